@@ -36,10 +36,12 @@ func buildCPIO() *cobra.Command {
 	var buildArch string
 	var sbomPath string
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var extraPackages []string
 	var sizeLimits options.SizeLimits
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use:     "build-cpio",
@@ -49,11 +51,17 @@ func buildCPIO() *cobra.Command {
 		Hidden:  true,
 		Args:    cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
 			return BuildCPIOCmd(cmd.Context(), args[1],
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
 				build.WithExtraPackages(extraPackages),
 				build.WithBuildDate(buildDate),
 				build.WithSBOM(sbomPath),
@@ -67,10 +75,12 @@ func buildCPIO() *cobra.Command {
 	cmd.Flags().StringVar(&buildArch, "build-arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate an SBOM")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	addClientLimitFlags(cmd, &sizeLimits)
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
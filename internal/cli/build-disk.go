@@ -0,0 +1,128 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func buildDisk() *cobra.Command {
+	var buildDate string
+	var buildArch string
+	var format string
+	var ignoreSignatures bool
+	var requireSigned bool
+	var runScriptlets bool
+	var scriptletSandbox string
+	var scriptletPackages []string
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var extraPackages []string
+	var sizeLimits options.SizeLimits
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "build-disk",
+		Short: "Build a bootable disk image from a YAML configuration file",
+		Long: `Build a bootable disk image from a YAML configuration file, with the
+kernel, bootloader and partitions of its disk section, for virtual machines.
+
+The disk image is raw, unless the output ends in .qcow2 or --format is set.
+Making it needs mkfs.ext4 and debugfs, from e2fsprogs, mkfs.vfat, from
+dosfstools, and mmd and mcopy, from mtools, for the EFI system partition, and
+qemu-img for qcow2.`,
+		Example: `  apko build-disk <config.yaml> <output.img>
+  apko build-disk <config.yaml> <output.qcow2>`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return BuildDiskCmd(cmd.Context(), args[1], format,
+				build.WithConfig(args[0], []string{}),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithExtraPackages(extraPackages),
+				build.WithBuildDate(buildDate),
+				build.WithArch(types.ParseArchitecture(buildArch)),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithRequireSignedPackages(requireSigned),
+				build.WithRunScriptlets(runScriptlets, scriptletSandbox, scriptletPackages),
+				build.WithSizeLimits(sizeLimits),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image")
+	cmd.Flags().StringVar(&buildArch, "build-arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
+	cmd.Flags().StringVar(&format, "format", "", "format to write the disk image in: raw or qcow2 (default is from the extension of the output)")
+	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().BoolVar(&requireSigned, "require-signed-packages", false, "fail unless every installed package is signed by a key in the keyring and matches the checksum in its repository index")
+	cmd.Flags().BoolVar(&runScriptlets, "run-scriptlets", false, "run the pre-install and post-install scripts of installed packages in a sandbox")
+	cmd.Flags().StringVar(&scriptletSandbox, "scriptlet-sandbox", build.ScriptletSandboxProot, "sandbox to run scriptlets in with --run-scriptlets: proot, which runs other architectures with qemu-user, chroot, which needs root, or bwrap")
+	cmd.Flags().StringSliceVar(&scriptletPackages, "scriptlet-package", nil, "packages allowed to run scriptlets with --run-scriptlets (default is all of them)")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	addClientLimitFlags(cmd, &sizeLimits)
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// BuildDiskCmd builds a disk image of the configured image for one
+// architecture and writes it to dest in format, or in the format
+// build.DiskFormatOf gives for dest when it is empty.
+func BuildDiskCmd(ctx context.Context, dest, format string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	bc, err := build.New(ctx, tarfs.New(), opts...)
+	if err != nil {
+		return err
+	}
+
+	ic := bc.ImageConfiguration()
+	if len(ic.Archs) != 0 {
+		log.Warnf("ignoring archs in config, only building for current arch (%s)", bc.Arch())
+	}
+
+	if format == "" {
+		format = build.DiskFormatOf(dest)
+	}
+	log.Infof("building %s disk image %s", format, dest)
+	if err := bc.BuildDisk(ctx, format, dest); err != nil {
+		return fmt.Errorf("failed to build disk image: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/u-root/u-root/pkg/mount/gpt"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBuildDisk(t *testing.T) {
+	for _, tool := range []string{"mkfs.ext4", "debugfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("building a disk image needs %s", tool)
+		}
+	}
+	ctx := context.Background()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, append(b, []byte(`
+disk:
+  bootloader: none
+  partitions:
+    - type: root
+      label: rootfs
+      size: 32MiB
+`)...), 0o644))
+
+	dest := filepath.Join(t.TempDir(), "disk.img")
+	opts := []build.Option{
+		build.WithConfig(config, []string{}),
+		build.WithArch(types.ParseArchitecture("amd64")),
+	}
+	require.NoError(t, cli.BuildDiskCmd(ctx, dest, "", opts...))
+
+	f, err := os.Open(dest)
+	require.NoError(t, err)
+	defer f.Close()
+	table, err := gpt.New(f)
+	require.NoError(t, err)
+	root := table.Primary.Parts[0]
+	require.Equal(t, "4f68bce3-e8cd-4db1-96e7-fbcaf984b709", root.PartGUID.String())
+	require.Equal(t, uint64(2048), root.FirstLBA)
+	require.Equal(t, uint64(2048+32*2048-1), root.LastLBA)
+
+	// The root partition holds an ext4 filesystem.
+	magic := make([]byte, 2)
+	_, err = f.ReadAt(magic, int64(root.FirstLBA)*512+1080)
+	require.NoError(t, err)
+	require.Equal(t, uint16(0xef53), binary.LittleEndian.Uint16(magic))
+
+	// The same configuration makes the same disk.
+	again := filepath.Join(t.TempDir(), "disk.img")
+	require.NoError(t, cli.BuildDiskCmd(ctx, again, "", opts...))
+	want, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	got, err := os.ReadFile(again)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	require.ErrorContains(t, cli.BuildDiskCmd(ctx, dest, "vmdk", opts...), `unknown disk format "vmdk"`)
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBuildFS(t *testing.T) {
+	ctx := context.Background()
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithArch(types.ParseArchitecture("amd64")),
+	}
+	tmp := t.TempDir()
+
+	tarNames := func(r io.Reader) map[string]bool {
+		names := map[string]bool{}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return names
+			}
+			require.NoError(t, err)
+			names[hdr.Name] = true
+		}
+	}
+
+	t.Run("tar", func(t *testing.T) {
+		dest := filepath.Join(tmp, "rootfs.tar")
+		require.NoError(t, cli.BuildFSCmd(ctx, dest, "", opts...))
+		f, err := os.Open(dest)
+		require.NoError(t, err)
+		defer f.Close()
+		require.True(t, tarNames(f)["etc/os-release"])
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		dest := filepath.Join(tmp, "rootfs.tgz")
+		require.NoError(t, cli.BuildFSCmd(ctx, dest, "", opts...))
+		f, err := os.Open(dest)
+		require.NoError(t, err)
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		require.True(t, tarNames(zr)["etc/os-release"])
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		dest := filepath.Join(tmp, "rootfs")
+		require.NoError(t, cli.BuildFSCmd(ctx, dest, "", opts...))
+		b, err := os.ReadFile(filepath.Join(dest, "etc", "os-release"))
+		require.NoError(t, err)
+		require.NotEmpty(t, b)
+		fi, err := os.Lstat(filepath.Join(dest, "etc", "apk", "world"))
+		require.NoError(t, err)
+		require.True(t, fi.Mode().IsRegular())
+
+		// It is only written into an empty directory.
+		require.ErrorContains(t, cli.BuildFSCmd(ctx, dest, build.RootFSFormatDir, opts...), "is not empty")
+	})
+
+	require.ErrorContains(t, cli.BuildFSCmd(ctx, filepath.Join(tmp, "rootfs.img"), "img", opts...), `unknown filesystem format "img"`)
+}
@@ -35,11 +35,17 @@ func buildMinirootFS() *cobra.Command {
 	var buildArch string
 	var sbomPath string
 	var ignoreSignatures bool
+	var requireSigned bool
+	var runScriptlets bool
+	var scriptletSandbox string
+	var scriptletPackages []string
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var extraPackages []string
 	var sizeLimits options.SizeLimits
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use:     "build-minirootfs",
@@ -48,17 +54,25 @@ func buildMinirootFS() *cobra.Command {
 		Example: `  apko build-minirootfs <config.yaml> <output.tar.gz>`,
 		Args:    cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
 			return BuildMinirootFSCmd(cmd.Context(),
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
 				build.WithExtraPackages(extraPackages),
 				build.WithTarball(args[1]),
 				build.WithBuildDate(buildDate),
 				build.WithSBOM(sbomPath),
 				build.WithArch(types.ParseArchitecture(buildArch)),
 				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithRequireSignedPackages(requireSigned),
+				build.WithRunScriptlets(runScriptlets, scriptletSandbox, scriptletPackages),
 				build.WithSizeLimits(sizeLimits),
 			)
 		},
@@ -68,11 +82,17 @@ func buildMinirootFS() *cobra.Command {
 	cmd.Flags().StringVar(&buildArch, "build-arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate an SBOM")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().BoolVar(&requireSigned, "require-signed-packages", false, "fail unless every installed package is signed by a key in the keyring and matches the checksum in its repository index")
+	cmd.Flags().BoolVar(&runScriptlets, "run-scriptlets", false, "run the pre-install and post-install scripts of installed packages in a sandbox")
+	cmd.Flags().StringVar(&scriptletSandbox, "scriptlet-sandbox", build.ScriptletSandboxProot, "sandbox to run scriptlets in with --run-scriptlets: proot, which runs other architectures with qemu-user, chroot, which needs root, or bwrap")
+	cmd.Flags().StringSliceVar(&scriptletPackages, "scriptlet-package", nil, "packages allowed to run scriptlets with --run-scriptlets (default is all of them)")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	addClientLimitFlags(cmd, &sizeLimits)
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
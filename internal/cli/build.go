@@ -21,14 +21,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"slices"
-	"sync"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
-	"go.opentelemetry.io/otel"
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/sys/unix"
 
 	"github.com/chainguard-dev/clog"
@@ -39,27 +35,36 @@ import (
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom/generator"
-	"chainguard.dev/apko/pkg/tarfs"
 )
 
 func buildCmd() *cobra.Command {
-	var withVCS bool
-	var buildDate string
 	var archstrs []string
 	var writeSBOM bool
 	var sbomPath string
 	var sbomFormats []string
+	var sbomVersions []string
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
-	var extraPackages []string
-	var rawAnnotations []string
 	var cacheDir string
 	var offline bool
-	var lockfile string
+	var vendorDir string
 	var includePaths []string
 	var ignoreSignatures bool
+	var requireSigned bool
+	var validateRuntime bool
 	var sizeLimits options.SizeLimits
+	var topts transportOptions
+	var bopts buildArgOptions
+	var iopts imageOptions
+	var layoutDir string
+	var jobs int
+	var maxSize, maxLayerSize string
+	var policies []string
+	var reproducibilityCheck bool
+	var load bool
+	var target oci.LocalTarget
 
 	cmd := &cobra.Command{
 		Use:   "build",
@@ -71,25 +76,69 @@ command, e.g.
 
   # docker load < output.tar
 
+With --oci-layout-dir, the image is instead added to an OCI image layout,
+which tools like skopeo, buildah and crane can consume directly, e.g.
+
+  # apko build --oci-layout-dir ./layout <config.yaml> <tag>
+  # skopeo copy oci:./layout:<tag> docker://...
+
+With --load, the image is instead streamed straight to the Docker daemon that
+DOCKER_HOST points at, without writing a tarball, or with --local-target to
+Podman or to a containerd namespace. Of a multi-architecture build, only the
+image for the host's platform is loaded, or the one GOOS and GOARCH select,
+e.g.
+
+  # apko build --load <config.yaml> <tag>
+  # apko build --load --local-target=containerd --namespace=k8s.io <config.yaml> <tag>
+
+The configuration may also be fetched from an https:// URL, optionally pinned
+with a #sha256:<hex> fragment, or from an oci:// reference to an artifact such
+as the build inputs apko publishes alongside an image, e.g.
+
+  # apko build https://example.com/apko.yaml#sha256:<hex> <tag> output.tar
+  # apko build oci://registry.example.com/configs/base@sha256:<hex> <tag> output.tar
+
 Along the image, apko will generate SBOMs (software bill of materials) describing the image contents.
 `,
-		Example: `  apko build <config.yaml> <tag> <output.tar|oci-layout-dir/>`,
+		Example: `  apko build <config.yaml> <tag> <output.tar|oci-layout-dir/>
+  apko build --oci-layout-dir <oci-layout-dir> <config.yaml> <tag>
+  apko build --load <config.yaml> <tag>`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) != 3 {
+			switch {
+			case load && layoutDir != "":
+				return fmt.Errorf("--load and --oci-layout-dir are mutually exclusive")
+			case !load && cmd.Flags().Changed("local-target"):
+				return fmt.Errorf("--local-target requires --load")
+			case load && len(args) != 2:
+				return fmt.Errorf("requires 2 arg with --load: 1 config file and a tag for the image")
+			case layoutDir != "" && len(args) != 2:
+				return fmt.Errorf("requires 2 arg with --oci-layout-dir: 1 config file and a tag for the image")
+			case layoutDir == "" && len(args) != 3:
 				return fmt.Errorf("requires 3 arg: 1 config file, a tag for the image, and an output path")
 			}
 
 			// TODO(kaniini): Print warning when multi-arch build is requested
 			// and ignored by the build system.
 			archs := types.ParseArchitectures(archstrs)
-			annotations, err := parseAnnotations(rawAnnotations)
+			imageOpts, err := iopts.buildOptions()
 			if err != nil {
-				return fmt.Errorf("parsing annotations from command line: %w", err)
+				return err
 			}
 
 			var sbomGenerators []generator.Generator
 			if writeSBOM && len(sbomFormats) > 0 {
-				sbomGenerators = generator.Generators(sbomFormats...)
+				if sbomGenerators, err = newSBOMGenerators(sbomFormats, sbomVersions); err != nil {
+					return err
+				}
+			}
+
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
 			}
 
 			tmp, err := os.MkdirTemp(os.TempDir(), "apko-temp-*")
@@ -98,255 +147,177 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 			}
 			defer os.RemoveAll(tmp)
 
-			return BuildCmd(cmd.Context(), args[1], args[2], archs,
-				[]string{args[1]},
-				writeSBOM,
-				sbomPath,
+			opts := []build.Option{
+				build.WithConfigVariables(vars),
 				build.WithConfig(args[0], includePaths),
-				build.WithBuildDate(buildDate),
 				build.WithSBOM(sbomPath),
 				build.WithSBOMGenerators(sbomGenerators...),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
-				build.WithExtraPackages(extraPackages),
 				build.WithTags(args[1]),
-				build.WithVCS(withVCS),
-				build.WithAnnotations(annotations),
-				build.WithCache(cacheDir, offline, apk.NewCache(true)),
-				build.WithLockFile(lockfile),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
 				build.WithTempDir(tmp),
 				build.WithIncludePaths(includePaths),
 				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithRequireSignedPackages(requireSigned),
+				build.WithValidateRuntime(validateRuntime),
 				build.WithSizeLimits(sizeLimits),
-			)
+				build.WithTransport(transport),
+				build.WithJobs(jobs),
+				build.WithMaxSize(maxSize, maxLayerSize),
+				build.WithPolicies(policies...),
+				build.WithVendorDir(vendorDir),
+			}
+			opts = append(opts, imageOpts...)
+			ctx := cmd.Context()
+			if load {
+				if err := target.Validate(); err != nil {
+					return err
+				}
+				return buildAndWrite(ctx, archs, sbomPath, reproducibilityCheck, writeLocal(ctx, target, []string{args[1]}), opts...)
+			}
+			if layoutDir != "" {
+				return buildAndWrite(ctx, archs, sbomPath, reproducibilityCheck, writeLayout(ctx, layoutDir, []string{args[1]}), opts...)
+			}
+			return buildAndWrite(ctx, archs, sbomPath, reproducibilityCheck, writeBuild(ctx, args[1], args[2], []string{args[1]}), opts...)
 		},
 	}
 
-	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
-	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image in RFC3339 format")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate SBOMs")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate SBOMs in dir (defaults to image directory)")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", []string{"spdx"}, "SBOM formats to output")
+	cmd.Flags().StringSliceVar(&sbomVersions, "sbom-format-version", []string{}, "version of an SBOM format to output, as format=version (e.g. spdx=2.2); defaults to the latest supported")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
-	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
-	cmd.Flags().StringSliceVar(&rawAnnotations, "annotations", []string{}, "OCI annotations to add. Separate with colon (key:value)")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
-	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
+	cmd.Flags().StringVar(&vendorDir, "vendor-dir", "", "build offline from a directory written by apko vendor, after checking it against its manifest")
 	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append.")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().BoolVar(&requireSigned, "require-signed-packages", false, "fail unless every installed package is signed by a key in the keyring and matches the checksum in its repository index")
+	cmd.Flags().BoolVar(&validateRuntime, "validate-runtime", false, "fail unless the entrypoint program, work-dir and run-as user of the image exist in its filesystem")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "fail the build if the compressed layers of the image of an architecture add up to more than this size, e.g. 100MiB; overrides max-size.image in the config")
+	cmd.Flags().StringVar(&maxLayerSize, "max-layer-size", "", "fail the build if a compressed layer of the image is larger than this size, e.g. 50MiB; overrides max-size.layer in the config")
+	cmd.Flags().StringSliceVar(&policies, "policy", []string{}, "fail the build if it violates this Rego (.rego, queried for data.apko.deny with opa) or CUE (.cue, vetted with cue) policy, evaluated against the config, the installed packages and the SBOMs")
+	cmd.Flags().IntVar(&jobs, "jobs", 0, "maximum number of architectures to build concurrently (0 builds all of them at once)")
+	cmd.Flags().BoolVar(&reproducibilityCheck, "reproducibility-check", false, "build the image twice and fail if the two builds differ")
+	cmd.Flags().StringVar(&layoutDir, "oci-layout-dir", "", "add the image to the OCI image layout in this directory, created if needed, instead of writing a tarball")
+	cmd.Flags().BoolVar(&load, "load", false, "load the image into the local Docker daemon, only for the host's platform if several architectures are built, instead of writing a tarball")
+	addLocalTargetFlags(cmd, &target)
 	addClientLimitFlags(cmd, &sizeLimits)
+	addTransportFlags(cmd, &topts)
+	addBuildArgFlags(cmd, &bopts)
+	addImageFlags(cmd, &iopts)
 	return cmd
 }
 
 func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, opts ...build.Option) error {
-	log := clog.FromContext(ctx)
-	wd, err := os.MkdirTemp("", "apko-*")
-	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
-	}
-	defer os.RemoveAll(wd)
-
-	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, opts...)
-	if err != nil {
-		return err
-	}
+	return buildAndWrite(ctx, archs, sbomPath, false, writeBuild(ctx, imageRef, output, tags), opts...)
+}
 
-	if fi, err := os.Stat(output); err == nil && fi.IsDir() {
-		// bundle the parts of the image into a tarball
-		if _, err := layout.Write(output, idx); err != nil {
-			return fmt.Errorf("writing image layout: %w", err)
-		}
-		log.Debugf("Final image layout at: %s", output)
-	} else {
-		// bundle the parts of the image into a tarball
-		if _, err := oci.BuildIndex(output, idx, append([]string{imageRef}, tags...)); err != nil {
-			return fmt.Errorf("bundling image: %w", err)
+// writeBuild writes the index to a tarball, or adds it to an OCI image layout
+// if output is a directory.
+func writeBuild(ctx context.Context, imageRef, output string, tags []string) func(v1.ImageIndex) error {
+	log := clog.FromContext(ctx)
+	return func(idx v1.ImageIndex) error {
+		if fi, err := os.Stat(output); err == nil && fi.IsDir() {
+			// bundle the parts of the image into a tarball
+			if _, err := layout.Write(output, idx); err != nil {
+				return fmt.Errorf("writing image layout: %w", err)
+			}
+			log.Debugf("Final image layout at: %s", output)
+		} else {
+			// bundle the parts of the image into a tarball
+			if _, err := oci.BuildIndex(output, idx, append([]string{imageRef}, tags...)); err != nil {
+				return fmt.Errorf("bundling image: %w", err)
+			}
+			log.Debugf("Final index tgz at: %s", output)
 		}
-		log.Debugf("Final index tgz at: %s", output)
+		return nil
 	}
+}
 
-	// copy sboms over to the sbomPath target directory
-	for _, sbom := range sboms {
-		// because os.Rename fails across partitions, we do our own
-		if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
-			return fmt.Errorf("moving sbom: %w", err)
-		}
-	}
-	return nil
+// BuildLayoutCmd builds an image and adds it to the OCI image layout at dir
+// under each of tags.
+func BuildLayoutCmd(ctx context.Context, dir string, archs []types.Architecture, tags []string, sbomPath string, opts ...build.Option) error {
+	return buildAndWrite(ctx, archs, sbomPath, false, writeLayout(ctx, dir, tags), opts...)
 }
 
-// buildImage build all of the components of an image in a single working directory.
-// Each layer is a separate file, as are config, manifests, index and sbom.
-func buildImageComponents(ctx context.Context, workDir string, archs []types.Architecture, opts ...build.Option) (idx v1.ImageIndex, sboms []types.SBOM, err error) {
+// writeLayout adds the index to the OCI image layout at dir under each of
+// tags.
+func writeLayout(ctx context.Context, dir string, tags []string) func(v1.ImageIndex) error {
 	log := clog.FromContext(ctx)
-	ctx, span := otel.Tracer("apko").Start(ctx, "buildImageComponents")
-	defer span.End()
-
-	o, ic, err := build.NewOptions(opts...)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
-		return nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
-	}
-
-	// cases:
-	// - archs set: use those archs
-	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
-	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
-	switch {
-	case len(archs) != 0:
-		ic.Archs = archs
-	case len(ic.Archs) != 0:
-		// do nothing
-	default:
-		ic.Archs = types.AllArchs
+	return func(idx v1.ImageIndex) error {
+		if err := oci.WriteLayout(ctx, dir, idx, tags); err != nil {
+			return err
+		}
+		log.Debugf("Final image layout at: %s", dir)
+		return nil
 	}
-	// save the final set we will build
-	log.Debugf("Building images for %d architectures: %+v", len(ic.Archs), ic.Archs)
+}
 
-	// Probe the VCS URL if it is not set and we are asked to do so.
-	if o.WithVCS && ic.VCSUrl == "" {
-		ic.ProbeVCSUrl(ctx, o.ImageConfigFile)
+// BuildLoadCmd builds an image and loads it into the local image store of
+// target under each of tags.
+func BuildLoadCmd(ctx context.Context, target oci.LocalTarget, archs []types.Architecture, tags []string, sbomPath string, opts ...build.Option) error {
+	if err := target.Validate(); err != nil {
+		return err
 	}
+	return buildAndWrite(ctx, archs, sbomPath, false, writeLocal(ctx, target, tags), opts...)
+}
 
-	// The build context options is sometimes copied in the next functions. Ensure
-	// we have the directory defined and created by invoking the function early.
-
-	// workDir, passed to us, is where we will lay out the various image filesystems
-	// under it we will have:
-	//  <arch>/ - the rootfs for each architecture
-	//  image/ - the summary layer files and sboms for each architecture
-	// imageDir, created here, is where the final artifacts will be: layer tars, indexes, etc.
-
-	log.Debugf("building tags %v", o.Tags)
-
-	var errg errgroup.Group
-	imageDir := filepath.Join(workDir, "image")
-	if err := os.MkdirAll(imageDir, 0755); err != nil {
-		return nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
+// writeLocal loads the image for the host's platform into the local image
+// store of target, tagged with tags.
+func writeLocal(ctx context.Context, target oci.LocalTarget, tags []string) func(v1.ImageIndex) error {
+	log := clog.FromContext(ctx)
+	return func(idx v1.ImageIndex) error {
+		ref, err := oci.LoadIndexInto(ctx, target, idx, tags)
+		if err != nil {
+			return fmt.Errorf("loading index: %w", err)
+		}
+		log.Infof("loaded image locally as %s", ref)
+		return nil
 	}
-	opts = append(opts, build.WithSBOM(imageDir))
-
-	imgs := map[types.Architecture]v1.Image{}
-
-	mtx := sync.Mutex{}
-
-	// We compute the "build date epoch" of the multi-arch image to be the
-	// maximum "build date epoch" of the per-arch images.  If the user has
-	// explicitly set SOURCE_DATE_EPOCH, that will always trump this
-	// computation.
-	multiArchBDE := o.SourceDateEpoch
+}
 
-	configs, _, err := build.LockImageConfiguration(ctx, *ic, opts...)
+// buildAndWrite builds the image, hands the index to write and moves the
+// SBOMs to sbomPath. If check is set, the image is built a second time first,
+// and nothing is written if the two builds differ.
+func buildAndWrite(ctx context.Context, archs []types.Architecture, sbomPath string, check bool, write func(v1.ImageIndex) error, opts ...build.Option) error {
+	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
-		return nil, nil, fmt.Errorf("locking config: %w", err)
-	}
-
-	for arch, ic := range configs {
-		errg.Go(func() error {
-			if arch == "index" {
-				return nil
-			}
-
-			arch := types.ParseArchitecture(arch)
-			log := log.With("arch", arch.ToAPK())
-			ctx := clog.WithLogger(ctx, log)
-
-			opts := slices.Clone(opts)
-			opts = append(opts, build.WithArch(arch), build.WithImageConfiguration(*ic))
-
-			bc, err := build.New(ctx, tarfs.New(), opts...)
-			if err != nil {
-				return fmt.Errorf("new build for arch %s: %w", arch, err)
-			}
-			layers, err := bc.BuildLayers(ctx)
-			if err != nil {
-				return fmt.Errorf("building %q layer: %w", arch, err)
-			}
-
-			// Compute the "build date epoch" from the packages that were
-			// installed.  The "build date epoch" is the MAX of the builddate
-			// embedded in the installed APKs.  If SOURCE_DATE_EPOCH is
-			// explicitly set by the user, that trumps this.
-			// This computation will only affect the timestamp of the image
-			// itself and its SBOMs, since the timestamps on files come from the
-			// APKs.
-			bde, err := bc.GetBuildDateEpoch()
-			if err != nil {
-				return fmt.Errorf("failed to determine build date epoch: %w", err)
-			}
-
-			img, err := oci.BuildImageFromLayers(ctx, bc.BaseImage(), layers, bc.ImageConfiguration(), bde, bc.Arch())
-			if err != nil {
-				return fmt.Errorf("failed to build OCI image for %q: %w", arch, err)
-			}
-
-			var outputs []types.SBOM
-			if len(o.SBOMGenerators) != 0 {
-				outputs, err = bc.GenerateImageSBOM(ctx, arch, img)
-				if err != nil {
-					return fmt.Errorf("generating sbom for %s: %w", arch, err)
-				}
-			}
-
-			mtx.Lock()
-			defer mtx.Unlock()
-
-			imgs[arch] = img
-
-			if bde.After(multiArchBDE) {
-				multiArchBDE = bde
-			}
-
-			if len(o.SBOMGenerators) != 0 {
-				sboms = append(sboms, outputs...)
-			}
-
-			return nil
-		})
-	}
-	if err := errg.Wait(); err != nil {
-		return nil, nil, err
+		return fmt.Errorf("failed to create working directory: %w", err)
 	}
+	defer os.RemoveAll(wd)
 
-	// generate the index
-	finalDigest, idx, err := oci.GenerateIndex(ctx, *ic, imgs, multiArchBDE)
+	// build all of the components in the working directory
+	idx, sboms, err := build.BuildIndex(ctx, wd, archs, opts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
+		return err
 	}
 
-	opts = append(opts,
-		build.WithImageConfiguration(*ic),       // We mutate Archs above.
-		build.WithSourceDateEpoch(multiArchBDE), // Maximum child's time.
-	)
-
-	o, ic, err = build.NewOptions(opts...)
-	if err != nil {
-		return nil, nil, err
+	if check {
+		if err := checkReproducible(ctx, idx, archs, opts...); err != nil {
+			return err
+		}
 	}
 
-	if _, err := build.WriteIndex(ctx, o, idx); err != nil {
-		return nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
+	if err := write(idx); err != nil {
+		return err
 	}
 
-	// the sboms are saved to the same working directory as the image components
-	if len(o.SBOMGenerators) != 0 {
-		files, err := build.GenerateIndexSBOM(ctx, *o, *ic, finalDigest, imgs)
-		if err != nil {
-			return nil, nil, fmt.Errorf("generating index SBOM: %w", err)
+	// copy sboms over to the sbomPath target directory
+	for _, sbom := range sboms {
+		// because os.Rename fails across partitions, we do our own
+		if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
+			return fmt.Errorf("moving sbom: %w", err)
 		}
-		sboms = append(sboms, files...)
 	}
-
-	return idx, sboms, nil
+	return nil
 }
 
 // rename just like os.Rename, but does a copy and delete if the rename fails
@@ -0,0 +1,55 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// buildArgOptions configures the substitution of ${VAR} references in the
+// configuration.
+type buildArgOptions struct {
+	// args are KEY=value pairs, or bare KEYs taking their value from the
+	// environment.
+	args []string
+	// strict fails on references to undefined variables.
+	strict bool
+}
+
+// variables returns the variables described by bopts, or nil if no build
+// args were given, leaving the configuration as written.
+func (bopts buildArgOptions) variables() (*types.Variables, error) {
+	if len(bopts.args) == 0 && !bopts.strict {
+		return nil, nil
+	}
+	vars := &types.Variables{Values: map[string]string{}, Strict: bopts.strict}
+	for _, arg := range bopts.args {
+		k, v, ok := strings.Cut(arg, "=")
+		if k == "" {
+			return nil, fmt.Errorf("malformed build arg %q, expected KEY=value", arg)
+		}
+		if !ok {
+			if v, ok = os.LookupEnv(k); !ok {
+				return nil, fmt.Errorf("build arg %s is not set in the environment", k)
+			}
+		}
+		vars.Values[k] = v
+	}
+	return vars, nil
+}
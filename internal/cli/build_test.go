@@ -15,21 +15,29 @@
 package cli_test
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/internal/cli"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 )
 
@@ -155,3 +163,347 @@ func TestBuildWithBase(t *testing.T) {
 
 	require.Equal(t, want, got)
 }
+
+func TestBuildWithBaseTarball(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	// The base image as a tarball, whose installed packages are read from it.
+	base, err := layout.ImageIndexFromPath(filepath.Join("testdata", "base_image"))
+	require.NoError(t, err)
+	refs := map[name.Reference]v1.Image{}
+	im, err := base.IndexManifest()
+	require.NoError(t, err)
+	for i, m := range im.Manifests {
+		img, err := base.Image(m.Digest)
+		require.NoError(t, err)
+		tag, err := name.NewTag(fmt.Sprintf("base:%d", i))
+		require.NoError(t, err)
+		refs[tag] = img
+	}
+	baseTarball := filepath.Join(tmp, "base.tar")
+	require.NoError(t, tarball.MultiRefWriteToFile(baseTarball, refs))
+
+	b, err := os.ReadFile(filepath.Join("testdata", "image_on_top.apko.yaml"))
+	require.NoError(t, err)
+	b = bytes.Replace(b, []byte("image: ./testdata/base_image/\n    apkindex: ./testdata/base_image/metadata/"), []byte("image: "+baseTarball), 1)
+	config := filepath.Join(tmp, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, b, 0o644))
+
+	// The same packages are locked, for a config with another checksum.
+	b, err = os.ReadFile(filepath.Join("testdata", "image_on_top.apko.lock.json"))
+	require.NoError(t, err)
+	var lock map[string]any
+	require.NoError(t, json.Unmarshal(b, &lock))
+	delete(lock, "config")
+	b, err = json.Marshal(lock)
+	require.NoError(t, err)
+	lockfile := filepath.Join(tmp, "apko.lock.json")
+	require.NoError(t, os.WriteFile(lockfile, b, 0o644))
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithTags("golden_top:latest"), build.WithLockFile(lockfile), build.WithTempDir(t.TempDir())}
+	out := t.TempDir()
+	require.NoError(t, cli.BuildCmd(ctx, "golden_top:latest", out, archs, []string{}, true, "", opts...))
+
+	root, err := layout.ImageIndexFromPath(out)
+	require.NoError(t, err)
+	idx, err := root.IndexManifest()
+	require.NoError(t, err)
+	for _, m := range idx.Manifests {
+		img, err := root.Image(m.Digest)
+		require.NoError(t, err)
+		layers, err := img.Layers()
+		require.NoError(t, err)
+		// The layer of the base image is reused, under the one apko built.
+		require.Len(t, layers, 2)
+		lower, err := layers[0].Digest()
+		require.NoError(t, err)
+		found := false
+		for _, bm := range im.Manifests {
+			bimg, err := base.Image(bm.Digest)
+			require.NoError(t, err)
+			blayers, err := bimg.Layers()
+			require.NoError(t, err)
+			d, err := blayers[0].Digest()
+			require.NoError(t, err)
+			found = found || d == lower
+		}
+		require.True(t, found, "lower layer %s is not from the base image", lower)
+	}
+}
+
+func TestBuildLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "layout")
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+	}
+
+	// Builds accumulate in the same layout.
+	require.NoError(t, cli.BuildLayoutCmd(ctx, dir, archs, []string{"example.com/app:v1", "example.com/app:latest"}, t.TempDir(), opts...))
+	require.NoError(t, cli.BuildLayoutCmd(ctx, dir, archs, []string{"example.com/app:v2"}, t.TempDir(), opts...))
+
+	root, err := layout.ImageIndexFromPath(dir)
+	require.NoError(t, err)
+	im, err := root.IndexManifest()
+	require.NoError(t, err)
+
+	var names []string
+	for _, m := range im.Manifests {
+		names = append(names, m.Annotations["org.opencontainers.image.ref.name"])
+	}
+	require.Equal(t, []string{"v1", "latest", "v2"}, names)
+
+	idx, err := root.ImageIndex(im.Manifests[0].Digest)
+	require.NoError(t, err)
+	require.NoError(t, validate.Index(idx))
+}
+
+func TestBuildArchOverrides(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+	b = append(b, []byte(`
+environment:
+  FOO: all
+  BAR: all
+arch-overrides:
+  aarch64:
+    environment:
+      FOO: arm
+    entrypoint:
+      command: /bin/true
+`)...)
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, b, 0o644))
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	require.NoError(t, cli.BuildCmd(ctx, "overrides:latest", tmp, archs, []string{}, false, "", build.WithConfig(config, []string{})))
+
+	root, err := layout.ImageIndexFromPath(tmp)
+	require.NoError(t, err)
+	im, err := root.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 2)
+
+	for _, m := range im.Manifests {
+		img, err := root.Image(m.Digest)
+		require.NoError(t, err)
+		cfg, err := img.ConfigFile()
+		require.NoError(t, err)
+
+		switch m.Platform.Architecture {
+		case "arm64":
+			require.Contains(t, cfg.Config.Env, "FOO=arm")
+			require.Equal(t, []string{"/bin/true"}, cfg.Config.Entrypoint)
+		case "amd64":
+			require.Contains(t, cfg.Config.Env, "FOO=all")
+			require.Equal(t, []string{"/bin/sh", "-l"}, cfg.Config.Entrypoint)
+		default:
+			t.Fatalf("unexpected platform %v", m.Platform)
+		}
+		require.Contains(t, cfg.Config.Env, "BAR=all")
+	}
+}
+
+func TestBuildEvents(t *testing.T) {
+	var mu sync.Mutex
+	var got []events.Event
+	ctx := events.WithEmitter(context.Background(), events.EmitterFunc(func(ev events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, ev)
+	}))
+	tmp := t.TempDir()
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	require.NoError(t, cli.BuildCmd(ctx, "events:latest", tmp, archs, []string{}, false, "", build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{})))
+
+	total := map[string]int{}
+	count := map[events.Type]map[string]int{}
+	digests := map[string]string{}
+	for _, ev := range got {
+		if count[ev.Type] == nil {
+			count[ev.Type] = map[string]int{}
+		}
+		count[ev.Type][ev.Arch]++
+		switch ev.Type {
+		case events.PackagesResolved:
+			total[ev.Arch] += ev.Total
+		case events.LayerBuilt:
+			require.NotEmpty(t, ev.Digest)
+			require.NotZero(t, ev.Size)
+		case events.DigestComputed:
+			digests[ev.Arch] = ev.Digest
+		}
+	}
+	for _, arch := range []string{"x86_64", "aarch64"} {
+		require.NotZero(t, total[arch])
+		require.Equal(t, total[arch], count[events.PackageFetched][arch])
+		require.Equal(t, total[arch], count[events.PackageInstalled][arch])
+		require.Equal(t, 1, count[events.LayerBuilt][arch])
+	}
+	require.Contains(t, digests, "")
+
+	root, err := layout.ImageIndexFromPath(tmp)
+	require.NoError(t, err)
+	im, err := root.IndexManifest()
+	require.NoError(t, err)
+	for _, m := range im.Manifests {
+		arch := types.ParseArchitecture(m.Platform.Architecture).ToAPK()
+		require.Equal(t, m.Digest.String(), digests[arch])
+	}
+}
+
+func TestBuildJobs(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+
+	var digests []string
+	for _, jobs := range []int{0, 1} {
+		tmp := t.TempDir()
+		require.NoError(t, cli.BuildCmd(ctx, "jobs:latest", tmp, archs, []string{}, false, "",
+			build.WithConfig(config, []string{}), build.WithJobs(jobs)))
+		root, err := layout.ImageIndexFromPath(tmp)
+		require.NoError(t, err)
+		h, err := root.Digest()
+		require.NoError(t, err)
+		digests = append(digests, h.String())
+	}
+	// Bounding the concurrency doesn't change the result.
+	require.Equal(t, digests[0], digests[1])
+
+	require.Error(t, cli.BuildCmd(ctx, "jobs:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithJobs(-1)))
+}
+
+func TestBuildEstargz(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64"})
+
+	var digests []string
+	for range 2 {
+		tmp := t.TempDir()
+		require.NoError(t, cli.BuildCmd(ctx, "estargz:latest", tmp, archs, []string{}, false, "",
+			build.WithConfig(config, []string{}), build.WithLayerFormat(build.LayerFormatEstargz)))
+
+		root, err := layout.ImageIndexFromPath(tmp)
+		require.NoError(t, err)
+		im, err := root.IndexManifest()
+		require.NoError(t, err)
+		require.Len(t, im.Manifests, 1)
+		digests = append(digests, im.Manifests[0].Digest.String())
+
+		img, err := root.Image(im.Manifests[0].Digest)
+		require.NoError(t, err)
+		m, err := img.Manifest()
+		require.NoError(t, err)
+		require.Len(t, m.Layers, 1)
+		require.Contains(t, m.Layers[0].Annotations, "containerd.io/snapshot/stargz/toc.digest")
+
+		// eStargz layers are still plain gzipped tarballs to other runtimes.
+		layers, err := img.Layers()
+		require.NoError(t, err)
+		rc, err := layers[0].Uncompressed()
+		require.NoError(t, err)
+		var names []string
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+		}
+		require.NoError(t, rc.Close())
+		require.Contains(t, names, "stargz.index.json")
+		require.Contains(t, names, "etc/os-release")
+	}
+	require.Equal(t, digests[0], digests[1])
+
+	require.Error(t, cli.BuildCmd(ctx, "estargz:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithLayerFormat("zstd")))
+}
+
+func TestBuildMaxSize(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64"})
+
+	require.NoError(t, cli.BuildCmd(ctx, "max-size:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithMaxSize("100MiB", "100MiB")))
+
+	err := cli.BuildCmd(ctx, "max-size:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithMaxSize("1KiB", ""))
+	require.ErrorContains(t, err, "over the max-size of 1.0 KiB compressed; the largest packages installed are:")
+	require.ErrorContains(t, err, "pretend-baselayout-")
+
+	err = cli.BuildCmd(ctx, "max-size:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithMaxSize("", "1KiB"))
+	require.ErrorContains(t, err, "layer 0 is ")
+
+	require.ErrorContains(t, cli.BuildCmd(ctx, "max-size:latest", t.TempDir(), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithMaxSize("lots", "")), `parsing max image size "lots"`)
+}
+
+func TestBuildPolicy(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64"})
+
+	// opa is faked, denying nothing or everything, and keeps the input it
+	// is given.
+	bin := t.TempDir()
+	input := filepath.Join(t.TempDir(), "input.json")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "opa"), []byte(`#!/bin/sh
+cat > `+input+`
+if [ -n "$DENY" ]; then
+  echo '{"result": [{"expressions": [{"value": ["'"$DENY"'"]}]}]}'
+else
+  echo '{"result": [{"expressions": [{"value": []}]}]}'
+fi
+`), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	policy := filepath.Join(t.TempDir(), "policy.rego")
+	require.NoError(t, os.WriteFile(policy, []byte("package apko\n"), 0o644))
+
+	require.NoError(t, cli.BuildCmd(ctx, "policy:latest", filepath.Join(t.TempDir(), "image.tar"), archs, []string{}, true, t.TempDir(),
+		build.WithConfig(config, []string{}), build.WithSBOMFormats([]string{"spdx"}), build.WithPolicies(policy)))
+
+	b, err := os.ReadFile(input)
+	require.NoError(t, err)
+	var got struct {
+		Config struct {
+			Contents struct {
+				Packages []string `json:"packages"`
+			} `json:"contents"`
+		} `json:"config"`
+		Packages map[string][]struct {
+			Name       string `json:"name"`
+			Repository string `json:"repository"`
+		} `json:"packages"`
+		SBOMs map[string]struct {
+			SPDXVersion string `json:"spdxVersion"`
+		} `json:"sboms"`
+	}
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Contains(t, got.Config.Contents.Packages[0], "replayout")
+	require.NotEmpty(t, got.Packages["x86_64"])
+	for _, pkg := range got.Packages["x86_64"] {
+		require.Equal(t, "./testdata/packages", pkg.Repository, pkg.Name)
+	}
+	require.NotEmpty(t, got.SBOMs["x86_64"].SPDXVersion)
+
+	t.Setenv("DENY", "replayout is not allowed")
+	err = cli.BuildCmd(ctx, "policy:latest", filepath.Join(t.TempDir(), "image.tar"), archs, []string{}, false, "",
+		build.WithConfig(config, []string{}), build.WithPolicies(policy))
+	require.ErrorContains(t, err, "the build violates policies:\n  "+policy+": replayout is not allowed")
+}
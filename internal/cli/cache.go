@@ -0,0 +1,144 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+)
+
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Maintain the apko cache directory",
+		Long: `Maintain the cache of downloaded APK packages and APKINDEX files.
+
+The cache directory is taken from --cache-dir, then $APKO_CACHE_DIR, and
+otherwise defaults to the system cache directory.`,
+	}
+	cmd.AddCommand(cleanCmd())
+	cmd.AddCommand(pruneCmd())
+	return cmd
+}
+
+func pruneCmd() *cobra.Command {
+	var cacheDir string
+	var maxSize string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Evict the oldest cache entries until the cache fits in a size budget",
+		Example: `  apko cache prune --max-size 10GB
+  apko cache prune --max-size 500MiB --dry-run`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			limit, err := humanize.ParseBytes(maxSize)
+			if err != nil {
+				return fmt.Errorf("parsing --max-size: %w", err)
+			}
+			return PruneImpl(cmd.Context(), cacheDir, int64(limit), dryRun)
+		},
+	}
+
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory containing the apk cache (defaults to system cache directory)")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "largest size to keep the cache within, e.g. 10GB")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be evicted without deleting")
+	_ = cmd.MarkFlagRequired("max-size")
+
+	return cmd
+}
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// PruneImpl removes files from the cache, least recently downloaded first,
+// until the total size of the cache is at most maxSize bytes.
+func PruneImpl(ctx context.Context, cacheDir string, maxSize int64, dryRun bool) error {
+	log := clog.FromContext(ctx)
+
+	cacheDir, err := resolveCacheDir(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	var entries []cacheEntry
+	var total int64
+	if err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, cacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	}); err != nil {
+		if os.IsNotExist(err) {
+			log.Infof("Cache directory does not exist, nothing to prune")
+			return nil
+		}
+		return fmt.Errorf("failed to walk cache directory: %w", err)
+	}
+
+	log.Infof("Cache size: %s, limit: %s", formatBytes(total), formatBytes(maxSize))
+	if total <= maxSize {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	var evicted int64
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		log.Debugf("evicting %s (%s)", e.path, formatBytes(e.size))
+		if !dryRun {
+			if err := os.Remove(e.path); err != nil {
+				return fmt.Errorf("failed to evict %s: %w", e.path, err)
+			}
+		}
+		total -= e.size
+		evicted += e.size
+	}
+
+	if dryRun {
+		log.Infof("Dry run mode: would evict %s", formatBytes(evicted))
+		return nil
+	}
+	log.Infof("Evicted %s, cache size is now %s", formatBytes(evicted), formatBytes(total))
+	return nil
+}
@@ -22,31 +22,50 @@ import (
 
 	"github.com/chainguard-dev/clog"
 	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
 )
 
 func cleanCmd() *cobra.Command {
 	var cacheDir string
 	var dryRun bool
+	var localImages bool
+	var target oci.LocalTarget
 
 	cmd := &cobra.Command{
 		Use:   "clean",
 		Short: "Clean the apko cache directory",
 		Long: `Clean the apko cache directory by removing all cached APK packages and APKINDEX files.
 
-If no cache directory is specified, the default cache directory is used:
+If no cache directory is specified, $APKO_CACHE_DIR is used if set, and
+otherwise the default cache directory:
   - On Linux: ~/.cache/dev.chainguard.go-apk
   - On macOS: ~/Library/Caches/dev.chainguard.go-apk
-  - On Windows: %LocalAppData%\dev.chainguard.go-apk`,
+  - On Windows: %LocalAppData%\dev.chainguard.go-apk
+
+With --local-images, the images apko loaded into the local Docker or Podman
+image store as apko.local/cache:<digest> are removed instead. Images are
+only removed from the store once no other tag refers to them.`,
 		Example: `  apko clean
   apko clean --cache-dir /custom/cache/path
-  apko clean --dry-run`,
+  apko clean --dry-run
+  apko clean --local-images
+  apko clean --local-images --local-target podman`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if localImages {
+				return CleanLocalImagesImpl(cmd.Context(), target, dryRun)
+			}
 			return CleanImpl(cmd.Context(), cacheDir, dryRun)
 		},
 	}
 
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory containing the apk cache (defaults to system cache directory)")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show cache size without deleting")
+	cmd.Flags().BoolVar(&localImages, "local-images", false, "remove the images loaded into the local image store instead of the cache directory")
+	cmd.Flags().StringVar(&target.Store, "local-target", oci.LocalDocker, "image store to remove local images from with --local-images: docker or podman")
+	addLocalHostFlags(cmd, &target)
+	cmd.MarkFlagsMutuallyExclusive("local-images", "cache-dir")
 
 	return cmd
 }
@@ -54,20 +73,9 @@ If no cache directory is specified, the default cache directory is used:
 func CleanImpl(ctx context.Context, cacheDir string, dryRun bool) error {
 	log := clog.FromContext(ctx)
 
-	// Determine cache directory
-	if cacheDir == "" {
-		var err error
-		cacheDir, err = os.UserCacheDir()
-		if err != nil {
-			return fmt.Errorf("failed to determine user cache directory: %w", err)
-		}
-		cacheDir = filepath.Join(cacheDir, "dev.chainguard.go-apk")
-	} else {
-		var err error
-		cacheDir, err = filepath.Abs(cacheDir)
-		if err != nil {
-			return fmt.Errorf("failed to resolve cache directory path: %w", err)
-		}
+	cacheDir, err := resolveCacheDir(cacheDir)
+	if err != nil {
+		return err
 	}
 
 	log.Infof("Cleaning cache directory: %s", cacheDir)
@@ -108,6 +116,52 @@ func CleanImpl(ctx context.Context, cacheDir string, dryRun bool) error {
 	return nil
 }
 
+// CleanLocalImagesImpl removes the images loaded into the image store of
+// target from it, or only lists them with dryRun.
+func CleanLocalImagesImpl(ctx context.Context, target oci.LocalTarget, dryRun bool) error {
+	log := clog.FromContext(ctx)
+
+	refs, err := oci.CleanLocalImages(ctx, target, dryRun)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		log.Infof("No local images to clean")
+		return nil
+	}
+	if dryRun {
+		for _, ref := range refs {
+			fmt.Println(ref)
+		}
+		log.Infof("Dry run mode: %d local images will not be removed", len(refs))
+		return nil
+	}
+
+	log.Infof("Removed %d local images", len(refs))
+	return nil
+}
+
+// resolveCacheDir returns the absolute cache directory to operate on, falling
+// back to $APKO_CACHE_DIR and then the system cache directory when cacheDir is
+// empty, the same way builds do.
+func resolveCacheDir(cacheDir string) (string, error) {
+	if cacheDir == "" {
+		cacheDir = os.Getenv(build.CacheDirEnv)
+	}
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine user cache directory: %w", err)
+		}
+		return filepath.Join(dir, "dev.chainguard.go-apk"), nil
+	}
+	dir, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory path: %w", err)
+	}
+	return dir, nil
+}
+
 // calculateDirSize recursively calculates the total size of a directory
 func calculateDirSize(path string) (int64, error) {
 	var size int64
@@ -19,8 +19,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build"
 )
 
 func TestCleanImpl(t *testing.T) {
@@ -107,6 +110,70 @@ func TestCleanImpl(t *testing.T) {
 	})
 }
 
+func TestCleanImplCacheDirEnv(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.MkdirAll(cacheDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "test.apk"), []byte("dummy content"), 0644))
+	t.Setenv(build.CacheDirEnv, cacheDir)
+
+	require.NoError(t, CleanImpl(context.Background(), "", false))
+
+	_, err := os.Stat(cacheDir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPruneImpl(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) string {
+		cacheDir := t.TempDir()
+		now := time.Now()
+		// Oldest first: a.apk, b.apk, APKINDEX/c.tar.gz.
+		for i, file := range []string{"a.apk", "b.apk", "APKINDEX/c.tar.gz"} {
+			path := filepath.Join(cacheDir, file)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, make([]byte, 100), 0644))
+			mtime := now.Add(time.Duration(i-3) * time.Hour)
+			require.NoError(t, os.Chtimes(path, mtime, mtime))
+		}
+		return cacheDir
+	}
+
+	t.Run("evicts oldest first", func(t *testing.T) {
+		cacheDir := setup(t)
+		require.NoError(t, PruneImpl(ctx, cacheDir, 150, false))
+
+		_, err := os.Stat(filepath.Join(cacheDir, "a.apk"))
+		require.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(cacheDir, "b.apk"))
+		require.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(cacheDir, "APKINDEX/c.tar.gz"))
+		require.NoError(t, err)
+	})
+
+	t.Run("within budget", func(t *testing.T) {
+		cacheDir := setup(t)
+		require.NoError(t, PruneImpl(ctx, cacheDir, 300, false))
+
+		size, err := calculateDirSize(cacheDir)
+		require.NoError(t, err)
+		require.Equal(t, int64(300), size)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		cacheDir := setup(t)
+		require.NoError(t, PruneImpl(ctx, cacheDir, 0, true))
+
+		size, err := calculateDirSize(cacheDir)
+		require.NoError(t, err)
+		require.Equal(t, int64(300), size)
+	})
+
+	t.Run("non-existent cache directory", func(t *testing.T) {
+		require.NoError(t, PruneImpl(ctx, filepath.Join(t.TempDir(), "non-existent"), 0, false))
+	})
+}
+
 func TestCalculateDirSize(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -15,6 +15,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -25,10 +26,17 @@ import (
 	cranecmd "github.com/google/go-containerregistry/cmd/crane/cmd"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/release-utils/version"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 )
 
 func New() *cobra.Command {
 	var workDir string
+	var eventsFile string
+	var eventsOut *os.File
+	var showProgress bool
+	var allowUnknownFields bool
 	cwd, err := os.Getwd()
 	if err != nil {
 		cwd = ""
@@ -40,6 +48,31 @@ func New() *cobra.Command {
 		SilenceUsage:      true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			http.DefaultTransport = userAgentTransport{http.DefaultTransport}
+			var emitters []events.Emitter
+			switch eventsFile {
+			case "":
+			case "-":
+				// What commands print to stdout for scripts, such as the
+				// digest publish prints, is left out of the stream then.
+				emitters = append(emitters, events.NewJSONLines(os.Stdout))
+				cmd.SetContext(context.WithValue(cmd.Context(), eventsOnStdoutKey{}, true))
+			default:
+				f, err := os.Create(eventsFile)
+				if err != nil {
+					return fmt.Errorf("creating events file: %w", err)
+				}
+				eventsOut = f
+				emitters = append(emitters, events.NewJSONLines(f))
+			}
+			if showProgress {
+				emitters = append(emitters, newProgress(os.Stderr))
+			}
+			if len(emitters) != 0 {
+				cmd.SetContext(events.WithEmitter(cmd.Context(), events.Multi(emitters...)))
+			}
+			if allowUnknownFields {
+				cmd.SetContext(types.WithAllowUnknownFields(cmd.Context()))
+			}
 			if workDir != "" {
 				if err := os.Chdir(workDir); err != nil {
 					return fmt.Errorf("failed to change dir to %s: %w", workDir, err)
@@ -48,27 +81,60 @@ func New() *cobra.Command {
 			slog.SetDefault(slog.New(charmlog.NewWithOptions(os.Stderr, charmlog.Options{ReportTimestamp: true, Level: charmlog.Level(level)})))
 			return nil
 		},
+		PersistentPostRunE: func(*cobra.Command, []string) error {
+			if eventsOut != nil {
+				return eventsOut.Close()
+			}
+			return nil
+		},
 	}
 	cmd.PersistentFlags().Var(&level, "log-level", "log level (e.g. debug, info, warn, error, fatal, panic)")
+	cmd.PersistentFlags().StringVar(&eventsFile, "events-file", "", "path to write newline-delimited JSON build events to, or '-' for stdout, where publish then does not print the digest it published (see --image-refs)")
+	cmd.PersistentFlags().BoolVar(&allowUnknownFields, "allow-unknown-fields", false, "warn about fields of configurations that are not configuration fields, such as typos, instead of failing on them")
+	cmd.PersistentFlags().BoolVar(&showProgress, "progress", false, "print build progress (packages installed, layers built, digests, tags pushed) to stderr, along with the logs; not to be combined with --events-file /dev/stderr, whose lines it would interleave with")
 
-	cmd.AddCommand(cranecmd.NewCmdAuthLogin("apko")) // apko login
+	cmd.AddCommand(cranecmd.NewCmdAuthLogin("apko"))  // apko login
+	cmd.AddCommand(cranecmd.NewCmdAuthLogout("apko")) // apko logout
 	cmd.AddCommand(buildCmd())
 	cmd.AddCommand(buildMinirootFS())
+	cmd.AddCommand(buildFS())
+	cmd.AddCommand(buildDisk())
 	cmd.AddCommand(buildCPIO())
 	cmd.AddCommand(showConfig())
+	cmd.AddCommand(validateCmd())
 	cmd.AddCommand(publish())
+	cmd.AddCommand(serveCmd())
 	cmd.AddCommand(showPackages())
+	cmd.AddCommand(planCmd())
 	cmd.AddCommand(dotcmd())
+	cmd.AddCommand(whyCmd())
+	cmd.AddCommand(filesCmd())
 	cmd.AddCommand(lock())
 	cmd.AddCommand(resolve())
+	cmd.AddCommand(vendorCmd())
 	cmd.AddCommand(installKeys())
 	cmd.AddCommand(cleanCmd())
+	cmd.AddCommand(cacheCmd())
+	cmd.AddCommand(sizeCmd())
+	cmd.AddCommand(diffCmd())
+	cmd.AddCommand(exportCmd())
+	cmd.AddCommand(shellCmd())
 	cmd.AddCommand(version.Version())
 
 	cmd.PersistentFlags().StringVarP(&workDir, "workdir", "C", cwd, "working dir (default is current dir where executed)")
 	return cmd
 }
 
+// eventsOnStdoutKey marks the contexts of commands whose events are written
+// to stdout, which nothing else may then be written to.
+type eventsOnStdoutKey struct{}
+
+// eventsOnStdout reports whether the events of ctx are written to stdout.
+func eventsOnStdout(ctx context.Context) bool {
+	on, _ := ctx.Value(eventsOnStdoutKey{}).(bool)
+	return on
+}
+
 type userAgentTransport struct{ t http.RoundTripper }
 
 func (u userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,373 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+const (
+	diffFormatText = "text"
+	diffFormatJSON = "json"
+)
+
+func diffCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var buildArch string
+	var cacheDir string
+	var offline bool
+	var format string
+	var kopts keychainOptions
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "Compare the packages, files and config of two images",
+		Long: `Compare the packages, files and config of two images.
+
+Each of old and new is an apko configuration if a file of that name exists,
+which is built for a single architecture, and an image reference to pull
+otherwise. This is useful to review what a bump of a base image or of the
+packages in a configuration changes.
+
+The differences are written as text, or with --format=json as a JSON object.`,
+		Example: `  apko diff before.yaml after.yaml
+  apko diff cgr.dev/chainguard/static:latest apko.yaml`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != diffFormatText && format != diffFormatJSON {
+				return fmt.Errorf("unsupported format %q, expected %s or %s", format, diffFormatText, diffFormatJSON)
+			}
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			kopts.transport = transport
+			keychain, err := newKeychain(cmd.Context(), kopts)
+			if err != nil {
+				return err
+			}
+			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain)}
+			if transport != nil {
+				remoteOpts = append(remoteOpts, remote.WithTransport(transport))
+			}
+			return DiffCmd(cmd.Context(), cmd.OutOrStdout(), format, args[0], args[1], remoteOpts,
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithArch(types.ParseArchitecture(buildArch)),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+				build.WithTransport(transport),
+				build.WithKeychain(keychain),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(&buildArch, "arch", runtime.GOARCH, "architecture to compare -- default is Go runtime architecture")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().StringVar(&format, "format", diffFormatText, "output format: text or json")
+	addKeychainFlags(cmd, &kopts)
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// imageDiff is how two images differ. Old and new values are empty for
+// something only the other image has.
+type imageDiff struct {
+	Packages []packageChange `json:"packages"`
+	Files    []fileChange    `json:"files"`
+	Config   []configChange  `json:"config"`
+}
+
+type packageChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+type fileChange struct {
+	Path string `json:"path"`
+	// Change is one of "added", "removed" or "modified".
+	Change string `json:"change"`
+}
+
+type configChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+// imageSummary is what DiffCmd compares of an image.
+type imageSummary struct {
+	// packages maps the name of each installed package to its version.
+	packages map[string]string
+	// files maps each path to a digest of its type, mode, ownership and
+	// contents.
+	files map[string]string
+	// config has each field of the image config, in JSON.
+	config map[string]json.RawMessage
+}
+
+// DiffCmd writes how the image from newSrc differs from the one of oldSrc to
+// w, in format. Each of them is a configuration built with opts if a file of
+// that name exists, and an image reference pulled with remoteOpts otherwise.
+func DiffCmd(ctx context.Context, w io.Writer, format, oldSrc, newSrc string, remoteOpts []remote.Option, opts ...build.Option) error {
+	o, _, err := build.NewOptions(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	summaries := make([]*imageSummary, 0, 2)
+	for i, src := range []string{oldSrc, newSrc} {
+		tmp := filepath.Join(wd, strconv.Itoa(i))
+		img, err := diffImage(ctx, src, o.Arch, tmp, remoteOpts, opts...)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", src, err)
+		}
+		s, err := summarize(img)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", src, err)
+		}
+		summaries = append(summaries, s)
+	}
+	d := diffSummaries(summaries[0], summaries[1])
+
+	if format == diffFormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	writeDiff(w, d)
+	return nil
+}
+
+// diffImage builds the configuration src for arch in tmp, or pulls it if it
+// is not a file.
+func diffImage(ctx context.Context, src string, arch types.Architecture, tmp string, remoteOpts []remote.Option, opts ...build.Option) (v1.Image, error) {
+	if _, err := os.Stat(src); err != nil {
+		ref, perr := name.ParseReference(src)
+		if perr != nil {
+			return nil, errors.Join(err, perr)
+		}
+		remoteOpts = append(slices.Clone(remoteOpts), remote.WithContext(ctx), remote.WithPlatform(*arch.ToOCIPlatform()))
+		return remote.Image(ref, remoteOpts...)
+	}
+
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, fmt.Errorf("creating tempdir: %w", err)
+	}
+	opts = append(slices.Clone(opts), build.WithConfig(src, []string{}), build.WithTempDir(tmp))
+
+	bc, err := build.New(ctx, tarfs.New(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := bc.BuildLayers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building image: %w", err)
+	}
+	bde, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine build date epoch: %w", err)
+	}
+	return oci.BuildImageFromLayers(ctx, bc.BaseImage(), layers, bc.ImageConfiguration(), bde, bc.Arch())
+}
+
+func summarize(img v1.Image) (*imageSummary, error) {
+	s := &imageSummary{
+		packages: map[string]string{},
+		files:    map[string]string{},
+		config:   map[string]json.RawMessage{},
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(cf.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.config); err != nil {
+		return nil, err
+	}
+
+	rc := mutate.Extract(img)
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		path := strings.TrimPrefix(hdr.Name, "/")
+
+		h := sha256.New()
+		fmt.Fprintf(h, "%c %o %d:%d %s\n", hdr.Typeflag, hdr.Mode, hdr.Uid, hdr.Gid, hdr.Linkname)
+		var data bytes.Buffer
+		w := io.Writer(h)
+		installed := path == "usr/lib/apk/db/installed" || path == "lib/apk/db/installed"
+		if installed {
+			w = io.MultiWriter(h, &data)
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		s.files[path] = fmt.Sprintf("%x", h.Sum(nil))
+
+		if installed {
+			pkgs, err := apk.ParseInstalled(&data)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+			for _, pkg := range pkgs {
+				s.packages[pkg.Name] = pkg.Version
+			}
+		}
+	}
+	return s, nil
+}
+
+func diffSummaries(before, after *imageSummary) imageDiff {
+	d := imageDiff{
+		Packages: []packageChange{},
+		Files:    []fileChange{},
+		Config:   []configChange{},
+	}
+
+	for _, name := range sortedUnion(before.packages, after.packages) {
+		if o, n := before.packages[name], after.packages[name]; o != n {
+			d.Packages = append(d.Packages, packageChange{Name: name, Old: o, New: n})
+		}
+	}
+
+	for _, path := range sortedUnion(before.files, after.files) {
+		o, inOld := before.files[path]
+		n, inNew := after.files[path]
+		switch {
+		case !inOld:
+			d.Files = append(d.Files, fileChange{Path: path, Change: "added"})
+		case !inNew:
+			d.Files = append(d.Files, fileChange{Path: path, Change: "removed"})
+		case o != n:
+			d.Files = append(d.Files, fileChange{Path: path, Change: "modified"})
+		}
+	}
+
+	for _, field := range sortedUnion(before.config, after.config) {
+		if o, n := before.config[field], after.config[field]; !bytes.Equal(o, n) {
+			d.Config = append(d.Config, configChange{Field: field, Old: o, New: n})
+		}
+	}
+	return d
+}
+
+func sortedUnion[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func writeDiff(w io.Writer, d imageDiff) {
+	if len(d.Packages) == 0 && len(d.Files) == 0 && len(d.Config) == 0 {
+		fmt.Fprintln(w, "no differences")
+		return
+	}
+
+	if len(d.Packages) != 0 {
+		fmt.Fprintln(w, "Packages:")
+		for _, p := range d.Packages {
+			switch {
+			case p.Old == "":
+				fmt.Fprintf(w, "  + %s %s\n", p.Name, p.New)
+			case p.New == "":
+				fmt.Fprintf(w, "  - %s %s\n", p.Name, p.Old)
+			default:
+				fmt.Fprintf(w, "  ~ %s %s -> %s\n", p.Name, p.Old, p.New)
+			}
+		}
+	}
+
+	if len(d.Files) != 0 {
+		fmt.Fprintln(w, "Files:")
+		marks := map[string]string{"added": "+", "removed": "-", "modified": "~"}
+		for _, f := range d.Files {
+			fmt.Fprintf(w, "  %s %s\n", marks[f.Change], f.Path)
+		}
+	}
+
+	if len(d.Config) != 0 {
+		fmt.Fprintln(w, "Config:")
+		for _, c := range d.Config {
+			switch {
+			case c.Old == nil:
+				fmt.Fprintf(w, "  + %s: %s\n", c.Field, c.New)
+			case c.New == nil:
+				fmt.Fprintf(w, "  - %s: %s\n", c.Field, c.Old)
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s -> %s\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+}
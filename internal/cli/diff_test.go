@@ -0,0 +1,104 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	arch := build.WithArch(types.ParseArchitecture("amd64"))
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.DiffCmd(ctx, &buf, "text", config, config, nil, arch))
+	require.Equal(t, "no differences\n", buf.String())
+
+	b, err := os.ReadFile(config)
+	require.NoError(t, err)
+	other := filepath.Join(t.TempDir(), "other.yaml")
+	b = bytes.Replace(b, []byte("- replayout"), []byte("- pretend-baselayout"), 1)
+	b = bytes.Replace(b, []byte("/bin/sh -l"), []byte("/bin/sh"), 1)
+	require.NoError(t, os.WriteFile(other, b, 0o644))
+
+	buf.Reset()
+	require.NoError(t, cli.DiffCmd(ctx, &buf, "json", config, other, nil, arch))
+	var d struct {
+		Packages []struct{ Name, Old, New string }
+		Files    []struct{ Path, Change string }
+		Config   []struct{ Field string }
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &d))
+	require.Contains(t, d.Packages, struct{ Name, Old, New string }{Name: "replayout", Old: "1.0.0-r0"})
+	require.Contains(t, d.Files, struct{ Path, Change string }{Path: "usr/lib/apk/db/installed", Change: "modified"})
+	require.Equal(t, []struct{ Field string }{{Field: "Entrypoint"}}, d.Config)
+
+	buf.Reset()
+	require.NoError(t, cli.DiffCmd(ctx, &buf, "text", config, other, nil, arch))
+	require.Contains(t, buf.String(), "  - replayout 1.0.0-r0\n")
+	require.Contains(t, buf.String(), "  ~ usr/lib/apk/db/installed\n")
+}
+
+func TestDiffImage(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	arch := types.ParseArchitecture("amd64")
+
+	// Push the image built from config to a registry.
+	dir := t.TempDir()
+	require.NoError(t, cli.BuildLayoutCmd(ctx, dir, []types.Architecture{arch}, []string{"diff:latest"}, t.TempDir(), build.WithConfig(config, []string{})))
+	lp, err := layout.ImageIndexFromPath(dir)
+	require.NoError(t, err)
+	m, err := lp.IndexManifest()
+	require.NoError(t, err)
+	idx, err := lp.ImageIndex(m.Manifests[0].Digest)
+	require.NoError(t, err)
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(fmt.Sprintf("%s/test/diff", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.DiffCmd(ctx, &buf, "text", ref.String(), ref.String(), nil, build.WithArch(arch)))
+	require.Equal(t, "no differences\n", buf.String())
+
+	// The published image has its package versions locked.
+	buf.Reset()
+	require.NoError(t, cli.DiffCmd(ctx, &buf, "text", ref.String(), config, nil, build.WithArch(arch)))
+	require.Equal(t, "Files:\n  ~ etc/apk/world\n  ~ etc/apko.json\n", buf.String())
+}
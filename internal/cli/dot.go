@@ -45,12 +45,14 @@ var extRegistryViewer string
 
 func dotcmd() *cobra.Command {
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var archstrs []string
 	var web, span bool
 	var cacheDir string
 	var offline bool
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use:   "dot",
@@ -70,17 +72,24 @@ apko dot --web -S example.yaml
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			archs := types.ParseArchitectures(archstrs)
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
 			return DotCmd(cmd.Context(), args[0], archs, web, span,
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
-				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithTransport(transport),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
 			)
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
@@ -89,6 +98,7 @@ apko dot --web -S example.yaml
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVarP(&extRegistryViewer, "registry-explorer", "e", "apk.dag.dev", "FQDN of the registry explorer that rendered nodes in SVG will link to.")
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
@@ -101,7 +111,7 @@ func DotCmd(ctx context.Context, configFile string, archs []types.Architecture,
 	}
 	defer os.RemoveAll(wd)
 
-	o, ic, err := build.NewOptions(opts...)
+	o, ic, err := build.NewOptions(ctx, opts...)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,261 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export an image to formats other tools consume",
+	}
+	cmd.AddCommand(exportDockerfile())
+	return cmd
+}
+
+func exportDockerfile() *cobra.Command {
+	var buildDate string
+	var buildArch string
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var extraPackages []string
+	var cacheDir string
+	var offline bool
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "dockerfile <config.yaml> <output-dir>",
+		Short: "Export a Dockerfile and build context approximating an image",
+		Long: `Export a Dockerfile and build context approximating an image.
+
+The image is built for a single architecture, and its layers are written to
+the output directory next to a Dockerfile that adds them to scratch and
+applies the image configuration, so that
+
+  # docker build <output-dir>
+
+produces an equivalent image. The result is not bit-for-bit identical to what
+apko builds: annotations are not carried over, and layer digests depend on
+the builder.`,
+		Example: `  apko export dockerfile apko.yaml ./context`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return ExportDockerfileCmd(cmd.Context(), args[1],
+				build.WithConfig(args[0], []string{}),
+				build.WithBuildDate(buildDate),
+				build.WithArch(types.ParseArchitecture(buildArch)),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithExtraPackages(extraPackages),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image in RFC3339 format")
+	cmd.Flags().StringVar(&buildArch, "arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// ExportDockerfileCmd builds an image and writes its layers and a Dockerfile
+// that reassembles them to dir.
+func ExportDockerfileCmd(ctx context.Context, dir string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	bc, err := build.New(ctx, tarfs.New(), opts...)
+	if err != nil {
+		return err
+	}
+	ic := bc.ImageConfiguration()
+	if len(ic.Archs) != 0 {
+		log.Infof("ignoring archs in config, only exporting %s", bc.Arch())
+	}
+
+	layers, err := bc.BuildLayers(ctx)
+	if err != nil {
+		return fmt.Errorf("building layers: %w", err)
+	}
+	created, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return fmt.Errorf("getting build date: %w", err)
+	}
+	img, err := oci.BuildImageFromLayers(ctx, bc.BaseImage(), layers, ic, created, bc.Arch())
+	if err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("getting image config: %w", err)
+	}
+	all, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("getting image layers: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+	names := make([]string, 0, len(all))
+	for i, l := range all {
+		name := fmt.Sprintf("layer-%d.tar.gz", i)
+		if err := writeLayer(filepath.Join(dir, name), l); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		return fmt.Errorf("creating Dockerfile: %w", err)
+	}
+	defer f.Close()
+	if err := writeDockerfile(f, names, cfg.Config); err != nil {
+		return fmt.Errorf("writing Dockerfile: %w", err)
+	}
+	log.Infof("exported Dockerfile and %d layers to %s", len(names), dir)
+	return f.Close()
+}
+
+func writeLayer(path string, l v1.Layer) error {
+	rc, err := l.Compressed()
+	if err != nil {
+		return fmt.Errorf("reading layer: %w", err)
+	}
+	defer rc.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// writeDockerfile writes a Dockerfile that adds layers, which are local
+// tarballs in the build context, to scratch and applies cfg.
+func writeDockerfile(w io.Writer, layers []string, cfg v1.Config) error {
+	var b strings.Builder
+	b.WriteString("# Generated by apko export dockerfile.\n")
+	b.WriteString("FROM scratch\n")
+	for _, l := range layers {
+		// ADD unpacks local tarballs, which is what makes this work.
+		fmt.Fprintf(&b, "ADD %s /\n", l)
+	}
+
+	for _, e := range cfg.Env {
+		k, v, _ := strings.Cut(e, "=")
+		fmt.Fprintf(&b, "ENV %s=%s\n", k, quoteDockerfile(v))
+	}
+	for _, k := range sortedKeys(cfg.Labels) {
+		fmt.Fprintf(&b, "LABEL %s=%s\n", quoteDockerfile(k), quoteDockerfile(cfg.Labels[k]))
+	}
+	for _, p := range sortedKeys(cfg.ExposedPorts) {
+		fmt.Fprintf(&b, "EXPOSE %s\n", p)
+	}
+	if len(cfg.Volumes) != 0 {
+		if err := writeExecForm(&b, "VOLUME", sortedKeys(cfg.Volumes)); err != nil {
+			return err
+		}
+	}
+	if cfg.WorkingDir != "" {
+		fmt.Fprintf(&b, "WORKDIR %s\n", cfg.WorkingDir)
+	}
+	if cfg.User != "" {
+		fmt.Fprintf(&b, "USER %s\n", cfg.User)
+	}
+	if cfg.StopSignal != "" {
+		fmt.Fprintf(&b, "STOPSIGNAL %s\n", cfg.StopSignal)
+	}
+	if len(cfg.Entrypoint) != 0 {
+		if err := writeExecForm(&b, "ENTRYPOINT", cfg.Entrypoint); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Cmd) != 0 {
+		if err := writeExecForm(&b, "CMD", cfg.Cmd); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeExecForm(b *strings.Builder, instruction string, args []string) error {
+	j, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "%s %s\n", instruction, j)
+	return nil
+}
+
+// quoteDockerfile double quotes s, escaping the characters that are special
+// within double quotes in a Dockerfile.
+func quoteDockerfile(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestExportDockerfile(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "context")
+
+	require.NoError(t, cli.ExportDockerfileCmd(ctx, dir,
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithArch(types.ParseArchitecture("amd64")),
+	))
+
+	b, err := os.ReadFile(filepath.Join(dir, "Dockerfile"))
+	require.NoError(t, err)
+	df := string(b)
+	require.Contains(t, df, "FROM scratch\nADD layer-0.tar.gz /\n")
+	require.Contains(t, df, `ENV PATH="/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin"`)
+	require.Contains(t, df, `ENTRYPOINT ["/bin/sh","-l"]`)
+
+	fi, err := os.Stat(filepath.Join(dir, "layer-0.tar.gz"))
+	require.NoError(t, err)
+	require.NotZero(t, fi.Size())
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func filesCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var archstrs []string
+	var cacheDir string
+	var offline bool
+	var bopts buildArgOptions
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "files <config.yaml>",
+		Short: "List the files of the image of a configuration with the packages that own them",
+		Long: `List the files of the image of a configuration with the packages that own them.
+
+The filesystem of the image is built, without writing any layer, and each path
+in it but directories is printed with the name and version of the package that
+installed it, separated by a tab, or with - for the paths apko added itself.
+A path that several packages ship is owned by the one installed last.`,
+		Example: `  apko files apko.yaml
+  apko files --arch x86_64 apko.yaml | grep /usr/bin/`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return FilesCmd(cmd.Context(), cmd.OutOrStdout(), types.ParseArchitectures(archstrs),
+				build.WithConfigVariables(vars),
+				build.WithConfig(args[0], []string{}),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to list the files of (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addBuildArgFlags(cmd, &bopts)
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// FilesCmd writes to w the files of the image of the configuration of opts,
+// for each of archs, with the packages that installed them.
+func FilesCmd(ctx context.Context, w io.Writer, archs []types.Architecture, opts ...build.Option) error {
+	o, ic, err := build.NewOptions(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	archs = slices.Clone(ic.Archs)
+
+	opts = append(opts, build.WithImageConfiguration(*ic))
+	mc, err := build.NewMultiArch(ctx, archs, opts...)
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(archs, func(a, b types.Architecture) int { return cmp.Compare(a.ToAPK(), b.ToAPK()) })
+	for _, arch := range archs {
+		bc := mc.Contexts[arch]
+		if err := bc.BuildImage(ctx); err != nil {
+			return fmt.Errorf("building filesystem for arch %q: %w", arch, err)
+		}
+		files, err := bc.FileOwners()
+		if err != nil {
+			return fmt.Errorf("for arch %q: %w", arch, err)
+		}
+		indent := ""
+		if len(archs) != 1 {
+			fmt.Fprintf(w, "%s:\n", arch.ToAPK())
+			indent = "  "
+		}
+		for _, f := range files {
+			fmt.Fprintf(w, "%s%s\t%s\n", indent, f.Path, cmp.Or(f.Package, "-"))
+		}
+	}
+	return nil
+}
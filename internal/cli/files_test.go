@@ -0,0 +1,41 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	config := build.WithConfig(filepath.Join("testdata", "apko.yaml"), nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.FilesCmd(ctx, &buf, []types.Architecture{types.ParseArchitecture("amd64")}, config))
+	// replayout replaces the os-release of pretend-baselayout.
+	require.Contains(t, buf.String(), "/etc/os-release\treplayout-1.0.0-r0\n")
+	require.Contains(t, buf.String(), "/var/lib/db/sbom/pretend-baselayout-1.0.0-r0.spdx.json\tpretend-baselayout-1.0.0-r0\n")
+	require.Contains(t, buf.String(), "/etc/apko.json\t-\n")
+	require.NotContains(t, buf.String(), "/etc\t")
+}
@@ -0,0 +1,52 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+
+	"chainguard.dev/apko/pkg/build"
+)
+
+// imageOptions are the options of publish that change what the image is,
+// which plan --digests shares so that its digests are those publish pushes.
+type imageOptions struct {
+	withVCS           bool
+	buildDate         string
+	rawAnnotations    []string
+	lockfile          string
+	extraPackages     []string
+	layerFormat       string
+	runScriptlets     bool
+	scriptletSandbox  string
+	scriptletPackages []string
+}
+
+// buildOptions returns the build options that iopts describe.
+func (iopts imageOptions) buildOptions() ([]build.Option, error) {
+	annotations, err := parseAnnotations(iopts.rawAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("parsing annotations from command line: %w", err)
+	}
+	return []build.Option{
+		build.WithBuildDate(iopts.buildDate),
+		build.WithExtraPackages(iopts.extraPackages),
+		build.WithVCS(iopts.withVCS),
+		build.WithAnnotations(annotations),
+		build.WithLockFile(iopts.lockfile),
+		build.WithRunScriptlets(iopts.runScriptlets, iopts.scriptletSandbox, iopts.scriptletPackages),
+		build.WithLayerFormat(iopts.layerFormat),
+	}, nil
+}
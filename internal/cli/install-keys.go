@@ -12,7 +12,8 @@ import (
 )
 
 func installKeys() *cobra.Command {
-	return &cobra.Command{
+	var topts transportOptions
+	cmd := &cobra.Command{
 		Use:     "install-keys",
 		Example: `apko install-keys`,
 		Short:   "Discover and install keys for all repositories",
@@ -21,7 +22,11 @@ func installKeys() *cobra.Command {
 			ctx := cmd.Context()
 			log := clog.FromContext(ctx)
 
-			a, err := apk.New(ctx)
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			a, err := apk.New(ctx, apk.WithTransport(transport))
 			if err != nil {
 				return err
 			}
@@ -49,4 +54,6 @@ func installKeys() *cobra.Command {
 			return nil
 		},
 	}
+	addTransportFlags(cmd, &topts)
+	return cmd
 }
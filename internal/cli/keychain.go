@@ -0,0 +1,288 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"chainguard.dev/sdk/sts"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/name"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+
+	"chainguard.dev/apko/pkg/build/oci"
+)
+
+// registryAuthEnv holds whitespace separated static credentials, in the
+// same form as --registry-auth, so they don't have to be passed as arguments.
+const registryAuthEnv = "APKO_REGISTRY_AUTH"
+
+// keychainOptions configures how registry credentials are resolved.
+type keychainOptions struct {
+	// auths are of the form "registry=username:password" or "registry=token".
+	auths []string
+	// disabled are the ambient keychains not to consult ("docker", "github").
+	disabled []string
+	// credHelpers are of the form "registry=helper".
+	credHelpers []string
+	// identities are of the form "registry=identity".
+	identities []string
+	// issuers are the STSes that ambient OIDC tokens are exchanged with,
+	// of the form "registry=issuer", or a bare issuer for the registries
+	// without one.
+	issuers []string
+	// transport fetches the ambient OIDC tokens of GitHub Actions, or
+	// http.DefaultTransport if nil. It is set from the transport flags, so
+	// that --allow-egress and the like apply to it too.
+	transport http.RoundTripper
+}
+
+// defaultIssuer is the issuer of registry identities unless another is given.
+const defaultIssuer = "https://issuer.enforce.dev"
+
+// parseIssuers returns the issuers of specs by registry, and the bare one,
+// defaultIssuer unless specs have one, which is the issuer of any other
+// registry.
+func parseIssuers(specs []string) (map[string]string, string, error) {
+	issuers := map[string]string{}
+	bare := defaultIssuer
+	for _, spec := range specs {
+		registry, issuer, ok := strings.Cut(spec, "=")
+		if !ok || strings.Contains(registry, "://") {
+			bare = spec
+			continue
+		}
+		if registry == "" || issuer == "" {
+			return nil, "", fmt.Errorf("registry identity issuer %q must be an issuer or of the form registry=issuer", spec)
+		}
+		issuers[registry] = issuer
+	}
+	return issuers, bare, nil
+}
+
+// newKeychain returns the keychain used to authenticate against registries.
+//
+// Static credentials, from kopts or the environment, take precedence over
+// everything else. Registries with an identity configured exchange an ambient OIDC token for
+// a registry token. Each of the credHelpers routes the given registry to the
+// external docker-credential-<helper> program. Both take precedence over the
+// docker config, which is consulted next, and honors any credHelpers or
+// credsStore configured there.
+func newKeychain(ctx context.Context, kopts keychainOptions) (authn.Keychain, error) {
+	keychains := make([]authn.Keychain, 0, len(kopts.identities)+len(kopts.credHelpers)+3)
+
+	auths := kopts.auths
+	if len(auths) == 0 {
+		auths = strings.Fields(os.Getenv(registryAuthEnv))
+	}
+	if len(auths) != 0 {
+		creds := make(map[string]authn.AuthConfig, len(auths))
+		for i, a := range auths {
+			registry, secret, ok := strings.Cut(a, "=")
+			if !ok || registry == "" || secret == "" {
+				// Don't echo the entry back, it may well be a secret.
+				return nil, fmt.Errorf("registry auth %d must be of the form registry=username:password or registry=token", i)
+			}
+			if username, password, ok := strings.Cut(secret, ":"); ok {
+				creds[registry] = authn.AuthConfig{Username: username, Password: password}
+			} else {
+				creds[registry] = authn.AuthConfig{RegistryToken: secret}
+			}
+		}
+		keychains = append(keychains, oci.StaticKeychain(creds))
+	}
+
+	issuers, bareIssuer, err := parseIssuers(kopts.issuers)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range kopts.identities {
+		registry, identity, ok := strings.Cut(id, "=")
+		if !ok || registry == "" || identity == "" {
+			return nil, fmt.Errorf("registry identity %q must be of the form registry=identity", id)
+		}
+		issuer, ok := issuers[registry]
+		if !ok {
+			issuer = bareIssuer
+		}
+		exch := sts.New(issuer, registry, sts.WithIdentity(identity), sts.WithUserAgent("apko"))
+		keychains = append(keychains, &oidcKeychain{
+			registry: registry,
+			ts:       oauth2.ReuseTokenSource(nil, sts.NewContextTokenSource(ctx, &ambientTokenSource{ctx: ctx, audience: issuer, transport: kopts.transport}, exch)),
+		})
+	}
+	for _, ch := range kopts.credHelpers {
+		registry, helper, ok := strings.Cut(ch, "=")
+		if !ok || registry == "" || helper == "" {
+			return nil, fmt.Errorf("credential helper %q must be of the form registry=helper", ch)
+		}
+		keychains = append(keychains, &credHelperKeychain{
+			registry: registry,
+			program:  client.NewShellProgramFunc("docker-credential-" + strings.TrimPrefix(helper, "docker-credential-")),
+		})
+	}
+
+	ambient := map[string]authn.Keychain{
+		"docker": authn.DefaultKeychain,
+		"github": github.Keychain,
+	}
+	for _, d := range kopts.disabled {
+		if _, ok := ambient[d]; !ok {
+			return nil, fmt.Errorf("unknown keychain %q, must be one of docker, github", d)
+		}
+		delete(ambient, d)
+	}
+	for _, k := range []string{"docker", "github"} {
+		if kc, ok := ambient[k]; ok {
+			keychains = append(keychains, kc)
+		}
+	}
+	return authn.NewMultiKeychain(keychains...), nil
+}
+
+// credHelperKeychain resolves credentials for a single registry through an
+// external docker credential helper.
+type credHelperKeychain struct {
+	registry string
+	program  client.ProgramFunc
+}
+
+func (c *credHelperKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if target.RegistryStr() != c.registry {
+		return authn.Anonymous, nil
+	}
+
+	serverURL := target.RegistryStr()
+	if serverURL == name.DefaultRegistry {
+		// This is the historical key the docker CLI uses for Docker Hub.
+		serverURL = authn.DefaultAuthKey
+	}
+
+	creds, err := client.Get(c.program, serverURL)
+	if credentials.IsErrCredentialsNotFound(err) {
+		return authn.Anonymous, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("getting credentials for %s: %w", c.registry, err)
+	}
+
+	// Helpers signal identity tokens with this magic username.
+	if creds.Username == "<token>" {
+		return authn.FromConfig(authn.AuthConfig{IdentityToken: creds.Secret}), nil
+	}
+	return authn.FromConfig(authn.AuthConfig{
+		Username: creds.Username,
+		Password: creds.Secret,
+	}), nil
+}
+
+// oidcKeychain resolves credentials for a single registry by exchanging an
+// ambient OIDC token for a registry token.
+type oidcKeychain struct {
+	registry string
+	ts       oauth2.TokenSource
+}
+
+func (o *oidcKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if target.RegistryStr() != o.registry {
+		return authn.Anonymous, nil
+	}
+	tok, err := o.ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("exchanging token for %s: %w", o.registry, err)
+	}
+	return &authn.Basic{
+		Username: "_token",
+		Password: tok.AccessToken,
+	}, nil
+}
+
+// ambientTokenSource finds an OIDC token in the environment we are running in.
+//
+// In order, it checks for GitHub Actions, then a projected workload identity
+// token file (as on GKE or EKS), and finally falls back to Google's ambient
+// credentials.
+type ambientTokenSource struct {
+	ctx       context.Context
+	audience  string
+	transport http.RoundTripper
+}
+
+func (a *ambientTokenSource) Token() (*oauth2.Token, error) {
+	if u, t := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"); u != "" && t != "" {
+		return githubActionsToken(a.ctx, &http.Client{Transport: a.transport}, u, t, a.audience)
+	}
+
+	for _, env := range []string{"K8S_TOKEN_PATH", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		if p := os.Getenv(env); p != "" {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("reading token from %s: %w", env, err)
+			}
+			return &oauth2.Token{AccessToken: strings.TrimSpace(string(b))}, nil
+		}
+	}
+
+	ts, err := idtoken.NewTokenSource(a.ctx, a.audience)
+	if err != nil {
+		return nil, fmt.Errorf("no ambient OIDC token found: %w", err)
+	}
+	return ts.Token()
+}
+
+func githubActionsToken(ctx context.Context, client *http.Client, requestURL, requestToken, audience string) (*oauth2.Token, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting GitHub Actions token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting GitHub Actions token: %s", resp.Status)
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding GitHub Actions token: %w", err)
+	}
+	return &oauth2.Token{AccessToken: body.Value}, nil
+}
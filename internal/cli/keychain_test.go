@@ -0,0 +1,171 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeychain(t *testing.T) {
+	ctx := context.Background()
+
+	// Install a fake credential helper on the PATH.
+	bin := t.TempDir()
+	script := "#!/bin/sh\ncat >/dev/null\necho '{\"Username\":\"helper-user\",\"Secret\":\"helper-secret\"}'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(script), 0o755)) //nolint:gosec
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	t.Run("helper is used for its registry", func(t *testing.T) {
+		kc, err := newKeychain(ctx, keychainOptions{credHelpers: []string{"registry.example.com=fake"}})
+		require.NoError(t, err)
+
+		repo, err := name.NewRepository("registry.example.com/foo")
+		require.NoError(t, err)
+		auth, err := kc.Resolve(repo)
+		require.NoError(t, err)
+		cfg, err := auth.Authorization()
+		require.NoError(t, err)
+		require.Equal(t, "helper-user", cfg.Username)
+		require.Equal(t, "helper-secret", cfg.Password)
+	})
+
+	t.Run("other registries are anonymous", func(t *testing.T) {
+		kc, err := newKeychain(ctx, keychainOptions{credHelpers: []string{"registry.example.com=docker-credential-fake"}})
+		require.NoError(t, err)
+
+		repo, err := name.NewRepository("other.example.com/foo")
+		require.NoError(t, err)
+		auth, err := kc.Resolve(repo)
+		require.NoError(t, err)
+		require.Equal(t, authn.Anonymous, auth)
+	})
+
+	t.Run("malformed helper", func(t *testing.T) {
+		_, err := newKeychain(ctx, keychainOptions{credHelpers: []string{"registry.example.com"}})
+		require.Error(t, err)
+	})
+
+	t.Run("identity exchanges ambient token", func(t *testing.T) {
+		gh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "Bearer request-token", r.Header.Get("Authorization"))
+			require.Equal(t, "https://issuer.example.com", r.URL.Query().Get("audience"))
+			fmt.Fprint(w, `{"value":"ambient-token"}`)
+		}))
+		defer gh.Close()
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", gh.URL)
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+		tok, err := (&ambientTokenSource{ctx: ctx, audience: "https://issuer.example.com"}).Token()
+		require.NoError(t, err)
+		require.Equal(t, "ambient-token", tok.AccessToken)
+	})
+
+	t.Run("static credentials take precedence", func(t *testing.T) {
+		kc, err := newKeychain(ctx, keychainOptions{
+			auths:       []string{"registry.example.com=static-user:static-pass", "token.example.com=static-token"},
+			credHelpers: []string{"registry.example.com=fake"},
+		})
+		require.NoError(t, err)
+
+		for reg, want := range map[string]*authn.AuthConfig{
+			"registry.example.com": {Username: "static-user", Password: "static-pass"},
+			"token.example.com":    {RegistryToken: "static-token"},
+		} {
+			repo, err := name.NewRepository(reg + "/foo")
+			require.NoError(t, err)
+			auth, err := kc.Resolve(repo)
+			require.NoError(t, err)
+			cfg, err := auth.Authorization()
+			require.NoError(t, err)
+			require.Equal(t, want, cfg)
+		}
+	})
+
+	t.Run("static credentials from the environment", func(t *testing.T) {
+		t.Setenv(registryAuthEnv, "env.example.com=env-user:env-pass")
+		kc, err := newKeychain(ctx, keychainOptions{})
+		require.NoError(t, err)
+
+		repo, err := name.NewRepository("env.example.com/foo")
+		require.NoError(t, err)
+		auth, err := kc.Resolve(repo)
+		require.NoError(t, err)
+		cfg, err := auth.Authorization()
+		require.NoError(t, err)
+		require.Equal(t, "env-user", cfg.Username)
+	})
+
+	t.Run("apko login is read, apko logout forgets", func(t *testing.T) {
+		repo, err := name.NewRepository("login.example.com/foo")
+		require.NoError(t, err)
+		resolve := func() authn.Authenticator {
+			kc, err := newKeychain(ctx, keychainOptions{})
+			require.NoError(t, err)
+			auth, err := kc.Resolve(repo)
+			require.NoError(t, err)
+			return auth
+		}
+
+		login := New()
+		login.SetArgs([]string{"login", "login.example.com", "-u", "login-user", "-p", "login-pass"})
+		require.NoError(t, login.Execute())
+		cfg, err := resolve().Authorization()
+		require.NoError(t, err)
+		require.Equal(t, "login-user", cfg.Username)
+		require.Equal(t, "login-pass", cfg.Password)
+
+		logout := New()
+		logout.SetArgs([]string{"logout", "login.example.com"})
+		require.NoError(t, logout.Execute())
+		require.Equal(t, authn.Anonymous, resolve())
+	})
+
+	t.Run("disabled keychains", func(t *testing.T) {
+		_, err := newKeychain(ctx, keychainOptions{disabled: []string{"docker", "github"}})
+		require.NoError(t, err)
+		_, err = newKeychain(ctx, keychainOptions{disabled: []string{"gcp"}})
+		require.Error(t, err)
+	})
+
+	t.Run("malformed identity", func(t *testing.T) {
+		_, err := newKeychain(ctx, keychainOptions{identities: []string{"=identity"}})
+		require.Error(t, err)
+		_, err = newKeychain(ctx, keychainOptions{identities: []string{"cgr.dev=identity"}, issuers: []string{"cgr.dev="}})
+		require.Error(t, err)
+	})
+
+	t.Run("issuers by registry", func(t *testing.T) {
+		issuers, bare, err := parseIssuers(nil)
+		require.NoError(t, err)
+		require.Empty(t, issuers)
+		require.Equal(t, defaultIssuer, bare)
+
+		issuers, bare, err = parseIssuers([]string{"registry.example.com=https://sts.example.com", "https://issuer.example.com/?x=y"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"registry.example.com": "https://sts.example.com"}, issuers)
+		require.Equal(t, "https://issuer.example.com/?x=y", bare)
+	})
+}
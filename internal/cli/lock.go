@@ -67,6 +67,7 @@ func RemoveLabel(s string) (string, error) {
 
 func lockInternal(cmdName string, extension string, deprecated string) *cobra.Command {
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var archstrs []string
@@ -74,6 +75,8 @@ func lockInternal(cmdName string, extension string, deprecated string) *cobra.Co
 	var includePaths []string
 	var ignoreSignatures bool
 	var cacheDir string
+	var bopts buildArgOptions
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use: cmdName,
@@ -88,25 +91,37 @@ func lockInternal(cmdName string, extension string, deprecated string) *cobra.Co
 			}
 
 			archs := types.ParseArchitectures(archstrs)
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
 
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
 			return LockCmd(
 				cmd.Context(),
 				output,
 				archs,
 				[]build.Option{
+					build.WithConfigVariables(vars),
 					build.WithConfig(args[0], includePaths),
 					build.WithExtraKeys(extraKeys),
+					build.WithKeyringDir(keyringDir),
 					build.WithExtraBuildRepos(extraBuildRepos),
 					build.WithExtraRepos(extraRepos),
+					build.WithTransport(transport),
 					build.WithIncludePaths(includePaths),
 					build.WithIgnoreSignatures(ignoreSignatures),
-					build.WithCache(cacheDir, false, apk.NewCache(true)),
+					build.WithCache(cacheDir, topts.noNetwork, apk.NewCache(true)),
 				},
 			)
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
@@ -114,6 +129,8 @@ func lockInternal(cmdName string, extension string, deprecated string) *cobra.Co
 	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	addBuildArgFlags(cmd, &bopts)
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
@@ -126,7 +143,7 @@ func LockCmd(ctx context.Context, output string, archs []types.Architecture, opt
 	}
 	defer os.RemoveAll(wd)
 
-	o, ic, err := build.NewOptions(opts...)
+	o, ic, err := build.NewOptions(ctx, opts...)
 
 	if err != nil {
 		return err
@@ -174,7 +191,7 @@ func LockCmd(ctx context.Context, output string, archs []types.Architecture, opt
 	}
 
 	// Discover and add auto-discovered keys from repositories
-	discoveredKeys := discoverKeysForLock(ctx, ic, archs)
+	discoveredKeys := discoverKeysForLock(ctx, ic, archs, o.Transport)
 	lock.Contents.Keyrings = append(lock.Contents.Keyrings, discoveredKeys...)
 
 	// TODO: If the archs can't agree on package versions (e.g., arm builds are ahead of x86) then we should fail instead of producing inconsistent locks.
@@ -277,8 +294,9 @@ func stripURLScheme(url string) string {
 	)
 }
 
-// discoverKeysForLock discovers keys from repositories and returns them as LockKeyring entries
-func discoverKeysForLock(ctx context.Context, ic *types.ImageConfiguration, archs []types.Architecture) []pkglock.LockKeyring {
+// discoverKeysForLock discovers keys from repositories through transport, or
+// http.DefaultTransport if nil, and returns them as LockKeyring entries
+func discoverKeysForLock(ctx context.Context, ic *types.ImageConfiguration, archs []types.Architecture, transport http.RoundTripper) []pkglock.LockKeyring {
 	log := clog.FromContext(ctx)
 
 	// Collect all unique repositories
@@ -297,7 +315,7 @@ func discoverKeysForLock(ctx context.Context, ic *types.ImageConfiguration, arch
 	discoveredKeyMap := make(map[string]pkglock.LockKeyring)
 
 	// Fetch Alpine releases once (cached by HTTP client)
-	client := &http.Client{}
+	client := &http.Client{Transport: transport}
 	var alpineReleases *apk.Releases
 
 	// Discover keys for each repository and architecture
@@ -1,8 +1,34 @@
 package cli
 
+import (
+	"fmt"
+	"io"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/scan"
+)
+
 type publishOpt struct {
-	local bool
-	tags  []string
+	local       bool
+	localTarget oci.LocalTarget
+	tags        []string
+	tagAnnots   map[string]map[string]string
+	archTags    bool
+	skipTagging bool
+	attachInput bool
+	inputsRef   string
+	policy      string
+	attachSBOMs bool
+	signKey     string
+	signRefs    bool
+	attestSBOMs bool
+	uploadJobs  int
+	dryRun      io.Writer
+	outputJSON  string
+	tagRefs     string
+	ghOutput    string
+	scanners    []string
+	scanFailOn  string
 }
 
 // PublishOption is an option for publishing
@@ -16,6 +42,18 @@ func WithLocal(local bool) PublishOption {
 	}
 }
 
+// WithLocalTarget sets the image store that publishing locally loads the
+// image into.
+func WithLocalTarget(target oci.LocalTarget) PublishOption {
+	return func(p *publishOpt) error {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		p.localTarget = target
+		return nil
+	}
+}
+
 // WithTags tags to use
 func WithTags(tags ...string) PublishOption {
 	return func(p *publishOpt) error {
@@ -23,3 +61,165 @@ func WithTags(tags ...string) PublishOption {
 		return nil
 	}
 }
+
+// WithTagAnnotations sets annotations to add to the index pushed to each
+// tag, by tag name.
+func WithTagAnnotations(annotations map[string]map[string]string) PublishOption {
+	return func(p *publishOpt) error {
+		p.tagAnnots = annotations
+		return nil
+	}
+}
+
+// WithArchTags sets whether the image of each architecture is also pushed
+// to <tag>-<arch> for each tag, as for oci.WithArchTags.
+func WithArchTags(archTags bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.archTags = archTags
+		return nil
+	}
+}
+
+// WithSkipTagging sets whether publishing pushes everything by digest only,
+// without pushing any tag.
+func WithSkipTagging(skip bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.skipTagging = skip
+		return nil
+	}
+}
+
+// WithAttachBuildInputs sets whether to push the config and lockfile as a
+// referrer of the published index.
+func WithAttachBuildInputs(attach bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.attachInput = attach
+		return nil
+	}
+}
+
+// WithBuildInputsRef sets a standalone reference to push the config and
+// lockfile to.
+func WithBuildInputsRef(ref string) PublishOption {
+	return func(p *publishOpt) error {
+		p.inputsRef = ref
+		return nil
+	}
+}
+
+// WithSigningPolicy sets the path of a signing policy that the publish
+// must satisfy.
+func WithSigningPolicy(path string) PublishOption {
+	return func(p *publishOpt) error {
+		p.policy = path
+		return nil
+	}
+}
+
+// WithAttachSBOMs sets whether to push every generated SBOM as a referrer of
+// the image or index it describes.
+func WithAttachSBOMs(attach bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.attachSBOMs = attach
+		return nil
+	}
+}
+
+// WithSigningKey sets the path of a PEM private key, or the URI of a KMS key,
+// to sign the published index and images with.
+func WithSigningKey(ref string) PublishOption {
+	return func(p *publishOpt) error {
+		p.signKey = ref
+		return nil
+	}
+}
+
+// WithSigningReferrers sets whether to store signatures with the OCI
+// referrers API rather than at cosign's .sig tags.
+func WithSigningReferrers(referrers bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.signRefs = referrers
+		return nil
+	}
+}
+
+// WithAttestSBOMs sets whether to push every generated SBOM as an in-toto
+// attestation of the image or index it describes, signed with the signing
+// key.
+func WithAttestSBOMs(attest bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.attestSBOMs = attest
+		return nil
+	}
+}
+
+// WithUploadJobs bounds how many blobs are uploaded concurrently across all
+// the images of the index. Zero uses oci.DefaultUploadJobs.
+func WithUploadJobs(jobs int) PublishOption {
+	return func(p *publishOpt) error {
+		if jobs < 0 {
+			return fmt.Errorf("upload jobs must not be negative, got %d", jobs)
+		}
+		p.uploadJobs = jobs
+		return nil
+	}
+}
+
+// WithDryRun builds everything but pushes nothing, writing what would be
+// published to w as JSON instead. A nil w publishes as usual.
+func WithDryRun(w io.Writer) PublishOption {
+	return func(p *publishOpt) error {
+		p.dryRun = w
+		return nil
+	}
+}
+
+// WithOutputJSON sets a path to write what was published to as JSON: the
+// digests of the index and its images, the layers of the images, the tags
+// and the SBOM artifacts.
+func WithOutputJSON(path string) PublishOption {
+	return func(p *publishOpt) error {
+		p.outputJSON = path
+		return nil
+	}
+}
+
+// WithTagRefs sets a path to write the references the index was pushed to,
+// pinned to the digest pushed to each, as tag@digest, one per line.
+func WithTagRefs(path string) PublishOption {
+	return func(p *publishOpt) error {
+		p.tagRefs = path
+		return nil
+	}
+}
+
+// WithGitHubOutput sets the path of a GitHub Actions step output file, as
+// $GITHUB_OUTPUT names, to set the digest, image and tags outputs of the step
+// in.
+func WithGitHubOutput(path string) PublishOption {
+	return func(p *publishOpt) error {
+		p.ghOutput = path
+		return nil
+	}
+}
+
+// WithScanners sets the vulnerability scanners to scan the built images
+// with before they are published, as for scan.NewScanner, and the severity
+// of the findings that fail publishing, high by default.
+func WithScanners(failOn string, specs ...string) PublishOption {
+	return func(p *publishOpt) error {
+		for _, spec := range specs {
+			if _, err := scan.NewScanner(spec); err != nil {
+				return err
+			}
+		}
+		if failOn != "" {
+			if _, err := scan.ParseSeverity(failOn); err != nil {
+				return fmt.Errorf("parsing scan severity threshold: %w", err)
+			}
+		}
+		p.scanners = specs
+		p.scanFailOn = failOn
+		return nil
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// buildPlan is what a build of a configuration would produce. Nothing in it
+// depends on when or where it is computed, so two plans of an unchanged
+// configuration and unchanged repositories are byte for byte the same.
+type buildPlan struct {
+	Config        planConfig               `json:"config"`
+	Tags          []string                 `json:"tags"`
+	Architectures []string                 `json:"architectures"`
+	Packages      map[string][]planPackage `json:"packages"`
+	// Digest and Images are only set when the plan is computed by building.
+	Digest string            `json:"digest,omitempty"`
+	Images map[string]string `json:"images,omitempty"`
+}
+
+type planConfig struct {
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+}
+
+type planPackage struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	Source   string `json:"source"`
+}
+
+func planCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var archstrs []string
+	var cacheDir string
+	var offline bool
+	var digests bool
+	var bopts buildArgOptions
+	var iopts imageOptions
+	var topts transportOptions
+	var kopts keychainOptions
+
+	cmd := &cobra.Command{
+		Use:   "plan <config.yaml> [tag...]",
+		Short: "Describe what a build of a configuration would produce, as JSON",
+		Long: `Describe what a build of a configuration would produce, as JSON.
+
+The plan holds the checksum of the configuration, with what it includes, the
+tags, the architectures and the packages resolved for each, with their
+checksums. It has no timestamps and is sorted, so that tools such as a
+Terraform or OpenTofu provider can compare it with the plan of what was last
+built to detect drift.
+
+With --digests, the image is built, without being pushed anywhere, to add the
+digest of the index and of the image of each platform to the plan. Builds are
+reproducible, so these are the digests that publish pushes given the same
+flags, such as --vcs, --annotations, --lockfile and --build-date, which plan
+takes too.`,
+		Example: `  apko plan apko.yaml cgr.dev/example/image:latest
+  apko plan --digests apko.yaml cgr.dev/example/image:latest`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
+			imageOpts, err := iopts.buildOptions()
+			if err != nil {
+				return err
+			}
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			kopts.transport = transport
+			keychain, err := newKeychain(cmd.Context(), kopts)
+			if err != nil {
+				return err
+			}
+			return PlanCmd(cmd.Context(), cmd.OutOrStdout(), args[1:], types.ParseArchitectures(archstrs), digests, append([]build.Option{
+				build.WithConfigVariables(vars),
+				build.WithConfig(args[0], []string{}),
+				build.WithTags(args[1:]...),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithKeychain(keychain),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			}, imageOpts...)...)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().BoolVar(&digests, "digests", false, "build the image, without pushing it, to add the digests of the index and images to the plan")
+	addBuildArgFlags(cmd, &bopts)
+	addImageFlags(cmd, &iopts)
+	addTransportFlags(cmd, &topts)
+	addKeychainFlags(cmd, &kopts)
+
+	return cmd
+}
+
+// PlanCmd writes the plan of a build of the configuration set up by opts, for
+// archs and tags, to w as JSON. With digests, the image is built to add the
+// digests of the index and images to it.
+func PlanCmd(ctx context.Context, w io.Writer, tags []string, archs []types.Architecture, digests bool, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	o, ic, err := build.NewOptions(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	archs = ic.Archs
+	log.Infof("Planning a build for %d architectures: %+v", len(archs), archs)
+
+	mc, err := build.NewMultiArch(ctx, archs, append(slices.Clone(opts), build.WithImageConfiguration(*ic))...)
+	if err != nil {
+		return err
+	}
+	lists, err := mc.BuildPackageLists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get package list for image: %w", err)
+	}
+
+	plan := buildPlan{
+		Config:        planConfig{Name: o.ImageConfigFile, Checksum: o.ImageConfigChecksum},
+		Tags:          tags,
+		Architectures: []string{},
+		Packages:      map[string][]planPackage{},
+	}
+	if plan.Tags == nil {
+		plan.Tags = []string{}
+	}
+	for arch, pkgs := range lists {
+		plan.Architectures = append(plan.Architectures, arch.ToAPK())
+		planned := make([]planPackage, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			planned = append(planned, planPackage{
+				Name:     pkg.Name,
+				Version:  pkg.Version,
+				Checksum: pkg.ChecksumString(),
+				Source:   pkg.URL(),
+			})
+		}
+		slices.SortFunc(planned, func(a, b planPackage) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
+		plan.Packages[arch.ToAPK()] = planned
+	}
+	slices.Sort(plan.Architectures)
+
+	if digests {
+		if err := planDigests(ctx, &plan, archs, opts...); err != nil {
+			return err
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
+
+// planDigests builds the image, in a working directory of its own, and sets
+// the digests of the index and its images in plan.
+func planDigests(ctx context.Context, plan *buildPlan, archs []types.Architecture, opts ...build.Option) error {
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	idx, _, err := build.BuildIndex(ctx, wd, archs, opts...)
+	if err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
+	d, err := idx.Digest()
+	if err != nil {
+		return err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	plan.Digest = d.String()
+	plan.Images = map[string]string{}
+	for _, desc := range im.Manifests {
+		platform := "image"
+		if desc.Platform != nil {
+			platform = desc.Platform.String()
+		}
+		plan.Images[platform] = desc.Digest.String()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	tags := []string{"example.com/test:latest"}
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(tags...),
+	}
+
+	var first, second bytes.Buffer
+	require.NoError(t, cli.PlanCmd(ctx, &first, tags, archs, false, opts...))
+	require.NoError(t, cli.PlanCmd(ctx, &second, tags, archs, false, opts...))
+	require.Equal(t, first.String(), second.String(), "plans should be deterministic")
+
+	var plan struct {
+		Config struct {
+			Checksum string `json:"checksum"`
+		} `json:"config"`
+		Tags          []string `json:"tags"`
+		Architectures []string `json:"architectures"`
+		Packages      map[string][]struct {
+			Name     string `json:"name"`
+			Version  string `json:"version"`
+			Checksum string `json:"checksum"`
+		} `json:"packages"`
+		Digest string            `json:"digest"`
+		Images map[string]string `json:"images"`
+	}
+	require.NoError(t, json.Unmarshal(first.Bytes(), &plan))
+	require.NotEmpty(t, plan.Config.Checksum)
+	require.Equal(t, tags, plan.Tags)
+	require.Equal(t, []string{"aarch64", "x86_64"}, plan.Architectures)
+	require.Len(t, plan.Packages, 2)
+	for _, pkgs := range plan.Packages {
+		require.NotEmpty(t, pkgs)
+		for _, pkg := range pkgs {
+			require.NotEmpty(t, pkg.Checksum, pkg.Name)
+		}
+	}
+	require.Empty(t, plan.Digest)
+
+	var withDigests bytes.Buffer
+	require.NoError(t, cli.PlanCmd(ctx, &withDigests, tags, archs, true, opts...))
+	require.NoError(t, json.Unmarshal(withDigests.Bytes(), &plan))
+	require.NotEmpty(t, plan.Digest)
+	require.Len(t, plan.Images, 2)
+	require.Contains(t, plan.Images, "linux/amd64")
+}
+
+func TestPlanImageFlags(t *testing.T) {
+	root := cli.New()
+	plan, _, err := root.Find([]string{"plan"})
+	require.NoError(t, err)
+	publish, _, err := root.Find([]string{"publish"})
+	require.NoError(t, err)
+
+	buildCmd, _, err := root.Find([]string{"build"})
+	require.NoError(t, err)
+
+	// What changes the digests is the same, with the same defaults, as in
+	// publish and build.
+	for _, name := range []string{"vcs", "build-date", "annotations", "lockfile", "package-append", "layer-format", "run-scriptlets"} {
+		f := plan.Flags().Lookup(name)
+		require.NotNil(t, f, name)
+		require.Equal(t, publish.Flags().Lookup(name).DefValue, f.DefValue, name)
+		require.Equal(t, buildCmd.Flags().Lookup(name).DefValue, f.DefValue, name)
+	}
+	// And it fetches what publish would, the same way.
+	for _, name := range []string{"allow-egress", "ca-file", "registry-auth", "credential-helper"} {
+		require.NotNil(t, plan.Flags().Lookup(name), name)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+// progressBarWidth is the number of cells in a package progress bar.
+const progressBarWidth = 30
+
+// progress renders build events as human-readable progress, one line per
+// event, with a progress bar of the packages installed for each
+// architecture.
+type progress struct {
+	mu        sync.Mutex
+	w         io.Writer
+	total     map[string]int
+	installed map[string]int
+}
+
+func newProgress(w io.Writer) *progress {
+	return &progress{
+		w:         w,
+		total:     map[string]int{},
+		installed: map[string]int{},
+	}
+}
+
+func (p *progress) Emit(ev events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	arch := ev.Arch
+	if arch == "" {
+		arch = "index"
+	}
+	switch ev.Type {
+	case events.PackagesResolved:
+		p.total[ev.Arch] += ev.Total
+		p.printf(arch, "installing %d packages", ev.Total)
+	case events.PackageInstalled:
+		p.installed[ev.Arch]++
+		p.printf(arch, "%s %s %s", bar(p.installed[ev.Arch], p.total[ev.Arch]), ev.Package, ev.Version)
+	case events.LayerBuilt:
+		p.printf(arch, "built layer %s (%s)", ev.Digest, humanize.IBytes(uint64(ev.Size))) //nolint:gosec // sizes are positive
+	case events.DigestComputed:
+		p.printf(arch, "digest %s", ev.Digest)
+	case events.TagPushed:
+		p.printf(arch, "pushed %s", ev.Reference)
+	case events.EgressDenied:
+		p.printf(arch, "denied request to %s", ev.Reference)
+	case events.PhaseFinished:
+		if ev.Error != "" {
+			p.printf(arch, "%s failed after %s: %s", ev.Phase, ev.Duration, ev.Error)
+		} else {
+			p.printf(arch, "%s done in %s", ev.Phase, ev.Duration)
+		}
+	}
+}
+
+func (p *progress) printf(arch, format string, args ...any) {
+	// Progress is best-effort; a broken terminal must not fail the build.
+	_, _ = fmt.Fprintf(p.w, "%-8s "+format+"\n", append([]any{arch}, args...)...)
+}
+
+// bar renders n out of total as a progress bar, or just n if total is unknown.
+func bar(n, total int) string {
+	if total <= 0 {
+		return fmt.Sprintf("%d", n)
+	}
+	filled := min(n*progressBarWidth/total, progressBarWidth)
+	return fmt.Sprintf("[%s%s] %*d/%d", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), len(fmt.Sprint(total)), n, total)
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf)
+
+	p.Emit(events.Event{Type: events.PackagesResolved, Arch: "x86_64", Total: 2})
+	p.Emit(events.Event{Type: events.PackageFetched, Arch: "x86_64", Package: "busybox"})
+	p.Emit(events.Event{Type: events.PackageInstalled, Arch: "x86_64", Package: "busybox", Version: "1.36.1-r0"})
+	p.Emit(events.Event{Type: events.PackageInstalled, Arch: "x86_64", Package: "musl", Version: "1.2.5-r0"})
+	p.Emit(events.Event{Type: events.LayerBuilt, Arch: "x86_64", Digest: "sha256:abc", Size: 2048})
+	p.Emit(events.Event{Type: events.DigestComputed, Digest: "sha256:def"})
+	p.Emit(events.Event{Type: events.TagPushed, Reference: "example.com/foo:latest"})
+
+	require.Equal(t, `x86_64   installing 2 packages
+x86_64   [###############...............] 1/2 busybox 1.36.1-r0
+x86_64   [##############################] 2/2 musl 1.2.5-r0
+x86_64   built layer sha256:abc (2.0 KiB)
+index    digest sha256:def
+index    pushed example.com/foo:latest
+`, buf.String())
+}
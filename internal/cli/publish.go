@@ -16,18 +16,23 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/authn/github"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/spf13/cobra"
 	"go.opentelemetry.io/otel"
+	"gopkg.in/yaml.v3"
 
 	"github.com/chainguard-dev/clog"
 
@@ -35,56 +40,123 @@ import (
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom/generator"
+	"chainguard.dev/apko/pkg/scan"
+	"chainguard.dev/apko/pkg/sign"
 )
 
 func publish() *cobra.Command {
 	var imageRefs string
-	var buildDate string
+	var outputJSON string
+	var tagRefs string
+	var scanners []string
+	var scanFailOn string
+	var githubOutput bool
 	var sbomPath string
 	var sbomFormats []string
+	var sbomVersions []string
 	var archstrs []string
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
-	var extraPackages []string
-	var rawAnnotations []string
-	var withVCS bool
+	var rawTagAnnotations []string
 	var writeSBOM bool
 	var local bool
+	var localTarget oci.LocalTarget
 	var cacheDir string
 	var offline bool
-	var lockfile string
+	var vendorDir string
 	var ignoreSignatures bool
+	var requireSigned bool
+	var validateRuntime bool
+	var jobs int
+	var uploadJobs int
+	var archTags bool
+	var skipTagging bool
+	var maxSize, maxLayerSize string
+	var policies []string
+	var packageVersionTag, packageVersionTagPrefix string
+	var packageVersionTagStem bool
+	var attachInputs bool
+	var inputsRef string
+	var policyPath string
+	var attachSBOMs bool
+	var signKey string
+	var signRefs bool
+	var attestSBOMs bool
+	var dryRun bool
+	var kopts keychainOptions
+	var topts transportOptions
+	var retryOpts retryOptions
+	var bopts buildArgOptions
+	var iopts imageOptions
 
 	cmd := &cobra.Command{
 		Use:   "publish <config.yaml> <tag...>",
 		Short: "Build and publish an image",
 		Long: `Publish a built image from a YAML configuration file.
 
-It is assumed that you have used "docker login" to store credentials
-in a keychain.`,
-		Example: `  apko publish hello-world.yaml hello:v1.0.0`,
+Registry credentials are read from the docker config, which "apko login"
+writes to without needing docker to be installed ($DOCKER_CONFIG, or
+~/.docker by default), along with any credential helpers configured there.
+See the --registry-auth and related flags for other ways of authenticating.
+
+Tags may be Go templates, rendered once the image is built with
+{{.PackageVersion "name"}}, the version of an installed package, {{.Date}},
+the build date as 20060102, {{.Created}}, the build time, {{.Arch}}, the
+architecture of a single-architecture image, {{.Digest}}, the digest of the
+index, and {{.DigestShort}}, the first 12 characters of its hex.`,
+		Example: `  apko publish hello-world.yaml hello:v1.0.0
+  apko publish nginx.yaml 'registry.example.com/nginx:{{.PackageVersion "nginx"}}-{{.Date}}'
+  apko publish --package-version-tag nginx --package-version-tag-stem nginx.yaml 'registry.example.com/nginx:{{.DigestShort}}'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 2 {
 				return fmt.Errorf("requires at least 2 arg(s), 1 config file and at least 1 tag for the image")
 			}
+			if !local && cmd.Flags().Changed("local-target") {
+				return fmt.Errorf("--local-target requires --local")
+			}
 
 			var sbomGenerators []generator.Generator
 			if writeSBOM && len(sbomFormats) > 0 {
-				sbomGenerators = generator.Generators(sbomFormats...)
+				var err error
+				if sbomGenerators, err = newSBOMGenerators(sbomFormats, sbomVersions); err != nil {
+					return err
+				}
 			}
 			archs := types.ParseArchitectures(archstrs)
-			annotations, err := parseAnnotations(rawAnnotations)
+			imageOpts, err := iopts.buildOptions()
 			if err != nil {
-				return fmt.Errorf("parsing annotations from command line: %w", err)
+				return err
+			}
+			tagAnnotations, err := parseTagAnnotations(rawTagAnnotations)
+			if err != nil {
+				return fmt.Errorf("parsing tag annotations from command line: %w", err)
 			}
 
-			keychain := authn.NewMultiKeychain(
-				authn.DefaultKeychain,
-				github.Keychain,
-			)
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			kopts.transport = transport
+			keychain, err := newKeychain(cmd.Context(), kopts)
+			if err != nil {
+				return err
+			}
+			// --jobs is how many architectures are built at once, uploads
+			// are bounded by --upload-jobs.
 			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain)}
+			retry, err := retryOpts.policy()
+			if err != nil {
+				return err
+			}
+			remoteOpts = append(remoteOpts, retry.RemoteOptions(transport)...)
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
 
 			pusher, err := remote.NewPusher(remoteOpts...)
 			if err != nil {
@@ -104,29 +176,61 @@ in a keychain.`,
 			}
 			defer os.RemoveAll(tmp)
 
+			ghOutput := ""
+			if githubOutput {
+				if ghOutput = os.Getenv("GITHUB_OUTPUT"); ghOutput == "" {
+					return errors.New("--github-output requires GITHUB_OUTPUT to be set, as in a GitHub Actions step")
+				}
+			}
+
 			if err := PublishCmd(cmd.Context(), imageRefs, archs, remoteOpts,
 				sbomPath,
-				[]build.Option{
+				append([]build.Option{
+					build.WithConfigVariables(vars),
 					build.WithConfig(args[0], []string{}),
-					build.WithBuildDate(buildDate),
 					build.WithSBOM(sbomPath),
 					build.WithSBOMGenerators(sbomGenerators...),
 					build.WithExtraKeys(extraKeys),
+					build.WithKeyringDir(keyringDir),
 					build.WithExtraBuildRepos(extraBuildRepos),
 					build.WithExtraRepos(extraRepos),
-					build.WithExtraPackages(extraPackages),
 					build.WithTags(args[1:]...),
-					build.WithVCS(withVCS),
-					build.WithAnnotations(annotations),
-					build.WithCache(cacheDir, offline, apk.NewCache(true)),
-					build.WithLockFile(lockfile),
+					build.WithPackageVersionTag(packageVersionTag, packageVersionTagStem, packageVersionTagPrefix),
+					build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
 					build.WithTempDir(tmp),
 					build.WithIgnoreSignatures(ignoreSignatures),
-				},
+					build.WithRequireSignedPackages(requireSigned),
+					build.WithValidateRuntime(validateRuntime),
+					build.WithTransport(transport),
+					build.WithKeychain(keychain),
+					build.WithJobs(jobs),
+					build.WithMaxSize(maxSize, maxLayerSize),
+					build.WithPolicies(policies...),
+					build.WithVendorDir(vendorDir),
+					build.WithRegistryCAFile(topts.caFile),
+					build.WithInsecureRegistries(topts.insecureRegistries...),
+				}, imageOpts...),
 				[]PublishOption{
 					// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
 					WithLocal(local),
+					WithLocalTarget(localTarget),
 					WithTags(args[1:]...),
+					WithTagAnnotations(tagAnnotations),
+					WithArchTags(archTags),
+					WithSkipTagging(skipTagging),
+					WithAttachBuildInputs(attachInputs),
+					WithBuildInputsRef(inputsRef),
+					WithSigningPolicy(policyPath),
+					WithAttachSBOMs(attachSBOMs),
+					WithSigningKey(signKey),
+					WithSigningReferrers(signRefs),
+					WithAttestSBOMs(attestSBOMs),
+					WithUploadJobs(uploadJobs),
+					WithDryRun(dryRunOutput(dryRun)),
+					WithOutputJSON(outputJSON),
+					WithTagRefs(tagRefs),
+					WithGitHubOutput(ghOutput),
+					WithScanners(scanFailOn, scanners...),
 				},
 			); err != nil {
 				return err
@@ -135,25 +239,56 @@ in a keychain.`,
 		},
 	}
 
-	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
-	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate an SBOM")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "path to write the SBOMs")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config.")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", []string{"spdx"}, "SBOM formats to output")
+	cmd.Flags().StringSliceVar(&sbomVersions, "sbom-format-version", []string{}, "version of an SBOM format to output, as format=version (e.g. spdx=2.2); defaults to the latest supported")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
-	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
-	cmd.Flags().StringSliceVar(&rawAnnotations, "annotations", []string{}, "OCI annotations to add. Separate with colon (key:value)")
+	cmd.Flags().StringSliceVar(&rawTagAnnotations, "tag-annotations", []string{}, "OCI annotations to add to the index pushed to just one tag, as tag=key:value; that tag gets an index of its own, holding the same images")
+	cmd.Flags().BoolVar(&archTags, "arch-tags", false, "also push the image of each architecture to <tag>-<arch> for each tag, e.g. 1.2.3-amd64, for clients that cannot pull multi-architecture indexes")
+	cmd.Flags().BoolVar(&skipTagging, "skip-tagging", false, "push the image, its SBOMs, signatures and attestations by digest only, without pushing any tag, and print its digest, for the tags to be applied later; signatures and attestations are stored as referrers, as with --sign-referrers, and registries without the referrers API still get the sha256-<digest> tags of the referrers tag schema, as does --build-inputs-ref if it is a tag")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
-	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
+	cmd.Flags().StringVar(&vendorDir, "vendor-dir", "", "build offline from a directory written by apko vendor, after checking it against its manifest")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().BoolVar(&requireSigned, "require-signed-packages", false, "fail unless every installed package is signed by a key in the keyring and matches the checksum in its repository index")
+	cmd.Flags().BoolVar(&validateRuntime, "validate-runtime", false, "fail unless the entrypoint program, work-dir and run-as user of the image exist in its filesystem")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "fail the build if the compressed layers of the image of an architecture add up to more than this size, e.g. 100MiB; overrides max-size.image in the config")
+	cmd.Flags().StringVar(&maxLayerSize, "max-layer-size", "", "fail the build if a compressed layer of the image is larger than this size, e.g. 50MiB; overrides max-size.layer in the config")
+	cmd.Flags().StringSliceVar(&policies, "policy", []string{}, "fail the build if it violates this Rego (.rego, queried for data.apko.deny with opa) or CUE (.cue, vetted with cue) policy, evaluated against the config, the installed packages and the SBOMs")
+	cmd.Flags().StringVar(&packageVersionTag, "package-version-tag", "", "also tag the image, in the repository of each tag, with the version of this package")
+	cmd.Flags().BoolVar(&packageVersionTagStem, "package-version-tag-stem", false, "with --package-version-tag, also tag the image with the major.minor.patch, major.minor and major versions the version starts with, and latest")
+	cmd.Flags().StringVar(&packageVersionTagPrefix, "package-version-tag-prefix", "", "prefix of the tags of --package-version-tag, e.g. v")
+	cmd.Flags().IntVar(&jobs, "jobs", 0, "maximum number of architectures to build concurrently (0 builds all architectures at once); the layers of each image are uploaded as --upload-jobs says")
+	cmd.Flags().IntVar(&uploadJobs, "upload-jobs", 0, "maximum number of blobs to upload concurrently across all architectures; blobs shared by several architectures are uploaded once (0 means 4)")
+	addKeychainFlags(cmd, &kopts)
+	addTransportFlags(cmd, &topts)
+	addRetryFlags(cmd, &retryOpts)
+	addBuildArgFlags(cmd, &bopts)
+	addImageFlags(cmd, &iopts)
+	cmd.Flags().StringSliceVar(&topts.insecureRegistries, "insecure-registry", []string{}, "registry (host[:port]) to allow publishing to over plain HTTP or without verifying its certificate")
 
 	// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
-	cmd.Flags().BoolVar(&local, "local", false, "publish image just to local Docker daemon")
+	cmd.Flags().BoolVar(&local, "local", false, "publish image just to local Docker daemon, or the image store of --local-target")
+	addLocalTargetFlags(cmd, &localTarget)
 	cmd.Flags().StringVar(&imageRefs, "image-refs", "", "path to file where a list of the published image references will be written")
+	cmd.Flags().StringVar(&tagRefs, "tag-refs", "", "path to file where the tags the index was pushed to will be written, as tag@digest, one per line")
+	cmd.Flags().BoolVar(&githubOutput, "github-output", false, "set the digest, image (repository@digest) and tags (tag@digest, one per line) outputs of the GitHub Actions step, in $GITHUB_OUTPUT")
+	cmd.Flags().StringVar(&outputJSON, "output-json", "", "path to file where the digests of the published index and images, their layers and sizes, the tags and the SBOM references will be written as JSON")
+	cmd.Flags().BoolVar(&attachInputs, "attach-build-inputs", false, "push the config and lockfile as an OCI artifact referring to the published index")
+	cmd.Flags().StringVar(&inputsRef, "build-inputs-ref", "", "reference to push the config and lockfile to as a standalone OCI artifact")
+	cmd.Flags().BoolVar(&attachSBOMs, "attach-sboms", false, "push every generated SBOM, in each of --sbom-formats, as an OCI artifact referring to the image it describes")
+	cmd.Flags().StringVar(&signKey, "sign-key", "", "path to a PEM private key, or KMS URI (awskms://, azurekms://, gcpkms:// or hashivault://), to sign the published index and images with, cosign style; encrypted cosign keys are decrypted with COSIGN_PASSWORD. Keyless signing is not supported")
+	cmd.Flags().BoolVar(&signRefs, "sign-referrers", false, "store signatures with the OCI referrers API instead of at .sig tags, falling back to the referrers tag schema on registries without it")
+	cmd.Flags().BoolVar(&attestSBOMs, "attest-sboms", false, "push every generated SBOM as an in-toto attestation signed with --sign-key, at cosign's .att tags (or as referrers with --sign-referrers), for policy engines that only consume attestations")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "build everything, but instead of pushing print the manifests and digests (and any SBOM references) that would be published as JSON")
+	cmd.Flags().StringSliceVar(&scanners, "scan", []string{}, "scan the built images for vulnerabilities before publishing them, with grype, trivy (run on the SPDX SBOMs) or secdb=<path or URL> (an Alpine secdb style database)")
+	cmd.Flags().StringVar(&scanFailOn, "scan-fail-on", "high", "severity of the vulnerabilities found by --scan that fail publishing, and above: unknown, negligible, low, medium, high or critical; those of unknown severity always fail")
+	cmd.Flags().StringVar(&policyPath, "signing-policy", "", "path to a signing policy that every destination must satisfy; publish fails before building if it cannot")
 
 	return cmd
 }
@@ -169,6 +304,54 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 			return err
 		}
 	}
+	if opts.dryRun != nil && opts.local {
+		return errors.New("a dry run cannot publish locally")
+	}
+
+	o, _, err := build.NewOptions(ctx, buildOpts...)
+	if err != nil {
+		return err
+	}
+	if o.RegistryCAFile != "" || len(o.InsecureRegistries) != 0 {
+		// Only a plain transport is configured here. Wrapped ones, such as
+		// those of the transport flags, are composed over a transport that
+		// already trusts the registries, and are used as they are rather
+		// than replaced, which would drop their wrappers.
+		t := o.Transport
+		if base, ok := o.Transport.(*http.Transport); ok || o.Transport == nil {
+			if t, err = oci.RegistryTransport(base, o.RegistryCAFile, o.InsecureRegistries); err != nil {
+				return err
+			}
+		}
+		// Any transport from ropt takes precedence, it is already configured.
+		ropt = append([]remote.Option{remote.WithTransport(t)}, ropt...)
+	}
+
+	var signer *sign.Signer
+	if opts.signKey != "" && !opts.local {
+		if sign.IsKMSRef(opts.signKey) {
+			signer, err = sign.LoadKMSKey(ctx, opts.signKey)
+		} else {
+			signer, err = sign.LoadKey(opts.signKey)
+		}
+		if err != nil {
+			return err
+		}
+		// cosign's .sig and .att tags are tags too, which --skip-tagging
+		// must not push.
+		signer.Referrers = opts.signRefs || opts.skipTagging
+	}
+	if opts.attestSBOMs && opts.signKey == "" {
+		return errors.New("attesting SBOMs requires a signing key")
+	}
+
+	// fail before doing any work if the signing policy can't be satisfied,
+	// by the tags known before building
+	if opts.policy != "" && !opts.local {
+		if err := checkSigningPolicy(opts, signer, o, slices.DeleteFunc(slices.Clone(opts.tags), oci.IsTagTemplate)); err != nil {
+			return err
+		}
+	}
 
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
@@ -177,48 +360,124 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 	defer os.RemoveAll(wd)
 
 	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, buildOpts...)
+	idx, sboms, inputs, err := build.BuildIndexWithInputs(ctx, wd, archs, buildOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to build image components: %w", err)
 	}
 
+	if len(opts.scanners) != 0 {
+		if err := scanIndex(ctx, idx, sboms, opts.scanners, opts.scanFailOn, o.Transport); err != nil {
+			return err
+		}
+	}
+
+	tags, err := publishTags(idx, opts.tags, o)
+	if err != nil {
+		return err
+	}
+	if opts.policy != "" && !opts.local && !slices.Equal(tags, opts.tags) {
+		if err := checkSigningPolicy(opts, signer, o, tags); err != nil {
+			return err
+		}
+	}
+
 	var (
 		local           = opts.local
-		tags            = opts.tags
 		builtReferences = make([]string, 0)
 	)
 
 	if local {
 		// TODO: We shouldn't even need to build the index if we're loading a single image.
-		ref, err := oci.LoadIndex(ctx, idx, tags)
+		ref, err := oci.LoadIndexInto(ctx, opts.localTarget, idx, tags)
 		if err != nil {
 			return fmt.Errorf("loading index: %w", err)
 		}
 		log.Infof("using local option, exiting early")
-		fmt.Println(ref.String())
+		printDigest(ctx, ref.String())
 		return nil
 	}
 
-	// publish each arch-specific image
-	// TODO: This should just happen as part of PublishIndex.
-	ref, err := name.ParseReference(tags[0])
+	var attach []types.SBOM
+	if opts.attachSBOMs {
+		attach = sboms
+	}
+	publisher, err := oci.NewPublisher(
+		oci.WithTags(tags...),
+		oci.WithInsecureRegistries(o.InsecureRegistries...),
+		oci.WithTagAnnotations(opts.tagAnnots),
+		oci.WithArchTags(opts.archTags),
+		oci.WithAttachedSBOMs(attach),
+		oci.WithUploadJobs(opts.uploadJobs),
+		oci.WithRemoteOptions(ropt...),
+	)
 	if err != nil {
-		return fmt.Errorf("parsing %q as tag: %w", tags[0], err)
+		return err
+	}
+	tagRefs := publisher.References()
+	if opts.dryRun != nil {
+		return writeDryRun(opts.dryRun, idx, tagRefs, sboms, opts)
 	}
-	refs, err := oci.PublishImagesFromIndex(ctx, idx, ref.Context(), ropt...)
+	// Everything is pushed by digest first, and tagged once all of it was,
+	// so that a failure leaves no tag pointing at a partial publication.
+	res, err := publisher.Push(ctx, idx)
 	if err != nil {
-		return fmt.Errorf("publishing images from index: %w", err)
+		return err
 	}
-	for _, ref := range refs {
+	finalDigest := res.Index
+	for _, ref := range res.ImageDigests() {
 		builtReferences = append(builtReferences, ref.String())
 	}
+	builtReferences = append(builtReferences, finalDigest.String())
+	repo := publisher.Repository()
 
-	// publish the index
-	finalDigest, err := oci.PublishIndex(ctx, idx, tags, ropt...)
-	if err != nil {
-		return fmt.Errorf("publishing image index: %w", err)
+	// sign the index and the images, if requested
+	if signer != nil {
+		sigs, err := signer.Sign(ctx, append([]name.Digest{finalDigest}, res.ImageDigests()...), ropt...)
+		if err != nil {
+			return fmt.Errorf("signing: %w", err)
+		}
+		for _, sig := range sigs {
+			builtReferences = append(builtReferences, sig.String())
+		}
+	}
+
+	// attach the sboms, if requested
+	if err := publisher.AttachSBOMs(ctx, idx, res); err != nil {
+		return err
+	}
+	for _, ref := range res.SBOMs {
+		builtReferences = append(builtReferences, ref.String())
+	}
+
+	// attest the sboms, if requested
+	if opts.attestSBOMs && signer != nil {
+		atts, err := sbomAttestations(repo, sboms)
+		if err != nil {
+			return err
+		}
+		refs, err := signer.Attest(ctx, atts, ropt...)
+		if err != nil {
+			return fmt.Errorf("attesting SBOMs: %w", err)
+		}
+		for _, ref := range refs {
+			builtReferences = append(builtReferences, ref.String())
+		}
+	}
+
+	// publish the build inputs, if requested
+	if opts.attachInput || opts.inputsRef != "" {
+		refs, err := publishBuildInputs(ctx, idx, repo, inputs, opts, o, ropt)
+		if err != nil {
+			return fmt.Errorf("publishing build inputs: %w", err)
+		}
+		builtReferences = append(builtReferences, refs...)
+	}
+
+	if opts.skipTagging {
+		log.Infof("skipping tagging, %s is published by digest only", finalDigest)
+	} else if err := publisher.Tag(ctx, idx, res); err != nil {
+		return err
 	}
-	builtReferences = append(builtReferences, finalDigest.String())
 
 	// output any file info requested
 	// If provided, this is the name of the file to write digest referenced into
@@ -229,6 +488,38 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 		}
 	}
 
+	if opts.outputJSON != "" {
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(opts.outputJSON, append(b, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write publish result: %w", err)
+		}
+	}
+
+	if opts.tagRefs != "" {
+		var b strings.Builder
+		for _, tag := range res.Tags {
+			fmt.Fprintln(&b, tag)
+		}
+		for _, img := range res.Images {
+			for _, tag := range img.Tags {
+				fmt.Fprintln(&b, tag)
+			}
+		}
+		//nolint:gosec // Make tag ref file readable by non-root
+		if err := os.WriteFile(opts.tagRefs, []byte(b.String()), 0o666); err != nil {
+			return fmt.Errorf("failed to write tag references: %w", err)
+		}
+	}
+
+	if opts.ghOutput != "" {
+		if err := writeGitHubOutput(opts.ghOutput, res); err != nil {
+			return fmt.Errorf("setting GitHub Actions outputs: %w", err)
+		}
+	}
+
 	// copy sboms over to the sbomPath target directory
 	if sbomPath != "" {
 		for _, sbom := range sboms {
@@ -241,11 +532,253 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 
 	// Write the image digest to STDOUT in order to enable command
 	// composition e.g. kn service create --image=$(apko publish ...)
-	fmt.Println(finalDigest)
+	printDigest(ctx, finalDigest.String())
 
 	return nil
 }
 
+// printDigest prints ref, what was published, to stdout, unless the events
+// are written there, where it would break the stream: it is only logged then,
+// and --image-refs is where scripts read it from.
+func printDigest(ctx context.Context, ref string) {
+	if eventsOnStdout(ctx) {
+		clog.FromContext(ctx).Infof("published %s", ref)
+		return
+	}
+	fmt.Println(ref)
+}
+
+// writeGitHubOutput appends the digest, image and tags outputs of res to the
+// GitHub Actions step output file at path.
+func writeGitHubOutput(path string, res *oci.PublishResult) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digest=%s\n", res.Index.DigestStr())
+	fmt.Fprintf(&b, "image=%s\n", res.Index)
+	// A multiline value is delimited by a line that none of its lines is.
+	delim := "APKO_" + strings.TrimPrefix(res.Index.DigestStr(), "sha256:")
+	fmt.Fprintf(&b, "tags<<%s\n", delim)
+	for _, tag := range res.Tags {
+		fmt.Fprintln(&b, tag)
+	}
+	fmt.Fprintln(&b, delim)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func dryRunOutput(dryRun bool) io.Writer {
+	if dryRun {
+		return os.Stdout
+	}
+	return nil
+}
+
+// dryRunManifest is a manifest that a dry run would have published.
+type dryRunManifest struct {
+	Reference string          `json:"reference"`
+	Tags      []string        `json:"tags,omitempty"`
+	Platform  *v1.Platform    `json:"platform,omitempty"`
+	Manifest  json.RawMessage `json:"manifest"`
+}
+
+// dryRunReport is what a dry run would have published.
+type dryRunReport struct {
+	Index  dryRunManifest   `json:"index"`
+	Images []dryRunManifest `json:"images"`
+	SBOMs  []string         `json:"sboms,omitempty"`
+}
+
+// writeDryRun writes to w what publishing idx to tags would push.
+func writeDryRun(w io.Writer, idx v1.ImageIndex, tags []name.Reference, sboms []types.SBOM, opts publishOpt) error {
+	repo := tags[0].Context()
+
+	h, err := idx.Digest()
+	if err != nil {
+		return fmt.Errorf("computing index digest: %w", err)
+	}
+	raw, err := idx.RawManifest()
+	if err != nil {
+		return fmt.Errorf("reading index manifest: %w", err)
+	}
+	report := dryRunReport{Index: dryRunManifest{
+		Reference: repo.Digest(h.String()).String(),
+		Manifest:  raw,
+	}}
+	for _, tag := range tags {
+		report.Index.Tags = append(report.Index.Tags, tag.Name())
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("reading index manifest: %w", err)
+	}
+	for _, m := range im.Manifests {
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return fmt.Errorf("reading image %s: %w", m.Digest, err)
+		}
+		raw, err := img.RawManifest()
+		if err != nil {
+			return fmt.Errorf("reading manifest of %s: %w", m.Digest, err)
+		}
+		dm := dryRunManifest{
+			Reference: repo.Digest(m.Digest.String()).String(),
+			Platform:  m.Platform,
+			Manifest:  raw,
+		}
+		if opts.archTags && m.Platform != nil {
+			for _, ref := range tags {
+				if tag, ok := ref.(name.Tag); ok {
+					dm.Tags = append(dm.Tags, oci.ArchTag(tag, m.Platform).Name())
+				}
+			}
+		}
+		report.Images = append(report.Images, dm)
+	}
+
+	if opts.attachSBOMs {
+		refs, err := oci.SBOMReferences(idx, repo, sboms)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			report.SBOMs = append(report.SBOMs, ref.String())
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// checkSigningPolicy checks that what opts is going to publish satisfies the
+// signing policy for each destination, when signed by signer, if not nil.
+func checkSigningPolicy(opts publishOpt, signer *sign.Signer, o *options.Options, tags []string) error {
+	policy, err := sign.LoadPolicy(opts.policy)
+	if err != nil {
+		return err
+	}
+
+	var pub sign.Publication
+	if signer != nil {
+		pub.Key = signer.Public()
+	}
+	if opts.attachInput {
+		pub.Attestations = append(pub.Attestations, oci.BuildInputsArtifactType)
+	}
+	if opts.attachSBOMs {
+		for _, gen := range o.SBOMGenerators {
+			pub.Attestations = append(pub.Attestations, string(oci.SBOMMediaType(gen.Key())))
+		}
+	}
+
+	if opts.attestSBOMs {
+		for _, gen := range o.SBOMGenerators {
+			pt, err := oci.SBOMPredicateType(gen.Key())
+			if err != nil {
+				return err
+			}
+			pub.Attestations = append(pub.Attestations, pt)
+		}
+	}
+
+	var errs []error
+	for _, tag := range tags {
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			return fmt.Errorf("parsing %q as tag: %w", tag, err)
+		}
+		errs = append(errs, policy.Check(ref.Context(), pub))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("signing policy not satisfied: %w", err)
+	}
+	return nil
+}
+
+// publishTags returns the tags to publish idx to: tags, with templates
+// rendered, and the package version tags of o, if any.
+func publishTags(idx v1.ImageIndex, tags []string, o *options.Options) ([]string, error) {
+	if o.PackageVersionTag == "" && !slices.ContainsFunc(tags, oci.IsTagTemplate) {
+		return tags, nil
+	}
+	// Both read the images, which is only done once.
+	data, err := oci.NewTagData(idx)
+	if err != nil {
+		return nil, err
+	}
+	if tags, err = data.RenderTags(tags); err != nil {
+		return nil, err
+	}
+	if o.PackageVersionTag == "" {
+		return tags, nil
+	}
+	versionTags, err := data.PackageVersionTags(tags, o.PackageVersionTag, o.PackageVersionTagStem, o.PackageVersionTagPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("tagging with the version of %s: %w", o.PackageVersionTag, err)
+	}
+	return append(slices.Clone(tags), versionTags...), nil
+}
+
+// sbomAttestations returns the attestation of every SBOM about the image or
+// index in repo that it describes.
+func sbomAttestations(repo name.Repository, sboms []types.SBOM) ([]sign.Attestation, error) {
+	atts := make([]sign.Attestation, 0, len(sboms))
+	for _, s := range sboms {
+		pt, err := oci.SBOMPredicateType(s.Format)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(s.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading SBOM: %w", err)
+		}
+		atts = append(atts, sign.Attestation{
+			Subject:       repo.Digest(s.Digest.String()),
+			PredicateType: pt,
+			Predicate:     b,
+		})
+	}
+	return atts, nil
+}
+
+// publishBuildInputs pushes the resolved configuration and lockfile used for
+// the build as OCI artifacts, as requested by opts.
+func publishBuildInputs(ctx context.Context, idx v1.ImageIndex, repo name.Repository, in *build.Inputs, opts publishOpt, o *options.Options, ropt []remote.Option) ([]string, error) {
+	config, err := yaml.Marshal(in.Config)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling config: %w", err)
+	}
+
+	var refs []string
+	if opts.attachInput {
+		dig, err := oci.PublishBuildInputs(ctx, idx, config, in.Lock, repo, nil, ropt...)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, dig.String())
+	}
+	if opts.inputsRef != "" {
+		ref, err := oci.ParseReference(opts.inputsRef, o.InsecureRegistries)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q as reference: %w", opts.inputsRef, err)
+		}
+		dig, err := oci.PublishBuildInputs(ctx, idx, config, in.Lock, repo, ref, ropt...)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, dig.String())
+	}
+	return refs, nil
+}
+
 func parseAnnotations(rawAnnotations []string) (map[string]string, error) {
 	annotations := map[string]string{}
 	keyRegex := regexp.MustCompile(`^[a-z0-9-\.]+$`)
@@ -267,3 +800,53 @@ func parseAnnotations(rawAnnotations []string) (map[string]string, error) {
 	}
 	return annotations, nil
 }
+
+// parseTagAnnotations parses annotations written as tag=key:value, by tag.
+func parseTagAnnotations(rawAnnotations []string) (map[string]map[string]string, error) {
+	byTag := map[string][]string{}
+	for _, s := range rawAnnotations {
+		tag, annotation, ok := strings.Cut(s, "=")
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("unable to parse tag annotation: %s", s)
+		}
+		byTag[tag] = append(byTag[tag], annotation)
+	}
+	annotations := make(map[string]map[string]string, len(byTag))
+	for tag, raw := range byTag {
+		a, err := parseAnnotations(raw)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		annotations[tag] = a
+	}
+	return annotations, nil
+}
+
+// scanIndex scans the images of idx, with their SBOMs, with the scanners of
+// specs, failing on the findings as severe as failOn or more. Security
+// databases are fetched through transport.
+func scanIndex(ctx context.Context, idx v1.ImageIndex, sboms []types.SBOM, specs []string, failOn string, transport http.RoundTripper) error {
+	threshold := scan.SeverityHigh
+	if failOn != "" {
+		var err error
+		if threshold, err = scan.ParseSeverity(failOn); err != nil {
+			return err
+		}
+	}
+	scanners := make([]scan.Scanner, 0, len(specs))
+	for _, spec := range specs {
+		s, err := scan.NewScanner(spec, scan.WithTransport(transport))
+		if err != nil {
+			return err
+		}
+		scanners = append(scanners, s)
+	}
+	targets, err := scan.Targets(idx, sboms)
+	if err != nil {
+		return fmt.Errorf("reading images to scan: %w", err)
+	}
+	if err := scan.Check(ctx, scanners, targets, threshold); err != nil {
+		return fmt.Errorf("scanning images: %w", err)
+	}
+	return nil
+}
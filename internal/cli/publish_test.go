@@ -16,7 +16,14 @@ package cli_test
 
 import (
 	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/fs"
@@ -26,6 +33,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -36,12 +44,16 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 
 	"chainguard.dev/apko/internal/cli"
 	"chainguard.dev/apko/pkg/apk/expandapk/tarfs"
 	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+	"chainguard.dev/apko/pkg/sign"
 )
 
 func TestPublish(t *testing.T) {
@@ -118,6 +130,447 @@ func (s *sentinel) RoundTrip(in *http.Request) (*http.Response, error) {
 	return s.rt.RoundTrip(in)
 }
 
+func TestPublishBuildInputs(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish", u.Host)
+	standalone := fmt.Sprintf("%s/test/publish-inputs:latest", u.Host)
+
+	archs := types.ParseArchitectures([]string{"amd64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithAttachBuildInputs(true),
+		cli.WithBuildInputsRef(standalone),
+	}
+
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	desc, err := remote.Head(ref, ropt...)
+	require.NoError(t, err)
+
+	referrers, err := remote.Referrers(ref.Context().Digest(desc.Digest.String()), ropt...)
+	require.NoError(t, err)
+	im, err := referrers.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 1)
+	require.Equal(t, oci.BuildInputsArtifactType, im.Manifests[0].ArtifactType)
+
+	sref, err := name.ParseReference(standalone)
+	require.NoError(t, err)
+	img, err := remote.Image(sref, ropt...)
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	mt, err := layers[0].MediaType()
+	require.NoError(t, err)
+	require.Equal(t, oci.ConfigMediaType, mt)
+
+	// The configuration published is the one built, for the architectures
+	// built rather than those it lists.
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	var ic types.ImageConfiguration
+	require.NoError(t, yaml.NewDecoder(rc).Decode(&ic))
+	require.Equal(t, archs, ic.Archs)
+}
+
+func TestPublishAttachSBOMs(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish", u.Host)
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMGenerators(spdx.New()),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithAttachSBOMs(true),
+	}
+
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	idx, err := remote.Index(ref, ropt...)
+	require.NoError(t, err)
+	h, err := idx.Digest()
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 2)
+
+	// The index and each image have their own SBOM attached.
+	for _, dig := range []v1.Hash{h, im.Manifests[0].Digest, im.Manifests[1].Digest} {
+		referrers, err := remote.Referrers(ref.Context().Digest(dig.String()), ropt...)
+		require.NoError(t, err)
+		rm, err := referrers.IndexManifest()
+		require.NoError(t, err)
+		require.Len(t, rm.Manifests, 1)
+		require.Equal(t, "application/spdx+json", rm.Manifests[0].ArtifactType)
+		art, err := remote.Image(ref.Context().Digest(rm.Manifests[0].Digest.String()), ropt...)
+		require.NoError(t, err)
+		am, err := art.Manifest()
+		require.NoError(t, err)
+		require.Contains(t, am.Annotations, "org.opencontainers.image.created")
+	}
+}
+
+func TestPublishOutputJSON(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish:latest", u.Host)
+	out := filepath.Join(t.TempDir(), "result.json")
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMGenerators(spdx.New()),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithAttachSBOMs(true),
+		cli.WithOutputJSON(out),
+	}
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var res oci.PublishResult
+	require.NoError(t, json.Unmarshal(b, &res))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	desc, err := remote.Head(ref, ropt...)
+	require.NoError(t, err)
+	require.Equal(t, desc.Digest.String(), res.Index.DigestStr())
+	require.Len(t, res.Tags, 1)
+	require.Equal(t, dst+"@"+desc.Digest.String(), res.Tags[0].String())
+	require.Len(t, res.Images, 2)
+	for _, img := range res.Images {
+		require.NotNil(t, img.Platform)
+		require.NotEmpty(t, img.Layers)
+		_, err := remote.Image(img.Digest, ropt...)
+		require.NoError(t, err)
+	}
+	// An SBOM for each image and one for the index.
+	require.Len(t, res.SBOMs, 3)
+}
+
+func TestPublishGitHubOutput(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	latest := fmt.Sprintf("%s/test/publish:latest", u.Host)
+	stable := fmt.Sprintf("%s/test/publish:stable", u.Host)
+	tmp := t.TempDir()
+	tagRefs := filepath.Join(tmp, "tag-refs")
+	ghOutput := filepath.Join(tmp, "github-output")
+	// Outputs of earlier steps are kept.
+	require.NoError(t, os.WriteFile(ghOutput, []byte("earlier=step\n"), 0o644))
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(latest, stable),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(latest, stable),
+		cli.WithTagRefs(tagRefs),
+		cli.WithGitHubOutput(ghOutput),
+	}
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	ref, err := name.ParseReference(latest)
+	require.NoError(t, err)
+	desc, err := remote.Head(ref, ropt...)
+	require.NoError(t, err)
+	dig := desc.Digest.String()
+
+	b, err := os.ReadFile(tagRefs)
+	require.NoError(t, err)
+	require.Equal(t, latest+"@"+dig+"\n"+stable+"@"+dig+"\n", string(b))
+
+	b, err = os.ReadFile(ghOutput)
+	require.NoError(t, err)
+	delim := "APKO_" + strings.TrimPrefix(dig, "sha256:")
+	want := "earlier=step\n" +
+		"digest=" + dig + "\n" +
+		"image=" + ref.Context().String() + "@" + dig + "\n" +
+		"tags<<" + delim + "\n" +
+		latest + "@" + dig + "\n" +
+		stable + "@" + dig + "\n" +
+		delim + "\n"
+	require.Equal(t, want, string(b))
+}
+
+func TestPublishTagAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	latest := fmt.Sprintf("%s/test/publish:latest", u.Host)
+	stable := fmt.Sprintf("%s/test/publish:stable", u.Host)
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(latest, stable),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(latest, stable),
+		cli.WithTagAnnotations(map[string]map[string]string{
+			"stable": {"com.example.channel": "stable"},
+		}),
+	}
+
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	manifest := func(tag string) *v1.IndexManifest {
+		ref, err := name.ParseReference(tag)
+		require.NoError(t, err)
+		idx, err := remote.Index(ref, ropt...)
+		require.NoError(t, err)
+		im, err := idx.IndexManifest()
+		require.NoError(t, err)
+		return im
+	}
+	lm, sm := manifest(latest), manifest(stable)
+	require.NotContains(t, lm.Annotations, "com.example.channel")
+	require.Equal(t, "stable", sm.Annotations["com.example.channel"])
+	// Both tags hold the same images.
+	require.Equal(t, lm.Manifests, sm.Manifests)
+}
+
+func TestPublishAttestSBOMs(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish", u.Host)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMGenerators(spdx.New()),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithAttestSBOMs(true),
+	}
+
+	err = cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts)
+	require.ErrorContains(t, err, "requires a signing key")
+
+	publishOpts = append(publishOpts, cli.WithSigningKey(keyPath))
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	idx, err := remote.Index(ref, ropt...)
+	require.NoError(t, err)
+	h, err := idx.Digest()
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 2)
+
+	// The index and each image have their own SBOM attestation.
+	for _, dig := range []v1.Hash{h, im.Manifests[0].Digest, im.Manifests[1].Digest} {
+		att, err := remote.Image(ref.Context().Tag("sha256-"+dig.Hex+".att"), ropt...)
+		require.NoError(t, err)
+		m, err := att.Manifest()
+		require.NoError(t, err)
+		require.Len(t, m.Layers, 1)
+		require.Equal(t, sign.DSSEMediaType, m.Layers[0].MediaType)
+		require.Equal(t, "https://spdx.dev/Document", m.Layers[0].Annotations[sign.PredicateTypeAnnotation])
+	}
+}
+
+func TestPublishDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	var writes int
+	r := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			writes++
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish", u.Host)
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMGenerators(spdx.New()),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithAttachSBOMs(true),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, append(publishOpts, cli.WithDryRun(&out))))
+	require.Zero(t, writes)
+
+	var report struct {
+		Index struct {
+			Reference string   `json:"reference"`
+			Tags      []string `json:"tags"`
+		} `json:"index"`
+		Images []struct {
+			Reference string       `json:"reference"`
+			Platform  *v1.Platform `json:"platform"`
+			Manifest  v1.Manifest  `json:"manifest"`
+		} `json:"images"`
+		SBOMs []string `json:"sboms"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Images, 2)
+	require.Len(t, report.SBOMs, 3)
+	require.Equal(t, []string{dst + ":latest"}, report.Index.Tags)
+	for _, img := range report.Images {
+		require.NotNil(t, img.Platform)
+		require.Len(t, img.Manifest.Layers, 1)
+	}
+
+	// Publishing for real pushes what the dry run predicted.
+	refsFile := filepath.Join(t.TempDir(), "refs")
+	require.NoError(t, cli.PublishCmd(ctx, refsFile, archs, ropt, "", opts, publishOpts))
+	b, err := os.ReadFile(refsFile)
+	require.NoError(t, err)
+	refs := strings.Fields(string(b))
+	require.Contains(t, refs, report.Index.Reference)
+	for _, img := range report.Images {
+		require.Contains(t, refs, img.Reference)
+	}
+	for _, sbom := range report.SBOMs {
+		require.Contains(t, refs, sbom)
+	}
+
+	require.Error(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, append(publishOpts, cli.WithDryRun(&out), cli.WithLocal(true))))
+}
+
+func TestPublishCustomCA(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewTLSServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0o644))
+
+	dst := fmt.Sprintf("%s/test/publish", u.Host)
+	archs := types.ParseArchitectures([]string{"amd64"})
+	publish := func(opts ...build.Option) error {
+		opts = append(opts,
+			build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+			build.WithTags(dst),
+		)
+		return cli.PublishCmd(ctx, "", archs, nil, "", opts, []cli.PublishOption{cli.WithTags(dst)})
+	}
+
+	// The registry certificate is not trusted by default.
+	require.ErrorContains(t, publish(), "certificate")
+	require.NoError(t, publish(build.WithRegistryCAFile(caFile)))
+	require.NoError(t, publish(build.WithInsecureRegistries(u.Host)))
+
+	// A wrapped transport that trusts the registry is kept, wrappers and all.
+	trusted, err := oci.RegistryTransport(nil, caFile, nil)
+	require.NoError(t, err)
+	var requests atomic.Int32
+	wrapped := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return trusted.RoundTrip(req)
+	})
+	require.NoError(t, publish(build.WithTransport(wrapped), build.WithRegistryCAFile(caFile)))
+	require.NotZero(t, requests.Load())
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestPublishSigningPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	dst := "registry.example.com/prod/app"
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(policy, []byte("rules:\n  - destination: registry.example.com/prod/*\n    signed: true\n"), 0o644))
+
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(dst),
+		cli.WithSigningPolicy(policy),
+	}
+
+	// The policy is checked before anything is built or pushed.
+	err := cli.PublishCmd(ctx, "", types.ParseArchitectures([]string{"amd64"}), nil, "", opts, publishOpts)
+	require.ErrorContains(t, err, "must be signed")
+}
+
 func TestPublishLayering(t *testing.T) {
 	ctx := context.Background()
 	tmp := t.TempDir()
@@ -251,3 +704,224 @@ func checkEarlyFiles(t *testing.T, idx v1.ImageIndex) {
 		assert.Less(t, pos, maxOffset, "file %q found too late in image (pos %d)", f, pos)
 	}
 }
+
+func TestPublishTagTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	repo := fmt.Sprintf("%s/test/publish", u.Host)
+	tmpl := repo + `:{{.PackageVersion "replayout"}}-{{.DigestShort}}`
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	tagRefs := filepath.Join(t.TempDir(), "tags")
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(tmpl),
+		build.WithPackageVersionTag("replayout", true, "v"),
+	}
+	publishOpts := []cli.PublishOption{cli.WithTags(tmpl), cli.WithTagRefs(tagRefs)}
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	b, err := os.ReadFile(tagRefs)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 6)
+	digest := lines[0][strings.LastIndex(lines[0], "@sha256:")+len("@sha256:"):]
+	want := []string{
+		repo + ":1.0.0-r0-" + digest[:12],
+		repo + ":v1.0.0-r0",
+		repo + ":v1.0.0",
+		repo + ":v1.0",
+		repo + ":v1",
+		repo + ":latest",
+	}
+	for i, line := range lines {
+		tag, _, _ := strings.Cut(line, "@")
+		require.Equal(t, want[i], tag)
+	}
+
+	// Images of several architectures have no single one.
+	opts[1] = build.WithTags(repo + ":{{.Arch}}")
+	err = cli.PublishCmd(ctx, "", archs, ropt, "", opts, []cli.PublishOption{cli.WithTags(repo + ":{{.Arch}}")})
+	require.ErrorContains(t, err, "the index holds the images of 2 architectures, not one")
+}
+
+func TestPublishArchTags(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	repo := fmt.Sprintf("%s/test/publish", u.Host)
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	outputJSON := filepath.Join(t.TempDir(), "publish.json")
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(repo+":1.2.3", repo+":latest"),
+	}
+	publishOpts := []cli.PublishOption{
+		cli.WithTags(repo+":1.2.3", repo+":latest"),
+		cli.WithArchTags(true),
+		cli.WithOutputJSON(outputJSON),
+	}
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+	b, err := os.ReadFile(outputJSON)
+	require.NoError(t, err)
+	var res oci.PublishResult
+	require.NoError(t, json.Unmarshal(b, &res))
+	require.Len(t, res.Images, 2)
+	for _, img := range res.Images {
+		arch := img.Platform.Architecture
+		require.Equal(t, []string{repo + ":1.2.3-" + arch, repo + ":latest-" + arch}, []string{img.Tags[0].Reference, img.Tags[1].Reference})
+
+		// The tag holds the image itself, not an index.
+		ref, err := name.ParseReference(repo + ":1.2.3-" + arch)
+		require.NoError(t, err)
+		desc, err := remote.Get(ref, ropt...)
+		require.NoError(t, err)
+		require.True(t, desc.MediaType.IsImage(), desc.MediaType)
+		require.Equal(t, img.Digest.DigestStr(), desc.Digest.String())
+	}
+}
+
+func TestPublishSkipTagging(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish:latest", u.Host)
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+	outputRefs := filepath.Join(t.TempDir(), "refs")
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+	}
+	publishOpts := []cli.PublishOption{cli.WithTags(dst), cli.WithArchTags(true), cli.WithSkipTagging(true)}
+	require.NoError(t, cli.PublishCmd(ctx, outputRefs, archs, ropt, "", opts, publishOpts))
+
+	// The index and its images are there by digest, but not tagged.
+	b, err := os.ReadFile(outputRefs)
+	require.NoError(t, err)
+	refs := strings.Fields(string(b))
+	require.Len(t, refs, 3)
+	for _, r := range refs {
+		ref, err := name.ParseReference(r)
+		require.NoError(t, err)
+		_, err = remote.Head(ref, ropt...)
+		require.NoError(t, err, r)
+	}
+	repo, err := name.NewRepository(fmt.Sprintf("%s/test/publish", u.Host))
+	require.NoError(t, err)
+	tags, err := remote.List(repo, ropt...)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+}
+
+func TestPublishSkipTaggingSigned(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	for _, referrers := range []bool{true, false} {
+		t.Run(fmt.Sprintf("referrers=%t", referrers), func(t *testing.T) {
+			s := httptest.NewServer(registry.New(registry.WithReferrersSupport(referrers)))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err)
+
+			dst := fmt.Sprintf("%s/test/publish:latest", u.Host)
+			archs := types.ParseArchitectures([]string{"amd64"})
+			ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+			opts := []build.Option{
+				build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+				build.WithTags(dst),
+				build.WithSBOMGenerators(spdx.New()),
+			}
+			publishOpts := []cli.PublishOption{
+				cli.WithTags(dst),
+				cli.WithSkipTagging(true),
+				cli.WithSigningKey(keyPath),
+				cli.WithAttachSBOMs(true),
+				cli.WithAttestSBOMs(true),
+				cli.WithAttachBuildInputs(true),
+			}
+			require.NoError(t, cli.PublishCmd(ctx, "", archs, ropt, "", opts, publishOpts))
+
+			repo, err := name.NewRepository(fmt.Sprintf("%s/test/publish", u.Host))
+			require.NoError(t, err)
+			tags, err := remote.List(repo, ropt...)
+			require.NoError(t, err)
+			if referrers {
+				// Everything is a referrer, of which nothing is tagged.
+				require.Empty(t, tags)
+				return
+			}
+			// Only the fallback tags listing the referrers of each manifest
+			// are pushed, not cosign's .sig and .att tags.
+			require.NotEmpty(t, tags)
+			for _, tag := range tags {
+				require.Regexp(t, `^sha256-[0-9a-f]{64}$`, tag)
+			}
+		})
+	}
+}
+
+func TestPublishEventsStdout(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	dst := fmt.Sprintf("%s/test/publish:latest", u.Host)
+	refs := filepath.Join(t.TempDir(), "refs")
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	var out bytes.Buffer
+	copied := make(chan error)
+	go func() {
+		_, err := io.Copy(&out, r)
+		copied <- err
+	}()
+
+	cmd := cli.New()
+	cmd.SetArgs([]string{"publish", filepath.Join("testdata", "apko.yaml"), dst, "--arch", "amd64", "--sbom=false", "--events-file", "-", "--image-refs", refs})
+	err = cmd.ExecuteContext(context.Background())
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	require.NoError(t, <-copied)
+	require.NoError(t, err)
+
+	// Every line on stdout is an event, the digest is only in --image-refs.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.NotEmpty(t, lines)
+	for _, l := range lines {
+		var ev events.Event
+		require.NoError(t, json.Unmarshal([]byte(l), &ev), l)
+		require.NotEmpty(t, ev.Type, l)
+	}
+	b, err := os.ReadFile(refs)
+	require.NoError(t, err)
+	require.Contains(t, string(b), u.Host+"/test/publish@sha256:")
+}
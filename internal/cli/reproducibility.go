@@ -0,0 +1,161 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// checkReproducible builds the image again, in a working directory of its
+// own, and fails if the result differs from idx.
+func checkReproducible(ctx context.Context, idx v1.ImageIndex, archs []types.Architecture, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+	log.Infof("building again to check the build is reproducible")
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+	tmp := filepath.Join(wd, "tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return fmt.Errorf("creating tempdir: %w", err)
+	}
+
+	// The layers of the first build are still in its temporary directory.
+	opts = append(slices.Clone(opts), build.WithTempDir(tmp))
+	again, _, err := build.BuildIndex(ctx, wd, archs, opts...)
+	if err != nil {
+		return fmt.Errorf("building again: %w", err)
+	}
+
+	if err := compareIndexes(idx, again); err != nil {
+		return fmt.Errorf("build is not reproducible: %w", err)
+	}
+	d, err := idx.Digest()
+	if err != nil {
+		return err
+	}
+	log.Infof("build is reproducible: both builds are %s", d)
+	return nil
+}
+
+// compareIndexes returns an error describing each image, config and layer in
+// which two builds of the same image differ, or nil if they do not.
+func compareIndexes(want, got v1.ImageIndex) error {
+	wd, err := want.Digest()
+	if err != nil {
+		return err
+	}
+	gd, err := got.Digest()
+	if err != nil {
+		return err
+	}
+	if wd == gd {
+		return nil
+	}
+	errs := []error{fmt.Errorf("index digest %s != %s", wd, gd)}
+
+	wm, err := want.IndexManifest()
+	if err != nil {
+		return err
+	}
+	gm, err := got.IndexManifest()
+	if err != nil {
+		return err
+	}
+	if len(wm.Manifests) != len(gm.Manifests) {
+		return errors.Join(append(errs, fmt.Errorf("%d images != %d", len(wm.Manifests), len(gm.Manifests)))...)
+	}
+
+	for i, desc := range wm.Manifests {
+		other := gm.Manifests[i]
+		if desc.Digest == other.Digest {
+			continue
+		}
+		platform := "image"
+		if desc.Platform != nil {
+			platform = desc.Platform.String()
+		}
+		errs = append(errs, fmt.Errorf("%s digest %s != %s", platform, desc.Digest, other.Digest))
+
+		wi, err := want.Image(desc.Digest)
+		if err != nil {
+			return err
+		}
+		gi, err := got.Image(other.Digest)
+		if err != nil {
+			return err
+		}
+		if err := compareImages(platform, wi, gi); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func compareImages(platform string, want, got v1.Image) error {
+	var errs []error
+
+	wc, err := want.ConfigName()
+	if err != nil {
+		return err
+	}
+	gc, err := got.ConfigName()
+	if err != nil {
+		return err
+	}
+	if wc != gc {
+		errs = append(errs, fmt.Errorf("%s config %s != %s", platform, wc, gc))
+	}
+
+	wl, err := want.Layers()
+	if err != nil {
+		return err
+	}
+	gl, err := got.Layers()
+	if err != nil {
+		return err
+	}
+	if len(wl) != len(gl) {
+		return errors.Join(append(errs, fmt.Errorf("%s has %d layers != %d", platform, len(wl), len(gl)))...)
+	}
+	for i := range wl {
+		wd, err := wl[i].DiffID()
+		if err != nil {
+			return err
+		}
+		gd, err := gl[i].DiffID()
+		if err != nil {
+			return err
+		}
+		if wd != gd {
+			errs = append(errs, fmt.Errorf("%s layer %d %s != %s", platform, i, wd, gd))
+		}
+	}
+	return errors.Join(errs...)
+}
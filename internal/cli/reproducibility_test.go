@@ -0,0 +1,58 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestReproducibilityCheck(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}), build.WithTags("golden:latest")}
+
+	require.NoError(t, buildAndWrite(ctx, archs, t.TempDir(), true, writeLayout(ctx, dir, []string{"golden:latest"}), opts...))
+
+	idx, err := layout.ImageIndexFromPath(dir)
+	require.NoError(t, err)
+	require.NoError(t, compareIndexes(idx, idx))
+
+	// Builds at different dates differ in their configs and indexes.
+	other := t.TempDir()
+	require.NoError(t, BuildLayoutCmd(ctx, other, archs, []string{"golden:latest"}, t.TempDir(), append(opts, build.WithBuildDate("2024-01-01T00:00:00Z"))...))
+	differ, err := layout.ImageIndexFromPath(other)
+	require.NoError(t, err)
+
+	wm, err := idx.IndexManifest()
+	require.NoError(t, err)
+	gm, err := differ.IndexManifest()
+	require.NoError(t, err)
+	want, err := idx.ImageIndex(wm.Manifests[0].Digest)
+	require.NoError(t, err)
+	got, err := differ.ImageIndex(gm.Manifests[0].Digest)
+	require.NoError(t, err)
+
+	err = compareIndexes(want, got)
+	require.ErrorContains(t, err, "index digest")
+	require.ErrorContains(t, err, "linux/amd64 config")
+}
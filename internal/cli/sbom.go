@@ -0,0 +1,36 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"chainguard.dev/apko/pkg/sbom/generator"
+)
+
+// newSBOMGenerators returns the generators of formats, emitting the versions
+// given as format=version.
+func newSBOMGenerators(formats, versions []string) ([]generator.Generator, error) {
+	byFormat := make(map[string]string, len(versions))
+	for _, v := range versions {
+		format, version, ok := strings.Cut(v, "=")
+		if !ok || format == "" || version == "" {
+			return nil, fmt.Errorf("SBOM format version %q must be of the form format=version", v)
+		}
+		byFormat[format] = version
+	}
+	return generator.WithVersions(generator.Generators(formats...), byFormat)
+}
@@ -0,0 +1,604 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// ServeLimits bounds the resources a BuildServer gives to builds.
+type ServeLimits struct {
+	// Jobs is how many builds run at once.
+	Jobs int
+	// QueuedJobs is how many builds wait for one to finish before new ones
+	// are turned away.
+	QueuedJobs int
+	// ConfigSize is the largest request body accepted, in bytes.
+	ConfigSize int64
+	// JobTimeout is how long a build may take, or zero for no limit.
+	JobTimeout time.Duration
+	// JobRetention is how long a finished build can still be looked up.
+	JobRetention time.Duration
+	// PrivateRepositories is whether configurations may use repositories
+	// and keys at loopback, private or link-local addresses, which are
+	// otherwise turned away so that clients cannot reach the network of
+	// the server through it.
+	PrivateRepositories bool
+}
+
+// DefaultServeLimits are the limits of apko serve unless flags say otherwise.
+var DefaultServeLimits = ServeLimits{
+	Jobs:         2,
+	QueuedJobs:   16,
+	ConfigSize:   1 << 20,
+	JobTimeout:   30 * time.Minute,
+	JobRetention: time.Hour,
+}
+
+func serveCmd() *cobra.Command {
+	var addr string
+	var limits = DefaultServeLimits
+	var extraKeys []string
+	var keyringDir string
+	var extraRepos []string
+	var cacheDir string
+	var kopts keychainOptions
+	var topts transportOptions
+	var retryOpts retryOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP API that builds and publishes configurations",
+		Long: `Serve an HTTP API that builds and publishes configurations.
+
+POST /v1/builds with a JSON body of the configuration (as YAML, in "config"),
+the architectures ("archs", default all, unless specified in the config), the
+tags ("tags") and whether to push to them ("publish") starts a build and
+returns it, with its "id". GET /v1/builds/{id} returns the build: its "status"
+(queued, running, succeeded or failed), its "error" if it failed and, once it
+succeeded, the digests of the index ("digest") and of the image of each
+platform ("images"), and what was pushed ("published").
+
+Each build has a working directory of its own, removed when it finishes. At
+most --max-jobs builds run at once, and a build is turned away with 429 when
+--max-queued-jobs already wait. Configurations cannot include files, copy
+files of the build machine into the image or build on a base image, since
+those read the files of the machine apko serve runs on, nor use repositories
+or keys at loopback, private or link-local addresses, unless
+--allow-private-repositories is set.
+
+Once it is interrupted, the server stops accepting builds, fails the ones that
+are still queued and waits for the ones that are running to finish.
+
+The server is not authenticated and pushes with its own credentials: only
+expose it to clients trusted to publish to the registries it can push to.`,
+		Example: `  apko serve --addr localhost:8080
+  curl -d '{"config": "...", "tags": ["registry.example.com/image:latest"], "publish": true}' localhost:8080/v1/builds`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			kopts.transport = transport
+			keychain, err := newKeychain(cmd.Context(), kopts)
+			if err != nil {
+				return err
+			}
+			retry, err := retryOpts.policy()
+			if err != nil {
+				return err
+			}
+			remoteOpts := append([]remote.Option{remote.WithAuthFromKeychain(keychain)}, retry.RemoteOptions(transport)...)
+
+			s, err := NewBuildServer(cmd.Context(), limits, remoteOpts, topts.insecureRegistries,
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraRepos(extraRepos),
+				build.WithCache(cacheDir, topts.noNetwork, apk.NewCache(true)),
+				build.WithTransport(transport),
+				build.WithKeychain(keychain),
+			)
+			if err != nil {
+				return err
+			}
+			return ServeCmd(cmd.Context(), addr, s)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "localhost:8080", "address to listen on")
+	cmd.Flags().IntVar(&limits.Jobs, "max-jobs", limits.Jobs, "maximum number of builds to run at once")
+	cmd.Flags().IntVar(&limits.QueuedJobs, "max-queued-jobs", limits.QueuedJobs, "maximum number of builds waiting to run before new ones are turned away")
+	cmd.Flags().Int64Var(&limits.ConfigSize, "max-request-size", limits.ConfigSize, "maximum size of a build request, in bytes")
+	cmd.Flags().DurationVar(&limits.JobTimeout, "job-timeout", limits.JobTimeout, "maximum duration of a build (0 means no limit)")
+	cmd.Flags().DurationVar(&limits.JobRetention, "job-retention", limits.JobRetention, "how long finished builds can still be looked up")
+	cmd.Flags().BoolVar(&limits.PrivateRepositories, "allow-private-repositories", limits.PrivateRepositories, "allow configurations to use repositories and keys at loopback, private or link-local addresses")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring of every build")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring of every build")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include in every build")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes, shared by all builds (default '' means to use system-defined cache directory)")
+	addKeychainFlags(cmd, &kopts)
+	addTransportFlags(cmd, &topts)
+	addRetryFlags(cmd, &retryOpts)
+	cmd.Flags().StringSliceVar(&topts.insecureRegistries, "insecure-registry", []string{}, "registry (host[:port]) to allow publishing to over plain HTTP or without verifying its certificate")
+
+	return cmd
+}
+
+// ServeCmd serves s on addr until ctx is done, and then waits for the builds
+// that are running to finish.
+func ServeCmd(ctx context.Context, addr string, s *BuildServer) error {
+	log := clog.FromContext(ctx)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 3 * time.Second,
+	}
+	log.Infof("serving builds on %s", l.Addr())
+
+	var g errgroup.Group
+	g.Go(func() error {
+		if err := server.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		if err := server.Shutdown(context.WithoutCancel(ctx)); err != nil {
+			return err
+		}
+		s.Wait()
+		return nil
+	})
+	return g.Wait()
+}
+
+// serveBuildRequest is the body of POST /v1/builds.
+type serveBuildRequest struct {
+	Config  string   `json:"config"`
+	Archs   []string `json:"archs,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Publish bool     `json:"publish,omitempty"`
+}
+
+const (
+	serveJobQueued    = "queued"
+	serveJobRunning   = "running"
+	serveJobSucceeded = "succeeded"
+	serveJobFailed    = "failed"
+)
+
+// serveJob is a build, as GET /v1/builds/{id} returns it.
+type serveJob struct {
+	ID        string             `json:"id"`
+	Status    string             `json:"status"`
+	Error     string             `json:"error,omitempty"`
+	Digest    string             `json:"digest,omitempty"`
+	Images    map[string]string  `json:"images,omitempty"`
+	Published *oci.PublishResult `json:"published,omitempty"`
+}
+
+// BuildServer builds and publishes the configurations it is sent over HTTP,
+// as apko serve does.
+type BuildServer struct {
+	ctx        context.Context
+	stopped    <-chan struct{}
+	limits     ServeLimits
+	remoteOpts []remote.Option
+	insecure   []string
+	opts       []build.Option
+	mux        *http.ServeMux
+
+	running chan struct{}
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	queued int
+	jobs   map[string]*serveJob
+}
+
+// NewBuildServer returns a BuildServer that runs builds with ctx, within
+// limits, and with opts on top of the configuration it is sent, and pushes
+// with remoteOpts. Once ctx is done, the builds that are queued fail, while
+// the ones that are running are not cancelled, so that Wait can wait for
+// them to finish.
+func NewBuildServer(ctx context.Context, limits ServeLimits, remoteOpts []remote.Option, insecure []string, opts ...build.Option) (*BuildServer, error) {
+	if limits.Jobs < 1 {
+		return nil, fmt.Errorf("at least one build must be able to run, got %d", limits.Jobs)
+	}
+	s := &BuildServer{
+		ctx:        context.WithoutCancel(ctx),
+		stopped:    ctx.Done(),
+		limits:     limits,
+		remoteOpts: remoteOpts,
+		insecure:   insecure,
+		opts:       opts,
+		mux:        http.NewServeMux(),
+		running:    make(chan struct{}, limits.Jobs),
+		jobs:       map[string]*serveJob{},
+	}
+	s.mux.HandleFunc("POST /v1/builds", s.createBuild)
+	s.mux.HandleFunc("GET /v1/builds/{id}", s.getBuild)
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return s, nil
+}
+
+func (s *BuildServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Wait waits for the builds that were started to finish.
+func (s *BuildServer) Wait() {
+	s.wg.Wait()
+}
+
+func (s *BuildServer) createBuild(w http.ResponseWriter, r *http.Request) {
+	var req serveBuildRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.limits.ConfigSize)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			serveError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request is larger than %d bytes", s.limits.ConfigSize))
+			return
+		}
+		serveError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %w", err))
+		return
+	}
+	if err := checkServedConfig(r.Context(), req.Config, s.limits.PrivateRepositories); err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Publish && len(req.Tags) == 0 {
+		serveError(w, http.StatusBadRequest, errors.New("no tags to publish"))
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return
+	}
+	job := &serveJob{ID: id, Status: serveJobQueued}
+
+	s.mu.Lock()
+	if s.queued >= s.limits.QueuedJobs+s.limits.Jobs {
+		s.mu.Unlock()
+		serveError(w, http.StatusTooManyRequests, errors.New("too many builds are queued"))
+		return
+	}
+	s.queued++
+	s.jobs[id] = job
+	snapshot := *job
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run(job, req)
+
+	w.Header().Set("Location", "/v1/builds/"+id)
+	serveJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (s *BuildServer) getBuild(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	var snapshot serveJob
+	if ok {
+		snapshot = *job
+	}
+	s.mu.Unlock()
+	if !ok {
+		serveError(w, http.StatusNotFound, fmt.Errorf("no build %q", r.PathValue("id")))
+		return
+	}
+	serveJSON(w, http.StatusOK, snapshot)
+}
+
+// run waits for a build to be able to run, runs job and records how it went.
+func (s *BuildServer) run(job *serveJob, req serveBuildRequest) {
+	defer s.wg.Done()
+	log := clog.FromContext(s.ctx).With("job", job.ID)
+	ctx := clog.WithLogger(s.ctx, log)
+
+	var digest string
+	var images map[string]string
+	var published *oci.PublishResult
+	var err error
+	select {
+	case s.running <- struct{}{}:
+		s.setStatus(job, func(job *serveJob) { job.Status = serveJobRunning })
+		log.Infof("building")
+
+		if s.limits.JobTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.limits.JobTimeout)
+			defer cancel()
+		}
+		digest, images, published, err = s.build(ctx, req)
+		<-s.running
+	case <-s.stopped:
+		err = errors.New("the build server stopped before the build could run")
+	}
+
+	s.setStatus(job, func(job *serveJob) {
+		s.queued--
+		if err != nil {
+			job.Status = serveJobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = serveJobSucceeded
+		job.Digest = digest
+		job.Images = images
+		job.Published = published
+	})
+	if err != nil {
+		log.Errorf("build failed: %v", err)
+	} else {
+		log.Info("build succeeded", "digest", digest)
+	}
+
+	time.AfterFunc(s.limits.JobRetention, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.jobs, job.ID)
+	})
+}
+
+func (s *BuildServer) setStatus(job *serveJob, update func(*serveJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(job)
+}
+
+// build builds req in a working directory of its own and, if asked to,
+// publishes it.
+func (s *BuildServer) build(ctx context.Context, req serveBuildRequest) (string, map[string]string, *oci.PublishResult, error) {
+	wd, err := os.MkdirTemp("", "apko-serve-*")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	config := filepath.Join(wd, "apko.yaml")
+	if err := os.WriteFile(config, []byte(req.Config), 0o600); err != nil {
+		return "", nil, nil, fmt.Errorf("writing configuration: %w", err)
+	}
+	tmp := filepath.Join(wd, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return "", nil, nil, fmt.Errorf("creating tempdir: %w", err)
+	}
+	work := filepath.Join(wd, "work")
+	if err := os.Mkdir(work, 0o755); err != nil {
+		return "", nil, nil, fmt.Errorf("creating working directory: %w", err)
+	}
+
+	opts := append(slices.Clone(s.opts),
+		build.WithConfig(config, []string{}),
+		build.WithTags(req.Tags...),
+		build.WithTempDir(tmp),
+	)
+	idx, _, err := build.BuildIndex(ctx, work, types.ParseArchitectures(req.Archs), opts...)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	d, err := idx.Digest()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	images := map[string]string{}
+	for _, desc := range im.Manifests {
+		platform := "image"
+		if desc.Platform != nil {
+			platform = desc.Platform.String()
+		}
+		images[platform] = desc.Digest.String()
+	}
+
+	if !req.Publish {
+		return d.String(), images, nil, nil
+	}
+	tags, err := oci.RenderTags(idx, req.Tags)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	publisher, err := oci.NewPublisher(
+		oci.WithTags(tags...),
+		oci.WithInsecureRegistries(s.insecure...),
+		oci.WithRemoteOptions(append(slices.Clone(s.remoteOpts), remote.WithContext(ctx))...),
+	)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	res, err := publisher.Publish(ctx, idx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return d.String(), images, res, nil
+}
+
+// checkServedConfig fails unless config is a configuration that apko serve
+// builds: one that does not read the files of the machine it runs on, nor
+// fetch from registries with its credentials, nor, unless private is set,
+// from its network, including in its arch-overrides, which ForArch merges
+// into what is built. The repositories and keys a server builds with are set
+// with its flags.
+//
+// config is loaded the way the build loads it, so that what is checked is
+// what is built.
+func checkServedConfig(ctx context.Context, config string, private bool) error {
+	if config == "" {
+		return errors.New("no configuration to build")
+	}
+	dir, err := os.MkdirTemp("", "apko-serve-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "apko.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		return fmt.Errorf("writing configuration: %w", err)
+	}
+
+	// Loading the configuration reads what it includes, so that is turned
+	// away first.
+	var written types.ImageConfiguration
+	if err := written.LoadWritten(ctx, path, nil, nil); err != nil {
+		return err
+	}
+	if written.Include != "" {
+		return errors.New("configurations cannot include files of the build server (include)")
+	}
+	var ic types.ImageConfiguration
+	if err := ic.LoadWithVariables(ctx, path, nil, sha256.New(), nil); err != nil {
+		return fmt.Errorf("failed to load image configuration: %w", err)
+	}
+	return checkServedImageConfig(ctx, ic, "", private)
+}
+
+func checkServedImageConfig(ctx context.Context, ic types.ImageConfiguration, prefix string, private bool) error {
+	switch {
+	case ic.Include != "":
+		return fmt.Errorf("configurations cannot include files of the build server (%sinclude)", prefix)
+	case len(ic.Contents.Files) != 0:
+		return fmt.Errorf("configurations cannot copy files of the build server (%scontents.files)", prefix)
+	case ic.Contents.BaseImage != nil:
+		return fmt.Errorf("configurations cannot build on a base image (%scontents.baseimage)", prefix)
+	}
+	if ic.Certificates != nil {
+		for _, c := range ic.Certificates.Additional {
+			if c.Path != "" {
+				return fmt.Errorf("configurations cannot read certificates of the build server (%scertificates.additional)", prefix)
+			}
+		}
+	}
+	if ic.Contents.KeyringDir != "" {
+		return fmt.Errorf("configurations cannot read keys of the build server (%scontents.keyring-dir)", prefix)
+	}
+	for _, f := range []struct {
+		field string
+		repos []string
+	}{
+		{"contents.repositories", ic.Contents.Repositories},
+		{"contents.build_repositories", ic.Contents.BuildRepositories},
+		{"contents.runtime_repositories", ic.Contents.RuntimeOnlyRepositories},
+		{"contents.keyring", ic.Contents.Keyring},
+	} {
+		for _, repo := range f.repos {
+			// Repositories may be tagged, as in @local https://...
+			fields := strings.Fields(repo)
+			if len(fields) == 0 {
+				continue
+			}
+			u := fields[len(fields)-1]
+			if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+				return fmt.Errorf("configurations can only use repositories and keys over HTTP(S), not %q (%s%s)", u, prefix, f.field)
+			}
+			if private {
+				continue
+			}
+			if err := checkPublicURL(ctx, u); err != nil {
+				return fmt.Errorf("configurations cannot use %q (%s%s): %w", u, prefix, f.field, err)
+			}
+		}
+	}
+	for arch, ov := range ic.ArchOverrides {
+		if err := checkServedImageConfig(ctx, ov, prefix+"arch-overrides."+arch+".", private); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPublicURL fails if the host of u is, or resolves to, a loopback,
+// private, link-local or unspecified address.
+func checkPublicURL(ctx context.Context, u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %w", host, err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			return fmt.Errorf("%s is at a loopback, private or link-local address (%s)", host, ip)
+		}
+	}
+	return nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating build id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func serveJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func serveError(w http.ResponseWriter, status int, err error) {
+	serveJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,232 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+)
+
+type servedBuild struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error"`
+	Digest    string            `json:"digest"`
+	Images    map[string]string `json:"images"`
+	Published *struct {
+		Index string `json:"index"`
+	} `json:"published"`
+}
+
+func postBuild(t *testing.T, url string, req any) (*http.Response, servedBuild) {
+	t.Helper()
+	b, err := json.Marshal(req)
+	require.NoError(t, err)
+	resp, err := http.Post(url+"/v1/builds", "application/json", bytes.NewReader(b))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var job servedBuild
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	return resp, job
+}
+
+func waitForBuild(t *testing.T, url, id string) servedBuild {
+	t.Helper()
+	for range 600 {
+		resp, err := http.Get(url + "/v1/builds/" + id)
+		require.NoError(t, err)
+		var job servedBuild
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		if job.Status == "succeeded" || job.Status == "failed" {
+			return job
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("build %s did not finish", id)
+	return servedBuild{}
+}
+
+func TestServe(t *testing.T) {
+	ctx := context.Background()
+
+	reg := httptest.NewServer(registry.New())
+	defer reg.Close()
+	u, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	dst := fmt.Sprintf("%s/test/serve:latest", u.Host)
+	ropt := []remote.Option{remote.WithTransport(reg.Client().Transport)}
+
+	// Served configurations cannot use local repositories, so the server
+	// provides them.
+	config := "contents:\n  packages:\n    - replayout\nentrypoint:\n  command: /bin/sh -l\n"
+
+	limits := cli.DefaultServeLimits
+	limits.ConfigSize = 4096
+	bs, err := cli.NewBuildServer(ctx, limits, ropt, nil,
+		build.WithExtraKeys([]string{filepath.Join("testdata", "melange.rsa.pub")}),
+		build.WithExtraRepos([]string{filepath.Join("testdata", "packages")}))
+	require.NoError(t, err)
+	s := httptest.NewServer(bs)
+	defer s.Close()
+	defer bs.Wait()
+
+	// Built only.
+	resp, job := postBuild(t, s.URL, map[string]any{"config": config, "archs": []string{"amd64"}})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Equal(t, "/v1/builds/"+job.ID, resp.Header.Get("Location"))
+	built := waitForBuild(t, s.URL, job.ID)
+	require.Equal(t, "succeeded", built.Status, built.Error)
+	require.NotEmpty(t, built.Digest)
+	require.Len(t, built.Images, 1)
+	require.Contains(t, built.Images, "linux/amd64")
+	require.Nil(t, built.Published)
+
+	// Built and published.
+	resp, job = postBuild(t, s.URL, map[string]any{"config": config, "archs": []string{"amd64"}, "tags": []string{dst}, "publish": true})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	published := waitForBuild(t, s.URL, job.ID)
+	require.Equal(t, "succeeded", published.Status, published.Error)
+	require.Equal(t, built.Digest, published.Digest, "builds should be reproducible")
+	require.NotNil(t, published.Published)
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	desc, err := remote.Head(ref, ropt...)
+	require.NoError(t, err)
+	require.Equal(t, published.Digest, desc.Digest.String())
+
+	// A failed build.
+	_, job = postBuild(t, s.URL, map[string]any{"config": "contents:\n  packages:\n    - does-not-exist\n"})
+	failed := waitForBuild(t, s.URL, job.ID)
+	require.Equal(t, "failed", failed.Status)
+	require.NotEmpty(t, failed.Error)
+
+	for _, c := range []struct {
+		name string
+		req  map[string]any
+		want int
+	}{
+		{"no config", map[string]any{}, http.StatusBadRequest},
+		{"files", map[string]any{"config": "contents:\n  files:\n    - source: /etc/shadow\n      destination: /shadow\n"}, http.StatusBadRequest},
+		{"include", map[string]any{"config": "include: /etc/apko.yaml\n"}, http.StatusBadRequest},
+		{"arch-override files", map[string]any{"config": "arch-overrides:\n  x86_64:\n    contents:\n      files:\n        - source: /etc/shadow\n          destination: /shadow\n"}, http.StatusBadRequest},
+		{"arch-override base image", map[string]any{"config": "arch-overrides:\n  amd64:\n    contents:\n      baseimage:\n        image: /var/lib/image\n"}, http.StatusBadRequest},
+		{"arch-override repository", map[string]any{"config": "arch-overrides:\n  amd64:\n    contents:\n      repositories:\n        - /var/lib/packages\n"}, http.StatusBadRequest},
+		{"local repository", map[string]any{"config": "contents:\n  repositories:\n    - \"@local ./packages\"\n"}, http.StatusBadRequest},
+		{"oci repository", map[string]any{"config": "contents:\n  repositories:\n    - oci://registry.example.com/packages\n"}, http.StatusBadRequest},
+		{"local keyring", map[string]any{"config": "contents:\n  keyring:\n    - /etc/apk/keys/key.rsa.pub\n"}, http.StatusBadRequest},
+		{"certificate path", map[string]any{"config": "certificates:\n  additional:\n    - name: host\n      path: /etc/ssl/private/key.pem\n"}, http.StatusBadRequest},
+		{"unknown field", map[string]any{"config": "contents:\n  packages:\n    - replayout\nnot-a-field: true\n"}, http.StatusBadRequest},
+		{"loopback repository", map[string]any{"config": "contents:\n  repositories:\n    - http://127.0.0.1:8080/packages\n"}, http.StatusBadRequest},
+		{"localhost repository", map[string]any{"config": "contents:\n  repositories:\n    - \"@local http://localhost/packages\"\n"}, http.StatusBadRequest},
+		{"private repository", map[string]any{"config": "contents:\n  repositories:\n    - https://10.0.0.1/packages\n"}, http.StatusBadRequest},
+		{"link-local keyring", map[string]any{"config": "contents:\n  keyring:\n    - http://169.254.169.254/latest/key.rsa.pub\n"}, http.StatusBadRequest},
+		{"arch-override private repository", map[string]any{"config": "arch-overrides:\n  amd64:\n    contents:\n      repositories:\n        - http://[::1]/packages\n"}, http.StatusBadRequest},
+		{"publish without tags", map[string]any{"config": config, "publish": true}, http.StatusBadRequest},
+		{"too large", map[string]any{"config": strings.Repeat("#", 8192)}, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			resp, _ := postBuild(t, s.URL, c.req)
+			require.Equal(t, c.want, resp.StatusCode)
+		})
+	}
+
+	resp, err = http.Get(s.URL + "/v1/builds/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServePrivateRepositories(t *testing.T) {
+	ctx := context.Background()
+
+	repo := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("testdata", "packages"))))
+	defer repo.Close()
+	config := fmt.Sprintf("contents:\n  repositories:\n    - %s\n  packages:\n    - pretend-baselayout\n", repo.URL)
+
+	limits := cli.DefaultServeLimits
+	limits.PrivateRepositories = true
+	bs, err := cli.NewBuildServer(ctx, limits, nil, nil,
+		build.WithExtraKeys([]string{filepath.Join("testdata", "packages", "melange.rsa.pub")}))
+	require.NoError(t, err)
+	s := httptest.NewServer(bs)
+	defer s.Close()
+	defer bs.Wait()
+
+	resp, job := postBuild(t, s.URL, map[string]any{"config": config, "archs": []string{"amd64"}})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, job.Error)
+	built := waitForBuild(t, s.URL, job.ID)
+	require.Equal(t, "succeeded", built.Status, built.Error)
+}
+
+func TestServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The repository answers once the server is stopped, so that the first
+	// build is still running then.
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	files := http.FileServer(http.Dir(filepath.Join("testdata", "packages")))
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(fetching) })
+		<-release
+		files.ServeHTTP(w, r)
+	}))
+	defer repo.Close()
+	config := fmt.Sprintf("contents:\n  repositories:\n    - %s\n  packages:\n    - pretend-baselayout\n", repo.URL)
+
+	limits := cli.DefaultServeLimits
+	limits.Jobs = 1
+	limits.PrivateRepositories = true
+	bs, err := cli.NewBuildServer(ctx, limits, nil, nil,
+		build.WithExtraKeys([]string{filepath.Join("testdata", "packages", "melange.rsa.pub")}))
+	require.NoError(t, err)
+	s := httptest.NewServer(bs)
+	defer s.Close()
+
+	_, running := postBuild(t, s.URL, map[string]any{"config": config, "archs": []string{"amd64"}})
+	<-fetching
+	_, queued := postBuild(t, s.URL, map[string]any{"config": config, "archs": []string{"amd64"}})
+
+	cancel()
+	// The queued build fails before the running one can finish.
+	require.Equal(t, "failed", waitForBuild(t, s.URL, queued.ID).Status)
+	close(release)
+	bs.Wait()
+
+	built := waitForBuild(t, s.URL, running.ID)
+	require.Equal(t, "succeeded", built.Status, built.Error)
+}
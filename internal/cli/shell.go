@@ -0,0 +1,119 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func shellCmd() *cobra.Command {
+	var buildArch string
+	var sandbox string
+	var ignoreSignatures bool
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var extraPackages []string
+	var cacheDir string
+	var offline bool
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "shell <config.yaml> [-- command...]",
+		Short: "Run a shell in the filesystem of an image, to explore it",
+		Long: `Run a shell in the filesystem of an image, to explore it.
+
+The filesystem is built for a single architecture and copied to a temporary
+directory, where a login shell, or the command given after the configuration,
+runs with a sandbox: proot, the default, which runs other architectures than
+the host's with qemu-user; chroot, which needs root; or bwrap. The copy, and
+whatever the shell changes in it, is removed when the shell exits.`,
+		Example: `  apko shell apko.yaml
+  apko shell --arch arm64 apko.yaml -- ls -l /usr/bin`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return ShellCmd(cmd.Context(), sandbox, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr(), args[1:],
+				build.WithConfig(args[0], []string{}),
+				build.WithArch(types.ParseArchitecture(buildArch)),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithExtraPackages(extraPackages),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(&buildArch, "arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
+	cmd.Flags().StringVar(&sandbox, "sandbox", build.ScriptletSandboxProot, "sandbox to run the shell in: proot, which runs other architectures with qemu-user, chroot, which needs root, or bwrap")
+	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// ShellCmd builds the filesystem of an image and runs command, or a login
+// shell if it is empty, in it with sandbox.
+func ShellCmd(ctx context.Context, sandbox string, stdin io.Reader, stdout, stderr io.Writer, command []string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	tmp, err := os.MkdirTemp(os.TempDir(), "apko-temp-*")
+	if err != nil {
+		return fmt.Errorf("creating tempdir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	bc, err := build.New(ctx, tarfs.New(), append([]build.Option{build.WithTempDir(tmp)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	ic := bc.ImageConfiguration()
+	if len(ic.Archs) != 0 {
+		log.Infof("ignoring archs in config, only building %s", bc.Arch())
+	}
+
+	if err := bc.BuildImage(ctx); err != nil {
+		return fmt.Errorf("building filesystem: %w", err)
+	}
+	return bc.Shell(ctx, sandbox, stdin, stdout, stderr, command...)
+}
@@ -17,54 +17,105 @@ package cli
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	showConfigFormatYAML = "yaml"
+	showConfigFormatJSON = "json"
 )
 
 func showConfig() *cobra.Command {
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var cacheDir string
 	var offline bool
+	var buildArch string
+	var format string
+	var diff bool
+	var bopts buildArgOptions
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use:   "show-config",
 		Short: "Show the configuration derived from loading a YAML file",
 		Long: `Show the configuration derived from loading a YAML file.
 
-The derived configuration is rendered in YAML.
+The derived configuration is what would be built for an architecture: with
+what it includes merged in, build args substituted, the arch-overrides of the
+architecture applied and defaults, such as the home directories of users,
+filled in. It is rendered in YAML, or with --format=json in JSON.
+
+With --diff, a unified diff from the configuration as written to the derived
+one is shown instead, both rendered the same way.
 `,
-		Example: `  apko show-config <config.yaml>`,
-		Args:    cobra.ExactArgs(1),
+		Example: `  apko show-config <config.yaml>
+  apko show-config --arch aarch64 --diff <config.yaml>`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return ShowConfigCmd(cmd.Context(),
+			if format != showConfigFormatYAML && format != showConfigFormatJSON {
+				return fmt.Errorf("unsupported format %q, expected %s or %s", format, showConfigFormatYAML, showConfigFormatJSON)
+			}
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
+			diffFrom := ""
+			if diff {
+				diffFrom = args[0]
+			}
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return ShowConfigCmd(cmd.Context(), cmd.OutOrStdout(), format, diffFrom,
+				build.WithConfigVariables(vars),
 				build.WithConfig(args[0], []string{}),
+				build.WithArch(types.ParseArchitecture(buildArch)),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
-				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithTransport(transport),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
 			)
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().StringVar(&buildArch, "arch", runtime.GOARCH, "architecture whose arch-overrides are applied -- default is Go runtime architecture")
+	cmd.Flags().StringVar(&format, "format", showConfigFormatYAML, "format to show the configuration in: yaml or json")
+	cmd.Flags().BoolVar(&diff, "diff", false, "show a unified diff from the configuration as written to the derived one")
+	addBuildArgFlags(cmd, &bopts)
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
 
-func ShowConfigCmd(ctx context.Context, opts ...build.Option) error {
+// ShowConfigCmd writes the configuration derived from opts to w, in format.
+// If diffFrom is set, a unified diff from the configuration of opts, as
+// written, to the derived one is written instead, labeled with diffFrom.
+func ShowConfigCmd(ctx context.Context, w io.Writer, format, diffFrom string, opts ...build.Option) error {
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
 		return fmt.Errorf("failed to create working directory: %w", err)
@@ -78,16 +129,54 @@ func ShowConfigCmd(ctx context.Context, opts ...build.Option) error {
 		return err
 	}
 
-	var buf bytes.Buffer
-	enc := yaml.NewEncoder(&buf)
+	derived, err := encodeConfig(bc.ImageConfiguration(), format)
+	if err != nil {
+		return err
+	}
 
-	if err := enc.Encode(bc.ImageConfiguration()); err != nil {
-		return fmt.Errorf("failed to encode YAML document: %w", err)
+	if diffFrom == "" {
+		if _, err := w.Write(derived); err != nil {
+			return fmt.Errorf("failed to write configuration: %w", err)
+		}
+		return nil
 	}
 
-	if _, err := buf.WriteTo(os.Stdout); err != nil {
-		return fmt.Errorf("failed to write YAML document: %w", err)
+	written, err := bc.WrittenConfiguration(ctx)
+	if err != nil {
+		return err
 	}
+	raw, err := encodeConfig(written, format)
+	if err != nil {
+		return err
+	}
+
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(raw)),
+		B:        difflib.SplitLines(string(derived)),
+		FromFile: diffFrom,
+		ToFile:   "derived",
+		Context:  3,
+	})
+}
 
-	return nil
+// encodeConfig renders ic in format, one of showConfigFormatYAML and
+// showConfigFormatJSON.
+func encodeConfig(ic types.ImageConfiguration, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	if format == showConfigFormatJSON {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ic); err != nil {
+			return nil, fmt.Errorf("failed to encode JSON document: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	enc := yaml.NewEncoder(&buf)
+	if err := enc.Encode(ic); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML document: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML document: %w", err)
+	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,73 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestShowConfig(t *testing.T) {
+	ctx := context.Background()
+	base, err := filepath.Abs(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`include: `+base+`
+accounts:
+  users:
+    - username: ${USER_NAME}
+      uid: 65532
+arch-overrides:
+  aarch64:
+    environment:
+      ARCH: arm64
+`), 0o644))
+
+	show := func(format, diffFrom, arch string) string {
+		var buf bytes.Buffer
+		require.NoError(t, cli.ShowConfigCmd(ctx, &buf, format, diffFrom,
+			build.WithConfigVariables(&types.Variables{Values: map[string]string{"USER_NAME": "nonroot"}, Strict: true}),
+			build.WithConfig(config, nil),
+			build.WithArch(types.ParseArchitecture(arch)),
+		))
+		return buf.String()
+	}
+
+	var ic types.ImageConfiguration
+	require.NoError(t, json.Unmarshal([]byte(show("json", "", "aarch64")), &ic))
+	require.Equal(t, []string{"replayout"}, ic.Contents.Packages)
+	require.Equal(t, "/home/nonroot", ic.Accounts.Users[0].HomeDir)
+	require.Equal(t, map[string]string{"ARCH": "arm64"}, ic.Environment)
+	require.Empty(t, ic.ArchOverrides)
+
+	require.NotContains(t, show("yaml", "", "x86_64"), "ARCH")
+
+	diff := show("yaml", config, "x86_64")
+	require.Contains(t, diff, "--- "+config+"\n+++ derived\n")
+	require.Contains(t, diff, "-          homedir: \"\"\n+          homedir: /home/nonroot\n")
+	require.Contains(t, diff, "+        - replayout\n")
+	// The configuration as written has its variables substituted too.
+	require.NotContains(t, diff, "USER_NAME")
+}
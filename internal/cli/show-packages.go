@@ -16,8 +16,12 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"text/tabwriter"
 	"text/template"
 
 	"github.com/spf13/cobra"
@@ -39,6 +43,11 @@ const (
 	formatPkgLock                          = `- {{ .Name }}={{ .Version }}`
 	formatPkgLockWithSource                = `- {{ .Name }}={{ .Version }} # {{ .Source }}`
 	showPkgsFormatDefault                  = formatNameSpaceVersion
+
+	// showPkgsFormatTable and showPkgsFormatJSON are not templates; they are
+	// rendered over all architectures at once.
+	showPkgsFormatTable = "table"
+	showPkgsFormatJSON  = "json"
 )
 
 var (
@@ -55,13 +64,17 @@ var (
 )
 
 type pkgInfo struct {
-	Name    string
-	Version string
-	Source  string
+	Arch    string `json:"arch"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Origin  string `json:"origin,omitempty"`
+	License string `json:"license,omitempty"`
+	Source  string `json:"source"`
 }
 
 func showPackages() *cobra.Command {
 	var extraKeys []string
+	var keyringDir string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var archstrs []string
@@ -69,6 +82,7 @@ func showPackages() *cobra.Command {
 	var tmpl string
 	var cacheDir string
 	var offline bool
+	var topts transportOptions
 
 	cmd := &cobra.Command{
 		Use:   "show-packages",
@@ -78,7 +92,7 @@ The result is identical to the first stages of a build, but does not actually in
 
 The output is one of several pre-defined formats, or can be customized to any go template, using
 the provided vars. See https://pkg.go.dev/text/template for more information. Available vars are
-.Name, .Version, .Source
+.Name, .Version, .Origin, .License, .Source, .Arch
 
 The pre-defined formats are:
   name-version:          {{ .Name }} {{ .Version }}
@@ -89,6 +103,8 @@ The pre-defined formats are:
   name-(version)-source: {{ .Name }} ({{ .Version }}) {{ .Source }}
   packagelock:               - {{ .Name }}={{ .Version }}
   packagelock-source:        - {{ .Name }}={{ .Version }} # {{ .Source }}
+  table:                 a table of name, version, origin and license
+  json:                  a JSON array of objects with all of the vars
 
 The default format is name-version.
 
@@ -98,34 +114,45 @@ packagelock and packagelock-source are particularly useful for inserting back in
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			archs := types.ParseArchitectures(archstrs)
-			if t, ok := showPkgsFormats[format]; ok {
+			switch t, ok := showPkgsFormats[format]; {
+			case ok:
 				tmpl = t
-			} else {
+			case format == showPkgsFormatTable, format == showPkgsFormatJSON:
+				tmpl = format
+			default:
 				// assume it's a template
 				tmpl = format
 			}
-			return ShowPackagesCmd(cmd.Context(), tmpl, archs,
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return ShowPackagesCmd(cmd.Context(), cmd.OutOrStdout(), tmpl, archs,
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
-				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithTransport(transport),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
 			)
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
-	cmd.Flags().StringVar(&format, "format", showPkgsFormatDefault, "format for showing packages; if pre-defined from list, will use that, else go template. See https://pkg.go.dev/text/template for more information. Available vars are `.Name`, `.Version`, `.Source`")
+	cmd.Flags().StringVar(&format, "format", showPkgsFormatDefault, "format for showing packages; if pre-defined from list, will use that, else go template. See https://pkg.go.dev/text/template for more information. Available vars are `.Name`, `.Version`, `.Origin`, `.License`, `.Source`, `.Arch`")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addTransportFlags(cmd, &topts)
 
 	return cmd
 }
 
-func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architecture, opts ...build.Option) error {
+func ShowPackagesCmd(ctx context.Context, w io.Writer, format string, archs []types.Architecture, opts ...build.Option) error {
 	log := clog.FromContext(ctx)
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
@@ -133,7 +160,7 @@ func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architect
 	}
 	defer os.RemoveAll(wd)
 
-	o, ic, err := build.NewOptions(opts...)
+	o, ic, err := build.NewOptions(ctx, opts...)
 	if err != nil {
 		return err
 	}
@@ -158,9 +185,11 @@ func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architect
 	// we have the directory defined and created by invoking the function early.
 	defer os.RemoveAll(o.TempDir())
 
-	tmpl, err := template.New("format").Parse(format)
-	if err != nil {
-		return fmt.Errorf("failed to parse format: %w", err)
+	var tmpl *template.Template
+	if format != showPkgsFormatTable && format != showPkgsFormatJSON {
+		if tmpl, err = template.New("format").Parse(format); err != nil {
+			return fmt.Errorf("failed to parse format: %w", err)
+		}
 	}
 
 	opts = append(opts, build.WithImageConfiguration(*ic))
@@ -175,20 +204,60 @@ func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architect
 		return fmt.Errorf("failed to get package list for image: %w", err)
 	}
 
-	for arch, pkgs := range lists {
+	sorted := make([]types.Architecture, 0, len(lists))
+	for arch := range lists {
+		sorted = append(sorted, arch)
+	}
+	slices.Sort(sorted)
+
+	var infos []pkgInfo
+	for _, arch := range sorted {
+		for _, pkg := range lists[arch] {
+			infos = append(infos, pkgInfo{
+				Arch:    arch.ToAPK(),
+				Name:    pkg.Name,
+				Version: pkg.Version,
+				Origin:  pkg.Origin,
+				License: pkg.License,
+				Source:  pkg.URL(),
+			})
+		}
+	}
+
+	switch format {
+	case showPkgsFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if infos == nil {
+			infos = []pkgInfo{}
+		}
+		return enc.Encode(infos)
+	case showPkgsFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
 		if len(archs) != 1 {
-			log.Infof("packages for %s", arch)
+			fmt.Fprintln(tw, "ARCH\tNAME\tVERSION\tORIGIN\tLICENSE")
+		} else {
+			fmt.Fprintln(tw, "NAME\tVERSION\tORIGIN\tLICENSE")
 		}
-		var p pkgInfo
-		for _, pkg := range pkgs {
-			p.Name = pkg.Name
-			p.Version = pkg.Version
-			p.Source = pkg.URL()
-			if err = tmpl.Execute(os.Stdout, p); err != nil {
-				return fmt.Errorf("failed to execute template: %w", err)
+		for _, p := range infos {
+			if len(archs) != 1 {
+				fmt.Fprintf(tw, "%s\t", p.Arch)
 			}
-			fmt.Println()
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name, p.Version, p.Origin, p.License)
+		}
+		return tw.Flush()
+	}
+
+	last := ""
+	for _, p := range infos {
+		if len(archs) != 1 && p.Arch != last {
+			log.Infof("packages for %s", p.Arch)
+			last = p.Arch
+		}
+		if err = tmpl.Execute(w, p); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
 		}
+		fmt.Fprintln(w)
 	}
 	return nil
 }
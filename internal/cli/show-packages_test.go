@@ -0,0 +1,65 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestShowPackages(t *testing.T) {
+	ctx := context.Background()
+	config := build.WithConfig(filepath.Join("testdata", "apko.yaml"), nil)
+	archs := []types.Architecture{types.ParseArchitecture("amd64")}
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.ShowPackagesCmd(ctx, &buf, "{{ .Name }} {{ .Version }}", archs, config))
+	require.Contains(t, buf.String(), "replayout 1.0.0-r0\n")
+
+	buf.Reset()
+	require.NoError(t, cli.ShowPackagesCmd(ctx, &buf, "table", archs, config))
+	require.Regexp(t, `^NAME\s+VERSION\s+ORIGIN\s+LICENSE\n`, buf.String())
+	require.Regexp(t, `replayout\s+1.0.0-r0\s+replayout`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, cli.ShowPackagesCmd(ctx, &buf, "json", archs, config))
+	var pkgs []struct {
+		Arch    string `json:"arch"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Origin  string `json:"origin"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &pkgs))
+	require.NotEmpty(t, pkgs)
+	var found bool
+	for _, p := range pkgs {
+		require.Equal(t, "x86_64", p.Arch)
+		if p.Name == "replayout" {
+			found = true
+			require.Equal(t, "1.0.0-r0", p.Version)
+			require.Equal(t, "replayout", p.Origin)
+		}
+	}
+	require.True(t, found)
+}
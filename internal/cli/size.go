@@ -0,0 +1,298 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"cmp"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+// unownedPackage collects the files that no package claims, such as those
+// apko generates itself.
+const unownedPackage = "(unowned)"
+
+func sizeCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var extraPackages []string
+	var buildArch string
+	var cacheDir string
+	var offline bool
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "size <config.yaml> [other.yaml]",
+		Short: "Report how much each package contributes to the size of an image",
+		Long: `Report how much each package contributes to the size of an image.
+
+The image is built for a single architecture and the size of every file is
+attributed to the packages that own it. Files owned by several packages are
+split evenly between them and also reported as shared; files owned by no
+package are attributed to "(unowned)". Compressed sizes are estimated by
+gzipping each file on its own.
+
+When given two configurations, the difference between them is reported
+instead, largest change first.`,
+		Example: `  apko size apko.yaml
+  apko size before.yaml after.yaml`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return SizeCmd(cmd.Context(), os.Stdout, args,
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithExtraPackages(extraPackages),
+				build.WithArch(types.ParseArchitecture(buildArch)),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(&buildArch, "arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// packageSize is the contribution of a single package to an image.
+type packageSize struct {
+	Name       string
+	Version    string
+	Size       int64
+	Compressed int64
+	// Shared is the part of Size that comes from files other packages own too.
+	Shared int64
+}
+
+// SizeCmd writes the per-package size of the image built from each config to
+// w, or the difference between them if there are two.
+func SizeCmd(ctx context.Context, w io.Writer, configs []string, opts ...build.Option) error {
+	if len(configs) == 0 || len(configs) > 2 {
+		return fmt.Errorf("requires 1 or 2 configs, got %d", len(configs))
+	}
+
+	sizes := make([][]packageSize, 0, len(configs))
+	for _, config := range configs {
+		s, err := packageSizes(ctx, append(opts, build.WithConfig(config, []string{}))...)
+		if err != nil {
+			return fmt.Errorf("sizing %s: %w", config, err)
+		}
+		sizes = append(sizes, s)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if len(sizes) == 1 {
+		writeSizes(tw, sizes[0])
+	} else {
+		writeSizeDiff(tw, sizes[0], sizes[1])
+	}
+	return tw.Flush()
+}
+
+func packageSizes(ctx context.Context, opts ...build.Option) ([]packageSize, error) {
+	log := clog.FromContext(ctx)
+
+	fsys := tarfs.New()
+	bc, err := build.New(ctx, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bc.ImageConfiguration().Archs) != 0 {
+		log.Infof("ignoring archs in config, only sizing %s", bc.Arch())
+	}
+	if err := bc.BuildImage(ctx); err != nil {
+		return nil, fmt.Errorf("building image: %w", err)
+	}
+
+	installed, err := bc.InstalledPackages()
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string][]string{}
+	byName := map[string]*packageSize{}
+	for _, pkg := range installed {
+		byName[pkg.Name] = &packageSize{Name: pkg.Name, Version: pkg.Version}
+		for _, f := range pkg.Files {
+			if f.Typeflag == 0 || f.Typeflag == '0' {
+				owners[f.Name] = append(owners[f.Name], pkg.Name)
+			}
+		}
+	}
+	byName[unownedPackage] = &packageSize{Name: unownedPackage}
+
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		compressed, err := compressedSize(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		own := owners[path]
+		if len(own) == 0 {
+			own = []string{unownedPackage}
+		}
+		n := int64(len(own))
+		for _, o := range own {
+			ps := byName[o]
+			ps.Size += info.Size() / n
+			ps.Compressed += compressed / n
+			if n > 1 {
+				ps.Shared += info.Size() / n
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking image filesystem: %w", err)
+	}
+
+	sizes := make([]packageSize, 0, len(byName))
+	for _, ps := range byName {
+		if ps.Name == unownedPackage && ps.Size == 0 {
+			continue
+		}
+		sizes = append(sizes, *ps)
+	}
+	slices.SortFunc(sizes, func(a, b packageSize) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Name, b.Name))
+	})
+	return sizes, nil
+}
+
+func compressedSize(fsys fs.FS, path string) (int64, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var cw countingWriter
+	zw := gzip.NewWriter(&cw)
+	if _, err := io.Copy(zw, f); err != nil {
+		return 0, fmt.Errorf("compressing %s: %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return int64(cw), nil
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+func writeSizes(w io.Writer, sizes []packageSize) {
+	var total packageSize
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tSIZE\tCOMPRESSED\tSHARED")
+	for _, s := range sizes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Version, formatBytes(s.Size), formatBytes(s.Compressed), formatBytes(s.Shared))
+		total.Size += s.Size
+		total.Compressed += s.Compressed
+		total.Shared += s.Shared
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%s\t%s\t%s\n", formatBytes(total.Size), formatBytes(total.Compressed), formatBytes(total.Shared))
+}
+
+func writeSizeDiff(w io.Writer, before, after []packageSize) {
+	type change struct {
+		name                 string
+		oldVersion, version  string
+		oldSize, size, delta int64
+	}
+	changes := map[string]*change{}
+	for _, s := range before {
+		changes[s.Name] = &change{name: s.Name, oldVersion: s.Version, oldSize: s.Size}
+	}
+	for _, s := range after {
+		c, ok := changes[s.Name]
+		if !ok {
+			c = &change{name: s.Name}
+			changes[s.Name] = c
+		}
+		c.version, c.size = s.Version, s.Size
+	}
+
+	var sorted []*change
+	var oldTotal, total int64
+	for _, c := range changes {
+		c.delta = c.size - c.oldSize
+		oldTotal += c.oldSize
+		total += c.size
+		if c.delta != 0 || c.oldVersion != c.version {
+			sorted = append(sorted, c)
+		}
+	}
+	abs := func(i int64) int64 { return max(i, -i) }
+	slices.SortFunc(sorted, func(a, b *change) int {
+		return cmp.Or(cmp.Compare(abs(b.delta), abs(a.delta)), cmp.Compare(a.name, b.name))
+	})
+
+	version := func(v string) string { return cmp.Or(v, "-") }
+	fmt.Fprintln(w, "PACKAGE\tOLD VERSION\tNEW VERSION\tOLD SIZE\tNEW SIZE\tDELTA")
+	for _, c := range sorted {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.name, version(c.oldVersion), version(c.version), formatBytes(c.oldSize), formatBytes(c.size), formatDelta(c.delta))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\t%s\t%s\n", formatBytes(oldTotal), formatBytes(total), formatDelta(total-oldTotal))
+}
+
+func formatDelta(d int64) string {
+	if d < 0 {
+		return "-" + formatBytes(-d)
+	}
+	return "+" + formatBytes(d)
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestSize(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	arch := build.WithArch(types.ParseArchitecture("amd64"))
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.SizeCmd(ctx, &buf, []string{config}, arch))
+	out := buf.String()
+	require.Contains(t, out, "PACKAGE")
+	require.Contains(t, out, "replayout")
+	require.Contains(t, out, "TOTAL")
+
+	// The same config twice has nothing but the total to report.
+	buf.Reset()
+	require.NoError(t, cli.SizeCmd(ctx, &buf, []string{config, config}, arch))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], "+0 B")
+
+	// Dropping a package shows up in the diff.
+	b, err := os.ReadFile(config)
+	require.NoError(t, err)
+	other := filepath.Join(t.TempDir(), "other.yaml")
+	require.NoError(t, os.WriteFile(other, bytes.Replace(b, []byte("- replayout"), []byte("- pretend-baselayout"), 1), 0o644))
+
+	buf.Reset()
+	require.NoError(t, cli.SizeCmd(ctx, &buf, []string{config, other}, arch))
+	require.Regexp(t, `replayout\s+1.0.0-r0\s+-\s`, buf.String())
+}
@@ -0,0 +1,247 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/egress"
+)
+
+// transportOptions configures the HTTP transport used to talk to APK
+// repositories and registries.
+type transportOptions struct {
+	// clientCert and clientKey are PEM files presented for mutual TLS.
+	clientCert string
+	clientKey  string
+	// proxy overrides the proxy from the environment. Credentials may be
+	// given in the URL userinfo.
+	proxy string
+	// logRequests logs every request at debug level.
+	logRequests bool
+	// caFile holds extra PEM certificates to trust.
+	caFile string
+	// insecureRegistries are hosts whose certificates are not verified.
+	insecureRegistries []string
+	// allowEgress, if set, are the only URLs requests may be made to. See
+	// egress.Allowlist for the format.
+	allowEgress []string
+	// noNetwork denies every request, for builds from the package cache
+	// alone.
+	noNetwork bool
+	// mirrors redirect requests for a repository or registry to a mirror
+	// of it, as orig=mirror. See parseMirrors for the format.
+	mirrors []string
+}
+
+// retryOptions configures how registry operations are retried.
+type retryOptions struct {
+	// retries is how many times a failed operation is tried again.
+	retries int
+	// backoff is the wait before the first retry.
+	backoff time.Duration
+	// timeout bounds each attempt, if set.
+	timeout time.Duration
+}
+
+// policy returns the retry policy described by ropts.
+func (ropts retryOptions) policy() (oci.RetryPolicy, error) {
+	if ropts.retries < 0 {
+		return oci.RetryPolicy{}, fmt.Errorf("--push-retries must not be negative")
+	}
+	return oci.RetryPolicy{
+		Attempts: ropts.retries + 1,
+		Backoff:  ropts.backoff,
+		Timeout:  ropts.timeout,
+	}, nil
+}
+
+// newTransport returns the transport described by topts, or nil if topts
+// asks for nothing beyond the defaults.
+func newTransport(topts transportOptions) (http.RoundTripper, error) {
+	if topts.clientCert == "" && topts.clientKey == "" && topts.proxy == "" && !topts.logRequests &&
+		topts.caFile == "" && len(topts.insecureRegistries) == 0 && len(topts.allowEgress) == 0 && !topts.noNetwork &&
+		len(topts.mirrors) == 0 {
+		return nil, nil
+	}
+	if topts.noNetwork && len(topts.allowEgress) != 0 {
+		return nil, fmt.Errorf("--no-network and --allow-egress cannot be used together")
+	}
+
+	t := cleanhttp.DefaultPooledTransport()
+	if topts.clientCert != "" || topts.clientKey != "" {
+		if topts.clientCert == "" || topts.clientKey == "" {
+			return nil, fmt.Errorf("--client-cert and --client-key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(topts.clientCert, topts.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		t.TLSClientConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	if topts.proxy != "" {
+		u, err := url.Parse(topts.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	var rt http.RoundTripper = t
+	if topts.caFile != "" || len(topts.insecureRegistries) != 0 {
+		var err error
+		rt, err = oci.RegistryTransport(t, topts.caFile, topts.insecureRegistries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if topts.logRequests {
+		rt = loggingTransport{rt}
+	}
+	if len(topts.allowEgress) != 0 || topts.noNetwork {
+		// With --no-network, the allowlist is empty and allows nothing.
+		allow, err := egress.NewAllowlist(topts.allowEgress)
+		if err != nil {
+			return nil, err
+		}
+		rt = allow.Transport(rt)
+	}
+	if len(topts.mirrors) != 0 {
+		mirrors, err := parseMirrors(topts.mirrors)
+		if err != nil {
+			return nil, err
+		}
+		// Mirrors are applied first, so that the egress allowlist and the
+		// logs see where requests actually go.
+		rt = mirrorTransport{mirrors, rt}
+	}
+	// The transport replaces http.DefaultTransport, which carries the
+	// User-Agent of apko, so it must carry it as well.
+	return userAgentTransport{rt}, nil
+}
+
+// mirror redirects the requests to a repository or registry to a mirror.
+type mirror struct {
+	// from and to are URL prefixes, such as
+	// https://packages.wolfi.dev/os, or else both hosts, such as
+	// index.docker.io, which redirect requests over any scheme.
+	from, to string
+	hosts    bool
+}
+
+// parseMirrors parses mirrors given as orig=mirror, where both are URL
+// prefixes or both are hosts (host[:port]).
+func parseMirrors(raw []string) ([]mirror, error) {
+	mirrors := make([]mirror, 0, len(raw))
+	for _, r := range raw {
+		from, to, ok := strings.Cut(r, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid mirror %q, must be orig=mirror", r)
+		}
+		fromURL, toURL := strings.Contains(from, "://"), strings.Contains(to, "://")
+		if fromURL != toURL {
+			return nil, fmt.Errorf("invalid mirror %q: orig and mirror must both be URLs or both be hosts", r)
+		}
+		if fromURL {
+			for _, u := range []string{from, to} {
+				if _, err := url.Parse(u); err != nil {
+					return nil, fmt.Errorf("invalid mirror %q: %w", r, err)
+				}
+			}
+			from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+		}
+		mirrors = append(mirrors, mirror{from: from, to: to, hosts: !fromURL})
+	}
+	return mirrors, nil
+}
+
+// rewrite returns where u goes with m, and whether m applies to it.
+func (m mirror) rewrite(u *url.URL) (*url.URL, bool) {
+	if m.hosts {
+		if u.Host != m.from {
+			return nil, false
+		}
+		rewritten := *u
+		rewritten.Host = m.to
+		rewritten.User = nil
+		return &rewritten, true
+	}
+	s := u.String()
+	rest, ok := strings.CutPrefix(s, m.from)
+	// The prefix must end at a path segment.
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "?")) {
+		return nil, false
+	}
+	rewritten, err := url.Parse(m.to + rest)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
+
+// mirrorTransport sends the requests to a mirror, if one applies, rather
+// than where they were made to. The credentials of requests are only sent
+// to a mirror on the same host, not handed to another.
+type mirrorTransport struct {
+	mirrors []mirror
+	t       http.RoundTripper
+}
+
+func (m mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, mirror := range m.mirrors {
+		u, ok := mirror.rewrite(req.URL)
+		if !ok {
+			continue
+		}
+		clog.FromContext(req.Context()).Debugf("mirroring %s to %s", req.URL.Redacted(), u.Redacted())
+		req = req.Clone(req.Context())
+		if !strings.EqualFold(u.Host, req.URL.Host) {
+			req.Header.Del("Authorization")
+			req.Header.Del("Cookie")
+		}
+		req.URL = u
+		req.Host = u.Host
+		break
+	}
+	return m.t.RoundTrip(req)
+}
+
+// loggingTransport logs each request and its outcome.
+type loggingTransport struct{ t http.RoundTripper }
+
+func (l loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log := clog.FromContext(req.Context())
+	start := time.Now()
+	resp, err := l.t.RoundTrip(req)
+	if err != nil {
+		log.Debugf("%s %s: %v (%s)", req.Method, req.URL.Redacted(), err, time.Since(start))
+		return nil, err
+	}
+	log.Debugf("%s %s: %s (%s)", req.Method, req.URL.Redacted(), resp.Status, time.Since(start))
+	return resp, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/egress"
+)
+
+func TestNewTransport(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		tr, err := newTransport(transportOptions{})
+		require.NoError(t, err)
+		require.Nil(t, tr)
+	})
+
+	t.Run("proxy with credentials", func(t *testing.T) {
+		var proxyAuth, target string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxyAuth = r.Header.Get("Proxy-Authorization")
+			target = r.URL.String()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer proxy.Close()
+
+		tr, err := newTransport(transportOptions{
+			proxy:       "http://user:pass@" + proxy.Listener.Addr().String(),
+			logRequests: true,
+		})
+		require.NoError(t, err)
+
+		resp, err := (&http.Client{Transport: tr}).Get("http://packages.example.com/x86_64/APKINDEX.tar.gz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "http://packages.example.com/x86_64/APKINDEX.tar.gz", target)
+		require.Equal(t, "Basic dXNlcjpwYXNz", proxyAuth)
+	})
+
+	t.Run("user agent", func(t *testing.T) {
+		var ua string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ua = r.Header.Get("User-Agent")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer s.Close()
+
+		tr, err := newTransport(transportOptions{logRequests: true})
+		require.NoError(t, err)
+		resp, err := (&http.Client{Transport: tr}).Get(s.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.True(t, strings.HasPrefix(ua, "apko/"), ua)
+	})
+
+	t.Run("no network", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer s.Close()
+
+		tr, err := newTransport(transportOptions{noNetwork: true})
+		require.NoError(t, err)
+		_, err = (&http.Client{Transport: tr}).Get(s.URL)
+		var denied *egress.DeniedError
+		require.ErrorAs(t, err, &denied)
+		// The transport is passed where it is needed, the process-wide
+		// default is left alone.
+		resp, err := http.Get(s.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		_, err = newTransport(transportOptions{noNetwork: true, allowEgress: []string{"*.example.com"}})
+		require.Error(t, err)
+	})
+
+	t.Run("mirrors", func(t *testing.T) {
+		var got, auths []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, r.Host+r.URL.Path)
+			auths = append(auths, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer s.Close()
+
+		tr, err := newTransport(transportOptions{mirrors: []string{
+			"http://packages.example.com/os=" + s.URL + "/mirror/os",
+			"registry.example.com=" + s.Listener.Addr().String(),
+		}})
+		require.NoError(t, err)
+		for _, u := range []string{
+			"http://packages.example.com/os/x86_64/APKINDEX.tar.gz",
+			"http://registry.example.com/v2/",
+		} {
+			req, err := http.NewRequest(http.MethodGet, u, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err := (&http.Client{Transport: tr}).Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		addr := s.Listener.Addr().String()
+		require.Equal(t, []string{addr + "/mirror/os/x86_64/APKINDEX.tar.gz", addr + "/v2/"}, got)
+		// The credentials meant for the original hosts are not sent to the
+		// mirror.
+		require.Equal(t, []string{"", ""}, auths)
+
+		// Nor is the process-wide default transport mirrored.
+		got = nil
+		if resp, err := (&http.Client{Timeout: time.Second}).Get("http://registry.example.com/v2/"); err == nil {
+			resp.Body.Close()
+		}
+		require.Empty(t, got)
+
+		// Only whole path segments are mirrored.
+		m, err := parseMirrors([]string{"https://packages.example.com/os=https://mirror.example.com"})
+		require.NoError(t, err)
+		u, err := url.Parse("https://packages.example.com/osx/APKINDEX.tar.gz")
+		require.NoError(t, err)
+		_, ok := m[0].rewrite(u)
+		require.False(t, ok)
+
+		for _, bad := range []string{"registry.example.com", "registry.example.com=https://mirror.example.com", "=mirror.example.com"} {
+			_, err := parseMirrors([]string{bad})
+			require.Error(t, err, bad)
+		}
+	})
+
+	t.Run("client cert without key", func(t *testing.T) {
+		_, err := newTransport(transportOptions{clientCert: "cert.pem"})
+		require.Error(t, err)
+	})
+}
+
+func TestNoNetworkBuild(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	tr, err := newTransport(transportOptions{noNetwork: true})
+	require.NoError(t, err)
+
+	t.Run("remote includes", func(t *testing.T) {
+		config := filepath.Join(t.TempDir(), "apko.yaml")
+		require.NoError(t, os.WriteFile(config, []byte("include: "+s.URL+"/base.yaml\n"), 0o644))
+		_, _, err := build.NewOptions(ctx, build.WithConfig(config, nil), build.WithTransport(tr))
+		var denied *egress.DeniedError
+		require.ErrorAs(t, err, &denied)
+	})
+
+	t.Run("oci repositories", func(t *testing.T) {
+		bc, err := build.New(ctx, fs.NewMemFS(),
+			build.WithImageConfiguration(types.ImageConfiguration{
+				Contents: types.ImageContents{
+					Repositories: []string{apk.OCIScheme + u.Host + "/packages"},
+					Packages:     []string{"hello"},
+				},
+			}),
+			build.WithTransport(tr),
+			build.WithIgnoreSignatures(true),
+		)
+		require.NoError(t, err)
+		_, err = bc.ResolveWithBase(ctx)
+		var denied *egress.DeniedError
+		require.ErrorAs(t, err, &denied)
+	})
+}
+
+func TestTransportFlagsCommands(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`contents:
+  repositories:
+    - `+s.URL+`/os
+  packages:
+    - hello
+archs:
+  - x86_64
+`), 0o644))
+
+	// Every command fetching from repositories is held to the allowlist, not
+	// only those building images.
+	for _, args := range [][]string{
+		{"show-packages", config, "--cache-dir", dir},
+		{"lock", config, "--cache-dir", dir, "--output", filepath.Join(dir, "apko.lock.json")},
+		{"why", config, "hello", "--cache-dir", dir},
+		{"files", config, "--cache-dir", dir},
+		{"size", config, "--cache-dir", dir, "--arch", "amd64"},
+		{"build-minirootfs", config, filepath.Join(dir, "rootfs.tar"), "--build-arch", "amd64"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			cmd := New()
+			cmd.SetArgs(append(args, "--allow-egress", "https://packages.example.com/"))
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			require.Error(t, cmd.ExecuteContext(context.Background()))
+		})
+	}
+	require.Zero(t, requests.Load(), "requests made to a URL not allowed")
+}
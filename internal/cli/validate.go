@@ -0,0 +1,112 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func validateCmd() *cobra.Command {
+	var schema bool
+	var bopts buildArgOptions
+
+	cmd := &cobra.Command{
+		Use:   "validate <config.yaml>",
+		Short: "Check a configuration against the configuration schema",
+		Long: `Check a configuration against the configuration schema.
+
+Unknown fields, values of the wrong type and missing required fields are
+reported with their line and column, as well as deprecated fields, which only
+warn. A configuration that matches the schema is then loaded, with what it
+includes, and checked as a build would before resolving any package.
+
+With --schema, the JSON schema of configurations is written to stdout instead,
+for editors to check and complete configurations with.`,
+		Example: `  apko validate apko.yaml
+  apko validate --schema > apko.schema.json`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if schema {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if schema {
+				_, err := cmd.OutOrStdout().Write(types.Schema)
+				return err
+			}
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
+			return ValidateCmd(cmd.Context(), cmd.OutOrStdout(), args[0], vars)
+		},
+	}
+
+	cmd.Flags().BoolVar(&schema, "schema", false, "write the JSON schema of configurations to stdout")
+	addBuildArgFlags(cmd, &bopts)
+
+	return cmd
+}
+
+// ValidateCmd checks the configuration at path against the configuration
+// schema, writing what is wrong with it to w, and then loads and validates
+// it. Configuration variables are substituted with vars, unless nil.
+func ValidateCmd(ctx context.Context, w io.Writer, path string, vars *types.Variables) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if vars != nil {
+		if data, err = vars.Expand(data); err != nil {
+			return fmt.Errorf("substituting variables in %s: %w", path, err)
+		}
+	}
+
+	issues, err := types.CheckSchema(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	errs := 0
+	for _, issue := range issues {
+		level := "error"
+		if issue.Deprecated {
+			level = "warning"
+		} else {
+			errs++
+		}
+		fmt.Fprintf(w, "%s:%s (%s)\n", path, issue, level)
+	}
+	if errs != 0 {
+		return fmt.Errorf("%s does not match the configuration schema: %d errors", path, errs)
+	}
+
+	ic := &types.ImageConfiguration{}
+	if err := ic.LoadWithVariables(ctx, path, nil, sha256.New(), vars); err != nil {
+		return fmt.Errorf("loading %s: %w", path, err)
+	}
+	if err := ic.Validate(); err != nil {
+		return fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	return nil
+}
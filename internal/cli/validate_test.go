@@ -0,0 +1,45 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.ValidateCmd(ctx, &buf, filepath.Join("testdata", "apko.yaml"), nil))
+	require.Empty(t, buf.String())
+
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  pakages: [foo]\n"), 0o644))
+	buf.Reset()
+	require.ErrorContains(t, cli.ValidateCmd(ctx, &buf, config, nil), "does not match the configuration schema: 1 errors")
+	require.Equal(t, config+":2:3: contents.pakages: unknown field (error)\n", buf.String())
+
+	// What the schema cannot tell is still checked.
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  file-conflicts: ignore\n"), 0o644))
+	require.ErrorContains(t, cli.ValidateCmd(ctx, &buf, config, nil), `file-conflicts "ignore" is not one of`)
+}
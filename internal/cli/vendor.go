@@ -0,0 +1,96 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func vendorCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var archstrs []string
+	var includePaths []string
+	var ignoreSignatures bool
+	var lockfile string
+	var bopts buildArgOptions
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "vendor <config.yaml> <vendor-dir>",
+		Short: "Download everything a build of a configuration needs into a directory",
+		Long: `Download everything a build of a configuration needs into a directory.
+
+The packages resolved for each architecture are downloaded into the directory,
+with the APKINDEX files of the repositories and the keys of the keyring,
+including discovered ones, and a manifest of their checksums, vendor.json.
+apko build and apko publish --vendor-dir then build from the directory alone,
+without the network, after checking it against its manifest, for air-gapped
+and hermetic builds. With --lockfile, the packages it locks are downloaded
+instead of those resolved. Packages of local repositories are used in place.`,
+		Example: `  apko vendor apko.yaml vendor/
+  apko build --vendor-dir vendor/ apko.yaml example:latest image.tar`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vars, err := bopts.variables()
+			if err != nil {
+				return err
+			}
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return VendorCmd(cmd.Context(), args[1], types.ParseArchitectures(archstrs),
+				build.WithConfigVariables(vars),
+				build.WithConfig(args[0], includePaths),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithIncludePaths(includePaths),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithLockFile(lockfile),
+				build.WithTransport(transport),
+			)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append")
+	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) whose packages are downloaded instead of those resolved")
+	addBuildArgFlags(cmd, &bopts)
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// VendorCmd downloads everything a build of the configuration set up by opts
+// for archs needs into dir, as build.Vendor does.
+func VendorCmd(ctx context.Context, dir string, archs []types.Architecture, opts ...build.Option) error {
+	_, err := build.Vendor(ctx, dir, archs, opts...)
+	return err
+}
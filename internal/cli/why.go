@@ -0,0 +1,122 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func whyCmd() *cobra.Command {
+	var extraKeys []string
+	var keyringDir string
+	var extraBuildRepos []string
+	var extraRepos []string
+	var archstrs []string
+	var cacheDir string
+	var offline bool
+	var topts transportOptions
+
+	cmd := &cobra.Command{
+		Use:   "why",
+		Short: "Explain why a package is installed by a configuration",
+		Long: `Explain why a package is installed by a configuration.
+
+For each package of the configuration that pulls the package in, the shortest
+chain of dependencies from it to the package is printed, along with the
+dependency that pulled in each package of the chain. Packages installed by
+install_if are shown with their condition.`,
+		Example: `  apko why <config.yaml> <package>`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport, err := newTransport(topts)
+			if err != nil {
+				return err
+			}
+			return WhyCmd(cmd.Context(), cmd.OutOrStdout(), args[1], types.ParseArchitectures(archstrs),
+				build.WithConfig(args[0], []string{}),
+				build.WithExtraKeys(extraKeys),
+				build.WithKeyringDir(keyringDir),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRepos(extraRepos),
+				build.WithTransport(transport),
+				build.WithCache(cacheDir, offline || topts.noNetwork, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringVar(&keyringDir, "keyring-dir", "", "directory whose keys (*.pub) are all included in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to explain (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	addTransportFlags(cmd, &topts)
+
+	return cmd
+}
+
+// WhyCmd writes to w why the package named name is installed by the
+// configuration of opts, for each of archs.
+func WhyCmd(ctx context.Context, w io.Writer, name string, archs []types.Architecture, opts ...build.Option) error {
+	o, ic, err := build.NewOptions(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	archs = ic.Archs
+
+	opts = append(opts, build.WithImageConfiguration(*ic))
+	mc, err := build.NewMultiArch(ctx, archs, opts...)
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(archs)
+	for _, arch := range archs {
+		chains, err := mc.Contexts[arch].Why(ctx, name)
+		if err != nil {
+			return fmt.Errorf("for arch %q: %w", arch, err)
+		}
+		indent := ""
+		if len(archs) != 1 {
+			fmt.Fprintf(w, "%s:\n", arch.ToAPK())
+			indent = "  "
+		}
+		for _, chain := range chains {
+			fmt.Fprintf(w, "%s%s\n", indent, chain)
+		}
+	}
+	return nil
+}
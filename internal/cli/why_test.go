@@ -0,0 +1,43 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestWhy(t *testing.T) {
+	ctx := context.Background()
+	config := build.WithConfig(filepath.Join("testdata", "apko.yaml"), nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.WhyCmd(ctx, &buf, "pretend-baselayout", []types.Architecture{types.ParseArchitecture("amd64")}, config))
+	require.Equal(t, "replayout (world: replayout) -> pretend-baselayout (depends on pretend-baselayout)\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, cli.WhyCmd(ctx, &buf, "replayout", nil, config))
+	require.Equal(t, "x86_64:\n  replayout (world: replayout)\naarch64:\n  replayout (world: replayout)\n", buf.String())
+
+	require.ErrorContains(t, cli.WhyCmd(ctx, &buf, "busybox", []types.Architecture{types.ParseArchitecture("amd64")}, config), "package busybox is not installed")
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// checkExcluded fails if pkgs, what world resolved to, has any of the
+// excluded packages, saying what pulls each of them in.
+func checkExcluded(world []string, pkgs []*RepositoryPackage, excluded []string) error {
+	var errs []error
+	for _, name := range excluded {
+		if !slices.ContainsFunc(pkgs, func(pkg *RepositoryPackage) bool { return pkg.Name == name }) {
+			continue
+		}
+		chains, err := Why(world, pkgs, name)
+		if err != nil {
+			return err
+		}
+		why := make([]string, len(chains))
+		for i, chain := range chains {
+			why[i] = chain.String()
+		}
+		errs = append(errs, fmt.Errorf("package %s is excluded, but would be installed: %s", name, strings.Join(why, "; ")))
+	}
+	return errors.Join(errs...)
+}
+
+// prune returns pkgs without the packages named in pruned, warning about
+// every dependency of the packages left that only a pruned package
+// satisfied.
+func prune(ctx context.Context, pkgs []*RepositoryPackage, pruned []string) []*RepositoryPackage {
+	if len(pruned) == 0 {
+		return pkgs
+	}
+	log := clog.FromContext(ctx)
+
+	var kept, removed []*RepositoryPackage
+	for _, pkg := range pkgs {
+		if slices.Contains(pruned, pkg.Name) {
+			removed = append(removed, pkg)
+		} else {
+			kept = append(kept, pkg)
+		}
+	}
+	if len(removed) == 0 {
+		return pkgs
+	}
+
+	for _, pkg := range removed {
+		log.Warnf("pruning %s-%s, which would otherwise be installed", pkg.Name, pkg.Version)
+	}
+	for _, pkg := range kept {
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			constraint := cachedResolvePackageNameVersionPin(dep)
+			if slices.ContainsFunc(kept, constraint.providedBy) {
+				continue
+			}
+			if i := slices.IndexFunc(removed, constraint.providedBy); i != -1 {
+				log.Warnf("pruning %s breaks the dependency of %s on %s, which may not work without it", removed[i].Name, pkg.Name, dep)
+			}
+		}
+	}
+	return kept
+}
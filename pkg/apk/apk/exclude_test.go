@@ -0,0 +1,48 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcludeAndPrune(t *testing.T) {
+	repo := &RepositoryWithIndex{Repository: &Repository{URI: "local"}}
+	pkg := func(p *Package) *RepositoryPackage { return NewRepositoryPackage(p, repo) }
+	pkgs := []*RepositoryPackage{
+		pkg(&Package{Name: "musl", Version: "1.2.4-r0", Provides: []string{"so:libc.musl-x86_64.so.1=1"}}),
+		pkg(&Package{Name: "busybox", Version: "1.36.1-r0", Provides: []string{"cmd:sh"}, Dependencies: []string{"so:libc.musl-x86_64.so.1"}}),
+		pkg(&Package{Name: "curl", Version: "8.0-r0", Dependencies: []string{"libcurl>=8", "cmd:sh", "so:libc.musl-x86_64.so.1"}}),
+		pkg(&Package{Name: "libcurl", Version: "8.0-r0", Dependencies: []string{"so:libc.musl-x86_64.so.1"}}),
+	}
+	world := []string{"curl"}
+
+	require.NoError(t, checkExcluded(world, pkgs, nil))
+	require.NoError(t, checkExcluded(world, pkgs, []string{"openssl"}))
+	err := checkExcluded(world, pkgs, []string{"busybox", "openssl"})
+	require.ErrorContains(t, err, "package busybox is excluded, but would be installed: curl (world: curl) -> busybox (depends on cmd:sh)")
+
+	ctx := context.Background()
+	require.Equal(t, pkgs, prune(ctx, pkgs, nil))
+	require.Equal(t, pkgs, prune(ctx, pkgs, []string{"openssl"}))
+	got := prune(ctx, pkgs, []string{"busybox"})
+	require.Len(t, got, 3)
+	for _, p := range got {
+		require.NotEqual(t, "busybox", p.Name)
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -49,6 +51,7 @@ import (
 	"chainguard.dev/apko/pkg/apk/auth"
 	"chainguard.dev/apko/pkg/apk/expandapk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/events"
 
 	"github.com/chainguard-dev/clog"
 )
@@ -64,17 +67,28 @@ type APK struct {
 	fs                 apkfs.FullFS
 	executor           Executor
 	ignoreMknodErrors  bool
+	ignoreConflicts    bool
 	client             *http.Client
 	cache              *cache
 	ignoreSignatures   bool
+	requireSigned      bool
+	excluded           []string
+	pruned             []string
 	noSignatureIndexes []string
 	auth               auth.Authenticator
+	oci                *ociRepositories
 	packageGetter      PackageGetter
 	sizeLimits         *SizeLimits
 
 	// filename to owning package, last write wins
 	installedFiles map[string]*Package
 
+	// package name to how InstallPackages verified it
+	verifications map[string]PackageVerification
+
+	// package name to the URL InstallPackages installed it from
+	sources map[string]string
+
 	// This is a map of arch to apk.APK for every arch in a mult-arch situation.
 	// It's stuffed here to avoid plumbing it across every method, but it's optional.
 	ByArch map[string]*APK
@@ -112,13 +126,16 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 	client := retryablehttp.NewClient()
 	client.HTTPClient = &http.Client{Transport: transport}
 	client.Logger = clog.FromContext(ctx)
+	client.CheckRetry = checkRetry
 
 	httpClient := client.StandardClient()
 
+	oci := newOCIRepositories(opt.transport, opt.keychain)
+
 	// Create default PackageGetter if none provided
 	packageGetter := opt.packageGetter
 	if packageGetter == nil {
-		var getterOpts []packageGetterOption
+		getterOpts := []packageGetterOption{withPackageOCIRepositories(oci)}
 		if opt.sizeLimits != nil {
 			if opt.sizeLimits.APKControlMaxSize != 0 {
 				getterOpts = append(getterOpts, withAPKControlMaxSize(opt.sizeLimits.APKControlMaxSize))
@@ -136,12 +153,19 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 		arch:               opt.arch,
 		executor:           opt.executor,
 		ignoreMknodErrors:  opt.ignoreMknodErrors,
+		ignoreConflicts:    opt.ignoreConflicts,
 		version:            opt.version,
 		cache:              opt.cache,
 		ignoreSignatures:   opt.ignoreSignatures,
+		requireSigned:      opt.requireSigned,
+		excluded:           opt.excluded,
+		pruned:             opt.pruned,
 		noSignatureIndexes: opt.noSignatureIndexes,
 		installedFiles:     map[string]*Package{},
+		verifications:      map[string]PackageVerification{},
+		sources:            map[string]string{},
 		auth:               opt.auth,
+		oci:                oci,
 		packageGetter:      packageGetter,
 		sizeLimits:         opt.sizeLimits,
 	}, nil
@@ -521,7 +545,23 @@ func (a *APK) loadSystemKeyring(ctx context.Context, locations ...string) ([]str
 	return nil, errors.New("no suitable keyring directory found")
 }
 
+// keyPinPrefix introduces the expected SHA256 of a key, as in
+// https://example.com/key.rsa.pub#sha256=<hex>.
+const keyPinPrefix = "#sha256="
+
+// cutKeyPin splits a keyring entry into the location of the key and the hex
+// SHA256 it is pinned to, if any.
+func cutKeyPin(element string) (string, string) {
+	if i := strings.LastIndex(element, keyPinPrefix); i >= 0 {
+		return element[:i], strings.ToLower(element[i+len(keyPinPrefix):])
+	}
+	return element, ""
+}
+
 // Installs the specified keys into the APK keyring inside the build context.
+//
+// Keys are paths or URLs, and may be pinned to the SHA256 of their contents
+// by appending #sha256=<hex>, failing if the key found there is any other.
 func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string) error {
 	log := clog.FromContext(ctx)
 	log.Debug("initializing apk keyring")
@@ -543,6 +583,7 @@ func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string)
 	for _, element := range keyFiles {
 		eg.Go(func() error {
 			log.Debugf("installing key %v", element)
+			element, pin := cutKeyPin(element)
 
 			var asURL *url.URL
 			var err error
@@ -595,6 +636,12 @@ func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string)
 				return fmt.Errorf("scheme %s not supported", asURL.Scheme)
 			}
 
+			if pin != "" {
+				if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != pin {
+					return fmt.Errorf("apk key %s has sha256 %x, expected %s", asURL.Redacted(), sum, pin)
+				}
+			}
+
 			// #nosec G306 -- apk keyring must be publicly readable
 			if err := a.fs.WriteFile(filepath.Join("etc", "apk", "keys", filepath.Base(element)), data,
 				0o644); err != nil {
@@ -646,6 +693,10 @@ func (a *APK) ResolveWorld(ctx context.Context) (toInstall []*RepositoryPackage,
 	if err != nil {
 		return
 	}
+	if err = checkExcluded(directPkgs, toInstall, a.excluded); err != nil {
+		return
+	}
+	toInstall = prune(ctx, toInstall, a.pruned)
 	log.Debugf("got %d packages to install:\n%s", len(toInstall), strings.Join(packageRefs(toInstall), "\n"))
 	return
 }
@@ -766,11 +817,23 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 	g.SetLimit(jobs + 1)
 
 	expanded := make([]*expandapk.APKExpanded, len(allpkgs))
+	verifications := make([]PackageVerification, len(allpkgs))
+
+	keys, err := a.packageKeyring()
+	if err != nil {
+		return nil, err
+	}
 
 	// Track what files were installed by which packages so we can deduplicate in idb.
 	allFiles := make([][]tar.Header, len(allpkgs))
 	infos := make([]*Package, len(allpkgs))
 
+	events.Emit(ctx, events.Event{
+		Type:  events.PackagesResolved,
+		Arch:  a.arch,
+		Total: len(allpkgs),
+	})
+
 	// A slice of pseudo-promises that get closed when expanded[i] is ready.
 	done := make([]chan struct{}, len(allpkgs))
 	for i := range allpkgs {
@@ -833,6 +896,20 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 			if err != nil {
 				return fmt.Errorf("expanding %s: %w", pkg, err)
 			}
+			events.Emit(ctx, events.Event{
+				Type:    events.PackageFetched,
+				Arch:    a.arch,
+				Package: pkg.PackageName(),
+				Size:    exp.Size,
+			})
+
+			verifications[i] = verifyPackage(pkg, exp, keys)
+			if err := verifications[i].Err; err != nil {
+				if a.requireSigned {
+					return fmt.Errorf("verifying %s: %w", pkg, err)
+				}
+				clog.FromContext(ctx).Debugf("could not verify %s: %v", pkg.PackageName(), err)
+			}
 
 			expanded[i] = exp
 
@@ -844,6 +921,17 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 		return nil, fmt.Errorf("installing packages: %w", withCause(ctx, err))
 	}
 
+	if a.verifications == nil {
+		a.verifications = map[string]PackageVerification{}
+	}
+	if a.sources == nil {
+		a.sources = map[string]string{}
+	}
+	for i, pkg := range allpkgs {
+		a.verifications[pkg.PackageName()] = verifications[i]
+		a.sources[pkg.PackageName()] = pkg.URL()
+	}
+
 	diffs := make([]InstalledDiff, 0, len(allFiles))
 
 	// update the installed file
@@ -1090,6 +1178,7 @@ func (a *APK) DiscoverKeys(ctx context.Context, repository string) ([]Key, error
 			rc := retryablehttp.NewClient()
 			rc.HTTPClient = client
 			rc.Logger = clog.FromContext(ctx)
+			rc.CheckRetry = checkRetry
 			client = rc.StandardClient()
 		}
 
@@ -1133,6 +1222,9 @@ func packageAsURI(pkg LocatablePackage) (uri.URI, error) {
 	if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
 		return uri.Parse(u)
 	}
+	if strings.HasPrefix(u, OCIScheme) {
+		return uri.URI(u), nil
+	}
 
 	return uri.New(u), nil
 }
@@ -1207,6 +1299,13 @@ func (a *APK) installPackage(ctx context.Context, pkg *Package, expanded *expand
 		return nil, fmt.Errorf("unable to update triggers for pkg %s: %w", pkg.Name, err)
 	}
 
+	events.Emit(ctx, events.Event{
+		Type:    events.PackageInstalled,
+		Arch:    a.arch,
+		Package: pkg.Name,
+		Version: pkg.Version,
+	})
+
 	return installedFiles, nil
 }
 
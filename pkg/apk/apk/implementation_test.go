@@ -16,6 +16,8 @@ package apk
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"net/http"
@@ -531,6 +533,18 @@ func TestInitKeyring(t *testing.T) {
 	tr.requireBasicAuth = true
 	require.NoError(t, a.InitKeyring(context.Background(), keyfiles, nil))
 
+	t.Run("pinned", func(t *testing.T) {
+		sum := sha256.Sum256([]byte(testDemoKey))
+		pinned := keyPath + "#sha256=" + hex.EncodeToString(sum[:])
+		require.NoError(t, a.InitKeyring(context.Background(), []string{pinned}, nil))
+		data, err := src.ReadFile(filepath.Join(DefaultKeyRingPath, filepath.Base(keyPath)))
+		require.NoError(t, err)
+		require.Equal(t, testDemoKey, string(data))
+
+		wrong := keyPath + "#sha256=" + strings.Repeat("0", 64)
+		require.ErrorContains(t, a.InitKeyring(context.Background(), []string{wrong}, nil), "expected "+strings.Repeat("0", 64))
+	})
+
 	t.Run("auth", func(t *testing.T) {
 		called := false
 		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +101,7 @@ func (i *indexCache) load(key string) (NamedIndex, error) {
 }
 
 func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map[string][]byte, arch string, opts *indexOpts) (NamedIndex, error) {
+	repoURL = localRepoPath(repoURL)
 	u := IndexURL(repoURL, arch)
 
 	ctx, span := otel.Tracer("go-apk").Start(ctx, fmt.Sprintf("indexCache.get(%q)", u))
@@ -109,6 +110,47 @@ func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map
 	repoBase := fmt.Sprintf("%s/%s", repoURL, arch)
 	repoRef := Repository{URI: repoBase}
 
+	if strings.HasPrefix(u, OCIScheme) {
+		ref := strings.TrimPrefix(repoURL, OCIScheme)
+		oci := opts.oci
+		if oci == nil {
+			oci = newOCIRepositories(nil, nil)
+		}
+		l, err := oci.file(ctx, ref, arch+"/"+indexFilename, true)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+
+		// The index is content addressed, so it only needs to be parsed again
+		// if the artifact now has a different one.
+		key := fmt.Sprintf("%s@%s", u, digest)
+		once, _ := i.onces.LoadOrStore(key, &sync.Once{})
+		once.(*sync.Once).Do(func() {
+			idx, err := func() (NamedIndex, error) {
+				rc, err := l.Compressed()
+				if err != nil {
+					return nil, fmt.Errorf("fetching %s: %w", u, err)
+				}
+				defer rc.Close()
+				b, err := io.ReadAll(rc)
+				if err != nil {
+					return nil, fmt.Errorf("fetching %s: %w", u, err)
+				}
+				idx, err := parseRepositoryIndex(ctx, u, keys, arch, b, opts)
+				if err != nil {
+					return nil, fmt.Errorf("parsing %s: %w", u, err)
+				}
+				return NewNamedRepositoryWithIndex(repoName, repoRef.WithIndex(idx)), nil
+			}()
+			i.store(key, idx, err)
+		})
+		return i.load(key)
+	}
+
 	if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
 		asURL, err := url.Parse(u)
 		if err != nil {
@@ -290,7 +332,7 @@ func shouldCheckSignatureForIndex(index string, arch string, opts *indexOpts) bo
 		return false
 	}
 	for _, ignoredIndex := range opts.noSignatureIndexes {
-		if IndexURL(ignoredIndex, arch) == index {
+		if IndexURL(localRepoPath(ignoredIndex), arch) == index {
 			return false
 		}
 	}
@@ -475,6 +517,7 @@ type indexOpts struct {
 	httpClient               *http.Client
 	auth                     auth.Authenticator
 	indexDecompressedMaxSize int64
+	oci                      *ociRepositories
 }
 type IndexOption func(*indexOpts)
 
@@ -508,6 +551,14 @@ func WithIndexDecompressedMaxSize(size int64) IndexOption {
 	}
 }
 
+// withOCIRepositories resolves oci:// repositories with oci, so that their
+// packages are then fetched from the same manifests.
+func withOCIRepositories(oci *ociRepositories) IndexOption {
+	return func(o *indexOpts) {
+		o.oci = oci
+	}
+}
+
 func redact(in string) string {
 	asURL, err := url.Parse(in)
 	if err != nil {
@@ -28,6 +28,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/chainguard-dev/clog"
 	"go.opentelemetry.io/otel"
 
 	"chainguard.dev/apko/pkg/apk/expandapk/tarfs"
@@ -69,7 +70,7 @@ func (a *APK) writeOneFile(header *tar.Header, r io.Reader, allowOverwrite bool)
 }
 
 // installRegularFile handles the various error modes of writing a regular file
-func (a *APK) installRegularFile(header *tar.Header, tr *tar.Reader, tmpDir string, pkg *Package) (bool, error) {
+func (a *APK) installRegularFile(ctx context.Context, header *tar.Header, tr *tar.Reader, tmpDir string, pkg *Package) (bool, error) {
 	checksum, err := checksumFromHeader(header)
 	if err != nil {
 		return false, err
@@ -140,13 +141,17 @@ func (a *APK) installRegularFile(header *tar.Header, tr *tar.Reader, tmpDir stri
 		// Otherwise, we can only overwrite the file if it's in the same origin or if it replaces the existing package.
 		_, isReplaced := replaceMap[pk.Name]
 		if pk.Origin != pkg.Origin && !isReplaced {
-			return false, FileConflictError{
+			conflict := FileConflictError{
 				Path: header.Name,
 				Origins: map[string]string{
 					pk.Name:  pk.Origin,
 					pkg.Name: pkg.Origin,
 				},
 			}
+			if !a.ignoreConflicts {
+				return false, conflict
+			}
+			clog.FromContext(ctx).Warnf("%v, overwriting the file of %s with that of %s", conflict, pk.Name, pkg.Name)
 		}
 
 		if err := a.writeOneFile(header, r, true); err != nil {
@@ -240,7 +245,7 @@ func (a *APK) installAPKFiles(ctx context.Context, in io.Reader, pkg *Package) (
 			}
 
 		case tar.TypeReg:
-			installed, err := a.installRegularFile(header, tr, tmpDir, pkg)
+			installed, err := a.installRegularFile(ctx, header, tr, tmpDir, pkg)
 			if err != nil {
 				return nil, err
 			}
@@ -180,6 +180,35 @@ func TestInstallAPKFiles(t *testing.T) {
 
 			checkDuplicateIDBEntries(t, apk)
 		})
+		t.Run("different origin and content, ignoring conflicts", func(t *testing.T) {
+			apk, src, err := testGetTestAPK()
+			require.NoErrorf(t, err, "failed to get test APK")
+			apk.ignoreConflicts = true
+			originalContent := []byte("hello world")
+			finalContent := []byte("extra long I am here")
+			overwriteFilename := "etc/doublewrite"
+
+			pkg := &Package{Name: "first", Origin: "first"}
+			fp1 := fakePackage(t, pkg, []testDirEntry{
+				{"etc", 0o755, true, nil, nil},
+				{overwriteFilename, 0o755, false, originalContent, nil},
+			})
+
+			pkg2 := &Package{Name: "second", Origin: "second"}
+			fp2 := fakePackage(t, pkg2, []testDirEntry{
+				{"etc", 0o755, true, nil, nil},
+				{overwriteFilename, 0o755, false, finalContent, nil},
+			})
+
+			_, err = apk.InstallPackages(context.Background(), nil, []InstallablePackage{fp1, fp2})
+			require.NoError(t, err)
+
+			actual, err := src.ReadFile(overwriteFilename)
+			require.NoError(t, err, "error reading %s", overwriteFilename)
+			require.Equal(t, finalContent, actual)
+
+			checkDuplicateIDBEntries(t, apk)
+		})
 		t.Run("different origin and content, but with replaces", func(t *testing.T) {
 			apk, src, err := testGetTestAPK()
 			require.NoErrorf(t, err, "failed to get test APK")
@@ -189,6 +189,61 @@ func (a *APK) readScriptsTar() (io.ReadCloser, error) {
 	return a.fs.Open(scriptsFilePath)
 }
 
+// Scriptlet is an install script of an installed package.
+type Scriptlet struct {
+	Package *InstalledPackage
+	// Name is the name of the script in the control section of the
+	// package, such as .pre-install or .post-install.
+	Name   string
+	Script []byte
+}
+
+// Scriptlets returns the scripts of the installed packages, in the order
+// the packages were installed in.
+func (a *APK) Scriptlets() ([]Scriptlet, error) {
+	installed, err := a.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("getting installed packages: %w", err)
+	}
+	prefixes := make(map[string]*InstalledPackage, len(installed))
+	for _, pkg := range installed {
+		prefixes[fmt.Sprintf("%s-%s.Q1%s", pkg.Name, pkg.Version, base64.StdEncoding.EncodeToString(pkg.Checksum))] = pkg
+	}
+
+	rc, err := a.readScriptsTar()
+	if err != nil {
+		return nil, fmt.Errorf("opening scripts: %w", err)
+	}
+	defer rc.Close()
+
+	var scriptlets []Scriptlet
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading scripts: %w", err)
+		}
+		// The name of the script follows the prefix of its package.
+		i := strings.LastIndex(hdr.Name, ".")
+		if i < 0 {
+			continue
+		}
+		pkg, ok := prefixes[hdr.Name[:i]]
+		if !ok {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		scriptlets = append(scriptlets, Scriptlet{Package: pkg, Name: hdr.Name[i:], Script: b})
+	}
+	return scriptlets, nil
+}
+
 // updateTriggers insert the triggers into the triggers file
 func (a *APK) updateTriggers(pkg *Package, values []string) error {
 	triggers, err := a.fs.OpenFile(triggersFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0)
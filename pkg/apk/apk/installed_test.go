@@ -420,6 +420,44 @@ func TestUpdateScriptsTar(t *testing.T) {
 	}
 }
 
+func TestScriptlets(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err, "unable to initialize APK implementation")
+
+	installed := map[string][]byte{}
+	for _, name := range []string{"first", "second"} {
+		pkg := &Package{Name: name, Version: "1.0.0-r0", Checksum: []byte(name)}
+		_, err := a.AddInstalledPackage(pkg, nil)
+		require.NoError(t, err)
+		script := []byte("echo " + name)
+		installed[name] = script
+
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: ".post-install", Mode: 0o755, Size: int64(len(script))}))
+		_, err = tw.Write(script)
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, a.updateScriptsTar(pkg, &buf, nil))
+	}
+
+	all, err := a.Scriptlets()
+	require.NoError(t, err)
+	// The test database has scripts of its own.
+	var scriptlets []Scriptlet
+	for _, s := range all {
+		if _, ok := installed[s.Package.Name]; ok {
+			scriptlets = append(scriptlets, s)
+		}
+	}
+	require.Len(t, scriptlets, 2)
+	for i, name := range []string{"first", "second"} {
+		require.Equal(t, name, scriptlets[i].Package.Name)
+		require.Equal(t, ".post-install", scriptlets[i].Name)
+		require.Equal(t, installed[name], scriptlets[i].Script)
+	}
+}
+
 func TestUpdateTriggers(t *testing.T) {
 	a, _, err := testGetTestAPK()
 	require.NoError(t, err, "unable to initialize APK implementation")
@@ -0,0 +1,165 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// FileScheme prefixes repositories that are directories on the local
+	// filesystem, such as file:///home/user/packages, which are read the same
+	// as plain paths.
+	FileScheme = "file://"
+
+	// OCIScheme prefixes repositories served as OCI artifacts, such as
+	// oci://registry.example.com/packages:latest. The artifact is a manifest
+	// with a layer for each file of the repository, titled with its path in
+	// the repository by the org.opencontainers.image.title annotation, as
+	// `oras push` does: x86_64/APKINDEX.tar.gz, x86_64/foo-1.0-r0.apk and
+	// so on. Without a tag or digest, the latest tag is used.
+	OCIScheme = "oci://"
+
+	// ociTitleAnnotation names the file that a layer of an OCI repository is.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+)
+
+// localRepoPath returns the path of repo on the local filesystem if it is a
+// file:// URL, or else repo as it is.
+func localRepoPath(repo string) string {
+	if !strings.HasPrefix(repo, FileScheme) {
+		return repo
+	}
+	u, err := url.Parse(repo)
+	if err != nil || u.Path == "" {
+		return strings.TrimPrefix(repo, FileScheme)
+	}
+	return u.Path
+}
+
+// ociRepositories resolves OCI repositories with the transport and keychain
+// of an APK, and holds the files of those resolved so far by reference, so
+// that packages are fetched from the manifest that their index was read
+// from.
+type ociRepositories struct {
+	transport http.RoundTripper
+	keychain  authn.Keychain
+	artifacts sync.Map // string -> map[string]v1.Layer
+}
+
+// newOCIRepositories returns an ociRepositories using transport and keychain,
+// or the defaults of remote for those that are nil.
+func newOCIRepositories(transport http.RoundTripper, keychain authn.Keychain) *ociRepositories {
+	if transport == nil {
+		transport = remote.DefaultTransport
+	}
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+	return &ociRepositories{transport: transport, keychain: keychain}
+}
+
+// files resolves the manifest of the OCI repository ref and returns its
+// layers by title.
+func (o *ociRepositories) files(ctx context.Context, ref string) (map[string]v1.Layer, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCI repository %s: %w", ref, err)
+	}
+	img, err := remote.Image(r, remote.WithContext(ctx), remote.WithTransport(o.transport), remote.WithAuthFromKeychain(o.keychain))
+	if err != nil {
+		return nil, fmt.Errorf("resolving OCI repository %s: %w", ref, err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of OCI repository %s: %w", ref, err)
+	}
+	files := make(map[string]v1.Layer, len(m.Layers))
+	for _, desc := range m.Layers {
+		title := desc.Annotations[ociTitleAnnotation]
+		if title == "" {
+			continue
+		}
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s of OCI repository %s: %w", title, ref, err)
+		}
+		files[strings.TrimPrefix(title, "./")] = l
+	}
+	o.artifacts.Store(ref, files)
+	return files, nil
+}
+
+// file returns the file at path in the OCI repository ref, resolving the
+// repository unless it was resolved already and resolve is false.
+func (o *ociRepositories) file(ctx context.Context, ref, path string, resolve bool) (v1.Layer, error) {
+	var files map[string]v1.Layer
+	if v, ok := o.artifacts.Load(ref); ok && !resolve {
+		files = v.(map[string]v1.Layer)
+	} else {
+		var err error
+		if files, err = o.files(ctx, ref); err != nil {
+			return nil, err
+		}
+	}
+	l, ok := files[path]
+	if !ok {
+		return nil, fmt.Errorf("OCI repository %s has no file titled %s", ref, path)
+	}
+	return l, nil
+}
+
+// splitOCIPackageURL splits the oci:// URL of a package into the reference
+// of its repository and the path of the package in the repository.
+func splitOCIPackageURL(u string) (ref, path string, err error) {
+	rest := strings.TrimPrefix(u, OCIScheme)
+	file := strings.LastIndex(rest, "/")
+	if file < 0 {
+		return "", "", fmt.Errorf("invalid OCI package URL %s", u)
+	}
+	arch := strings.LastIndex(rest[:file], "/")
+	if arch < 0 {
+		return "", "", fmt.Errorf("invalid OCI package URL %s", u)
+	}
+	return rest[:arch], rest[arch+1:], nil
+}
+
+// fetchPackage opens the package at the oci:// URL u.
+func (o *ociRepositories) fetchPackage(ctx context.Context, u string) (io.ReadCloser, error) {
+	ref, path, err := splitOCIPackageURL(u)
+	if err != nil {
+		return nil, err
+	}
+	l, err := o.file(ctx, ref, path, false)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get package apk at %s: %w", u, err)
+	}
+	return rc, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+)
+
+func testRepositoryKeys() map[string][]byte {
+	keys := make(map[string][]byte, len(testKeys))
+	for k, v := range testKeys {
+		keys[k] = []byte(v)
+	}
+	return keys
+}
+
+func TestFileRepository(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile(filepath.Join(testPrimaryPkgDir, indexFilename))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, testArch), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, testArch, indexFilename), b, 0o644))
+
+	indexes, err := GetRepositoryIndexes(t.Context(), []string{"file://" + dir}, testRepositoryKeys(), testArch)
+	require.NoError(t, err)
+	require.Len(t, indexes, 1)
+	require.NotEmpty(t, indexes[0].Packages())
+
+	// Packages are read from the directory, not a file:// URL.
+	pkg := indexes[0].Packages()[0]
+	require.Equal(t, filepath.Join(dir, testArch, pkg.Filename()), pkg.URL())
+}
+
+func TestOCIRepository(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	index, err := os.ReadFile(filepath.Join(testPrimaryPkgDir, indexFilename))
+	require.NoError(t, err)
+	apk := []byte("not really an apk")
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(index, types.MediaType("application/vnd.apk.index")),
+		Annotations: map[string]string{ociTitleAnnotation: testArch + "/" + indexFilename},
+	}, mutate.Addendum{
+		Layer:       static.NewLayer(apk, types.MediaType("application/vnd.apk")),
+		Annotations: map[string]string{ociTitleAnnotation: testArch + "/hello-0.1.0-r0.apk"},
+	})
+	require.NoError(t, err)
+	repo := u.Host + "/packages"
+	ref, err := name.ParseReference(repo + ":latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	var requests atomic.Int32
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	keychain := &recordingKeychain{}
+	oci := newOCIRepositories(transport, keychain)
+	indexes, err := GetRepositoryIndexes(t.Context(), []string{OCIScheme + repo}, testRepositoryKeys(), testArch, withOCIRepositories(oci))
+	require.NoError(t, err)
+	require.Len(t, indexes, 1)
+	require.NotEmpty(t, indexes[0].Packages())
+	require.NotZero(t, requests.Load(), "the transport of the APK is used")
+	require.Equal(t, []string{u.Host}, keychain.registries, "the keychain of the APK is used")
+	pkg := indexes[0].Packages()[0]
+	require.Equal(t, OCIScheme+repo+"/"+testArch+"/"+pkg.Filename(), pkg.URL())
+
+	t.Run("packages are fetched from the artifact", func(t *testing.T) {
+		rc, err := oci.fetchPackage(t.Context(), OCIScheme+repo+"/"+testArch+"/hello-0.1.0-r0.apk")
+		require.NoError(t, err)
+		defer rc.Close()
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.Equal(t, apk, got)
+	})
+
+	t.Run("missing packages fail", func(t *testing.T) {
+		_, err := oci.fetchPackage(t.Context(), OCIScheme+repo+"/"+testArch+"/missing-1.0-r0.apk")
+		require.ErrorContains(t, err, "has no file titled "+testArch+"/missing-1.0-r0.apk")
+	})
+
+	t.Run("missing repositories fail", func(t *testing.T) {
+		_, err := GetRepositoryIndexes(t.Context(), []string{OCIScheme + u.Host + "/missing"}, testRepositoryKeys(), testArch)
+		require.ErrorContains(t, err, "resolving OCI repository")
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// recordingKeychain records the registries it resolves credentials for.
+type recordingKeychain struct {
+	mu         sync.Mutex
+	registries []string
+}
+
+func (k *recordingKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.registries = append(k.registries, r.RegistryStr())
+	return authn.Anonymous, nil
+}
+
+func TestSplitOCIPackageURL(t *testing.T) {
+	for _, tc := range []struct {
+		u, ref, path string
+	}{
+		{"oci://registry.example.com/packages/x86_64/foo-1.0-r0.apk", "registry.example.com/packages", "x86_64/foo-1.0-r0.apk"},
+		{"oci://localhost:5000/a/b:v1/aarch64/foo-1.0-r0.apk", "localhost:5000/a/b:v1", "aarch64/foo-1.0-r0.apk"},
+	} {
+		ref, path, err := splitOCIPackageURL(tc.u)
+		require.NoError(t, err)
+		require.Equal(t, tc.ref, ref)
+		require.Equal(t, tc.path, path)
+	}
+	_, _, err := splitOCIPackageURL("oci://foo.apk")
+	require.Error(t, err)
+}
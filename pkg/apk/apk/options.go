@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/hashicorp/go-cleanhttp"
 
 	"chainguard.dev/apko/pkg/apk/auth"
@@ -30,13 +31,18 @@ type opts struct {
 	executor           Executor
 	arch               string
 	ignoreMknodErrors  bool
+	ignoreConflicts    bool
 	fs                 apkfs.FullFS
 	version            string
 	cache              *cache
 	noSignatureIndexes []string
 	auth               auth.Authenticator
 	ignoreSignatures   bool
+	requireSigned      bool
+	excluded           []string
+	pruned             []string
 	transport          http.RoundTripper
+	keychain           authn.Keychain
 	packageGetter      PackageGetter
 	sizeLimits         *SizeLimits
 }
@@ -84,6 +90,17 @@ func WithIgnoreMknodErrors(ignore bool) Option {
 	}
 }
 
+// WithIgnoreFileConflicts sets whether a file that packages of different
+// origins ship with different contents, and that neither replaces, is
+// overwritten by the package installed last, with a warning, rather than
+// failing the install. Default is false.
+func WithIgnoreFileConflicts(ignore bool) Option {
+	return func(o *opts) error {
+		o.ignoreConflicts = ignore
+		return nil
+	}
+}
+
 // WithFS sets the filesystem to use. If not provided, will use the OS filesystem based at root /.
 func WithFS(fs apkfs.FullFS) Option {
 	return func(o *opts) error {
@@ -130,6 +147,36 @@ func WithIgnoreIndexSignatures(ignore bool) Option {
 	}
 }
 
+// WithRequireSignedPackages sets whether installing a package fails unless
+// it is signed by a key in the keyring and matches the checksum in its index.
+// Otherwise, packages that cannot be verified are only logged. Default is
+// false.
+func WithRequireSignedPackages(require bool) Option {
+	return func(o *opts) error {
+		o.requireSigned = require
+		return nil
+	}
+}
+
+// WithExcludedPackages sets packages that must not be installed: resolving
+// the world fails if it would install one of them.
+func WithExcludedPackages(names ...string) Option {
+	return func(o *opts) error {
+		o.excluded = names
+		return nil
+	}
+}
+
+// WithPrunedPackages sets packages to leave out of what the world resolves
+// to, even when other packages depend on them. The dependencies that pruning
+// breaks are logged as warnings.
+func WithPrunedPackages(names ...string) Option {
+	return func(o *opts) error {
+		o.pruned = names
+		return nil
+	}
+}
+
 func WithNoSignatureIndexes(noSignatureIndex ...string) Option {
 	return func(o *opts) error {
 		o.noSignatureIndexes = append(o.noSignatureIndexes, noSignatureIndex...)
@@ -154,6 +201,15 @@ func WithTransport(t http.RoundTripper) Option {
 	}
 }
 
+// WithKeychain sets the keychain authenticating to the registries of oci://
+// repositories. The default is authn.DefaultKeychain.
+func WithKeychain(kc authn.Keychain) Option {
+	return func(o *opts) error {
+		o.keychain = kc
+		return nil
+	}
+}
+
 // WithPackageGetter sets a custom PackageGetter for fetching, expanding, and caching packages.
 // If not provided, a DefaultPackageGetter will be created automatically.
 func WithPackageGetter(pg PackageGetter) Option {
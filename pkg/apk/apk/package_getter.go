@@ -57,6 +57,7 @@ type defaultPackageGetter struct {
 	client            *http.Client
 	cache             *cache
 	auth              auth.Authenticator
+	oci               *ociRepositories
 	apkControlMaxSize int64
 	apkDataMaxSize    int64
 }
@@ -78,6 +79,14 @@ func withAPKDataMaxSize(size int64) packageGetterOption {
 	}
 }
 
+// withPackageOCIRepositories fetches packages of oci:// repositories with
+// oci, from the manifests their indexes were read from.
+func withPackageOCIRepositories(oci *ociRepositories) packageGetterOption {
+	return func(d *defaultPackageGetter) {
+		d.oci = oci
+	}
+}
+
 // newDefaultPackageGetter creates a new defaultPackageGetter with the given configuration.
 func newDefaultPackageGetter(client *http.Client, cache *cache, authenticator auth.Authenticator, opts ...packageGetterOption) *defaultPackageGetter {
 	d := &defaultPackageGetter{
@@ -88,6 +97,9 @@ func newDefaultPackageGetter(client *http.Client, cache *cache, authenticator au
 	for _, opt := range opts {
 		opt(d)
 	}
+	if d.oci == nil {
+		d.oci = newOCIRepositories(client.Transport, nil)
+	}
 	return d
 }
 
@@ -178,7 +190,8 @@ func (d *defaultPackageGetter) getPackageImpl(ctx context.Context, pkg Installab
 	return d.cachePackage(ctx, pkg, exp, cacheDir)
 }
 
-// fetchPackage fetches a package from the network or local filesystem.
+// fetchPackage fetches a package from the network, a registry or the local
+// filesystem.
 func (d *defaultPackageGetter) fetchPackage(ctx context.Context, pkg FetchablePackage) (io.ReadCloser, error) {
 	log := clog.FromContext(ctx)
 	log.Debugf("fetching %s", pkg)
@@ -198,7 +211,7 @@ func (d *defaultPackageGetter) fetchPackage(ctx context.Context, pkg FetchablePa
 
 	switch asURL.Scheme {
 	case "file":
-		f, err := os.Open(u)
+		f, err := os.Open(localRepoPath(u))
 		if err != nil {
 			return nil, fmt.Errorf("failed to read repository package apk %s: %w", u, err)
 		}
@@ -227,6 +240,8 @@ func (d *defaultPackageGetter) fetchPackage(ctx context.Context, pkg FetchablePa
 			return nil, fmt.Errorf("unable to get package apk at %s: %v", u, res.Status)
 		}
 		return res.Body, nil
+	case "oci":
+		return d.oci.fetchPackage(ctx, u)
 	default:
 		return nil, fmt.Errorf("repository scheme %s not supported", asURL.Scheme)
 	}
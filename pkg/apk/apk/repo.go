@@ -162,21 +162,9 @@ func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) (
 	arch := strings.TrimSuffix(string(archB), "\n")
 
 	// create the list of keys
-	keys := make(map[string][]byte)
-	dir, err := a.fs.ReadDir(keysDirPath)
+	keys, err := a.keyring()
 	if err != nil {
-		return nil, fmt.Errorf("could not read keys directory in %s at %s: %w", a.fs, keysDirPath, err)
-	}
-	for _, d := range dir {
-		if d.IsDir() {
-			continue
-		}
-		fullPath := filepath.Join(keysDirPath, d.Name())
-		b, err := a.fs.ReadFile(fullPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not read key file at %s: %w", fullPath, err)
-		}
-		keys[d.Name()] = b
+		return nil, err
 	}
 	httpClient := a.client
 	if a.cache != nil {
@@ -187,6 +175,7 @@ func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) (
 		WithIgnoreSignatureForIndexes(a.noSignatureIndexes...),
 		WithHTTPClient(httpClient),
 		WithIndexAuthenticator(a.auth),
+		withOCIRepositories(a.oci),
 	}
 	if sz := a.apkIndexDecompressedMaxSize(); sz != 0 {
 		opts = append(opts, WithIndexDecompressedMaxSize(sz))
@@ -320,7 +309,7 @@ func (p *PkgResolver) disqualifyProviders(constraint string, dq map[*RepositoryP
 		return
 	}
 
-	conflicting := filterPackages(providers, dq, withVersion(parsed.Version, parsed.dep), withPreferPin(parsed.pin))
+	conflicting := filterPackages(providers, dq, withName(parsed.Name), withVersion(parsed.Version, parsed.dep), withPreferPin(parsed.pin))
 
 	for _, conflict := range conflicting {
 		if _, dqed := dq[conflict.RepositoryPackage]; dqed {
@@ -430,6 +419,9 @@ func (p *PkgResolver) disqualify(dq map[*RepositoryPackage]string, pkg *Reposito
 // constrain looks through a list of constraints and disqualifies anything that would
 // conflict with any constraints that have a version selector (i.e. not versionAny).
 func (p *PkgResolver) constrain(constraints []string, dq map[*RepositoryPackage]string) error {
+	// The version constraints on each name, to tell apart constraints that
+	// conflict with each other from ones that no version satisfies.
+	byName := map[string][]string{}
 	for _, constraint := range constraints {
 		if strings.HasPrefix(constraint, "!") {
 			p.disqualifyProviders(constraint[1:], dq)
@@ -451,6 +443,7 @@ func (p *PkgResolver) constrain(constraints []string, dq map[*RepositoryPackage]
 			// This shouldn't happen but return an error to be safe.
 			return fmt.Errorf("parsing constraint %q: %w", constraint, err)
 		}
+		byName[parsed.Name] = append(byName[parsed.Name], constraint)
 
 		for _, provider := range providers {
 			if provider.Name == parsed.Name {
@@ -484,9 +477,50 @@ func (p *PkgResolver) constrain(constraints []string, dq map[*RepositoryPackage]
 		}
 	}
 
+	for name, cs := range byName {
+		if len(cs) < 2 {
+			continue
+		}
+		if err := p.checkConflicts(name, cs); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// checkConflicts returns an error if there are packages named name but none
+// of them has a version satisfying all of constraints.
+func (p *PkgResolver) checkConflicts(name string, constraints []string) error {
+	var versions []string
+	for _, provider := range p.nameMap[name] {
+		if provider.Name != name {
+			continue
+		}
+		actualVersion, err := cachedParseVersion(provider.Version)
+		if err != nil {
+			continue
+		}
+		satisfied := true
+		for _, c := range constraints {
+			if ok, err := cachedResolvePackageNameVersionPin(c).SatisfiedBy(actualVersion); err != nil || !ok {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return nil
+		}
+		versions = append(versions, provider.Version)
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	slices.Sort(versions)
+	return fmt.Errorf("constraints %s conflict: no version of %s satisfies all of them, the versions available are %s",
+		strings.Join(constraints, ", "), name, strings.Join(slices.Compact(versions), ", "))
+}
+
 // GetPackagesWithDependencies get all of the dependencies for the given packages based on the
 // indexes. Does not filter for installed already or not.
 func (p *PkgResolver) GetPackagesWithDependencies(ctx context.Context, packages []string, allArchs map[string][]NamedIndex) (toInstall []*RepositoryPackage, conflicts []string, err error) {
@@ -496,6 +530,9 @@ func (p *PkgResolver) GetPackagesWithDependencies(ctx context.Context, packages
 	// Tracks all the packages we have disqualified and the reason we disqualified them.
 	dq := globalDisqualifyCache.Get(ctx, allArchs)
 
+	// Constraints on a range of versions are a constraint on each bound.
+	packages = expandVersionRanges(packages)
+
 	// We're going to mutate this as our set of input packages to install, so make a copy.
 	constraints := slices.Clone(packages)
 
@@ -558,9 +595,32 @@ func (p *PkgResolver) GetPackagesWithDependencies(ctx context.Context, packages
 
 	conflicts = uniqify(conflicts)
 
+	if err := checkNegations(toInstall); err != nil {
+		return nil, nil, err
+	}
+
 	return toInstall, conflicts, nil
 }
 
+// checkNegations returns an error if one of pkgs has a !name dependency that
+// another of them satisfies, as they cannot be installed together.
+func checkNegations(pkgs []*RepositoryPackage) error {
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Dependencies {
+			if !strings.HasPrefix(dep, "!") {
+				continue
+			}
+			constraint := cachedResolvePackageNameVersionPin(dep[1:])
+			for _, other := range pkgs {
+				if other != pkg && constraint.providedBy(other) {
+					return fmt.Errorf("%s conflicts with %s, which satisfies %q", pkg.Filename(), other.Filename(), dep)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // GetPackageWithDependencies get all of the dependencies for a single package as well as looking
 // up the package itself and resolving its version, based on the indexes.
 // Requires the existing set because the logic for resolving dependencies between competing
@@ -650,7 +710,7 @@ func (p *PkgResolver) ResolvePackage(pkgName string, dq map[*RepositoryPackage]s
 
 	// pkgsWithVersions contains a map of all versions of the package
 	// get the one that most matches what was requested
-	packages := filterPackages(pkgsWithVersions, dq, withVersion(version, compare), withPreferPin(pin))
+	packages := filterPackages(pkgsWithVersions, dq, withName(name), withVersion(version, compare), withPreferPin(pin))
 	if len(packages) == 0 {
 		return nil, maybedqerror(pkgsWithVersions, dq)
 	}
@@ -677,7 +737,7 @@ func (p *PkgResolver) resolvePackage(pkgName string, dq map[*RepositoryPackage]s
 
 	// pkgsWithVersions contains a map of all versions of the package
 	// get the one that most matches what was requested
-	packages := filterPackages(pkgsWithVersions, dq, withVersion(version, compare), withPreferPin(pin))
+	packages := filterPackages(pkgsWithVersions, dq, withName(name), withVersion(version, compare), withPreferPin(pin))
 	if len(packages) == 0 {
 		return nil, maybedqerror(pkgsWithVersions, dq)
 	}
@@ -836,6 +896,7 @@ func (p *PkgResolver) getPackageDependencies(ctx context.Context, pkg *Repositor
 			// get the one that most matches what was requested
 			pkgs := filterPackages(depPkgWithVersions,
 				dq,
+				withName(name),
 				withVersion(version, compare),
 				withAllowPin(allowPin),
 				withInstalledPackage(existing[name]),
@@ -1007,6 +1068,17 @@ func (p *PkgResolver) comparePackages(compare *RepositoryPackage, name string, e
 			return 1
 		}
 
+		// a package with the name looked for is preferred over the ones
+		// providing it, whatever their priority
+		if name != "" && a.Name != b.Name {
+			if a.Name == name {
+				return -1
+			}
+			if b.Name == name {
+				return 1
+			}
+		}
+
 		// check provider priority
 		if a.ProviderPriority != b.ProviderPriority {
 			if a.ProviderPriority > b.ProviderPriority {
@@ -664,7 +664,9 @@ func TestResolvePackage(t *testing.T) {
 		resolver := NewPkgResolver(context.Background(), testNamedRepositoryFromIndexes(index))
 		pkgs, err := resolver.ResolvePackage("package5>1.0.0", map[*RepositoryPackage]string{})
 		require.NoError(t, err)
-		require.Len(t, pkgs, 6)
+		// package5-special and package5-noconflict provide package5 without
+		// a version, so they cannot satisfy a versioned constraint.
+		require.Len(t, pkgs, 4)
 		// first version should be highest match
 		require.Equal(t, "2.0.0", pkgs[0].Version)
 	})
@@ -1003,3 +1005,140 @@ func TestDisqualifyingOtherArchitectures(t *testing.T) {
 	_, _, err := resolver.GetPackagesWithDependencies(context.Background(), names, byArch)
 	require.ErrorContains(t, err, "package \"onlyinarm64-1.0.0.apk\" not available for arch \"x86_64\"")
 }
+
+func TestVersionConstraints(t *testing.T) {
+	deps := map[string][]string{
+		"foo=1.1-r0": nil,
+		"foo=1.2-r0": nil,
+		"foo=1.9-r1": nil,
+		"foo=2.0-r0": nil,
+	}
+	for _, tt := range []struct {
+		constraints []string
+		want        string
+		wantErr     string
+	}{
+		{constraints: []string{"foo>=1.2"}, want: "foo-2.0-r0.apk"},
+		{constraints: []string{"foo<2"}, want: "foo-1.9-r1.apk"},
+		{constraints: []string{"foo~1.2"}, want: "foo-1.2-r0.apk"},
+		{constraints: []string{"foo>=1.2,<2"}, want: "foo-1.9-r1.apk"},
+		{constraints: []string{"foo>=1.2", "foo<1.9"}, want: "foo-1.2-r0.apk"},
+		{constraints: []string{"foo>=2", "foo<1.5"}, wantErr: "constraints foo>=2, foo<1.5 conflict: no version of foo satisfies all of them, the versions available are 1.1-r0, 1.2-r0, 1.9-r1, 2.0-r0"},
+		{constraints: []string{"foo>=2,<1.5"}, wantErr: "constraints foo>=2, foo<1.5 conflict"},
+		{constraints: []string{"foo>3"}, wantErr: `"2.0-r0" does not satisfy "foo>3"`},
+	} {
+		t.Run(strings.Join(tt.constraints, " "), func(t *testing.T) {
+			pkgs, _, err := makeResolver(nil, deps).GetPackagesWithDependencies(context.Background(), tt.constraints, nil)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, pkgs, 1)
+			require.Equal(t, tt.want, pkgs[0].Filename())
+		})
+	}
+}
+
+func TestProvidesAndNegations(t *testing.T) {
+	ctx := context.Background()
+	resolve := func(t *testing.T, r *PkgResolver, world ...string) ([]string, error) {
+		t.Helper()
+		pkgs, _, err := r.GetPackagesWithDependencies(ctx, world, nil)
+		var names []string
+		for _, pkg := range pkgs {
+			names = append(names, pkg.Filename())
+		}
+		return names, err
+	}
+	priority := func(r *PkgResolver, name string, prio uint64) {
+		for _, pkg := range r.nameMap[name] {
+			if pkg.Name == name {
+				pkg.ProviderPriority = prio
+			}
+		}
+	}
+
+	t.Run("versioned dependencies use the version provided", func(t *testing.T) {
+		r := makeResolver(map[string][]string{
+			"bigpkg=9.0-r0":  {"libfoo=1.0"},
+			"libfoo2=2.1-r0": {"libfoo=2.1"},
+		}, map[string][]string{
+			"app=1.0-r0": {"libfoo>=2"},
+		})
+		got, err := resolve(t, r, "app")
+		require.NoError(t, err)
+		require.Equal(t, []string{"libfoo2-2.1-r0.apk", "app-1.0-r0.apk"}, got)
+	})
+
+	t.Run("unversioned provides do not satisfy versioned dependencies", func(t *testing.T) {
+		r := makeResolver(map[string][]string{
+			"virt=9.0-r0": {"libfoo"},
+		}, map[string][]string{
+			"app=1.0-r0": {"libfoo>=2"},
+		})
+		_, err := resolve(t, r, "app")
+		require.Error(t, err)
+	})
+
+	t.Run("packages with the name are preferred over providers", func(t *testing.T) {
+		r := makeResolver(map[string][]string{
+			"busybox=2.0-r0": {"sh"},
+		}, map[string][]string{
+			"sh=1.0-r0":  nil,
+			"app=1.0-r0": {"sh"},
+		})
+		priority(r, "busybox", 100)
+		got, err := resolve(t, r, "app")
+		require.NoError(t, err)
+		require.Equal(t, []string{"sh-1.0-r0.apk", "app-1.0-r0.apk"}, got)
+	})
+
+	t.Run("provider priority picks between providers", func(t *testing.T) {
+		r := makeResolver(map[string][]string{
+			"busybox=1.0-r0": {"cmd:sh"},
+			"dash=2.0-r0":    {"cmd:sh"},
+		}, map[string][]string{
+			"app=1.0-r0": {"cmd:sh"},
+		})
+		priority(r, "busybox", 100)
+		priority(r, "dash", 10)
+		got, err := resolve(t, r, "app")
+		require.NoError(t, err)
+		require.Equal(t, []string{"busybox-1.0-r0.apk", "app-1.0-r0.apk"}, got)
+	})
+
+	t.Run("negated dependencies cannot be installed together", func(t *testing.T) {
+		r := makeResolver(nil, map[string][]string{
+			"a=1.0-r0": {"!b"},
+			"b=1.0-r0": nil,
+		})
+		_, err := resolve(t, r, "a", "b")
+		require.ErrorContains(t, err, "excluded by !b")
+		// b is picked before the dependencies of a are seen.
+		_, err = resolve(t, r, "b", "a")
+		require.ErrorContains(t, err, `a-1.0-r0.apk conflicts with b-1.0-r0.apk, which satisfies "!b"`)
+	})
+
+	t.Run("negated dependencies are versioned", func(t *testing.T) {
+		r := makeResolver(nil, map[string][]string{
+			"a=1.0-r0": {"!b<1"},
+			"b=1.0-r0": nil,
+		})
+		got, err := resolve(t, r, "a", "b")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"a-1.0-r0.apk", "b-1.0-r0.apk"}, got)
+	})
+
+	t.Run("negated dependencies steer the choice of providers", func(t *testing.T) {
+		r := makeResolver(map[string][]string{
+			"busybox=1.0-r0": {"cmd:sh"},
+			"dash=2.0-r0":    {"cmd:sh"},
+		}, map[string][]string{
+			"app=1.0-r0": {"!dash", "cmd:sh"},
+		})
+		got, err := resolve(t, r, "app")
+		require.NoError(t, err)
+		require.Equal(t, []string{"busybox-1.0-r0.apk", "app-1.0-r0.apk"}, got)
+	})
+}
@@ -15,12 +15,28 @@
 package apk
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+
+	"chainguard.dev/apko/pkg/egress"
 )
 
+// checkRetry is the retry policy of the HTTP clients used to fetch from
+// repositories. Requests denied by an egress allowlist will never succeed,
+// so they are not retried.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	var denied *egress.DeniedError
+	if errors.As(err, &denied) {
+		return false, err
+	}
+	return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+}
+
 type rangeRetryTransport struct {
 	base http.RoundTripper
 }
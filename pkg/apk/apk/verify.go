@@ -0,0 +1,234 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/expandapk"
+	sign "chainguard.dev/apko/pkg/apk/signature"
+)
+
+// PackageVerification is how a package fetched for installation was
+// verified against the keyring and the index it was resolved from.
+type PackageVerification struct {
+	// KeyID is the keyring key that the signature of the package was
+	// verified with, if any.
+	KeyID string
+	// Checksum is set if the control section of the package matched the
+	// checksum the index has for it.
+	Checksum bool
+	// Err is why the package could not be verified, if it could not.
+	Err error
+}
+
+// Verified reports whether the package is signed by a key in the keyring and
+// matches the index it was resolved from, if that has a checksum for it.
+func (v PackageVerification) Verified() bool {
+	return v.Err == nil && v.KeyID != ""
+}
+
+func (v PackageVerification) String() string {
+	switch {
+	case v.Err != nil:
+		return fmt.Sprintf("signature not verified: %v", v.Err)
+	case v.Checksum:
+		return fmt.Sprintf("signature verified with key %s, checksum matches the repository index", v.KeyID)
+	default:
+		return fmt.Sprintf("signature verified with key %s", v.KeyID)
+	}
+}
+
+// PackageVerifications returns how each package installed by InstallPackages
+// was verified, by package name.
+func (a *APK) PackageVerifications() map[string]PackageVerification {
+	return a.verifications
+}
+
+// PackageSources returns the URL each package installed by InstallPackages
+// was installed from, by package name.
+func (a *APK) PackageSources() map[string]string {
+	return a.sources
+}
+
+// keyring returns the contents of the keys in the keyring, by file name.
+func (a *APK) keyring() (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	dir, err := a.fs.ReadDir(keysDirPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keys directory in %s at %s: %w", a.fs, keysDirPath, err)
+	}
+	for _, d := range dir {
+		if d.IsDir() {
+			continue
+		}
+		fullPath := filepath.Join(keysDirPath, d.Name())
+		b, err := a.fs.ReadFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key file at %s: %w", fullPath, err)
+		}
+		keys[d.Name()] = b
+	}
+	return keys, nil
+}
+
+// packageKeyring returns the keyring to verify packages with, which is empty
+// if none was set up.
+func (a *APK) packageKeyring() (map[string][]byte, error) {
+	keys, err := a.keyring()
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string][]byte{}, nil
+	}
+	return keys, err
+}
+
+// verifyPackage checks that the control section of exp matches the checksum
+// pkg has in its index, and that the signature of exp is by one of keys.
+func verifyPackage(pkg InstallablePackage, exp *expandapk.APKExpanded, keys map[string][]byte) PackageVerification {
+	var v PackageVerification
+	if chk := pkg.ChecksumString(); strings.HasPrefix(chk, "Q1") {
+		want, err := base64.StdEncoding.DecodeString(chk[2:])
+		if err != nil {
+			v.Err = fmt.Errorf("malformed checksum %q in index: %w", chk, err)
+			return v
+		}
+		if !bytes.Equal(want, exp.ControlHash) {
+			v.Err = fmt.Errorf("checksum mismatch: index has %s, package has Q1%s", chk, base64.StdEncoding.EncodeToString(exp.ControlHash))
+			return v
+		}
+		v.Checksum = true
+	}
+
+	if exp.SignatureFile == "" {
+		v.Err = errors.New("package is not signed")
+		return v
+	}
+	sigs, err := packageSignatures(exp.SignatureFile)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+
+	var controlDigests map[crypto.Hash][]byte
+	var errs []error
+	for _, sig := range sigs {
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			// Keys fetched through proxies may lack the extension.
+			key, ok = keys[strings.TrimSuffix(sig.KeyID, ".rsa.pub")]
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("key %s is not in the keyring", sig.KeyID))
+			continue
+		}
+		if controlDigests == nil {
+			if controlDigests, err = controlSectionDigests(exp); err != nil {
+				v.Err = err
+				return v
+			}
+		}
+		if err := sign.RSAVerifyDigest(controlDigests[sig.DigestAlgorithm], sig.DigestAlgorithm, sig.Signature, key); err != nil {
+			errs = append(errs, fmt.Errorf("signature by %s: %w", sig.KeyID, err))
+			continue
+		}
+		v.KeyID = sig.KeyID
+		return v
+	}
+	if len(errs) == 0 {
+		errs = append(errs, errors.New("no supported signature"))
+	}
+	v.Err = errors.Join(errs...)
+	return v
+}
+
+// packageSignatures reads the signatures in the signature section of a
+// package.
+func packageSignatures(path string) ([]Signature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening signature section: %w", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature section: %w", err)
+	}
+	defer zr.Close()
+
+	var sigs []Signature
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading signature section: %w", err)
+		}
+		matches := signatureFileRegex.FindStringSubmatch(hdr.Name)
+		if len(matches) != 3 {
+			return nil, fmt.Errorf("unexpected file %s in signature section", hdr.Name)
+		}
+		var digestAlgorithm crypto.Hash
+		switch matches[1] {
+		case "RSA":
+			digestAlgorithm = crypto.SHA1
+		case "RSA256":
+			digestAlgorithm = crypto.SHA256
+		default:
+			// DSA is obsolete and RSA512 not supported, as for indexes.
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		sigs = append(sigs, Signature{
+			KeyID:           matches[2],
+			Signature:       b,
+			DigestAlgorithm: digestAlgorithm,
+		})
+	}
+	return sigs, nil
+}
+
+// controlSectionDigests returns the digests of the compressed control
+// section of exp that package signatures sign.
+func controlSectionDigests(exp *expandapk.APKExpanded) (map[crypto.Hash][]byte, error) {
+	f, err := os.Open(exp.ControlFile)
+	if err != nil {
+		return nil, fmt.Errorf("opening control section: %w", err)
+	}
+	defer f.Close()
+	h1, h256 := crypto.SHA1.New(), crypto.SHA256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), f); err != nil {
+		return nil, fmt.Errorf("hashing control section: %w", err)
+	}
+	return map[crypto.Hash][]byte{
+		crypto.SHA1:   h1.Sum(nil),
+		crypto.SHA256: h256.Sum(nil),
+	}, nil
+}
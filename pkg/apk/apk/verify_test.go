@@ -0,0 +1,202 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // this is what apk tools is using
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/expandapk"
+)
+
+// signedFakePackage is fakePackage with a signature section signing the
+// control section with key, as keyName, using RSA or RSA256.
+func signedFakePackage(t *testing.T, pkg *Package, entries []testDirEntry, key *rsa.PrivateKey, keyName, sigType string) *testPackage {
+	t.Helper()
+
+	section := func(write func(tw *tar.Writer) error) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		require.NoError(t, write(tw))
+		require.NoError(t, tw.Flush())
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	control := section(func(tw *tar.Writer) error {
+		var b bytes.Buffer
+		if err := template.Must(template.New("control").Parse(controlTemplate)).Execute(&b, pkg); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: ".PKGINFO", Typeflag: tar.TypeReg, Size: int64(b.Len())}); err != nil {
+			return err
+		}
+		_, err := tw.Write(b.Bytes())
+		return err
+	})
+
+	hash := crypto.SHA1
+	var digest []byte
+	if sigType == "RSA256" {
+		hash = crypto.SHA256
+		d := sha256.Sum256(control)
+		digest = d[:]
+	} else {
+		d := sha1.Sum(control) //nolint:gosec
+		digest = d[:]
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+	require.NoError(t, err)
+	signature := section(func(tw *tar.Writer) error {
+		if err := tw.WriteHeader(&tar.Header{Name: ".SIGN." + sigType + "." + keyName, Typeflag: tar.TypeReg, Size: int64(len(sig))}); err != nil {
+			return err
+		}
+		_, err := tw.Write(sig)
+		return err
+	})
+
+	data := section(func(tw *tar.Writer) error { return writeFiles(tw, entries) })
+
+	f := filepath.Join(t.TempDir(), pkg.Name+".apk")
+	require.NoError(t, os.WriteFile(f, append(append(signature, control...), data...), 0o644))
+
+	sum := sha1.Sum(control) //nolint:gosec
+	return &testPackage{
+		pkg:      pkg,
+		file:     f,
+		checksum: "Q1" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerifyPackage(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys := map[string][]byte{"test.rsa.pub": publicKeyPEM(t, key)}
+	entries := []testDirEntry{{"etc", 0o755, true, nil, nil}}
+
+	expand := func(t *testing.T, pkg InstallablePackage) *expandapk.APKExpanded {
+		f, err := os.Open(pkg.URL())
+		require.NoError(t, err)
+		defer f.Close()
+		exp, err := expandapk.ExpandApk(ctx, f, "")
+		require.NoError(t, err)
+		t.Cleanup(func() { exp.Close() })
+		return exp
+	}
+
+	for _, sigType := range []string{"RSA", "RSA256"} {
+		t.Run("signed with "+sigType, func(t *testing.T) {
+			pkg := signedFakePackage(t, &Package{Name: "signed"}, entries, key, "test.rsa.pub", sigType)
+			v := verifyPackage(pkg, expand(t, pkg), keys)
+			require.NoError(t, v.Err)
+			require.True(t, v.Verified())
+			require.True(t, v.Checksum)
+			require.Equal(t, "test.rsa.pub", v.KeyID)
+		})
+	}
+
+	t.Run("key without extension", func(t *testing.T) {
+		pkg := signedFakePackage(t, &Package{Name: "signed"}, entries, key, "test.rsa.pub", "RSA")
+		v := verifyPackage(pkg, expand(t, pkg), map[string][]byte{"test": keys["test.rsa.pub"]})
+		require.True(t, v.Verified())
+	})
+
+	t.Run("signed by someone else", func(t *testing.T) {
+		pkg := signedFakePackage(t, &Package{Name: "forged"}, entries, other, "test.rsa.pub", "RSA")
+		v := verifyPackage(pkg, expand(t, pkg), keys)
+		require.False(t, v.Verified())
+		require.ErrorContains(t, v.Err, "signature by test.rsa.pub")
+	})
+
+	t.Run("key not in keyring", func(t *testing.T) {
+		pkg := signedFakePackage(t, &Package{Name: "unknown"}, entries, other, "other.rsa.pub", "RSA")
+		v := verifyPackage(pkg, expand(t, pkg), keys)
+		require.ErrorContains(t, v.Err, "key other.rsa.pub is not in the keyring")
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		pkg := signedFakePackage(t, &Package{Name: "mismatch"}, entries, key, "test.rsa.pub", "RSA")
+		pkg.checksum = "Q1" + base64.StdEncoding.EncodeToString(make([]byte, sha1.Size))
+		v := verifyPackage(pkg, expand(t, pkg), keys)
+		require.ErrorContains(t, v.Err, "checksum mismatch")
+		require.False(t, v.Checksum)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		pkg := fakePackage(t, &Package{Name: "unsigned"}, entries)
+		v := verifyPackage(pkg, expand(t, pkg), keys)
+		require.ErrorContains(t, v.Err, "not signed")
+	})
+}
+
+func TestInstallPackagesRequireSigned(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	entries := []testDirEntry{{"etc", 0o755, true, nil, nil}}
+
+	newAPK := func(t *testing.T) *APK {
+		a, src, err := testGetTestAPK()
+		require.NoError(t, err)
+		require.NoError(t, src.MkdirAll(keysDirPath, 0o755))
+		require.NoError(t, src.WriteFile(filepath.Join(keysDirPath, "test.rsa.pub"), publicKeyPEM(t, key), 0o644))
+		a.requireSigned = true
+		return a
+	}
+
+	t.Run("signed packages are installed", func(t *testing.T) {
+		a := newAPK(t)
+		pkg := signedFakePackage(t, &Package{Name: "signed"}, entries, key, "test.rsa.pub", "RSA")
+		_, err := a.InstallPackages(ctx, nil, []InstallablePackage{pkg})
+		require.NoError(t, err)
+		v := a.PackageVerifications()["signed"]
+		require.True(t, v.Verified())
+		require.Equal(t, "signature verified with key test.rsa.pub, checksum matches the repository index", v.String())
+	})
+
+	t.Run("unsigned packages fail", func(t *testing.T) {
+		a := newAPK(t)
+		pkg := fakePackage(t, &Package{Name: "unsigned"}, entries)
+		_, err := a.InstallPackages(ctx, nil, []InstallablePackage{pkg})
+		require.ErrorContains(t, err, "package is not signed")
+	})
+}
@@ -367,6 +367,40 @@ func (p ParsedConstraint) SatisfiedBy(v Version) (bool, error) {
 	return p.dep.satisfies(v, pv), nil
 }
 
+// providedBy reports whether pkg is named p.Name, or provides it, at a version
+// satisfying p. Packages providing p.Name without a version only satisfy p if
+// it has none either.
+func (p ParsedConstraint) providedBy(pkg *RepositoryPackage) bool {
+	if pkg.Name == p.Name {
+		if p.Version == "" {
+			return true
+		}
+		if v, err := cachedParseVersion(pkg.Version); err == nil {
+			if ok, err := p.SatisfiedBy(v); err == nil && ok {
+				return true
+			}
+		}
+	}
+	for _, prov := range pkg.Provides {
+		provided := cachedResolvePackageNameVersionPin(prov)
+		if provided.Name != p.Name {
+			continue
+		}
+		if p.Version == "" {
+			return true
+		}
+		if provided.Version == "" {
+			continue
+		}
+		if v, err := cachedParseVersion(provided.Version); err == nil {
+			if ok, err := p.SatisfiedBy(v); err == nil && ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 var endsWithReleaseStr = regexp.MustCompile(`-r\d+$`)
 
 func ResolvePackageNameVersionPin(pkgName string) ParsedConstraint {
@@ -429,9 +463,41 @@ func ResolvePackageNameVersionPin(pkgName string) ParsedConstraint {
 	return p
 }
 
+// ExpandVersionRange splits a constraint on a range of versions, such as
+// foo>=1.2,<2, into a constraint for each of its bounds: foo>=1.2 and foo<2.
+// A repository pin at the end, as in foo>=1.2,<2@local, applies to each of
+// them. Other constraints are returned as they are.
+func ExpandVersionRange(constraint string) []string {
+	first, rest, ok := strings.Cut(constraint, ",")
+	if !ok {
+		return []string{constraint}
+	}
+	bounds := strings.Split(rest, ",")
+	var pin string
+	if last, p, ok := strings.Cut(bounds[len(bounds)-1], "@"); ok {
+		bounds[len(bounds)-1], pin = last, "@"+p
+	}
+	name := ResolvePackageNameVersionPin(first).Name
+	expanded := []string{strings.TrimSpace(first) + pin}
+	for _, bound := range bounds {
+		expanded = append(expanded, name+strings.TrimSpace(bound)+pin)
+	}
+	return expanded
+}
+
+// expandVersionRanges is ExpandVersionRange for each of constraints.
+func expandVersionRanges(constraints []string) []string {
+	expanded := make([]string, 0, len(constraints))
+	for _, c := range constraints {
+		expanded = append(expanded, ExpandVersionRange(c)...)
+	}
+	return expanded
+}
+
 type filterOptions struct {
 	allowPin  string
 	preferPin string
+	name      string
 	version   string
 	installed *RepositoryPackage
 	compare   versionDependency
@@ -455,6 +521,15 @@ func withVersion(version string, compare versionDependency) filterOption {
 		o.compare = compare
 	}
 }
+
+// withName makes versions be compared with the version each package has for
+// name: its own if it is named name, else the version it provides name at,
+// with packages providing name without a version satisfying no version.
+func withName(name string) filterOption {
+	return func(o *filterOptions) {
+		o.name = name
+	}
+}
 func withInstalledPackage(pkg *RepositoryPackage) filterOption {
 	return func(o *filterOptions) {
 		o.installed = pkg
@@ -501,24 +576,33 @@ func filterPackages(pkgs []*repositoryPackage, dq map[*RepositoryPackage]string,
 			return nil
 		}
 
-		actualVersion, err := cachedParseVersion(pkg.Version)
-		// skip invalid ones
-		if err != nil {
-			continue
-		}
+		if o.name == "" || o.name == pkg.Name {
+			actualVersion, err := cachedParseVersion(pkg.Version)
+			// skip invalid ones
+			if err != nil {
+				continue
+			}
 
-		if o.compare.satisfies(actualVersion, requiredVersion) {
-			passed = append(passed, pkg)
-			continue
+			if o.compare.satisfies(actualVersion, requiredVersion) {
+				passed = append(passed, pkg)
+				continue
+			}
+			if o.name != "" {
+				continue
+			}
 		}
 
 		for _, prov := range pkg.Provides {
-			version := cachedResolvePackageNameVersionPin(prov).Version
+			provided := cachedResolvePackageNameVersionPin(prov)
+			if o.name != "" && provided.Name != o.name {
+				continue
+			}
+			version := provided.Version
 			if version == "" {
 				continue
 			}
 
-			actualVersion, err = cachedParseVersion(version)
+			actualVersion, err := cachedParseVersion(version)
 			// again, we skip invalid ones
 			if err != nil {
 				continue
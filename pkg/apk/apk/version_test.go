@@ -960,3 +960,21 @@ func TestResolverPackageNameVersionPin(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandVersionRange(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       []string
+	}{
+		{"foo", []string{"foo"}},
+		{"foo=1.2.3-r0", []string{"foo=1.2.3-r0"}},
+		{"foo>=1.2,<2", []string{"foo>=1.2", "foo<2"}},
+		{"foo>1.2, <=1.9", []string{"foo>1.2", "foo<=1.9"}},
+		{"foo>=1.2,<2@local", []string{"foo>=1.2@local", "foo<2@local"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			require.Equal(t, tt.want, ExpandVersionRange(tt.constraint))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WhyLink is a package in a WhyChain, with what pulled it in.
+type WhyLink struct {
+	Package *RepositoryPackage
+	// World is the world constraint the package was installed for, if it
+	// is the first of a chain.
+	World string
+	// Dependency is the dependency of the previous package in the chain
+	// that the package satisfies, if it was pulled in by one.
+	Dependency string
+	// InstallIf is the install_if condition of the package, if it was
+	// installed because all of it was.
+	InstallIf []string
+}
+
+func (l WhyLink) String() string {
+	switch {
+	case l.World != "":
+		return fmt.Sprintf("%s (world: %s)", l.Package.Name, l.World)
+	case len(l.InstallIf) != 0:
+		return fmt.Sprintf("%s (installed if %s)", l.Package.Name, strings.Join(l.InstallIf, ", "))
+	default:
+		return fmt.Sprintf("%s (depends on %s)", l.Package.Name, l.Dependency)
+	}
+}
+
+// WhyChain is a chain of packages from a world constraint to a package,
+// each pulled in by the one before it.
+type WhyChain []WhyLink
+
+func (c WhyChain) String() string {
+	links := make([]string, len(c))
+	for i, l := range c {
+		links[i] = l.String()
+	}
+	return strings.Join(links, " -> ")
+}
+
+// Why explains why the package named name is in pkgs, the packages that
+// world resolved to: for each world constraint that leads to the package, it
+// returns the shortest chain of dependencies from the package the constraint
+// resolved to down to it. Packages pulled in by install_if end a chain at the
+// first of their condition that is found.
+func Why(world []string, pkgs []*RepositoryPackage, name string) ([]WhyChain, error) {
+	var target *RepositoryPackage
+	for _, pkg := range pkgs {
+		if pkg.Name == name {
+			target = pkg
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("package %s is not installed", name)
+	}
+
+	// What each package pulls in, in the order of its dependencies.
+	edges := make(map[*RepositoryPackage][]WhyLink, len(pkgs))
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			constraint := cachedResolvePackageNameVersionPin(dep)
+			for _, other := range pkgs {
+				if other != pkg && constraint.providedBy(other) {
+					edges[pkg] = append(edges[pkg], WhyLink{Package: other, Dependency: dep})
+					break
+				}
+			}
+		}
+		// A package installed if others are hangs off the first of them.
+		for _, cond := range pkg.InstallIf {
+			constraint := cachedResolvePackageNameVersionPin(cond)
+			for _, other := range pkgs {
+				if other != pkg && constraint.providedBy(other) {
+					edges[other] = append(edges[other], WhyLink{Package: pkg, InstallIf: pkg.InstallIf})
+					break
+				}
+			}
+			break
+		}
+	}
+
+	var chains []WhyChain
+	for _, w := range world {
+		constraint := cachedResolvePackageNameVersionPin(w)
+		var root *RepositoryPackage
+		for _, pkg := range pkgs {
+			if constraint.providedBy(pkg) {
+				root = pkg
+				break
+			}
+		}
+		if root == nil {
+			continue
+		}
+
+		// Breadth first, so that the first chain found is the shortest.
+		prev := map[*RepositoryPackage]WhyChain{root: {{Package: root, World: w}}}
+		queue := []*RepositoryPackage{root}
+		for len(queue) != 0 {
+			pkg := queue[0]
+			queue = queue[1:]
+			if pkg == target {
+				chains = append(chains, prev[pkg])
+				break
+			}
+			for _, link := range edges[pkg] {
+				if _, seen := prev[link.Package]; seen {
+					continue
+				}
+				chain := make(WhyChain, len(prev[pkg]), len(prev[pkg])+1)
+				copy(chain, prev[pkg])
+				prev[link.Package] = append(chain, link)
+				queue = append(queue, link.Package)
+			}
+		}
+	}
+	return chains, nil
+}
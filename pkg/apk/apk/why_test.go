@@ -0,0 +1,56 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhy(t *testing.T) {
+	repo := &RepositoryWithIndex{Repository: &Repository{URI: "local"}}
+	pkg := func(p *Package) *RepositoryPackage { return NewRepositoryPackage(p, repo) }
+	pkgs := []*RepositoryPackage{
+		pkg(&Package{Name: "musl", Version: "1.2.4-r0", Provides: []string{"so:libc.musl-x86_64.so.1=1"}}),
+		pkg(&Package{Name: "busybox", Version: "1.36.1-r0", Provides: []string{"cmd:sh"}, Dependencies: []string{"so:libc.musl-x86_64.so.1"}}),
+		pkg(&Package{Name: "curl", Version: "8.0-r0", Dependencies: []string{"libcurl>=8", "so:libc.musl-x86_64.so.1"}}),
+		pkg(&Package{Name: "libcurl", Version: "8.0-r0", Dependencies: []string{"so:libc.musl-x86_64.so.1", "!libcurl-old"}}),
+		pkg(&Package{Name: "curl-doc", Version: "8.0-r0", InstallIf: []string{"curl=8.0-r0", "docs"}}),
+		pkg(&Package{Name: "docs", Version: "1-r0"}),
+	}
+	world := []string{"busybox", "curl", "docs"}
+
+	why := func(name string) []string {
+		chains, err := Why(world, pkgs, name)
+		require.NoError(t, err)
+		var got []string
+		for _, c := range chains {
+			got = append(got, c.String())
+		}
+		return got
+	}
+
+	require.Equal(t, []string{
+		"busybox (world: busybox) -> musl (depends on so:libc.musl-x86_64.so.1)",
+		"curl (world: curl) -> musl (depends on so:libc.musl-x86_64.so.1)",
+	}, why("musl"))
+	require.Equal(t, []string{"curl (world: curl) -> libcurl (depends on libcurl>=8)"}, why("libcurl"))
+	require.Equal(t, []string{"curl (world: curl) -> curl-doc (installed if curl=8.0-r0, docs)"}, why("curl-doc"))
+	require.Equal(t, []string{"docs (world: docs)"}, why("docs"))
+
+	_, err := Why(world, pkgs, "openssl")
+	require.ErrorContains(t, err, "package openssl is not installed")
+}
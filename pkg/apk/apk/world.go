@@ -45,9 +45,9 @@ func (a *APK) SetWorld(ctx context.Context, packages []string) error {
 	log := clog.FromContext(ctx)
 	log.Debug("setting apk world")
 
-	// sort them before writing
-	copied := make([]string, len(packages))
-	copy(copied, packages)
+	// sort them before writing, with ranges written as a constraint for each
+	// bound, as apk reads them
+	copied := expandVersionRanges(packages)
 	sort.Strings(copied)
 
 	data := strings.Join(copied, "\n") + "\n"
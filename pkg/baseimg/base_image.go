@@ -18,12 +18,19 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"slices"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	ocitypes "github.com/google/go-containerregistry/pkg/v1/types"
 
 	"chainguard.dev/apko/pkg/apk/apk"
@@ -57,7 +64,23 @@ func getUnnestedImageIndex(imgPath string) (v1.ImageIndex, error) {
 	return index, nil
 }
 
+// imageHasArch reports whether img is for arch.
+func imageHasArch(img v1.Image, arch types.Architecture) (bool, error) {
+	config, err := img.ConfigFile()
+	if err != nil {
+		return false, err
+	}
+	if config == nil {
+		return false, fmt.Errorf("got image without config")
+	}
+	return config.Architecture == arch.ToOCIPlatform().Architecture, nil
+}
+
 func getImageForArch(imgPath string, arch types.Architecture) (v1.Image, error) {
+	if fi, err := os.Stat(imgPath); err == nil && !fi.IsDir() {
+		return getTarballImageForArch(imgPath, arch)
+	}
+
 	index, err := getUnnestedImageIndex(imgPath)
 	if err != nil {
 		return nil, err
@@ -72,24 +95,98 @@ func getImageForArch(imgPath string, arch types.Architecture) (v1.Image, error)
 		if err != nil {
 			return nil, err
 		}
-		config, err := img.ConfigFile()
+		ok, err := imageHasArch(img, arch)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return img, nil
+		}
+	}
+	return nil, fmt.Errorf("image for arch not found")
+}
+
+// getTarballImageForArch returns the image for arch in the tarball at
+// imgPath, as written by docker save or apko build, which holds one image or
+// tagged ones for several architectures.
+func getTarballImageForArch(imgPath string, arch types.Architecture) (v1.Image, error) {
+	opener := func() (io.ReadCloser, error) {
+		return os.Open(imgPath)
+	}
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", imgPath, err)
+	}
+	for _, desc := range m {
+		var tag *name.Tag
+		if len(desc.RepoTags) != 0 {
+			t, err := name.NewTag(desc.RepoTags[0])
+			if err != nil {
+				return nil, err
+			}
+			tag = &t
+		} else if len(m) != 1 {
+			continue
+		}
+		img, err := tarball.Image(opener, tag)
 		if err != nil {
 			return nil, err
 		}
-		if config == nil {
-			return nil, fmt.Errorf("got image without config")
+		ok, err := imageHasArch(img, arch)
+		if err != nil {
+			return nil, err
 		}
-		if config.Architecture == arch.ToOCIPlatform().Architecture {
+		if ok {
 			return img, nil
 		}
 	}
 	return nil, fmt.Errorf("image for arch not found")
 }
 
+// installedDBPaths are where the database of the packages installed in an
+// image may be.
+var installedDBPaths = []string{"usr/lib/apk/db/installed", "lib/apk/db/installed"}
+
+// readInstalledDB returns the database of the packages installed in img,
+// which is empty if it has none.
+func readInstalledDB(img v1.Image) ([]byte, error) {
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	found := map[string][]byte{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading base image: %w", err)
+		}
+		p := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || !slices.Contains(installedDBPaths, p) {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s of base image: %w", p, err)
+		}
+		found[p] = b
+	}
+	for _, p := range installedDBPaths {
+		if b, ok := found[p]; ok {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
 // New creates an instance of BaseImage base on provided parameters:
-//   - imgPath: path to the directory containing OCI layout of the image.
+//   - imgPath: path to the directory containing OCI layout of the image, or
+//     to a tarball of the image.
 //   - apkIndexPath: path to the directory containing per arch APKINDEX files representing
-//     installed file of the base image.
+//     installed file of the base image. If empty, the database of installed packages of the
+//     image is read instead.
 //   - arch: architecture of the base image.
 //   - materializedApkIndexPath: path where the auxiliary APKINDEX of the base image will be written to in order to
 //     resolve packages.
@@ -98,7 +195,19 @@ func New(imgPath string, apkIndexPath string, arch types.Architecture, materizal
 	if err != nil {
 		return nil, err
 	}
-	contents, err := os.ReadFile(path.Join(apkIndexPath, arch.ToAPK(), "APKINDEX"))
+	return NewFromImage(img, apkIndexPath, arch, materizalizedApkIndexPath)
+}
+
+// NewFromImage is like New, for an image that was already loaded, such as
+// one pulled from a registry.
+func NewFromImage(img v1.Image, apkIndexPath string, arch types.Architecture, materizalizedApkIndexPath string) (*BaseImage, error) {
+	var contents []byte
+	var err error
+	if apkIndexPath != "" {
+		contents, err = os.ReadFile(path.Join(apkIndexPath, arch.ToAPK(), "APKINDEX"))
+	} else {
+		contents, err = readInstalledDB(img)
+	}
 	if err != nil {
 		return nil, err
 	}
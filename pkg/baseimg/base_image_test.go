@@ -0,0 +1,103 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baseimg
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// testImage returns an image for arch with the apk database of the test base
+// image at installedPath, if it is set.
+func testImage(t *testing.T, arch types.Architecture, installedPath string) v1.Image {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	if installedPath != "" {
+		db, err := os.ReadFile(filepath.Join("..", "..", "internal", "cli", "testdata", "base_image", "metadata", arch.ToAPK(), "APKINDEX"))
+		require.NoError(t, err)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: installedPath, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(db))}))
+		_, err = tw.Write(db)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	b := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	})
+	require.NoError(t, err)
+	plat := arch.ToOCIPlatform()
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{Architecture: plat.Architecture, OS: plat.OS})
+	require.NoError(t, err)
+	img, err = mutate.AppendLayers(img, layer)
+	require.NoError(t, err)
+	return img
+}
+
+func TestNewFromTarball(t *testing.T) {
+	amd64 := types.ParseArchitecture("amd64")
+	arm64 := types.ParseArchitecture("arm64")
+
+	imgPath := filepath.Join(t.TempDir(), "base.tar")
+	refs := map[name.Reference]v1.Image{}
+	for _, arch := range []types.Architecture{amd64, arm64} {
+		tag, err := name.NewTag("base:latest-" + arch.String())
+		require.NoError(t, err)
+		refs[tag] = testImage(t, arch, "usr/lib/apk/db/installed")
+	}
+	require.NoError(t, tarball.MultiRefWriteToFile(imgPath, refs))
+
+	for _, arch := range []types.Architecture{amd64, arm64} {
+		base, err := New(imgPath, "", arch, t.TempDir())
+		require.NoError(t, err)
+		cfg, err := base.Image().ConfigFile()
+		require.NoError(t, err)
+		require.Equal(t, arch.ToOCIPlatform().Architecture, cfg.Architecture)
+		require.Len(t, base.InstalledPackages(), 2)
+		require.Equal(t, "pretend-baselayout", base.InstalledPackages()[0].Name)
+		require.FileExists(t, filepath.Join(base.APKIndexPath(), arch.ToAPK(), "APKINDEX.tar.gz"))
+	}
+
+	_, err := New(imgPath, "", types.ParseArchitecture("riscv64"), t.TempDir())
+	require.ErrorContains(t, err, "image for arch not found")
+}
+
+func TestNewFromImage(t *testing.T) {
+	arch := types.ParseArchitecture("amd64")
+
+	// Images that are not usr-merged keep the database in /lib.
+	base, err := NewFromImage(testImage(t, arch, "./lib/apk/db/installed"), "", arch, t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, base.InstalledPackages(), 2)
+
+	// Images not built from apk packages have none installed.
+	base, err = NewFromImage(testImage(t, arch, ""), "", arch, t.TempDir())
+	require.NoError(t, err)
+	require.Empty(t, base.InstalledPackages())
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"golang.org/x/sync/errgroup"
 
@@ -37,12 +38,40 @@ func appendGroup(groups []passwd.GroupEntry, group types.Group) []passwd.GroupEn
 	return append(groups, ge)
 }
 
+// addGroupMember adds user to the members of the group named group.
+func addGroupMember(groups []passwd.GroupEntry, group, user string) error {
+	for i, ge := range groups {
+		if ge.GroupName != group {
+			continue
+		}
+		// Groups without members are parsed as having an empty one.
+		members := slices.DeleteFunc(slices.Clone(ge.Members), func(m string) bool { return m == "" })
+		if !slices.Contains(members, user) {
+			members = append(members, user)
+		}
+		groups[i].Members = members
+		return nil
+	}
+	return fmt.Errorf("user %s is a member of unknown group %s", user, group)
+}
+
 func userToUserEntry(user types.User) passwd.UserEntry {
 	if user.Shell == "" {
-		user.Shell = "/bin/sh"
+		if user.System {
+			user.Shell = "/sbin/nologin"
+		} else {
+			user.Shell = "/bin/sh"
+		}
 	}
 	if user.HomeDir == "" {
-		user.HomeDir = "/home/" + user.UserName
+		if user.System {
+			user.HomeDir = "/dev/null"
+		} else {
+			user.HomeDir = "/home/" + user.UserName
+		}
+	}
+	if user.Gecos == "" {
+		user.Gecos = "Account created by apko"
 	}
 	// Default the GID to the UID if not provided
 	gid := user.UID
@@ -55,7 +84,7 @@ func userToUserEntry(user types.User) passwd.UserEntry {
 		GID:      gid,
 		HomeDir:  user.HomeDir,
 		Password: "x",
-		Info:     "Account created by apko",
+		Info:     user.Gecos,
 		Shell:    user.Shell,
 	}
 }
@@ -63,7 +92,8 @@ func userToUserEntry(user types.User) passwd.UserEntry {
 func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 	var eg errgroup.Group
 
-	if len(ic.Accounts.Groups) != 0 {
+	hasMembers := slices.ContainsFunc(ic.Accounts.Users, func(u types.User) bool { return len(u.Groups) != 0 })
+	if len(ic.Accounts.Groups) != 0 || hasMembers {
 		// Mutate the /etc/groups file
 		eg.Go(func() error {
 			path := filepath.Join("etc", "group")
@@ -77,6 +107,14 @@ func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 				gf.Entries = appendGroup(gf.Entries, g)
 			}
 
+			for _, u := range ic.Accounts.Users {
+				for _, g := range u.Groups {
+					if err := addGroupMember(gf.Entries, g, u.UserName); err != nil {
+						return err
+					}
+				}
+			}
+
 			if err := gf.WriteFile(fsys, path); err != nil {
 				return err
 			}
@@ -85,6 +123,27 @@ func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 		})
 	}
 
+	if len(ic.Accounts.Users) != 0 {
+		// Mutate the /etc/shadow file, with the passwords of new users locked.
+		eg.Go(func() error {
+			path := filepath.Join("etc", "shadow")
+
+			sf, err := passwd.ReadOrCreateShadowFile(fsys, path)
+			if err != nil {
+				return err
+			}
+
+			for _, u := range ic.Accounts.Users {
+				if slices.ContainsFunc(sf.Entries, func(se passwd.ShadowEntry) bool { return se.UserName == u.UserName }) {
+					continue
+				}
+				sf.Entries = append(sf.Entries, passwd.ShadowEntry{UserName: u.UserName, Password: "!"})
+			}
+
+			return sf.WriteFile(fsys, path)
+		})
+	}
+
 	// Mutate the /etc/passwd file
 	eg.Go(func() error {
 		path := filepath.Join("etc", "passwd")
@@ -17,6 +17,9 @@ package build
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build/types"
 )
 
@@ -26,6 +29,7 @@ var (
 	id1234  = uint32(1234)
 	id1235  = uint32(1235)
 	id1235T = types.GID(&id1235)
+	id10000 = uint32(10000)
 )
 
 func Test_userToUserEntry_UID_GID_mapping(t *testing.T) {
@@ -78,3 +82,81 @@ func Test_userToUserEntry_UID_GID_mapping(t *testing.T) {
 		}
 	}
 }
+
+func Test_userToUserEntry_defaults(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		user types.User
+		want [3]string
+	}{{
+		desc: "Regular accounts log in to a home",
+		user: types.User{UserName: "alice"},
+		want: [3]string{"Account created by apko", "/home/alice", "/bin/sh"},
+	}, {
+		desc: "System accounts are homeless and cannot log in",
+		user: types.User{UserName: "daemon", System: true},
+		want: [3]string{"Account created by apko", "/dev/null", "/sbin/nologin"},
+	}, {
+		desc: "Everything can be set",
+		user: types.User{UserName: "bob", System: true, Gecos: "Bob", HomeDir: "/var/lib/bob", Shell: "/bin/bash"},
+		want: [3]string{"Bob", "/var/lib/bob", "/bin/bash"},
+	}} {
+		ue := userToUserEntry(test.user)
+		require.Equal(t, test.want, [3]string{ue.Info, ue.HomeDir, ue.Shell}, test.desc)
+	}
+}
+
+func TestMutateAccounts(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/group", []byte("root:x:0:root\nwheel:x:10:\n"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/shadow", []byte("root:*::0:::::\nalice:$6$hash:19000:0:99999:7:::\n"), 0o600))
+
+	ic := &types.ImageConfiguration{
+		Accounts: types.ImageAccounts{
+			Groups: []types.Group{{GroupName: "web", GID: 10000}},
+			Users: []types.User{{
+				UserName: "alice",
+				UID:      1000,
+				Gecos:    "Alice",
+				Groups:   []string{"wheel", "web"},
+			}, {
+				UserName: "nginx",
+				UID:      10000,
+				GID:      types.GID(&id10000),
+				System:   true,
+				Groups:   []string{"web"},
+			}},
+		},
+	}
+	require.NoError(t, mutateAccounts(fsys, ic))
+
+	b, err := fsys.ReadFile("etc/passwd")
+	require.NoError(t, err)
+	require.Equal(t, "alice:x:1000:1000:Alice:/home/alice:/bin/sh\nnginx:x:10000:10000:Account created by apko:/dev/null:/sbin/nologin\n", string(b))
+
+	b, err = fsys.ReadFile("etc/group")
+	require.NoError(t, err)
+	require.Equal(t, "root:x:0:root\nwheel:x:10:alice\nweb:x:10000:alice,nginx\n", string(b))
+
+	// Passwords that are set already are kept.
+	b, err = fsys.ReadFile("etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, "root:*::0:::::\nalice:$6$hash:19000:0:99999:7:::\nnginx:!:::::::\n", string(b))
+
+	// Only regular accounts get a home directory.
+	fi, err := fsys.Stat("home/alice")
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+
+	t.Run("unknown supplementary group", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("etc", 0o755))
+		ic := &types.ImageConfiguration{
+			Accounts: types.ImageAccounts{
+				Users: []types.User{{UserName: "alice", UID: 1000, Groups: []string{"wheel"}}},
+			},
+		}
+		require.EqualError(t, mutateAccounts(fsys, ic), "user alice is a member of unknown group wheel")
+	})
+}
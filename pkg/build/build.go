@@ -17,20 +17,26 @@ package build
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	v1types "github.com/google/go-containerregistry/pkg/v1/types"
 	"go.opentelemetry.io/otel"
 	"gopkg.in/yaml.v3"
@@ -41,6 +47,7 @@ import (
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/baseimg"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/paths"
 	"chainguard.dev/apko/pkg/s6"
@@ -64,6 +71,75 @@ type Context struct {
 	fs      apkfs.FullFS
 	apk     *apk.APK
 	baseimg *baseimg.BaseImage
+
+	// stripped are the files the strip path mutations removed.
+	stripped []string
+
+	// optsCtx is the context options are applied with, for options that
+	// fetch or read anything.
+	optsCtx context.Context
+
+	// What options leave to finish once all of them are applied, so that
+	// they do not depend on their order: the configuration WithConfig
+	// loads, the annotations WithAnnotations adds to it, the vendor
+	// directory of WithVendorDir, and the keys of the directories
+	// WithKeyringDir adds.
+	configFile         string
+	configIncludePaths []string
+	annotations        map[string]string
+	vendorDir          string
+	keyringDirs        []string
+}
+
+// applyOptions applies opts to bc, and then finishes what they left to do
+// once all of them are applied.
+func (bc *Context) applyOptions(opts []Option) error {
+	for _, opt := range opts {
+		if err := opt(bc); err != nil {
+			return err
+		}
+	}
+	if bc.configFile != "" {
+		log := clog.FromContext(bc.optsCtx)
+		log.Debugf("loading config file: %s", bc.configFile)
+
+		var ic types.ImageConfiguration
+		hasher := sha256.New()
+		if err := ic.LoadWithVariables(bc.remoteContext(bc.optsCtx), bc.configFile, bc.configIncludePaths, hasher, bc.o.ConfigVariables); err != nil {
+			return fmt.Errorf("failed to load image configuration: %w", err)
+		}
+		bc.ic = ic
+		bc.o.ImageConfigFile = bc.configFile
+		bc.o.ImageConfigChecksum = "sha256-" + base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+	}
+	if len(bc.annotations) != 0 {
+		if bc.ic.Annotations == nil {
+			bc.ic.Annotations = make(map[string]string)
+		}
+		maps.Copy(bc.ic.Annotations, bc.annotations)
+	}
+	bc.applyVendorDir()
+	for _, dir := range bc.keyringDirs {
+		keys, err := keyringDirKeys(dir)
+		if err != nil {
+			return err
+		}
+		bc.o.ExtraKeyFiles = append(slices.Clip(bc.o.ExtraKeyFiles), keys...)
+	}
+	bc.keyringDirs = nil
+	if dir := bc.ic.Contents.KeyringDir; dir != "" {
+		resolved, err := paths.ResolvePath(dir, bc.configIncludePaths)
+		if err != nil {
+			return fmt.Errorf("resolving contents.keyring-dir %s: %w", dir, err)
+		}
+		keys, err := keyringDirKeys(resolved)
+		if err != nil {
+			return err
+		}
+		bc.ic.Contents.Keyring = append(slices.Clip(bc.ic.Contents.Keyring), keys...)
+		bc.ic.Contents.KeyringDir = ""
+	}
+	return nil
 }
 
 func (bc *Context) Summarize(ctx context.Context) {
@@ -78,7 +154,7 @@ func (bc *Context) BaseImage() v1.Image {
 }
 
 func (bc *Context) GetBuildDateEpoch() (time.Time, error) {
-	if _, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+	if _, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && !bc.o.BuildDateFromPackages {
 		return bc.o.SourceDateEpoch, nil
 	}
 	pl, err := bc.apk.GetInstalled()
@@ -100,7 +176,10 @@ func (bc *Context) BuildImage(ctx context.Context) error {
 	ctx, span := otel.Tracer("apko").Start(ctx, "BuildImage")
 	defer span.End()
 
-	if _, err := bc.buildImage(ctx); err != nil {
+	done := events.StartPhase(ctx, "build-image", bc.Arch().ToAPK())
+	_, err := bc.buildImage(ctx)
+	done(err)
+	if err != nil {
 		log.Debugf("buildImage failed: %v", err)
 		b, err2 := yaml.Marshal(bc.ic)
 		if err2 != nil {
@@ -193,14 +272,30 @@ func (bc *Context) ImageLayoutToLayer(ctx context.Context) (string, v1.Layer, er
 		return "", nil, fmt.Errorf("generating tarball: %w", err)
 	}
 
-	l, err := lw.finalize()
+	fl, err := lw.finalize()
 	if err != nil {
 		return "", nil, fmt.Errorf("finalizing layer: %w", err)
 	}
+	l, err := bc.formatLayer(fl)
+	if err != nil {
+		return "", nil, err
+	}
+	bc.emitLayerBuilt(ctx, l)
 
 	return outfile.Name(), l, nil
 }
 
+func (bc *Context) emitLayerBuilt(ctx context.Context, l v1.Layer) {
+	ev := events.Event{Type: events.LayerBuilt, Arch: bc.Arch().ToAPK()}
+	if h, err := l.Digest(); err == nil {
+		ev.Digest = h.String()
+	}
+	if size, err := l.Size(); err == nil {
+		ev.Size = size
+	}
+	events.Emit(ctx, ev)
+}
+
 func (bc *Context) checkPaths(ctx context.Context) error {
 	log := clog.FromContext(ctx)
 
@@ -215,19 +310,26 @@ func (bc *Context) checkPaths(ctx context.Context) error {
 			return fmt.Errorf("checking %s file: %w", p, err)
 		}
 	}
+	if err := bc.checkEntrypointShell(ctx); err != nil {
+		return err
+	}
+	if bc.o.ValidateRuntime {
+		if err := bc.checkRuntime(); err != nil {
+			return fmt.Errorf("validating the image runtime: %w", err)
+		}
+	}
 	return nil
 }
 
 // NewOptions evaluates the build.Options in the same way as New().
-func NewOptions(opts ...Option) (*options.Options, *types.ImageConfiguration, error) {
+func NewOptions(ctx context.Context, opts ...Option) (*options.Options, *types.ImageConfiguration, error) {
 	bc := Context{
-		o: options.Default,
+		o:       options.Default,
+		optsCtx: ctx,
 	}
 
-	for _, opt := range opts {
-		if err := opt(&bc); err != nil {
-			return nil, nil, err
-		}
+	if err := bc.applyOptions(opts); err != nil {
+		return nil, nil, err
 	}
 
 	return &bc.o, &bc.ic, nil
@@ -235,7 +337,8 @@ func NewOptions(opts ...Option) (*options.Options, *types.ImageConfiguration, er
 
 // New creates a build context.
 // The SOURCE_DATE_EPOCH env variable is supported and will
-// overwrite the provided timestamp if present.
+// overwrite the provided timestamp if present, unless the build date is
+// BuildDatePackages.
 func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error) {
 	log := clog.FromContext(ctx)
 
@@ -243,18 +346,17 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 	defer span.End()
 
 	bc := Context{
-		o:  options.Default,
-		fs: fs,
+		o:       options.Default,
+		fs:      fs,
+		optsCtx: ctx,
 	}
 
-	for _, opt := range opts {
-		if err := opt(&bc); err != nil {
-			return nil, err
-		}
+	if err := bc.applyOptions(opts); err != nil {
+		return nil, err
 	}
 
 	// SOURCE_DATE_EPOCH will always overwrite the build flag
-	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && len(strings.TrimSpace(v)) != 0 {
+	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && len(strings.TrimSpace(v)) != 0 && !bc.o.BuildDateFromPackages {
 		// The value MUST be an ASCII representation of an integer
 		// with no fractional component, identical to the output
 		// format of date +%s.
@@ -268,19 +370,39 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		bc.o.SourceDateEpoch = time.Unix(sec, 0).UTC()
 	}
 
+	if bc.o.RequireSignedPackages && bc.o.IgnoreSignatures {
+		return nil, fmt.Errorf("requiring signed packages and ignoring signatures are mutually exclusive")
+	}
+
 	// if arch is missing default to the running program's arch
 	zeroArch := types.Architecture("")
 	if bc.o.Arch == zeroArch {
 		bc.o.Arch = types.ParseArchitecture(runtime.GOARCH)
 	}
 
+	if len(bc.ic.ArchOverrides) != 0 {
+		if err := bc.ic.ValidateArchOverrides(); err != nil {
+			return nil, fmt.Errorf("failed to validate configuration: %w", err)
+		}
+		ic, err := bc.ic.ForArch(bc.o.Arch)
+		if err != nil {
+			return nil, err
+		}
+		bc.ic = *ic
+	}
+
 	apkOpts := []apk.Option{
 		apk.WithFS(bc.fs),
 		apk.WithArch(bc.o.Arch.ToAPK()),
 		apk.WithIgnoreMknodErrors(true),
 		apk.WithIgnoreIndexSignatures(bc.o.IgnoreSignatures),
+		apk.WithRequireSignedPackages(bc.o.RequireSignedPackages),
+		apk.WithExcludedPackages(bc.ic.Contents.ExcludePackages...),
+		apk.WithPrunedPackages(bc.ic.Contents.PrunePackages...),
+		apk.WithIgnoreFileConflicts(bc.ic.Contents.FileConflicts == "warn"),
 		apk.WithAuthenticator(bc.o.Auth),
 		apk.WithTransport(bc.o.Transport),
+		apk.WithKeychain(bc.o.Keychain),
 		apk.WithPackageGetter(bc.o.PackageGetter),
 		apk.WithSizeLimits(&apk.SizeLimits{
 			APKIndexDecompressedMaxSize: bc.o.SizeLimits.APKIndexDecompressedMaxSize,
@@ -307,15 +429,7 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 	}
 
 	if bc.ic.Contents.BaseImage != nil {
-		imgPath, err := paths.ResolvePath(bc.ic.Contents.BaseImage.Image, bc.o.IncludePaths)
-		if err != nil {
-			return nil, fmt.Errorf("baseImage path %s: %w", bc.ic.Contents.BaseImage.Image, err)
-		}
-		apkindexPath, err := paths.ResolvePath(bc.ic.Contents.BaseImage.APKIndex, bc.o.IncludePaths)
-		if err != nil {
-			return nil, fmt.Errorf("baseImage apk path %s: %w", bc.ic.Contents.BaseImage.Image, err)
-		}
-		baseImg, err := baseimg.New(imgPath, apkindexPath, bc.Arch(), bc.o.TempDir())
+		baseImg, err := bc.loadBaseImage(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -485,6 +599,32 @@ func (l *layer) MediaType() (v1types.MediaType, error) {
 	return l.desc.MediaType, nil
 }
 
+// remoteContext returns ctx with the transport and keychain that remote
+// configurations are fetched with.
+func (bc *Context) remoteContext(ctx context.Context) context.Context {
+	if bc.o.Transport != nil {
+		ctx = types.WithRemoteTransport(ctx, bc.o.Transport)
+	}
+	if bc.o.Keychain != nil {
+		ctx = types.WithRemoteKeychain(ctx, bc.o.Keychain)
+	}
+	return ctx
+}
+
+// WrittenConfiguration returns the configuration file given with WithConfig
+// as it is written, loaded like the configuration is, with its variables
+// substituted, but with nothing it includes merged in.
+func (bc *Context) WrittenConfiguration(ctx context.Context) (types.ImageConfiguration, error) {
+	var ic types.ImageConfiguration
+	if bc.configFile == "" {
+		return ic, errors.New("no configuration file was given")
+	}
+	if err := ic.LoadWritten(bc.remoteContext(ctx), bc.configFile, bc.configIncludePaths, bc.o.ConfigVariables); err != nil {
+		return ic, fmt.Errorf("failed to load image configuration: %w", err)
+	}
+	return ic, nil
+}
+
 // Here be dragons:
 // There was previously a pattern of accessing build.New().Options for convenience.
 // This unfortunately led to a lot of mutation of build.Context.Options for convenience.
@@ -511,3 +651,65 @@ func (bc *Context) WantSBOM() bool {
 func (bc *Context) APK() *apk.APK {
 	return bc.apk
 }
+
+// loadBaseImage loads the base image of the configuration, from a local OCI
+// layout or tarball, or else from a registry.
+func (bc *Context) loadBaseImage(ctx context.Context) (*baseimg.BaseImage, error) {
+	desc := bc.ic.Contents.BaseImage
+	apkindexPath := ""
+	if desc.APKIndex != "" {
+		var err error
+		apkindexPath, err = paths.ResolvePath(desc.APKIndex, bc.o.IncludePaths)
+		if err != nil {
+			return nil, fmt.Errorf("baseImage apk path %s: %w", desc.APKIndex, err)
+		}
+	}
+
+	imgPath, err := paths.ResolvePath(desc.Image, bc.o.IncludePaths)
+	if err == nil {
+		return baseimg.New(imgPath, apkindexPath, bc.Arch(), bc.o.TempDir())
+	}
+	// A mistyped path must not be pulled from a registry instead.
+	if looksLikePath(desc.Image) {
+		return nil, fmt.Errorf("baseImage path %s: %w", desc.Image, err)
+	}
+	ref, perr := name.ParseReference(desc.Image)
+	if perr != nil {
+		return nil, fmt.Errorf("baseImage path %s: %w", desc.Image, err)
+	}
+
+	keychain := bc.o.Keychain
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+	ropts := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithPlatform(*bc.Arch().ToOCIPlatform()),
+	}
+	if bc.o.Transport != nil {
+		ropts = append(ropts, remote.WithTransport(bc.o.Transport))
+	}
+	img, err := remote.Image(ref, ropts...)
+	if err != nil {
+		return nil, fmt.Errorf("pulling base image %s: %w", ref, err)
+	}
+	return baseimg.NewFromImage(img, apkindexPath, bc.Arch(), bc.o.TempDir())
+}
+
+// looksLikePath reports whether the base image s is meant as a path rather
+// than an image reference: absolute or relative to the current directory, or
+// an image tarball.
+func looksLikePath(s string) bool {
+	for _, prefix := range []string{"/", "./", "../", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return filepath.IsAbs(s)
+}
@@ -36,8 +36,10 @@ import (
 	ldsocache "chainguard.dev/apko/internal/ldso-cache"
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/lock"
 	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/s6"
 )
 
 // pgzip's default is GOMAXPROCS(0)
@@ -148,32 +150,19 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 		}
 	}
 
-	var (
-		pkgs []apk.InstalledDiff
-		err  error
-	)
-	if bc.o.Lockfile != "" {
-		log.Debugf("Using lockfile: %s", bc.o.Lockfile)
-		lock, err := lock.FromFile(bc.o.Lockfile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load lock-file: %w", err)
-		}
-		err = bc.VerifyLockfileConsistency(ctx, lock.Config)
-		if err != nil {
-			return nil, err
-		}
-		allPkgs, err := installablePackagesForArch(lock, bc.Arch())
-		if err != nil {
-			return nil, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
-		}
-		pkgs, err = bc.apk.InstallPackages(ctx, &bc.o.SourceDateEpoch, allPkgs)
-		if err != nil {
-			return nil, fmt.Errorf("failed installation from lockfile %s: %w", bc.o.Lockfile, err)
-		}
-	} else {
-		pkgs, err = bc.apk.FixateWorld(ctx, &bc.o.SourceDateEpoch)
+	done := events.StartPhase(ctx, "install-packages", bc.Arch().ToAPK())
+	pkgs, err := bc.installPackages(ctx)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if bc.o.RunScriptlets {
+		done := events.StartPhase(ctx, "run-scriptlets", bc.Arch().ToAPK())
+		err := bc.runScriptlets(ctx)
+		done(err)
 		if err != nil {
-			return nil, fmt.Errorf("installing apk packages: %w", err)
+			return nil, fmt.Errorf("running scriptlets: %w", err)
 		}
 	}
 
@@ -190,6 +179,18 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 		return nil, fmt.Errorf("failed to install apko config: %w", err)
 	}
 
+	if err := writeSystemConfig(bc.fs, &bc.ic); err != nil {
+		return nil, fmt.Errorf("failed to write system config: %w", err)
+	}
+
+	if err := writeOSRelease(bc.fs, bc.ic.OSRelease); err != nil {
+		return nil, fmt.Errorf("failed to write os-release: %w", err)
+	}
+
+	if err := copyFiles(bc.fs, bc.ic.Contents.Files, bc.o.SourceDateEpoch); err != nil {
+		return nil, fmt.Errorf("failed to copy files: %w", err)
+	}
+
 	if err := mutatePaths(bc.fs, &bc.o, &bc.ic); err != nil {
 		return nil, fmt.Errorf("failed to mutate paths: %w", err)
 	}
@@ -198,11 +199,21 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 		return nil, fmt.Errorf("failed to install certificates: %w", err)
 	}
 
-	if err := bc.s6.WriteSupervisionTree(ctx, bc.ic.Entrypoint.Services); err != nil {
+	services := make(map[string]s6.Service, len(bc.ic.Entrypoint.Services))
+	for name, svc := range bc.ic.Entrypoint.Services {
+		services[name] = s6.Service{
+			Command:      svc.Command,
+			Dependencies: svc.Dependencies,
+			Environment:  svc.Environment,
+			WorkDir:      svc.WorkDir,
+			User:         svc.RunAs,
+		}
+	}
+	if err := bc.s6.WriteServices(ctx, services); err != nil {
 		return nil, fmt.Errorf("failed to write supervision tree: %w", err)
 	}
 
-	// add busybox symlinks
+	// add busybox and other multiplexer symlinks
 	installed, err := bc.apk.GetInstalled()
 	if err != nil {
 		return nil, fmt.Errorf("getting installed packages: %w", err)
@@ -212,11 +223,22 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 		return nil, err
 	}
 
+	if err := installConfiguredLinks(bc.fs, installed, bc.ic.Links); err != nil {
+		return nil, err
+	}
+
 	// add necessary character devices
 	if err := installCharDevices(bc.fs); err != nil {
 		return nil, err
 	}
 
+	if bc.stripped, err = stripPaths(bc.fs, &bc.ic); err != nil {
+		return nil, fmt.Errorf("failed to strip paths: %w", err)
+	}
+	if len(bc.stripped) != 0 {
+		log.Infof("stripped %d files", len(bc.stripped))
+	}
+
 	if err := updateCache(ctx, bc.fs); err != nil {
 		return nil, err
 	}
@@ -226,6 +248,39 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 	return pkgs, nil
 }
 
+// installPackages installs the packages pinned by the lockfile, if any, or
+// otherwise those resolved from the world.
+func (bc *Context) installPackages(ctx context.Context) ([]apk.InstalledDiff, error) {
+	log := clog.FromContext(ctx)
+
+	if bc.o.Lockfile != "" {
+		log.Debugf("Using lockfile: %s", bc.o.Lockfile)
+		lock, err := lock.FromFile(bc.o.Lockfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load lock-file: %w", err)
+		}
+		err = bc.VerifyLockfileConsistency(ctx, lock.Config)
+		if err != nil {
+			return nil, err
+		}
+		allPkgs, err := installablePackagesForArch(lock, bc.Arch())
+		if err != nil {
+			return nil, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
+		}
+		pkgs, err := bc.apk.InstallPackages(ctx, &bc.o.SourceDateEpoch, allPkgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed installation from lockfile %s: %w", bc.o.Lockfile, err)
+		}
+		return pkgs, nil
+	}
+
+	pkgs, err := bc.apk.FixateWorld(ctx, &bc.o.SourceDateEpoch)
+	if err != nil {
+		return nil, fmt.Errorf("installing apk packages: %w", err)
+	}
+	return pkgs, nil
+}
+
 func (bc *Context) VerifyLockfileConsistency(ctx context.Context, lockConfig *lock.Config) error {
 	log := clog.FromContext(ctx)
 	if lockConfig == nil {
@@ -318,6 +373,21 @@ func (bc *Context) BuildPackageList(ctx context.Context) (toInstall []*apk.Repos
 	return toInstall, conflicts, err
 }
 
+// Why resolves the packages of the image, and explains why the package named
+// name is one of them, with a chain of dependencies from each world package
+// that pulls it in.
+func (bc *Context) Why(ctx context.Context, name string) ([]apk.WhyChain, error) {
+	toInstall, _, err := bc.BuildPackageList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	world, err := bc.apk.GetWorld()
+	if err != nil {
+		return nil, fmt.Errorf("reading world: %w", err)
+	}
+	return apk.Why(world, toInstall, name)
+}
+
 func (bc *Context) Resolve(ctx context.Context) ([]*apk.APKResolved, error) {
 	return bc.apk.ResolveAndCalculateWorld(ctx)
 }
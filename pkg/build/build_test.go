@@ -18,10 +18,20 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
-
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/apk/auth"
@@ -96,6 +106,32 @@ func TestBuildLayerWithLayeringStrategy(t *testing.T) {
 	require.Contains(t, err.Error(), "cannot use BuildLayer with a layering strategy")
 }
 
+func TestBuildLayersChecksRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	for _, config := range []string{"layering.yaml", "empty-layering.yaml"} {
+		t.Run(config, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", config))
+			require.NoError(t, err)
+
+			// The entrypoint of the test configurations is not installed.
+			bc, err := build.New(ctx, fs.NewMemFS(), build.WithConfig(config, []string{"testdata"}), build.WithValidateRuntime(true))
+			require.NoError(t, err)
+			_, err = bc.BuildLayers(ctx)
+			require.ErrorContains(t, err, "validating the image runtime: entrypoint: /bin/sh")
+
+			// Nor is the shell that runs shell fragments.
+			shell := filepath.Join(t.TempDir(), config)
+			b = []byte(strings.Replace(string(b), "command: /bin/sh -l", "shell-fragment: echo hi\n  shell: /bin/zsh", 1))
+			require.NoError(t, os.WriteFile(shell, b, 0o644))
+			bc, err = build.New(ctx, fs.NewMemFS(), build.WithConfig(shell, []string{"testdata"}))
+			require.NoError(t, err)
+			_, err = bc.BuildLayers(ctx)
+			require.ErrorContains(t, err, "entrypoint shell is not installed: /bin/zsh")
+		})
+	}
+}
+
 func TestBuildImage(t *testing.T) {
 	ctx := context.Background()
 
@@ -243,3 +279,140 @@ func TestAuth_bad(t *testing.T) {
 	require.Error(t, err, "build should have failed to init keyring")
 	require.True(t, called)
 }
+
+func TestImageLayoutToStreamedLayer(t *testing.T) {
+	ctx := context.Background()
+
+	bc, err := build.New(ctx, fs.NewMemFS(), build.WithConfig("apko.yaml", []string{"testdata"}), build.WithTempDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, bc.BuildImage(ctx))
+
+	_, want, err := bc.ImageLayoutToLayer(ctx)
+	require.NoError(t, err)
+	got, err := bc.ImageLayoutToStreamedLayer(ctx)
+	require.NoError(t, err)
+
+	for _, f := range []func(v1.Layer) (v1.Hash, error){v1.Layer.Digest, v1.Layer.DiffID} {
+		wantHash, err := f(want)
+		require.NoError(t, err)
+		gotHash, err := f(got)
+		require.NoError(t, err)
+		require.Equal(t, wantHash, gotHash)
+	}
+	mt, err := got.MediaType()
+	require.NoError(t, err)
+	require.Equal(t, v1types.OCILayer, mt)
+}
+
+func TestBuildDatePackages(t *testing.T) {
+	ctx := context.Background()
+	// Before the build time of any package.
+	t.Setenv("SOURCE_DATE_EPOCH", "-1")
+
+	for _, tc := range []struct {
+		buildDate string
+		packages  bool
+	}{
+		{buildDate: ""},
+		{buildDate: build.BuildDatePackages, packages: true},
+	} {
+		bc, err := build.New(ctx, fs.NewMemFS(), build.WithConfig("apko.yaml", []string{"testdata"}), build.WithBuildDate(tc.buildDate))
+		require.NoError(t, err)
+		require.NoError(t, bc.BuildImage(ctx))
+
+		want := time.Unix(-1, 0).UTC()
+		if tc.packages {
+			want = time.Unix(0, 0).UTC()
+			installed, err := bc.InstalledPackages()
+			require.NoError(t, err)
+			for _, pkg := range installed {
+				if pkg.BuildTime.After(want) {
+					want = pkg.BuildTime
+				}
+			}
+		}
+		got, err := bc.GetBuildDateEpoch()
+		require.NoError(t, err)
+		require.True(t, want.Equal(got), "build date %q: want %s, got %s", tc.buildDate, want, got)
+	}
+}
+
+func TestWithKeyringDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a.rsa.pub", "b.rsa.pub", "README"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("key"), 0o644))
+	}
+
+	want := []string{"extra.rsa.pub", filepath.Join(dir, "a.rsa.pub"), filepath.Join(dir, "b.rsa.pub")}
+	for _, opts := range [][]build.Option{
+		{build.WithExtraKeys([]string{"extra.rsa.pub"}), build.WithKeyringDir(dir)},
+		{build.WithKeyringDir(dir), build.WithExtraKeys([]string{"extra.rsa.pub"})},
+	} {
+		o, _, err := build.NewOptions(ctx, opts...)
+		require.NoError(t, err)
+		require.Equal(t, want, o.ExtraKeyFiles)
+	}
+
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  keyring:\n    - extra.rsa.pub\n  keyring-dir: "+dir+"\n"), 0o644))
+	_, ic, err := build.NewOptions(ctx, build.WithConfig(config, nil))
+	require.NoError(t, err)
+	require.Equal(t, want, ic.Contents.Keyring)
+	require.Empty(t, ic.Contents.KeyringDir)
+
+	_, _, err = build.NewOptions(ctx, build.WithKeyringDir(t.TempDir()))
+	require.ErrorContains(t, err, "no keys")
+}
+
+func TestWithConfigVariablesOrder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := filepath.Join(dir, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  packages:\n    - foo=${VERSION}\n"), 0o644))
+	vars := &types.Variables{Values: map[string]string{"VERSION": "1.2.3"}}
+
+	for _, opts := range [][]build.Option{
+		{build.WithConfigVariables(vars), build.WithConfig(config, nil), build.WithAnnotations(map[string]string{"a": "b"})},
+		{build.WithAnnotations(map[string]string{"a": "b"}), build.WithConfig(config, nil), build.WithConfigVariables(vars)},
+	} {
+		_, ic, err := build.NewOptions(ctx, opts...)
+		require.NoError(t, err)
+		require.Equal(t, []string{"foo=1.2.3"}, ic.Contents.Packages)
+		require.Equal(t, map[string]string{"a": "b"}, ic.Annotations)
+	}
+}
+
+type recordingKeychain struct{ registries []string }
+
+func (k *recordingKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	k.registries = append(k.registries, r.RegistryStr())
+	return authn.Anonymous, nil
+}
+
+func TestLoadBaseImage(t *testing.T) {
+	ctx := context.Background()
+	withBase := func(image string) build.Option {
+		return build.WithImageConfiguration(types.ImageConfiguration{
+			Contents: types.ImageContents{BaseImage: &types.BaseImageDescriptor{Image: image}},
+		})
+	}
+
+	// A mistyped path is not pulled from a registry.
+	for _, image := range []string{"./missing", "../missing/layout", "/missing/layout", "base.tar"} {
+		_, err := build.New(ctx, fs.NewMemFS(), withBase(image))
+		require.ErrorContains(t, err, "baseImage path "+image, image)
+	}
+
+	// Images in a registry are pulled with the keychain of the build.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ref, err := name.NewTag(u.Host + "/base:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, empty.Image))
+	kc := &recordingKeychain{}
+	_, _ = build.New(ctx, fs.NewMemFS(), withBase(ref.String()), build.WithKeychain(kc))
+	require.Contains(t, kc.registries, u.Host)
+}
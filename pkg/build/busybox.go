@@ -53,8 +53,7 @@ var busyboxLinks map[string][]string
 
 func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) error {
 	// does busybox exist? if not, do not bother with symlinks
-	busyboxInfo, err := fsys.Stat(busybox)
-	if err != nil {
+	if _, err := fsys.Stat(busybox); err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
@@ -104,40 +103,5 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 		}
 	}
 
-	for _, link := range links {
-		if link == busybox || link == "" {
-			continue
-		}
-
-		dir := filepath.Dir(link)
-		if dir == "." {
-			continue
-		}
-
-		if err := fsys.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("creating directory %s: %w", dir, err)
-		}
-		if err := fsys.Chtimes(dir, busyboxInfo.ModTime(), busyboxInfo.ModTime()); err != nil {
-			return fmt.Errorf("error chtimes on %s: %w", dir, err)
-		}
-
-		if err := fsys.Symlink(busybox, link); err != nil {
-			// sometimes the list generates links twice, so do not error on that
-			if errors.Is(err, os.ErrExist) {
-				// ignore if it already is a symlink, in line with what `busybox --install -s`` does
-				if _, err := fsys.Readlink(link); err == nil {
-					continue
-				}
-				// ignore if it already is a regular file
-				if err != nil {
-					fi, err := fsys.Stat(link)
-					if err == nil && fi.Mode().IsRegular() {
-						continue
-					}
-				}
-			}
-			return fmt.Errorf("creating busybox link %s: %w", link, err)
-		}
-	}
-	return nil
+	return installLinks(fsys, busybox, links)
 }
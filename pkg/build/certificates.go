@@ -17,8 +17,11 @@ package build
 import (
 	"bytes"
 	"context"
+	"crypto/sha1" //nolint:gosec // OpenSSL names the links with SHA-1.
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
@@ -27,14 +30,21 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf16"
 
 	"github.com/pavlo-v-chernykh/keystore-go/v4"
 	"go.opentelemetry.io/otel"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
 const (
 	// Directory for individual certificate files (used by update-ca-certificates).
 	caCertsDir = "usr/local/share/ca-certificates"
+
+	// Directory in which OpenSSL looks certificates up by the hash of their subject.
+	caHashDir = "etc/ssl/certs"
 )
 
 var (
@@ -111,8 +121,20 @@ func (bc *Context) installCertificates(ctx context.Context) error {
 		return fmt.Errorf("failed to load Java truststores: %w", err)
 	}
 
+	if err := bc.fs.MkdirAll(caHashDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", caHashDir, err)
+	}
+
 	for _, additional := range bc.ic.Certificates.Additional {
-		cert, err := parseCertificates(additional.Content)
+		content := additional.Content
+		if additional.Path != "" {
+			b, err := os.ReadFile(additional.Path)
+			if err != nil {
+				return fmt.Errorf("failed to read certificate %s: %w", additional.Name, err)
+			}
+			content = string(b)
+		}
+		cert, err := parseCertificates(content)
 		if err != nil {
 			return fmt.Errorf("failed to parse certificate %s: %w", additional.Name, err)
 		}
@@ -128,6 +150,11 @@ func (bc *Context) installCertificates(ctx context.Context) error {
 			return fmt.Errorf("failed to change times on certificate file %s: %w", certPath, err)
 		}
 
+		// Link the certificate file from the hash of its subject, as c_rehash does.
+		if err := linkCertificateHash(bc.fs, cert, certPath); err != nil {
+			return err
+		}
+
 		// Append to all existing CA bundles.
 		for _, bundle := range existingBundles {
 			if _, err := bundle.Write(cert.pem); err != nil {
@@ -213,6 +240,117 @@ func (bc *Context) loadJavaTruststores() ([]loadedTruststore, error) {
 	return truststores, nil
 }
 
+// linkCertificateHash creates a symlink to the certificate file at certPath
+// named after the subject hash of cert, with the first suffix not taken by
+// another certificate with the same hash.
+func linkCertificateHash(fsys apkfs.FullFS, cert *parsedCertificate, certPath string) error {
+	hash, err := subjectHash(cert.structured)
+	if err != nil {
+		return fmt.Errorf("failed to hash subject of certificate %s: %w", certPath, err)
+	}
+	for i := 0; ; i++ {
+		link := filepath.Join(caHashDir, fmt.Sprintf("%s.%d", hash, i))
+		if err := fsys.Symlink("/"+certPath, link); errors.Is(err, fs.ErrExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to link %s to certificate file %s: %w", link, certPath, err)
+		}
+		return nil
+	}
+}
+
+// subjectHash returns the hash of the subject of cert as OpenSSL computes it
+// to look certificates up in a directory: the first four bytes, little
+// endian, of the SHA-1 of the subject in canonical form, in which string
+// values are UTF-8, lower case and with collapsed whitespace.
+func subjectHash(cert *x509.Certificate) (string, error) {
+	var rdns []asn1.RawValue
+	if rest, err := asn1.Unmarshal(cert.RawSubject, &rdns); err != nil {
+		return "", err
+	} else if len(rest) != 0 {
+		return "", fmt.Errorf("trailing data after subject")
+	}
+
+	type attribute struct {
+		Type  asn1.ObjectIdentifier
+		Value asn1.RawValue
+	}
+	h := sha1.New() //nolint:gosec // OpenSSL names the links with SHA-1.
+	for _, rdn := range rdns {
+		var attrs []attribute
+		if _, err := asn1.UnmarshalWithParams(rdn.FullBytes, &attrs, "set"); err != nil {
+			return "", err
+		}
+		for i, a := range attrs {
+			value, ok := canonicalString(a.Value)
+			if !ok {
+				continue
+			}
+			attrs[i].Value = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: value}
+		}
+		b, err := asn1.MarshalWithParams(attrs, "set")
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	sum := h.Sum(nil)
+	return fmt.Sprintf("%08x", binary.LittleEndian.Uint32(sum[:4])), nil
+}
+
+// canonicalString returns the canonical form of an ASN.1 string value, or
+// false when v is not a string.
+func canonicalString(v asn1.RawValue) ([]byte, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return nil, false
+	}
+	var s string
+	switch v.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String:
+		s = string(v.Bytes)
+	case asn1.TagT61String:
+		// Latin-1, as OpenSSL reads it.
+		r := make([]rune, len(v.Bytes))
+		for i, b := range v.Bytes {
+			r[i] = rune(b)
+		}
+		s = string(r)
+	case asn1.TagBMPString:
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[2*i:])
+		}
+		s = string(utf16.Decode(u))
+	case 28: // UniversalString
+		r := make([]rune, len(v.Bytes)/4)
+		for i := range r {
+			r[i] = rune(binary.BigEndian.Uint32(v.Bytes[4*i:]))
+		}
+		s = string(r)
+	default:
+		return nil, false
+	}
+
+	// Only ASCII is lower cased and counts as whitespace.
+	var b []byte
+	space := false
+	for _, c := range []byte(strings.Trim(s, " \t\n\v\f\r")) {
+		switch {
+		case strings.IndexByte(" \t\n\v\f\r", c) >= 0:
+			space = true
+			continue
+		case space:
+			b = append(b, ' ')
+			space = false
+		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return b, true
+}
+
 // parseCertificates parses a string as a PEM-encoded certificate and returns
 // a parsedCertificate struct.
 func parseCertificates(pemData string) (*parsedCertificate, error) {
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -67,6 +68,8 @@ gN9WUwCbEMBy/YhBSrXycKA8crgGg3x1mIsopn88JKwmMBa68oS7EHM9w7C4y71M
 -----END CERTIFICATE-----
 `
 	testCertPEMFingerprint = "e70570a989f8565aabdf7cae27abd1621872d6a3f811e3fef27e3dba02912198"
+	// From openssl x509 -subject_hash
+	testCertPEMSubjectHash = "63bc25b1"
 
 	// From https://letsencrypt.org/certs/staging/letsencrypt-stg-root-x2.pem
 	testCertPEM2 = `-----BEGIN CERTIFICATE-----
@@ -86,6 +89,7 @@ vbtH7QiVzeKCOTQPINyRql6P
 -----END CERTIFICATE-----
 `
 	testCertPEM2Fingerprint = "9b2a339fe6a3e85585c4cd75536cb8c1cf7cd603b9a64bec2521858ae48da85d"
+	testCertPEM2SubjectHash = "b5023534"
 )
 
 func TestParseCertificates(t *testing.T) {
@@ -189,6 +193,7 @@ func TestInstallCertificates(t *testing.T) {
 		existingFiles: map[string][]byte{},
 		wantFiles: map[string][]byte{
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-%s.crt", testCertPEMFingerprint)): []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                              []byte(testCertPEM),
 		},
 	}, {
 		name: "multiple certificate entries only one existing bundle",
@@ -204,7 +209,9 @@ func TestInstallCertificates(t *testing.T) {
 		wantFiles: map[string][]byte{
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n" + testCertPEM2 + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-1-%s.crt", testCertPEMFingerprint)):  []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                                 []byte(testCertPEM),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-2-%s.crt", testCertPEM2Fingerprint)): []byte(testCertPEM2),
+			filepath.Join(caHashDir, testCertPEM2SubjectHash+".0"):                                []byte(testCertPEM2),
 		},
 	}, {
 		name: "multiple certificate entries with multiple existing bundles",
@@ -222,7 +229,9 @@ func TestInstallCertificates(t *testing.T) {
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n" + testCertPEM2 + "\n"),
 			caBundlePaths[1]: []byte("# Another CA Bundle\n" + testCertPEM + "\n" + testCertPEM2 + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-1-%s.crt", testCertPEMFingerprint)):  []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                                 []byte(testCertPEM),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-2-%s.crt", testCertPEM2Fingerprint)): []byte(testCertPEM2),
+			filepath.Join(caHashDir, testCertPEM2SubjectHash+".0"):                                []byte(testCertPEM2),
 		},
 	}, {
 		name: "multiple certificate entries with identical names",
@@ -238,7 +247,9 @@ func TestInstallCertificates(t *testing.T) {
 		wantFiles: map[string][]byte{
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n" + testCertPEM2 + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-%s.crt", testCertPEMFingerprint)):  []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                               []byte(testCertPEM),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-%s.crt", testCertPEM2Fingerprint)): []byte(testCertPEM2),
+			filepath.Join(caHashDir, testCertPEM2SubjectHash+".0"):                              []byte(testCertPEM2),
 		},
 	}, {
 		name: "certificate with additional metadata",
@@ -253,6 +264,7 @@ func TestInstallCertificates(t *testing.T) {
 		wantFiles: map[string][]byte{
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-%s.crt", testCertPEMFingerprint)): []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                              []byte(testCertPEM),
 		},
 	}, {
 		name: "certificate with existing Java truststore",
@@ -270,6 +282,7 @@ func TestInstallCertificates(t *testing.T) {
 		wantFiles: map[string][]byte{
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-%s.crt", testCertPEMFingerprint)): []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                              []byte(testCertPEM),
 			javaTruststorePaths[0]: createTruststore(map[string]string{
 				"existing":                            testCertPEM2,
 				"test-cert-" + testCertPEMFingerprint: testCertPEM,
@@ -292,7 +305,9 @@ func TestInstallCertificates(t *testing.T) {
 		wantFiles: map[string][]byte{
 			caBundlePaths[0]: []byte("# Existing CA Bundle\n" + testCertPEM + "\n" + testCertPEM2 + "\n"),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-1-%s.crt", testCertPEMFingerprint)):  []byte(testCertPEM),
+			filepath.Join(caHashDir, testCertPEMSubjectHash+".0"):                                 []byte(testCertPEM),
 			filepath.Join(caCertsDir, fmt.Sprintf("test-cert-2-%s.crt", testCertPEM2Fingerprint)): []byte(testCertPEM2),
+			filepath.Join(caHashDir, testCertPEM2SubjectHash+".0"):                                []byte(testCertPEM2),
 			javaTruststorePaths[0]: createTruststore(map[string]string{
 				"existing":                               testCertPEM2,
 				"test-cert-1-" + testCertPEMFingerprint:  testCertPEM,
@@ -374,3 +389,50 @@ func TestInstallCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestInstallCertificatesFromPath(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1337")
+	path := filepath.Join(t.TempDir(), "corp-ca.pem")
+	if err := os.WriteFile(path, []byte(testCertPEM), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := apkfs.NewMemFS()
+	// Another certificate with the same subject hash is linked already.
+	if err := fsys.MkdirAll(caHashDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Symlink("other.pem", filepath.Join(caHashDir, testCertPEMSubjectHash+".0")); err != nil {
+		t.Fatal(err)
+	}
+	bc := &Context{
+		o: options.Options{
+			SourceDateEpoch: time.Unix(1337, 0),
+		},
+		ic: types.ImageConfiguration{
+			Certificates: &types.ImageCertificates{
+				Additional: []types.AdditionalCertificateEntry{{Name: "corp-ca", Path: path}},
+			},
+		},
+		fs: fsys,
+	}
+	if err := bc.installCertificates(context.Background()); err != nil {
+		t.Fatalf("installCertificates() = %v", err)
+	}
+
+	certPath := filepath.Join(caCertsDir, fmt.Sprintf("corp-ca-%s.crt", testCertPEMFingerprint))
+	data, err := fsys.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("failed to read certificate file: %v", err)
+	}
+	if diff := cmp.Diff(testCertPEM, string(data)); diff != "" {
+		t.Errorf("certificate file mismatch (-want +got):\n%s", diff)
+	}
+	link, err := fsys.Readlink(filepath.Join(caHashDir, testCertPEMSubjectHash+".1"))
+	if err != nil {
+		t.Fatalf("failed to read hash link: %v", err)
+	}
+	if want := "/" + certPath; link != want {
+		t.Errorf("hash link points to %s, want %s", link, want)
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/disk"
+)
+
+const (
+	// DiskFormatRaw writes a disk image as is.
+	DiskFormatRaw = "raw"
+	// DiskFormatQcow2 writes a disk image in the qcow2 format of QEMU,
+	// with qemu-img.
+	DiskFormatQcow2 = "qcow2"
+)
+
+// DiskFormatOf returns the format of a disk image written to path, going by
+// its extension: qcow2 for .qcow2, and raw otherwise.
+func DiskFormatOf(path string) string {
+	if strings.HasSuffix(path, ".qcow2") {
+		return DiskFormatQcow2
+	}
+	return DiskFormatRaw
+}
+
+// efiArchs are the names UEFI gives architectures, in the file names of
+// bootloaders.
+var efiArchs = map[types.Architecture]string{
+	types.ParseArchitecture("amd64"):   "x64",
+	types.ParseArchitecture("arm64"):   "aa64",
+	types.ParseArchitecture("riscv64"): "riscv64",
+	types.ParseArchitecture("386"):     "ia32",
+}
+
+// BuildDisk builds the filesystem of the image, with the kernel and
+// bootloader of its disk configuration, and writes a disk image of it to
+// path, in format.
+func (bc *Context) BuildDisk(ctx context.Context, format, path string) error {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "BuildDisk")
+	defer span.End()
+
+	if format != DiskFormatRaw && format != DiskFormatQcow2 {
+		return fmt.Errorf("unknown disk format %q, must be one of %s or %s", format, DiskFormatRaw, DiskFormatQcow2)
+	}
+	cfg := types.ImageDisk{}
+	if bc.ic.Disk != nil {
+		cfg = *bc.ic.Disk
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Only the disk image gets the kernel and the bootloader.
+	bc.ic.Contents.Packages = append(bc.ic.Contents.Packages, cfg.Packages()...)
+	if err := bc.BuildImage(ctx); err != nil {
+		return err
+	}
+	if err := bc.postBuildSetApk(ctx); err != nil {
+		return err
+	}
+	if err := bc.checkPaths(ctx); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(bc.o.TempDir(), "disk-")
+	if err != nil {
+		return fmt.Errorf("creating disk working directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The GUIDs of the disk are the same for the same configuration.
+	seed, err := json.Marshal(bc.ic)
+	if err != nil {
+		return err
+	}
+	seed = append(seed, bc.Arch().String()...)
+
+	size, err := cfg.SizeBytes()
+	if err != nil {
+		return err
+	}
+	layout := cfg.Layout()
+	parts := make([]disk.Partition, len(layout))
+	for i, p := range layout {
+		parts[i] = disk.Partition{Name: p.Label, GUID: disk.NewGUID(seed, p.Label)}
+		if parts[i].Size, err = p.SizeBytes(); err != nil {
+			return err
+		}
+		switch p.Type {
+		case types.DiskPartitionEFI:
+			parts[i].Type = disk.TypeEFI
+		case types.DiskPartitionRoot:
+			parts[i].Type = disk.RootType(bc.Arch().String())
+			if parts[i].Size == 0 && size == 0 {
+				if parts[i].Size, err = bc.rootPartitionSize(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if size, err = disk.Layout(size, parts); err != nil {
+		return err
+	}
+
+	images := make([]string, len(parts))
+	for i, p := range layout {
+		images[i] = filepath.Join(tmp, fmt.Sprintf("partition-%d.img", i))
+		log.Infof("making %s partition %s of %d MiB", p.Type, p.Label, parts[i].Size>>20)
+		switch p.Type {
+		case types.DiskPartitionRoot:
+			err = bc.makeRootPartition(ctx, tmp, images[i], parts[i])
+		case types.DiskPartitionEFI:
+			root := slices.IndexFunc(layout, func(p types.DiskPartition) bool { return p.Type == types.DiskPartitionRoot })
+			err = bc.makeEFIPartition(ctx, cfg, tmp, images[i], parts[i], parts[root])
+		}
+		if err != nil {
+			return fmt.Errorf("making %s partition %s: %w", p.Type, p.Label, err)
+		}
+	}
+
+	raw := path
+	if format != DiskFormatRaw {
+		raw = filepath.Join(tmp, "disk.img")
+	}
+	if err := writeDisk(raw, size, disk.NewGUID(seed, ""), parts, images); err != nil {
+		return fmt.Errorf("writing disk image: %w", err)
+	}
+	if format == DiskFormatQcow2 {
+		if err := runDiskTool(ctx, nil, "qemu-img", "convert", "-f", "raw", "-O", "qcow2", raw, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rootPartitionSize returns the size of a root partition for the filesystem
+// that leaves room for ext4 and some to spare.
+func (bc *Context) rootPartitionSize() (int64, error) {
+	var total int64
+	if err := fs.WalkDir(bc.fs, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Every file takes at least a block.
+		total += max(fi.Size(), 4096)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return total*5/4 + 64<<20, nil
+}
+
+// makeRootPartition writes an ext4 filesystem of the image to img, the
+// content of partition p.
+func (bc *Context) makeRootPartition(ctx context.Context, tmp, img string, p disk.Partition) error {
+	root := filepath.Join(tmp, "rootfs")
+	if err := bc.extractRootFS(ctx, root); err != nil {
+		return err
+	}
+	if err := createSized(img, p.Size); err != nil {
+		return err
+	}
+	epoch, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return err
+	}
+	// e2fsprogs takes a fake time of 0 as the real time.
+	env := []string{"E2FSPROGS_FAKE_TIME=" + strconv.FormatInt(max(epoch.Unix(), 1), 10)}
+	uuid := p.GUID.String()
+	if err := runDiskTool(ctx, env, "mkfs.ext4", "-q", "-F", "-L", p.Name, "-U", uuid,
+		"-E", "hash_seed="+uuid+",root_owner=0:0", "-d", root, img); err != nil {
+		return err
+	}
+
+	// Extracting the filesystem without root loses owners and device files,
+	// so debugfs puts them back.
+	script, err := bc.debugfsScript(epoch)
+	if err != nil {
+		return err
+	}
+	scriptPath := filepath.Join(tmp, "debugfs")
+	if err := os.WriteFile(scriptPath, script, 0o644); err != nil {
+		return err
+	}
+	return runDiskTool(ctx, env, "debugfs", "-w", "-f", scriptPath, img)
+}
+
+// debugfsScript returns debugfs commands that set the owner and times of
+// every file of the filesystem, and create its device files. mkfs.ext4 takes
+// the change times of the extracted files, and symlinks keep the time they
+// were extracted at, so every time is set again for the disk to be
+// reproducible.
+func (bc *Context) debugfsScript(epoch time.Time) ([]byte, error) {
+	// Times are set last, as creating device files changes the times of
+	// their directories.
+	var b, times bytes.Buffer
+	asRoot := os.Geteuid() == 0
+	err := fs.WalkDir(bc.fs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := bc.fs.Lstat(p)
+		if err != nil {
+			return err
+		}
+		name := strconv.Quote(path.Join("/", p))
+		if hdr, ok := fi.Sys().(*tar.Header); ok && !asRoot {
+			// mknod creates its file in the working directory.
+			node := ""
+			switch hdr.Typeflag {
+			case tar.TypeChar:
+				node = fmt.Sprintf("c %d %d", hdr.Devmajor, hdr.Devminor)
+			case tar.TypeBlock:
+				node = fmt.Sprintf("b %d %d", hdr.Devmajor, hdr.Devminor)
+			case tar.TypeFifo:
+				node = "p"
+			}
+			if node != "" {
+				fmt.Fprintf(&b, "cd %s\nmknod %s %s\n", strconv.Quote(path.Join("/", path.Dir(p))), strconv.Quote(path.Base(p)), node)
+				fmt.Fprintf(&b, "sif %s mode 0%o\n", name, tarNodeType(hdr.Typeflag)|uint32(fi.Mode().Perm()))
+			}
+		}
+		if uid, gid, ok := fileOwner(fi); ok {
+			fmt.Fprintf(&b, "sif %s uid %d\nsif %s gid %d\n", name, uid, name, gid)
+		}
+		mtime := fi.ModTime().Unix()
+		fmt.Fprintf(&times, "sif %s atime @%d\nsif %s mtime @%d\n", name, mtime, name, mtime)
+		fmt.Fprintf(&times, "sif %s ctime @%d\nsif %s crtime @%d\n", name, epoch.Unix(), name, epoch.Unix())
+		return nil
+	})
+	b.Write(times.Bytes())
+	return b.Bytes(), err
+}
+
+// makeEFIPartition writes a FAT filesystem to img, the content of the EFI
+// system partition p, with the bootloader that boots the kernel from root.
+func (bc *Context) makeEFIPartition(ctx context.Context, cfg types.ImageDisk, tmp, img string, p, root disk.Partition) error {
+	log := clog.FromContext(ctx)
+
+	if err := createSized(img, p.Size); err != nil {
+		return err
+	}
+	volumeID := fmt.Sprintf("%08x", p.GUID.L)
+	if err := runDiskTool(ctx, nil, "mkfs.vfat", "-n", p.Name, "-i", volumeID, img); err != nil {
+		return err
+	}
+	if cfg.BootloaderOrDefault() != types.DiskBootloaderSystemdBoot {
+		return nil
+	}
+
+	efiArch, ok := efiArchs[bc.Arch()]
+	if !ok {
+		return fmt.Errorf("systemd-boot does not support %s", bc.Arch())
+	}
+	kernels, err := fs.Glob(bc.fs, "boot/vmlinu[xz]*")
+	if err != nil {
+		return err
+	}
+	if len(kernels) == 0 {
+		return fmt.Errorf("no kernel in /boot, set disk.kernel to the package of one")
+	}
+	if len(kernels) > 1 {
+		log.Warnf("booting %s of kernels %v", kernels[0], kernels)
+	}
+	initrds, err := fs.Glob(bc.fs, "boot/initr*")
+	if err != nil {
+		return err
+	}
+
+	options := "root=PARTUUID=" + root.GUID.String() + " rw"
+	if cfg.Cmdline != "" {
+		options += " " + cfg.Cmdline
+	}
+	title := "apko"
+	if r := bc.ic.OSRelease; r != nil && r.PrettyName != "" {
+		title = r.PrettyName
+	}
+	entry := fmt.Sprintf("title %s\nlinux /vmlinuz\n", title)
+	if len(initrds) != 0 {
+		entry += "initrd /initrd\n"
+	}
+	entry += "options " + options + "\n"
+
+	files := map[string]func() ([]byte, error){
+		"EFI/BOOT/BOOT" + strings.ToUpper(efiArch) + ".EFI": func() ([]byte, error) {
+			return bc.fs.ReadFile("usr/lib/systemd/boot/efi/systemd-boot" + efiArch + ".efi")
+		},
+		"vmlinuz":                  func() ([]byte, error) { return bc.fs.ReadFile(kernels[0]) },
+		"loader/loader.conf":       func() ([]byte, error) { return []byte("default apko.conf\ntimeout 0\n"), nil },
+		"loader/entries/apko.conf": func() ([]byte, error) { return []byte(entry), nil },
+	}
+	if len(initrds) != 0 {
+		files["initrd"] = func() ([]byte, error) { return bc.fs.ReadFile(initrds[0]) }
+	}
+
+	if err := runDiskTool(ctx, nil, "mmd", "-i", img, "::/EFI", "::/EFI/BOOT", "::/loader", "::/loader/entries"); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		b, err := files[name]()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		src := filepath.Join(tmp, "efi-"+strings.ReplaceAll(name, "/", "-"))
+		if err := os.WriteFile(src, b, 0o644); err != nil {
+			return err
+		}
+		if err := runDiskTool(ctx, nil, "mcopy", "-i", img, src, "::/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDisk writes a disk image of size bytes to path, with the partition
+// table of parts and the content of each from images.
+func writeDisk(path string, size int64, diskGUID disk.GUID, parts []disk.Partition, images []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	if err := disk.WriteTable(f, size, diskGUID, parts); err != nil {
+		return err
+	}
+	for i, p := range parts {
+		img, err := os.Open(images[i])
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.NewOffsetWriter(f, p.Offset), io.LimitReader(img, p.Size))
+		img.Close()
+		if err != nil {
+			return fmt.Errorf("writing partition %s: %w", p.Name, err)
+		}
+	}
+	return f.Close()
+}
+
+func createSized(path string, size int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runDiskTool runs a program that makes disk images, with env added to the
+// environment.
+func runDiskTool(ctx context.Context, env []string, name string, args ...string) error {
+	prog, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("building a disk image requires %s: %w", name, err)
+	}
+	cmd := exec.CommandContext(ctx, prog, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w: %s", name, err, strings.TrimSpace(out.String()))
+	}
+	clog.FromContext(ctx).Debugf("%s: %s", name, out.String())
+	return nil
+}
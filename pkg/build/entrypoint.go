@@ -0,0 +1,58 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// checkEntrypointShell checks that the shell that runs the shell fragment of
+// the entrypoint is installed. The default shell being missing is only
+// warned about, as images have been built without it.
+func (bc *Context) checkEntrypointShell(ctx context.Context) error {
+	if bc.ic.Entrypoint.ShellFragment == "" {
+		return nil
+	}
+	shell := bc.ic.Entrypoint.ShellOrDefault()
+	if err := checkExecutable(bc.fs, shell); err != nil {
+		if bc.ic.Entrypoint.Shell == "" {
+			clog.FromContext(ctx).Warnf("entrypoint shell is not installed: %v", err)
+			return nil
+		}
+		return fmt.Errorf("entrypoint shell is not installed: %w", err)
+	}
+	return nil
+}
+
+// checkExecutable checks that p, following symlinks, is an executable
+// regular file of fsys.
+func checkExecutable(fsys apkfs.FullFS, p string) error {
+	fi, err := fsys.Stat(p)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", p)
+	}
+	if fi.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s is not executable", p)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestCheckEntrypointShell(t *testing.T) {
+	ctx := context.Background()
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("/usr/bin", 0o755))
+	require.NoError(t, fsys.Symlink("usr/bin", "/bin"))
+	require.NoError(t, fsys.WriteFile("/usr/bin/bash", []byte("bash"), 0o755))
+	require.NoError(t, fsys.WriteFile("/usr/bin/dash", []byte("dash"), 0o644))
+
+	check := func(e types.ImageEntrypoint) error {
+		bc := &Context{fs: fsys, ic: types.ImageConfiguration{Entrypoint: e}}
+		return bc.checkEntrypointShell(ctx)
+	}
+	require.NoError(t, check(types.ImageEntrypoint{ShellFragment: "echo hi", Shell: "/bin/bash"}))
+	require.EqualError(t, check(types.ImageEntrypoint{ShellFragment: "echo hi", Shell: "/bin/dash"}),
+		"entrypoint shell is not installed: /bin/dash is not executable")
+	require.ErrorContains(t, check(types.ImageEntrypoint{ShellFragment: "echo hi", Shell: "/bin/zsh"}),
+		"entrypoint shell is not installed: /bin/zsh")
+	// The default shell is only warned about.
+	require.NoError(t, check(types.ImageEntrypoint{ShellFragment: "echo hi"}))
+	require.NoError(t, check(types.ImageEntrypoint{Command: "/bin/zsh"}))
+}
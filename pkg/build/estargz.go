@@ -0,0 +1,185 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	v1tar "github.com/google/go-containerregistry/pkg/v1/tarball"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// LayerFormatGzip compresses layers with gzip.
+	LayerFormatGzip = "gzip"
+	// LayerFormatEstargz compresses layers as eStargz, with a table of
+	// contents that lets the containerd stargz snapshotter pull files of the
+	// image lazily, as they are accessed. eStargz layers are valid gzip, so
+	// other runtimes pull them as usual.
+	LayerFormatEstargz = "estargz"
+)
+
+// formatLayer returns l compressed in the configured layer format.
+func (bc *Context) formatLayer(l v1.Layer) (v1.Layer, error) {
+	fl, ok := l.(*layer)
+	if !ok || bc.o.LayerFormat != LayerFormatEstargz {
+		return l, nil
+	}
+
+	in, err := os.Open(fl.uncompressed)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := estargz.Build(io.NewSectionReader(in, 0, stat.Size()),
+		estargz.WithCompression(estargzGzip{estargz.NewGzipCompressorWithLevel(gzip.BestSpeed), &estargz.GzipDecompressor{}}))
+	if err != nil {
+		return nil, fmt.Errorf("building estargz layer: %w", err)
+	}
+	defer blob.Close()
+
+	out, err := os.Create(fl.uncompressed + ".estargz")
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, blob); err != nil {
+		return nil, fmt.Errorf("writing estargz layer: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+
+	gl, err := v1tar.LayerFromFile(out.Name(), v1tar.WithMediaType(v1types.OCILayer))
+	if err != nil {
+		return nil, err
+	}
+	diffID, err := v1.NewHash(blob.DiffID().String())
+	if err != nil {
+		return nil, err
+	}
+	return &estargzLayer{Layer: gl, diffID: diffID, toc: blob.TOCDigest().String()}, nil
+}
+
+// estargzLayer is a gzip layer that records the digest of its eStargz table
+// of contents in its descriptor, where the snapshotter looks for it.
+type estargzLayer struct {
+	v1.Layer
+	diffID v1.Hash
+	toc    string
+}
+
+func (l *estargzLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *estargzLayer) Descriptor() (*v1.Descriptor, error) {
+	h, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.Size()
+	if err != nil {
+		return nil, err
+	}
+	mt, err := l.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Descriptor{
+		MediaType: mt,
+		Size:      size,
+		Digest:    h,
+		Annotations: map[string]string{
+			estargz.TOCJSONDigestAnnotation: l.toc,
+		},
+	}, nil
+}
+
+// estargzGzip is the gzip compression of eStargz, but writes the footer by
+// hand: estargz writes it with compress/gzip and relies on the exact bytes
+// an empty stream compresses to, which differ across Go versions.
+type estargzGzip struct {
+	*estargz.GzipCompressor
+	*estargz.GzipDecompressor
+}
+
+func (c estargzGzip) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz, err := c.Writer(w)
+	if err != nil {
+		return "", err
+	}
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     estargz.TOCTarName,
+		Size:     int64(len(tocJSON)),
+	}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if _, err := w.Write(estargzFooter(off)); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+// estargzFooter returns the eStargz footer pointing at the table of contents
+// at off: an empty gzip member whose extra field holds the offset.
+func estargzFooter(off int64) []byte {
+	subfield := fmt.Sprintf("%016xSTARGZ", off)
+	extra := binary.LittleEndian.AppendUint16([]byte{'S', 'G'}, uint16(len(subfield))) //nolint:gosec // 22 bytes
+	extra = append(extra, subfield...)
+
+	// ID1, ID2, CM=deflate, FLG=FEXTRA, MTIME, XFL, OS=unknown.
+	b := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(extra))) //nolint:gosec // 26 bytes
+	b = append(b, extra...)
+	// An empty final stored block, then the CRC-32 and size of no data.
+	b = append(b, 1, 0, 0, 0xff, 0xff)
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+	return b
+}
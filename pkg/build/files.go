@@ -0,0 +1,102 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// copyFiles copies the files and directories of the build machine listed in
+// files into fsys, with their modification times set to mtime.
+func copyFiles(fsys apkfs.FullFS, files []types.ImageFile, mtime time.Time) error {
+	for _, f := range files {
+		if err := copyFile(fsys, f, mtime); err != nil {
+			return fmt.Errorf("copying %s to %s: %w", f.Source, f.Destination, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(fsys apkfs.FullFS, f types.ImageFile, mtime time.Time) error {
+	return filepath.WalkDir(f.Source, func(src string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(f.Source, src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(f.Destination, rel)
+		fi, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+		mode := fi.Mode().Perm()
+		if f.Permissions != 0 && !fi.IsDir() {
+			mode = fs.FileMode(f.Permissions)
+		}
+
+		if err := fsys.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			if err := fsys.MkdirAll(dst, mode); err != nil {
+				return err
+			}
+			if err := fsys.Chmod(dst, mode); err != nil {
+				return err
+			}
+		case fi.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			if _, err := fsys.Lstat(dst); err == nil {
+				if err := fsys.Remove(dst); err != nil {
+					return err
+				}
+			}
+			// The ownership and times of symlinks would be those of their
+			// targets.
+			return fsys.Symlink(target, dst)
+		case fi.Mode().IsRegular():
+			b, err := os.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			if err := fsys.WriteFile(dst, b, mode); err != nil {
+				return err
+			}
+			if err := fsys.Chmod(dst, mode); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s is not a regular file, directory or symlink", src)
+		}
+
+		if err := fsys.Chown(dst, int(f.UID), int(f.GID)); err != nil {
+			return err
+		}
+		return fsys.Chtimes(dst, mtime, mtime)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestCopyFiles(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "app.conf"), []byte("listen = 8080\n"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "static", "css"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "static", "index.html"), []byte("<html>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "static", "css", "site.css"), []byte("body {}"), 0o644))
+	require.NoError(t, os.Symlink("index.html", filepath.Join(src, "static", "home.html")))
+
+	fsys := tarfs.New()
+	mtime := time.Unix(1700000000, 0).UTC()
+	require.NoError(t, copyFiles(fsys, []types.ImageFile{{
+		Source:      filepath.Join(src, "app.conf"),
+		Destination: "/etc/app/app.conf",
+		UID:         1000,
+		GID:         1000,
+		Permissions: 0o640,
+	}, {
+		Source:      filepath.Join(src, "static"),
+		Destination: "/srv/www",
+	}}, mtime))
+
+	for path, want := range map[string]struct {
+		content  string
+		mode     fs.FileMode
+		uid, gid int
+	}{
+		"etc/app/app.conf":     {"listen = 8080\n", 0o640, 1000, 1000},
+		"srv/www/index.html":   {"<html>", 0o644, 0, 0},
+		"srv/www/css/site.css": {"body {}", 0o644, 0, 0},
+	} {
+		b, err := fsys.ReadFile(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want.content, string(b), path)
+		fi, err := fsys.Stat(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want.mode, fi.Mode(), path)
+		require.True(t, mtime.Equal(fi.ModTime()), path)
+		uid, gid, ok := fileOwner(fi)
+		require.True(t, ok, path)
+		require.Equal(t, want.uid, uid, path)
+		require.Equal(t, want.gid, gid, path)
+	}
+
+	fi, err := fsys.Stat("srv/www/css")
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	require.True(t, mtime.Equal(fi.ModTime()))
+
+	link, err := fsys.Readlink("srv/www/home.html")
+	require.NoError(t, err)
+	require.Equal(t, "index.html", link)
+
+	require.ErrorContains(t, copyFiles(fsys, []types.ImageFile{{Source: filepath.Join(src, "missing"), Destination: "/missing"}}, mtime), "copying "+filepath.Join(src, "missing")+" to /missing")
+}
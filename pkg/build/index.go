@@ -0,0 +1,250 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/chainguard-dev/clog"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/policy"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+// BuildIndex builds the image of the configuration opts set up for archs, or
+// else the architectures of the configuration or all of them, and returns
+// its index and SBOMs. The components of the image are written in workDir:
+// each layer is a separate file, as are config, manifests, index and SBOMs.
+//
+// This is the entrypoint for embedding apko as a library: everything about
+// the build is configured by opts, and the index can then be published with
+// an oci.Publisher.
+func BuildIndex(ctx context.Context, workDir string, archs []types.Architecture, opts ...Option) (v1.ImageIndex, []types.SBOM, error) {
+	idx, sboms, _, err := BuildIndexWithInputs(ctx, workDir, archs, opts...)
+	return idx, sboms, err
+}
+
+// Inputs are what an image was built from.
+type Inputs struct {
+	// Config is the configuration the image was built from, with the
+	// architectures it was built for.
+	Config types.ImageConfiguration
+	// Lock is the content of the lockfile the image was built with, if any.
+	Lock []byte
+}
+
+// BuildIndexWithInputs is BuildIndex, that also returns the inputs the image
+// was built from, so that they can be published along with it.
+func BuildIndexWithInputs(ctx context.Context, workDir string, archs []types.Architecture, opts ...Option) (idx v1.ImageIndex, sboms []types.SBOM, in *Inputs, err error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "BuildIndex")
+	defer span.End()
+
+	o, ic, err := NewOptions(ctx, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
+		return nil, nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
+	}
+	var lock []byte
+	if o.Lockfile != "" {
+		if lock, err = os.ReadFile(o.Lockfile); err != nil {
+			return nil, nil, nil, fmt.Errorf("reading lockfile: %w", err)
+		}
+	}
+
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	// save the final set we will build
+	log.Debugf("Building images for %d architectures: %+v", len(ic.Archs), ic.Archs)
+
+	// Probe the VCS URL if it is not set and we are asked to do so.
+	if o.WithVCS && ic.VCSUrl == "" {
+		ic.ProbeVCSUrl(ctx, o.ImageConfigFile)
+	}
+
+	// The build context options is sometimes copied in the next functions. Ensure
+	// we have the directory defined and created by invoking the function early.
+
+	// workDir, passed to us, is where we will lay out the various image filesystems
+	// under it we will have:
+	//  <arch>/ - the rootfs for each architecture
+	//  image/ - the summary layer files and sboms for each architecture
+	// imageDir, created here, is where the final artifacts will be: layer tars, indexes, etc.
+
+	log.Debugf("building tags %v", o.Tags)
+
+	// The first architecture that fails cancels the others.
+	errg, archCtx := errgroup.WithContext(ctx)
+	if o.Jobs > 0 {
+		errg.SetLimit(o.Jobs)
+	}
+	imageDir := filepath.Join(workDir, "image")
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
+	}
+	opts = append(opts, WithSBOM(imageDir))
+
+	imgs := map[types.Architecture]v1.Image{}
+	pkgs := map[string][]policy.Package{}
+
+	mtx := sync.Mutex{}
+
+	// We compute the "build date epoch" of the multi-arch image to be the
+	// maximum "build date epoch" of the per-arch images.  If the user has
+	// explicitly set SOURCE_DATE_EPOCH, that will always trump this
+	// computation.
+	multiArchBDE := o.SourceDateEpoch
+
+	configs, _, err := LockImageConfiguration(ctx, *ic, opts...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("locking config: %w", err)
+	}
+
+	for arch, ic := range configs {
+		errg.Go(func() error {
+			if arch == "index" {
+				return nil
+			}
+
+			arch := types.ParseArchitecture(arch)
+			log := log.With("arch", arch.ToAPK())
+			ctx := clog.WithLogger(archCtx, log)
+
+			opts := slices.Clone(opts)
+			opts = append(opts, WithArch(arch), WithImageConfiguration(*ic))
+
+			bc, err := New(ctx, tarfs.New(), opts...)
+			if err != nil {
+				return fmt.Errorf("new build for arch %s: %w", arch, err)
+			}
+			layers, err := bc.BuildLayers(ctx)
+			if err != nil {
+				return fmt.Errorf("building %q layer: %w", arch, err)
+			}
+
+			// Compute the "build date epoch" from the packages that were
+			// installed.  The "build date epoch" is the MAX of the builddate
+			// embedded in the installed APKs.  If SOURCE_DATE_EPOCH is
+			// explicitly set by the user, that trumps this.
+			// This computation will only affect the timestamp of the image
+			// itself and its SBOMs, since the timestamps on files come from the
+			// APKs.
+			bde, err := bc.GetBuildDateEpoch()
+			if err != nil {
+				return fmt.Errorf("failed to determine build date epoch: %w", err)
+			}
+
+			builder, err := oci.NewBuilder(oci.WithBaseImage(bc.BaseImage()), oci.WithCreated(bde), oci.WithArch(bc.Arch()))
+			if err != nil {
+				return err
+			}
+			img, err := builder.Image(ctx, bc.ImageConfiguration(), layers...)
+			if err != nil {
+				return fmt.Errorf("failed to build OCI image for %q: %w", arch, err)
+			}
+			if err := bc.checkSize(img); err != nil {
+				return fmt.Errorf("image for %q: %w", arch, err)
+			}
+
+			var outputs []types.SBOM
+			if len(o.SBOMGenerators) != 0 {
+				outputs, err = bc.GenerateImageSBOM(ctx, arch, img)
+				if err != nil {
+					return fmt.Errorf("generating sbom for %s: %w", arch, err)
+				}
+			}
+			var installed []policy.Package
+			if len(o.Policies) != 0 {
+				if installed, err = bc.policyPackages(); err != nil {
+					return fmt.Errorf("image for %q: %w", arch, err)
+				}
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			imgs[arch] = img
+			if len(o.Policies) != 0 {
+				pkgs[arch.ToAPK()] = installed
+			}
+
+			if bde.After(multiArchBDE) {
+				multiArchBDE = bde
+			}
+
+			if len(o.SBOMGenerators) != 0 {
+				sboms = append(sboms, outputs...)
+			}
+
+			return nil
+		})
+	}
+	if err := errg.Wait(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(o.Policies) != 0 {
+		if err := checkPolicies(ctx, o, *ic, pkgs, sboms); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// generate the index
+	finalDigest, idx, err := oci.GenerateIndex(ctx, *ic, imgs, multiArchBDE)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
+	}
+
+	o.SBOMPath = imageDir
+	o.SourceDateEpoch = multiArchBDE // Maximum child's time.
+
+	if _, err := WriteIndex(ctx, o, idx); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
+	}
+
+	// the sboms are saved to the same working directory as the image components
+	if len(o.SBOMGenerators) != 0 {
+		files, err := GenerateIndexSBOM(ctx, *o, *ic, finalDigest, imgs)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("generating index SBOM: %w", err)
+		}
+		sboms = append(sboms, files...)
+	}
+
+	return idx, sboms, &Inputs{Config: *ic, Lock: lock}, nil
+}
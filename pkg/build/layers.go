@@ -69,6 +69,10 @@ func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
 		return nil, err
 	}
 
+	if err := bc.checkPaths(ctx); err != nil {
+		return nil, err
+	}
+
 	// Use our layering strategy to partition packages into a set of Budget groups.
 	groups, err := groupByOriginAndSize(pkgs, bc.ic.Layering.Budget)
 	if err != nil {
@@ -85,7 +89,17 @@ func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
 	}
 
 	// Then partition that single fs.FS into multiple layers based on our layering strategy.
-	return splitLayers(ctx, bc.fs, groups, pkgToDiff, bc.o.TempDir())
+	layers, err := splitLayers(ctx, bc.fs, groups, pkgToDiff, bc.o.TempDir())
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range layers {
+		if layers[i], err = bc.formatLayer(l); err != nil {
+			return nil, err
+		}
+		bc.emitLayerBuilt(ctx, layers[i])
+	}
+	return layers, nil
 }
 
 func replacesGroup(rep string, g *group) (bool, error) {
@@ -0,0 +1,107 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// installConfiguredLinks creates the links of the multiplexer binaries
+// configured in links that are installed: those listed by the manifest of
+// each installed package, then those listed in the configuration.
+func installConfiguredLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage, links []types.Links) error {
+	for _, l := range links {
+		if _, err := fsys.Stat(l.Binary); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+
+		var paths []string
+		if l.Manifests != "" {
+			for _, pkg := range installed {
+				b, err := fsys.ReadFile(filepath.Join(l.Manifests, pkg.Name))
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				} else if err != nil {
+					return fmt.Errorf("reading links of %s to %s: %w", pkg.Name, l.Binary, err)
+				}
+				for _, line := range strings.Split(string(b), "\n") {
+					paths = append(paths, strings.TrimSpace(line))
+				}
+			}
+		}
+		paths = append(paths, l.Paths...)
+
+		if err := installLinks(fsys, l.Binary, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installLinks creates a symlink to binary at each of links, along with the
+// directories they are in, skipping the ones that already exist as a symlink
+// or regular file, in line with what `busybox --install -s` does.
+func installLinks(fsys apkfs.FullFS, binary string, links []string) error {
+	info, err := fsys.Stat(binary)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if link == binary || link == "" {
+			continue
+		}
+
+		dir := filepath.Dir(link)
+		if dir == "." {
+			continue
+		}
+
+		if err := fsys.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating directory %s: %w", dir, err)
+		}
+		if err := fsys.Chtimes(dir, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("error chtimes on %s: %w", dir, err)
+		}
+
+		if err := fsys.Symlink(binary, link); err != nil {
+			// sometimes the list generates links twice, so do not error on that
+			if errors.Is(err, os.ErrExist) {
+				// ignore if it already is a symlink
+				if _, err := fsys.Readlink(link); err == nil {
+					continue
+				}
+				// ignore if it already is a regular file
+				fi, err := fsys.Stat(link)
+				if err == nil && fi.Mode().IsRegular() {
+					continue
+				}
+			}
+			return fmt.Errorf("creating link %s to %s: %w", link, binary, err)
+		}
+	}
+	return nil
+}
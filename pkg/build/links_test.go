@@ -0,0 +1,67 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestInstallConfiguredLinks(t *testing.T) {
+	installed := []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "toybox"}},
+		{Package: apk.Package{Name: "toybox-extras"}},
+	}
+	links := []types.Links{{
+		Binary:    "/usr/bin/toybox",
+		Manifests: "/etc/toybox-paths.d",
+		Paths:     []string{"/usr/bin/cat"},
+	}, {
+		// Not installed, so nothing links to it.
+		Binary: "/usr/bin/coreutils",
+		Paths:  []string{"/usr/bin/ls"},
+	}}
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("/usr/bin", 0755))
+	require.NoError(t, fsys.MkdirAll("/etc/toybox-paths.d", 0755))
+	require.NoError(t, fsys.WriteFile("/usr/bin/toybox", []byte("toybox"), 0755))
+	require.NoError(t, fsys.WriteFile("/usr/bin/sed", []byte("gnu sed"), 0755))
+	require.NoError(t, fsys.WriteFile("/etc/toybox-paths.d/toybox", []byte("/bin/sh\n/usr/bin/sed\n"), 0644))
+	require.NoError(t, fsys.WriteFile("/etc/toybox-paths.d/toybox-extras", []byte("/usr/sbin/ifconfig"), 0644))
+	// Not installed, so not read.
+	require.NoError(t, fsys.WriteFile("/etc/toybox-paths.d/other", []byte("/usr/bin/other"), 0644))
+
+	require.NoError(t, installConfiguredLinks(fsys, installed, links))
+
+	for _, link := range []string{"/bin/sh", "/usr/sbin/ifconfig", "/usr/bin/cat"} {
+		target, err := fsys.Readlink(link)
+		require.NoError(t, err, link)
+		require.Equal(t, "/usr/bin/toybox", target, link)
+	}
+	// Files that exist already are kept.
+	b, err := fsys.ReadFile("/usr/bin/sed")
+	require.NoError(t, err)
+	require.Equal(t, "gnu sed", string(b))
+	for _, link := range []string{"/usr/bin/other", "/usr/bin/ls"} {
+		_, err := fsys.Lstat(link)
+		require.Error(t, err, link)
+	}
+}
@@ -35,7 +35,7 @@ import (
 // architecture that could not be locked. Using the "index" architecture is equivalent to what
 // this used to return prior to supporting per-arch locked configs.
 func LockImageConfiguration(ctx context.Context, ic types.ImageConfiguration, opts ...Option) (map[string]*types.ImageConfiguration, map[string][]string, error) {
-	o, input, err := NewOptions(append(opts, WithImageConfiguration(ic))...)
+	o, input, err := NewOptions(ctx, append(opts, WithImageConfiguration(ic))...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -79,9 +79,14 @@ func LockImageConfiguration(ctx context.Context, ic types.ImageConfiguration, op
 	ics := make(map[string]*types.ImageConfiguration, len(mc.Contexts)+1)
 	// Set the locked package lists.
 	for arch, pl := range pls {
-		// Create a defensive copy of "input".
-		copied := types.ImageConfiguration{}
-		if err := input.MergeInto(&copied); err != nil {
+		// Create a defensive copy of "input", with the overrides applied for
+		// single-arch configs.
+		copied := &types.ImageConfiguration{}
+		if arch == "index" {
+			if err := input.MergeInto(copied); err != nil {
+				return nil, nil, err
+			}
+		} else if copied, err = input.ForArch(types.ParseArchitecture(arch)); err != nil {
 			return nil, nil, err
 		}
 
@@ -92,7 +97,7 @@ func LockImageConfiguration(ctx context.Context, ic types.ImageConfiguration, op
 			copied.Archs = []types.Architecture{types.ParseArchitecture(arch)}
 		}
 
-		ics[arch] = &copied
+		ics[arch] = copied
 	}
 
 	return ics, missing, nil
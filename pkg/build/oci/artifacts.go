@@ -0,0 +1,146 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
+)
+
+const (
+	// BuildInputsArtifactType is the artifact type of the manifest holding
+	// the apko configuration and lockfile an image was built from.
+	BuildInputsArtifactType = "application/vnd.dev.chainguard.apko.build-inputs.v1"
+
+	// ConfigMediaType is the media type of the apko configuration blob.
+	ConfigMediaType = ggcrtypes.MediaType(types.ConfigMediaType)
+
+	// LockMediaType is the media type of the apko lockfile blob.
+	LockMediaType ggcrtypes.MediaType = "application/vnd.dev.chainguard.apko.lock.v1+json"
+)
+
+// BuildInputsArtifact assembles an OCI artifact containing the given apko
+// configuration and, if non-empty, the lockfile it was resolved with.
+// When subject is non-nil the artifact refers to it, which makes it
+// discoverable through the referrers API of the registry.
+func BuildInputsArtifact(config, lock []byte, subject *v1.Descriptor) (v1.Image, error) {
+	adds := []mutate.Addendum{{
+		Layer:     static.NewLayer(config, ConfigMediaType),
+		MediaType: ConfigMediaType,
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": "apko.yaml",
+		},
+	}}
+	if len(lock) != 0 {
+		adds = append(adds, mutate.Addendum{
+			Layer:     static.NewLayer(lock, LockMediaType),
+			MediaType: LockMediaType,
+			Annotations: map[string]string{
+				"org.opencontainers.image.title": "apko.lock.json",
+			},
+		})
+	}
+
+	img, err := mutate.Append(mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1), adds...)
+	if err != nil {
+		return nil, fmt.Errorf("appending build inputs: %w", err)
+	}
+	img = mutate.ConfigMediaType(img, BuildInputsArtifactType)
+
+	if subject != nil {
+		img = mutate.Subject(img, *subject).(v1.Image)
+	}
+	return img, nil
+}
+
+// PublishBuildInputs pushes the configuration and lockfile an index was built
+// from to the registry.
+//
+// If ref is nil, the artifact is pushed by digest into repo with the index as
+// its subject, so it travels with the image as a referrer. Otherwise it is
+// pushed as a standalone artifact to ref.
+func PublishBuildInputs(ctx context.Context, idx v1.ImageIndex, config, lock []byte, repo name.Repository, ref name.Reference, remoteOpts ...remote.Option) (name.Digest, error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "PublishBuildInputs")
+	defer span.End()
+	remoteOpts = withContext(ctx, remoteOpts)
+
+	var subject *v1.Descriptor
+	if ref == nil {
+		desc, err := indexDescriptor(idx)
+		if err != nil {
+			return name.Digest{}, err
+		}
+		subject = desc
+	}
+
+	art, err := BuildInputsArtifact(config, lock, subject)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	h, err := art.Digest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("computing build inputs digest: %w", err)
+	}
+
+	if ref == nil {
+		ref = repo.Digest(h.String())
+	}
+	log.Infof("publishing build inputs to %s", ref)
+	if err := remote.Write(ref, art, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("writing build inputs: %w", err)
+	}
+	events.Emit(ctx, events.Event{
+		Type:      events.ArtifactPublished,
+		Reference: ref.String(),
+		Digest:    h.String(),
+	})
+
+	return ref.Context().Digest(h.String()), nil
+}
+
+func indexDescriptor(idx v1.ImageIndex) (*v1.Descriptor, error) {
+	h, err := idx.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("getting index digest: %w", err)
+	}
+	size, err := idx.Size()
+	if err != nil {
+		return nil, fmt.Errorf("getting index size: %w", err)
+	}
+	mt, err := idx.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("getting index media type: %w", err)
+	}
+	return &v1.Descriptor{
+		MediaType: mt,
+		Digest:    h,
+		Size:      size,
+	}, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Builder builds images from layers and an image configuration, and the
+// indexes of those images.
+type Builder struct {
+	baseImage v1.Image
+	created   time.Time
+	arch      types.Architecture
+}
+
+// BuilderOption is an option for NewBuilder.
+type BuilderOption func(*Builder) error
+
+// WithBaseImage sets the image whose layers the images built are on top of.
+func WithBaseImage(img v1.Image) BuilderOption {
+	return func(b *Builder) error {
+		b.baseImage = img
+		return nil
+	}
+}
+
+// WithCreated sets the creation time of what is built.
+func WithCreated(created time.Time) BuilderOption {
+	return func(b *Builder) error {
+		b.created = created
+		return nil
+	}
+}
+
+// WithArch sets the architecture of the images built.
+func WithArch(arch types.Architecture) BuilderOption {
+	return func(b *Builder) error {
+		b.arch = arch
+		return nil
+	}
+}
+
+// NewBuilder returns a Builder configured by opts.
+func NewBuilder(opts ...BuilderOption) (*Builder, error) {
+	b := &Builder{}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Image builds the image of ic from layers, as BuildImageFromLayers does. The
+// builder must have an architecture.
+func (b *Builder) Image(ctx context.Context, ic types.ImageConfiguration, layers ...v1.Layer) (v1.Image, error) {
+	if b.arch == "" {
+		return nil, errors.New("no architecture to build the image for")
+	}
+	return BuildImageFromLayers(ctx, b.baseImage, layers, ic, b.created, b.arch)
+}
+
+// Index builds the index of the images of ic, by architecture, as
+// GenerateIndex does.
+func (b *Builder) Index(ctx context.Context, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image) (name.Digest, v1.ImageIndex, error) {
+	return GenerateIndex(ctx, ic, imgs, b.created)
+}
@@ -29,14 +29,39 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	v1tar "github.com/google/go-containerregistry/pkg/v1/tarball"
 	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
-	"github.com/google/shlex"
 
 	"github.com/chainguard-dev/clog"
 
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/options"
 )
 
+// baseEnvironment is set in every image unless disabled with
+// base-environment: false; the configured environment takes precedence.
+var baseEnvironment = map[string]string{
+	"PATH":          "/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+	"SSL_CERT_FILE": "/etc/ssl/certs/ca-certificates.crt",
+}
+
+// Environment returns the environment of an image of ic: its configured
+// environment, over the base environment unless that is disabled.
+func Environment(ic *types.ImageConfiguration) map[string]string {
+	env := maps.Clone(ic.Environment)
+	if env == nil {
+		env = map[string]string{}
+	}
+	// Set the base environment variables if they are not already set.
+	if ic.BaseEnvironment == nil || *ic.BaseEnvironment {
+		for k, v := range baseEnvironment {
+			if _, found := env[k]; !found {
+				env[k] = v
+			}
+		}
+	}
+	return env
+}
+
 func BuildImageFromLayer(ctx context.Context, baseImage v1.Image, layer v1.Layer, oic types.ImageConfiguration, created time.Time, arch types.Architecture) (v1.Image, error) {
 	return BuildImageFromLayers(ctx, baseImage, []v1.Layer{layer}, oic, created, arch)
 }
@@ -73,6 +98,7 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 			return nil, fmt.Errorf("could not calculate layer diff id: %w", err)
 		}
 
+		log := log.With("digest", digest.String())
 		log.Infof("layer digest: %v", digest)
 		log.Infof("layer diffID: %v", diffid)
 
@@ -100,6 +126,11 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 	if annotations == nil {
 		annotations = map[string]string{}
 	}
+	for k, v := range ic.OSRelease.Annotations() {
+		if _, ok := annotations[k]; !ok {
+			annotations[k] = v
+		}
+	}
 	if ic.VCSUrl != "" {
 		if url, hash, ok := strings.Cut(ic.VCSUrl, "@"); ok {
 			annotations["org.opencontainers.image.source"] = url
@@ -108,6 +139,14 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 	}
 	annotations["org.opencontainers.image.created"] = created.Format(time.RFC3339)
 
+	if ic.Wasm != nil {
+		img, err := buildWasmArtifact(layers, ic, annotations, created, arch)
+		if err != nil {
+			return nil, err
+		}
+		return img, emitDigest(ctx, img, arch)
+	}
+
 	v1Image = mutate.Annotations(v1Image, annotations).(v1.Image)
 
 	cfg, err := v1Image.ConfigFile()
@@ -117,28 +156,36 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 
 	cfg = cfg.DeepCopy()
 	cfg.Author = "github.com/chainguard-dev/apko"
-	platform := arch.ToOCIPlatform()
+	platform := ic.Platform(arch)
 	cfg.Architecture = platform.Architecture
 	cfg.Variant = platform.Variant
 	cfg.Created = v1.Time{Time: created}
+	cfg.OS = platform.OS
+	cfg.OSVersion = platform.OSVersion
+	cfg.OSFeatures = platform.OSFeatures
 	cfg.Config.Labels = make(map[string]string)
-	cfg.OS = "linux"
-	cfg.Config.Labels = annotations
+	if ic.AnnotationLabels == nil || *ic.AnnotationLabels {
+		maps.Copy(cfg.Config.Labels, annotations)
+	}
+	maps.Copy(cfg.Config.Labels, ic.Labels)
 
 	// NOTE: Need to allow empty Entrypoints. The runtime will override to `/bin/sh -c` and handle quoting
 	switch {
 	case ic.Entrypoint.ShellFragment != "":
-		cfg.Config.Entrypoint = []string{"/bin/sh", "-c", ic.Entrypoint.ShellFragment}
-	case ic.Entrypoint.Command != "":
-		splitcmd, err := shlex.Split(ic.Entrypoint.Command)
+		cfg.Config.Entrypoint = []string{ic.Entrypoint.ShellOrDefault(), "-c", ic.Entrypoint.ShellFragment}
+	case ic.Entrypoint.Command != "" || len(ic.Entrypoint.CommandArgs) != 0:
+		splitcmd, err := ic.Entrypoint.CommandArgv()
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse entrypoint command: %w", err)
 		}
 		cfg.Config.Entrypoint = splitcmd
 	}
+	if initArgs := ic.Entrypoint.Init(); len(initArgs) != 0 {
+		cfg.Config.Entrypoint = append(initArgs, cfg.Config.Entrypoint...)
+	}
 
-	if ic.Cmd != "" {
-		splitcmd, err := shlex.Split(ic.Cmd)
+	if ic.Cmd != "" || len(ic.CmdArgs) != 0 {
+		splitcmd, err := ic.CmdArgv()
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse cmd: %w", err)
 		}
@@ -156,19 +203,18 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 		}
 	}
 
-	env := maps.Clone(ic.Environment)
-	// Set these environment variables if they are not already set.
-	if env == nil {
-		env = map[string]string{}
-	}
-	for k, v := range map[string]string{
-		"PATH":          "/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
-		"SSL_CERT_FILE": "/etc/ssl/certs/ca-certificates.crt",
-	} {
-		if _, found := env[k]; !found {
-			env[k] = v
+	if len(ic.Ports) != 0 {
+		cfg.Config.ExposedPorts = make(map[string]struct{}, len(ic.Ports))
+		for _, p := range ic.Ports {
+			port, err := types.ParsePort(p)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Config.ExposedPorts[port] = struct{}{}
 		}
 	}
+
+	env := Environment(ic)
 	envs := []string{}
 	for k, v := range env {
 		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
@@ -184,12 +230,37 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 		cfg.Config.StopSignal = ic.StopSignal
 	}
 
+	if ic.Healthcheck != nil {
+		hc, err := ic.Healthcheck.Config()
+		if err != nil {
+			return nil, err
+		}
+		// The OCI image config has no healthcheck; only runtimes reading the
+		// Docker fields of the config, such as Docker and Podman, honor it.
+		log.Warnf("setting healthcheck in an OCI image config, which only Docker-compatible runtimes honor")
+		cfg.Config.Healthcheck = hc
+	}
+
 	img, err := mutate.ConfigFile(v1Image, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to update oci config file: %w", err)
 	}
 
-	return img, nil
+	return img, emitDigest(ctx, img, arch)
+}
+
+// emitDigest emits the digest of img, built for arch, when something listens
+// to build events.
+func emitDigest(ctx context.Context, img v1.Image, arch types.Architecture) error {
+	if events.FromContext(ctx) == nil {
+		return nil
+	}
+	h, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("computing image digest: %w", err)
+	}
+	events.Emit(ctx, events.Event{Type: events.DigestComputed, Arch: arch.ToAPK(), Digest: h.String()})
+	return nil
 }
 
 func BuildImageTarballFromLayer(ctx context.Context, imageRef string, layer v1.Layer, outputTarGZ string, ic types.ImageConfiguration, opts options.Options) error {
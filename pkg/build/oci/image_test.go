@@ -35,6 +35,7 @@ func TestBuildImageFromLayer(t *testing.T) {
 	require.NoError(t, err)
 	now := time.Now()
 	v1now := v1.Time{Time: now}
+	yes, no := true, false
 
 	for _, c := range []struct {
 		desc string
@@ -155,6 +156,243 @@ func TestBuildImageFromLayer(t *testing.T) {
 				},
 			},
 		},
+	}, {
+		desc: "no base env",
+		cfg: types.ImageConfiguration{
+			Environment: map[string]string{
+				"FOO":  "bar",
+				"PATH": "/bin",
+			},
+			BaseEnvironment: &no,
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"FOO=bar",
+					"PATH=/bin",
+				},
+				Labels: map[string]string{
+					"org.opencontainers.image.created": now.Format(time.RFC3339),
+				},
+			},
+		},
+	}, {
+		desc: "explicit base env",
+		cfg: types.ImageConfiguration{
+			Environment:     map[string]string{},
+			BaseEnvironment: &yes,
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				Labels: map[string]string{
+					"org.opencontainers.image.created": now.Format(time.RFC3339),
+				},
+			},
+		},
+	}, {
+		desc: "ports, labels and stop signal",
+		cfg: types.ImageConfiguration{
+			Ports:      []string{"8080", "53/UDP"},
+			StopSignal: "SIGQUIT",
+			Volumes:    []string{"/data"},
+			Labels: map[string]string{
+				"maintainer":                     "someone",
+				"org.opencontainers.image.title": "label",
+			},
+			Annotations: map[string]string{
+				"org.opencontainers.image.title": "annotation",
+			},
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				ExposedPorts: map[string]struct{}{
+					"8080/tcp": {},
+					"53/udp":   {},
+				},
+				Volumes: map[string]struct{}{
+					"/data": {},
+				},
+				StopSignal: "SIGQUIT",
+				Labels: map[string]string{
+					"maintainer":                       "someone",
+					"org.opencontainers.image.title":   "label",
+					"org.opencontainers.image.created": now.Format(time.RFC3339),
+				},
+			},
+		},
+	}, {
+		desc: "labels without annotations",
+		cfg: types.ImageConfiguration{
+			Labels: map[string]string{
+				"maintainer": "someone",
+			},
+			Annotations: map[string]string{
+				"org.opencontainers.image.title": "annotation",
+			},
+			AnnotationLabels: &no,
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				Labels: map[string]string{
+					"maintainer": "someone",
+				},
+			},
+		},
+	}, {
+		desc: "os-release",
+		cfg: types.ImageConfiguration{
+			OSRelease: &types.ImageOSRelease{
+				ID:        "acme",
+				VersionID: "2025.1",
+			},
+			Annotations: map[string]string{
+				"dev.chainguard.apko.os-release.version-id": "2025.1.3",
+			},
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				Labels: map[string]string{
+					"dev.chainguard.apko.os-release.id":         "acme",
+					"dev.chainguard.apko.os-release.version-id": "2025.1.3",
+					"org.opencontainers.image.created":          now.Format(time.RFC3339),
+				},
+			},
+		},
+	}, {
+		desc: "entrypoint under tini",
+		cfg: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{
+				Type:    "tini",
+				Command: "/usr/bin/app --port 8080",
+			},
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Entrypoint: []string{"/sbin/tini", "--", "/usr/bin/app", "--port", "8080"},
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				Labels: map[string]string{
+					"org.opencontainers.image.created": now.Format(time.RFC3339),
+				},
+			},
+		},
+	}, {
+		desc: "healthcheck",
+		cfg: types.ImageConfiguration{
+			Healthcheck: &types.ImageHealthcheck{
+				Test:        []string{"CMD", "/usr/bin/healthcheck"},
+				Interval:    "30s",
+				Timeout:     "5s",
+				StartPeriod: "1m",
+				Retries:     3,
+			},
+		},
+		want: &v1.ConfigFile{
+			Author: "github.com/chainguard-dev/apko",
+			History: []v1.History{{
+				Created:   v1now,
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   "This is an apko single-layer image",
+			}},
+			Created: v1now,
+			OS:      "linux",
+			RootFS:  v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{diffID}},
+			Config: v1.Config{
+				Env: []string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+					"SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+				},
+				Healthcheck: &v1.HealthConfig{
+					Test:        []string{"CMD", "/usr/bin/healthcheck"},
+					Interval:    30 * time.Second,
+					Timeout:     5 * time.Second,
+					StartPeriod: time.Minute,
+					Retries:     3,
+				},
+				Labels: map[string]string{
+					"org.opencontainers.image.created": now.Format(time.RFC3339),
+				},
+			},
+		},
 	}} {
 		t.Run(c.desc, func(t *testing.T) {
 			ctx := context.Background()
@@ -169,3 +407,34 @@ func TestBuildImageFromLayer(t *testing.T) {
 		})
 	}
 }
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+	layer := static.NewLayer([]byte("hello"), ggcrtypes.OCILayer)
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	ic := types.ImageConfiguration{Cmd: "serve"}
+
+	b, err := NewBuilder(WithCreated(created))
+	require.NoError(t, err)
+	_, err = b.Image(ctx, ic, layer)
+	require.ErrorContains(t, err, "no architecture")
+
+	b, err = NewBuilder(WithBaseImage(empty.Image), WithCreated(created), WithArch(types.ParseArchitecture("arm64")))
+	require.NoError(t, err)
+	img, err := b.Image(ctx, ic, layer)
+	require.NoError(t, err)
+	want, err := BuildImageFromLayers(ctx, empty.Image, []v1.Layer{layer}, ic, created, types.ParseArchitecture("arm64"))
+	require.NoError(t, err)
+	got, err := img.Digest()
+	require.NoError(t, err)
+	wantDigest, err := want.Digest()
+	require.NoError(t, err)
+	require.Equal(t, wantDigest, got)
+
+	_, idx, err := b.Index(ctx, ic, map[types.Architecture]v1.Image{types.ParseArchitecture("arm64"): img})
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 1)
+	require.Equal(t, got, im.Manifests[0].Digest)
+}
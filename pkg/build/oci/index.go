@@ -35,6 +35,7 @@ import (
 	"go.opentelemetry.io/otel"
 
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 )
 
 // GenerateIndex generates an OCI image index from the given imgs. The index type
@@ -44,14 +45,22 @@ func GenerateIndex(ctx context.Context, ic types.ImageConfiguration, imgs map[ty
 	_, span := otel.Tracer("apko").Start(ctx, "GenerateIndex")
 	defer span.End()
 
-	return generateIndexWithMediaType(ggcrtypes.OCIImageIndex, ic, imgs, created)
+	dig, idx, err := generateIndexWithMediaType(ggcrtypes.OCIImageIndex, ic, imgs, created)
+	if err == nil {
+		events.Emit(ctx, events.Event{Type: events.DigestComputed, Digest: dig.DigestStr()})
+	}
+	return dig, idx, err
 }
 
 // GenerateDockerIndex generates a docker multi-arch manifest from the given imgs. The index type
 // will be "application/vnd.docker.distribution.manifest.list.v2+json".
 // The index is stored in memory.
 func GenerateDockerIndex(ctx context.Context, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, created time.Time) (name.Digest, v1.ImageIndex, error) {
-	return generateIndexWithMediaType(ggcrtypes.DockerManifestList, ic, imgs, created)
+	dig, idx, err := generateIndexWithMediaType(ggcrtypes.DockerManifestList, ic, imgs, created)
+	if err == nil {
+		events.Emit(ctx, events.Event{Type: events.DigestComputed, Digest: dig.DigestStr()})
+	}
+	return dig, idx, err
 }
 
 // generateIndexWithMediaType generates an index or docker manifest list from the given imgs. The index type
@@ -61,6 +70,11 @@ func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageCon
 	annCopy := make(map[string]string, len(ic.Annotations))
 	if mediaType == ggcrtypes.OCIImageIndex {
 		maps.Copy(annCopy, ic.Annotations)
+		for k, v := range ic.OSRelease.Annotations() {
+			if _, ok := annCopy[k]; !ok {
+				annCopy[k] = v
+			}
+		}
 		if ic.VCSUrl != "" {
 			if url, hash, ok := strings.Cut(ic.VCSUrl, "@"); ok {
 				annCopy["org.opencontainers.image.source"] = url
@@ -97,13 +111,22 @@ func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageCon
 			return name.Digest{}, nil, fmt.Errorf("failed to compute size: %w", err)
 		}
 
+		// Describe the platform the image was built for, which carries the
+		// configured operating system, falling back to that of arch.
+		platform := arch.ToOCIPlatform()
+		if cf, err := img.ConfigFile(); err != nil {
+			return name.Digest{}, nil, fmt.Errorf("failed to get config file: %w", err)
+		} else if p := cf.Platform(); p != nil && p.Architecture != "" {
+			platform = p
+		}
+
 		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
 			Add: img,
 			Descriptor: v1.Descriptor{
 				MediaType: mt,
 				Digest:    h,
 				Size:      size,
-				Platform:  arch.ToOCIPlatform(),
+				Platform:  platform,
 			},
 		})
 	}
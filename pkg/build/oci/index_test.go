@@ -14,10 +14,67 @@
 
 package oci
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
 
 func TestGenerateIndex(t *testing.T) {
+	ctx := context.Background()
+	layer := static.NewLayer([]byte("hello"), ggcrtypes.OCILayer)
+	now := time.Now()
+
+	ic := types.ImageConfiguration{
+		OS: &types.ImageOS{
+			Name:     "windows",
+			Version:  "10.0.17763.1040",
+			Features: []string{"win32k"},
+		},
+	}
+	imgs := map[types.Architecture]v1.Image{}
+	for _, arch := range types.ParseArchitectures([]string{"amd64", "arm/v7"}) {
+		img, err := BuildImageFromLayer(ctx, empty.Image, layer, ic, now, arch)
+		require.NoError(t, err)
+		imgs[arch] = img
+	}
+
+	_, idx, err := GenerateIndex(ctx, ic, imgs, now)
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 2)
+
+	var platforms []v1.Platform
+	for _, m := range im.Manifests {
+		platforms = append(platforms, *m.Platform)
+	}
+	require.Equal(t, []v1.Platform{{
+		Architecture: "amd64",
+		OS:           "windows",
+		OSVersion:    "10.0.17763.1040",
+		OSFeatures:   []string{"win32k"},
+	}, {
+		Architecture: "arm",
+		Variant:      "v7",
+		OS:           "windows",
+		OSVersion:    "10.0.17763.1040",
+		OSFeatures:   []string{"win32k"},
+	}}, platforms)
 
+	cfg, err := imgs[types.ParseArchitecture("amd64")].ConfigFile()
+	require.NoError(t, err)
+	require.Equal(t, "windows", cfg.OS)
+	require.Equal(t, "10.0.17763.1040", cfg.OSVersion)
+	require.Equal(t, []string{"win32k"}, cfg.OSFeatures)
 }
 
 func TestGenerateDockerIndex(t *testing.T) {
@@ -0,0 +1,66 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// installedDBPaths are where images may have their database of installed
+// packages, by preference.
+var installedDBPaths = []string{"usr/lib/apk/db/installed", "lib/apk/db/installed"}
+
+// InstalledPackages returns the packages of the database of installed
+// packages of img, if it has one.
+func InstalledPackages(img v1.Image) ([]*apk.InstalledPackage, error) {
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	found := map[string][]*apk.InstalledPackage{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || !slices.Contains(installedDBPaths, p) {
+			continue
+		}
+		if found[p], err = apk.ParseInstalled(tr); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+	}
+	for _, p := range installedDBPaths {
+		if installed, ok := found[p]; ok {
+			return installed, nil
+		}
+	}
+	return nil, nil
+}
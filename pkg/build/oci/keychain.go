@@ -0,0 +1,43 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// StaticKeychain returns a keychain that authenticates against each registry
+// in creds with its static credentials, and anonymously against any other.
+//
+// Combine it with other keychains through authn.NewMultiKeychain, and pass it
+// to the publish functions with remote.WithAuthFromKeychain.
+func StaticKeychain(creds map[string]authn.AuthConfig) authn.Keychain {
+	return staticKeychain(creds)
+}
+
+type staticKeychain map[string]authn.AuthConfig
+
+func (s staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	reg := target.RegistryStr()
+	cfg, ok := s[reg]
+	if !ok && reg == name.DefaultRegistry {
+		cfg, ok = s["docker.io"]
+	}
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(cfg), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// WriteLayout adds idx to the OCI image layout at dir, creating the layout if
+// it does not exist yet.
+//
+// The index is recorded once per tag with the tag as its
+// org.opencontainers.image.ref.name annotation, which is how tools like
+// skopeo (oci:<dir>:<tag>) and crane find it. Without tags it is recorded
+// once, unnamed.
+func WriteLayout(ctx context.Context, dir string, idx v1.ImageIndex, tags []string) error {
+	log := clog.FromContext(ctx)
+	_, span := otel.Tracer("apko").Start(ctx, "WriteLayout")
+	defer span.End()
+
+	p, err := layout.FromPath(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		p, err = layout.Write(dir, empty.Index)
+	}
+	if err != nil {
+		return fmt.Errorf("opening image layout %s: %w", dir, err)
+	}
+
+	if len(tags) == 0 {
+		if err := p.AppendIndex(idx); err != nil {
+			return fmt.Errorf("writing image layout: %w", err)
+		}
+		return nil
+	}
+	for _, t := range tags {
+		tag, err := name.NewTag(t)
+		if err != nil {
+			return fmt.Errorf("parsing tag %q: %w", t, err)
+		}
+		if err := p.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": tag.TagStr(),
+		})); err != nil {
+			return fmt.Errorf("writing image layout: %w", err)
+		}
+		log.Debugf("wrote %s to image layout %s", tag, dir)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/chainguard-dev/clog"
+)
+
+const (
+	// LocalDocker is the image store of the Docker daemon DOCKER_HOST, or
+	// else the current Docker context, points at.
+	LocalDocker = "docker"
+	// LocalPodman is the image store of Podman, reached through its API
+	// socket.
+	LocalPodman = "podman"
+	// LocalContainerd is a namespace of containerd's image store, which ctr
+	// imports into.
+	LocalContainerd = "containerd"
+
+	// DefaultContainerdNamespace is the namespace the kubelet pulls images
+	// from, so that kind and k3s nodes can run the loaded images.
+	DefaultContainerdNamespace = "k8s.io"
+)
+
+// LocalTarget is an image store on this host that images can be loaded into.
+type LocalTarget struct {
+	// Store is one of LocalDocker, LocalPodman or LocalContainerd. Empty
+	// means LocalDocker.
+	Store string
+	// Namespace is the containerd namespace to import into. Empty means
+	// DefaultContainerdNamespace.
+	Namespace string
+	// Host is the endpoint of the Docker daemon or Podman API, as a
+	// unix://, tcp:// or ssh:// URL or the path of a socket. Empty means
+	// DOCKER_HOST, or else the endpoint of the current Docker context, or
+	// CONTAINER_HOST for LocalPodman, or else their default sockets.
+	Host string
+	// APIVersion is the version of the Docker API to use. Empty means
+	// DOCKER_API_VERSION, or else the version the daemon and the client
+	// negotiate.
+	APIVersion string
+}
+
+// Validate checks that t is a store images can be loaded into.
+func (t LocalTarget) Validate() error {
+	switch t.Store {
+	case "", LocalDocker, LocalPodman:
+		if t.Namespace != "" {
+			return fmt.Errorf("a namespace can only be set for the %s store", LocalContainerd)
+		}
+	case LocalContainerd:
+		if t.Host != "" || t.APIVersion != "" {
+			return fmt.Errorf("a host or API version cannot be set for the %s store, which ctr imports into", LocalContainerd)
+		}
+	default:
+		return fmt.Errorf("unknown local image store %q, must be one of %s, %s or %s", t.Store, LocalDocker, LocalPodman, LocalContainerd)
+	}
+	return nil
+}
+
+// LoadIndexInto is LoadIndex for the image store of target.
+func LoadIndexInto(ctx context.Context, target LocalTarget, idx v1.ImageIndex, tags []string) (name.Reference, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	goos, goarch := localPlatform()
+	useManifest := localManifest(im, goos, goarch)
+	img, err := idx.Image(useManifest.Digest)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("reading child image %q", useManifest.Digest.String())
+	}
+
+	clog.FromContext(ctx).Infof("using best guess single-arch image for local tags (%s/%s)", goos, goarch)
+	return LoadImageInto(ctx, target, img, tags)
+}
+
+// LoadImageInto is LoadImage for the image store of target.
+func LoadImageInto(ctx context.Context, target LocalTarget, image v1.Image, tags []string) (name.Reference, error) {
+	if err := target.Validate(); err != nil {
+		return name.Digest{}, err
+	}
+	if target.Store == LocalContainerd {
+		ns := target.Namespace
+		if ns == "" {
+			ns = DefaultContainerdNamespace
+		}
+		return importContainerd(ctx, ns, image, tags)
+	}
+	c, err := target.client()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	defer c.Close()
+	return loadDaemon(ctx, c, image, tags)
+}
+
+// client returns a Docker API client for the Docker daemon or Podman API of
+// t.
+func (t LocalTarget) client() (*client.Client, error) {
+	if t.Store == LocalPodman {
+		return podmanClient(t.Host, t.APIVersion)
+	}
+	return dockerClient(t.Host, t.APIVersion)
+}
+
+// dockerClient returns a Docker API client for the daemon at host, or else
+// the one DOCKER_HOST points at, or else that of the current Docker context,
+// as the Docker CLI does, using apiVersion, or else DOCKER_API_VERSION, or
+// else the version they negotiate. The TLS settings of the environment apply
+// too, but not those of contexts.
+func dockerClient(host, apiVersion string) (*client.Client, error) {
+	if host == "" {
+		host = os.Getenv(client.EnvOverrideHost)
+	}
+	if host == "" {
+		var err error
+		if host, err = dockerContextHost(); err != nil {
+			return nil, fmt.Errorf("connecting to docker: %w", err)
+		}
+	}
+	c, err := newClient(host, apiVersion, client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to docker: %w", err)
+	}
+	return c, nil
+}
+
+// dockerContextHost returns the endpoint of the current Docker context:
+// DOCKER_CONTEXT, or else the currentContext of the docker config, such as
+// the one Colima or Docker Desktop switch to. It returns "" for the default
+// context, whose endpoint is the default socket.
+func dockerContextHost() (string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	current := os.Getenv("DOCKER_CONTEXT")
+	if current == "" {
+		b, err := os.ReadFile(filepath.Join(dir, "config.json"))
+		if os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		var cfg struct {
+			CurrentContext string `json:"currentContext"`
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return "", fmt.Errorf("parsing docker config: %w", err)
+		}
+		current = cfg.CurrentContext
+	}
+	if current == "" || current == "default" {
+		return "", nil
+	}
+
+	// The metadata of contexts is stored by the digest of their name.
+	h := sha256.Sum256([]byte(current))
+	b, err := os.ReadFile(filepath.Join(dir, "contexts", "meta", hex.EncodeToString(h[:]), "meta.json"))
+	if err != nil {
+		return "", fmt.Errorf("reading docker context %s: %w", current, err)
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host string `json:"Host"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return "", fmt.Errorf("parsing docker context %s: %w", current, err)
+	}
+	return meta.Endpoints["docker"].Host, nil
+}
+
+// podmanClient returns a Docker API client for the Podman API at host, or
+// else the socket that CONTAINER_HOST points at, or else the rootless socket
+// of the user if it exists, or else the system one, using apiVersion, or
+// else the version they negotiate.
+func podmanClient(host, apiVersion string) (*client.Client, error) {
+	if host == "" {
+		host = os.Getenv("CONTAINER_HOST")
+	}
+	if host == "" {
+		sock := "/run/podman/podman.sock"
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			if _, err := os.Stat(filepath.Join(dir, "podman", "podman.sock")); err == nil {
+				sock = filepath.Join(dir, "podman", "podman.sock")
+			}
+		}
+		host = "unix://" + sock
+	}
+	c, err := newClient(host, apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to podman at %s: %w", host, err)
+	}
+	return c, nil
+}
+
+// newClient returns a Docker API client, configured with opts, for the
+// daemon at host, if it is not empty. A path is that of a socket, and
+// ssh://[user@]host[:port] runs "docker system dial-stdio" on host over ssh,
+// as the Docker CLI does. With apiVersion, the client uses that version
+// rather than negotiate one.
+func newClient(host, apiVersion string, opts ...client.Opt) (*client.Client, error) {
+	if strings.HasPrefix(host, "/") {
+		host = "unix://" + host
+	}
+	switch {
+	case strings.HasPrefix(host, "ssh://"):
+		helper, err := connhelper.GetConnectionHelper(host)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: helper.Dialer}}),
+			client.WithHost(helper.Host),
+			client.WithDialContext(helper.Dialer))
+	case host != "":
+		opts = append(opts, client.WithHost(host))
+	}
+	if apiVersion != "" {
+		opts = append(opts, client.WithVersion(apiVersion))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// importContainerd streams image, tagged with tags, to ctr to import into
+// namespace ns of the containerd that CONTAINERD_ADDRESS points at.
+func importContainerd(ctx context.Context, ns string, image v1.Image, tags []string) (name.Reference, error) {
+	log := clog.FromContext(ctx)
+	hash, err := image.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	refs := map[name.Reference]v1.Image{}
+	var first name.Reference
+	for _, tag := range tags {
+		ref, err := name.NewTag(tag)
+		if err != nil {
+			return name.Digest{}, err
+		}
+		if first == nil {
+			first = ref
+		}
+		refs[ref] = image
+	}
+	if first == nil {
+		ref, err := name.NewTag(fmt.Sprintf("%s/%s:%s", LocalDomain, LocalRepo, hash.Hex))
+		if err != nil {
+			return name.Digest{}, err
+		}
+		first = ref
+		refs[ref] = image
+	}
+
+	ctr, err := exec.LookPath("ctr")
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("importing into containerd requires ctr: %w", err)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ctr, "--namespace", ns, "images", "import", "--digests", "-")
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	log.Infof("importing image %s into containerd namespace %s", hash, ns)
+	if err := cmd.Start(); err != nil {
+		return name.Digest{}, fmt.Errorf("running ctr: %w", err)
+	}
+	werr := tarball.MultiRefWrite(refs, stdin)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return name.Digest{}, fmt.Errorf("ctr images import: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if werr != nil {
+		return name.Digest{}, fmt.Errorf("writing image to ctr: %w", werr)
+	}
+	return first, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// LocalCacheLabel is the label of the images that loading into a Docker or
+// Podman image store writes to LocalDomain/LocalRepo, whose value is the
+// tags, comma-separated, they were loaded for. An image is superseded once
+// another image is loaded for the same tags.
+const LocalCacheLabel = "dev.chainguard.apko.local-cache"
+
+// localClient is the client of a Docker or Podman image store.
+type localClient interface {
+	daemon.Client
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageRemove(ctx context.Context, image string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+}
+
+// localCacheLabelValue returns the value of LocalCacheLabel for the images
+// loaded for tags.
+func localCacheLabelValue(tags []string) string {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return strings.Join(slices.Compact(tags), ",")
+}
+
+// withLocalCacheLabel returns img with LocalCacheLabel set for tags.
+func withLocalCacheLabel(img v1.Image, tags []string) (v1.Image, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfg := cf.Config.DeepCopy()
+	labels := map[string]string{}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	labels[LocalCacheLabel] = localCacheLabelValue(tags)
+	cfg.Labels = labels
+	return mutate.Config(img, *cfg)
+}
+
+// localCacheRefs returns the references of img, an image of a local image
+// store, in LocalDomain/LocalRepo.
+func localCacheRefs(img image.Summary) []string {
+	var refs []string
+	for _, tag := range img.RepoTags {
+		if strings.HasPrefix(tag, LocalDomain+"/"+LocalRepo+":") {
+			refs = append(refs, tag)
+		}
+	}
+	return refs
+}
+
+// listLocalCache returns the images of c with LocalCacheLabel, of value
+// value if it is not empty.
+func listLocalCache(ctx context.Context, c localClient, value string) ([]image.Summary, error) {
+	label := LocalCacheLabel
+	if value != "" {
+		label += "=" + value
+	}
+	imgs, err := c.ImageList(ctx, image.ListOptions{Filters: filters.NewArgs(filters.Arg("label", label))})
+	if err != nil {
+		return nil, fmt.Errorf("listing local images: %w", err)
+	}
+	return slices.DeleteFunc(imgs, func(img image.Summary) bool {
+		v, ok := img.Labels[LocalCacheLabel]
+		return !ok || (value != "" && v != value)
+	}), nil
+}
+
+// pruneLocalCache removes the references in LocalDomain/LocalRepo of the
+// images of c loaded for the same tags as the image of ID keep, which
+// supersedes them. Failures are only logged, since they leave nothing
+// worse than before.
+func pruneLocalCache(ctx context.Context, c localClient, tags []string, keep v1.Hash) {
+	log := clog.FromContext(ctx)
+	if len(tags) == 0 {
+		return
+	}
+	imgs, err := listLocalCache(ctx, c, localCacheLabelValue(tags))
+	if err != nil {
+		log.Warnf("not removing superseded local images: %v", err)
+		return
+	}
+	for _, img := range imgs {
+		if img.ID == keep.String() {
+			continue
+		}
+		for _, ref := range localCacheRefs(img) {
+			log.Infof("removing superseded local image %s", ref)
+			if _, err := c.ImageRemove(ctx, ref, image.RemoveOptions{PruneChildren: true}); err != nil {
+				log.Warnf("removing superseded local image %s: %v", ref, err)
+			}
+		}
+	}
+}
+
+// CleanLocalImages removes the references in LocalDomain/LocalRepo of every
+// image with LocalCacheLabel in the image store of target, which must be a
+// Docker or Podman one, and returns them. With dryRun, they are only
+// returned.
+func CleanLocalImages(ctx context.Context, target LocalTarget, dryRun bool) ([]string, error) {
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+	if target.Store == LocalContainerd {
+		return nil, fmt.Errorf("cleaning the %s image store is not supported", LocalContainerd)
+	}
+	c, err := target.client()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return cleanLocalImages(ctx, c, dryRun)
+}
+
+func cleanLocalImages(ctx context.Context, c localClient, dryRun bool) ([]string, error) {
+	log := clog.FromContext(ctx)
+	imgs, err := listLocalCache(ctx, c, "")
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, img := range imgs {
+		for _, ref := range localCacheRefs(img) {
+			if !dryRun {
+				log.Infof("removing local image %s", ref)
+				if _, err := c.ImageRemove(ctx, ref, image.RemoveOptions{PruneChildren: true}); err != nil {
+					return removed, fmt.Errorf("removing local image %s: %w", ref, err)
+				}
+			}
+			removed = append(removed, ref)
+		}
+	}
+	return removed, nil
+}
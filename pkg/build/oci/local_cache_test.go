@@ -0,0 +1,203 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore is an image store that keeps what is loaded into it in memory.
+type fakeStore struct {
+	images map[string]*image.Summary
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{images: map[string]*image.Summary{}}
+}
+
+func (s *fakeStore) lookup(ref string) *image.Summary {
+	if img, ok := s.images[ref]; ok {
+		return img
+	}
+	for _, img := range s.images {
+		if slices.Contains(img.RepoTags, ref) {
+			return img
+		}
+	}
+	return nil
+}
+
+// untag removes tag from every image but img, like loading or tagging an
+// image as an existing tag does.
+func (s *fakeStore) untag(tag string, img *image.Summary) {
+	for _, other := range s.images {
+		if other != img {
+			other.RepoTags = slices.DeleteFunc(other.RepoTags, func(t string) bool { return t == tag })
+		}
+	}
+}
+
+func (s *fakeStore) tags() []string {
+	var tags []string
+	for _, img := range s.images {
+		tags = append(tags, img.RepoTags...)
+	}
+	return tags
+}
+
+func (s *fakeStore) NegotiateAPIVersion(context.Context) {}
+
+func (s *fakeStore) ImageSave(context.Context, []string, ...client.ImageSaveOption) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeStore) ImageLoad(_ context.Context, r io.Reader, _ ...client.ImageLoadOption) (image.LoadResponse, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	opener := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(b)), nil }
+	img, err := tarball.Image(opener, nil)
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	id, err := img.ConfigName()
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	loaded := &image.Summary{ID: id.String(), Labels: cf.Config.Labels, RepoTags: m[0].RepoTags}
+	s.images[loaded.ID] = loaded
+	for _, tag := range loaded.RepoTags {
+		s.untag(tag, loaded)
+	}
+	return image.LoadResponse{Body: io.NopCloser(bytes.NewReader(nil))}, nil
+}
+
+func (s *fakeStore) ImageTag(_ context.Context, src, dst string) error {
+	img := s.lookup(src)
+	if img == nil {
+		return errors.New("no such image " + src)
+	}
+	s.untag(dst, img)
+	if !slices.Contains(img.RepoTags, dst) {
+		img.RepoTags = append(img.RepoTags, dst)
+	}
+	return nil
+}
+
+func (s *fakeStore) ImageInspectWithRaw(_ context.Context, ref string) (image.InspectResponse, []byte, error) {
+	img := s.lookup(ref)
+	if img == nil {
+		return image.InspectResponse{}, nil, errors.New("no such image " + ref)
+	}
+	return image.InspectResponse{ID: img.ID, RepoTags: img.RepoTags}, nil, nil
+}
+
+func (s *fakeStore) ImageHistory(context.Context, string, ...client.ImageHistoryOption) ([]image.HistoryResponseItem, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeStore) ImageList(context.Context, image.ListOptions) ([]image.Summary, error) {
+	var imgs []image.Summary
+	for _, img := range s.images {
+		imgs = append(imgs, *img)
+	}
+	return imgs, nil
+}
+
+func (s *fakeStore) ImageRemove(_ context.Context, ref string, _ image.RemoveOptions) ([]image.DeleteResponse, error) {
+	img := s.lookup(ref)
+	if img == nil {
+		return nil, errors.New("no such image " + ref)
+	}
+	img.RepoTags = slices.DeleteFunc(img.RepoTags, func(t string) bool { return t == ref })
+	if len(img.RepoTags) == 0 {
+		delete(s.images, img.ID)
+	}
+	return []image.DeleteResponse{{Untagged: ref}}, nil
+}
+
+func TestLoadDaemonPrunesSupersededImages(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStore()
+
+	load := func(tags ...string) string {
+		img, err := random.Image(1024, 1)
+		require.NoError(t, err)
+		ref, err := loadDaemon(ctx, s, img, tags)
+		require.NoError(t, err)
+		return ref.String()
+	}
+
+	first := load("example.com/app:dev")
+	other := load("example.com/other:dev")
+	require.ElementsMatch(t, []string{"example.com/app:dev", "example.com/other:dev", first, other}, s.tags())
+
+	// Loading app again supersedes its first image, but not the image of
+	// other.
+	second := load("example.com/app:dev")
+	require.ElementsMatch(t, []string{"example.com/app:dev", "example.com/other:dev", second, other}, s.tags())
+
+	// Images loaded with no tags are kept until cleaned.
+	untagged := load()
+	require.Contains(t, s.tags(), untagged)
+	untagged2 := load()
+	require.Contains(t, s.tags(), untagged)
+	require.Contains(t, s.tags(), untagged2)
+}
+
+func TestCleanLocalImages(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStore()
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := loadDaemon(ctx, s, img, []string{"example.com/app:dev"})
+	require.NoError(t, err)
+	// An image apko did not load is left alone, even in LocalDomain.
+	s.images["sha256:foreign"] = &image.Summary{ID: "sha256:foreign", RepoTags: []string{LocalDomain + "/" + LocalRepo + ":foreign"}}
+
+	removed, err := cleanLocalImages(ctx, s, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{ref.String()}, removed)
+	require.Contains(t, s.tags(), ref.String())
+
+	removed, err = cleanLocalImages(ctx, s, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{ref.String()}, removed)
+	require.ElementsMatch(t, []string{LocalDomain + "/" + LocalRepo + ":foreign", "example.com/app:dev"}, s.tags())
+
+	_, err = CleanLocalImages(ctx, LocalTarget{Store: LocalContainerd}, false)
+	require.ErrorContains(t, err, "not supported")
+}
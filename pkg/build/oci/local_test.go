@@ -0,0 +1,128 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTargetValidate(t *testing.T) {
+	require.NoError(t, LocalTarget{}.Validate())
+	require.NoError(t, LocalTarget{Store: LocalPodman}.Validate())
+	require.NoError(t, LocalTarget{Store: LocalContainerd, Namespace: "default"}.Validate())
+	require.ErrorContains(t, LocalTarget{Store: "cri-o"}.Validate(), "unknown local image store")
+	require.ErrorContains(t, LocalTarget{Store: LocalDocker, Namespace: "k8s.io"}.Validate(), "namespace")
+	require.NoError(t, LocalTarget{Host: "ssh://me@engine", APIVersion: "1.43"}.Validate())
+	require.ErrorContains(t, LocalTarget{Store: LocalContainerd, Host: "unix:///run/containerd.sock"}.Validate(), "host")
+}
+
+func TestLocalTargetClient(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("DOCKER_HOST", "tcp://engine.example.com:2375")
+	t.Setenv("DOCKER_API_VERSION", "")
+	t.Setenv("CONTAINER_HOST", "")
+
+	c, err := LocalTarget{}.client()
+	require.NoError(t, err)
+	require.Equal(t, "tcp://engine.example.com:2375", c.DaemonHost())
+
+	c, err = LocalTarget{Host: "/home/me/.colima/default/docker.sock", APIVersion: "1.43"}.client()
+	require.NoError(t, err)
+	require.Equal(t, "unix:///home/me/.colima/default/docker.sock", c.DaemonHost())
+	require.Equal(t, "1.43", c.ClientVersion())
+
+	// ssh is dialed through the Docker CLI on the remote host.
+	c, err = LocalTarget{Host: "ssh://me@engine.example.com"}.client()
+	require.NoError(t, err)
+	require.Equal(t, "http://docker.example.com", c.DaemonHost())
+
+	c, err = LocalTarget{Store: LocalPodman, Host: "unix:///run/user/1000/podman/podman.sock"}.client()
+	require.NoError(t, err)
+	require.Equal(t, "unix:///run/user/1000/podman/podman.sock", c.DaemonHost())
+}
+
+func TestDockerContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+
+	// Without a docker config, the default context is current.
+	host, err := dockerContextHost()
+	require.NoError(t, err)
+	require.Empty(t, host)
+
+	// The metadata store of the Docker CLI, as docker context create writes it.
+	meta := filepath.Join(dir, "contexts", "meta", "f24fd3749c1368328e2b149bec149cb6795619f244c5b584e844961215dadd16")
+	require.NoError(t, os.MkdirAll(meta, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(meta, "meta.json"), []byte(`{"Name":"colima","Metadata":{},"Endpoints":{"docker":{"Host":"unix:///home/me/.colima/default/docker.sock","SkipTLSVerify":false}}}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"colima"}`), 0o644))
+
+	c, err := LocalTarget{}.client()
+	require.NoError(t, err)
+	require.Equal(t, "unix:///home/me/.colima/default/docker.sock", c.DaemonHost())
+
+	// DOCKER_HOST takes precedence, as it does for the Docker CLI.
+	t.Setenv("DOCKER_HOST", "tcp://engine.example.com:2375")
+	c, err = LocalTarget{}.client()
+	require.NoError(t, err)
+	require.Equal(t, "tcp://engine.example.com:2375", c.DaemonHost())
+
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "missing")
+	_, err = LocalTarget{}.client()
+	require.ErrorContains(t, err, "reading docker context missing")
+	t.Setenv("DOCKER_CONTEXT", "default")
+	host, err = dockerContextHost()
+	require.NoError(t, err)
+	require.Empty(t, host)
+}
+
+func TestImportContainerd(t *testing.T) {
+	// A fake ctr that records its arguments and the archive it is sent.
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat > " + filepath.Join(dir, "archive.tar") + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ctr"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := LoadImageInto(context.Background(), LocalTarget{Store: LocalContainerd}, img, []string{"example.com/app:dev"})
+	require.NoError(t, err)
+	require.Equal(t, "example.com/app:dev", ref.String())
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	require.Equal(t, "--namespace k8s.io images import --digests -", strings.TrimSpace(string(args)))
+
+	tag, err := name.NewTag("example.com/app:dev")
+	require.NoError(t, err)
+	imported, err := tarball.ImageFromPath(filepath.Join(dir, "archive.tar"), &tag)
+	require.NoError(t, err)
+	want, err := img.Digest()
+	require.NoError(t, err)
+	got, err := imported.Digest()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
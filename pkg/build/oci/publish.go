@@ -18,20 +18,35 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/events"
 )
 
+// LoadImage loads image into the local Docker daemon and tags it with tags.
 func LoadImage(ctx context.Context, image v1.Image, tags []string) (name.Reference, error) {
+	return LoadImageInto(ctx, LocalTarget{}, image, tags)
+}
+
+// loadDaemon writes image, with LocalCacheLabel set for tags, to
+// LocalDomain/LocalRepo in the image store c is a client of, tags it with
+// tags and then removes the images it supersedes there.
+func loadDaemon(ctx context.Context, c localClient, image v1.Image, tags []string) (name.Reference, error) {
 	log := clog.FromContext(ctx)
+	daemonOpts := []daemon.Option{daemon.WithContext(ctx), daemon.WithClient(c)}
 	hash, err := image.Digest()
 	if err != nil {
 		return name.Digest{}, err
@@ -41,8 +56,16 @@ func LoadImage(ctx context.Context, image v1.Image, tags []string) (name.Referen
 	if err != nil {
 		return name.Digest{}, err
 	}
+	labeled, err := withLocalCacheLabel(image, tags)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("labeling image: %w", err)
+	}
+	id, err := labeled.ConfigName()
+	if err != nil {
+		return name.Digest{}, err
+	}
 	log.Infof("saving OCI image locally: %s", localSrcTag.Name())
-	resp, err := daemon.Write(localSrcTag, image, daemon.WithContext(ctx))
+	resp, err := daemon.Write(localSrcTag, labeled, daemonOpts...)
 	if err != nil {
 		log.Errorf("docker daemon error: %s", strings.ReplaceAll(resp, "\n", "\\n"))
 		return name.Digest{}, fmt.Errorf("failed to save OCI image locally: %w", err)
@@ -54,12 +77,13 @@ func LoadImage(ctx context.Context, image v1.Image, tags []string) (name.Referen
 			return name.Digest{}, err
 		}
 		if !strings.HasPrefix(localDstTag.Name(), fmt.Sprintf("%s/", LocalDomain)) {
-			log.Infof("tagging local image %s as %s", localSrcTag.Name(), localDstTag.Name())
-			if err := daemon.Tag(localSrcTag, localDstTag, daemon.WithContext(ctx)); err != nil {
+			log.With("tag", localDstTag.Name()).Infof("tagging local image %s as %s", localSrcTag.Name(), localDstTag.Name())
+			if err := daemon.Tag(localSrcTag, localDstTag, daemonOpts...); err != nil {
 				return name.Digest{}, err
 			}
 		}
 	}
+	pruneLocalCache(ctx, c, tags, id)
 	return localSrcTag, nil
 }
 
@@ -69,88 +93,219 @@ func LoadImage(ctx context.Context, image v1.Image, tags []string) (name.Referen
 // platform, defaulting to the one on which the docker daemon is running.
 // PublishIndex will determine that platform and use it to publish the updated index.
 func PublishIndex(ctx context.Context, idx v1.ImageIndex, tags []string, remoteOpts ...remote.Option) (name.Digest, error) {
-	log := clog.FromContext(ctx)
+	refs := make([]name.Reference, 0, len(tags))
+	for _, tag := range tags {
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			return name.Digest{}, fmt.Errorf("unable to parse reference: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	return PublishIndexRefs(ctx, idx, refs, remoteOpts...)
+}
 
-	// TODO(jason): Also set annotations on the index.
+// PublishIndexRefs is like PublishIndex, but takes parsed references, which
+// allows publishing to insecure registries.
+func PublishIndexRefs(ctx context.Context, idx v1.ImageIndex, refs []name.Reference, remoteOpts ...remote.Option) (name.Digest, error) {
+	return PublishIndexTags(ctx, idx, refs, nil, remoteOpts...)
+}
 
-	ref, err := name.ParseReference(tags[0])
+// PublishIndexTags is like PublishIndexRefs, but the tags that have
+// annotations in tagAnnotations, by tag name, get a copy of idx with those
+// annotations added to its manifest. Such a copy holds the same images but
+// has a digest of its own, so idx is then also pushed by its digest, which is
+// the one returned.
+func PublishIndexTags(ctx context.Context, idx v1.ImageIndex, refs []name.Reference, tagAnnotations map[string]map[string]string, remoteOpts ...remote.Option) (name.Digest, error) {
+	dig, _, err := publishIndexTags(ctx, idx, refs, tagAnnotations, remoteOpts...)
+	return dig, err
+}
+
+// publishIndexTags is PublishIndexTags, also returning the digest of the
+// index pushed to each of refs.
+func publishIndexTags(ctx context.Context, idx v1.ImageIndex, refs []name.Reference, tagAnnotations map[string]map[string]string, remoteOpts ...remote.Option) (name.Digest, []v1.Hash, error) {
+	dig, pushes, err := planIndexTags(idx, refs, tagAnnotations)
 	if err != nil {
-		return name.Digest{}, fmt.Errorf("parsing tag %q: %w", tags[0], err)
+		return name.Digest{}, nil, err
+	}
+	if err := pushIndexDigests(ctx, idx, pushes, remoteOpts...); err != nil {
+		return name.Digest{}, nil, err
+	}
+	if err := tagIndexes(ctx, pushes, remoteOpts...); err != nil {
+		return name.Digest{}, nil, err
+	}
+	digests := make([]v1.Hash, 0, len(pushes))
+	for _, p := range pushes {
+		digests = append(digests, p.h)
+	}
+	return dig, digests, nil
+}
+
+// indexPush is an index to push to a reference.
+type indexPush struct {
+	ref name.Reference
+	idx v1.ImageIndex
+	h   v1.Hash
+}
+
+// planIndexTags returns the digest of idx in the repository of the first of
+// refs and what is pushed to each of refs: idx, or, for the tags that have
+// annotations in tagAnnotations, by tag name, a copy of idx with those
+// annotations added to its manifest.
+func planIndexTags(idx v1.ImageIndex, refs []name.Reference, tagAnnotations map[string]map[string]string) (name.Digest, []indexPush, error) {
+	if len(refs) == 0 {
+		return name.Digest{}, nil, fmt.Errorf("no tags to publish")
 	}
 
 	h, err := idx.Digest()
 	if err != nil {
-		return name.Digest{}, err
+		return name.Digest{}, nil, err
 	}
 
-	dig := ref.Context().Digest(h.String())
-
-	toPublish := tags
+	pushes := make([]indexPush, 0, len(refs))
+	for _, ref := range refs {
+		tag, ok := ref.(name.Tag)
+		if !ok || len(tagAnnotations[tag.TagStr()]) == 0 {
+			pushes = append(pushes, indexPush{ref: ref, idx: idx, h: h})
+			continue
+		}
+		tidx := mutate.Annotations(idx, tagAnnotations[tag.TagStr()]).(v1.ImageIndex)
+		th, err := tidx.Digest()
+		if err != nil {
+			return name.Digest{}, nil, err
+		}
+		pushes = append(pushes, indexPush{ref: ref, idx: tidx, h: th})
+	}
+	return refs[0].Context().Digest(h.String()), pushes, nil
+}
 
-	var g errgroup.Group
-	for _, tag := range toPublish {
-		log.Infof("publishing index tag %v", tag)
+// pushIndexDigests pushes idx and the indexes of pushes, which planIndexTags
+// planned for it, by their digests: idx in the repository of the first of
+// pushes, and the others once in each repository they are pushed to, so that
+// tagging them afterwards pushes nothing but their manifests.
+func pushIndexDigests(ctx context.Context, idx v1.ImageIndex, pushes []indexPush, remoteOpts ...remote.Option) error {
+	log := clog.FromContext(ctx)
 
-		ref, err := name.ParseReference(tag)
-		if err != nil {
-			return name.Digest{}, fmt.Errorf("unable to parse reference: %w", err)
+	h, err := idx.Digest()
+	if err != nil {
+		return err
+	}
+	digests := []indexPush{{ref: pushes[0].ref.Context().Digest(h.String()), idx: idx, h: h}}
+	for _, p := range pushes {
+		d := p.ref.Context().Digest(p.h.String())
+		if !slices.ContainsFunc(digests, func(q indexPush) bool { return q.ref.String() == d.String() }) {
+			digests = append(digests, indexPush{ref: d, idx: p.idx, h: p.h})
 		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	remoteOpts = withContext(ctx, remoteOpts)
+	for _, p := range digests {
+		log.With("digest", p.h.String()).Infof("publishing index %v", p.ref)
 
 		g.Go(func() error {
-			return remote.WriteIndex(ref, idx, remoteOpts...)
+			if err := remote.WriteIndex(p.ref, p.idx, remoteOpts...); err != nil {
+				return err
+			}
+			events.Emit(ctx, events.Event{
+				Type:      events.ArtifactPublished,
+				Reference: p.ref.String(),
+				Digest:    p.h.String(),
+			})
+			return nil
 		})
 	}
 	if err := g.Wait(); err != nil {
-		return name.Digest{}, fmt.Errorf("failed to publish: %w", err)
+		return fmt.Errorf("failed to publish: %w", err)
 	}
+	return nil
+}
+
+// tagIndexes pushes the indexes of pushes, which pushIndexDigests pushed,
+// to their tags.
+func tagIndexes(ctx context.Context, pushes []indexPush, remoteOpts ...remote.Option) error {
+	log := clog.FromContext(ctx)
 
-	return dig, nil
+	g, ctx := errgroup.WithContext(ctx)
+	remoteOpts = withContext(ctx, remoteOpts)
+	for _, p := range pushes {
+		tag, ok := p.ref.(name.Tag)
+		if !ok {
+			continue
+		}
+		log.With("tag", tag.String(), "digest", p.h.String()).Infof("publishing index tag %v", tag)
+
+		g.Go(func() error {
+			if err := remote.Tag(tag, p.idx, remoteOpts...); err != nil {
+				return err
+			}
+			events.Emit(ctx, events.Event{
+				Type:      events.TagPushed,
+				Reference: tag.String(),
+				Digest:    p.h.String(),
+			})
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("failed to tag: %w", err)
+	}
+	return nil
 }
 
-// If attempting to save locally, pick the native architecture
-// and use that cached image for local tags
+// LoadIndex loads the image of idx for the native platform into the local
+// Docker daemon, as docker itself does when it pulls a multi-architecture
+// index, and tags it with tags. GOOS and GOARCH override the platform.
 // Ported from https://github.com/ko-build/ko/blob/main/pkg/publish/daemon.go#L92-L168
 func LoadIndex(ctx context.Context, idx v1.ImageIndex, tags []string) (name.Reference, error) {
-	log := clog.FromContext(ctx)
-	im, err := idx.IndexManifest()
-	if err != nil {
-		return name.Digest{}, err
-	}
-	goos, goarch := os.Getenv("GOOS"), os.Getenv("GOARCH")
+	return LoadIndexInto(ctx, LocalTarget{}, idx, tags)
+}
+
+// localPlatform returns the platform of the image to load locally.
+func localPlatform() (goos, goarch string) {
+	goos, goarch = os.Getenv("GOOS"), os.Getenv("GOARCH")
 	if goos == "" {
 		goos = "linux"
 	}
 	if goarch == "" {
-		goarch = "amd64"
+		goarch = runtime.GOARCH
 	}
-	// Default to just using the first one in the list if we cannot match
-	useManifest := im.Manifests[0]
+	return goos, goarch
+}
+
+// localManifest returns the manifest of im for goos/goarch, or the first one
+// if there is none.
+func localManifest(im *v1.IndexManifest, goos, goarch string) v1.Descriptor {
 	for _, manifest := range im.Manifests {
 		if manifest.Platform == nil {
 			continue
 		}
-		if manifest.Platform.OS != goos {
-			continue
-		}
-		if manifest.Platform.Architecture != goarch {
-			continue
+		if manifest.Platform.OS == goos && manifest.Platform.Architecture == goarch {
+			return manifest
 		}
-		useManifest = manifest
 	}
-	img, err := idx.Image(useManifest.Digest)
-	if err != nil {
-		return name.Digest{}, fmt.Errorf("reading child image %q", useManifest.Digest.String())
-	}
-
-	log.Infof("using best guess single-arch image for local tags (%s/%s)", goos, goarch)
-	return LoadImage(ctx, img, tags)
+	return im.Manifests[0]
 }
 
+// DefaultUploadJobs is how many blobs PublishImagesFromIndex uploads at
+// once, which is the registry client's default.
+const DefaultUploadJobs = 4
+
 // PublishImagesFromIndex publishes all images from an index to a remote registry.
 // The only difference between this and PublishIndex is that PublishIndex pushes out all blobs and referenced manifests
 // from within the index. This adds pushing the referenced Image artifacts along with appropriate tags.
+//
+// The layers and configs of all the images are uploaded first, each blob once
+// even if several images share it, and at most DefaultUploadJobs of them at a
+// time across all images. The image manifests are pushed once their blobs are
+// all there.
 func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Repository, remoteOpts ...remote.Option) ([]name.Digest, error) {
-	_, span := otel.Tracer("apko").Start(ctx, "PublishImagesFromIndex")
+	return PublishImagesFromIndexWithJobs(ctx, idx, repo, DefaultUploadJobs, remoteOpts...)
+}
+
+// PublishImagesFromIndexWithJobs is PublishImagesFromIndex uploading at most
+// jobs blobs at a time, or DefaultUploadJobs if jobs is zero.
+func PublishImagesFromIndexWithJobs(ctx context.Context, idx v1.ImageIndex, repo name.Repository, jobs int, remoteOpts ...remote.Option) ([]name.Digest, error) {
+	ctx, span := otel.Tracer("apko").Start(ctx, "PublishImagesFromIndex")
 	defer span.End()
 
 	manifest, err := idx.IndexManifest()
@@ -158,20 +313,42 @@ func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Re
 		return nil, fmt.Errorf("failed to get index manifest: %w", err)
 	}
 
+	imgs := make([]v1.Image, len(manifest.Manifests))
+	for i, m := range manifest.Manifests {
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image for %v from index: %w", m, err)
+		}
+		imgs[i] = img
+	}
+	if err := uploadBlobs(ctx, imgs, repo, jobs, remoteOpts...); err != nil {
+		return nil, err
+	}
+
 	digests := make([]name.Digest, len(manifest.Manifests))
 
-	var g errgroup.Group
+	// The first failed push cancels the others.
+	g, ctx := errgroup.WithContext(ctx)
+	remoteOpts = withContext(ctx, remoteOpts)
 	for i, m := range manifest.Manifests {
 		dig := repo.Digest(m.Digest.String())
 		digests[i] = dig
 
 		g.Go(func() error {
-			img, err := idx.Image(m.Digest)
-			if err != nil {
-				return fmt.Errorf("failed to get image for %v from index: %w", m, err)
+			// With the blobs in place this only pushes the manifest.
+			if err := remote.Write(dig, imgs[i], remoteOpts...); err != nil {
+				return err
 			}
-
-			return remote.Write(dig, img, remoteOpts...)
+			ev := events.Event{
+				Type:      events.ArtifactPublished,
+				Reference: dig.String(),
+				Digest:    m.Digest.String(),
+			}
+			if m.Platform != nil {
+				ev.Arch = m.Platform.Architecture
+			}
+			events.Emit(ctx, ev)
+			return nil
 		})
 	}
 	if err := g.Wait(); err != nil {
@@ -179,3 +356,59 @@ func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Re
 	}
 	return digests, nil
 }
+
+// uploadBlobs uploads the distributable layers and the configs of imgs to
+// repo, each distinct blob once, at most jobs at a time.
+func uploadBlobs(ctx context.Context, imgs []v1.Image, repo name.Repository, jobs int, remoteOpts ...remote.Option) error {
+	if jobs <= 0 {
+		jobs = DefaultUploadJobs
+	}
+
+	seen := map[v1.Hash]struct{}{}
+	var blobs []v1.Layer
+	for _, img := range imgs {
+		layers, err := img.Layers()
+		if err != nil {
+			return fmt.Errorf("getting layers: %w", err)
+		}
+		config, err := partial.ConfigLayer(img)
+		if err != nil {
+			return fmt.Errorf("getting config: %w", err)
+		}
+		for _, l := range append(layers, config) {
+			if mt, err := l.MediaType(); err == nil && !mt.IsDistributable() {
+				continue
+			}
+			h, err := l.Digest()
+			if err != nil {
+				return fmt.Errorf("getting layer digest: %w", err)
+			}
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			blobs = append(blobs, l)
+		}
+	}
+
+	// The first failed upload cancels the others.
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(jobs)
+	remoteOpts = withContext(ctx, remoteOpts)
+	for _, l := range blobs {
+		g.Go(func() error {
+			if err := remote.WriteLayer(repo, l, remoteOpts...); err != nil {
+				h, _ := l.Digest()
+				return fmt.Errorf("uploading blob %s: %w", h, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// withContext returns remoteOpts making requests with ctx, so that pushes are
+// cancelled with it.
+func withContext(ctx context.Context, remoteOpts []remote.Option) []remote.Option {
+	return append(slices.Clip(remoteOpts), remote.WithContext(ctx))
+}
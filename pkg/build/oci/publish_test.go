@@ -14,7 +14,26 @@
 
 package oci
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+)
 
 func TestPublishImage(t *testing.T) {
 
@@ -36,8 +55,100 @@ func TestPublishTagFromImage(t *testing.T) {
 
 }
 
+func TestLocalManifest(t *testing.T) {
+	im := &v1.IndexManifest{Manifests: []v1.Descriptor{
+		{Digest: v1.Hash{Algorithm: "sha256", Hex: "amd64"}, Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		{Digest: v1.Hash{Algorithm: "sha256", Hex: "arm64"}, Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+	}}
+	require.Equal(t, "arm64", localManifest(im, "linux", "arm64").Digest.Hex)
+	require.Equal(t, "amd64", localManifest(im, "linux", "amd64").Digest.Hex)
+	// Without a match, the first image is loaded.
+	require.Equal(t, "amd64", localManifest(im, "linux", "s390x").Digest.Hex)
+}
+
 func TestPublishImagesFromIndex(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	repo, err := name.NewRepository(u.Host + "/test/images")
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	idx, err := random.Index(1024, 1, 2)
+	require.NoError(t, err)
+
+	// Pushes are cancelled with the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = PublishImagesFromIndex(ctx, idx, repo, ropt...)
+	require.ErrorIs(t, err, context.Canceled)
+
+	digests, err := PublishImagesFromIndex(context.Background(), idx, repo, ropt...)
+	require.NoError(t, err)
+	require.Len(t, digests, 2)
+	for _, dig := range digests {
+		_, err := remote.Image(dig, ropt...)
+		require.NoError(t, err)
+	}
+}
 
+func TestPublishImagesFromIndexUploads(t *testing.T) {
+	const jobs = 2
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	uploads := map[string]int{}
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/uploads/") {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			if r.Method == http.MethodPut {
+				uploads[r.URL.Query().Get("digest")]++
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	repo, err := name.NewRepository(u.Host + "/test/images")
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	// Every image has a layer of its own and one they all share.
+	shared, err := random.Layer(1024, types.OCILayer)
+	require.NoError(t, err)
+	idx := mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+	for range 4 {
+		own, err := random.Layer(1024, types.OCILayer)
+		require.NoError(t, err)
+		img, err := mutate.AppendLayers(empty.Image, shared, own)
+		require.NoError(t, err)
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img})
+	}
+
+	digests, err := PublishImagesFromIndexWithJobs(context.Background(), idx, repo, jobs, ropt...)
+	require.NoError(t, err)
+	require.Len(t, digests, 4)
+
+	// 4 configs, 4 layers of their own and the shared one.
+	require.Len(t, uploads, 9)
+	sharedDigest, err := shared.Digest()
+	require.NoError(t, err)
+	for dig, n := range uploads {
+		require.Equal(t, 1, n, "blob %s uploaded %d times", dig, n)
+	}
+	require.Contains(t, uploads, sharedDigest.String())
+	require.LessOrEqual(t, maxInFlight, jobs)
 }
 
 func TestCopy(t *testing.T) {
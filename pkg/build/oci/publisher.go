@@ -0,0 +1,360 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
+)
+
+// Publisher publishes image indexes to a registry: the images they hold,
+// the index under each of its tags and, if any, the SBOMs attached to it.
+type Publisher struct {
+	tags           []string
+	insecure       []string
+	refs           []name.Reference
+	tagAnnotations map[string]map[string]string
+	sboms          []types.SBOM
+	jobs           int
+	archTags       bool
+	remoteOpts     []remote.Option
+}
+
+// PublisherOption is an option for NewPublisher.
+type PublisherOption func(*Publisher) error
+
+// WithTags sets the references to publish indexes to. The first one's
+// repository is where the images and SBOMs are pushed.
+func WithTags(tags ...string) PublisherOption {
+	return func(p *Publisher) error {
+		p.tags = tags
+		return nil
+	}
+}
+
+// WithInsecureRegistries sets the registries that tags are pushed to over
+// plain HTTP, as for ParseReference.
+func WithInsecureRegistries(registries ...string) PublisherOption {
+	return func(p *Publisher) error {
+		p.insecure = registries
+		return nil
+	}
+}
+
+// WithTagAnnotations sets annotations to add to the index pushed to each tag,
+// by tag name, as for PublishIndexTags.
+func WithTagAnnotations(annotations map[string]map[string]string) PublisherOption {
+	return func(p *Publisher) error {
+		p.tagAnnotations = annotations
+		return nil
+	}
+}
+
+// WithAttachedSBOMs sets SBOMs to attach to the published index and images as
+// referrers, as for AttachSBOMs.
+func WithAttachedSBOMs(sboms []types.SBOM) PublisherOption {
+	return func(p *Publisher) error {
+		p.sboms = sboms
+		return nil
+	}
+}
+
+// WithUploadJobs sets how many blobs are uploaded at once, as for
+// PublishImagesFromIndexWithJobs.
+func WithUploadJobs(jobs int) PublisherOption {
+	return func(p *Publisher) error {
+		if jobs < 0 {
+			return fmt.Errorf("upload jobs must not be negative, got %d", jobs)
+		}
+		p.jobs = jobs
+		return nil
+	}
+}
+
+// WithArchTags sets whether the image of each platform of the published
+// index is also pushed to <tag>-<arch> for each tag, as in 1.2.3-amd64 and
+// 1.2.3-arm64, with the architecture and variant of the platform, for the
+// clients that cannot pull indexes.
+func WithArchTags(archTags bool) PublisherOption {
+	return func(p *Publisher) error {
+		p.archTags = archTags
+		return nil
+	}
+}
+
+// WithRemoteOptions sets the options of the registry client, such as its
+// keychain and transport.
+func WithRemoteOptions(opts ...remote.Option) PublisherOption {
+	return func(p *Publisher) error {
+		p.remoteOpts = append(p.remoteOpts, opts...)
+		return nil
+	}
+}
+
+// NewPublisher returns a Publisher configured by opts, which must set tags.
+func NewPublisher(opts ...PublisherOption) (*Publisher, error) {
+	p := &Publisher{}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.tags) == 0 {
+		return nil, errors.New("no tags to publish")
+	}
+	for _, tag := range p.tags {
+		ref, err := ParseReference(tag, p.insecure)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q as tag: %w", tag, err)
+		}
+		p.refs = append(p.refs, ref)
+	}
+	return p, nil
+}
+
+// References returns the references that indexes are published to.
+func (p *Publisher) References() []name.Reference {
+	return p.refs
+}
+
+// Repository returns the repository that images and SBOMs are pushed to.
+func (p *Publisher) Repository() name.Repository {
+	return p.refs[0].Context()
+}
+
+// PublishResult is what Publish pushed.
+type PublishResult struct {
+	// Index is the digest of the index.
+	Index name.Digest `json:"index"`
+	// Tags are the references the index was pushed to.
+	Tags []PublishedTag `json:"tags"`
+	// Images are the images of the index, in its order.
+	Images []PublishedImage `json:"images"`
+	// SBOMs are the digests of the artifacts attaching the SBOMs.
+	SBOMs []name.Digest `json:"sboms,omitempty"`
+}
+
+// PublishedTag is a reference an index was pushed to.
+type PublishedTag struct {
+	// Reference is the reference, usually a tag.
+	Reference string `json:"reference"`
+	// Digest is the digest of the index pushed to it, which is not that of
+	// the published index if the tag has annotations of its own.
+	Digest v1.Hash `json:"digest"`
+}
+
+// String returns the reference pinned to the digest, as tag@digest.
+func (t PublishedTag) String() string {
+	return t.Reference + "@" + t.Digest.String()
+}
+
+// PublishedImage is an image of a published index.
+type PublishedImage struct {
+	// Digest is the digest of the image.
+	Digest name.Digest `json:"digest"`
+	// Platform is the platform of the image in the index.
+	Platform *v1.Platform `json:"platform,omitempty"`
+	// Layers are the layers of the image, with their digests and sizes.
+	Layers []v1.Descriptor `json:"layers"`
+	// Tags are the references the image was pushed to by itself, with
+	// WithArchTags.
+	Tags []PublishedTag `json:"tags,omitempty"`
+}
+
+// ImageDigests returns the digests of the images of r.
+func (r *PublishResult) ImageDigests() []name.Digest {
+	digests := make([]name.Digest, 0, len(r.Images))
+	for _, img := range r.Images {
+		digests = append(digests, img.Digest)
+	}
+	return digests
+}
+
+// Publish publishes idx: everything by digest, with Push and AttachSBOMs,
+// and then its tags, with Tag, so that no tag is pushed unless everything
+// else was.
+func (p *Publisher) Publish(ctx context.Context, idx v1.ImageIndex) (*PublishResult, error) {
+	res, err := p.Push(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.AttachSBOMs(ctx, idx, res); err != nil {
+		return nil, err
+	}
+	if err := p.Tag(ctx, idx, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Push pushes idx and its images by digest, but neither the SBOMs attached to
+// it, which AttachSBOMs then pushes, nor its tags, which Tag then pushes. The
+// result has no SBOMs or tags until then.
+func (p *Publisher) Push(ctx context.Context, idx v1.ImageIndex) (*PublishResult, error) {
+	// Fail on tags that cannot be pushed before pushing anything.
+	if _, err := p.archTagsOf(idx); err != nil {
+		return nil, err
+	}
+
+	digests, err := PublishImagesFromIndexWithJobs(ctx, idx, p.Repository(), p.jobs, p.remoteOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("publishing images from index: %w", err)
+	}
+
+	dig, pushes, err := planIndexTags(idx, p.refs, p.tagAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("publishing image index: %w", err)
+	}
+	if err := pushIndexDigests(ctx, idx, pushes, p.remoteOpts...); err != nil {
+		return nil, fmt.Errorf("publishing image index: %w", err)
+	}
+
+	res := &PublishResult{Index: dig}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for i, desc := range im.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest of %s: %w", desc.Digest, err)
+		}
+		res.Images = append(res.Images, PublishedImage{Digest: digests[i], Platform: desc.Platform, Layers: m.Layers})
+	}
+
+	return res, nil
+}
+
+// AttachSBOMs attaches the SBOMs of WithAttachedSBOMs, if any, to idx, which
+// Push pushed with the result res, adding them to res.
+func (p *Publisher) AttachSBOMs(ctx context.Context, idx v1.ImageIndex, res *PublishResult) error {
+	if len(p.sboms) == 0 {
+		return nil
+	}
+	sboms, err := AttachSBOMs(ctx, idx, p.Repository(), p.sboms, p.remoteOpts...)
+	if err != nil {
+		return fmt.Errorf("attaching SBOMs: %w", err)
+	}
+	res.SBOMs = sboms
+	return nil
+}
+
+// Tag pushes idx, which Push pushed with the result res, to its tags and,
+// with WithArchTags, its images to their own tags, adding them to res.
+func (p *Publisher) Tag(ctx context.Context, idx v1.ImageIndex, res *PublishResult) error {
+	archTags, err := p.archTagsOf(idx)
+	if err != nil {
+		return err
+	}
+	_, pushes, err := planIndexTags(idx, p.refs, p.tagAnnotations)
+	if err != nil {
+		return fmt.Errorf("publishing image index: %w", err)
+	}
+	if err := tagIndexes(ctx, pushes, p.remoteOpts...); err != nil {
+		return fmt.Errorf("publishing image index: %w", err)
+	}
+	res.Tags = nil
+	for _, push := range pushes {
+		res.Tags = append(res.Tags, PublishedTag{Reference: push.ref.String(), Digest: push.h})
+	}
+
+	for i := range res.Images {
+		pi := &res.Images[i]
+		tags := archTags[pi.Digest.DigestStr()]
+		if len(tags) == 0 {
+			continue
+		}
+		h, err := v1.NewHash(pi.Digest.DigestStr())
+		if err != nil {
+			return err
+		}
+		img, err := idx.Image(h)
+		if err != nil {
+			return fmt.Errorf("reading image %s: %w", h, err)
+		}
+		if pi.Tags, err = p.publishArchTags(ctx, img, h, tags); err != nil {
+			return fmt.Errorf("publishing tags of %s: %w", pi.Platform, err)
+		}
+	}
+	return nil
+}
+
+// ArchTag returns the tag that the image of platform is pushed to for tag,
+// with WithArchTags.
+func ArchTag(tag name.Tag, platform *v1.Platform) name.Tag {
+	return tag.Context().Tag(tag.TagStr() + "-" + platform.Architecture + platform.Variant)
+}
+
+// archTagsOf returns the arch tags of the images of idx, by digest, with
+// WithArchTags.
+func (p *Publisher) archTagsOf(idx v1.ImageIndex) (map[string][]name.Tag, error) {
+	if !p.archTags {
+		return nil, nil
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	archTags := map[string][]name.Tag{}
+	for _, desc := range im.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+		for _, ref := range p.refs {
+			tag, ok := ref.(name.Tag)
+			if !ok {
+				continue
+			}
+			archTag := ArchTag(tag, desc.Platform)
+			if _, err := name.NewTag(archTag.String()); err != nil {
+				return nil, fmt.Errorf("tagging %s for %s: %w", tag, desc.Platform, err)
+			}
+			archTags[desc.Digest.String()] = append(archTags[desc.Digest.String()], archTag)
+		}
+	}
+	return archTags, nil
+}
+
+// publishArchTags pushes img, whose digest is h, to tags.
+func (p *Publisher) publishArchTags(ctx context.Context, img v1.Image, h v1.Hash, tags []name.Tag) ([]PublishedTag, error) {
+	published := make([]PublishedTag, 0, len(tags))
+	for _, tag := range tags {
+		clog.FromContext(ctx).With("tag", tag.String(), "digest", h.String()).Infof("publishing image tag %v", tag)
+		if err := remote.Tag(tag, img, withContext(ctx, p.remoteOpts)...); err != nil {
+			return nil, err
+		}
+		events.Emit(ctx, events.Event{
+			Type:      events.TagPushed,
+			Reference: tag.String(),
+			Digest:    h.String(),
+		})
+		published = append(published, PublishedTag{Reference: tag.String(), Digest: h})
+	}
+	return published, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	_, err = NewPublisher(WithRemoteOptions(ropt...))
+	require.EqualError(t, err, "no tags to publish")
+	_, err = NewPublisher(WithTags(u.Host+"/test:latest"), WithUploadJobs(-1))
+	require.EqualError(t, err, "upload jobs must not be negative, got -1")
+
+	p, err := NewPublisher(
+		WithTags(u.Host+"/test:latest", u.Host+"/test:v1"),
+		WithTagAnnotations(map[string]map[string]string{"v1": {"version": "1"}}),
+		WithRemoteOptions(ropt...),
+	)
+	require.NoError(t, err)
+	require.Equal(t, u.Host+"/test", p.Repository().String())
+
+	idx, err := random.Index(1024, 1, 2)
+	require.NoError(t, err)
+	res, err := p.Publish(context.Background(), idx)
+	require.NoError(t, err)
+
+	h, err := idx.Digest()
+	require.NoError(t, err)
+	require.Equal(t, u.Host+"/test@"+h.String(), res.Index.String())
+	require.Len(t, res.Tags, 2)
+	require.Equal(t, u.Host+"/test:latest@"+h.String(), res.Tags[0].String())
+	require.Equal(t, u.Host+"/test:v1", res.Tags[1].Reference)
+	require.Len(t, res.Images, 2)
+	require.Len(t, res.ImageDigests(), 2)
+	for _, img := range res.Images {
+		require.Len(t, img.Layers, 1)
+		require.Positive(t, img.Layers[0].Size)
+	}
+	require.Empty(t, res.SBOMs)
+
+	latest, err := name.ParseReference(u.Host + "/test:latest")
+	require.NoError(t, err)
+	desc, err := remote.Head(latest, ropt...)
+	require.NoError(t, err)
+	require.Equal(t, h, desc.Digest)
+
+	v1, err := name.ParseReference(u.Host + "/test:v1")
+	require.NoError(t, err)
+	tidx, err := remote.Index(v1, ropt...)
+	require.NoError(t, err)
+	m, err := tidx.IndexManifest()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"version": "1"}, m.Annotations)
+	th, err := tidx.Digest()
+	require.NoError(t, err)
+	require.Equal(t, th, res.Tags[1].Digest)
+}
+
+func TestPublisherLogs(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	// Any slog handler can take the logs, which carry the tag and digest as
+	// attributes.
+	var buf bytes.Buffer
+	ctx := clog.WithLogger(context.Background(), clog.New(slog.NewJSONHandler(&buf, nil)))
+
+	p, err := NewPublisher(WithTags(u.Host+"/test:latest"), WithRemoteOptions(remote.WithTransport(s.Client().Transport)))
+	require.NoError(t, err)
+	idx, err := random.Index(1024, 1, 1)
+	require.NoError(t, err)
+	res, err := p.Publish(ctx, idx)
+	require.NoError(t, err)
+
+	var found bool
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec map[string]any
+		require.NoError(t, dec.Decode(&rec))
+		if rec["tag"] == u.Host+"/test:latest" {
+			require.Equal(t, res.Index.DigestStr(), rec["digest"])
+			found = true
+		}
+	}
+	require.True(t, found, "no record of the tag pushed")
+}
+
+func TestPublisherPushThenTag(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	p, err := NewPublisher(
+		WithTags(u.Host+"/test:latest", u.Host+"/other:v1"),
+		WithTagAnnotations(map[string]map[string]string{"v1": {"version": "1"}}),
+		WithRemoteOptions(ropt...),
+	)
+	require.NoError(t, err)
+	idx, err := random.Index(1024, 1, 2)
+	require.NoError(t, err)
+
+	// Pushing pushes every index by digest, in each repository, but no tag.
+	res, err := p.Push(ctx, idx)
+	require.NoError(t, err)
+	require.Empty(t, res.Tags)
+	_, err = remote.Head(res.Index, ropt...)
+	require.NoError(t, err)
+	for _, tag := range []string{u.Host + "/test:latest", u.Host + "/other:v1"} {
+		ref, err := name.ParseReference(tag)
+		require.NoError(t, err)
+		_, err = remote.Head(ref, ropt...)
+		require.Error(t, err, tag)
+	}
+	other, err := name.NewRepository(u.Host + "/other")
+	require.NoError(t, err)
+	tags, err := remote.List(other, ropt...)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	require.NoError(t, p.Tag(ctx, idx, res))
+	require.Len(t, res.Tags, 2)
+	for _, tag := range res.Tags {
+		ref, err := name.ParseReference(tag.Reference)
+		require.NoError(t, err)
+		desc, err := remote.Head(ref, ropt...)
+		require.NoError(t, err)
+		require.Equal(t, tag.Digest, desc.Digest)
+	}
+}
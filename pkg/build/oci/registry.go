@@ -0,0 +1,94 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ParseReference parses s as a reference. If its registry is one of
+// insecure, the reference may be reached over plain HTTP.
+func ParseReference(s string, insecure []string) (name.Reference, error) {
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(insecure, ref.Context().RegistryStr()) {
+		return name.ParseReference(s, name.Insecure)
+	}
+	return ref, nil
+}
+
+// RegistryTransport returns a copy of t that also trusts the PEM encoded
+// certificates in caFile, and that does not verify the certificates of the
+// insecure registries. A nil t starts from remote.DefaultTransport.
+func RegistryTransport(t *http.Transport, caFile string, insecure []string) (http.RoundTripper, error) {
+	if t == nil {
+		dt, ok := remote.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("unexpected default transport %T", remote.DefaultTransport)
+		}
+		t = dt
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if len(insecure) == 0 {
+		return t, nil
+	}
+	it := t.Clone()
+	it.TLSClientConfig.InsecureSkipVerify = true //nolint:gosec // Only for registries explicitly marked insecure.
+	return &insecureTransport{hosts: insecure, secure: t, insecure: it}, nil
+}
+
+// insecureTransport sends requests to hosts through insecure and everything
+// else through secure.
+type insecureTransport struct {
+	hosts    []string
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+}
+
+func (t *insecureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if slices.Contains(t.hosts, req.URL.Host) {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.secure.RoundTrip(req)
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// MaxRetryAfter caps how long a Retry-After header can make a retry wait.
+const MaxRetryAfter = time.Minute
+
+// errAttemptTimeout is returned for requests that took longer than the
+// per-attempt timeout of a RetryPolicy, which are retried.
+var errAttemptTimeout = errors.New("attempt timed out")
+
+// RetryPolicy configures how registry operations are retried. Requests
+// failing with 429 Too Many Requests, 408 Request Timeout or a 5xx status, or
+// with a network error, are retried; other failures, such as 401, 403 and 404,
+// are not. A Retry-After header on the response is waited for before the
+// next attempt.
+type RetryPolicy struct {
+	// Attempts is how many times each operation is tried in total. Zero
+	// means the registry client's default of 3.
+	Attempts int
+	// Backoff is the wait before the first retry, tripled before each of
+	// the next ones. Zero means the registry client's default of 1s.
+	Backoff time.Duration
+	// Timeout bounds each attempt, if set.
+	Timeout time.Duration
+}
+
+// RemoteOptions returns the options that make registry operations retry
+// as p says, over inner, which is http.DefaultTransport if nil.
+func (p RetryPolicy) RemoteOptions(inner http.RoundTripper) []remote.Option {
+	if inner == nil {
+		inner = remote.DefaultTransport
+	}
+	backoff := remote.Backoff{
+		Duration: time.Second,
+		Factor:   3.0,
+		Jitter:   0.1,
+		Steps:    3,
+	}
+	if p.Attempts > 0 {
+		backoff.Steps = p.Attempts
+	}
+	if p.Backoff > 0 {
+		backoff.Duration = p.Backoff
+	}
+
+	codes := []int{http.StatusRequestTimeout, http.StatusTooManyRequests}
+	for code := 500; code < 600; code++ {
+		codes = append(codes, code)
+	}
+	return []remote.Option{
+		remote.WithTransport(&retryAfterTransport{inner: inner, timeout: p.Timeout}),
+		remote.WithRetryBackoff(backoff),
+		remote.WithRetryPredicate(Retryable),
+		remote.WithRetryStatusCodes(codes...),
+	}
+}
+
+// Retryable reports whether a registry operation that failed with err is
+// worth trying again.
+func Retryable(err error) bool {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return terr.StatusCode == http.StatusRequestTimeout || terr.StatusCode == http.StatusTooManyRequests || terr.StatusCode >= 500
+	}
+	if errors.Is(err, errAttemptTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed)
+}
+
+// retryAfterTransport bounds each request by timeout, and makes responses
+// asking to retry later wait as long as they ask before being returned to
+// the retrying transport of the registry client.
+type retryAfterTransport struct {
+	inner   http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		var attempt context.Context
+		attempt, cancel = context.WithTimeout(ctx, t.timeout)
+		req = req.WithContext(attempt)
+	}
+
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		cancel()
+		if t.timeout > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, fmt.Errorf("%s %s: %w after %s", req.Method, req.URL.Redacted(), errAttemptTimeout, t.timeout)
+		}
+		return nil, err
+	}
+	// The attempt lasts until the body is read.
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	if wait := retryAfter(resp); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			resp.Body.Close()
+			return nil, ctx.Err()
+		}
+	}
+	return resp, nil
+}
+
+// retryAfter returns how long resp asks to wait before retrying, capped at
+// MaxRetryAfter.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0
+	}
+	var wait time.Duration
+	if secs, err := strconv.Atoi(h); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(h); err == nil {
+		wait = time.Until(at)
+	}
+	return min(max(wait, 0), MaxRetryAfter)
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	reg := registry.New()
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		// fail writes a failure in response to the nth manifest request,
+		// reporting whether it did.
+		fail     func(w http.ResponseWriter, n int32) bool
+		policy   RetryPolicy
+		wantErr  bool
+		requests int32
+		minWait  time.Duration
+	}{{
+		name: "not found is not retried",
+		fail: func(w http.ResponseWriter, _ int32) bool {
+			w.WriteHeader(http.StatusNotFound)
+			return true
+		},
+		policy:   RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+		wantErr:  true,
+		requests: 1,
+	}, {
+		name: "forbidden is not retried",
+		fail: func(w http.ResponseWriter, _ int32) bool {
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		},
+		policy:   RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+		wantErr:  true,
+		requests: 1,
+	}, {
+		name: "server errors are retried as many times as asked",
+		fail: func(w http.ResponseWriter, _ int32) bool {
+			w.WriteHeader(http.StatusBadGateway)
+			return true
+		},
+		policy:   RetryPolicy{Attempts: 4, Backoff: time.Millisecond},
+		wantErr:  true,
+		requests: 4,
+	}, {
+		name: "retry after is honored",
+		fail: func(w http.ResponseWriter, n int32) bool {
+			if n > 1 {
+				return false
+			}
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return true
+		},
+		policy:   RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+		requests: 2,
+		minWait:  time.Second,
+	}, {
+		name: "slow attempts are retried",
+		fail: func(_ http.ResponseWriter, n int32) bool {
+			if n > 1 {
+				return false
+			}
+			time.Sleep(200 * time.Millisecond)
+			return false
+		},
+		policy:   RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Timeout: 50 * time.Millisecond},
+		requests: 2,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/" && r.Method == http.MethodGet && !isBlob(r.URL.Path) {
+					if tc.fail(w, requests.Add(1)) {
+						return
+					}
+				}
+				reg.ServeHTTP(w, r)
+			}))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err)
+			ref, err := name.ParseReference(u.Host + "/test/retry:latest")
+			require.NoError(t, err)
+			require.NoError(t, remote.Write(ref, img, remote.WithTransport(s.Client().Transport)))
+			requests.Store(0)
+
+			start := time.Now()
+			_, err = remote.Image(ref, tc.policy.RemoteOptions(s.Client().Transport)...)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.requests, requests.Load())
+			require.GreaterOrEqual(t, time.Since(start), tc.minWait)
+		})
+	}
+}
+
+func isBlob(path string) bool {
+	return strings.Contains(path, "/blobs/")
+}
@@ -0,0 +1,198 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
+	"chainguard.dev/apko/pkg/sbom/generator"
+)
+
+// SBOMMediaType returns the media type that SBOMs of the given format are
+// attached with: the one its registered generator declares, if any.
+func SBOMMediaType(format string) ggcrtypes.MediaType {
+	if g, ok := generator.Lookup(format); ok {
+		if tg, ok := g.(generator.TypedGenerator); ok {
+			return ggcrtypes.MediaType(tg.MediaType())
+		}
+	}
+	switch format {
+	case "spdx":
+		return "application/spdx+json"
+	case "cyclonedx":
+		return "application/vnd.cyclonedx+json"
+	default:
+		return ggcrtypes.MediaType("application/vnd.dev.chainguard.apko.sbom." + format)
+	}
+}
+
+// SBOMPredicateType returns the in-toto predicate type of SBOMs of format,
+// as cosign attest names it, or as its registered generator declares it.
+func SBOMPredicateType(format string) (string, error) {
+	if g, ok := generator.Lookup(format); ok {
+		if tg, ok := g.(generator.TypedGenerator); ok {
+			return tg.PredicateType(), nil
+		}
+	}
+	switch format {
+	case "spdx":
+		return "https://spdx.dev/Document", nil
+	case "cyclonedx":
+		return "https://cyclonedx.org/bom", nil
+	default:
+		return "", fmt.Errorf("no attestation predicate type for %s SBOMs", format)
+	}
+}
+
+// AttachSBOMs pushes every SBOM to repo as an artifact referring to the image
+// or index of idx that it describes, so each format is discoverable through
+// the referrers API of the registry. Registries without the referrers API
+// get the sha256-<hex> fallback tag instead.
+func AttachSBOMs(ctx context.Context, idx v1.ImageIndex, repo name.Repository, sboms []types.SBOM, remoteOpts ...remote.Option) ([]name.Digest, error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "AttachSBOMs")
+	defer span.End()
+	remoteOpts = withContext(ctx, remoteOpts)
+
+	arts, err := sbomArtifacts(idx, repo, sboms)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make([]name.Digest, 0, len(arts))
+	for _, a := range arts {
+		log.With("arch", a.sbom.Arch, "digest", a.sbom.Digest.String()).Infof("attaching %s SBOM for %s as %s", a.sbom.Format, a.sbom.Digest, a.ref)
+		if err := remote.Write(a.ref, a.img, remoteOpts...); err != nil {
+			return nil, fmt.Errorf("writing %s SBOM: %w", a.sbom.Format, err)
+		}
+		events.Emit(ctx, events.Event{
+			Type:      events.ArtifactPublished,
+			Arch:      a.sbom.Arch,
+			Reference: a.ref.String(),
+			Digest:    a.ref.DigestStr(),
+		})
+		digests = append(digests, a.ref)
+	}
+	return digests, nil
+}
+
+// SBOMReferences returns the references AttachSBOMs would push sboms to,
+// without pushing anything.
+func SBOMReferences(idx v1.ImageIndex, repo name.Repository, sboms []types.SBOM) ([]name.Digest, error) {
+	arts, err := sbomArtifacts(idx, repo, sboms)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]name.Digest, 0, len(arts))
+	for _, a := range arts {
+		refs = append(refs, a.ref)
+	}
+	return refs, nil
+}
+
+type sbomAttachment struct {
+	sbom types.SBOM
+	img  v1.Image
+	ref  name.Digest
+}
+
+// sbomArtifacts builds the artifact of every SBOM, referring to the image or
+// index of idx that it describes.
+func sbomArtifacts(idx v1.ImageIndex, repo name.Repository, sboms []types.SBOM) ([]sbomAttachment, error) {
+	subjects, err := subjectDescriptors(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	arts := make([]sbomAttachment, 0, len(sboms))
+	for _, s := range sboms {
+		subject, ok := subjects[s.Digest]
+		if !ok {
+			return nil, fmt.Errorf("%s SBOM %s describes %s, which is not part of the index", s.Format, s.Path, s.Digest)
+		}
+		b, err := os.ReadFile(s.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading SBOM: %w", err)
+		}
+
+		art, err := sbomArtifact(b, SBOMMediaType(s.Format), filepath.Base(s.Path), s.Annotations, subject)
+		if err != nil {
+			return nil, err
+		}
+		h, err := art.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("computing SBOM digest: %w", err)
+		}
+		arts = append(arts, sbomAttachment{sbom: s, img: art, ref: repo.Digest(h.String())})
+	}
+	return arts, nil
+}
+
+func sbomArtifact(b []byte, mt ggcrtypes.MediaType, title string, annotations map[string]string, subject v1.Descriptor) (v1.Image, error) {
+	img, err := mutate.Append(mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1), mutate.Addendum{
+		Layer:     static.NewLayer(b, mt),
+		MediaType: mt,
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": title,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("appending SBOM: %w", err)
+	}
+	img = mutate.ConfigMediaType(img, mt)
+	if len(annotations) != 0 {
+		img = mutate.Annotations(img, annotations).(v1.Image)
+	}
+	return mutate.Subject(img, subject).(v1.Image), nil
+}
+
+// subjectDescriptors returns the descriptors of idx and of every manifest it
+// holds, by digest.
+func subjectDescriptors(idx v1.ImageIndex) (map[v1.Hash]v1.Descriptor, error) {
+	desc, err := indexDescriptor(idx)
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("getting index manifest: %w", err)
+	}
+
+	subjects := map[v1.Hash]v1.Descriptor{desc.Digest: *desc}
+	for _, m := range im.Manifests {
+		subjects[m.Digest] = v1.Descriptor{
+			MediaType: m.MediaType,
+			Digest:    m.Digest,
+			Size:      m.Size,
+		}
+	}
+	return subjects, nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// IsTagTemplate reports whether tag is a template, for RenderTags.
+func IsTagTemplate(tag string) bool {
+	return strings.Contains(tag, "{{")
+}
+
+// TagData is what tag templates are rendered with.
+type TagData struct {
+	// Created is when the images were built, the latest of their build
+	// dates.
+	Created time.Time
+	// Date is Created, in UTC, as 20060102.
+	Date string
+	// Digest is the digest of the index, as sha256:<hex>.
+	Digest string
+	// DigestShort is the first 12 characters of the hex of Digest.
+	DigestShort string
+
+	archs    []string
+	versions map[string]map[string]string
+}
+
+// Arch returns the architecture of the index, as apk names it, which must
+// hold the image of a single architecture.
+func (d TagData) Arch() (string, error) {
+	if len(d.archs) != 1 {
+		return "", fmt.Errorf("the index holds the images of %d architectures, not one", len(d.archs))
+	}
+	return d.archs[0], nil
+}
+
+// PackageVersion returns the version of the package name, which must be
+// installed at the same version in every image, with what tags may not hold
+// replaced with underscores.
+func (d TagData) PackageVersion(name string) (string, error) {
+	v, err := d.packageVersion(name)
+	if err != nil {
+		return "", err
+	}
+	return invalidTagChars.ReplaceAllString(v, "_"), nil
+}
+
+func (d TagData) packageVersion(name string) (string, error) {
+	versions := d.versions[name]
+	if len(versions) == 0 {
+		return "", fmt.Errorf("package %s is not installed", name)
+	}
+	var version string
+	for _, arch := range d.archs {
+		v, ok := versions[arch]
+		switch {
+		case !ok:
+			return "", fmt.Errorf("package %s is not installed for %s", name, arch)
+		case version != "" && v != version:
+			return "", fmt.Errorf("package %s is installed at different versions: %s and %s", name, version, v)
+		}
+		version = v
+	}
+	return version, nil
+}
+
+// invalidTagChars matches what tags may not hold.
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// NewTagData reads the data tag templates of idx are rendered with from the
+// images it holds.
+func NewTagData(idx v1.ImageIndex) (*TagData, error) {
+	d, err := idx.Digest()
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	data := &TagData{
+		Digest:      d.String(),
+		DigestShort: d.Hex[:12],
+		versions:    map[string]map[string]string{},
+	}
+	for _, desc := range im.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("reading config of image %s: %w", desc.Digest, err)
+		}
+		if created := cf.Created.UTC(); created.After(data.Created) {
+			data.Created = created
+		}
+		pkgs, err := InstalledPackages(img)
+		if err != nil {
+			return nil, fmt.Errorf("reading packages of image %s: %w", desc.Digest, err)
+		}
+		arch := platformArch(desc.Platform)
+		data.archs = append(data.archs, arch)
+		for _, pkg := range pkgs {
+			if data.versions[pkg.Name] == nil {
+				data.versions[pkg.Name] = map[string]string{}
+			}
+			data.versions[pkg.Name][arch] = pkg.Version
+		}
+	}
+	slices.Sort(data.archs)
+	data.Date = data.Created.Format("20060102")
+	return data, nil
+}
+
+// platformArch returns the architecture of platform, as apk names it.
+func platformArch(platform *v1.Platform) string {
+	for _, a := range types.AllArchs {
+		if p := a.ToOCIPlatform(); p.Architecture == platform.Architecture && p.Variant == platform.Variant {
+			return a.ToAPK()
+		}
+	}
+	return types.ParseArchitecture(platform.Architecture).ToAPK()
+}
+
+// RenderTags renders the tags of tags that are templates, as for
+// text/template, with the TagData of idx, as in
+// registry.example.com/nginx:{{.PackageVersion "nginx"}}-{{.Date}}. Other
+// tags are returned as they are.
+func RenderTags(idx v1.ImageIndex, tags []string) ([]string, error) {
+	if !slices.ContainsFunc(tags, IsTagTemplate) {
+		return tags, nil
+	}
+	data, err := NewTagData(idx)
+	if err != nil {
+		return nil, err
+	}
+	return data.RenderTags(tags)
+}
+
+// RenderTags is RenderTags with the TagData d, for callers that need it for
+// more than rendering tags, so that the images are only read once.
+func (d TagData) RenderTags(tags []string) ([]string, error) {
+	rendered := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !IsTagTemplate(tag) {
+			rendered = append(rendered, tag)
+			continue
+		}
+		tmpl, err := template.New("tag").Option("missingkey=error").Parse(tag)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tag template %q: %w", tag, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, d); err != nil {
+			return nil, fmt.Errorf("rendering tag template %q: %w", tag, err)
+		}
+		rendered = append(rendered, b.String())
+	}
+	return rendered, nil
+}
+
+// PackageVersionTags returns, for the repository of each of tags, a tag of
+// prefix followed by the version of the package pkg installed in the images
+// of idx, as TagData.PackageVersion returns it. With stems, tags of the
+// major.minor.patch, major.minor and major versions it starts with, and
+// latest, are returned too, so that 1.25.3-r1 is also tagged 1.25.3, 1.25,
+// 1 and latest.
+func PackageVersionTags(idx v1.ImageIndex, tags []string, pkg string, stems bool, prefix string) ([]string, error) {
+	data, err := NewTagData(idx)
+	if err != nil {
+		return nil, err
+	}
+	return data.PackageVersionTags(tags, pkg, stems, prefix)
+}
+
+// PackageVersionTags is PackageVersionTags with the TagData d.
+func (d TagData) PackageVersionTags(tags []string, pkg string, stems bool, prefix string) ([]string, error) {
+	version, err := d.packageVersion(pkg)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{prefix + invalidTagChars.ReplaceAllString(version, "_")}
+	if stems {
+		for _, stem := range versionStems(version) {
+			names = append(names, prefix+stem)
+		}
+		names = append(names, "latest")
+	}
+
+	var versionTags []string
+	var repos []string
+	for _, tag := range tags {
+		repo := tagRepository(tag)
+		if slices.Contains(repos, repo) {
+			continue
+		}
+		repos = append(repos, repo)
+		for _, n := range names {
+			if t := repo + ":" + n; !slices.Contains(tags, t) && !slices.Contains(versionTags, t) {
+				versionTags = append(versionTags, t)
+			}
+		}
+	}
+	return versionTags, nil
+}
+
+// versionStem matches the major, minor and patch versions a version starts
+// with.
+var versionStem = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// versionStems returns the major.minor.patch, major.minor and major versions
+// version starts with, but version itself.
+func versionStems(version string) []string {
+	m := versionStem.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	var stems []string
+	for i := 3; i >= 1; i-- {
+		if m[i] == "" {
+			continue
+		}
+		stem := strings.Join(m[1:i+1], ".")
+		if stem != version {
+			stems = append(stems, stem)
+		}
+	}
+	return stems
+}
+
+// tagRepository returns the repository of tag, without its tag or digest.
+func tagRepository(tag string) string {
+	tag, _, _ = strings.Cut(tag, "@")
+	if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionStems(t *testing.T) {
+	for version, want := range map[string][]string{
+		"1.25.3-r1":       {"1.25.3", "1.25", "1"},
+		"1.25.3":          {"1.25", "1"},
+		"2.4-r0":          {"2.4", "2"},
+		"20240101-r0":     {"20240101"},
+		"1.2.3.4_git2024": {"1.2.3", "1.2", "1"},
+		"latest":          nil,
+	} {
+		require.Equal(t, want, versionStems(version), version)
+	}
+}
+
+func TestTagRepository(t *testing.T) {
+	for tag, want := range map[string]string{
+		"cgr.dev/example/image:latest":         "cgr.dev/example/image",
+		"localhost:5000/image:v1":              "localhost:5000/image",
+		"localhost:5000/image":                 "localhost:5000/image",
+		"cgr.dev/example/image@sha256:abcdef0": "cgr.dev/example/image",
+	} {
+		require.Equal(t, want, tagRepository(tag), tag)
+	}
+}
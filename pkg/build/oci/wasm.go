@@ -0,0 +1,179 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	// WasmConfigMediaType is the media type of the config of a WebAssembly
+	// OCI artifact.
+	WasmConfigMediaType ggcrtypes.MediaType = "application/vnd.wasm.config.v0+json"
+
+	// WasmLayerMediaType is the media type of the module of a WebAssembly
+	// OCI artifact.
+	WasmLayerMediaType ggcrtypes.MediaType = "application/wasm"
+)
+
+// wasmConfig is the config of a WebAssembly OCI artifact, as the CNCF
+// specifies it.
+type wasmConfig struct {
+	Created      time.Time `json:"created"`
+	Author       string    `json:"author,omitempty"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	LayerDigests []string  `json:"layerDigests"`
+}
+
+// buildWasmArtifact returns a WebAssembly OCI artifact of the module that
+// ic.Wasm configures, read from layers.
+func buildWasmArtifact(layers []v1.Layer, ic *types.ImageConfiguration, annotations map[string]string, created time.Time, arch types.Architecture) (v1.Image, error) {
+	platform := ic.Platform(arch)
+	if platform.Architecture != "wasm" {
+		return nil, fmt.Errorf("a wasm artifact cannot be built for %s, only for wasm32", arch)
+	}
+
+	module, err := readLayersFile(layers, ic.Wasm.Module)
+	if err != nil {
+		return nil, fmt.Errorf("reading wasm module: %w", err)
+	}
+	layer := static.NewLayer(module, WasmLayerMediaType)
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(wasmConfig{
+		Created:      created.UTC(),
+		Author:       "github.com/chainguard-dev/apko",
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		LayerDigests: []string{digest.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(config))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.Marshal(v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     ggcrtypes.OCIManifestSchema1,
+		Config: v1.Descriptor{
+			MediaType: WasmConfigMediaType,
+			Digest:    configDigest,
+			Size:      configSize,
+		},
+		Layers: []v1.Descriptor{{
+			MediaType: WasmLayerMediaType,
+			Digest:    digest,
+			Size:      int64(len(module)),
+			Annotations: map[string]string{
+				"org.opencontainers.image.title": path.Base(ic.Wasm.Module),
+			},
+		}},
+		Annotations: annotations,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partial.CompressedToImage(&wasmArtifact{config: config, manifest: manifest, layer: layer})
+}
+
+// wasmArtifact is a WebAssembly OCI artifact, whose config is not an image
+// config.
+type wasmArtifact struct {
+	config   []byte
+	manifest []byte
+	layer    v1.Layer
+}
+
+func (a *wasmArtifact) RawConfigFile() ([]byte, error) { return a.config, nil }
+
+func (a *wasmArtifact) MediaType() (ggcrtypes.MediaType, error) {
+	return ggcrtypes.OCIManifestSchema1, nil
+}
+
+func (a *wasmArtifact) RawManifest() ([]byte, error) { return a.manifest, nil }
+
+func (a *wasmArtifact) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if d, err := a.layer.Digest(); err != nil {
+		return nil, err
+	} else if d == h {
+		return a.layer, nil
+	}
+	return nil, fmt.Errorf("wasm artifact has no layer %s", h)
+}
+
+// readLayersFile returns the content of the regular file at p in the
+// filesystem of layers, the last one to have it.
+func readLayersFile(layers []v1.Layer, p string) ([]byte, error) {
+	name := strings.TrimPrefix(path.Clean(p), "/")
+	var content []byte
+	found := false
+	for _, l := range layers {
+		rc, err := l.Uncompressed()
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rc.Close()
+				return nil, err
+			}
+			if strings.TrimPrefix(path.Clean(hdr.Name), "/") != name {
+				continue
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				rc.Close()
+				return nil, fmt.Errorf("%s is not a regular file", p)
+			}
+			if content, err = io.ReadAll(tr); err != nil {
+				rc.Close()
+				return nil, err
+			}
+			found = true
+		}
+		rc.Close()
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not in the image", p)
+	}
+	return content, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBuildWasmArtifact(t *testing.T) {
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "usr/lib/wasm/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "usr/lib/wasm/hello.wasm", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(module))}))
+	_, err := tw.Write(module)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	layer := static.NewLayer(buf.Bytes(), ggcrtypes.OCIUncompressedLayer)
+
+	created := time.Unix(1700000000, 0).UTC()
+	wasm := types.ParseArchitecture("wasm32")
+	ic := types.ImageConfiguration{
+		Wasm:        &types.ImageWasm{Module: "/usr/lib/wasm/hello.wasm"},
+		Annotations: map[string]string{"org.opencontainers.image.title": "hello"},
+	}
+	img, err := BuildImageFromLayers(context.Background(), empty.Image, []v1.Layer{layer}, ic, created, wasm)
+	require.NoError(t, err)
+
+	m, err := img.Manifest()
+	require.NoError(t, err)
+	require.Equal(t, ggcrtypes.OCIManifestSchema1, m.MediaType)
+	require.Equal(t, WasmConfigMediaType, m.Config.MediaType)
+	require.Len(t, m.Layers, 1)
+	require.Equal(t, WasmLayerMediaType, m.Layers[0].MediaType)
+	require.Equal(t, "hello.wasm", m.Layers[0].Annotations["org.opencontainers.image.title"])
+	require.Equal(t, "hello", m.Annotations["org.opencontainers.image.title"])
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Compressed()
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, module, got)
+
+	raw, err := img.RawConfigFile()
+	require.NoError(t, err)
+	var cfg map[string]any
+	require.NoError(t, json.Unmarshal(raw, &cfg))
+	require.Equal(t, map[string]any{
+		"created":      "2023-11-14T22:13:20Z",
+		"author":       "github.com/chainguard-dev/apko",
+		"architecture": "wasm",
+		"os":           "wasi",
+		"layerDigests": []any{m.Layers[0].Digest.String()},
+	}, cfg)
+
+	// The index describes the platform of the artifact.
+	cf, err := img.ConfigFile()
+	require.NoError(t, err)
+	require.Equal(t, &v1.Platform{OS: "wasi", Architecture: "wasm"}, cf.Platform())
+
+	_, err = BuildImageFromLayers(context.Background(), empty.Image, []v1.Layer{layer}, ic, created, types.ParseArchitecture("amd64"))
+	require.ErrorContains(t, err, "only for wasm32")
+	ic.Wasm.Module = "/usr/lib/wasm/missing.wasm"
+	_, err = BuildImageFromLayers(context.Background(), empty.Image, []v1.Layer{layer}, ic, created, wasm)
+	require.ErrorContains(t, err, "/usr/lib/wasm/missing.wasm is not in the image")
+}
@@ -15,21 +15,21 @@
 package build
 
 import (
-	"context"
-	sha2562 "crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"maps"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/policy"
 	"chainguard.dev/apko/pkg/sbom/generator"
-
-	"github.com/chainguard-dev/clog"
 )
 
 // Option is an option for the build context.
@@ -40,20 +40,19 @@ type Option func(*Context) error
 // TODO(jason): Remove this.
 func WithConfig(configFile string, includePaths []string) Option {
 	return func(bc *Context) error {
-		ctx := context.Background()
-		log := clog.FromContext(ctx)
-		log.Debugf("loading config file: %s", configFile)
-
-		var ic types.ImageConfiguration
-		hasher := sha2562.New()
-		if err := ic.Load(ctx, configFile, includePaths, hasher); err != nil { //nolint:staticcheck
-			return fmt.Errorf("failed to load image configuration: %w", err)
-		}
-
-		bc.ic = ic
-		bc.o.ImageConfigFile = configFile
-		bc.o.ImageConfigChecksum = "sha256-" + base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+		// The configuration is loaded once all options are applied, with
+		// the variables and transport they set.
+		bc.configFile = configFile
+		bc.configIncludePaths = includePaths
+		return nil
+	}
+}
 
+// WithConfigVariables substitutes vars in the image configuration, whether
+// it comes before or after WithConfig.
+func WithConfigVariables(vars *types.Variables) Option {
+	return func(bc *Context) error {
+		bc.o.ConfigVariables = vars
 		return nil
 	}
 }
@@ -66,6 +65,19 @@ func WithTags(tags ...string) Option {
 	}
 }
 
+// WithPackageVersionTag tags images with the version of the package pkg,
+// after prefix, in the repository of each of their tags and, with stems,
+// with the major.minor.patch, major.minor and major versions it starts with
+// and latest, as for oci.PackageVersionTags. An empty pkg does nothing.
+func WithPackageVersionTag(pkg string, stems bool, prefix string) Option {
+	return func(bc *Context) error {
+		bc.o.PackageVersionTag = pkg
+		bc.o.PackageVersionTagStem = stems
+		bc.o.PackageVersionTagPrefix = prefix
+		return nil
+	}
+}
+
 // WithTarball sets the output path of the layer tarball.
 func WithTarball(path string) Option {
 	return func(bc *Context) error {
@@ -74,14 +86,21 @@ func WithTarball(path string) Option {
 	}
 }
 
+// BuildDatePackages is the build date that dates the image at the newest
+// build time of the packages installed in it, even if SOURCE_DATE_EPOCH is
+// set.
+const BuildDatePackages = "packages"
+
 // WithBuildDate sets the timestamps for the build context.
 // The string is parsed according to RFC3339.
 // An empty string is a special case and will default to
-// the unix epoch.
+// the unix epoch, as does BuildDatePackages.
 func WithBuildDate(s string) Option {
 	return func(bc *Context) error {
+		bc.o.BuildDateFromPackages = s == BuildDatePackages
+
 		// default to 0 for reproducibility
-		if s == "" {
+		if s == "" || s == BuildDatePackages {
 			bc.o.SourceDateEpoch = time.Unix(0, 0).UTC()
 			return nil
 		}
@@ -137,6 +156,35 @@ func WithExtraKeys(keys []string) Option {
 	}
 }
 
+// WithKeyringDir adds every key (*.pub) in dir to the extra keys, along with
+// those of WithExtraKeys and contents.keyring-dir. An empty dir adds nothing.
+func WithKeyringDir(dir string) Option {
+	return func(bc *Context) error {
+		if dir != "" {
+			bc.keyringDirs = append(bc.keyringDirs, dir)
+		}
+		return nil
+	}
+}
+
+// keyringDirKeys returns the keys (*.pub) in dir.
+func keyringDirKeys(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring directory: %w", err)
+	}
+	var keys []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".pub" {
+			keys = append(keys, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys (*.pub) found in keyring directory %s", dir)
+	}
+	return keys, nil
+}
+
 func WithExtraBuildRepos(repos []string) Option {
 	return func(bc *Context) error {
 		bc.o.ExtraBuildRepos = repos
@@ -170,6 +218,7 @@ func WithIncludePaths(includePaths []string) Option {
 func WithImageConfiguration(ic types.ImageConfiguration) Option {
 	return func(bc *Context) error {
 		bc.ic = ic
+		bc.configFile = ""
 		return nil
 	}
 }
@@ -194,17 +243,25 @@ func WithVCS(enable bool) Option {
 // Commandline annotations take precedence.
 func WithAnnotations(annotations map[string]string) Option {
 	return func(bc *Context) error {
-		if bc.ic.Annotations == nil {
-			bc.ic.Annotations = make(map[string]string)
+		if bc.annotations == nil {
+			bc.annotations = make(map[string]string)
 		}
-		maps.Copy(bc.ic.Annotations, annotations)
+		maps.Copy(bc.annotations, annotations)
 		return nil
 	}
 }
 
-// WithCache set the cache directory to use
+// CacheDirEnv names the environment variable holding the cache directory to
+// use when none is given explicitly.
+const CacheDirEnv = "APKO_CACHE_DIR"
+
+// WithCache set the cache directory to use. An empty cacheDir falls back to
+// $APKO_CACHE_DIR, and then to the system cache directory.
 func WithCache(cacheDir string, offline bool, shared *apk.Cache) Option {
 	return func(bc *Context) error {
+		if cacheDir == "" {
+			cacheDir = os.Getenv(CacheDirEnv)
+		}
 		bc.o.CacheDir = cacheDir
 		bc.o.Offline = offline
 		bc.o.SharedCache = shared
@@ -242,6 +299,52 @@ func WithIgnoreSignatures(ignore bool) Option {
 	}
 }
 
+// WithRunScriptlets sets whether to run the pre-install and post-install
+// scripts of the installed packages named in packages, or of all of them if
+// it is empty, in sandbox: ScriptletSandboxProot, the default if it is empty,
+// ScriptletSandboxChroot or ScriptletSandboxBwrap. Default is false.
+func WithRunScriptlets(run bool, sandbox string, packages []string) Option {
+	return func(bc *Context) error {
+		if !run {
+			bc.o.RunScriptlets = false
+			return nil
+		}
+		if sandbox == "" {
+			sandbox = ScriptletSandboxProot
+		}
+		if _, ok := scriptletSandboxes[sandbox]; !ok {
+			return fmt.Errorf("unknown scriptlet sandbox %q, must be %s, %s or %s", sandbox, ScriptletSandboxProot, ScriptletSandboxChroot, ScriptletSandboxBwrap)
+		}
+		if err := checkSandboxPrivileges(sandbox); err != nil {
+			return err
+		}
+		bc.o.RunScriptlets = true
+		bc.o.ScriptletSandbox = sandbox
+		bc.o.ScriptletPackages = packages
+		return nil
+	}
+}
+
+// WithRequireSignedPackages sets whether to fail the build on packages that
+// are not signed by a key in the keyring, or that do not match the checksum
+// in their repository index. Default is false.
+func WithRequireSignedPackages(require bool) Option {
+	return func(bc *Context) error {
+		bc.o.RequireSignedPackages = require
+		return nil
+	}
+}
+
+// WithValidateRuntime sets whether to fail the build unless the program of
+// the entrypoint, the working directories and the run-as users of the image
+// are in its filesystem. Default is false.
+func WithValidateRuntime(validate bool) Option {
+	return func(bc *Context) error {
+		bc.o.ValidateRuntime = validate
+		return nil
+	}
+}
+
 // WithTransport allows explicitly setting the inner HTTP transport.
 func WithTransport(t http.RoundTripper) Option {
 	return func(bc *Context) error {
@@ -250,6 +353,39 @@ func WithTransport(t http.RoundTripper) Option {
 	}
 }
 
+// WithKeychain sets the keychain authenticating to registries: of the base
+// image, of oci:// repositories and of configurations in registries. The
+// default is authn.DefaultKeychain.
+func WithKeychain(kc authn.Keychain) Option {
+	return func(bc *Context) error {
+		bc.o.Keychain = kc
+		return nil
+	}
+}
+
+// WithRegistryCAFile sets a file of extra PEM certificates to trust when
+// publishing to registries. They are added to the transport of WithTransport
+// if it is a plain *http.Transport, or else to the default one; a transport
+// wrapping another must already trust them, as oci.RegistryTransport makes
+// it.
+func WithRegistryCAFile(path string) Option {
+	return func(bc *Context) error {
+		bc.o.RegistryCAFile = path
+		return nil
+	}
+}
+
+// WithInsecureRegistries sets registries that may be published to over
+// plain HTTP or without verifying their certificates. As for
+// WithRegistryCAFile, a transport wrapping another must already skip the
+// verification.
+func WithInsecureRegistries(registries ...string) Option {
+	return func(bc *Context) error {
+		bc.o.InsecureRegistries = registries
+		return nil
+	}
+}
+
 // WithPackageGetter sets a custom PackageGetter for fetching, expanding, and caching packages.
 // If not provided, a DefaultPackageGetter will be created automatically.
 func WithPackageGetter(pg apk.PackageGetter) Option {
@@ -266,3 +402,62 @@ func WithSizeLimits(limits options.SizeLimits) Option {
 		return nil
 	}
 }
+
+// WithJobs bounds how many architectures are built concurrently. Zero, the
+// default, builds all of them at once.
+func WithJobs(jobs int) Option {
+	return func(bc *Context) error {
+		if jobs < 0 {
+			return fmt.Errorf("jobs must not be negative, got %d", jobs)
+		}
+		bc.o.Jobs = jobs
+		return nil
+	}
+}
+
+// WithMaxSize sets the largest compressed sizes of the image and of each of
+// its layers, such as 100MiB, over those of the configuration. Empty sizes
+// leave those of the configuration.
+func WithMaxSize(image, layer string) Option {
+	return func(bc *Context) error {
+		budget := &types.ImageSizeBudget{Image: image, Layer: layer}
+		if _, err := budget.ImageBytes(); err != nil {
+			return fmt.Errorf("parsing max image size %q: %w", image, err)
+		}
+		if _, err := budget.LayerBytes(); err != nil {
+			return fmt.Errorf("parsing max layer size %q: %w", layer, err)
+		}
+		bc.o.MaxSize = *budget
+		return nil
+	}
+}
+
+// WithPolicies sets the Rego (.rego) or CUE (.cue) policies that BuildIndex
+// evaluates, with policy.Evaluate, against the configuration, the installed
+// packages and the SBOMs of a build before writing the index, failing on
+// any violation.
+func WithPolicies(policies ...string) Option {
+	return func(bc *Context) error {
+		for _, p := range policies {
+			if err := policy.Check(p); err != nil {
+				return err
+			}
+		}
+		bc.o.Policies = policies
+		return nil
+	}
+}
+
+// WithLayerFormat sets how layers are compressed, one of LayerFormatGzip, the
+// default, or LayerFormatEstargz.
+func WithLayerFormat(format string) Option {
+	return func(bc *Context) error {
+		switch format {
+		case "", LayerFormatGzip, LayerFormatEstargz:
+		default:
+			return fmt.Errorf("unsupported layer format %q, expected %s or %s", format, LayerFormatGzip, LayerFormatEstargz)
+		}
+		bc.o.LayerFormat = format
+		return nil
+	}
+}
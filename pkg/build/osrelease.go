@@ -0,0 +1,102 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const osReleasePath = "etc/os-release"
+
+// unquotedOSReleaseValue matches the values of os-release fields that need
+// no quoting.
+var unquotedOSReleaseValue = regexp.MustCompile(`^[A-Za-z0-9._/:-]+$`)
+
+// writeOSRelease sets the fields of /etc/os-release configured by r, keeping
+// the other fields of the one installed by packages. When /etc/os-release is
+// a symlink, as to /usr/lib/os-release, it is replaced by a file.
+func writeOSRelease(fsys apkfs.FullFS, r *types.ImageOSRelease) error {
+	if r == nil {
+		return nil
+	}
+	fields := r.Fields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var lines []string
+	b, err := fsys.ReadFile(osReleasePath)
+	switch {
+	case err == nil:
+		lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		if err := fsys.Remove(osReleasePath); err != nil {
+			return fmt.Errorf("removing /%s: %w", osReleasePath, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if err := fsys.MkdirAll("etc", 0o755); err != nil {
+			return fmt.Errorf("creating /etc: %w", err)
+		}
+		// A dangling symlink.
+		if err := fsys.Remove(osReleasePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing /%s: %w", osReleasePath, err)
+		}
+	default:
+		return fmt.Errorf("reading /%s: %w", osReleasePath, err)
+	}
+
+	for _, f := range fields {
+		line := f.Key + "=" + quoteOSReleaseValue(f.Value)
+		replaced := false
+		for i, l := range lines {
+			if key, _, ok := strings.Cut(l, "="); ok && strings.TrimSpace(key) == f.Key {
+				lines[i] = line
+				replaced = true
+			}
+		}
+		if !replaced {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := fsys.WriteFile(osReleasePath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("writing /%s: %w", osReleasePath, err)
+	}
+	return nil
+}
+
+// quoteOSReleaseValue quotes v as a shell would need it to be, as
+// os-release(5) requires.
+func quoteOSReleaseValue(v string) string {
+	if unquotedOSReleaseValue.MatchString(v) {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range v {
+		if strings.ContainsRune("\"\\$`", c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
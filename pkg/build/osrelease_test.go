@@ -0,0 +1,78 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestWriteOSRelease(t *testing.T) {
+	r := &types.ImageOSRelease{
+		ID:         "acme",
+		Name:       "Acme Linux",
+		VersionID:  "2025.1",
+		PrettyName: `Acme "Roadrunner" Linux`,
+		HomeURL:    "https://acme.example.com/",
+	}
+
+	t.Run("no os-release", func(t *testing.T) {
+		fsys := tarfs.New()
+		require.NoError(t, writeOSRelease(fsys, r))
+		b, err := fsys.ReadFile("etc/os-release")
+		require.NoError(t, err)
+		require.Equal(t, `NAME="Acme Linux"
+ID=acme
+PRETTY_NAME="Acme \"Roadrunner\" Linux"
+VERSION_ID=2025.1
+HOME_URL=https://acme.example.com/
+`, string(b))
+	})
+
+	t.Run("os-release of packages", func(t *testing.T) {
+		fsys := tarfs.New()
+		require.NoError(t, fsys.MkdirAll("etc", 0o755))
+		require.NoError(t, fsys.MkdirAll("usr/lib", 0o755))
+		require.NoError(t, fsys.WriteFile("usr/lib/os-release", []byte(`ID=wolfi
+NAME="Wolfi"
+PRETTY_NAME="Wolfi"
+VERSION_ID="20230201"
+HOME_URL="https://wolfi.dev"
+BUG_REPORT_URL="https://github.com/wolfi-dev/os/issues"
+`), 0o644))
+		require.NoError(t, fsys.Symlink("../usr/lib/os-release", "etc/os-release"))
+
+		require.NoError(t, writeOSRelease(fsys, &types.ImageOSRelease{ID: "acme", PrettyName: "Acme Linux"}))
+		b, err := fsys.ReadFile("etc/os-release")
+		require.NoError(t, err)
+		require.Equal(t, `ID=acme
+NAME="Wolfi"
+PRETTY_NAME="Acme Linux"
+VERSION_ID="20230201"
+HOME_URL="https://wolfi.dev"
+BUG_REPORT_URL="https://github.com/wolfi-dev/os/issues"
+`, string(b))
+
+		// What SBOMs record.
+		rd, err := sbom.ReadReleaseData(fsys)
+		require.NoError(t, err)
+		require.Equal(t, &sbom.ReleaseData{ID: "acme", Name: "Wolfi", PrettyName: "Acme Linux", VersionID: "20230201"}, rd)
+	})
+}
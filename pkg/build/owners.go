@@ -0,0 +1,59 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// FileOwner is a path of the filesystem of an image and the package that
+// installed it.
+type FileOwner struct {
+	// Path is the absolute path.
+	Path string `json:"path"`
+	// Package is the name and version of the package that installed the
+	// path, as name-version, or empty if apko added it.
+	Package string `json:"package,omitempty"`
+}
+
+// FileOwners returns every path but the directories of the filesystem
+// built by BuildImage, in lexical order, with the package that installed
+// each. A path several packages ship is owned by the one installed last.
+func (bc *Context) FileOwners() ([]FileOwner, error) {
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("getting installed packages: %w", err)
+	}
+	owners := map[string]string{}
+	for _, pkg := range installed {
+		for _, hdr := range pkg.Files {
+			owners[strings.TrimPrefix(hdr.Name, "/")] = pkg.Name + "-" + pkg.Version
+		}
+	}
+
+	var files []FileOwner
+	if err := fs.WalkDir(bc.fs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files = append(files, FileOwner{Path: "/" + p, Package: owners[p]})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking image filesystem: %w", err)
+	}
+	return files, nil
+}
@@ -18,7 +18,10 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 
@@ -31,6 +34,7 @@ type PathMutator func(apkfs.FullFS, *options.Options, types.PathMutation) error
 var pathMutators = map[string]PathMutator{
 	"directory":   mutateDirectory,
 	"empty-file":  mutateEmptyFile,
+	"file":        mutateFile,
 	"hardlink":    mutateHardLink,
 	"symlink":     mutateSymLink,
 	"permissions": mutatePermissions,
@@ -93,6 +97,20 @@ func mutateEmptyFile(fsys apkfs.FullFS, o *options.Options, mut types.PathMutati
 	return nil
 }
 
+func mutateFile(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation) error {
+	target := mut.Path
+
+	if err := ensureParentDirectory(fsys, target); err != nil {
+		return fmt.Errorf("ensuring parent directory for %q: %w", target, err)
+	}
+
+	if err := fsys.WriteFile(target, []byte(mut.Content), fs.FileMode(mut.Permissions)); err != nil {
+		return fmt.Errorf("writing file %q: %w", target, err)
+	}
+
+	return nil
+}
+
 func mutateHardLink(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation) error {
 	source := mut.Source
 	target := mut.Path
@@ -131,6 +149,10 @@ func mutateSymLink(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation
 
 func mutatePaths(fsys apkfs.FullFS, o *options.Options, ic *types.ImageConfiguration) error {
 	for _, mut := range ic.Paths {
+		if mut.Type == "strip" {
+			// Applied by stripPaths, once everything else is in place.
+			continue
+		}
 		pm, ok := pathMutators[mut.Type]
 		if !ok {
 			return fmt.Errorf("unsupported path mutation type %q", mut.Type)
@@ -153,6 +175,88 @@ func mutatePaths(fsys apkfs.FullFS, o *options.Options, ic *types.ImageConfigura
 	return nil
 }
 
+// stripPaths removes what matches the patterns of the strip path mutations
+// of ic from fsys, returning the absolute paths of the files removed, in
+// order. Directories are only removed if they match and nothing is left in
+// them.
+func stripPaths(fsys apkfs.FullFS, ic *types.ImageConfiguration) ([]string, error) {
+	var patterns []string
+	for _, mut := range ic.Paths {
+		if mut.Type == "strip" {
+			patterns = append(patterns, mut.Path)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	match := func(p string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool { return matchStripPattern(pattern, p) })
+	}
+
+	var stripped, dirs []string
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." || !match("/"+p) {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		stripped = append(stripped, "/"+p)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking image filesystem: %w", err)
+	}
+	for _, p := range stripped {
+		if err := fsys.Remove(p[1:]); err != nil {
+			return nil, fmt.Errorf("stripping %s: %w", p, err)
+		}
+	}
+	// Children come after their parents in walk order.
+	for _, p := range slices.Backward(dirs) {
+		if entries, err := fsys.ReadDir(p); err != nil || len(entries) != 0 {
+			continue
+		}
+		if err := fsys.Remove(p); err != nil {
+			return nil, fmt.Errorf("stripping %s: %w", "/"+p, err)
+		}
+	}
+	return stripped, nil
+}
+
+// matchStripPattern reports whether the absolute path p matches pattern. A
+// pattern with no slash, such as *.a, matches the base name of paths in any
+// directory. Otherwise each element of it is matched as by path.Match, and
+// an element that is ** matches any number of elements, including none.
+func matchStripPattern(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchElements(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(p, "/"), "/"))
+}
+
+func matchElements(pattern, elems []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := range len(elems) + 1 {
+				if matchElements(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
 // PathMutationFileConflictError is returned when a path mutation
 // attempts to create a file that conflicts with an existing file.
 // This is a user error in the image configuration.
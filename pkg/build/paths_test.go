@@ -0,0 +1,136 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestMutatePaths(t *testing.T) {
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/motd", []byte("welcome"), 0o644))
+
+	ic := &types.ImageConfiguration{
+		Paths: []types.PathMutation{{
+			Path:        "/var/lib/app",
+			Type:        "directory",
+			UID:         1000,
+			GID:         1000,
+			Permissions: 0o750,
+		}, {
+			Path:        "/etc/app/app.conf",
+			Type:        "file",
+			Content:     "listen = 8080\n",
+			UID:         1000,
+			GID:         1000,
+			Permissions: 0o640,
+		}, {
+			Path:        "/etc/motd",
+			Type:        "file",
+			Content:     "replaced",
+			Permissions: 0o644,
+		}, {
+			// As before, this sets the permissions of the target.
+			Path:        "/usr/bin/app-config",
+			Type:        "symlink",
+			Source:      "/etc/app/app.conf",
+			UID:         1000,
+			GID:         1000,
+			Permissions: 0o640,
+		}},
+	}
+	require.NoError(t, mutatePaths(fsys, &options.Options{}, ic))
+
+	for path, want := range map[string]struct {
+		mode     fs.FileMode
+		uid, gid int
+	}{
+		"var/lib/app":      {fs.ModeDir | 0o750, 1000, 1000},
+		"etc/app/app.conf": {0o640, 1000, 1000},
+		"etc/motd":         {0o644, 0, 0},
+	} {
+		fi, err := fsys.Stat(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want.mode, fi.Mode(), path)
+		uid, gid, ok := fileOwner(fi)
+		require.True(t, ok, path)
+		require.Equal(t, want.uid, uid, path)
+		require.Equal(t, want.gid, gid, path)
+	}
+
+	b, err := fsys.ReadFile("etc/app/app.conf")
+	require.NoError(t, err)
+	require.Equal(t, "listen = 8080\n", string(b))
+	b, err = fsys.ReadFile("etc/motd")
+	require.NoError(t, err)
+	require.Equal(t, "replaced", string(b))
+	link, err := fsys.Readlink("usr/bin/app-config")
+	require.NoError(t, err)
+	require.Equal(t, "/etc/app/app.conf", link)
+}
+
+func TestStripPaths(t *testing.T) {
+	fsys := tarfs.New()
+	for _, dir := range []string{"usr/share/man/man1", "usr/share/locale/de/LC_MESSAGES", "usr/lib", "usr/bin"} {
+		require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	}
+	for _, file := range []string{
+		"usr/share/man/man1/app.1",
+		"usr/share/locale/de/LC_MESSAGES/app.mo",
+		"usr/lib/libapp.a",
+		"usr/lib/libapp.so",
+		"usr/bin/app",
+	} {
+		require.NoError(t, fsys.WriteFile(file, []byte(file), 0o644))
+	}
+
+	ic := &types.ImageConfiguration{
+		Paths: []types.PathMutation{
+			{Path: "/usr/share/man/**", Type: "strip"},
+			{Path: "/usr/share/locale/*/LC_MESSAGES/*.mo", Type: "strip"},
+			{Path: "*.a", Type: "strip"},
+		},
+	}
+	// Strip mutations are left to stripPaths.
+	require.NoError(t, mutatePaths(fsys, &options.Options{}, ic))
+	_, err := fsys.Stat("usr/lib/libapp.a")
+	require.NoError(t, err)
+
+	stripped, err := stripPaths(fsys, ic)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/usr/lib/libapp.a",
+		"/usr/share/locale/de/LC_MESSAGES/app.mo",
+		"/usr/share/man/man1/app.1",
+	}, stripped)
+
+	for _, gone := range []string{"usr/share/man", "usr/lib/libapp.a", "usr/share/locale/de/LC_MESSAGES/app.mo"} {
+		_, err := fsys.Stat(gone)
+		require.ErrorIs(t, err, fs.ErrNotExist, gone)
+	}
+	// Directories that do not match are kept, even once empty.
+	for _, kept := range []string{"usr/share/locale/de/LC_MESSAGES", "usr/lib/libapp.so", "usr/bin/app"} {
+		_, err := fsys.Stat(kept)
+		require.NoError(t, err, kept)
+	}
+}
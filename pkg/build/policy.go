@@ -0,0 +1,94 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/policy"
+)
+
+// policyPackages returns the packages installed by bc, as policies see
+// them.
+func (bc *Context) policyPackages() ([]policy.Package, error) {
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("reading installed packages: %w", err)
+	}
+	sources := bc.apk.PackageSources()
+	pkgs := make([]policy.Package, 0, len(installed))
+	for _, pkg := range installed {
+		u := sources[pkg.Name]
+		repo := u
+		if i := strings.LastIndex(u, "/"); i != -1 {
+			repo = strings.TrimSuffix(u[:i], "/"+pkg.Arch)
+		}
+		pkgs = append(pkgs, policy.Package{
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Origin:     pkg.Origin,
+			License:    pkg.License,
+			URL:        u,
+			Repository: repo,
+		})
+	}
+	slices.SortFunc(pkgs, func(a, b policy.Package) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return pkgs, nil
+}
+
+// checkPolicies fails if the build of ic, which installed pkgs in the image
+// of each architecture and generated sboms, violates any of the policies of
+// o.
+func checkPolicies(ctx context.Context, o *options.Options, ic types.ImageConfiguration, pkgs map[string][]policy.Package, sboms []types.SBOM) error {
+	log := clog.FromContext(ctx)
+
+	input := policy.Input{Config: ic, Packages: pkgs, SBOMs: map[string]json.RawMessage{}}
+	for _, s := range sboms {
+		if s.Format != "spdx" || s.Arch == "" {
+			continue
+		}
+		b, err := os.ReadFile(s.Path)
+		if err != nil {
+			return fmt.Errorf("reading SBOM: %w", err)
+		}
+		input.SBOMs[types.ParseArchitecture(s.Arch).ToAPK()] = b
+	}
+
+	violations, err := policy.Evaluate(ctx, o.Policies, input)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		log.Infof("the build complies with %d policies", len(o.Policies))
+		return nil
+	}
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		msgs[i] = "  " + v.String()
+	}
+	return fmt.Errorf("the build violates policies:\n%s", strings.Join(msgs, "\n"))
+}
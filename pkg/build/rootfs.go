@@ -0,0 +1,257 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	gzip "github.com/klauspost/pgzip"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// RootFSFormatTar writes the filesystem as an uncompressed tarball.
+	RootFSFormatTar = "tar"
+	// RootFSFormatTarGz writes the filesystem as a gzipped tarball.
+	RootFSFormatTarGz = "tar.gz"
+	// RootFSFormatDir extracts the filesystem into a directory.
+	RootFSFormatDir = "dir"
+)
+
+// RootFSFormats are the formats BuildRootFS can write.
+var RootFSFormats = []string{RootFSFormatTar, RootFSFormatTarGz, RootFSFormatDir}
+
+// RootFSFormatOf returns the format a filesystem written to path is in,
+// going by its extension: a tarball for .tar, a gzipped one for .tar.gz and
+// .tgz, and a directory otherwise.
+func RootFSFormatOf(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".tar"):
+		return RootFSFormatTar
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return RootFSFormatTarGz
+	}
+	return RootFSFormatDir
+}
+
+// BuildRootFS builds the filesystem of the image and writes it to path in
+// format, one of RootFSFormats, without wrapping it in an OCI layer.
+func (bc *Context) BuildRootFS(ctx context.Context, format, path string) error {
+	ctx, span := otel.Tracer("apko").Start(ctx, "BuildRootFS")
+	defer span.End()
+
+	if !slices.Contains(RootFSFormats, format) {
+		return fmt.Errorf("unknown filesystem format %q, must be one of %s", format, strings.Join(RootFSFormats, ", "))
+	}
+
+	if err := bc.BuildImage(ctx); err != nil {
+		return err
+	}
+	if err := bc.postBuildSetApk(ctx); err != nil {
+		return err
+	}
+	if err := bc.checkPaths(ctx); err != nil {
+		return err
+	}
+
+	if format == RootFSFormatDir {
+		return bc.extractRootFS(ctx, path)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer out.Close()
+
+	buf := pooledBufioWriter(out)
+	defer bufioPool.Put(buf)
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if format == RootFSFormatTarGz {
+		zw = pooledGzipWriter(buf)
+		defer pgzipPool.Put(zw)
+		w = zw
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeTar(ctx, tw, bc.fs); err != nil {
+		return fmt.Errorf("generating tarball: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("compressing %s: %w", path, err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("flushing %s: %w", path, err)
+	}
+	return out.Close()
+}
+
+// extractRootFS writes the filesystem into dir, which must be empty if it
+// exists. Owners and device files are only kept when running as root.
+func (bc *Context) extractRootFS(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf("%s is not empty", dir)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := writeTar(ctx, tw, bc.fs)
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	if err := extractTar(ctx, tar.NewReader(pr), dir); err != nil {
+		return fmt.Errorf("extracting filesystem to %s: %w", dir, err)
+	}
+	return nil
+}
+
+// extractTar writes the entries of tr under dir.
+func extractTar(ctx context.Context, tr *tar.Reader, dir string) error {
+	log := clog.FromContext(ctx)
+	root := os.Geteuid() == 0
+
+	// Directories get their modification time last, once nothing more is
+	// written in them.
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			if name == "." {
+				continue
+			}
+			return fmt.Errorf("%s is outside of the filesystem", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := os.Link(filepath.Join(dir, filepath.Clean(hdr.Linkname)), target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if !root {
+				log.Debugf("not creating device %s, which needs root", hdr.Name)
+				continue
+			}
+			dev := int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))) //nolint:gosec // device numbers fit
+			if err := unix.Mknod(target, uint32(mode.Perm())|tarNodeType(hdr.Typeflag), dev); err != nil {
+				return fmt.Errorf("creating device %s: %w", hdr.Name, err)
+			}
+		default:
+			log.Debugf("skipping %s of unsupported type %q", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		if root {
+			if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+				return err
+			}
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if err := os.Chmod(target, mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+
+	// Deepest first, so that setting a directory's time is not undone by its
+	// children.
+	slices.Reverse(dirs)
+	for _, hdr := range dirs {
+		target := filepath.Join(dir, filepath.Clean(hdr.Name))
+		mode := hdr.FileInfo().Mode()
+		if err := os.Chmod(target, mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarNodeType returns the file type mknod(2) takes for a tar entry type.
+func tarNodeType(typ byte) uint32 {
+	switch typ {
+	case tar.TypeChar:
+		return unix.S_IFCHR
+	case tar.TypeBlock:
+		return unix.S_IFBLK
+	}
+	return unix.S_IFIFO
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/passwd"
+)
+
+// checkRuntime checks that what the image runs is in its filesystem: the
+// program of the entrypoint, or of the cmd without one, the working
+// directories and the users things run as. It returns every problem found.
+func (bc *Context) checkRuntime() error {
+	ic := &bc.ic
+	var errs []error
+
+	args := ic.Entrypoint.Init()
+	if ic.Entrypoint.ShellFragment == "" {
+		rest, err := ic.Entrypoint.CommandArgv()
+		if err == nil && len(rest) == 0 {
+			rest, err = ic.CmdArgv()
+		}
+		if err != nil {
+			return fmt.Errorf("parsing entrypoint command: %w", err)
+		}
+		args = append(args, rest...)
+	}
+	if len(args) != 0 {
+		if err := checkProgram(bc.fs, args[0], ic.WorkDir, oci.Environment(ic)["PATH"]); err != nil {
+			errs = append(errs, fmt.Errorf("entrypoint: %w", err))
+		}
+	}
+
+	if ic.WorkDir != "" {
+		if err := checkDirectory(bc.fs, ic.WorkDir); err != nil {
+			errs = append(errs, fmt.Errorf("work-dir: %w", err))
+		}
+	}
+
+	users, userErr := passwd.ReadUserFile(bc.fs, "etc/passwd")
+	groups, groupErr := passwd.ReadGroupFile(bc.fs, "etc/group")
+	checkUser := func(runAs string) error {
+		user, group, hasGroup := strings.Cut(runAs, ":")
+		if userErr != nil {
+			return userErr
+		}
+		if !slices.ContainsFunc(users.Entries, func(e passwd.UserEntry) bool {
+			return e.UserName == user || strconv.FormatUint(uint64(e.UID), 10) == user
+		}) {
+			return fmt.Errorf("user %s is not in /etc/passwd", user)
+		}
+		if _, err := strconv.ParseUint(group, 10, 32); !hasGroup || err == nil {
+			// Runtimes do not look numeric groups up.
+			return nil
+		}
+		if groupErr != nil {
+			return groupErr
+		}
+		if !slices.ContainsFunc(groups.Entries, func(e passwd.GroupEntry) bool { return e.GroupName == group }) {
+			return fmt.Errorf("group %s is not in /etc/group", group)
+		}
+		return nil
+	}
+	if ic.Accounts.RunAs != "" {
+		if err := checkUser(ic.Accounts.RunAs); err != nil {
+			errs = append(errs, fmt.Errorf("run-as: %w", err))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(ic.Entrypoint.Services)) {
+		svc := ic.Entrypoint.Services[name]
+		if svc.WorkDir != "" {
+			if err := checkDirectory(bc.fs, svc.WorkDir); err != nil {
+				errs = append(errs, fmt.Errorf("service %s work-dir: %w", name, err))
+			}
+		}
+		if svc.RunAs != "" {
+			if err := checkUser(svc.RunAs); err != nil {
+				errs = append(errs, fmt.Errorf("service %s run-as: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkProgram checks that the program a runtime runs for name is in fsys,
+// looking it up in the directories of pathList unless name has a slash, as
+// runtimes do. A relative name with a slash is in workDir.
+func checkProgram(fsys apkfs.FullFS, name, workDir, pathList string) error {
+	if strings.Contains(name, "/") {
+		if !path.IsAbs(name) {
+			name = path.Join("/", workDir, name)
+		}
+		return checkExecutable(fsys, name)
+	}
+	for _, dir := range strings.Split(pathList, ":") {
+		if dir == "" {
+			continue
+		}
+		if checkExecutable(fsys, path.Join(dir, name)) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not in the PATH of the image, %s", name, pathList)
+}
+
+// checkDirectory checks that p, following symlinks, is a directory of fsys.
+func checkDirectory(fsys apkfs.FullFS, p string) error {
+	fi, err := fsys.Stat(p)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", p)
+	}
+	return nil
+}
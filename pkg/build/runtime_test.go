@@ -0,0 +1,72 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestCheckRuntime(t *testing.T) {
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("/usr/bin", 0o755))
+	require.NoError(t, fsys.MkdirAll("/etc", 0o755))
+	require.NoError(t, fsys.MkdirAll("/srv/app", 0o755))
+	require.NoError(t, fsys.WriteFile("/usr/bin/app", []byte("app"), 0o755))
+	require.NoError(t, fsys.WriteFile("/srv/app/run", []byte("run"), 0o755))
+	require.NoError(t, fsys.WriteFile("/etc/passwd", []byte("root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"), 0o644))
+	require.NoError(t, fsys.WriteFile("/etc/group", []byte("root:x:0:\napp:x:1000:\n"), 0o644))
+
+	check := func(ic types.ImageConfiguration) error {
+		bc := &Context{fs: fsys, ic: ic}
+		return bc.checkRuntime()
+	}
+
+	for _, ic := range []types.ImageConfiguration{
+		{Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/app --port 8080"}},
+		// Looked up in the PATH.
+		{Entrypoint: types.ImageEntrypoint{Command: "app"}},
+		{Cmd: "app"},
+		{WorkDir: "/srv/app", Cmd: "./run"},
+		{Accounts: types.ImageAccounts{RunAs: "app"}},
+		{Accounts: types.ImageAccounts{RunAs: "1000:app"}},
+		{Accounts: types.ImageAccounts{RunAs: "app:4242"}},
+	} {
+		require.NoError(t, check(ic), "%+v", ic)
+	}
+
+	err := check(types.ImageConfiguration{
+		Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/missing"},
+		WorkDir:    "/usr/bin/app",
+		Accounts:   types.ImageAccounts{RunAs: "nobody"},
+	})
+	require.ErrorContains(t, err, "entrypoint: /usr/bin/missing:")
+	require.ErrorContains(t, err, "work-dir: /usr/bin/app is not a directory")
+	require.ErrorContains(t, err, "run-as: user nobody is not in /etc/passwd")
+
+	require.EqualError(t, check(types.ImageConfiguration{Cmd: "missing"}),
+		"entrypoint: missing is not in the PATH of the image, /usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin")
+	require.EqualError(t, check(types.ImageConfiguration{Accounts: types.ImageAccounts{RunAs: "app:wheel"}}),
+		"run-as: group wheel is not in /etc/group")
+	require.EqualError(t, check(types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{
+		Type:     "service-bundle",
+		Command:  "/usr/bin/app",
+		Services: map[string]types.ImageService{"web": {Command: "/usr/bin/app", WorkDir: "/srv/web", RunAs: "web"}},
+	}}), "service web work-dir: /srv/web: file does not exist\nservice web run-as: user web is not in /etc/passwd")
+}
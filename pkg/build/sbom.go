@@ -15,15 +15,14 @@
 package build
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -35,7 +34,9 @@ import (
 	"github.com/chainguard-dev/clog"
 
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/events"
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom"
 	soptions "chainguard.dev/apko/pkg/sbom/options"
@@ -48,7 +49,8 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 	sopt.FileName = fmt.Sprintf("sbom-%s", o.Arch.ToAPK())
 
 	// Parse the image reference
-	if len(o.Tags) > 0 {
+	// Templated tags are only rendered once the image is built.
+	if len(o.Tags) > 0 && !oci.IsTagTemplate(o.Tags[0]) {
 		tag, err := name.NewTag(o.Tags[0])
 		if err == nil {
 			sopt.ImageInfo.Tag = tag.TagStr()
@@ -61,6 +63,10 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 	sopt.ImageInfo.SourceDateEpoch = bde
 	sopt.ImageInfo.VCSUrl = ic.VCSUrl
 	sopt.ImageInfo.ImageMediaType = ggcrtypes.OCIManifestSchema1
+	if ic.SBOM != nil {
+		sopt.IncludeFiles = ic.SBOM.IncludeFiles
+		sopt.IncludeLicenseTexts = ic.SBOM.LicenseTexts
+	}
 
 	sopt.OutputDir = o.TempDir()
 	if o.SBOMPath != "" {
@@ -70,6 +76,18 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 	return sopt
 }
 
+// sbomAnnotations returns the annotations of the artifacts that attach the
+// SBOMs of ic, created at created.
+func sbomAnnotations(ic types.ImageConfiguration, created time.Time) map[string]string {
+	annotations := map[string]string{
+		"org.opencontainers.image.created": created.UTC().Format(time.RFC3339),
+	}
+	if ic.SBOM != nil {
+		maps.Copy(annotations, ic.SBOM.Annotations)
+	}
+	return annotations
+}
+
 func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architecture, img v1.Image) ([]types.SBOM, error) {
 	log := clog.FromContext(ctx).With("arch", arch.ToAPK())
 	ctx = clog.WithLogger(ctx, log)
@@ -112,6 +130,8 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 	}
 
 	s.Packages = pkgs
+	s.PackageVerifications = bc.apk.PackageVerifications()
+	s.StrippedFiles = bc.stripped
 
 	// Get the image digest
 	h, err := img.Digest()
@@ -122,81 +142,40 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 	s.ImageInfo.ImageDigest = h.String()
 	s.ImageInfo.Arch = arch
 
-	var sboms = make([]types.SBOM, 0)
-	for _, gen := range bc.o.SBOMGenerators {
-		filename := filepath.Join(s.OutputDir, s.FileName+"."+gen.Ext())
-		if err := gen.Generate(ctx, &s, filename); err != nil {
-			return nil, fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
-		}
+	done := events.StartPhase(ctx, "sbom", arch.ToAPK())
+	paths, err := sbom.Generate(ctx, &s, bc.o.SBOMGenerators...)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	var sboms = make([]types.SBOM, 0, len(paths))
+	for i, gen := range bc.o.SBOMGenerators {
 		sboms = append(sboms, types.SBOM{
-			Path:   filename,
+			Path:   paths[i],
 			Format: gen.Key(),
 			Arch:   arch.String(),
 			Digest: h,
+
+			Annotations: sbomAnnotations(bc.ic, bde),
 		})
 	}
 	return sboms, nil
 }
 
-type ReleaseData struct {
-	ID         string
-	Name       string
-	PrettyName string
-	VersionID  string
-}
+// ReleaseData is the subset of /etc/os-release recorded in SBOMs.
+type ReleaseData = sbom.ReleaseData
 
 // fetchFSReleaseData is a helper that reads the information from /etc/os-release
-//
-// If no os-release file is found, it returns a Data struct with ID set to "unknown".
 func fetchFSReleaseData(fsys fs.FS) (*ReleaseData, error) {
-	f, err := fsys.Open("/etc/os-release")
-	if errors.Is(err, fs.ErrNotExist) {
-		return &ReleaseData{
-			ID:        "unknown",
-			Name:      "apko-generated image",
-			VersionID: "unknown",
-		}, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("opening os-release: %w", err)
-	}
-	defer f.Close()
-
-	return ParseReleaseData(f)
+	return sbom.ReadReleaseData(fsys)
 }
 
 // ParseReleaseData reads the os-release data from the provided io.Reader
+//
+// Deprecated: use sbom.ParseReleaseData.
 func ParseReleaseData(osRelease io.Reader) (*ReleaseData, error) {
-	scanner := bufio.NewScanner(osRelease)
-
-	kv := map[string]string{}
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		before, after, ok := strings.Cut(line, "=")
-		if !ok {
-			return nil, fmt.Errorf("invalid os-release line: %q", line)
-		}
-
-		kv[before] = strings.Trim(after, "\"")
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading os-release: %w", err)
-	}
-
-	return &ReleaseData{
-		ID:         kv["ID"],
-		Name:       kv["NAME"],
-		PrettyName: kv["PRETTY_NAME"],
-		VersionID:  kv["VERSION_ID"],
-	}, nil
+	return sbom.ParseReleaseData(osRelease)
 }
 
 func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageConfiguration, indexDigest name.Digest, imgs map[types.Architecture]v1.Image) ([]types.SBOM, error) {
@@ -262,6 +241,8 @@ func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageCon
 			Path:   filename,
 			Format: gen.Key(),
 			Digest: h,
+
+			Annotations: sbomAnnotations(ic, o.SourceDateEpoch),
 		})
 	}
 
@@ -0,0 +1,407 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	// ScriptletSandboxProot runs scriptlets with proot, as a fake root user
+	// that needs no privileges, and through qemu-user for other
+	// architectures than the host's.
+	ScriptletSandboxProot = "proot"
+	// ScriptletSandboxChroot runs scriptlets with chroot, which needs root,
+	// and binfmt_misc for other architectures than the host's.
+	ScriptletSandboxChroot = "chroot"
+	// ScriptletSandboxBwrap runs scriptlets with bubblewrap, as root in a
+	// user namespace, and binfmt_misc for other architectures than the
+	// host's.
+	ScriptletSandboxBwrap = "bwrap"
+
+	// scriptletPath is where each scriptlet is written in the root it runs
+	// in.
+	scriptletPath = ".apko-scriptlet"
+)
+
+// scriptletNames are the scriptlets run, in the order they run in for each
+// package. As the files of every package are installed before any
+// scriptlet runs, pre-install scriptlets see them already.
+var scriptletNames = []string{".pre-install", ".post-install"}
+
+// sandboxCommand returns the command that runs the program args[0] of root,
+// for arch, with the rest of args, with root as the root directory.
+type sandboxCommand func(ctx context.Context, root string, arch types.Architecture, args ...string) (*exec.Cmd, error)
+
+var scriptletSandboxes = map[string]sandboxCommand{
+	ScriptletSandboxProot:  prootCommand,
+	ScriptletSandboxChroot: chrootCommand,
+	ScriptletSandboxBwrap:  bwrapCommand,
+}
+
+// checkSandboxPrivileges fails if sandbox cannot run with the privileges
+// apko has, so that a build fails before it installs anything rather than
+// once it runs the first scriptlet.
+func checkSandboxPrivileges(sandbox string) error {
+	if sandbox == ScriptletSandboxChroot && os.Geteuid() != 0 {
+		return fmt.Errorf("the %s sandbox needs root; use %s or %s to run without privileges", ScriptletSandboxChroot, ScriptletSandboxProot, ScriptletSandboxBwrap)
+	}
+	return nil
+}
+
+func hostRuns(arch types.Architecture) bool {
+	host := types.ParseArchitecture(runtime.GOARCH)
+	return arch == host || arch.Compatible(host)
+}
+
+func prootCommand(ctx context.Context, root string, arch types.Architecture, args ...string) (*exec.Cmd, error) {
+	proot, err := exec.LookPath("proot")
+	if err != nil {
+		return nil, fmt.Errorf("the proot sandbox requires proot: %w", err)
+	}
+	pargs := []string{"-0", "-r", root, "-w", "/"}
+	if !hostRuns(arch) {
+		qemu, err := exec.LookPath("qemu-" + arch.ToQEmu())
+		if err != nil {
+			return nil, fmt.Errorf("the proot sandbox requires qemu-%s to run %s programs: %w", arch.ToQEmu(), arch.ToAPK(), err)
+		}
+		pargs = append(pargs, "-q", qemu)
+	}
+	return exec.CommandContext(ctx, proot, append(pargs, args...)...), nil
+}
+
+func chrootCommand(ctx context.Context, root string, _ types.Architecture, args ...string) (*exec.Cmd, error) {
+	chroot, err := exec.LookPath("chroot")
+	if err != nil {
+		return nil, fmt.Errorf("the chroot sandbox requires chroot: %w", err)
+	}
+	return exec.CommandContext(ctx, chroot, append([]string{root}, args...)...), nil
+}
+
+func bwrapCommand(ctx context.Context, root string, _ types.Architecture, args ...string) (*exec.Cmd, error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, fmt.Errorf("the bwrap sandbox requires bwrap: %w", err)
+	}
+	bargs := []string{
+		"--bind", root, "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--unshare-all",
+		"--uid", "0", "--gid", "0",
+		"--chdir", "/",
+		"--die-with-parent",
+		"--",
+	}
+	return exec.CommandContext(ctx, bwrap, append(bargs, args...)...), nil
+}
+
+// runScriptlets runs the scriptlets of the installed packages that are
+// allowed to, in a copy of the filesystem on disk, and copies what they
+// changed back.
+func (bc *Context) runScriptlets(ctx context.Context) error {
+	log := clog.FromContext(ctx)
+
+	all, err := bc.apk.Scriptlets()
+	if err != nil {
+		return err
+	}
+	var run []int
+	for i, s := range all {
+		if !slices.Contains(scriptletNames, s.Name) {
+			continue
+		}
+		if len(bc.o.ScriptletPackages) != 0 && !slices.Contains(bc.o.ScriptletPackages, s.Package.Name) {
+			log.Debugf("not running %s of %s, which is not allowed to run scriptlets", s.Name, s.Package.Name)
+			continue
+		}
+		run = append(run, i)
+	}
+	if len(run) == 0 {
+		return nil
+	}
+	// Each package runs its pre-install scriptlet before its post-install one.
+	slices.SortStableFunc(run, func(i, j int) int {
+		if all[i].Package != all[j].Package {
+			return 0
+		}
+		return slices.Index(scriptletNames, all[i].Name) - slices.Index(scriptletNames, all[j].Name)
+	})
+
+	command := scriptletSandboxes[bc.o.ScriptletSandbox]
+	if command == nil {
+		command = prootCommand
+	}
+
+	root, err := os.MkdirTemp(bc.o.TempDir(), "scriptlets-")
+	if err != nil {
+		return fmt.Errorf("creating scriptlet root: %w", err)
+	}
+	defer os.RemoveAll(root)
+
+	before, err := exportFS(bc.fs, root)
+	if err != nil {
+		return fmt.Errorf("copying filesystem for scriptlets: %w", err)
+	}
+
+	script := filepath.Join(root, scriptletPath)
+	for _, i := range run {
+		s := all[i]
+		log.Infof("running %s of %s", s.Name, s.Package.Name)
+		if err := os.WriteFile(script, s.Script, 0o755); err != nil {
+			return fmt.Errorf("writing %s of %s: %w", s.Name, s.Package.Name, err)
+		}
+		cmd, err := command(ctx, root, bc.Arch(), "/"+scriptletPath, s.Package.Version)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		cmd.Env = []string{"PATH=/usr/sbin:/usr/bin:/sbin:/bin", "HOME=/root"}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running %s of %s: %w: %s", s.Name, s.Package.Name, err, strings.TrimSpace(out.String()))
+		}
+		log.Debugf("%s of %s: %s", s.Name, s.Package.Name, out.String())
+	}
+	if err := os.Remove(script); err != nil {
+		return err
+	}
+
+	if err := importFS(root, bc.fs, before); err != nil {
+		return fmt.Errorf("copying back what scriptlets changed: %w", err)
+	}
+	return nil
+}
+
+// exportedEntry is what exportFS knows of a file it exported.
+type exportedEntry struct {
+	mode     fs.FileMode
+	uid, gid int
+	link     string
+	// exported is the mode the file was exported with, which is what it
+	// still has on disk unless a scriptlet changed it.
+	exported fs.FileMode
+}
+
+// exportsOwners reports whether exportFS gives the files it exports their
+// owners, which only root can. Otherwise, what scriptlets chown is lost.
+func exportsOwners() bool {
+	return os.Geteuid() == 0
+}
+
+// exportFS writes the directories, regular files and symlinks of fsys under
+// dir, and returns what they were, by path.
+func exportFS(fsys apkfs.FullFS, dir string) (map[string]exportedEntry, error) {
+	entries := map[string]exportedEntry{}
+	var dirs []string
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+		fi, err := fsys.Lstat(path)
+		if err != nil {
+			return err
+		}
+		e := exportedEntry{mode: fi.Mode(), exported: fi.Mode()}
+		if uid, gid, ok := fileOwner(fi); ok {
+			e.uid, e.gid = uid, gid
+		}
+		target := filepath.Join(dir, path)
+		switch {
+		case fi.IsDir():
+			// Keep directories writable until everything is exported.
+			if err := os.Mkdir(target, 0o755); err != nil {
+				return err
+			}
+			e.exported |= 0o700
+			dirs = append(dirs, path)
+		case fi.Mode()&fs.ModeSymlink != 0:
+			if e.link, err = fsys.Readlink(path); err != nil {
+				return err
+			}
+			if err := os.Symlink(e.link, target); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			b, err := fsys.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			e.exported |= 0o200
+			if err := os.WriteFile(target, b, e.exported.Perm()); err != nil {
+				return err
+			}
+			// WriteFile is subject to the umask.
+			if err := os.Chmod(target, e.exported.Perm()); err != nil {
+				return err
+			}
+		default:
+			// Devices and such are not needed by scriptlets.
+			return nil
+		}
+		if exportsOwners() {
+			if err := os.Lchown(target, e.uid, e.gid); err != nil {
+				return err
+			}
+		}
+		entries[path] = e
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, path := range dirs {
+		if err := os.Chmod(filepath.Join(dir, path), entries[path].exported.Perm()); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// importFS copies into fsys what was changed under dir since exportFS
+// returned before: new and modified files, and removals, with the modes and,
+// if exportFS gave files their owners, the owners they have under dir. New
+// files are owned by root otherwise, and the others keep their owner.
+func importFS(dir string, fsys apkfs.FullFS, before map[string]exportedEntry) error {
+	seen := map[string]bool{}
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		path, err := filepath.Rel(dir, p)
+		if err != nil || path == "." {
+			return err
+		}
+		seen[path] = true
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		prev, existed := before[path]
+		if existed && prev.mode.Type() != fi.Mode().Type() {
+			if err := fsys.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			existed = false
+		}
+
+		mode := fi.Mode().Perm()
+		if existed && mode == prev.exported.Perm() {
+			// Exported files and directories were made writable.
+			mode = prev.mode.Perm()
+		}
+		uid, gid := prev.uid, prev.gid
+		if !existed {
+			uid, gid = 0, 0
+		}
+		if diskUID, diskGID, ok := fileOwner(fi); ok && exportsOwners() {
+			uid, gid = diskUID, diskGID
+		}
+
+		switch {
+		case fi.IsDir():
+			if !existed {
+				if err := fsys.MkdirAll(path, mode); err != nil {
+					return err
+				}
+			}
+		case fi.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if existed && prev.link == link {
+				return nil
+			}
+			if existed {
+				if err := fsys.Remove(path); err != nil {
+					return err
+				}
+			}
+			// Chmod and Chown would follow the link.
+			return fsys.Symlink(link, path)
+		case fi.Mode().IsRegular():
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			// Modification times tell nothing, scriptlets may set them.
+			if old, err := fsys.ReadFile(path); !existed || err != nil || !bytes.Equal(old, b) {
+				if existed {
+					if err := fsys.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return err
+					}
+				}
+				if err := fsys.WriteFile(path, b, mode); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil
+		}
+		if err := fsys.Chmod(path, mode); err != nil {
+			return err
+		}
+		return fsys.Chown(path, uid, gid)
+	}); err != nil {
+		return err
+	}
+
+	// Remove what is gone, deepest first.
+	var gone []string
+	for path := range before {
+		if !seen[path] {
+			gone = append(gone, path)
+		}
+	}
+	slices.Sort(gone)
+	slices.Reverse(gone)
+	for _, path := range gone {
+		if err := fsys.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileOwner returns the owner of fi, if its filesystem records one.
+func fileOwner(fi fs.FileInfo) (uid, gid int, ok bool) {
+	switch sys := fi.Sys().(type) {
+	case *tar.Header:
+		return sys.Uid, sys.Gid, true
+	case *syscall.Stat_t:
+		return int(sys.Uid), int(sys.Gid), true
+	}
+	return 0, 0, false
+}
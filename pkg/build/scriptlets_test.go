@@ -0,0 +1,123 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestExportImportFS(t *testing.T) {
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.MkdirAll("var/lib/gone", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/kept", []byte("kept"), 0o600))
+	require.NoError(t, fsys.Chown("etc/kept", 1000, 1000))
+	require.NoError(t, fsys.WriteFile("etc/changed", []byte("before"), 0o644))
+	require.NoError(t, fsys.Chown("etc/changed", 42, 42))
+	require.NoError(t, fsys.WriteFile("var/lib/gone/file", []byte("gone"), 0o644))
+	require.NoError(t, fsys.Symlink("kept", "etc/link"))
+	require.NoError(t, fsys.WriteFile("etc/same-size", []byte("before"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/script", []byte("#!/bin/sh"), 0o644))
+	require.NoError(t, fsys.MkdirAll("var/lib/private", 0o755))
+	require.NoError(t, fsys.Chown("var/lib/private", 42, 42))
+
+	dir := t.TempDir()
+	before, err := exportFS(fsys, dir)
+	require.NoError(t, err)
+
+	// What a scriptlet might do.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "etc/changed"), []byte("after"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "etc/added"), []byte("added"), 0o640))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "var/lib/gone")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "etc/link")))
+	require.NoError(t, os.Symlink("changed", filepath.Join(dir, "etc/link")))
+	fi, err := os.Stat(filepath.Join(dir, "etc/same-size"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "etc/same-size"), []byte("BEFORE"), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "etc/same-size"), fi.ModTime(), fi.ModTime()))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "etc/script"), 0o700))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "var/lib/private"), 0o700))
+	// Owners only survive the round trip when running as root.
+	owner := 42
+	if exportsOwners() {
+		owner = 7
+		require.NoError(t, os.Chown(filepath.Join(dir, "etc/changed"), 7, 7))
+		require.NoError(t, os.Chown(filepath.Join(dir, "var/lib/private"), 7, 7))
+	}
+
+	require.NoError(t, importFS(dir, fsys, before))
+
+	for path, want := range map[string]string{
+		"etc/kept":      "kept",
+		"etc/changed":   "after",
+		"etc/added":     "added",
+		"etc/same-size": "BEFORE",
+	} {
+		got, err := fsys.ReadFile(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want, string(got), path)
+	}
+	link, err := fsys.Readlink("etc/link")
+	require.NoError(t, err)
+	require.Equal(t, "changed", link)
+	_, err = fsys.Stat("var/lib/gone")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	for path, want := range map[string]struct {
+		mode     fs.FileMode
+		uid, gid int
+	}{
+		"etc/kept":        {0o600, 1000, 1000},
+		"etc/changed":     {0o644, owner, owner},
+		"etc/added":       {0o640, 0, 0},
+		"etc/script":      {0o700, 0, 0},
+		"var/lib/private": {0o700, owner, owner},
+		"var/lib":         {0o755, 0, 0},
+	} {
+		fi, err := fsys.Stat(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want.mode, fi.Mode().Perm(), path)
+		uid, gid, ok := fileOwner(fi)
+		require.True(t, ok, path)
+		require.Equal(t, want.uid, uid, path)
+		require.Equal(t, want.gid, gid, path)
+	}
+}
+
+func TestWithRunScriptlets(t *testing.T) {
+	bc := &Context{}
+	require.NoError(t, WithRunScriptlets(true, "", []string{"foo"})(bc))
+	require.True(t, bc.o.RunScriptlets)
+	require.Equal(t, ScriptletSandboxProot, bc.o.ScriptletSandbox)
+	require.Equal(t, []string{"foo"}, bc.o.ScriptletPackages)
+
+	require.ErrorContains(t, WithRunScriptlets(true, "docker", nil)(bc), `unknown scriptlet sandbox "docker"`)
+
+	require.NoError(t, WithRunScriptlets(false, "docker", nil)(bc))
+	require.False(t, bc.o.RunScriptlets)
+
+	if os.Geteuid() == 0 {
+		require.NoError(t, WithRunScriptlets(true, ScriptletSandboxChroot, nil)(bc))
+	} else {
+		require.ErrorContains(t, WithRunScriptlets(true, ScriptletSandboxChroot, nil)(bc), "needs root")
+	}
+}
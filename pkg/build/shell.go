@@ -0,0 +1,89 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// defaultShell is what Shell runs when it is given no command.
+var defaultShell = []string{"/bin/sh", "-l"}
+
+// Shell runs command, or a login shell if it is empty, in a copy of the
+// filesystem built by BuildImage, with sandbox, one of the scriptlet
+// sandboxes, using stdin, stdout and stderr. What the command changes is
+// thrown away when it exits.
+func (bc *Context) Shell(ctx context.Context, sandbox string, stdin io.Reader, stdout, stderr io.Writer, command ...string) error {
+	log := clog.FromContext(ctx)
+
+	sandboxCmd, ok := scriptletSandboxes[sandbox]
+	if !ok {
+		return fmt.Errorf("unknown sandbox %q, must be %s, %s or %s", sandbox, ScriptletSandboxProot, ScriptletSandboxChroot, ScriptletSandboxBwrap)
+	}
+	if err := checkSandboxPrivileges(sandbox); err != nil {
+		return err
+	}
+	if len(command) == 0 {
+		command = defaultShell
+	}
+
+	root, err := os.MkdirTemp(bc.o.TempDir(), "shell-")
+	if err != nil {
+		return fmt.Errorf("creating shell root: %w", err)
+	}
+	defer os.RemoveAll(root)
+	if _, err := exportFS(bc.fs, root); err != nil {
+		return fmt.Errorf("copying filesystem for the shell: %w", err)
+	}
+
+	cmd, err := sandboxCmd(ctx, root, bc.Arch(), command...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	cmd.Env = shellEnv(bc.ic.Environment)
+
+	log.Infof("running %v in the %s filesystem, with %s", command, bc.Arch(), sandbox)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %v: %w", command, err)
+	}
+	return nil
+}
+
+// shellEnv returns the environment of a shell in an image with environment,
+// keeping the terminal of the host.
+func shellEnv(environment map[string]string) []string {
+	env := map[string]string{
+		"PATH": "/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin",
+		"HOME": "/root",
+	}
+	if term, ok := os.LookupEnv("TERM"); ok {
+		env["TERM"] = term
+	}
+	maps.Copy(env, environment)
+
+	vars := make([]string, 0, len(env))
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		vars = append(vars, k+"="+env[k])
+	}
+	return vars
+}
@@ -0,0 +1,61 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestShell(t *testing.T) {
+	// A chroot that shows what it would run, and in what.
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "chroot"), []byte(`#!/bin/sh
+root=$1
+shift
+echo "$@"
+cat "$root/etc/motd"
+echo "$GREETING"
+`), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/motd", []byte("welcome\n"), 0o644))
+	bc := &Context{
+		fs: fsys,
+		o:  options.Options{TempDirPath: t.TempDir(), Arch: types.ParseArchitecture("amd64")},
+		ic: types.ImageConfiguration{Environment: map[string]string{"GREETING": "hello"}},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, bc.Shell(context.Background(), ScriptletSandboxChroot, nil, &out, &out))
+	require.Equal(t, "/bin/sh -l\nwelcome\nhello\n", out.String())
+
+	out.Reset()
+	require.NoError(t, bc.Shell(context.Background(), ScriptletSandboxChroot, nil, &out, &out, "ls", "/etc"))
+	require.Equal(t, "ls /etc\nwelcome\nhello\n", out.String())
+
+	require.ErrorContains(t, bc.Shell(context.Background(), "docker", nil, &out, &out), `unknown sandbox "docker"`)
+}
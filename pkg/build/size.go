@@ -0,0 +1,108 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// sizeBreakdownPackages is how many of the largest packages are listed when
+// an image is over its size budget.
+const sizeBreakdownPackages = 10
+
+// checkSize fails if img, built by bc, or any of its layers is larger than
+// the max-size of the build.
+func (bc *Context) checkSize(img v1.Image) error {
+	budget := types.ImageSizeBudget{}
+	if bc.ic.MaxSize != nil {
+		budget = *bc.ic.MaxSize
+	}
+	budget.Image = cmp.Or(bc.o.MaxSize.Image, budget.Image)
+	budget.Layer = cmp.Or(bc.o.MaxSize.Layer, budget.Layer)
+	maxImage, err := budget.ImageBytes()
+	if err != nil {
+		return err
+	}
+	maxLayer, err := budget.LayerBytes()
+	if err != nil {
+		return err
+	}
+	if maxImage == 0 && maxLayer == 0 {
+		return nil
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("reading layers: %w", err)
+	}
+	var total int64
+	var over []string
+	for i, l := range layers {
+		size, err := l.Size()
+		if err != nil {
+			return fmt.Errorf("reading size of layer %d: %w", i, err)
+		}
+		total += size
+		if maxLayer != 0 && size > maxLayer {
+			over = append(over, fmt.Sprintf("layer %d is %s, over the max-size of %s", i, humanize.IBytes(uint64(size)), humanize.IBytes(uint64(maxLayer)))) //nolint:gosec // sizes are positive
+		}
+	}
+	if maxImage != 0 && total > maxImage {
+		over = append(over, fmt.Sprintf("image is %s, over the max-size of %s", humanize.IBytes(uint64(total)), humanize.IBytes(uint64(maxImage)))) //nolint:gosec // sizes are positive
+	}
+	if len(over) == 0 {
+		return nil
+	}
+
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	return fmt.Errorf("%s compressed; the largest packages installed are:\n%s", strings.Join(over, ", "), sizeBreakdown(installed))
+}
+
+// sizeBreakdown lists the largest of pkgs by installed size, one per line,
+// with how much of the installed size of all of them each is.
+func sizeBreakdown(pkgs []*apk.InstalledPackage) string {
+	pkgs = slices.Clone(pkgs)
+	slices.SortStableFunc(pkgs, func(a, b *apk.InstalledPackage) int {
+		return cmp.Or(cmp.Compare(b.InstalledSize, a.InstalledSize), cmp.Compare(a.Name, b.Name))
+	})
+	var total uint64
+	for _, pkg := range pkgs {
+		total += pkg.InstalledSize
+	}
+	var b strings.Builder
+	for _, pkg := range pkgs[:min(len(pkgs), sizeBreakdownPackages)] {
+		percent := 0.0
+		if total != 0 {
+			percent = 100 * float64(pkg.InstalledSize) / float64(total)
+		}
+		fmt.Fprintf(&b, "  %10s %5.1f%%  %s-%s\n", humanize.IBytes(pkg.InstalledSize), percent, pkg.Name, pkg.Version)
+	}
+	if n := len(pkgs) - sizeBreakdownPackages; n > 0 {
+		fmt.Fprintf(&b, "  and %d more packages, %s installed in all\n", n, humanize.IBytes(total))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
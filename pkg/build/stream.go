@@ -0,0 +1,84 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	v1tar "github.com/google/go-containerregistry/pkg/v1/tarball"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// ImageLayoutToStreamedLayer is like ImageLayoutToLayer, but nothing is
+// written to disk: the layer is compressed straight from the filesystem of
+// BuildImage whenever its contents are read. This trades CPU, as computing
+// the digests and pushing each read the filesystem again, for not writing
+// and re-reading a tarball the size of the image.
+//
+// The layer is identical to the one of ImageLayoutToLayer. eStargz layers
+// are built from the whole tarball, so they cannot be streamed.
+func (bc *Context) ImageLayoutToStreamedLayer(ctx context.Context) (v1.Layer, error) {
+	ctx, span := otel.Tracer("apko").Start(ctx, "ImageLayoutToStreamedLayer")
+	defer span.End()
+
+	if bc.o.LayerFormat == LayerFormatEstargz {
+		return nil, fmt.Errorf("%s layers cannot be streamed", LayerFormatEstargz)
+	}
+	if err := bc.checkPaths(ctx); err != nil {
+		return nil, err
+	}
+
+	l, err := v1tar.LayerFromOpener(func() (io.ReadCloser, error) {
+		return streamLayer(ctx, bc.fs), nil
+	}, v1tar.WithMediaType(v1types.OCILayer))
+	if err != nil {
+		return nil, fmt.Errorf("streaming layer: %w", err)
+	}
+	bc.emitLayerBuilt(ctx, l)
+
+	return l, nil
+}
+
+// streamLayer returns the gzipped tarball of fsys, written as it is read.
+func streamLayer(ctx context.Context, fsys apkfs.FullFS) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		buf := pooledBufioWriter(pw)
+		defer bufioPool.Put(buf)
+		zw := pooledGzipWriter(buf)
+		defer pgzipPool.Put(zw)
+
+		tw := tar.NewWriter(zw)
+		err := writeTar(ctx, tw, fsys)
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		if err == nil {
+			err = buf.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
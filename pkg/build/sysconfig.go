@@ -0,0 +1,77 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	sysctlConfPath  = "etc/sysctl.d/90-apko.conf"
+	limitsConfPath  = "etc/security/limits.d/90-apko.conf"
+	modulesConfPath = "etc/modules-load.d/apko.conf"
+)
+
+// writeSystemConfig writes the files of /etc that configure the kernel
+// parameters, resource limits and kernel modules of ic, when it sets any.
+func writeSystemConfig(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
+	if len(ic.Sysctl) != 0 {
+		var b strings.Builder
+		for _, k := range slices.Sorted(maps.Keys(ic.Sysctl)) {
+			fmt.Fprintf(&b, "%s = %s\n", k, ic.Sysctl[k])
+		}
+		if err := writeConfFile(fsys, sysctlConfPath, b.String()); err != nil {
+			return err
+		}
+	}
+
+	if len(ic.Limits) != 0 {
+		var b strings.Builder
+		for _, l := range ic.Limits {
+			typ := l.Type
+			if typ == "" {
+				typ = "-"
+			}
+			fmt.Fprintf(&b, "%s\t%s\t%s\t%s\n", l.Domain, typ, l.Item, l.Value)
+		}
+		if err := writeConfFile(fsys, limitsConfPath, b.String()); err != nil {
+			return err
+		}
+	}
+
+	if len(ic.Modules) != 0 {
+		if err := writeConfFile(fsys, modulesConfPath, strings.Join(ic.Modules, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeConfFile(fsys apkfs.FullFS, path, content string) error {
+	if err := fsys.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating directory of /%s: %w", path, err)
+	}
+	if err := fsys.WriteFile(path, []byte("# Generated by apko\n"+content), 0o644); err != nil {
+		return fmt.Errorf("writing /%s: %w", path, err)
+	}
+	return nil
+}
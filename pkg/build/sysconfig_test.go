@@ -0,0 +1,54 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func TestWriteSystemConfig(t *testing.T) {
+	fsys := tarfs.New()
+	require.NoError(t, writeSystemConfig(fsys, &types.ImageConfiguration{}))
+	_, err := fsys.Stat("etc")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, writeSystemConfig(fsys, &types.ImageConfiguration{
+		Sysctl: map[string]string{
+			"net.ipv4.ip_forward": "1",
+			"net.core.somaxconn":  "1024",
+		},
+		Limits: []types.Limit{
+			{Domain: "*", Item: "nofile", Value: "65536"},
+			{Domain: "@app", Type: "soft", Item: "nproc", Value: "unlimited"},
+		},
+		Modules: []string{"overlay", "br_netfilter"},
+	}))
+
+	for path, want := range map[string]string{
+		"etc/sysctl.d/90-apko.conf":          "# Generated by apko\nnet.core.somaxconn = 1024\nnet.ipv4.ip_forward = 1\n",
+		"etc/security/limits.d/90-apko.conf": "# Generated by apko\n*\t-\tnofile\t65536\n@app\tsoft\tnproc\tunlimited\n",
+		"etc/modules-load.d/apko.conf":       "# Generated by apko\noverlay\nbr_netfilter\n",
+	} {
+		b, err := fsys.ReadFile(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want, string(b), path)
+	}
+}
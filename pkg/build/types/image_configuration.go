@@ -19,13 +19,20 @@ import (
 	"fmt"
 	"hash"
 	"maps"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"gopkg.in/yaml.v3"
 
 	"github.com/chainguard-dev/clog"
@@ -54,14 +61,85 @@ func (ic *ImageConfiguration) ProbeVCSUrl(ctx context.Context, imageConfigPath s
 	}
 }
 
+type allowUnknownFieldsKey struct{}
+
+// WithAllowUnknownFields returns a context in which configurations are loaded
+// ignoring the fields they have that are not configuration fields, with a
+// warning, rather than failing on them. This is an escape hatch for
+// configurations that relied on unknown fields being ignored, as typos are
+// then silently ignored too.
+func WithAllowUnknownFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowUnknownFieldsKey{}, true)
+}
+
+func allowsUnknownFields(ctx context.Context) bool {
+	allow, _ := ctx.Value(allowUnknownFieldsKey{}).(bool)
+	return allow
+}
+
 // Parse a configuration blob into an ImageConfiguration struct.
-func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, includePaths []string, configHasher hash.Hash) error {
+// src is where the blob came from, which relative references of remote
+// configurations are resolved against, and chain the configurations that
+// included it.
+func (ic *ImageConfiguration) parse(ctx context.Context, src string, chain []string, configData []byte, includePaths []string, configHasher hash.Hash, vars *Variables) error {
 	log := clog.FromContext(ctx)
 	configHasher.Write(configData)
 	dec := yaml.NewDecoder(strings.NewReader(string(configData)))
 	dec.KnownFields(true)
 	if err := dec.Decode(ic); err != nil {
-		return fmt.Errorf("failed to parse image configuration: %w", err)
+		if !allowsUnknownFields(ctx) {
+			return fmt.Errorf("failed to parse image configuration: %w", err)
+		}
+		// Decode again without failing on unknown fields, which were only
+		// the problem if this succeeds.
+		if err := yaml.Unmarshal(configData, ic); err != nil {
+			return fmt.Errorf("failed to parse image configuration: %w", err)
+		}
+		log.Warnf("ignoring what is not understood in %s: %v", src, err)
+	}
+
+	if !knownEntrypointType(ic.Entrypoint.Type) {
+		log.Warnf("entrypoint type %q of %s is not one of service-bundle, tini, dumb-init or none, running the command as it is", ic.Entrypoint.Type, src)
+	}
+
+	if isRemoteConfig(src) {
+		// A remote configuration must not read the files of the build machine.
+		if len(ic.Contents.Files) != 0 {
+			return fmt.Errorf("remote configuration %s cannot copy files into the image", src)
+		}
+		if ic.Certificates != nil {
+			for _, c := range ic.Certificates.Additional {
+				if c.Path != "" {
+					return fmt.Errorf("remote configuration %s cannot read certificate %s from a file", src, c.Name)
+				}
+			}
+		}
+		if ic.Include != "" {
+			include, err := resolveRemote(src, ic.Include)
+			if err != nil {
+				return fmt.Errorf("resolving include: %w", err)
+			}
+			ic.Include = include
+		}
+		for i, k := range ic.Contents.Keyring {
+			key, err := resolveRemote(src, k)
+			if err != nil {
+				return fmt.Errorf("resolving keyring: %w", err)
+			}
+			ic.Contents.Keyring[i] = key
+		}
+	} else {
+		config := chain[len(chain)-1]
+		for i, f := range ic.Contents.Files {
+			ic.Contents.Files[i].Source = resolveLocal(config, f.Source, includePaths)
+		}
+		if ic.Certificates != nil {
+			for i, c := range ic.Certificates.Additional {
+				if c.Path != "" {
+					ic.Certificates.Additional[i].Path = resolveLocal(config, c.Path, includePaths)
+				}
+			}
+		}
 	}
 
 	if ic.Include != "" {
@@ -69,7 +147,7 @@ func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, incl
 
 		included := &ImageConfiguration{}
 
-		if err := included.Load(ctx, ic.Include, includePaths, configHasher); err != nil {
+		if err := included.load(ctx, ic.Include, chain, includePaths, configHasher, vars); err != nil {
 			return fmt.Errorf("failed to read include file: %w", err)
 		}
 
@@ -87,12 +165,17 @@ func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, incl
 	if ic.Contents.BaseImage != nil {
 		if !cmp.Equal((ImageEntrypoint{}), ic.Entrypoint) ||
 			ic.Cmd != "" ||
+			len(ic.CmdArgs) != 0 ||
 			ic.StopSignal != "" ||
+			ic.Healthcheck != nil ||
 			ic.WorkDir != "" ||
 			!cmp.Equal((ImageAccounts{}), ic.Accounts) ||
 			len(ic.Environment) != 0 ||
 			len(ic.Paths) != 0 ||
-			len(ic.Annotations) != 0 {
+			len(ic.Annotations) != 0 ||
+			len(ic.Ports) != 0 ||
+			len(ic.Labels) != 0 ||
+			ic.AnnotationLabels != nil {
 			return fmt.Errorf("when using base image, the only supported image specification are: contents, archs and includes")
 		}
 	}
@@ -114,8 +197,9 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	if reflect.ValueOf(target.Entrypoint).IsZero() {
 		target.Entrypoint = ic.Entrypoint
 	}
-	if target.Cmd == "" {
+	if target.Cmd == "" && len(target.CmdArgs) == 0 {
 		target.Cmd = ic.Cmd
+		target.CmdArgs = ic.CmdArgs
 	}
 	if target.StopSignal == "" {
 		target.StopSignal = ic.StopSignal
@@ -123,18 +207,53 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	if target.WorkDir == "" {
 		target.WorkDir = ic.WorkDir
 	}
+	if target.Healthcheck == nil {
+		target.Healthcheck = ic.Healthcheck
+	}
+	if target.OS == nil {
+		target.OS = ic.OS
+	}
+	if target.OSRelease == nil {
+		target.OSRelease = ic.OSRelease
+	}
+	if target.Wasm == nil {
+		target.Wasm = ic.Wasm
+	}
+	if target.Disk == nil {
+		target.Disk = ic.Disk
+	}
 	if target.Layering == nil {
 		target.Layering = ic.Layering
 	}
+	if target.MaxSize == nil {
+		target.MaxSize = ic.MaxSize
+	}
 	if target.Certificates == nil {
 		target.Certificates = ic.Certificates
 	}
+	if target.SBOM == nil {
+		target.SBOM = ic.SBOM
+	}
 	if len(target.Archs) == 0 {
 		target.Archs = ic.Archs
 	}
+	for k, v := range ic.ArchOverrides {
+		if target.ArchOverrides == nil {
+			target.ArchOverrides = make(map[string]ImageConfiguration, len(ic.ArchOverrides))
+		}
+		if _, ok := target.ArchOverrides[k]; !ok {
+			target.ArchOverrides[k] = v
+		}
+	}
 	if err := ic.Accounts.MergeInto(&target.Accounts); err != nil {
 		return err
 	}
+	if target.BaseEnvironment == nil {
+		target.BaseEnvironment = ic.BaseEnvironment
+	}
+	if target.AnnotationLabels == nil {
+		target.AnnotationLabels = ic.AnnotationLabels
+	}
 	if target.Environment == nil && ic.Environment != nil {
 		target.Environment = maps.Clone(ic.Environment)
 	} else {
@@ -145,6 +264,18 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 		}
 	}
 	target.Paths = slices.Concat(ic.Paths, target.Paths)
+	target.Links = slices.Concat(ic.Links, target.Links)
+	if target.Sysctl == nil && ic.Sysctl != nil {
+		target.Sysctl = maps.Clone(ic.Sysctl)
+	} else {
+		for k, v := range ic.Sysctl {
+			if _, ok := target.Sysctl[k]; !ok {
+				target.Sysctl[k] = v
+			}
+		}
+	}
+	target.Limits = slices.Concat(ic.Limits, target.Limits)
+	target.Modules = slices.Concat(ic.Modules, target.Modules)
 	if target.Annotations == nil && ic.Annotations != nil {
 		target.Annotations = maps.Clone(ic.Annotations)
 	} else {
@@ -156,6 +287,16 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	}
 
 	target.Volumes = slices.Concat(ic.Volumes, target.Volumes)
+	target.Ports = slices.Concat(ic.Ports, target.Ports)
+	if target.Labels == nil && ic.Labels != nil {
+		target.Labels = maps.Clone(ic.Labels)
+	} else {
+		for k, v := range ic.Labels {
+			if _, ok := target.Labels[k]; !ok {
+				target.Labels[k] = v
+			}
+		}
+	}
 
 	// Update the contents.
 	return ic.Contents.MergeInto(&target.Contents)
@@ -172,44 +313,183 @@ func (a *ImageAccounts) MergeInto(target *ImageAccounts) error {
 
 func (i *ImageContents) MergeInto(target *ImageContents) error {
 	target.Keyring = slices.Concat(i.Keyring, target.Keyring)
+	if target.KeyringDir == "" {
+		target.KeyringDir = i.KeyringDir
+	}
 	target.BuildRepositories = slices.Concat(i.BuildRepositories, target.BuildRepositories)
 	target.RuntimeOnlyRepositories = slices.Concat(i.RuntimeOnlyRepositories, target.RuntimeOnlyRepositories)
 	target.Repositories = slices.Concat(i.Repositories, target.Repositories)
 	target.Packages = slices.Concat(i.Packages, target.Packages)
+	target.ExcludePackages = slices.Concat(i.ExcludePackages, target.ExcludePackages)
+	target.PrunePackages = slices.Concat(i.PrunePackages, target.PrunePackages)
+	if target.FileConflicts == "" {
+		target.FileConflicts = i.FileConflicts
+	}
+	target.Files = slices.Concat(i.Files, target.Files)
 	if target.BaseImage == nil {
 		target.BaseImage = i.BaseImage
 	}
 	return nil
 }
 
-func (ic *ImageConfiguration) readLocal(imageconfigPath string, includePaths []string) ([]byte, error) {
+// resolveLocal resolves p, a path of a file of the build machine in the local
+// configuration at config, like an include, or else relative to config. It
+// returns p as it is if it is found nowhere, for copying it to fail on.
+func resolveLocal(config, p string, includePaths []string) string {
+	resolved, err := paths.ResolvePath(p, append(slices.Clip(includePaths), filepath.Dir(config)))
+	if err != nil {
+		return p
+	}
+	return resolved
+}
+
+func (ic *ImageConfiguration) readLocal(imageconfigPath string, includePaths []string) (string, []byte, error) {
 	resolvedPath, err := paths.ResolvePath(imageconfigPath, includePaths)
 	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(resolvedPath)
+	return resolvedPath, data, err
+}
+
+// Platform returns the platform of the image built for arch: the OCI
+// platform of arch, on the configured operating system.
+func (ic *ImageConfiguration) Platform(arch Architecture) *v1.Platform {
+	plat := arch.ToOCIPlatform()
+	if ic.OS != nil {
+		if ic.OS.Name != "" {
+			plat.OS = ic.OS.Name
+		}
+		plat.OSVersion = ic.OS.Version
+		plat.OSFeatures = ic.OS.Features
+	}
+	return plat
+}
+
+// ForArch returns a copy of the configuration to build for arch, with the
+// arch-overrides for arch, if any, merged over it. The copy has no
+// arch-overrides of its own.
+func (ic *ImageConfiguration) ForArch(arch Architecture) (*ImageConfiguration, error) {
+	out := &ImageConfiguration{}
+	for k, ov := range ic.ArchOverrides {
+		if ParseArchitecture(k) == arch {
+			if err := ov.MergeInto(out); err != nil {
+				return nil, fmt.Errorf("merging arch-overrides for %q: %w", k, err)
+			}
+		}
+	}
+	if err := ic.MergeInto(out); err != nil {
 		return nil, err
 	}
-	return os.ReadFile(resolvedPath)
+	out.ArchOverrides = nil
+	return out, nil
 }
 
 // Load - loads an image configuration given a configuration file path.
 // Populates configHasher with the configuration data loaded from the imageConfigPath and the other referenced files.
 // You can pass any dummy hasher (like fnv.New32()), if you don't care about the hash of the configuration.
 //
+// The path may also be an http(s) URL, pinned to a digest with a
+// #sha256:<hex> fragment, or an oci://<reference> to an artifact with a
+// ConfigMediaType layer. Relative includes and keys of a URL are fetched
+// relative to it.
+//
 // Deprecated: This will be removed in a future release.
 func (ic *ImageConfiguration) Load(ctx context.Context, imageConfigPath string, includePaths []string, configHasher hash.Hash) error {
-	data, err := ic.readLocal(imageConfigPath, includePaths)
+	return ic.load(ctx, imageConfigPath, nil, includePaths, configHasher, nil)
+}
+
+// LoadWithVariables is like Load, but substitutes vars in the configuration
+// and anything it includes before parsing.
+func (ic *ImageConfiguration) LoadWithVariables(ctx context.Context, imageConfigPath string, includePaths []string, configHasher hash.Hash, vars *Variables) error {
+	return ic.load(ctx, imageConfigPath, nil, includePaths, configHasher, vars)
+}
+
+// LoadWritten loads the configuration at imageConfigPath, found and fetched
+// like LoadWithVariables does, with vars substituted in it, as it is written:
+// nothing it includes is merged in and none of its paths are resolved.
+func (ic *ImageConfiguration) LoadWritten(ctx context.Context, imageConfigPath string, includePaths []string, vars *Variables) error {
+	_, data, err := ic.read(ctx, imageConfigPath, includePaths, vars)
 	if err != nil {
 		return err
 	}
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(!allowsUnknownFields(ctx))
+	if err := dec.Decode(ic); err != nil {
+		return fmt.Errorf("failed to parse image configuration: %w", err)
+	}
+	return nil
+}
 
-	return ic.parse(ctx, data, includePaths, configHasher)
+func (ic *ImageConfiguration) load(ctx context.Context, imageConfigPath string, chain []string, includePaths []string, configHasher hash.Hash, vars *Variables) error {
+	id, data, err := ic.read(ctx, imageConfigPath, includePaths, vars)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(chain, id) {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(chain, id), " -> "))
+	}
+
+	return ic.parse(ctx, imageConfigPath, append(slices.Clip(chain), id), data, includePaths, configHasher, vars)
+}
+
+// read reads the configuration at imageConfigPath, with vars substituted in
+// it. It returns what identifies the configuration: its absolute path, or
+// imageConfigPath if it is remote.
+func (ic *ImageConfiguration) read(ctx context.Context, imageConfigPath string, includePaths []string, vars *Variables) (string, []byte, error) {
+	var data []byte
+	id := imageConfigPath
+	var err error
+	if isRemoteConfig(imageConfigPath) {
+		data, err = fetchRemoteConfig(ctx, imageConfigPath)
+	} else {
+		id, data, err = ic.readLocal(imageConfigPath, includePaths)
+		if err == nil {
+			id, err = filepath.Abs(id)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if vars != nil {
+		if data, err = vars.Expand(data); err != nil {
+			return "", nil, fmt.Errorf("substituting variables in %s: %w", imageConfigPath, err)
+		}
+	}
+	return id, data, nil
 }
 
 // Do preflight checks and mutations on an image configuration.
 func (ic *ImageConfiguration) Validate() error {
-	if ic.Entrypoint.Type == "service-bundle" {
+	switch ic.Entrypoint.Type {
+	case "", "none":
+	case "service-bundle":
 		if err := ic.ValidateServiceBundle(); err != nil {
 			return err
 		}
+	default:
+		// Other types run the command as it is, as they always have, which
+		// parsing warns about.
+		if ei, ok := entrypointInits[ic.Entrypoint.Type]; ok {
+			// As for s6, a duplicate entry in /etc/apk/world is harmless.
+			ic.Contents.Packages = append(ic.Contents.Packages, ei.pkg)
+		}
+	}
+	if ic.Entrypoint.Command != "" && len(ic.Entrypoint.CommandArgs) != 0 {
+		return fmt.Errorf("configured entrypoint command and command-args cannot both be set")
+	}
+	if ic.Cmd != "" && len(ic.CmdArgs) != 0 {
+		return fmt.Errorf("configured cmd and cmd-args cannot both be set")
+	}
+	if ic.Entrypoint.Shell != "" {
+		if ic.Entrypoint.ShellFragment == "" {
+			return fmt.Errorf("configured entrypoint shell %s only runs a shell-fragment, which is not set", ic.Entrypoint.Shell)
+		}
+		if !path.IsAbs(ic.Entrypoint.Shell) {
+			return fmt.Errorf("configured entrypoint shell %q is not an absolute path", ic.Entrypoint.Shell)
+		}
 	}
 
 	for i, u := range ic.Accounts.Users {
@@ -222,7 +502,17 @@ func (ic *ImageConfiguration) Validate() error {
 		}
 
 		if u.HomeDir == "" {
-			ic.Accounts.Users[i].HomeDir = "/home/" + u.UserName
+			if u.System {
+				ic.Accounts.Users[i].HomeDir = "/dev/null"
+			} else {
+				ic.Accounts.Users[i].HomeDir = "/home/" + u.UserName
+			}
+		}
+
+		for _, g := range u.Groups {
+			if g == "" {
+				return fmt.Errorf("configured user %s has a supplementary group with no name", u.UserName)
+			}
 		}
 	}
 
@@ -232,6 +522,22 @@ func (ic *ImageConfiguration) Validate() error {
 		}
 	}
 
+	if err := ic.ValidateArchOverrides(); err != nil {
+		return err
+	}
+
+	if ic.Healthcheck != nil {
+		if _, err := ic.Healthcheck.Config(); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range ic.Ports {
+		if _, err := ParsePort(p); err != nil {
+			return err
+		}
+	}
+
 	if ic.Certificates != nil {
 		for _, additional := range ic.Certificates.Additional {
 			if additional.Name == "" {
@@ -240,15 +546,385 @@ func (ic *ImageConfiguration) Validate() error {
 			if !certNameRegex.MatchString(additional.Name) {
 				return fmt.Errorf("configured additional certificate %q has an invalid name, it must match %s", additional.Name, certNameRegex.String())
 			}
+			if (additional.Content == "") == (additional.Path == "") {
+				return fmt.Errorf("configured additional certificate %q must have either content or a path", additional.Name)
+			}
+		}
+	}
+
+	if _, err := ic.MaxSize.ImageBytes(); err != nil {
+		return fmt.Errorf("configured max-size image %q: %w", ic.MaxSize.Image, err)
+	}
+	if _, err := ic.MaxSize.LayerBytes(); err != nil {
+		return fmt.Errorf("configured max-size layer %q: %w", ic.MaxSize.Layer, err)
+	}
+
+	if err := ic.Contents.validateExcluded(); err != nil {
+		return err
+	}
+	switch ic.Contents.FileConflicts {
+	case "", "error", "warn":
+	default:
+		return fmt.Errorf("configured file-conflicts %q is not one of error or warn", ic.Contents.FileConflicts)
+	}
+
+	for _, f := range ic.Contents.Files {
+		if f.Source == "" {
+			return fmt.Errorf("configured file copied to %q has no source", f.Destination)
+		}
+		if !path.IsAbs(f.Destination) {
+			return fmt.Errorf("configured file %q is copied to %q, which is not an absolute path", f.Source, f.Destination)
+		}
+	}
+
+	for _, mut := range ic.Paths {
+		if mut.Type != "strip" {
+			continue
+		}
+		if strings.Contains(mut.Path, "/") && !path.IsAbs(mut.Path) {
+			return fmt.Errorf("configured strip pattern %q is neither an absolute path nor a base name", mut.Path)
+		}
+		if _, err := path.Match(mut.Path, ""); err != nil {
+			return fmt.Errorf("configured strip pattern %q: %w", mut.Path, err)
+		}
+	}
+
+	for _, l := range ic.Links {
+		if !path.IsAbs(l.Binary) {
+			return fmt.Errorf("configured links binary %q is not an absolute path", l.Binary)
+		}
+		for _, p := range l.Paths {
+			if !path.IsAbs(p) {
+				return fmt.Errorf("configured link %q to %s is not an absolute path", p, l.Binary)
+			}
+		}
+	}
+
+	if ic.OSRelease != nil {
+		for _, f := range ic.OSRelease.Fields() {
+			if strings.Contains(f.Value, "\n") {
+				return fmt.Errorf("configured os-release %s has a value spanning lines", f.Key)
+			}
+		}
+		for _, f := range []OSReleaseField{{"ID", ic.OSRelease.ID}, {"VERSION_ID", ic.OSRelease.VersionID}} {
+			if !osReleaseIDRegex.MatchString(f.Value) {
+				return fmt.Errorf("configured os-release %s %q must match %s", f.Key, f.Value, osReleaseIDRegex.String())
+			}
+		}
+	}
+
+	if ic.Wasm != nil {
+		if !path.IsAbs(ic.Wasm.Module) {
+			return fmt.Errorf("configured wasm module %q is not an absolute path", ic.Wasm.Module)
+		}
+		for _, a := range ic.Archs {
+			if a != wasm {
+				return fmt.Errorf("configured wasm artifact cannot be built for %s, only for wasm32", a)
+			}
+		}
+	}
+
+	if ic.Disk != nil {
+		if err := ic.Disk.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range ic.Sysctl {
+		if k == "" || strings.ContainsAny(k, "= \t\n") {
+			return fmt.Errorf("configured sysctl %q is not a valid kernel parameter name", k)
+		}
+		if strings.Contains(v, "\n") {
+			return fmt.Errorf("configured sysctl %s has a value spanning lines", k)
+		}
+	}
+
+	for _, l := range ic.Limits {
+		for _, f := range []string{l.Domain, l.Item, l.Value} {
+			if f == "" || strings.ContainsAny(f, " \t\n") {
+				return fmt.Errorf("configured limit of %q for %q to %q needs a domain, an item and a value, with no spaces", l.Item, l.Domain, l.Value)
+			}
+		}
+		switch l.Type {
+		case "", "-", "soft", "hard":
+		default:
+			return fmt.Errorf("configured limit of %s for %s has type %q, which is not one of soft, hard or -", l.Item, l.Domain, l.Type)
+		}
+		if !slices.Contains(limitItems, l.Item) {
+			return fmt.Errorf("configured limit of %q for %s is not one of %s", l.Item, l.Domain, strings.Join(limitItems, ", "))
+		}
+	}
+
+	for _, m := range ic.Modules {
+		if m == "" || strings.ContainsAny(m, " \t\n") {
+			return fmt.Errorf("configured kernel module %q is not a valid module name", m)
+		}
+	}
+	return nil
+}
+
+// envNameRegex matches the names of environment variables that a service
+// can set.
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// osReleaseIDRegex matches the values os-release(5) allows for ID and
+// VERSION_ID, or no value.
+var osReleaseIDRegex = regexp.MustCompile(`^[a-z0-9._-]*$`)
+
+// OSReleaseAnnotationPrefix prefixes the annotations recording the fields of
+// /etc/os-release set by the image configuration.
+const OSReleaseAnnotationPrefix = "dev.chainguard.apko.os-release."
+
+// OSReleaseField is a field of /etc/os-release.
+type OSReleaseField struct {
+	// Key is the name of the field, e.g. PRETTY_NAME.
+	Key string
+	// Value is the unquoted value of the field.
+	Value string
+}
+
+// Fields returns the fields of /etc/os-release that r sets, in the order
+// os-release(5) lists them.
+func (r *ImageOSRelease) Fields() []OSReleaseField {
+	var fields []OSReleaseField
+	for _, f := range []OSReleaseField{
+		{"NAME", r.Name},
+		{"ID", r.ID},
+		{"PRETTY_NAME", r.PrettyName},
+		{"VERSION_ID", r.VersionID},
+		{"HOME_URL", r.HomeURL},
+	} {
+		if f.Value != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Annotations returns the annotations that record the fields of r, named
+// after the field with OSReleaseAnnotationPrefix, e.g.
+// dev.chainguard.apko.os-release.pretty-name.
+func (r *ImageOSRelease) Annotations() map[string]string {
+	if r == nil {
+		return nil
+	}
+	annotations := map[string]string{}
+	for _, f := range r.Fields() {
+		annotations[OSReleaseAnnotationPrefix+strings.ReplaceAll(strings.ToLower(f.Key), "_", "-")] = f.Value
+	}
+	return annotations
+}
+
+// limitItems are the resources that pam_limits can limit.
+var limitItems = []string{
+	"as", "chroot", "core", "cpu", "data", "fsize", "locks", "maxlogins", "maxsyslogins",
+	"memlock", "msgqueue", "nice", "nofile", "nonewprivs", "nproc", "priority", "rss",
+	"rtprio", "sigpending", "stack",
+}
+
+// Config returns the healthcheck as it is set in the image configuration.
+func (h *ImageHealthcheck) Config() (*v1.HealthConfig, error) {
+	if len(h.Test) == 0 {
+		return nil, fmt.Errorf("configured healthcheck has no test")
+	}
+	switch h.Test[0] {
+	case "NONE":
+	case "CMD", "CMD-SHELL":
+		if len(h.Test) == 1 {
+			return nil, fmt.Errorf("configured healthcheck test %q has no command", h.Test[0])
+		}
+	default:
+		return nil, fmt.Errorf("configured healthcheck test %q must start with one of CMD, CMD-SHELL or NONE", h.Test[0])
+	}
+	if h.Retries < 0 {
+		return nil, fmt.Errorf("configured healthcheck retries %d is negative", h.Retries)
+	}
+
+	hc := &v1.HealthConfig{
+		Test:    h.Test,
+		Retries: h.Retries,
+	}
+	for _, d := range []struct {
+		field string
+		value string
+		dst   *time.Duration
+	}{
+		{"interval", h.Interval, &hc.Interval},
+		{"timeout", h.Timeout, &hc.Timeout},
+		{"start-period", h.StartPeriod, &hc.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("configured healthcheck %s %q is not a duration, e.g. 30s", d.field, d.value)
+		}
+		*d.dst = v
+	}
+	return hc, nil
+}
+
+// ParsePort normalizes a port[/protocol] entry of ports into the port/protocol
+// form used as a key of the OCI ExposedPorts configuration.
+func ParsePort(s string) (string, error) {
+	port, proto, ok := strings.Cut(s, "/")
+	if !ok {
+		proto = "tcp"
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || n == 0 {
+		return "", fmt.Errorf("configured port %q is not a port number between 1 and 65535", s)
+	}
+	switch proto = strings.ToLower(proto); proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", fmt.Errorf("configured port %q has unsupported protocol %q, it must be one of tcp, udp or sctp", s, proto)
+	}
+	return fmt.Sprintf("%d/%s", n, proto), nil
+}
+
+// ValidateArchOverrides checks that each of the arch-overrides is for a
+// distinct, known architecture and sets only what an override may.
+func (ic *ImageConfiguration) ValidateArchOverrides() error {
+	seen := make(map[Architecture]string, len(ic.ArchOverrides))
+	for _, k := range slices.Sorted(maps.Keys(ic.ArchOverrides)) {
+		ov := ic.ArchOverrides[k]
+		arch := ParseArchitecture(k)
+		if !slices.Contains(AllArchs, arch) {
+			return fmt.Errorf("configured arch-overrides has unknown architecture %q", k)
+		}
+		if prev, ok := seen[arch]; ok {
+			return fmt.Errorf("configured arch-overrides %q and %q are for the same architecture", prev, k)
+		}
+		seen[arch] = k
+		if len(ov.Archs) != 0 || ov.Include != "" || len(ov.ArchOverrides) != 0 {
+			return fmt.Errorf("configured arch-overrides for %q cannot set archs, include or arch-overrides", k)
+		}
+		if ov.Contents.BaseImage != nil {
+			return fmt.Errorf("configured arch-overrides for %q cannot set a base image", k)
+		}
+	}
+	return nil
+}
+
+// validateExcluded checks that no package is both asked for and excluded or
+// pruned, or both excluded and pruned.
+func (i *ImageContents) validateExcluded() error {
+	for _, p := range i.Packages {
+		// Strip any version constraint or repository pin.
+		name := p
+		if i := strings.IndexAny(p, "=<>~@"); i != -1 {
+			name = p[:i]
+		}
+		if slices.Contains(i.ExcludePackages, name) {
+			return fmt.Errorf("configured package %q is also in exclude-packages", p)
+		}
+		if slices.Contains(i.PrunePackages, name) {
+			return fmt.Errorf("configured package %q is also in prune-packages", p)
+		}
+	}
+	for _, p := range i.ExcludePackages {
+		if slices.Contains(i.PrunePackages, p) {
+			return fmt.Errorf("configured package %q is in both exclude-packages and prune-packages", p)
 		}
 	}
 	return nil
 }
 
+// entrypointInit is an init that an entrypoint type runs the command
+// under, to reap zombie processes and forward signals.
+type entrypointInit struct {
+	// pkg is the package that installs the init.
+	pkg string
+	// args are the arguments the command is appended to.
+	args []string
+}
+
+var entrypointInits = map[string]entrypointInit{
+	"tini":      {pkg: "tini", args: []string{"/sbin/tini", "--"}},
+	"dumb-init": {pkg: "dumb-init", args: []string{"/usr/bin/dumb-init", "--"}},
+}
+
+// DefaultShell is the shell that runs shell fragment entrypoints unless
+// another one is configured.
+const DefaultShell = "/bin/sh"
+
+// ShellOrDefault returns the shell that runs the shell fragment of e.
+func (e *ImageEntrypoint) ShellOrDefault() string {
+	if e.Shell != "" {
+		return e.Shell
+	}
+	return DefaultShell
+}
+
+// knownEntrypointType reports whether typ is an entrypoint type that apko
+// knows, or unset.
+func knownEntrypointType(typ string) bool {
+	switch typ {
+	case "", "none", "service-bundle":
+		return true
+	}
+	_, ok := entrypointInits[typ]
+	return ok
+}
+
+// Init returns the arguments that the entrypoint command is appended to, to
+// run it under the init of its type, if it has one.
+func (e *ImageEntrypoint) Init() []string {
+	return slices.Clone(entrypointInits[e.Type].args)
+}
+
 // Do preflight checks and mutations on an image configured to manage
 // a service bundle.
 func (ic *ImageConfiguration) ValidateServiceBundle() error {
+	services := ic.Entrypoint.Services
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		svc := services[name]
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/ \t\n") {
+			return fmt.Errorf("configured service %q has an invalid name", name)
+		}
+		if svc.Command == "" {
+			return fmt.Errorf("configured service %s has no command", name)
+		}
+		for _, dep := range svc.Dependencies {
+			if _, ok := services[dep]; !ok {
+				return fmt.Errorf("configured service %s depends on unknown service %q", name, dep)
+			}
+		}
+		for k := range svc.Environment {
+			if !envNameRegex.MatchString(k) {
+				return fmt.Errorf("configured service %s sets environment variable %q, which must match %s", name, k, envNameRegex.String())
+			}
+		}
+	}
+	// A cycle of dependencies would keep its services from ever starting.
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("configured services have a dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range services[name].Dependencies {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
 	ic.Entrypoint.Command = "/bin/s6-svscan /sv"
+	ic.Entrypoint.CommandArgs = nil
 
 	// It's harmless to have a duplicate entry in /etc/apk/world,
 	// apk will fix it up when the fixate op happens.
@@ -267,16 +943,25 @@ func (ic *ImageConfiguration) Summarize(ctx context.Context) {
 	log.Infof("    repositories: %v", ic.Contents.Repositories)
 	log.Infof("    keyring:      %v", ic.Contents.Keyring)
 	log.Infof("    packages:     %v", ic.Contents.Packages)
-	if ic.Entrypoint.Type != "" || ic.Entrypoint.Command != "" || len(ic.Entrypoint.Services) != 0 {
+	if ic.Entrypoint.Type != "" || ic.Entrypoint.Command != "" || len(ic.Entrypoint.CommandArgs) != 0 || len(ic.Entrypoint.Services) != 0 {
 		log.Infof("  entrypoint:")
 		log.Infof("    type:    %s", ic.Entrypoint.Type)
 		log.Infof("    command:     %s", ic.Entrypoint.Command)
+		if len(ic.Entrypoint.CommandArgs) != 0 {
+			log.Infof("    command args: %q", ic.Entrypoint.CommandArgs)
+		}
 		log.Infof("    service: %v", ic.Entrypoint.Services)
 		log.Infof("    shell fragment: %v", ic.Entrypoint.ShellFragment)
+		if ic.Entrypoint.Shell != "" {
+			log.Infof("    shell: %s", ic.Entrypoint.Shell)
+		}
 	}
 	if ic.Cmd != "" {
 		log.Infof("  cmd: %s", ic.Cmd)
 	}
+	if len(ic.CmdArgs) != 0 {
+		log.Infof("  cmd args: %q", ic.CmdArgs)
+	}
 	if ic.StopSignal != "" {
 		log.Infof("  stop signal: %s", ic.StopSignal)
 	}
@@ -307,3 +992,156 @@ func gidToInt(gid GID) uint32 {
 	}
 	return *gid
 }
+
+const (
+	// DiskBootloaderSystemdBoot boots a disk image with systemd-boot,
+	// installed by the systemd-boot package, from its EFI system partition.
+	DiskBootloaderSystemdBoot = "systemd-boot"
+	// DiskBootloaderNone installs no bootloader in a disk image.
+	DiskBootloaderNone = "none"
+
+	// DiskPartitionEFI is the type of the EFI system partition of a disk
+	// image.
+	DiskPartitionEFI = "efi"
+	// DiskPartitionRoot is the type of the partition of a disk image with
+	// the filesystem of the image.
+	DiskPartitionRoot = "root"
+)
+
+// diskPartitionLabels are the labels partitions get by default, by type.
+var diskPartitionLabels = map[string]string{
+	DiskPartitionEFI:  "EFI",
+	DiskPartitionRoot: "root",
+}
+
+// diskLabelLengths are the longest labels the filesystems of partitions can
+// have, by type.
+var diskLabelLengths = map[string]int{
+	DiskPartitionEFI:  11,
+	DiskPartitionRoot: 16,
+}
+
+// BootloaderOrDefault returns the bootloader of the disk image.
+func (d *ImageDisk) BootloaderOrDefault() string {
+	if d.Bootloader == "" {
+		return DiskBootloaderSystemdBoot
+	}
+	return d.Bootloader
+}
+
+// Packages returns the packages that the disk image needs installed: its
+// kernel and its bootloader.
+func (d *ImageDisk) Packages() []string {
+	var pkgs []string
+	if d.Kernel != "" {
+		pkgs = append(pkgs, d.Kernel)
+	}
+	if d.BootloaderOrDefault() == DiskBootloaderSystemdBoot {
+		pkgs = append(pkgs, "systemd-boot")
+	}
+	return pkgs
+}
+
+// Layout returns the partitions of the disk image, or the default ones, with
+// their labels set.
+func (d *ImageDisk) Layout() []DiskPartition {
+	parts := slices.Clone(d.Partitions)
+	if len(parts) == 0 {
+		if d.BootloaderOrDefault() != DiskBootloaderNone {
+			parts = append(parts, DiskPartition{Type: DiskPartitionEFI, Size: "128MiB"})
+		}
+		parts = append(parts, DiskPartition{Type: DiskPartitionRoot})
+	}
+	for i, p := range parts {
+		if p.Label == "" {
+			parts[i].Label = diskPartitionLabels[p.Type]
+		}
+	}
+	return parts
+}
+
+// SizeBytes returns the size of the disk image, or 0 when it is the size of
+// its partitions.
+func (d *ImageDisk) SizeBytes() (int64, error) {
+	return parseDiskSize(d.Size)
+}
+
+// SizeBytes returns the size of the partition, or 0 when it fills the rest
+// of the disk.
+func (p DiskPartition) SizeBytes() (int64, error) {
+	return parseDiskSize(p.Size)
+}
+
+// ImageBytes returns the largest size of the image, or 0 when it has none.
+func (b *ImageSizeBudget) ImageBytes() (int64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	return parseDiskSize(b.Image)
+}
+
+// LayerBytes returns the largest size of a layer, or 0 when it has none.
+func (b *ImageSizeBudget) LayerBytes() (int64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	return parseDiskSize(b.Layer)
+}
+
+func parseDiskSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	n, err := humanize.ParseBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 || n > math.MaxInt64 {
+		return 0, fmt.Errorf("%s is out of range", size)
+	}
+	return int64(n), nil
+}
+
+// Validate checks the disk image configuration.
+func (d *ImageDisk) Validate() error {
+	bootloader := d.BootloaderOrDefault()
+	if bootloader != DiskBootloaderSystemdBoot && bootloader != DiskBootloaderNone {
+		return fmt.Errorf("configured disk bootloader %q is not one of systemd-boot or none", d.Bootloader)
+	}
+	if strings.Contains(d.Cmdline, "\n") {
+		return fmt.Errorf("configured disk cmdline spans lines")
+	}
+	if _, err := d.SizeBytes(); err != nil {
+		return fmt.Errorf("configured disk size %q: %w", d.Size, err)
+	}
+
+	parts := d.Layout()
+	seen := map[string]bool{}
+	for i, p := range parts {
+		if _, ok := diskPartitionLabels[p.Type]; !ok {
+			return fmt.Errorf("configured disk partition type %q is not one of efi or root", p.Type)
+		}
+		if seen[p.Type] {
+			return fmt.Errorf("configured disk has more than one %s partition", p.Type)
+		}
+		seen[p.Type] = true
+		// FAT labels are at most 11 bytes, and ext4 ones 16.
+		if p.Label == "" || len(p.Label) > diskLabelLengths[p.Type] || strings.ContainsAny(p.Label, "\"\n") {
+			return fmt.Errorf("configured disk partition label %q is invalid", p.Label)
+		}
+		size, err := p.SizeBytes()
+		if err != nil {
+			return fmt.Errorf("configured disk partition %s size %q: %w", p.Label, p.Size, err)
+		}
+		if size == 0 && i != len(parts)-1 {
+			return fmt.Errorf("configured disk partition %s has no size, which only the last partition can leave out", p.Label)
+		}
+	}
+	if !seen[DiskPartitionRoot] {
+		return fmt.Errorf("configured disk has no root partition")
+	}
+	if bootloader == DiskBootloaderSystemdBoot && !seen[DiskPartitionEFI] {
+		return fmt.Errorf("configured disk has no efi partition, which systemd-boot boots from")
+	}
+	return nil
+}
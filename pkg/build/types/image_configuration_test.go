@@ -3,6 +3,7 @@ package types_test
 import (
 	"context"
 	"crypto/sha256"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -67,7 +68,68 @@ func TestUserContents(t *testing.T) {
 	ic.Summarize(ctx)
 }
 
+func TestIncludeChain(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"root.yaml": "contents:\n  packages: [root]\nenvironment:\n  LEVEL: root\n  ROOT: \"1\"\n",
+		"mid.yaml":  "include: " + filepath.Join(dir, "root.yaml") + "\ncontents:\n  packages: [mid]\nenvironment:\n  LEVEL: mid\n",
+		"top.yaml":  "include: " + filepath.Join(dir, "mid.yaml") + "\ncontents:\n  packages: [top]\n",
+		"a.yaml":    "include: " + filepath.Join(dir, "b.yaml") + "\n",
+		"b.yaml":    "include: " + filepath.Join(dir, "a.yaml") + "\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	ic := types.ImageConfiguration{}
+	require.NoError(t, ic.Load(ctx, filepath.Join(dir, "top.yaml"), nil, sha256.New()))
+	require.Equal(t, []string{"root", "mid", "top"}, ic.Contents.Packages)
+	require.Equal(t, map[string]string{"LEVEL": "mid", "ROOT": "1"}, ic.Environment)
+
+	ic = types.ImageConfiguration{}
+	err := ic.Load(ctx, filepath.Join(dir, "a.yaml"), nil, sha256.New())
+	require.ErrorContains(t, err, "include cycle: "+filepath.Join(dir, "a.yaml")+" -> "+filepath.Join(dir, "b.yaml")+" -> "+filepath.Join(dir, "a.yaml"))
+}
+
+func TestLocalPaths(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "config"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "app.conf"), nil, 0o644))
+	config := filepath.Join(dir, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  files:\n    - source: config/app.conf\n      destination: /etc/app.conf\n    - source: missing\n      destination: /missing\ncertificates:\n  additional:\n    - name: corp-ca\n      path: config/app.conf\n"), 0o644))
+
+	// The working directory has no config/app.conf, so it is found next to
+	// the configuration.
+	ic := types.ImageConfiguration{}
+	require.NoError(t, ic.Load(ctx, config, nil, sha256.New()))
+	require.Equal(t, filepath.Join(dir, "config", "app.conf"), ic.Contents.Files[0].Source)
+	require.Equal(t, "missing", ic.Contents.Files[1].Source)
+	require.Equal(t, filepath.Join(dir, "config", "app.conf"), ic.Certificates.Additional[0].Path)
+}
+
+func TestUnknownFields(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  packages: [busybox]\nenviroment:\n  FOO: bar\n"), 0o644))
+
+	ic := types.ImageConfiguration{}
+	require.ErrorContains(t, ic.Load(ctx, config, nil, sha256.New()), "field enviroment not found")
+
+	ic = types.ImageConfiguration{}
+	require.NoError(t, ic.Load(types.WithAllowUnknownFields(ctx), config, nil, sha256.New()))
+	require.Equal(t, []string{"busybox"}, ic.Contents.Packages)
+	require.Empty(t, ic.Environment)
+
+	// Values of the wrong type still fail.
+	require.NoError(t, os.WriteFile(config, []byte("contents:\n  packages: busybox\nenviroment: {}\n"), 0o644))
+	ic = types.ImageConfiguration{}
+	require.ErrorContains(t, ic.Load(types.WithAllowUnknownFields(ctx), config, nil, sha256.New()), "cannot unmarshal")
+}
+
 func TestMergeInto(t *testing.T) {
+	yes, no := true, false
 	tests := []struct {
 		name     string
 		source   types.ImageConfiguration
@@ -242,6 +304,48 @@ func TestMergeInto(t *testing.T) {
 				"org.blah":  "bar",
 			},
 		},
+	}, {
+		name: "base environment",
+		source: types.ImageConfiguration{
+			BaseEnvironment: &no,
+		},
+		target: types.ImageConfiguration{
+			BaseEnvironment: &yes,
+		},
+		expected: types.ImageConfiguration{
+			BaseEnvironment: &yes,
+		},
+	}, {
+		name: "inherited base environment",
+		source: types.ImageConfiguration{
+			BaseEnvironment: &no,
+		},
+		target: types.ImageConfiguration{},
+		expected: types.ImageConfiguration{
+			BaseEnvironment: &no,
+		},
+	}, {
+		name: "ports and labels",
+		source: types.ImageConfiguration{
+			Ports: []string{"80"},
+			Labels: map[string]string{
+				"maintainer": "foo",
+				"extra":      "foo",
+			},
+		},
+		target: types.ImageConfiguration{
+			Ports: []string{"53/udp"},
+			Labels: map[string]string{
+				"maintainer": "bar",
+			},
+		},
+		expected: types.ImageConfiguration{
+			Ports: []string{"80", "53/udp"},
+			Labels: map[string]string{
+				"maintainer": "bar",
+				"extra":      "foo",
+			},
+		},
 	}}
 
 	for _, tt := range tests {
@@ -259,6 +363,18 @@ func TestValidate(t *testing.T) {
 		configuration types.ImageConfiguration
 		expectError   string
 	}{{
+		name: "entrypoint shell without shell fragment",
+		configuration: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/app", Shell: "/bin/bash"},
+		},
+		expectError: "configured entrypoint shell /bin/bash only runs a shell-fragment, which is not set",
+	}, {
+		name: "relative entrypoint shell",
+		configuration: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{ShellFragment: "echo hi", Shell: "bash"},
+		},
+		expectError: `configured entrypoint shell "bash" is not an absolute path`,
+	}, {
 		name: "no cert name",
 		configuration: types.ImageConfiguration{
 			Certificates: &types.ImageCertificates{
@@ -291,6 +407,237 @@ func TestValidate(t *testing.T) {
 			},
 		},
 		expectError: `configured additional certificate "my-cert@123!" has an invalid name, it must match ^[a-zA-Z0-9_-]+$`,
+	}, {
+		name: "cert with content and path",
+		configuration: types.ImageConfiguration{
+			Certificates: &types.ImageCertificates{
+				Additional: []types.AdditionalCertificateEntry{{
+					Name:    "corp-ca",
+					Content: "test",
+					Path:    "corp-ca.pem",
+				}},
+			},
+		},
+		expectError: `configured additional certificate "corp-ca" must have either content or a path`,
+	}, {
+		name: "port out of range",
+		configuration: types.ImageConfiguration{
+			Ports: []string{"8080", "70000/tcp"},
+		},
+		expectError: `configured port "70000/tcp" is not a port number between 1 and 65535`,
+	}, {
+		name: "port with unknown protocol",
+		configuration: types.ImageConfiguration{
+			Ports: []string{"53/icmp"},
+		},
+		expectError: `configured port "53/icmp" has unsupported protocol "icmp", it must be one of tcp, udp or sctp`,
+	}, {
+		name: "healthcheck without test",
+		configuration: types.ImageConfiguration{
+			Healthcheck: &types.ImageHealthcheck{Interval: "30s"},
+		},
+		expectError: "configured healthcheck has no test",
+	}, {
+		name: "healthcheck with unknown test",
+		configuration: types.ImageConfiguration{
+			Healthcheck: &types.ImageHealthcheck{Test: []string{"curl", "localhost"}},
+		},
+		expectError: `configured healthcheck test "curl" must start with one of CMD, CMD-SHELL or NONE`,
+	}, {
+		name: "healthcheck with bad interval",
+		configuration: types.ImageConfiguration{
+			Healthcheck: &types.ImageHealthcheck{Test: []string{"CMD", "true"}, Interval: "30"},
+		},
+		expectError: `configured healthcheck interval "30" is not a duration, e.g. 30s`,
+	}, {
+		name: "arch override for unknown arch",
+		configuration: types.ImageConfiguration{
+			ArchOverrides: map[string]types.ImageConfiguration{"sparc": {}},
+		},
+		expectError: `configured arch-overrides has unknown architecture "sparc"`,
+	}, {
+		name: "arch overrides for the same arch",
+		configuration: types.ImageConfiguration{
+			ArchOverrides: map[string]types.ImageConfiguration{"amd64": {}, "x86_64": {}},
+		},
+		expectError: `configured arch-overrides "amd64" and "x86_64" are for the same architecture`,
+	}, {
+		name: "arch override setting archs",
+		configuration: types.ImageConfiguration{
+			ArchOverrides: map[string]types.ImageConfiguration{
+				"arm64": {Archs: []types.Architecture{types.ParseArchitecture("arm64")}},
+			},
+		},
+		expectError: `configured arch-overrides for "arm64" cannot set archs, include or arch-overrides`,
+	}, {
+		name: "user with unnamed supplementary group",
+		configuration: types.ImageConfiguration{
+			Accounts: types.ImageAccounts{
+				Users: []types.User{{UserName: "alice", UID: 1000, Groups: []string{"wheel", ""}}},
+			},
+		},
+		expectError: "configured user alice has a supplementary group with no name",
+	}, {
+		name: "file without source",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{Files: []types.ImageFile{{Destination: "/etc/app.conf"}}},
+		},
+		expectError: `configured file copied to "/etc/app.conf" has no source`,
+	}, {
+		name: "file with relative destination",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{Files: []types.ImageFile{{Source: "app.conf", Destination: "etc/app.conf"}}},
+		},
+		expectError: `configured file "app.conf" is copied to "etc/app.conf", which is not an absolute path`,
+	}, {
+		name: "links without binary",
+		configuration: types.ImageConfiguration{
+			Links: []types.Links{{Paths: []string{"/bin/ls"}}},
+		},
+		expectError: `configured links binary "" is not an absolute path`,
+	}, {
+		name: "relative link",
+		configuration: types.ImageConfiguration{
+			Links: []types.Links{{Binary: "/usr/bin/toybox", Paths: []string{"bin/ls"}}},
+		},
+		expectError: `configured link "bin/ls" to /usr/bin/toybox is not an absolute path`,
+	}, {
+		name: "os-release with invalid ID",
+		configuration: types.ImageConfiguration{
+			OSRelease: &types.ImageOSRelease{ID: "Acme Linux"},
+		},
+		expectError: `configured os-release ID "Acme Linux" must match ^[a-z0-9._-]*$`,
+	}, {
+		name: "os-release spanning lines",
+		configuration: types.ImageConfiguration{
+			OSRelease: &types.ImageOSRelease{PrettyName: "Acme\nLinux"},
+		},
+		expectError: `configured os-release PRETTY_NAME has a value spanning lines`,
+	}, {
+		name: "sysctl with invalid name",
+		configuration: types.ImageConfiguration{
+			Sysctl: map[string]string{"net.core.somaxconn = 1024": ""},
+		},
+		expectError: `configured sysctl "net.core.somaxconn = 1024" is not a valid kernel parameter name`,
+	}, {
+		name: "limit of unknown item",
+		configuration: types.ImageConfiguration{
+			Limits: []types.Limit{{Domain: "*", Item: "files", Value: "1024"}},
+		},
+		expectError: `configured limit of "files" for * is not one of as, chroot, core, cpu, data, fsize, locks, maxlogins, maxsyslogins, memlock, msgqueue, nice, nofile, nonewprivs, nproc, priority, rss, rtprio, sigpending, stack`,
+	}, {
+		name: "limit of unknown type",
+		configuration: types.ImageConfiguration{
+			Limits: []types.Limit{{Domain: "*", Type: "both", Item: "nofile", Value: "1024"}},
+		},
+		expectError: `configured limit of nofile for * has type "both", which is not one of soft, hard or -`,
+	}, {
+		name: "limit without value",
+		configuration: types.ImageConfiguration{
+			Limits: []types.Limit{{Domain: "@app", Item: "nofile"}},
+		},
+		expectError: `configured limit of "nofile" for "@app" to "" needs a domain, an item and a value, with no spaces`,
+	}, {
+		name: "invalid kernel module",
+		configuration: types.ImageConfiguration{
+			Modules: []string{"br_netfilter overlay"},
+		},
+		expectError: `configured kernel module "br_netfilter overlay" is not a valid module name`,
+	}, {
+		name: "service depending on unknown service",
+		configuration: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{
+				Type: "service-bundle",
+				Services: map[string]types.ImageService{
+					"app": {Command: "app", Dependencies: []string{"db"}},
+				},
+			},
+		},
+		expectError: `configured service app depends on unknown service "db"`,
+	}, {
+		name: "services depending on each other",
+		configuration: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{
+				Type: "service-bundle",
+				Services: map[string]types.ImageService{
+					"app":   {Command: "app", Dependencies: []string{"cache"}},
+					"cache": {Command: "cache", Dependencies: []string{"db"}},
+					"db":    {Command: "db", Dependencies: []string{"cache"}},
+				},
+			},
+		},
+		expectError: `configured services have a dependency cycle: app -> cache -> db -> cache`,
+	}, {
+		name: "service with invalid environment variable",
+		configuration: types.ImageConfiguration{
+			Entrypoint: types.ImageEntrypoint{
+				Type: "service-bundle",
+				Services: map[string]types.ImageService{
+					"app": {Command: "app", Environment: map[string]string{"APP-PORT": "8080"}},
+				},
+			},
+		},
+		expectError: `configured service app sets environment variable "APP-PORT", which must match ^[A-Za-z_][A-Za-z0-9_]*$`,
+	}, {
+		name: "unknown disk bootloader",
+		configuration: types.ImageConfiguration{
+			Disk: &types.ImageDisk{Bootloader: "grub"},
+		},
+		expectError: `configured disk bootloader "grub" is not one of systemd-boot or none`,
+	}, {
+		name: "disk partition without size before another",
+		configuration: types.ImageConfiguration{
+			Disk: &types.ImageDisk{Partitions: []types.DiskPartition{{Type: "root"}, {Type: "efi", Size: "128MiB"}}},
+		},
+		expectError: "configured disk partition root has no size, which only the last partition can leave out",
+	}, {
+		name: "disk without efi partition for systemd-boot",
+		configuration: types.ImageConfiguration{
+			Disk: &types.ImageDisk{Partitions: []types.DiskPartition{{Type: "root"}}},
+		},
+		expectError: "configured disk has no efi partition, which systemd-boot boots from",
+	}, {
+		name: "disk partition with invalid size",
+		configuration: types.ImageConfiguration{
+			Disk: &types.ImageDisk{Bootloader: "none", Partitions: []types.DiskPartition{{Type: "root", Size: "lots"}}},
+		},
+		expectError: `configured disk partition root size "lots": strconv.ParseFloat: parsing "": invalid syntax`,
+	}, {
+		name: "disk partition label too long",
+		configuration: types.ImageConfiguration{
+			Disk: &types.ImageDisk{Partitions: []types.DiskPartition{{Type: "efi", Label: "EFI-SYSTEM-PARTITION", Size: "128MiB"}, {Type: "root"}}},
+		},
+		expectError: `configured disk partition label "EFI-SYSTEM-PARTITION" is invalid`,
+	}, {
+		name: "excluded package asked for",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{Packages: []string{"busybox>=1.36"}, ExcludePackages: []string{"busybox"}},
+		},
+		expectError: `configured package "busybox>=1.36" is also in exclude-packages`,
+	}, {
+		name: "package both excluded and pruned",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{ExcludePackages: []string{"busybox"}, PrunePackages: []string{"busybox"}},
+		},
+		expectError: `configured package "busybox" is in both exclude-packages and prune-packages`,
+	}, {
+		name: "relative strip pattern",
+		configuration: types.ImageConfiguration{
+			Paths: []types.PathMutation{{Path: "usr/share/man/**", Type: "strip"}},
+		},
+		expectError: `configured strip pattern "usr/share/man/**" is neither an absolute path nor a base name`,
+	}, {
+		name: "invalid max-size",
+		configuration: types.ImageConfiguration{
+			MaxSize: &types.ImageSizeBudget{Image: "lots"},
+		},
+		expectError: `configured max-size image "lots": strconv.ParseFloat: parsing "": invalid syntax`,
+	}, {
+		name: "unknown file-conflicts",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{FileConflicts: "ignore"},
+		},
+		expectError: `configured file-conflicts "ignore" is not one of error or warn`,
 	}}
 
 	for _, tt := range tests {
@@ -300,3 +647,79 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEntrypointInit(t *testing.T) {
+	for typ, want := range map[string][]string{
+		"none":      nil,
+		"tini":      {"/sbin/tini", "--"},
+		"dumb-init": {"/usr/bin/dumb-init", "--"},
+		// An unknown type runs the command as it is.
+		"systemd": nil,
+	} {
+		ic := types.ImageConfiguration{
+			Contents:   types.ImageContents{Packages: []string{"nginx"}},
+			Entrypoint: types.ImageEntrypoint{Type: typ, Command: "/usr/sbin/nginx"},
+		}
+		require.NoError(t, ic.Validate(), typ)
+		require.Equal(t, want, ic.Entrypoint.Init(), typ)
+		if want != nil {
+			require.Equal(t, []string{"nginx", typ}, ic.Contents.Packages, typ)
+		} else {
+			require.Equal(t, []string{"nginx"}, ic.Contents.Packages, typ)
+		}
+	}
+}
+
+func TestForArch(t *testing.T) {
+	ic := types.ImageConfiguration{
+		Contents: types.ImageContents{
+			Packages: []string{"base"},
+		},
+		Cmd: "serve",
+		Environment: map[string]string{
+			"FOO": "all",
+			"BAR": "all",
+		},
+		ArchOverrides: map[string]types.ImageConfiguration{
+			"aarch64": {
+				Contents: types.ImageContents{
+					Packages: []string{"arm-only"},
+				},
+				Cmd: "serve --arm",
+				Environment: map[string]string{
+					"FOO": "arm",
+				},
+			},
+		},
+	}
+
+	got, err := ic.ForArch(types.ParseArchitecture("arm64"))
+	require.NoError(t, err)
+	require.Equal(t, &types.ImageConfiguration{
+		Contents: types.ImageContents{
+			Packages: []string{"base", "arm-only"},
+		},
+		Cmd: "serve --arm",
+		Environment: map[string]string{
+			"FOO": "arm",
+			"BAR": "all",
+		},
+	}, got)
+
+	got, err = ic.ForArch(types.ParseArchitecture("amd64"))
+	require.NoError(t, err)
+	require.Equal(t, &types.ImageConfiguration{
+		Contents: types.ImageContents{
+			Packages: []string{"base"},
+		},
+		Cmd: "serve",
+		Environment: map[string]string{
+			"FOO": "all",
+			"BAR": "all",
+		},
+	}, got)
+
+	// The original is left untouched.
+	require.Equal(t, []string{"arm-only"}, ic.ArchOverrides["aarch64"].Contents.Packages)
+	require.Equal(t, "arm", ic.ArchOverrides["aarch64"].Environment["FOO"])
+}
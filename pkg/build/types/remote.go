@@ -0,0 +1,188 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+
+	"chainguard.dev/apko/pkg/limitio"
+)
+
+// ConfigMediaType is the media type of the layer holding the apko
+// configuration in an OCI artifact.
+const ConfigMediaType = "application/vnd.dev.chainguard.apko.config.v1+yaml"
+
+// maxRemoteConfigSize bounds how much of a remote configuration is read.
+const maxRemoteConfigSize = 10 << 20
+
+const ociScheme = "oci://"
+
+type remoteTransportKey struct{}
+
+type remoteKeychainKey struct{}
+
+// WithRemoteTransport returns a context in which remote configurations are
+// fetched through t, rather than http.DefaultTransport.
+func WithRemoteTransport(ctx context.Context, t http.RoundTripper) context.Context {
+	return context.WithValue(ctx, remoteTransportKey{}, t)
+}
+
+// WithRemoteKeychain returns a context in which configurations in registries
+// are fetched with the credentials of kc, rather than those of
+// authn.DefaultKeychain.
+func WithRemoteKeychain(ctx context.Context, kc authn.Keychain) context.Context {
+	return context.WithValue(ctx, remoteKeychainKey{}, kc)
+}
+
+func remoteTransport(ctx context.Context) http.RoundTripper {
+	if t, _ := ctx.Value(remoteTransportKey{}).(http.RoundTripper); t != nil {
+		return t
+	}
+	return http.DefaultTransport
+}
+
+func remoteKeychain(ctx context.Context) authn.Keychain {
+	if kc, _ := ctx.Value(remoteKeychainKey{}).(authn.Keychain); kc != nil {
+		return kc
+	}
+	return authn.DefaultKeychain
+}
+
+// isRemoteConfig reports whether src names a configuration to fetch rather
+// than a local file.
+func isRemoteConfig(src string) bool {
+	return strings.HasPrefix(src, "https://") ||
+		strings.HasPrefix(src, "http://") ||
+		strings.HasPrefix(src, ociScheme)
+}
+
+// fetchRemoteConfig fetches the configuration at src, which is either an
+// http(s) URL, optionally pinned with a #sha256:<hex> fragment, or an
+// oci://<reference> to an artifact with a ConfigMediaType layer.
+func fetchRemoteConfig(ctx context.Context, src string) ([]byte, error) {
+	if ref, ok := strings.CutPrefix(src, ociScheme); ok {
+		return fetchOCIConfig(ctx, ref)
+	}
+	return fetchHTTPConfig(ctx, src)
+}
+
+func fetchHTTPConfig(ctx context.Context, src string) ([]byte, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", src, err)
+	}
+	var want string
+	if u.Fragment != "" {
+		hexDigest, ok := strings.CutPrefix(u.Fragment, "sha256:")
+		if !ok {
+			return nil, fmt.Errorf("%s: only #sha256:<hex> digests are supported", src)
+		}
+		want = hexDigest
+		u.Fragment = ""
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: remoteTransport(ctx)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(limitio.NewLimitedReader(resp.Body, maxRemoteConfigSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", u, err)
+	}
+
+	if want != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return nil, fmt.Errorf("%s: digest mismatch, want sha256:%s, got sha256:%s", u, want, got)
+		}
+	}
+	return data, nil
+}
+
+func fetchOCIConfig(ctx context.Context, s string) ([]byte, error) {
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", s, err)
+	}
+	// Pulling by digest verifies the manifest, and with it the layer digests.
+	img, err := remote.Image(ref, remote.WithContext(ctx), remote.WithTransport(remoteTransport(ctx)), remote.WithAuthFromKeychain(remoteKeychain(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("reading layers of %s: %w", ref, err)
+	}
+	for _, l := range layers {
+		mt, err := l.MediaType()
+		if err != nil {
+			return nil, fmt.Errorf("reading layers of %s: %w", ref, err)
+		}
+		if mt != ggcrtypes.MediaType(ConfigMediaType) {
+			continue
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("reading configuration of %s: %w", ref, err)
+		}
+		defer rc.Close()
+		return io.ReadAll(limitio.NewLimitedReader(rc, maxRemoteConfigSize))
+	}
+	return nil, fmt.Errorf("%s has no layer of media type %s", ref, ConfigMediaType)
+}
+
+// resolveRemote resolves p, referenced by the remote configuration at base,
+// the way a browser resolves a link: relative to base for http(s). Remote p
+// are returned unchanged; OCI configurations can only reference remote p.
+func resolveRemote(base, p string) (string, error) {
+	if isRemoteConfig(p) {
+		return p, nil
+	}
+	if strings.HasPrefix(base, ociScheme) {
+		return "", fmt.Errorf("%q cannot be resolved relative to %s, use a URL or oci:// reference", p, base)
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	u.Fragment = ""
+	rel, err := url.Parse(path.Clean(p))
+	if err != nil {
+		return "", err
+	}
+	return u.ResolveReference(rel).String(), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const remoteConfig = `include: base.yaml
+contents:
+  keyring:
+    - keys/top.pub
+  packages:
+    - top
+`
+
+const remoteBase = `contents:
+  keyring:
+    - https://example.com/base.pub
+  packages:
+    - base
+`
+
+func TestLoadRemoteURL(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/configs/apko.yaml":
+			fmt.Fprint(w, remoteConfig)
+		case "/configs/base.yaml":
+			fmt.Fprint(w, remoteBase)
+		case "/configs/files.yaml":
+			fmt.Fprint(w, "contents:\n  files:\n    - source: /etc/passwd\n      destination: /etc/passwd\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	src := s.URL + "/configs/apko.yaml"
+	ic := types.ImageConfiguration{}
+	require.NoError(t, ic.Load(ctx, src, nil, sha256.New()))
+	require.Equal(t, []string{"base", "top"}, ic.Contents.Packages)
+	require.Equal(t, []string{"https://example.com/base.pub", s.URL + "/configs/keys/top.pub"}, ic.Contents.Keyring)
+
+	sum := sha256.Sum256([]byte(remoteConfig))
+	ic = types.ImageConfiguration{}
+	require.NoError(t, ic.Load(ctx, src+"#sha256:"+hex.EncodeToString(sum[:]), nil, sha256.New()))
+
+	ic = types.ImageConfiguration{}
+	err := ic.Load(ctx, src+"#sha256:"+hex.EncodeToString(make([]byte, 32)), nil, sha256.New())
+	require.ErrorContains(t, err, "digest mismatch")
+
+	ic = types.ImageConfiguration{}
+	require.Error(t, ic.Load(ctx, s.URL+"/missing.yaml", nil, sha256.New()))
+
+	ic = types.ImageConfiguration{}
+	err = ic.Load(ctx, s.URL+"/configs/files.yaml", nil, sha256.New())
+	require.ErrorContains(t, err, "cannot copy files into the image")
+}
+
+func TestLoadRemoteOCI(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	art, err := oci.BuildInputsArtifact([]byte(remoteBase), nil, nil)
+	require.NoError(t, err)
+	h, err := art.Digest()
+	require.NoError(t, err)
+	tag, err := name.NewTag(u.Host + "/configs/base:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag, art, remote.WithTransport(s.Client().Transport)))
+
+	for _, ref := range []string{tag.String(), tag.Context().Digest(h.String()).String()} {
+		ic := types.ImageConfiguration{}
+		require.NoError(t, ic.Load(ctx, "oci://"+ref, nil, sha256.New()))
+		require.Equal(t, []string{"base"}, ic.Contents.Packages)
+		require.Equal(t, []string{"https://example.com/base.pub"}, ic.Contents.Keyring)
+	}
+
+	// Relative references cannot be resolved against an OCI reference.
+	art, err = oci.BuildInputsArtifact([]byte(remoteConfig), nil, nil)
+	require.NoError(t, err)
+	tag, err = name.NewTag(u.Host + "/configs/top:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag, art, remote.WithTransport(s.Client().Transport)))
+
+	ic := types.ImageConfiguration{}
+	err = ic.Load(ctx, "oci://"+tag.String(), nil, sha256.New())
+	require.ErrorContains(t, err, `"base.yaml" cannot be resolved`)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+type recordingKeychain struct{ registries []string }
+
+func (k *recordingKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	k.registries = append(k.registries, r.RegistryStr())
+	return authn.Anonymous, nil
+}
+
+func TestLoadRemoteTransport(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	art, err := oci.BuildInputsArtifact([]byte(remoteBase), nil, nil)
+	require.NoError(t, err)
+	tag, err := name.NewTag(u.Host + "/configs/base:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag, art, remote.WithTransport(s.Client().Transport)))
+
+	errDenied := errors.New("denied")
+	denied := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, errDenied })
+	ctx := types.WithRemoteTransport(context.Background(), denied)
+	for _, src := range []string{s.URL + "/configs/apko.yaml", "oci://" + tag.String()} {
+		ic := types.ImageConfiguration{}
+		require.ErrorIs(t, ic.Load(ctx, src, nil, sha256.New()), errDenied, src)
+	}
+
+	kc := &recordingKeychain{}
+	ctx = types.WithRemoteKeychain(context.Background(), kc)
+	ic := types.ImageConfiguration{}
+	require.NoError(t, ic.Load(ctx, "oci://"+tag.String(), nil, sha256.New()))
+	require.Equal(t, []string{u.Host}, kc.registries)
+}
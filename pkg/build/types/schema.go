@@ -0,0 +1,236 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the JSON schema of image configurations, which editors can use to
+// check and complete them. It is generated by internal/gen-jsonschema.
+//
+//go:embed schema.json
+var Schema []byte
+
+// SchemaIssue is something wrong with a configuration according to Schema.
+type SchemaIssue struct {
+	// Line and Column locate the issue in the configuration, from 1.
+	Line, Column int
+	// Path is the dotted path of the offending value, such as
+	// contents.packages[2].
+	Path string
+	// Message says what is wrong.
+	Message string
+	// Deprecated is set when the issue is only the use of a deprecated
+	// field, which still works.
+	Deprecated bool
+}
+
+func (i SchemaIssue) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", i.Line, i.Column, i.Path, i.Message)
+}
+
+// CheckSchema checks the YAML configuration in configData against Schema and
+// returns its unknown fields, values of the wrong type, missing required
+// fields and deprecated fields, in the order they appear. It only fails if
+// configData is not YAML.
+func CheckSchema(configData []byte) ([]SchemaIssue, error) {
+	var root jsonschema.Schema
+	if err := json.Unmarshal(Schema, &root); err != nil {
+		return nil, fmt.Errorf("parsing configuration schema: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(configData, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse image configuration: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	c := schemaChecker{defs: root.Definitions}
+	c.check(doc.Content[0], &root, "")
+	return c.issues, nil
+}
+
+type schemaChecker struct {
+	defs   jsonschema.Definitions
+	issues []SchemaIssue
+}
+
+func (c *schemaChecker) report(n *yaml.Node, path, format string, args ...any) {
+	c.issues = append(c.issues, SchemaIssue{Line: n.Line, Column: n.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows the references of s to the definitions of the schema.
+func (c *schemaChecker) resolve(s *jsonschema.Schema) *jsonschema.Schema {
+	for s != nil && s.Ref != "" {
+		s = c.defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+	}
+	return s
+}
+
+// check checks the value n at path against s.
+func (c *schemaChecker) check(n *yaml.Node, s *jsonschema.Schema, path string) {
+	s = c.resolve(s)
+	if s == nil {
+		return
+	}
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	// A null leaves the field unset, whatever its type.
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	if len(s.OneOf) != 0 {
+		c.checkOneOf(n, s.OneOf, path)
+		return
+	}
+	if s.Type != "" && !matchesType(n, s.Type) {
+		c.report(n, path, "expected %s, got %s", schemaTypeName(s.Type), nodeTypeName(n))
+		return
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		c.checkMapping(n, s, path)
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for i, item := range n.Content {
+				c.check(item, s.Items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+}
+
+// checkOneOf checks n against the first of alternatives it is of the type of,
+// so that the issues reported are those of what the configuration meant.
+func (c *schemaChecker) checkOneOf(n *yaml.Node, alternatives []*jsonschema.Schema, path string) {
+	var types []string
+	for _, alt := range alternatives {
+		alt = c.resolve(alt)
+		if alt.Type == "" || matchesType(n, alt.Type) {
+			c.check(n, alt, path)
+			return
+		}
+		types = append(types, schemaTypeName(alt.Type))
+	}
+	c.report(n, path, "expected %s, got %s", strings.Join(types, " or "), nodeTypeName(n))
+}
+
+func (c *schemaChecker) checkMapping(n *yaml.Node, s *jsonschema.Schema, path string) {
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if key.Value == "<<" && key.Tag == "!!merge" {
+			c.check(value, s, path)
+			continue
+		}
+		seen[key.Value] = true
+		field := key.Value
+		if path != "" {
+			field = path + "." + key.Value
+		}
+
+		var prop *jsonschema.Schema
+		if s.Properties != nil {
+			prop, _ = s.Properties.Get(key.Value)
+		}
+		switch {
+		case prop != nil:
+			if prop.Deprecated {
+				c.issues = append(c.issues, SchemaIssue{Line: key.Line, Column: key.Column, Path: field, Message: "field is deprecated", Deprecated: true})
+			}
+			c.check(value, prop, field)
+		case s.AdditionalProperties == nil:
+		case reflect.DeepEqual(s.AdditionalProperties, jsonschema.FalseSchema):
+			c.report(key, field, "unknown field")
+		default:
+			c.check(value, s.AdditionalProperties, field)
+		}
+	}
+	for _, req := range s.Required {
+		if !seen[req] {
+			c.report(n, path, "missing required field %s", req)
+		}
+	}
+}
+
+// matchesType returns whether n can be decoded into a value of the JSON
+// schema type typ, as the YAML decoder does: any scalar makes a string.
+func matchesType(n *yaml.Node, typ string) bool {
+	switch typ {
+	case "object":
+		return n.Kind == yaml.MappingNode
+	case "array":
+		return n.Kind == yaml.SequenceNode
+	case "string":
+		return n.Kind == yaml.ScalarNode
+	case "integer":
+		if n.Kind != yaml.ScalarNode {
+			return false
+		}
+		if n.Tag == "!!int" {
+			return true
+		}
+		// A float with no fractional part, such as 1e3, decodes into an
+		// integer too.
+		f, err := strconv.ParseFloat(n.Value, 64)
+		return n.Tag == "!!float" && err == nil && f == float64(int64(f))
+	case "number":
+		return n.Kind == yaml.ScalarNode && (n.Tag == "!!int" || n.Tag == "!!float")
+	case "boolean":
+		return n.Kind == yaml.ScalarNode && n.Tag == "!!bool"
+	}
+	return true
+}
+
+func schemaTypeName(typ string) string {
+	switch typ {
+	case "object":
+		return "a mapping"
+	case "array":
+		return "a list"
+	case "integer":
+		return "an integer"
+	}
+	return "a " + typ
+}
+
+func nodeTypeName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch n.Tag {
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	}
+	return fmt.Sprintf("%q", n.Value)
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestCheckSchema(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config string
+		want   []string
+	}{{
+		name: "valid",
+		config: `contents:
+  packages: [busybox]
+entrypoint:
+  command-args: [/bin/sh, -c]
+cmd: echo hello
+accounts:
+  run-as: 65532
+  users:
+    - username: nonroot
+      uid: 65532
+paths:
+  - path: /data
+    type: directory
+    uid: 65532
+    permissions: 0o755
+`,
+	}, {
+		name: "unknown fields",
+		config: `contents:
+  pakages: [busybox]
+entrypoints: {}
+`,
+		want: []string{
+			"2:3: contents.pakages: unknown field",
+			"3:1: entrypoints: unknown field",
+		},
+	}, {
+		name: "wrong types",
+		config: `contents:
+  repositories: https://example.com/os
+accounts:
+  users:
+    - username: nonroot
+      uid: nonroot
+entrypoint:
+  command: {}
+`,
+		want: []string{
+			`2:17: contents.repositories: expected a list, got "https://example.com/os"`,
+			`6:12: accounts.users[0].uid: expected an integer, got "nonroot"`,
+			`8:12: entrypoint.command: expected a string, got a mapping`,
+		},
+	}, {
+		name: "missing required field",
+		config: `contents:
+  files:
+    - source: foo
+`,
+		want: []string{"3:7: contents.files[0]: missing required field destination"},
+	}, {
+		name:   "deprecated field",
+		config: "include: base.yaml\n",
+		want:   []string{"1:1: include: field is deprecated"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := types.CheckSchema([]byte(tt.config))
+			require.NoError(t, err)
+			var got []string
+			for _, issue := range issues {
+				got = append(got, issue.String())
+				require.Equal(t, tt.name == "deprecated field", issue.Deprecated)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
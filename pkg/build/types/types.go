@@ -15,6 +15,7 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"runtime"
@@ -22,6 +23,8 @@ import (
 	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/shlex"
+	"github.com/invopop/jsonschema"
 )
 
 func processRepositoryURLs(repositories []string) error {
@@ -61,9 +64,21 @@ type User struct {
 	// Required: The user's group ID
 	GID GID `json:"gid,omitempty" yaml:"gid,omitempty"`
 	// Optional: The user's shell
+	//
+	// Defaults to /bin/sh, or /sbin/nologin for system accounts.
 	Shell string `json:"shell,omitempty"`
 	// Optional: The user's home directory
+	//
+	// Defaults to /home/<username>, or none (/dev/null) for system accounts.
+	// It is created, owned by the user, unless it exists already.
 	HomeDir string `json:"homedir,omitempty"`
+	// Optional: The user's full name or other information (the GECOS field)
+	Gecos string `json:"gecos,omitempty" yaml:"gecos,omitempty"`
+	// Optional: Names of the supplementary groups the user is a member of
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	// Optional: Whether the user is a system account, run by a service
+	// rather than logged in to
+	System bool `json:"system,omitempty" yaml:"system,omitempty"`
 }
 
 type GID *uint32
@@ -78,11 +93,13 @@ type Group struct {
 }
 
 type PathMutation struct {
-	// The target path to mutate
+	// The target path to mutate, or the pattern of the paths to remove, for
+	// the strip mutation
 	Path string `json:"path,omitempty"`
 	// The type of mutation to perform
 	//
-	// This can be one of: directory, empty-file, hardlink, symlink, permissions
+	// This can be one of: directory, empty-file, file, hardlink, symlink,
+	// permissions, strip
 	Type string `json:"type,omitempty"`
 	// The mutation's desired user ID
 	UID uint32 `json:"uid,omitempty"`
@@ -94,13 +111,17 @@ type PathMutation struct {
 	Source string `json:"source,omitempty"`
 	// Toggle whether to mutate recursively
 	Recursive bool `json:"recursive,omitempty"`
+	// The contents of the file, for the file mutation
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
 }
 
 type BaseImageDescriptor struct {
-	// Required: Path to the base image OCI layout. Right now only local files are supported.
+	// Required: The base image, as a path to an OCI layout or an image
+	// tarball, or else as a reference to an image in a registry.
 	Image string `json:"image,omitempty" yaml:"image,omitempty"`
-	// Required: Path to file representing installed packages in the base image in APKINDEX format.
+	// Optional: Path to file representing installed packages in the base image in APKINDEX format.
 	// (Assumes regular Alpine repository layout, that is: set /foo/bar if the index is /foo/bor/{aarch64|x86_64}/APKINDEX
+	// When unset, the installed packages are read from the apk database of the image.
 	APKIndex string `json:"apkindex,omitempty" yaml:"apkindex,omitempty"`
 }
 
@@ -118,10 +139,47 @@ type ImageContents struct {
 	Repositories []string `json:"repositories,omitempty" yaml:"repositories,omitempty"`
 	// A list of public keys used to verify the desired repositories
 	Keyring []string `json:"keyring,omitempty" yaml:"keyring,omitempty"`
+	// Optional: A local directory whose keys (*.pub) are all added to the
+	// keyring
+	KeyringDir string `json:"keyring-dir,omitempty" yaml:"keyring-dir,omitempty"`
 	// A list of packages to include in the image
 	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+	// Optional: Names of packages that must not be in the image. The build
+	// fails if resolving the packages would install one of them.
+	ExcludePackages []string `json:"exclude-packages,omitempty" yaml:"exclude-packages,omitempty"`
+	// Optional: Names of packages to leave out of the image, even though
+	// other packages depend on them. Warning: the packages depending on them
+	// may then not work.
+	PrunePackages []string `json:"prune-packages,omitempty" yaml:"prune-packages,omitempty"`
+	// Optional: What to do when packages of different origins, neither
+	// replacing the other, ship a file with different contents: error, the
+	// default, fails the build, and warn keeps the file of the package
+	// installed last
+	FileConflicts string `json:"file-conflicts,omitempty" yaml:"file-conflicts,omitempty"`
 	// Optional: Base image to build on top of. Warning: Experimental.
 	BaseImage *BaseImageDescriptor `json:"baseimage,omitempty" yaml:"baseimage,omitempty" apko:"experimental"`
+	// Optional: Files and directories of the build machine to copy into the
+	// image, after the packages are installed
+	Files []ImageFile `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// ImageFile is a file or directory of the build machine to copy into the
+// image.
+type ImageFile struct {
+	// Required: Path of the file or directory to copy, found like an
+	// include, or else relative to the configuration
+	Source string `json:"source" yaml:"source"`
+	// Required: Absolute path to copy it to in the image
+	//
+	// Directories are copied with everything in them.
+	Destination string `json:"destination" yaml:"destination"`
+	// Optional: The user ID that owns what is copied
+	UID uint32 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	// Optional: The group ID that owns what is copied
+	GID uint32 `json:"gid,omitempty" yaml:"gid,omitempty"`
+	// Optional: The permission bits of the files copied, which otherwise
+	// keep those they have on the build machine
+	Permissions uint32 `json:"permissions,omitempty" yaml:"permissions,omitempty"`
 }
 
 // MarshalYAML implements yaml.Marshaler for ImageContents, redacting URLs in
@@ -151,14 +209,190 @@ func (i ImageContents) MarshalYAML() (any, error) {
 }
 
 type ImageEntrypoint struct {
-	// Optional: The type of entrypoint. Only "service-bundle" is supported.
+	// Optional: The type of entrypoint: "service-bundle" to supervise the
+	// services with s6, "tini" or "dumb-init" to run the command under that
+	// init, or "none" (the default) to run the command as it is
 	Type string `json:"type,omitempty"`
 	// Required: The command of the entrypoint
 	Command string `json:"command,omitempty"`
+	// Optional: The command of the entrypoint as a list of its arguments,
+	// which are taken as they are instead of being split like a shell would.
+	// It cannot be set with command.
+	CommandArgs []string `json:"command-args,omitempty" yaml:"command-args,omitempty"`
 	// Optional: The shell fragment of the entrypoint command
 	ShellFragment string `json:"shell-fragment,omitempty" yaml:"shell-fragment"`
+	// Optional: The shell that runs the shell fragment, such as /bin/bash
+	// (default /bin/sh)
+	Shell string `json:"shell,omitempty" yaml:"shell,omitempty"`
+
+	// Optional: The services supervised by s6, by name, for the
+	// service-bundle type
+	Services map[string]ImageService `json:"services,omitempty"`
+}
+
+// ImageService is a service supervised by s6. It can be given as just its
+// command.
+type ImageService struct {
+	// Required: The command of the service, an execline command line
+	Command string `json:"command" yaml:"command"`
+	// Optional: The services that must be up before the service starts
+	Dependencies []string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	// Optional: Environment variables set for the service
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// Optional: The directory the service runs in
+	WorkDir string `json:"work-dir,omitempty" yaml:"work-dir,omitempty"`
+	// Optional: The user the service runs as, a username or uid:gid
+	RunAs string `json:"run-as,omitempty" yaml:"run-as,omitempty"`
+}
+
+// serviceFields has the fields of ImageService without its methods, to
+// decode and encode them.
+type serviceFields ImageService
+
+// isCommand reports whether s has nothing but its command, which is then how
+// it is encoded.
+func (s ImageService) isCommand() bool {
+	return len(s.Dependencies) == 0 && len(s.Environment) == 0 && s.WorkDir == "" && s.RunAs == ""
+}
+
+func (s *ImageService) UnmarshalYAML(unmarshal func(any) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		*s = ImageService{Command: command}
+		return nil
+	}
+	return unmarshal((*serviceFields)(s))
+}
+
+func (s ImageService) MarshalYAML() (any, error) {
+	if s.isCommand() {
+		return s.Command, nil
+	}
+	return serviceFields(s), nil
+}
+
+func (s *ImageService) UnmarshalJSON(b []byte) error {
+	var command string
+	if err := json.Unmarshal(b, &command); err == nil {
+		*s = ImageService{Command: command}
+		return nil
+	}
+	return json.Unmarshal(b, (*serviceFields)(s))
+}
+
+func (s ImageService) MarshalJSON() ([]byte, error) {
+	if s.isCommand() {
+		return json.Marshal(s.Command)
+	}
+	return json.Marshal(serviceFields(s))
+}
+
+// JSONSchemaExtend allows the service to be given as just its command in the
+// JSON schema.
+func (ImageService) JSONSchemaExtend(schema *jsonschema.Schema) {
+	object := *schema
+	*schema = jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{{Type: "string"}, &object},
+	}
+}
+
+// CommandArgv returns the arguments of the command of the entrypoint: its
+// command-args as they are, or its command split like a shell would.
+func (e ImageEntrypoint) CommandArgv() ([]string, error) {
+	if len(e.CommandArgs) != 0 {
+		return e.CommandArgs, nil
+	}
+	return shlex.Split(e.Command)
+}
+
+// ImageHealthcheck configures how a runtime checks that the container is
+// healthy, like HEALTHCHECK in a Dockerfile. It is carried in the Docker
+// config of the image, which OCI defines no equivalent for.
+type ImageHealthcheck struct {
+	// Required: The test to run: ["CMD", args...] to run a command directly,
+	// ["CMD-SHELL", command] to run it with the shell, or ["NONE"] to disable
+	// checking
+	Test []string `json:"test,omitempty" yaml:"test,omitempty"`
+	// Optional: The time between checks, e.g. 30s
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Optional: The time after which a check is considered to have failed
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Optional: The time the container has to start before failed checks count
+	StartPeriod string `json:"start-period,omitempty" yaml:"start-period,omitempty"`
+	// Optional: The number of consecutive failures after which the container
+	// is unhealthy
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+}
+
+// ImageOS describes the operating system the container image is for.
+type ImageOS struct {
+	// Optional: The name of the operating system (default linux)
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Optional: The version of the operating system, e.g. 10.0.17763.1040
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Optional: Features of the operating system the image requires
+	Features []string `json:"features,omitempty" yaml:"features,omitempty"`
+}
+
+// ImageOSRelease sets fields of /etc/os-release, which identify the
+// distribution the image is made of.
+type ImageOSRelease struct {
+	// Optional: The ID of the distribution, e.g. wolfi
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Optional: The name of the distribution, e.g. Wolfi
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Optional: The version of the distribution, e.g. 20230201
+	VersionID string `json:"version-id,omitempty" yaml:"version-id,omitempty"`
+	// Optional: The name of the distribution to show to users, with its version
+	PrettyName string `json:"pretty-name,omitempty" yaml:"pretty-name,omitempty"`
+	// Optional: The homepage of the distribution
+	HomeURL string `json:"home-url,omitempty" yaml:"home-url,omitempty"`
+}
+
+// ImageDisk configures the bootable disk image `apko build-disk` makes of
+// the filesystem of the image.
+type ImageDisk struct {
+	// Optional: The package of the kernel to install for the disk image,
+	// e.g. linux
+	Kernel string `json:"kernel,omitempty" yaml:"kernel,omitempty"`
+	// Optional: Arguments to pass to the kernel, after the root partition,
+	// e.g. console=ttyS0
+	Cmdline string `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`
+	// Optional: The bootloader, systemd-boot (the default), which boots the
+	// kernel of /boot with UEFI from the EFI system partition, or none, for
+	// kernels booted directly by the VM
+	Bootloader string `json:"bootloader,omitempty" yaml:"bootloader,omitempty"`
+	// Optional: The size of the disk, e.g. 2GiB (default is the size of its
+	// partitions)
+	Size string `json:"size,omitempty" yaml:"size,omitempty"`
+	// Optional: The partitions of the disk, in order (default is a 128MiB
+	// EFI system partition, unless the bootloader is none, then the root
+	// partition)
+	Partitions []DiskPartition `json:"partitions,omitempty" yaml:"partitions,omitempty"`
+}
 
-	Services map[string]string `json:"services,omitempty"`
+// DiskPartition is a partition of a disk image.
+type DiskPartition struct {
+	// Required: The type of the partition, efi for the EFI system partition,
+	// which is a FAT filesystem, or root for the filesystem of the image,
+	// which is ext4
+	Type string `json:"type" yaml:"type"`
+	// Optional: The name of the partition and label of its filesystem
+	// (default is EFI or root)
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+	// Optional: The size of the partition, e.g. 512MiB
+	//
+	// Only the last partition can leave it out, to fill the rest of the disk
+	// or, without a disk size, what its content needs.
+	Size string `json:"size,omitempty" yaml:"size,omitempty"`
+}
+
+// ImageWasm publishes a wasm image as a WebAssembly OCI artifact, whose
+// only layer is a module, instead of as a container image.
+type ImageWasm struct {
+	// Required: The path of the module in the filesystem of the image, e.g.
+	// /usr/lib/wasm/hello.wasm
+	Module string `json:"module" yaml:"module"`
 }
 
 type ImageAccounts struct {
@@ -183,8 +417,14 @@ type ImageConfiguration struct {
 	//
 	// These are the additional arguments to pass to the entrypoint.
 	Cmd string `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	// Optional: The command of the container image as a list of its
+	// arguments, which are taken as they are instead of being split like a
+	// shell would. It cannot be set with cmd.
+	CmdArgs []string `json:"cmd-args,omitempty" yaml:"cmd-args,omitempty"`
 	// Optional: The stop signal used to suspend the execution of the containers process
 	StopSignal string `json:"stop-signal,omitempty" yaml:"stop-signal,omitempty"`
+	// Optional: How to check that the container is healthy
+	Healthcheck *ImageHealthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
 	// Optional: The working directory of the container
 	WorkDir string `json:"work-dir,omitempty" yaml:"work-dir,omitempty"`
 	// Optional: Account configuration for the container image
@@ -193,10 +433,49 @@ type ImageConfiguration struct {
 	//
 	// The list of supported architectures is: 386, amd64, arm64, arm/v6, arm/v7, ppc64le, riscv64, s390x, loong64
 	Archs []Architecture `json:"archs,omitempty" yaml:"archs,omitempty"`
+	// Optional: The operating system to set in the image configuration and
+	// index descriptors, which defaults to linux
+	//
+	// apko only installs Linux packages; this is for experimenting with
+	// other platforms.
+	OS *ImageOS `json:"os,omitempty" yaml:"os,omitempty"`
+	// Optional: Fields of /etc/os-release identifying the distribution of the
+	// image, which are recorded as annotations too
+	OSRelease *ImageOSRelease `json:"os-release,omitempty" yaml:"os-release,omitempty"`
+	// Optional: Publish the image as a WebAssembly OCI artifact of a
+	// module, for the wasm32 architecture
+	Wasm *ImageWasm `json:"wasm,omitempty" yaml:"wasm,omitempty"`
+	// Optional: How to make a bootable disk image of the image with
+	// `apko build-disk`
+	Disk *ImageDisk `json:"disk,omitempty" yaml:"disk,omitempty"`
+	// Optional: Configuration to merge over this one when building for a
+	// particular architecture, keyed by architecture
+	//
+	// The override takes precedence, and lists such as packages are appended
+	// to. An override cannot set archs, include or arch-overrides.
+	ArchOverrides map[string]ImageConfiguration `json:"arch-overrides,omitempty" yaml:"arch-overrides,omitempty"`
 	// Optional: Environment variables to set in the container image
+	//
+	// These are merged over the base environment, which sets PATH and
+	// SSL_CERT_FILE, so a variable set here takes precedence.
 	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// Optional: Whether to include the base environment (default true)
+	//
+	// When false, the image environment is exactly Environment.
+	BaseEnvironment *bool `json:"base-environment,omitempty" yaml:"base-environment,omitempty"`
 	// Optional: List of paths mutations
 	Paths []PathMutation `json:"paths,omitempty" yaml:"paths,omitempty"`
+	// Optional: Symlinks to create to multiplexer binaries, such as toybox,
+	// in addition to those of busybox
+	Links []Links `json:"links,omitempty" yaml:"links,omitempty"`
+	// Optional: Kernel parameters to set, written to /etc/sysctl.d/90-apko.conf
+	Sysctl map[string]string `json:"sysctl,omitempty" yaml:"sysctl,omitempty"`
+	// Optional: Resource limits of users and groups, written to
+	// /etc/security/limits.d/90-apko.conf
+	Limits []Limit `json:"limits,omitempty" yaml:"limits,omitempty"`
+	// Optional: Kernel modules to load at boot, written to
+	// /etc/modules-load.d/apko.conf
+	Modules []string `json:"modules,omitempty" yaml:"modules,omitempty"`
 	// Optional: The link to version control system for this container's source code
 	VCSUrl string `json:"vcs-url,omitempty" yaml:"vcs-url,omitempty"`
 	// Optional: Annotations to apply to the images manifests
@@ -217,11 +496,90 @@ type ImageConfiguration struct {
 	// supported container runtimes.
 	Volumes []string `json:"volumes,omitempty" yaml:"volumes,omitempty"`
 
+	// Optional: A list of ports the container listens on, as port[/protocol]
+	//
+	// The protocol is one of tcp, udp or sctp, and defaults to tcp.
+	Ports []string `json:"ports,omitempty" yaml:"ports,omitempty"`
+
+	// Optional: Labels to set in the image configuration
+	//
+	// Annotations are also set as labels; a label set here takes precedence
+	// over an annotation with the same key.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Optional: Whether to also set the annotations as labels (default true)
+	//
+	// Docker shows labels but not annotations. When false, the labels are
+	// exactly Labels.
+	AnnotationLabels *bool `json:"annotation-labels,omitempty" yaml:"annotation-labels,omitempty"`
+
 	// Optional: Configuration to control layering of the OCI image.
 	Layering *Layering `json:"layering,omitempty" yaml:"layering,omitempty"`
 
+	// Optional: Largest compressed sizes the layers and image of each
+	// architecture may have; the build fails if they are larger.
+	MaxSize *ImageSizeBudget `json:"max-size,omitempty" yaml:"max-size,omitempty"`
+
 	// Optional: Certificates to install in the container image
 	Certificates *ImageCertificates `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+
+	// Optional: Configuration of the SBOMs generated for the image
+	SBOM *ImageSBOM `json:"sbom,omitempty" yaml:"sbom,omitempty"`
+}
+
+// CmdArgv returns the arguments of the command of the image: its cmd-args as
+// they are, or its cmd split like a shell would.
+func (ic ImageConfiguration) CmdArgv() ([]string, error) {
+	if len(ic.CmdArgs) != 0 {
+		return ic.CmdArgs, nil
+	}
+	return shlex.Split(ic.Cmd)
+}
+
+// JSONSchemaExtend marks the deprecated fields as such in the JSON schema.
+func (ImageConfiguration) JSONSchemaExtend(schema *jsonschema.Schema) {
+	if include, ok := schema.Properties.Get("include"); ok {
+		include.Deprecated = true
+	}
+}
+
+// ImageSBOM configures the SBOMs generated for the image.
+type ImageSBOM struct {
+	// Optional: List every file installed by a package, with its checksums
+	// and the package that owns it
+	IncludeFiles bool `json:"include-files,omitempty" yaml:"include-files,omitempty"`
+	// Optional: Copy the license texts shipped by the packages into the SBOM
+	// for the licenses that are not in the SPDX license list
+	LicenseTexts bool `json:"license-texts,omitempty" yaml:"license-texts,omitempty"`
+	// Optional: Annotations to set on the manifest of the artifact that
+	// attaches each SBOM to the image, on top of its creation time
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// Links configures the symlinks to a multiplexer binary, such as toybox or
+// coreutils-single, that acts as the program it is invoked as.
+type Links struct {
+	// Required: Path of the multiplexer binary, such as /usr/bin/toybox
+	//
+	// No links are created when it is not installed.
+	Binary string `json:"binary" yaml:"binary"`
+	// Optional: Directory in which packages list the links to create to the
+	// binary, one path per line of a file named after the package, as busybox
+	// packages do in /etc/busybox-paths.d
+	Manifests string `json:"manifests,omitempty" yaml:"manifests,omitempty"`
+	// Optional: Paths of links to create to the binary
+	Paths []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+// Limit is a resource limit of a user or group, as set by pam_limits.
+type Limit struct {
+	// Required: The user, @group or * limited
+	Domain string `json:"domain" yaml:"domain"`
+	// Optional: Whether the limit is soft, hard or both (default both)
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Required: The resource limited, such as nofile or nproc
+	Item string `json:"item" yaml:"item"`
+	// Required: The limit, such as 65536 or unlimited
+	Value string `json:"value" yaml:"value"`
 }
 
 // Architecture represents a CPU architecture for the container image.
@@ -250,6 +608,9 @@ var (
 	ppc64le = Architecture("ppc64le")
 	riscv64 = Architecture("riscv64")
 	s390x   = Architecture("s390x")
+	// wasm images are of WebAssembly modules, which are the same for every
+	// machine.
+	wasm = Architecture("wasm")
 )
 
 // AllArchs contains the standard set of supported architectures, which are
@@ -281,6 +642,8 @@ func (a Architecture) ToAPK() string {
 		return "armv7"
 	case loong64:
 		return "loongarch64"
+	case wasm:
+		return "wasm32"
 	default:
 		return string(a)
 	}
@@ -289,6 +652,10 @@ func (a Architecture) ToAPK() string {
 func (a Architecture) ToOCIPlatform() *v1.Platform {
 	plat := v1.Platform{OS: "linux"}
 	switch a := ParseArchitecture(a.String()); a {
+	case wasm:
+		// The platform that Docker and runwasi run WASI modules for.
+		plat.OS = "wasi"
+		plat.Architecture = "wasm"
 	case armv6:
 		plat.Architecture = "arm"
 		plat.Variant = "v6"
@@ -396,6 +763,8 @@ func ParseArchitecture(s string) Architecture {
 		return armv7
 	case "loong64", "loongarch64":
 		return loong64
+	case "wasm", "wasm32":
+		return wasm
 	}
 	return Architecture(s)
 }
@@ -433,6 +802,9 @@ type SBOM struct {
 	Path   string
 	Format string
 	Digest v1.Hash
+	// Annotations are set on the manifest of the artifact that attaches the
+	// SBOM.
+	Annotations map[string]string
 }
 
 type Layering struct {
@@ -440,15 +812,29 @@ type Layering struct {
 	Budget   int    `json:"budget,omitempty" yaml:"budget,omitempty"`
 }
 
+// ImageSizeBudget holds the largest sizes an image may have, such as 100MiB
+// or 50MB.
+type ImageSizeBudget struct {
+	// Optional: Largest size of the image, as the sum of its compressed layers
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+	// Optional: Largest size of each compressed layer of the image
+	Layer string `json:"layer,omitempty" yaml:"layer,omitempty"`
+}
+
 type AdditionalCertificateEntry struct {
 	// Required: Name of the certificate entry
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
-	// Required: PEM-encoded certificate content to install in the image.
+	// Required, unless path is set: PEM-encoded certificate content to install in the image.
 	// Must contain exactly one certificate.
 	// The certificate will be:
 	// 1. Appended to the default certificate bundles (e.g., /etc/ssl/certs/ca-certificates.crt)
 	// 2. Installed as an individual file in the ca-certificates.
+	// 3. Linked from /etc/ssl/certs by the hash of its subject, as c_rehash does.
 	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+	// Required, unless content is set: Path to a file on the build machine
+	// with the PEM-encoded certificate content to install in the image,
+	// found like an include, or else relative to the configuration
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
 }
 
 type ImageCertificates struct {
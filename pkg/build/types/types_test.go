@@ -15,11 +15,13 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 )
@@ -166,6 +168,10 @@ func TestOCIPlatform(t *testing.T) {
 		desc: "aarch64",
 		in:   "aarch64",
 		want: "arm64",
+	}, {
+		desc: "wasm32",
+		in:   "wasm32",
+		want: "wasm",
 	}} {
 		t.Run(c.desc, func(t *testing.T) {
 			got := Architecture(c.in)
@@ -174,6 +180,14 @@ func TestOCIPlatform(t *testing.T) {
 	}
 }
 
+func TestWasmArchitecture(t *testing.T) {
+	a := ParseArchitecture("wasm32")
+	require.Equal(t, wasm, a)
+	require.Equal(t, "wasm32", a.ToAPK())
+	require.Equal(t, &v1.Platform{OS: "wasi", Architecture: "wasm"}, a.ToOCIPlatform())
+	require.NotContains(t, AllArchs, a)
+}
+
 var (
 	id0     = uint32(0)
 	id0T    = GID(&id0)
@@ -332,3 +346,62 @@ homedir: ""
 		}
 	}
 }
+
+func TestImageServiceMarshalling(t *testing.T) {
+	var ic ImageConfiguration
+	require.NoError(t, yaml.Unmarshal([]byte(`
+entrypoint:
+  type: service-bundle
+  services:
+    db: /usr/bin/db
+    app:
+      command: /usr/bin/app --port 8080
+      dependencies: [db]
+      environment:
+        APP_ENV: production
+      work-dir: /srv/app
+      run-as: app
+`), &ic))
+
+	db := ImageService{Command: "/usr/bin/db"}
+	app := ImageService{
+		Command:      "/usr/bin/app --port 8080",
+		Dependencies: []string{"db"},
+		Environment:  map[string]string{"APP_ENV": "production"},
+		WorkDir:      "/srv/app",
+		RunAs:        "app",
+	}
+	require.Equal(t, map[string]ImageService{"db": db, "app": app}, ic.Entrypoint.Services)
+
+	// A service with nothing but its command is encoded as it.
+	b, err := json.Marshal(ic.Entrypoint.Services)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"db":"/usr/bin/db","app":{"command":"/usr/bin/app --port 8080","dependencies":["db"],"environment":{"APP_ENV":"production"},"work-dir":"/srv/app","run-as":"app"}}`, string(b))
+	var services map[string]ImageService
+	require.NoError(t, json.Unmarshal(b, &services))
+	require.Equal(t, ic.Entrypoint.Services, services)
+
+	y, err := yaml.Marshal(db)
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/db\n", string(y))
+}
+
+func TestCommandArgv(t *testing.T) {
+	var ic ImageConfiguration
+	require.NoError(t, yaml.Unmarshal([]byte(`
+entrypoint:
+  command-args: ["/usr/bin/app", "--greeting", "hello \"world\""]
+cmd: --port 8080 'two words'
+`), &ic))
+	require.NoError(t, ic.Validate())
+
+	args, err := ic.Entrypoint.CommandArgv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/app", "--greeting", `hello "world"`}, args)
+	args, err = ic.CmdArgv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"--port", "8080", "two words"}, args)
+
+	ic.CmdArgs = []string{"--port", "8080"}
+	require.ErrorContains(t, ic.Validate(), "cmd and cmd-args cannot both be set")
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// Variables substitutes ${NAME} references in configurations as they are
+// loaded. $${ is left as ${, for configurations that need it literally, such
+// as shell fragments expanding variables at runtime.
+type Variables struct {
+	// Values of the variables, which take precedence over the environment.
+	Values map[string]string
+	// Strict fails loading a configuration referencing a variable that is
+	// neither in Values nor the environment; otherwise it expands to "".
+	Strict bool
+}
+
+var variableRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Lookup returns the value of name, from Values or else the environment.
+func (v *Variables) Lookup(name string) (string, bool) {
+	if val, ok := v.Values[name]; ok {
+		return val, true
+	}
+	return os.LookupEnv(name)
+}
+
+// Expand substitutes the variables referenced in data.
+func (v *Variables) Expand(data []byte) ([]byte, error) {
+	var undefined []string
+	out := variableRef.ReplaceAllFunc(data, func(m []byte) []byte {
+		if string(m) == "$${" {
+			return []byte("${")
+		}
+		name := string(m[2 : len(m)-1])
+		val, ok := v.Lookup(name)
+		if !ok && !slices.Contains(undefined, name) {
+			undefined = append(undefined, name)
+		}
+		return []byte(val)
+	})
+	if len(undefined) != 0 && v.Strict {
+		errs := make([]error, 0, len(undefined))
+		for _, name := range undefined {
+			errs = append(errs, fmt.Errorf("variable %q is not defined", name))
+		}
+		return nil, errors.Join(errs...)
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestVariablesExpand(t *testing.T) {
+	t.Setenv("APKO_TEST_FROM_ENV", "env")
+
+	for _, tt := range []struct {
+		name    string
+		vars    types.Variables
+		in      string
+		want    string
+		wantErr string
+	}{{
+		name: "values",
+		vars: types.Variables{Values: map[string]string{"VERSION": "1.2.3"}},
+		in:   "packages: [foo=${VERSION}]",
+		want: "packages: [foo=1.2.3]",
+	}, {
+		name: "environment",
+		in:   "FOO: ${APKO_TEST_FROM_ENV}",
+		want: "FOO: env",
+	}, {
+		name: "values over environment",
+		vars: types.Variables{Values: map[string]string{"APKO_TEST_FROM_ENV": "value"}},
+		in:   "FOO: ${APKO_TEST_FROM_ENV}",
+		want: "FOO: value",
+	}, {
+		name: "escaped",
+		vars: types.Variables{Values: map[string]string{"HOME": "/root"}},
+		in:   "cmd: echo $${HOME} ${HOME} $HOME",
+		want: "cmd: echo ${HOME} /root $HOME",
+	}, {
+		name: "undefined",
+		in:   "tag: ${APKO_TEST_UNDEFINED}",
+		want: "tag: ",
+	}, {
+		name:    "undefined strict",
+		vars:    types.Variables{Strict: true},
+		in:      "tag: ${APKO_TEST_UNDEFINED}-${APKO_TEST_UNDEFINED}",
+		wantErr: `variable "APKO_TEST_UNDEFINED" is not defined`,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.vars.Expand([]byte(tt.in))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestLoadWithVariables(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(`contents:
+  packages:
+    - base=${VERSION}
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apko.yaml"), []byte(`include: ${BASE}
+environment:
+  SCRIPT: echo $${HOME}
+annotations:
+  org.opencontainers.image.version: ${VERSION}
+`), 0o644))
+
+	vars := &types.Variables{Values: map[string]string{
+		"BASE":    filepath.Join(dir, "base.yaml"),
+		"VERSION": "1.2.3",
+	}}
+	ic := types.ImageConfiguration{}
+	require.NoError(t, ic.LoadWithVariables(ctx, filepath.Join(dir, "apko.yaml"), nil, sha256.New(), vars))
+	require.Equal(t, []string{"base=1.2.3"}, ic.Contents.Packages)
+	require.Equal(t, "echo ${HOME}", ic.Environment["SCRIPT"])
+	require.Equal(t, "1.2.3", ic.Annotations["org.opencontainers.image.version"])
+
+	vars = &types.Variables{Values: map[string]string{"BASE": filepath.Join(dir, "base.yaml")}, Strict: true}
+	ic = types.ImageConfiguration{}
+	err := ic.LoadWithVariables(ctx, filepath.Join(dir, "apko.yaml"), nil, sha256.New(), vars)
+	require.ErrorContains(t, err, `variable "VERSION" is not defined`)
+}
@@ -0,0 +1,333 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+const (
+	// VendorManifestFile is the manifest of a vendor directory, in it.
+	VendorManifestFile = "vendor.json"
+
+	// vendorCacheDir holds the package cache of a vendor directory: the
+	// APKINDEX files, packages and keyring keys fetched over the network.
+	vendorCacheDir = "cache"
+	// vendorKeysDir holds every key the keyring ended up with, including
+	// discovered ones, which the package cache does not keep.
+	vendorKeysDir = "keys"
+)
+
+// VendorManifest describes what a vendor directory holds.
+type VendorManifest struct {
+	// Config is the configuration the directory was vendored for.
+	Config VendorConfig `json:"config"`
+	// Packages are the packages resolved for each architecture.
+	Packages []VendoredPackage `json:"packages"`
+	// Files are the sha256 checksums of every file in the directory, by
+	// slash-separated path relative to it.
+	Files map[string]string `json:"files"`
+}
+
+// VendorConfig is the configuration a vendor directory was vendored for.
+type VendorConfig struct {
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+}
+
+// VendoredPackage is a package of a vendor directory.
+type VendoredPackage struct {
+	Arch     string `json:"arch"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	URL      string `json:"url"`
+}
+
+// Vendor resolves the configuration set up by opts for archs, and downloads
+// the APKINDEX files, packages and keys a build of it needs into dir, with
+// a manifest of their checksums, for WithVendorDir to build from without
+// the network. With WithLockFile, the packages it locks are vendored.
+// Packages of local repositories are used in place, and not copied.
+func Vendor(ctx context.Context, dir string, archs []types.Architecture, opts ...Option) (*VendorManifest, error) {
+	log := clog.FromContext(ctx)
+
+	o, ic, err := NewOptions(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(o.TempDir())
+	if ic.Contents.BaseImage != nil {
+		return nil, fmt.Errorf("vendoring configurations with a base image is not supported")
+	}
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+
+	cacheDir := filepath.Join(dir, vendorCacheDir)
+	keysDir := filepath.Join(dir, vendorKeysDir)
+	for _, d := range []string{cacheDir, keysDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, fmt.Errorf("creating %s: %w", d, err)
+		}
+	}
+
+	wd, err := os.MkdirTemp("", "apko-vendor-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	// With a lockfile, the packages it locks are vendored, rather than
+	// those resolved.
+	var locked *lock.Lock
+	if o.Lockfile != "" {
+		l, err := lock.FromFile(o.Lockfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load lock-file: %w", err)
+		}
+		locked = &l
+	}
+
+	m := &VendorManifest{
+		Config:   VendorConfig{Name: o.ImageConfigFile, Checksum: o.ImageConfigChecksum},
+		Packages: []VendoredPackage{},
+	}
+	shared := apk.NewCache(true)
+	for _, arch := range ic.Archs {
+		log := log.With("arch", arch.ToAPK())
+		ctx := clog.WithLogger(ctx, log)
+		log.Infof("vendoring packages")
+
+		fsys := apkfs.DirFS(ctx, filepath.Join(wd, arch.ToAPK()), apkfs.WithCreateDir())
+		bc, err := New(ctx, fsys, append(slices.Clone(opts), WithArch(arch), WithCache(cacheDir, false, shared))...)
+		if err != nil {
+			return nil, err
+		}
+		if locked != nil {
+			// Installing the locked packages fetches exactly them into the
+			// cache.
+			if _, err := bc.installPackages(ctx); err != nil {
+				return nil, err
+			}
+			for _, p := range locked.Contents.Packages {
+				if p.Architecture != arch.ToAPK() {
+					continue
+				}
+				m.Packages = append(m.Packages, VendoredPackage{
+					Arch:     p.Architecture,
+					Name:     p.Name,
+					Version:  p.Version,
+					Checksum: p.Checksum,
+					URL:      p.URL,
+				})
+			}
+		} else {
+			// Resolving fetches every package into the cache.
+			resolved, err := bc.ResolveWithBase(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get package list for image: %w", err)
+			}
+			for _, r := range resolved {
+				m.Packages = append(m.Packages, VendoredPackage{
+					Arch:     arch.ToAPK(),
+					Name:     r.Package.Name,
+					Version:  r.Package.Version,
+					Checksum: r.Package.ChecksumString(),
+					URL:      r.Package.URL(),
+				})
+			}
+		}
+		if err := vendorKeys(fsys, keysDir); err != nil {
+			return nil, fmt.Errorf("vendoring keys: %w", err)
+		}
+	}
+	slices.SortFunc(m.Packages, func(a, b VendoredPackage) int {
+		return cmp.Or(cmp.Compare(a.Arch, b.Arch), cmp.Compare(a.Name, b.Name))
+	})
+
+	if m.Files, err = checksumVendorDir(dir); err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, VendorManifestFile), append(b, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("writing vendor manifest: %w", err)
+	}
+	log.Infof("vendored %d packages and %d files into %s", len(m.Packages), len(m.Files), dir)
+	return m, nil
+}
+
+// vendorKeys copies the keys of the keyring of fsys into keysDir.
+func vendorKeys(fsys apkfs.FullFS, keysDir string) error {
+	entries, err := fsys.ReadDir(path.Join("etc", "apk", "keys"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".pub" {
+			continue
+		}
+		data, err := fsys.ReadFile(path.Join("etc", "apk", "keys", e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(keysDir, e.Name()), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checksumVendorDir returns the sha256 checksums of the files in dir, but
+// its manifest, by slash-separated path relative to it.
+func checksumVendorDir(dir string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == VendorManifestFile {
+			return nil
+		}
+		sum, err := sha256File(p)
+		if err != nil {
+			return err
+		}
+		sums[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checksumming %s: %w", dir, err)
+	}
+	return sums, nil
+}
+
+func sha256File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ReadVendorManifest reads the manifest of the vendor directory dir and
+// checks that every file it lists is there, with its checksum.
+func ReadVendorManifest(dir string) (*VendorManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, VendorManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading vendor manifest: %w", err)
+	}
+	var m VendorManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parsing vendor manifest: %w", err)
+	}
+	var bad []string
+	for rel, want := range m.Files {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return nil, fmt.Errorf("vendor manifest lists %s, which is outside of %s", rel, dir)
+		}
+		got, err := sha256File(filepath.Join(dir, filepath.FromSlash(rel)))
+		switch {
+		case err != nil:
+			bad = append(bad, fmt.Sprintf("%s: %v", rel, err))
+		case got != want:
+			bad = append(bad, fmt.Sprintf("%s: checksum %s, expected %s", rel, got, want))
+		}
+	}
+	if len(bad) != 0 {
+		slices.Sort(bad)
+		return nil, fmt.Errorf("vendor directory %s does not match its manifest:\n%s", dir, strings.Join(bad, "\n"))
+	}
+	return &m, nil
+}
+
+// WithVendorDir builds from the vendor directory dir, written by Vendor,
+// without the network: its files are checked against its manifest, it is
+// the package cache, used offline, and its keys are added to the keyring.
+// The directory is checked once, however many times the option is applied,
+// and it is the cache whatever other options come before or after it. An
+// empty dir does nothing.
+func WithVendorDir(dir string) Option {
+	var once sync.Once
+	var err error
+	return func(bc *Context) error {
+		if dir == "" {
+			return nil
+		}
+		once.Do(func() {
+			_, err = ReadVendorManifest(dir)
+		})
+		if err != nil {
+			return err
+		}
+		bc.vendorDir = dir
+		return nil
+	}
+}
+
+// applyVendorDir makes the vendor directory of WithVendorDir, if any, the
+// package cache, used offline, and adds its keys to the keyring.
+func (bc *Context) applyVendorDir() {
+	if bc.vendorDir == "" {
+		return
+	}
+	bc.o.CacheDir = filepath.Join(bc.vendorDir, vendorCacheDir)
+	bc.o.Offline = true
+	if bc.o.SharedCache == nil {
+		bc.o.SharedCache = apk.NewCache(true)
+	}
+	keysDir := filepath.Join(bc.vendorDir, vendorKeysDir)
+	if matches, _ := filepath.Glob(filepath.Join(keysDir, "*.pub")); len(matches) != 0 {
+		bc.keyringDirs = append(bc.keyringDirs, keysDir)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestVendor(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "1")
+		http.FileServer(http.Dir("testdata/packages")).ServeHTTP(w, r)
+	}))
+	ic := types.ImageConfiguration{
+		Contents: types.ImageContents{
+			Repositories: []string{s.URL},
+			Keyring:      []string{s.URL + "/melange.rsa.pub"},
+			Packages:     []string{"pretend-baselayout"},
+		},
+	}
+	archs := types.ParseArchitectures([]string{"amd64"})
+
+	dir := t.TempDir()
+	m, err := build.Vendor(ctx, dir, archs, build.WithImageConfiguration(ic))
+	require.NoError(t, err)
+	require.Len(t, m.Packages, 1)
+	require.Equal(t, "pretend-baselayout", m.Packages[0].Name)
+	require.Contains(t, m.Files, "keys/melange.rsa.pub")
+	s.Close()
+
+	// Without the server, everything comes from the vendor directory.
+	bc, err := build.New(ctx, fs.NewMemFS(),
+		build.WithImageConfiguration(ic),
+		build.WithArch(archs[0]),
+		build.WithVendorDir(dir),
+	)
+	require.NoError(t, err)
+	resolved, err := bc.ResolveWithBase(ctx)
+	require.NoError(t, err)
+	require.Len(t, resolved, 1)
+
+	// Nor does it matter whether another cache comes before or after it.
+	bc, err = build.New(ctx, fs.NewMemFS(),
+		build.WithVendorDir(dir),
+		build.WithCache(t.TempDir(), false, nil),
+		build.WithImageConfiguration(ic),
+		build.WithArch(archs[0]),
+	)
+	require.NoError(t, err)
+	resolved, err = bc.ResolveWithBase(ctx)
+	require.NoError(t, err)
+	require.Len(t, resolved, 1)
+
+	// A vendor directory that does not match its manifest is refused.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keys", "melange.rsa.pub"), []byte("tampered"), 0o644))
+	_, err = build.New(ctx, fs.NewMemFS(), build.WithImageConfiguration(ic), build.WithVendorDir(dir))
+	require.ErrorContains(t, err, "does not match its manifest")
+}
@@ -0,0 +1,229 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package disk lays out GPT partitioned disk images.
+package disk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/u-root/u-root/pkg/mount/gpt"
+)
+
+const (
+	// SectorSize is the size of the sectors of disk images.
+	SectorSize = gpt.BlockSize
+
+	// Alignment is what partitions start and end at multiples of.
+	Alignment = 1 << 20
+
+	// tableSectors is the size of each partition entry array, of 128
+	// entries of 128 bytes.
+	tableSectors = gpt.MaxNPart * 128 / SectorSize
+)
+
+// GUID is a GUID as GPT writes it.
+type GUID = gpt.GUID
+
+// Partition type GUIDs, from the UEFI specification and the Discoverable
+// Partitions Specification.
+var (
+	TypeEFI   = MustParseGUID("c12a7328-f81f-11d2-ba4b-00a0c93ec93b")
+	TypeLinux = MustParseGUID("0fc63daf-8483-4772-8e79-3d69d8477de4")
+
+	rootTypes = map[string]GUID{
+		"amd64":   MustParseGUID("4f68bce3-e8cd-4db1-96e7-fbcaf984b709"),
+		"arm64":   MustParseGUID("b921b045-1df0-41c3-af44-4c6f280d3fae"),
+		"riscv64": MustParseGUID("72ec70a6-cf74-40e6-bd49-4bda08e8f224"),
+		"386":     MustParseGUID("44479540-f297-41b2-9af7-d131d5f0458a"),
+	}
+)
+
+// RootType returns the type GUID of the root partition for goarch, which
+// lets systemd find it, or the generic Linux type for other architectures.
+func RootType(goarch string) GUID {
+	if t, ok := rootTypes[goarch]; ok {
+		return t
+	}
+	return TypeLinux
+}
+
+// ParseGUID parses a GUID written as 01234567-89ab-cdef-0123-456789abcdef.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 || len(s) != 36 {
+		return g, fmt.Errorf("%q is not a GUID", s)
+	}
+	g.L = binary.BigEndian.Uint32(b[0:4])
+	g.W1 = binary.BigEndian.Uint16(b[4:6])
+	g.W2 = binary.BigEndian.Uint16(b[6:8])
+	copy(g.B[:], b[8:])
+	return g, nil
+}
+
+// MustParseGUID is ParseGUID but panics on errors.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// NewGUID returns a random-looking version 4 GUID that is the same for the
+// same seed and name, so that disk images are reproducible.
+func NewGUID(seed []byte, name string) GUID {
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	b := h.Sum(nil)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return GUID{
+		L:  binary.BigEndian.Uint32(b[0:4]),
+		W1: binary.BigEndian.Uint16(b[4:6]),
+		W2: binary.BigEndian.Uint16(b[6:8]),
+		B:  [8]byte(b[8:16]),
+	}
+}
+
+// Partition is a partition of a disk image.
+type Partition struct {
+	// Name is the name of the partition in the partition table.
+	Name string
+	// Type is the type GUID of the partition.
+	Type GUID
+	// GUID is the unique GUID of the partition.
+	GUID GUID
+	// Size is the size of the partition in bytes, which Layout rounds up
+	// to Alignment. Only the last partition can have no size, and then
+	// fills the rest of the disk.
+	Size int64
+	// Offset is where the partition starts on the disk, set by Layout.
+	Offset int64
+}
+
+// Layout places parts on a disk of size bytes, one after the other from the
+// first Alignment, and sets their offsets and sizes. When size is 0, the disk
+// is as large as its partitions need. It returns the size of the disk.
+func Layout(size int64, parts []Partition) (int64, error) {
+	// The partition table at the end fits in the Alignment after the last
+	// partition.
+	offset := int64(Alignment)
+	for i := range parts {
+		p := &parts[i]
+		p.Offset = offset
+		switch {
+		case p.Size > 0:
+			p.Size = alignUp(p.Size)
+		case i != len(parts)-1:
+			return 0, fmt.Errorf("partition %s has no size, which only the last partition can leave out", p.Name)
+		case size == 0:
+			return 0, fmt.Errorf("partition %s has no size, which the disk needs to fill", p.Name)
+		default:
+			p.Size = alignDown(size) - Alignment - offset
+			if p.Size <= 0 {
+				return 0, fmt.Errorf("a disk of %d bytes has no room for partition %s", size, p.Name)
+			}
+		}
+		offset += p.Size
+	}
+	need := offset + Alignment
+	if size == 0 {
+		return need, nil
+	}
+	if size < need {
+		return 0, fmt.Errorf("a disk of %d bytes is too small for partitions that need %d", size, need)
+	}
+	if size%SectorSize != 0 {
+		return 0, fmt.Errorf("a disk of %d bytes is not a whole number of sectors", size)
+	}
+	return size, nil
+}
+
+func alignUp(n int64) int64 {
+	return (n + Alignment - 1) / Alignment * Alignment
+}
+
+func alignDown(n int64) int64 {
+	return n / Alignment * Alignment
+}
+
+// WriteTable writes a protective MBR and the primary and backup GPT for
+// parts, laid out by Layout, to w, a disk of size bytes.
+func WriteTable(w io.WriterAt, size int64, diskGUID GUID, parts []Partition) error {
+	if len(parts) > gpt.MaxNPart {
+		return fmt.Errorf("a disk can have at most %d partitions", gpt.MaxNPart)
+	}
+	sectors := uint64(size / SectorSize)
+	entries := make([]gpt.Part, gpt.MaxNPart)
+	for i, p := range parts {
+		name := utf16.Encode([]rune(p.Name))
+		if len(name) > 36 {
+			return fmt.Errorf("partition name %q is longer than 36 characters", p.Name)
+		}
+		e := gpt.Part{
+			PartGUID:   p.Type,
+			UniqueGUID: p.GUID,
+			FirstLBA:   uint64(p.Offset / SectorSize),
+			LastLBA:    uint64((p.Offset+p.Size)/SectorSize) - 1,
+		}
+		for j, u := range name {
+			binary.LittleEndian.PutUint16(e.Name[2*j:], u)
+		}
+		entries[i] = e
+	}
+
+	header := gpt.Header{
+		Signature:  gpt.Signature,
+		Revision:   gpt.Revision,
+		HeaderSize: gpt.HeaderSize,
+		FirstLBA:   2 + tableSectors,
+		LastLBA:    sectors - 2 - tableSectors,
+		DiskGUID:   diskGUID,
+		NPart:      gpt.MaxNPart,
+		PartSize:   128,
+	}
+	primary, backup := header, header
+	primary.CurrentLBA, primary.BackupLBA, primary.PartStart = 1, sectors-1, 2
+	backup.CurrentLBA, backup.BackupLBA, backup.PartStart = sectors-1, 1, sectors-1-tableSectors
+
+	return gpt.Write(w, &gpt.PartitionTable{
+		MasterBootRecord: protectiveMBR(sectors),
+		Primary:          &gpt.GPT{Header: primary, Parts: entries},
+		Backup:           &gpt.GPT{Header: backup, Parts: entries},
+	})
+}
+
+// protectiveMBR returns an MBR with a single partition of type 0xee over the
+// whole disk, so that tools that do not know GPT leave it alone.
+func protectiveMBR(sectors uint64) *gpt.MBR {
+	var mbr gpt.MBR
+	entry := mbr[446:462]
+	copy(entry[1:4], []byte{0x00, 0x02, 0x00})
+	entry[4] = 0xee
+	copy(entry[5:8], []byte{0xff, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(entry[8:], 1)
+	binary.LittleEndian.PutUint32(entry[12:], uint32(min(sectors-1, 0xffffffff))) //nolint:gosec // bounded by min
+	mbr[510], mbr[511] = 0x55, 0xaa
+	return &mbr
+}
@@ -0,0 +1,92 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/u-root/u-root/pkg/mount/gpt"
+)
+
+const mib = 1 << 20
+
+func TestLayout(t *testing.T) {
+	parts := []Partition{{Name: "EFI", Size: 100 * 1000 * 1000}, {Name: "root", Size: 10 * mib}}
+	size, err := Layout(0, parts)
+	require.NoError(t, err)
+	require.Equal(t, int64(108*mib), size)
+	require.Equal(t, int64(mib), parts[0].Offset)
+	require.Equal(t, int64(96*mib), parts[0].Size)
+	require.Equal(t, int64(97*mib), parts[1].Offset)
+
+	parts = []Partition{{Name: "EFI", Size: mib}, {Name: "root"}}
+	size, err = Layout(64*mib+512, parts)
+	require.NoError(t, err)
+	require.Equal(t, int64(64*mib+512), size)
+	require.Equal(t, int64(61*mib), parts[1].Size)
+
+	_, err = Layout(0, []Partition{{Name: "root"}})
+	require.ErrorContains(t, err, "which the disk needs to fill")
+	_, err = Layout(64*mib, []Partition{{Name: "root"}, {Name: "EFI", Size: mib}})
+	require.ErrorContains(t, err, "only the last partition")
+	_, err = Layout(2*mib, []Partition{{Name: "root", Size: mib}})
+	require.ErrorContains(t, err, "too small")
+}
+
+func TestWriteTable(t *testing.T) {
+	seed := []byte("seed")
+	parts := []Partition{
+		{Name: "EFI", Type: TypeEFI, GUID: NewGUID(seed, "EFI"), Size: 2 * mib},
+		{Name: "root", Type: RootType("amd64"), GUID: NewGUID(seed, "root")},
+	}
+	size, err := Layout(16*mib, parts)
+	require.NoError(t, err)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, WriteTable(f, size, NewGUID(seed, ""), parts))
+
+	table, err := gpt.New(f)
+	require.NoError(t, err)
+	require.Equal(t, byte(0xee), table.MasterBootRecord[450])
+	require.Equal(t, uint64(size/SectorSize-1), table.Primary.BackupLBA)
+	require.Equal(t, "c12a7328-f81f-11d2-ba4b-00a0c93ec93b", table.Primary.Parts[0].PartGUID.String())
+	require.Equal(t, "4f68bce3-e8cd-4db1-96e7-fbcaf984b709", table.Primary.Parts[1].PartGUID.String())
+	require.Equal(t, NewGUID(seed, "root"), table.Primary.Parts[1].UniqueGUID)
+	require.Equal(t, uint64(2048), table.Primary.Parts[0].FirstLBA)
+	require.Equal(t, uint64(6143), table.Primary.Parts[0].LastLBA)
+	require.Equal(t, uint64(6144), table.Primary.Parts[1].FirstLBA)
+	require.Equal(t, uint64(size/SectorSize-2048-1), table.Primary.Parts[1].LastLBA)
+	require.Equal(t, []byte{'r', 0, 'o', 0, 'o', 0, 't', 0, 0, 0}, table.Primary.Parts[1].Name[:10])
+	require.Zero(t, table.Primary.Parts[2].FirstLBA)
+}
+
+func TestGUID(t *testing.T) {
+	g, err := ParseGUID("0fc63daf-8483-4772-8e79-3d69d8477de4")
+	require.NoError(t, err)
+	require.Equal(t, "0fc63daf-8483-4772-8e79-3d69d8477de4", g.String())
+	_, err = ParseGUID("0fc63daf")
+	require.Error(t, err)
+
+	a, b := NewGUID([]byte("a"), "root"), NewGUID([]byte("b"), "root")
+	require.NotEqual(t, a, b)
+	require.Equal(t, a, NewGUID([]byte("a"), "root"))
+	require.Equal(t, byte('4'), a.String()[14])
+}
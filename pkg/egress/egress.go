@@ -0,0 +1,144 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package egress restricts the URLs a build may reach over the network.
+package egress
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+// Allowlist is a set of patterns outbound requests must match.
+//
+// A pattern containing "://" is a URL prefix, such as
+// "https://packages.wolfi.dev/os/": requests must have its scheme and host,
+// and port, exactly, and a path that is its path or below it, a whole path
+// segment at a time. Any other pattern is a path.Match pattern for the host
+// name, such as "*.example.com".
+type Allowlist struct {
+	prefixes []*url.URL
+	hosts    []string
+}
+
+// NewAllowlist returns an Allowlist of patterns.
+func NewAllowlist(patterns []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, p := range patterns {
+		if strings.Contains(p, "://") {
+			u, err := url.Parse(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid egress pattern %q: %w", p, err)
+			}
+			if u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+				return nil, fmt.Errorf("invalid egress pattern %q: must be a scheme, host and optional path", p)
+			}
+			a.prefixes = append(a.prefixes, u)
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid egress pattern %q: %w", p, err)
+		}
+		a.hosts = append(a.hosts, p)
+	}
+	return a, nil
+}
+
+// Allows reports whether u matches any pattern of the allowlist.
+func (a *Allowlist) Allows(u *url.URL) bool {
+	for _, p := range a.prefixes {
+		if matchPrefix(p, u) {
+			return true
+		}
+	}
+	for _, p := range a.hosts {
+		if ok, _ := path.Match(p, u.Hostname()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPorts are the ports of URLs without one, by scheme.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// matchPrefix reports whether u has the scheme, host and port of p, and a
+// path at or below its path.
+func matchPrefix(p, u *url.URL) bool {
+	if !strings.EqualFold(p.Scheme, u.Scheme) || !strings.EqualFold(p.Hostname(), u.Hostname()) {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if cmp.Or(p.Port(), defaultPorts[scheme]) != cmp.Or(u.Port(), defaultPorts[scheme]) {
+		return false
+	}
+	prefix := strings.TrimSuffix(p.Path, "/")
+	if prefix == "" {
+		return true
+	}
+	// Dot segments are resolved, so that /os/../other is not below /os.
+	upath := path.Clean("/" + u.Path)
+	return upath == prefix || strings.HasPrefix(upath, prefix+"/")
+}
+
+// DeniedError is returned for requests the allowlist does not allow.
+type DeniedError struct {
+	URL string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("egress to %s is not allowed", e.URL)
+}
+
+// Transport wraps base so that every request must be allowed.
+//
+// Denied requests fail with a *DeniedError without reaching the network, and
+// are logged and reported as an events.EgressDenied event so they leave an
+// audit record.
+func (a *Allowlist) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{allow: a, base: base}
+}
+
+type transport struct {
+	allow *Allowlist
+	base  http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.allow.Allows(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	u := req.URL.Redacted()
+	err := &DeniedError{URL: u}
+	clog.FromContext(ctx).Errorf("egress denied: %s %s", req.Method, u)
+	events.Emit(ctx, events.Event{
+		Type:      events.EgressDenied,
+		Reference: u,
+		Error:     err.Error(),
+	})
+	return nil, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/egress"
+	"chainguard.dev/apko/pkg/events"
+)
+
+func TestAllows(t *testing.T) {
+	allow, err := egress.NewAllowlist([]string{"https://packages.wolfi.dev/os/", "https://dl-cdn.alpinelinux.org", "*.example.com"})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz", true},
+		{"https://packages.wolfi.dev/other/x86_64/APKINDEX.tar.gz", false},
+		{"http://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz", false},
+		{"https://registry.example.com/v2/", true},
+		{"https://registry.example.com:5000/v2/", true},
+		{"https://example.com/v2/", false},
+		{"https://evil.com/?u=registry.example.com", false},
+		{"https://packages.wolfi.dev:443/os/x86_64/APKINDEX.tar.gz", true},
+		{"https://PACKAGES.wolfi.dev/os/", true},
+		{"https://packages.wolfi.dev/os", true},
+		{"https://dl-cdn.alpinelinux.org/alpine/edge/main", true},
+		// Bypasses of a plain string prefix.
+		{"https://packages.wolfi.dev/osx/x86_64/APKINDEX.tar.gz", false},
+		{"https://packages.wolfi.dev/os/../other/APKINDEX.tar.gz", false},
+		{"https://packages.wolfi.dev:8443/os/x86_64/APKINDEX.tar.gz", false},
+		{"https://dl-cdn.alpinelinux.org.evil.com/alpine/", false},
+		{"https://dl-cdn.alpinelinux.org@evil.com/alpine/", false},
+		{"https://dl-cdn.alpinelinux.org:1@evil.com/alpine/", false},
+		{"https://dl-cdn.alpinelinux.organization/alpine/", false},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, allow.Allows(u))
+		})
+	}
+}
+
+func TestNewAllowlist(t *testing.T) {
+	for _, p := range []string{"https://user@packages.wolfi.dev/", "https://packages.wolfi.dev/?x=1", "https:///os/", "[a-"} {
+		_, err := egress.NewAllowlist([]string{p})
+		require.Error(t, err, p)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	allow, err := egress.NewAllowlist([]string{s.URL + "/allowed/"})
+	require.NoError(t, err)
+	client := &http.Client{Transport: allow.Transport(s.Client().Transport)}
+
+	var buf bytes.Buffer
+	ctx := events.WithEmitter(context.Background(), events.NewJSONLines(&buf))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/allowed/foo", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Zero(t, buf.Len())
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/denied", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req) //nolint:bodyclose
+	var denied *egress.DeniedError
+	require.True(t, errors.As(err, &denied))
+	require.Equal(t, s.URL+"/denied", denied.URL)
+
+	var ev events.Event
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &ev))
+	require.Equal(t, events.EgressDenied, ev.Type)
+	require.Equal(t, s.URL+"/denied", ev.Reference)
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events reports machine-readable progress of a build.
+//
+// An Emitter is attached to a context with WithEmitter, and anything that
+// builds or publishes with that context reports to it. Without an Emitter,
+// emitting is a no-op. Library consumers subscribe with an EmitterFunc, and
+// several subscribers can be combined with Multi.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an Event.
+type Type string
+
+const (
+	// PhaseStarted is emitted when a build phase begins.
+	PhaseStarted Type = "phase.started"
+	// PhaseFinished is emitted when a build phase ends, successfully or not.
+	PhaseFinished Type = "phase.finished"
+	// PackagesResolved is emitted before installing packages into an image,
+	// with the number of packages to install as Total.
+	PackagesResolved Type = "packages.resolved"
+	// PackageFetched is emitted for each package downloaded, or found in
+	// the cache, before it is installed.
+	PackageFetched Type = "package.fetched"
+	// PackageInstalled is emitted for each package installed into an image.
+	PackageInstalled Type = "package.installed"
+	// LayerBuilt is emitted for each image layer built.
+	LayerBuilt Type = "layer.built"
+	// DigestComputed is emitted with the digest of each image and index
+	// built; an index has no Arch.
+	DigestComputed Type = "digest.computed"
+	// ArtifactPublished is emitted for each manifest pushed to a registry.
+	ArtifactPublished Type = "artifact.published"
+	// TagPushed is emitted for each tag pushed to a registry.
+	TagPushed Type = "tag.pushed"
+	// EgressDenied is emitted for each request blocked by an egress allowlist.
+	EgressDenied Type = "egress.denied"
+)
+
+// Event is a single point of progress.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	Phase     string    `json:"phase,omitempty"`
+	Arch      string    `json:"arch,omitempty"`
+	Package   string    `json:"package,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	Digest    string    `json:"digest,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Emitter receives events. Implementations must be safe for concurrent use.
+type Emitter interface {
+	Emit(Event)
+}
+
+// EmitterFunc adapts a function to an Emitter.
+type EmitterFunc func(Event)
+
+// Emit calls f(ev).
+func (f EmitterFunc) Emit(ev Event) { f(ev) }
+
+// Multi returns an Emitter that reports every event to each of emitters, in
+// order.
+func Multi(emitters ...Emitter) Emitter {
+	return multi(emitters)
+}
+
+type multi []Emitter
+
+func (m multi) Emit(ev Event) {
+	for _, e := range m {
+		e.Emit(ev)
+	}
+}
+
+type emitterKey struct{}
+
+// WithEmitter returns a context that reports events to e.
+func WithEmitter(ctx context.Context, e Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, e)
+}
+
+// FromContext returns the Emitter attached to ctx, or nil.
+func FromContext(ctx context.Context) Emitter {
+	e, _ := ctx.Value(emitterKey{}).(Emitter)
+	return e
+}
+
+// Emit reports ev to the Emitter attached to ctx, if any.
+func Emit(ctx context.Context, ev Event) {
+	e := FromContext(ctx)
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	e.Emit(ev)
+}
+
+// StartPhase emits PhaseStarted for phase and returns a function that
+// emits the matching PhaseFinished, recording err if it is non-nil.
+func StartPhase(ctx context.Context, phase, arch string) func(err error) {
+	start := time.Now()
+	Emit(ctx, Event{Type: PhaseStarted, Phase: phase, Arch: arch})
+	return func(err error) {
+		ev := Event{
+			Type:     PhaseFinished,
+			Phase:    phase,
+			Arch:     arch,
+			Duration: time.Since(start).String(),
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		Emit(ctx, ev)
+	}
+}
+
+// NewJSONLines returns an Emitter that writes each event to w as a single
+// line of JSON.
+func NewJSONLines(w io.Writer) Emitter {
+	return &jsonLines{enc: json.NewEncoder(w)}
+}
+
+type jsonLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (j *jsonLines) Emit(ev Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// Events are best-effort; a broken sink must not fail the build.
+	_ = j.enc.Encode(ev)
+}
@@ -0,0 +1,76 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := events.WithEmitter(context.Background(), events.NewJSONLines(&buf))
+
+	done := events.StartPhase(ctx, "build-image", "amd64")
+	events.Emit(ctx, events.Event{Type: events.PackageInstalled, Arch: "amd64", Package: "busybox", Version: "1.36.1-r0"})
+	done(errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+
+	var got []events.Event
+	for _, l := range lines {
+		var ev events.Event
+		require.NoError(t, json.Unmarshal([]byte(l), &ev))
+		require.False(t, ev.Time.IsZero())
+		got = append(got, ev)
+	}
+	require.Equal(t, events.PhaseStarted, got[0].Type)
+	require.Equal(t, "build-image", got[0].Phase)
+	require.Equal(t, events.PackageInstalled, got[1].Type)
+	require.Equal(t, "busybox", got[1].Package)
+	require.Equal(t, events.PhaseFinished, got[2].Type)
+	require.Equal(t, "boom", got[2].Error)
+	require.NotEmpty(t, got[2].Duration)
+}
+
+func TestEmitWithoutEmitter(t *testing.T) {
+	// Must not panic.
+	events.Emit(context.Background(), events.Event{Type: events.PhaseStarted})
+	events.StartPhase(context.Background(), "build-image", "")(nil)
+}
+
+func TestMulti(t *testing.T) {
+	var a, b []events.Type
+	ctx := events.WithEmitter(context.Background(), events.Multi(
+		events.EmitterFunc(func(ev events.Event) { a = append(a, ev.Type) }),
+		events.EmitterFunc(func(ev events.Event) { b = append(b, ev.Type) }),
+	))
+
+	events.Emit(ctx, events.Event{Type: events.PackagesResolved, Total: 2})
+	events.Emit(ctx, events.Event{Type: events.TagPushed})
+
+	want := []events.Type{events.PackagesResolved, events.TagPushed}
+	require.Equal(t, want, a)
+	require.Equal(t, want, b)
+}
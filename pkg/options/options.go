@@ -22,6 +22,8 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
 	"chainguard.dev/apko/pkg/build/types"
@@ -57,11 +59,16 @@ type Options struct {
 	WithVCS bool `json:"withVCS,omitempty"`
 	// ImageConfigFile might, but does not have to be a filename. It might be any abstract configuration identifier.
 	ImageConfigFile string `json:"imageConfigFile,omitempty"`
+	// ConfigVariables (when set) are substituted in the configuration as it is loaded.
+	ConfigVariables *types.Variables `json:"-"`
 	// ImageConfigChecksum (when set) allows to detect mismatch between configuration and the lockfile.
-	ImageConfigChecksum     string                `json:"configChecksum,omitempty"`
-	TarballPath             string                `json:"tarballPath,omitempty"`
-	Tags                    []string              `json:"tags,omitempty"`
-	SourceDateEpoch         time.Time             `json:"sourceDateEpoch,omitempty"`
+	ImageConfigChecksum string    `json:"configChecksum,omitempty"`
+	TarballPath         string    `json:"tarballPath,omitempty"`
+	Tags                []string  `json:"tags,omitempty"`
+	SourceDateEpoch     time.Time `json:"sourceDateEpoch,omitempty"`
+	// BuildDateFromPackages dates the image at the newest build time of its
+	// packages, ignoring SOURCE_DATE_EPOCH.
+	BuildDateFromPackages   bool                  `json:"buildDateFromPackages,omitempty"`
 	SBOMPath                string                `json:"sbomPath,omitempty"`
 	SBOMGenerators          []generator.Generator `json:"-"`
 	ExtraKeyFiles           []string              `json:"extraKeyFiles,omitempty"`
@@ -83,8 +90,42 @@ type Options struct {
 	IncludePaths            []string              `json:"includePaths,omitempty"`
 	IgnoreSignatures        bool                  `json:"ignoreSignatures,omitempty"`
 	Transport               http.RoundTripper     `json:"-"`
-	PackageGetter           apk.PackageGetter     `json:"-"`
-	SizeLimits              SizeLimits            `json:"sizeLimits,omitempty"`
+	// Keychain authenticates to registries, of the base image, of oci://
+	// repositories and of configurations in registries. The default is
+	// authn.DefaultKeychain.
+	Keychain      authn.Keychain    `json:"-"`
+	PackageGetter apk.PackageGetter `json:"-"`
+	SizeLimits    SizeLimits        `json:"sizeLimits,omitempty"`
+	// RequireSignedPackages fails the build on packages that are not
+	// signed by a key in the keyring or do not match their index.
+	RequireSignedPackages bool `json:"requireSignedPackages,omitempty"`
+	// ValidateRuntime fails the build unless the entrypoint, working
+	// directory and run-as user of the image are in its filesystem.
+	ValidateRuntime bool `json:"validateRuntime,omitempty"`
+	// RunScriptlets runs the pre-install and post-install scripts of the
+	// installed packages in ScriptletSandbox.
+	RunScriptlets bool `json:"runScriptlets,omitempty"`
+	// ScriptletSandbox is how scriptlets are run: "proot", the default,
+	// "chroot" or "bwrap".
+	ScriptletSandbox string `json:"scriptletSandbox,omitempty"`
+	// ScriptletPackages are the packages whose scriptlets are run; empty
+	// means all of them.
+	ScriptletPackages []string `json:"scriptletPackages,omitempty"`
+	// RegistryCAFile holds extra PEM certificates to trust when publishing.
+	RegistryCAFile string `json:"registryCAFile,omitempty"`
+	// InsecureRegistries may be published to over plain HTTP or without
+	// verifying their certificates.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+	// Jobs bounds how many architectures are built at once; 0 builds them
+	// all at once.
+	Jobs int `json:"jobs,omitempty"`
+	// LayerFormat is how layers are compressed: "gzip", the default, or
+	// "estargz" for layers that can be lazily pulled.
+	LayerFormat string `json:"layerFormat,omitempty"`
+	// MaxSize overrides the max-size of the configuration where set.
+	MaxSize types.ImageSizeBudget `json:"maxSize,omitempty"`
+	// Policies are the Rego or CUE policies the build must comply with.
+	Policies []string `json:"policies,omitempty"`
 }
 
 type Auth struct{ User, Pass string }
@@ -0,0 +1,136 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passwd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// ShadowEntry describes a single line in /etc/shadow.
+//
+// The password aging fields are kept as they are written, as any of them
+// may be empty.
+type ShadowEntry struct {
+	UserName   string
+	Password   string
+	LastChange string
+	MinAge     string
+	MaxAge     string
+	Warn       string
+	Inactive   string
+	Expire     string
+	Reserved   string
+}
+
+// ShadowFile describes an entire /etc/shadow file's contents.
+type ShadowFile struct {
+	Entries []ShadowEntry
+}
+
+// ReadOrCreateShadowFile parses an /etc/shadow file into a ShadowFile.
+// An empty file, only readable by its owner, is created if /etc/shadow is
+// missing.
+func ReadOrCreateShadowFile(fsys apkfs.FullFS, filePath string) (ShadowFile, error) {
+	sf := ShadowFile{}
+
+	file, err := fsys.OpenFile(filePath, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return sf, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if err := sf.Load(file); err != nil {
+		return sf, err
+	}
+
+	return sf, nil
+}
+
+// Load loads an /etc/shadow file into a ShadowFile from an io.Reader.
+func (sf *ShadowFile) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		se := ShadowEntry{}
+
+		if err := se.Parse(scanner.Text()); err != nil {
+			return fmt.Errorf("unable to parse: %w", err)
+		}
+
+		sf.Entries = append(sf.Entries, se)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to parse: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes an /etc/shadow file from a ShadowFile, which is only
+// readable by its owner if it is created.
+func (sf *ShadowFile) WriteFile(fsys apkfs.FullFS, filePath string) error {
+	file, err := fsys.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open %s for writing: %w", filePath, err)
+	}
+	defer file.Close()
+
+	return sf.Write(file)
+}
+
+// Write writes an /etc/shadow file into an io.Writer.
+func (sf *ShadowFile) Write(w io.Writer) error {
+	for _, se := range sf.Entries {
+		if err := se.Write(w); err != nil {
+			return fmt.Errorf("unable to write shadow entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Parse parses an /etc/shadow line into a ShadowEntry.
+func (se *ShadowEntry) Parse(line string) error {
+	line = strings.TrimSpace(line)
+
+	parts := strings.Split(line, ":")
+	if len(parts) != 9 {
+		return fmt.Errorf("malformed line, contains %d parts, expecting 9", len(parts))
+	}
+
+	se.UserName = parts[0]
+	se.Password = parts[1]
+	se.LastChange = parts[2]
+	se.MinAge = parts[3]
+	se.MaxAge = parts[4]
+	se.Warn = parts[5]
+	se.Inactive = parts[6]
+	se.Expire = parts[7]
+	se.Reserved = parts[8]
+
+	return nil
+}
+
+// Write writes an /etc/shadow line into an io.Writer.
+func (se *ShadowEntry) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s:%s:%s:%s:%s:%s:%s:%s:%s\n", se.UserName, se.Password, se.LastChange, se.MinAge, se.MaxAge, se.Warn, se.Inactive, se.Expire, se.Reserved)
+	return err
+}
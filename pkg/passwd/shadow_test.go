@@ -0,0 +1,65 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passwd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestShadowParser(t *testing.T) {
+	fsys := apkfs.DirFS(t.Context(), "testdata")
+	sf, err := ReadOrCreateShadowFile(fsys, "shadow")
+	require.NoError(t, err)
+	require.Len(t, sf.Entries, 4)
+
+	assert.Equal(t, "root", sf.Entries[0].UserName)
+	assert.Equal(t, "*", sf.Entries[0].Password)
+	assert.Equal(t, "", sf.Entries[0].LastChange)
+	assert.Equal(t, "0", sf.Entries[0].MinAge)
+	assert.Equal(t, "nobody", sf.Entries[3].UserName)
+	assert.Equal(t, "!", sf.Entries[3].Password)
+}
+
+func TestShadowWriter(t *testing.T) {
+	fsys := apkfs.DirFS(t.Context(), "testdata")
+	sf, err := ReadOrCreateShadowFile(fsys, "shadow")
+	require.NoError(t, err)
+
+	w := &bytes.Buffer{}
+	require.NoError(t, sf.Write(w))
+
+	want, err := os.ReadFile("testdata/shadow")
+	require.NoError(t, err)
+	require.Equal(t, string(want), w.String())
+}
+
+func TestShadowCreated(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	sf, err := ReadOrCreateShadowFile(fsys, "etc/shadow")
+	require.NoError(t, err)
+	require.Empty(t, sf.Entries)
+
+	fi, err := fsys.Stat("etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy evaluates user-provided policies, written in Rego or CUE,
+// against what a build produced, so that builds can be gated on package and
+// repository allowlists and the like.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// RegoQuery is what Rego policies are queried for: the set, or array, of
+// violations of the input, each a message or an object with a msg field.
+const RegoQuery = "data.apko.deny"
+
+// Input is what policies are evaluated against.
+type Input struct {
+	// Config is the configuration of the build, with what it includes.
+	Config types.ImageConfiguration `json:"config"`
+	// Packages are the packages installed in the image of each
+	// architecture, by architecture as apk names it.
+	Packages map[string][]Package `json:"packages"`
+	// SBOMs are the SPDX SBOMs of the image of each architecture, by
+	// architecture, if they were generated.
+	SBOMs map[string]json.RawMessage `json:"sboms"`
+}
+
+// Package is an installed package.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Origin  string `json:"origin"`
+	License string `json:"license"`
+	// URL is where the package was installed from.
+	URL string `json:"url"`
+	// Repository is the repository the package was installed from, as
+	// configurations list it, without the architecture.
+	Repository string `json:"repository"`
+}
+
+// Violation is a violation of a policy.
+type Violation struct {
+	Policy  string `json:"policy"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Policy + ": " + v.Message
+}
+
+// engine evaluates a kind of policy.
+type engine struct {
+	// bin is the command the engine runs, which must be in PATH.
+	bin  string
+	eval func(ctx context.Context, bin, policy string, input []byte) ([]string, error)
+}
+
+var engines = map[string]engine{
+	".rego": {bin: "opa", eval: evalRego},
+	".cue":  {bin: "cue", eval: evalCUE},
+}
+
+// Check returns an error if policy cannot be evaluated: it is not a Rego
+// (.rego) or CUE (.cue) file, it does not exist or the command of its
+// engine is not in PATH.
+func Check(policy string) error {
+	e, ok := engines[filepath.Ext(policy)]
+	if !ok {
+		return fmt.Errorf("policy %s is neither Rego (.rego) nor CUE (.cue)", policy)
+	}
+	if _, err := os.Stat(policy); err != nil {
+		return fmt.Errorf("reading policy: %w", err)
+	}
+	if _, err := exec.LookPath(e.bin); err != nil {
+		return fmt.Errorf("evaluating %s policies: %w", filepath.Ext(policy), err)
+	}
+	return nil
+}
+
+// Evaluate evaluates policies against input, by the extension of their
+// paths: Rego policies are queried with opa for RegoQuery, and input is
+// vetted against CUE policies with cue, each error being a violation.
+func Evaluate(ctx context.Context, policies []string, input Input) ([]Violation, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("encoding policy input: %w", err)
+	}
+	var violations []Violation
+	for _, policy := range policies {
+		if err := Check(policy); err != nil {
+			return nil, err
+		}
+		e := engines[filepath.Ext(policy)]
+		bin, err := exec.LookPath(e.bin)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := e.eval(ctx, bin, policy, data)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating policy %s: %w", policy, err)
+		}
+		slices.Sort(msgs)
+		for _, msg := range msgs {
+			violations = append(violations, Violation{Policy: policy, Message: msg})
+		}
+	}
+	return violations, nil
+}
+
+func evalRego(ctx context.Context, bin, policy string, input []byte) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, "eval", "--format", "json", "--stdin-input", "--data", policy, RegoQuery)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running opa: %w: %s", err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+
+	var out struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("parsing output of opa: %w", err)
+	}
+	// A policy without violations has an empty deny. One that does not
+	// define it, such as one in another package, would never fail.
+	if len(out.Result) == 0 {
+		return nil, fmt.Errorf("%s does not define %s", policy, RegoQuery)
+	}
+	var msgs []string
+	for _, r := range out.Result {
+		for _, e := range r.Expressions {
+			var values []json.RawMessage
+			if err := json.Unmarshal(e.Value, &values); err != nil {
+				return nil, fmt.Errorf("%s is not a set or an array: %w", RegoQuery, err)
+			}
+			for _, v := range values {
+				msgs = append(msgs, regoMessage(v))
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// regoMessage returns the message of a violation: itself, if it is a
+// string, its msg field, if it has one, or else its JSON.
+func regoMessage(v json.RawMessage) string {
+	var msg string
+	if err := json.Unmarshal(v, &msg); err == nil {
+		return msg
+	}
+	var obj struct {
+		Msg *string `json:"msg"`
+	}
+	if err := json.Unmarshal(v, &obj); err == nil && obj.Msg != nil {
+		return *obj.Msg
+	}
+	return string(v)
+}
+
+func evalCUE(ctx context.Context, bin, policy string, input []byte) ([]string, error) {
+	dir, err := os.MkdirTemp("", "apko-policy-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	inputPath := filepath.Join(dir, "input.json")
+	if err := os.WriteFile(inputPath, input, 0o600); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, "vet", "--concrete", policy, inputPath)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil, nil
+	case !errors.As(err, &exitErr):
+		return nil, fmt.Errorf("running cue: %w", err)
+	}
+	// Every error cue reports starts a line, with its positions on the
+	// indented lines that follow it.
+	var msgs []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		msgs = append(msgs, line)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("running cue: %w", err)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommand puts a command named name running script in PATH.
+func fakeCommand(t *testing.T, name, script string) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func writePolicy(t *testing.T, name string) string {
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte("package apko\n"), 0o644))
+	return p
+}
+
+func TestCheck(t *testing.T) {
+	fakeCommand(t, "opa", "exit 0\n")
+	require.NoError(t, Check(writePolicy(t, "policy.rego")))
+	require.ErrorContains(t, Check(writePolicy(t, "policy.json")), "is neither Rego (.rego) nor CUE (.cue)")
+	require.ErrorContains(t, Check(filepath.Join(t.TempDir(), "missing.rego")), "reading policy")
+}
+
+func TestEvaluateRego(t *testing.T) {
+	ctx := context.Background()
+	out := filepath.Join(t.TempDir(), "input.json")
+	fakeCommand(t, "opa", `cat > `+out+`
+echo '{"result": [{"expressions": [{"value": ["package foo is not allowed", {"msg": "repository bar is not allowed"}, {"code": 1}]}]}]}'
+`)
+	policy := writePolicy(t, "policy.rego")
+
+	violations, err := Evaluate(ctx, []string{policy}, Input{
+		Packages: map[string][]Package{"x86_64": {{Name: "foo", Version: "1.0-r0"}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Violation{
+		{Policy: policy, Message: "package foo is not allowed"},
+		{Policy: policy, Message: "repository bar is not allowed"},
+		{Policy: policy, Message: `{"code": 1}`},
+	}, violations)
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var input Input
+	require.NoError(t, json.Unmarshal(b, &input))
+	require.Equal(t, "foo", input.Packages["x86_64"][0].Name)
+
+	fakeCommand(t, "opa", `echo '{"result": [{"expressions": [{"value": []}]}]}'`)
+	violations, err = Evaluate(ctx, []string{policy}, Input{})
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	// An undefined deny has no result, and is not a policy that passes.
+	fakeCommand(t, "opa", `echo '{}'`)
+	_, err = Evaluate(ctx, []string{policy}, Input{})
+	require.ErrorContains(t, err, "does not define data.apko.deny")
+
+	fakeCommand(t, "opa", "echo 'rego_parse_error: unexpected eof' >&2\nexit 1\n")
+	_, err = Evaluate(ctx, []string{policy}, Input{})
+	require.ErrorContains(t, err, "rego_parse_error: unexpected eof")
+}
+
+func TestEvaluateCUE(t *testing.T) {
+	ctx := context.Background()
+	policy := writePolicy(t, "policy.cue")
+
+	fakeCommand(t, "cue", "exit 0\n")
+	violations, err := Evaluate(ctx, []string{policy}, Input{})
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	fakeCommand(t, "cue", `cat >&2 <<EOF
+packages.x86_64.0.repository: invalid value "https://example.com" (out of bound =~"^https://packages.wolfi.dev/"):
+    ./policy.cue:3:15
+    ./input.json:1:2
+EOF
+exit 1
+`)
+	violations, err = Evaluate(ctx, []string{policy}, Input{})
+	require.NoError(t, err)
+	require.Equal(t, []Violation{{
+		Policy:  policy,
+		Message: `packages.x86_64.0.repository: invalid value "https://example.com" (out of bound =~"^https://packages.wolfi.dev/"):`,
+	}}, violations)
+}
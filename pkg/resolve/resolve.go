@@ -0,0 +1,142 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resolve answers "what would apko install" for an image
+// configuration, without building anything.
+//
+// It fetches the repository indexes for each requested architecture, solves
+// the package constraints the same way a build would, and returns the
+// resulting package graph:
+//
+//	graphs, err := resolve.Resolve(ctx, build.WithConfig("apko.yaml", nil))
+//	for arch, g := range graphs {
+//		for _, pkg := range g.Packages {
+//			fmt.Println(arch, pkg.Name, pkg.Version, pkg.Checksum)
+//		}
+//	}
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Package is a single resolved package.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"architecture"`
+	Origin  string `json:"origin,omitempty"`
+	// URL is where the .apk would be fetched from.
+	URL string `json:"url"`
+	// Checksum is the control section checksum, as found in APKINDEX.
+	Checksum string `json:"checksum"`
+	Size     uint64 `json:"size"`
+	// Dependencies are the names of the packages in the same Graph
+	// that this package depends on.
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// Graph is the set of packages resolved for a single architecture, in the
+// order they would be installed.
+type Graph struct {
+	Arch     types.Architecture `json:"arch"`
+	Packages []Package          `json:"packages"`
+}
+
+// Resolve resolves the packages for each architecture in the configuration
+// supplied by opts. Architectures default to those in the configuration, or
+// to all architectures if it lists none.
+func Resolve(ctx context.Context, opts ...build.Option) (map[types.Architecture]*Graph, error) {
+	ctx, span := otel.Tracer("apko").Start(ctx, "Resolve")
+	defer span.End()
+
+	_, ic, err := build.NewOptions(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	archs := ic.Archs
+	if len(archs) == 0 {
+		archs = types.AllArchs
+	}
+
+	mc, err := build.NewMultiArch(ctx, archs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := mc.BuildPackageLists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("resolving packages: %w", err)
+	}
+
+	graphs := make(map[types.Architecture]*Graph, len(lists))
+	for arch, pkgs := range lists {
+		graphs[arch] = newGraph(arch, pkgs)
+	}
+	return graphs, nil
+}
+
+func newGraph(arch types.Architecture, pkgs []*apk.RepositoryPackage) *Graph {
+	// Index everything each resolved package provides, so we can map
+	// dependency constraints back onto the packages that satisfy them.
+	providers := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		providers[pkg.Name] = pkg.Name
+		for _, prov := range pkg.Provides {
+			providers[apk.ResolvePackageNameVersionPin(prov).Name] = pkg.Name
+		}
+	}
+
+	g := &Graph{
+		Arch:     arch,
+		Packages: make([]Package, 0, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		deps := []string{}
+		for _, dep := range pkg.Dependencies {
+			if dep == "" || dep[0] == '!' {
+				// Conflicts are not edges in the graph.
+				continue
+			}
+			name, ok := providers[apk.ResolvePackageNameVersionPin(dep).Name]
+			if !ok || name == pkg.Name || slices.Contains(deps, name) {
+				continue
+			}
+			deps = append(deps, name)
+		}
+		sort.Strings(deps)
+
+		g.Packages = append(g.Packages, Package{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Arch:         pkg.Arch,
+			Origin:       pkg.Origin,
+			URL:          pkg.URL(),
+			Checksum:     pkg.ChecksumString(),
+			Size:         pkg.Size,
+			Dependencies: deps,
+		})
+	}
+	return g
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/resolve"
+)
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+
+	tmp := t.TempDir()
+	graphs, err := resolve.Resolve(ctx,
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTempDir(tmp),
+	)
+	require.NoError(t, err)
+	require.Len(t, graphs, 2)
+	// The temporary directory of the caller is theirs to remove.
+	require.DirExists(t, tmp)
+
+	for _, arch := range []types.Architecture{types.ParseArchitecture("x86_64"), types.ParseArchitecture("aarch64")} {
+		g, ok := graphs[arch]
+		require.True(t, ok, "missing %s", arch)
+		require.Equal(t, arch, g.Arch)
+
+		names := map[string]resolve.Package{}
+		for _, pkg := range g.Packages {
+			require.NotEmpty(t, pkg.Checksum)
+			require.NotEmpty(t, pkg.URL)
+			names[pkg.Name] = pkg
+		}
+		require.Contains(t, names, "replayout")
+		require.Contains(t, names, "pretend-baselayout")
+		require.Contains(t, names["replayout"].Dependencies, "pretend-baselayout")
+	}
+}
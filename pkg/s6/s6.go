@@ -18,6 +18,21 @@ import (
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
+// Service is a service supervised by s6.
+type Service struct {
+	// Command is the execline command line of the service.
+	Command string
+	// Dependencies are the services that must be up before it starts.
+	Dependencies []string
+	// Environment holds the variables set for the service.
+	Environment map[string]string
+	// WorkDir is the directory the service runs in.
+	WorkDir string
+	// User is the user the service runs as, an account name or uid:gid.
+	User string
+}
+
+// Services are the commands of the services to supervise, by name.
 type Services map[string]string
 
 type Context struct {
@@ -17,26 +17,81 @@ package s6
 import (
 	"context"
 	"fmt"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/chainguard-dev/clog"
 )
 
 func (sc *Context) WriteSupervisionTree(ctx context.Context, services Services) error {
+	svcs := make(map[string]Service, len(services))
+	for service, svccmd := range services {
+		svcs[service] = Service{Command: svccmd}
+	}
+	return sc.WriteServices(ctx, svcs)
+}
+
+// WriteServices is WriteSupervisionTree for services that have more than a
+// command.
+func (sc *Context) WriteServices(ctx context.Context, services map[string]Service) error {
 	log := clog.FromContext(ctx)
 	log.Debug("generating supervision tree")
 
 	// generate the leaves
-	for service, svccmd := range services {
+	for service, svc := range services {
 		svcdir := filepath.Join("sv", service)
 		if err := sc.fs.MkdirAll(svcdir, 0777); err != nil {
 			return fmt.Errorf("could not make supervision directory: %w", err)
 		}
 
-		if err := sc.fs.WriteFile(filepath.Join(svcdir, "run"), fmt.Appendf(nil, "#!/bin/execlineb\n%s\n", svccmd), 0755); err != nil {
+		if err := sc.fs.WriteFile(filepath.Join(svcdir, "run"), runScript(svc), 0755); err != nil {
 			return fmt.Errorf("could not write runfile: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// dependencyTimeout is how long a service waits for its dependencies to be
+// up before it fails, to be run again.
+const dependencyTimeout = 30 * time.Second
+
+// runScript returns the execline script that runs svc: once its
+// dependencies are up, with its environment, in its working directory and
+// as its user.
+func runScript(svc Service) []byte {
+	var b strings.Builder
+	b.WriteString("#!/bin/execlineb\n")
+	if len(svc.Dependencies) != 0 {
+		// Waiting fails if they are not up in time, and s6-supervise then
+		// runs the script again, rather than it waiting forever.
+		deps := make([]string, 0, len(svc.Dependencies))
+		for _, dep := range svc.Dependencies {
+			deps = append(deps, quote(filepath.Join("/sv", dep)))
+		}
+		fmt.Fprintf(&b, "if { s6-svwait -u -t %d %s }\n", dependencyTimeout.Milliseconds(), strings.Join(deps, " "))
+	}
+	for _, k := range slices.Sorted(maps.Keys(svc.Environment)) {
+		fmt.Fprintf(&b, "export %s %s\n", k, quote(svc.Environment[k]))
+	}
+	if svc.WorkDir != "" {
+		fmt.Fprintf(&b, "cd %s\n", quote(svc.WorkDir))
+	}
+	if svc.User != "" {
+		fmt.Fprintf(&b, "s6-setuidgid %s\n", quote(svc.User))
+	}
+	fmt.Fprintf(&b, "%s\n", svc.Command)
+	return []byte(b.String())
+}
+
+// quote returns s as a single execline word.
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r\"\\#{}") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s6
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestWriteSupervisionTree(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, New(fsys).WriteServices(context.Background(), map[string]Service{
+		"db": {Command: "/usr/bin/db"},
+		"app": {
+			Command:      "/usr/bin/app --port 8080",
+			Dependencies: []string{"db"},
+			Environment:  map[string]string{"GREETING": `say "hi"`, "APP_ENV": "production"},
+			WorkDir:      "/srv/my app",
+			User:         "app",
+		},
+	}))
+
+	for path, want := range map[string]string{
+		"sv/db/run": "#!/bin/execlineb\n/usr/bin/db\n",
+		"sv/app/run": `#!/bin/execlineb
+if { s6-svwait -u -t 30000 /sv/db }
+export APP_ENV production
+export GREETING "say \"hi\""
+cd "/srv/my app"
+s6-setuidgid app
+/usr/bin/app --port 8080
+`,
+	} {
+		b, err := fsys.ReadFile(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want, string(b), path)
+	}
+}
+
+func TestWriteSupervisionTreeCommands(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, New(fsys).WriteSupervisionTree(context.Background(), Services{"web": "/usr/bin/web"}))
+	b, err := fsys.ReadFile("sv/web/run")
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/execlineb\n/usr/bin/web\n", string(b))
+}
@@ -16,6 +16,9 @@ package generator
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
 	"chainguard.dev/apko/pkg/sbom/options"
@@ -29,6 +32,56 @@ type Generator interface {
 	GenerateIndex(*options.Options, string) error
 }
 
+// TypedGenerator is a Generator whose SBOMs have a media type of their own to
+// be attached to images with, and an in-toto predicate type to be attested
+// with.
+type TypedGenerator interface {
+	Generator
+	MediaType() string
+	PredicateType() string
+}
+
+// VersionedGenerator is a Generator that can emit several versions of its
+// format.
+type VersionedGenerator interface {
+	Generator
+	// Versions lists the versions of the format that can be emitted, the
+	// default first.
+	Versions() []string
+	// WithVersion returns a generator emitting version of the format.
+	WithVersion(version string) (Generator, error)
+}
+
+// WithVersions returns generators with each whose key is in versions set to
+// emit that version of its format.
+func WithVersions(generators []Generator, versions map[string]string) ([]Generator, error) {
+	out := make([]Generator, 0, len(generators))
+	seen := map[string]bool{}
+	for _, g := range generators {
+		version, ok := versions[g.Key()]
+		if !ok {
+			out = append(out, g)
+			continue
+		}
+		seen[g.Key()] = true
+		vg, ok := g.(VersionedGenerator)
+		if !ok {
+			return nil, fmt.Errorf("%s SBOMs have a single version", g.Key())
+		}
+		g, err := vg.WithVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	for _, key := range slices.Sorted(maps.Keys(versions)) {
+		if !seen[key] {
+			return nil, fmt.Errorf("no %s SBOMs are generated to set the version of", key)
+		}
+	}
+	return out, nil
+}
+
 // GeneratorFactory is a function that creates a Generator.
 type GeneratorFactory func() Generator
 
@@ -46,7 +99,18 @@ func RegisterGenerator(key string, factory GeneratorFactory) {
 	registry[key] = factory
 }
 
-// Generators returns a map of registered generators.
+// Lookup returns a new generator of the kind registered under key.
+func Lookup(key string) (Generator, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[key]
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// Generators returns the registered generators, ordered by key.
 // If names are provided, only generators with those keys will be returned.
 func Generators(names ...string) []Generator {
 	generators := []Generator{}
@@ -61,9 +125,9 @@ func Generators(names ...string) []Generator {
 	registryMu.RLock()
 	defer registryMu.RUnlock()
 
-	for key, factory := range registry {
+	for _, key := range slices.Sorted(maps.Keys(registry)) {
 		if all || nameIdx[key] {
-			generators = append(generators, factory())
+			generators = append(generators, registry[key]())
 		}
 	}
 
@@ -0,0 +1,280 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/github/go-spdx/v2/spdxexp/spdxlicenses"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+const licenseRefPrefix = "LicenseRef-"
+
+// licenseAliases maps license names commonly found in APK packages, in
+// upper case, to the SPDX identifier they stand for.
+var licenseAliases = map[string]string{
+	"AGPL3":         "AGPL-3.0-only",
+	"AGPL3+":        "AGPL-3.0-or-later",
+	"APACHE":        "Apache-2.0",
+	"APACHE2":       "Apache-2.0",
+	"APACHE-2":      "Apache-2.0",
+	"APACHE2.0":     "Apache-2.0",
+	"ASL2.0":        "Apache-2.0",
+	"ASL-2.0":       "Apache-2.0",
+	"BSD-2":         "BSD-2-Clause",
+	"BSD-3":         "BSD-3-Clause",
+	"BSD2":          "BSD-2-Clause",
+	"BSD3":          "BSD-3-Clause",
+	"GPL2":          "GPL-2.0-only",
+	"GPL2+":         "GPL-2.0-or-later",
+	"GPL-2":         "GPL-2.0-only",
+	"GPL-2+":        "GPL-2.0-or-later",
+	"GPL3":          "GPL-3.0-only",
+	"GPL3+":         "GPL-3.0-or-later",
+	"GPL-3":         "GPL-3.0-only",
+	"GPL-3+":        "GPL-3.0-or-later",
+	"LGPL2":         "LGPL-2.0-only",
+	"LGPL2+":        "LGPL-2.0-or-later",
+	"LGPL2.1":       "LGPL-2.1-only",
+	"LGPL2.1+":      "LGPL-2.1-or-later",
+	"LGPL-2.1":      "LGPL-2.1-only",
+	"LGPL-2.1+":     "LGPL-2.1-or-later",
+	"LGPL3":         "LGPL-3.0-only",
+	"LGPL3+":        "LGPL-3.0-or-later",
+	"MPL2":          "MPL-2.0",
+	"MPL-2":         "MPL-2.0",
+	"PSF":           "PSF-2.0",
+	"PUBLICDOMAIN":  "LicenseRef-Public-Domain",
+	"PUBLIC-DOMAIN": "LicenseRef-Public-Domain",
+	"ZLIB/LIBPNG":   "Zlib",
+}
+
+var invalidLicenseRefChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// normalizeLicense rewrites an APK license string as a valid SPDX license
+// expression. Operators are upper cased, identifiers take the case of the
+// SPDX license list, deprecated and common non-SPDX names are replaced by
+// the identifier they stand for, and any other license becomes a
+// LicenseRef. It returns the expression and the licenses it could not find
+// in the SPDX license list, keyed by the LicenseRef now standing for them.
+func normalizeLicense(license string) (string, map[string]string) {
+	switch strings.TrimSpace(license) {
+	case "", "NOASSERTION", "NONE":
+		return license, nil
+	}
+
+	unknown := map[string]string{}
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(license))
+	for i, tok := range tokens {
+		switch up := strings.ToUpper(tok); {
+		case tok == "(" || tok == ")":
+		case up == "AND" || up == "OR" || up == "WITH":
+			tokens[i] = up
+		case i > 0 && tokens[i-1] == "WITH":
+			if ok, id := spdxlicenses.IsException(tok); ok {
+				tokens[i] = id
+			}
+		default:
+			id, ok := licenseID(tok)
+			if !ok {
+				unknown[id] = tok
+			}
+			tokens[i] = id
+		}
+	}
+
+	if !wellFormed(tokens) {
+		// Not an expression at all, so refer to the whole string.
+		ref := licenseRef(license)
+		return ref, map[string]string{ref: license}
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(strings.Join(tokens, " "), "( ", "("), " )", ")"), unknown
+}
+
+// wellFormed reports whether tokens alternate between licenses and
+// operators, with balanced parentheses.
+func wellFormed(tokens []string) bool {
+	depth, operand := 0, true
+	for _, tok := range tokens {
+		switch {
+		case operand && tok == "(":
+			depth++
+		case operand && tok != ")" && tok != "AND" && tok != "OR" && tok != "WITH":
+			operand = false
+		case !operand && tok == ")":
+			if depth--; depth < 0 {
+				return false
+			}
+		case !operand && (tok == "AND" || tok == "OR" || tok == "WITH"):
+			operand = true
+		default:
+			return false
+		}
+	}
+	return !operand && depth == 0
+}
+
+// licenseID returns the SPDX identifier for a single license name, or a
+// LicenseRef and false if there is none.
+func licenseID(name string) (string, bool) {
+	if strings.HasPrefix(name, licenseRefPrefix) {
+		// Needs licensing info like any other license we made up.
+		return name, false
+	}
+	if strings.HasPrefix(name, "DocumentRef-") {
+		return name, true
+	}
+	if id, ok := licenseAliases[strings.ToUpper(name)]; ok {
+		return id, !strings.HasPrefix(id, licenseRefPrefix)
+	}
+	if ok, id := spdxlicenses.IsActiveLicense(name); ok {
+		return id, true
+	}
+	if ok, id := spdxlicenses.IsDeprecatedLicense(name); ok {
+		// GPL-2.0 and GPL-2.0+ were replaced by GPL-2.0-only and
+		// GPL-2.0-or-later, and likewise for the other GNU licenses.
+		if base, plus := strings.CutSuffix(id, "+"); plus {
+			if ok, id := spdxlicenses.IsActiveLicense(base + "-or-later"); ok {
+				return id, true
+			}
+		} else if ok, id := spdxlicenses.IsActiveLicense(id + "-only"); ok {
+			return id, true
+		}
+		return id, true
+	}
+	if base, plus := strings.CutSuffix(name, "+"); plus {
+		if ok, id := spdxlicenses.IsActiveLicense(base); ok {
+			return id + "+", true
+		}
+	}
+	return licenseRef(name), false
+}
+
+// licenseRef returns the LicenseRef standing for a license that is not in
+// the SPDX license list.
+func licenseRef(name string) string {
+	return licenseRefPrefix + strings.Trim(invalidLicenseRefChars.ReplaceAllString(name, "-"), "-")
+}
+
+// normalizeLicenses normalizes the licenses of the packages in doc, adding
+// the extracted licensing info SPDX requires for each LicenseRef made up for
+// an unknown license. The text of the license is the one shipped by the
+// package if opts.IncludeLicenseTexts is set and the package ships any, or
+// the original license name otherwise.
+func normalizeLicenses(ctx context.Context, doc *Document, opts *options.Options) error {
+	log := clog.FromContext(ctx)
+
+	known := map[string]struct{}{}
+	for _, info := range doc.LicensingInfos {
+		known[info.LicenseID] = struct{}{}
+	}
+	installed := map[string]*apk.InstalledPackage{}
+	for _, pkg := range opts.Packages {
+		installed[pkg.Name+"-"+pkg.Version] = pkg
+	}
+
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		unknown := map[string]string{}
+		for _, license := range []*string{&p.LicenseDeclared, &p.LicenseConcluded} {
+			expr, refs := normalizeLicense(*license)
+			*license = expr
+			for ref, name := range refs {
+				unknown[ref] = name
+			}
+		}
+
+		refs := make([]string, 0, len(unknown))
+		for ref := range unknown {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			if _, ok := known[ref]; ok {
+				continue
+			}
+			known[ref] = struct{}{}
+			log.Warnf("package %s-%s has license %q which is not in the SPDX license list, referring to it as %s", p.Name, p.Version, unknown[ref], ref)
+
+			text := unknown[ref]
+			if pkg, ok := installed[p.Name+"-"+p.Version]; ok && opts.IncludeLicenseTexts {
+				shipped, err := licenseTexts(opts, pkg)
+				if err != nil {
+					return fmt.Errorf("reading license of %s: %w", p.Name, err)
+				}
+				if shipped != "" {
+					text = shipped
+				}
+			}
+			doc.LicensingInfos = append(doc.LicensingInfos, LicensingInfo{
+				LicenseID:     ref,
+				ExtractedText: text,
+			})
+		}
+	}
+	return nil
+}
+
+// licenseTexts returns the contents of the license files installed by pkg,
+// in usr/share/licenses or named like LICENSE or COPYING, in the order the
+// package lists them.
+func licenseTexts(opts *options.Options, pkg *apk.InstalledPackage) (string, error) {
+	var texts []string
+	for _, hdr := range pkg.Files {
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA { //nolint:staticcheck // apk databases use both
+			continue
+		}
+		if !isLicenseFile(hdr.Name) {
+			continue
+		}
+		f, err := opts.FS.Open(hdr.Name)
+		if err != nil {
+			// Removed from the image after it was installed.
+			continue
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		texts = append(texts, string(data))
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func isLicenseFile(name string) bool {
+	if strings.HasPrefix(name, "usr/share/licenses/") {
+		return true
+	}
+	base := strings.ToUpper(path.Base(name))
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING"} {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -15,10 +15,16 @@
 package spdx
 
 import (
+	"archive/tar"
 	"context"
+	"crypto/sha1" //nolint:gosec // SPDX mandates SHA1
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"regexp"
 	"strings"
@@ -52,16 +58,68 @@ const (
 	apkSBOMdir           = "/var/lib/db/sbom"
 )
 
-type SPDX struct{}
+// namespacePrefix is what the namespaces of the documents generated start
+// with.
+const namespacePrefix = "https://spdx.org/spdxdocs/apko/"
+
+// documentNamespace returns the namespace of the document of the image or
+// index with digest, which is unique to it, or of the document named name if
+// digest is not known.
+func documentNamespace(name, digest string) string {
+	if digest == "" {
+		return namespacePrefix + name
+	}
+	return namespacePrefix + "sbom-" + digest
+}
+
+const (
+	// Version22 is version 2.2 of the SPDX specification.
+	Version22 = "2.2"
+	// Version23 is version 2.3 of the SPDX specification, the default.
+	Version23 = "2.3"
+)
+
+// serializers adapt a document, which is built to the default version of
+// the specification, to each version that can be emitted.
+var serializers = map[string]func(*Document){
+	Version23: func(*Document) {},
+	Version22: toSPDX22,
+}
+
+type SPDX struct {
+	version string
+}
 
 func New() *SPDX {
-	return &SPDX{}
+	return &SPDX{version: Version23}
+}
+
+// Versions lists the versions of SPDX that can be emitted, the default first.
+func (sx *SPDX) Versions() []string {
+	return []string{Version23, Version22}
+}
+
+// WithVersion returns a generator emitting documents of version of the SPDX
+// specification.
+func (sx *SPDX) WithVersion(version string) (generator.Generator, error) {
+	if _, ok := serializers[version]; !ok {
+		return nil, fmt.Errorf("unsupported SPDX version %q, expected one of %v", version, sx.Versions())
+	}
+	return &SPDX{version: version}, nil
 }
 
 func (sx *SPDX) Key() string {
 	return "spdx"
 }
 
+func (sx *SPDX) MediaType() string {
+	return "application/spdx+json"
+}
+
+func (sx *SPDX) PredicateType() string {
+	return "https://spdx.dev/Document"
+}
+
 func (sx *SPDX) Ext() string {
 	return "spdx.json"
 }
@@ -91,8 +149,10 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 	// The default document name makes no attempt to avoid
 	// clashes. Ensuring a unique name requires a digest
 	documentName := "sbom"
-	if hash := hashToString(opts.ImageInfo.Layers[0].Digest); hash != "" {
-		documentName += "-" + hash
+	if len(opts.ImageInfo.Layers) > 0 {
+		if hash := hashToString(opts.ImageInfo.Layers[0].Digest); hash != "" {
+			documentName += "-" + hash
+		}
 	}
 	doc := &Document{
 		ID:      "SPDXRef-DOCUMENT",
@@ -107,7 +167,7 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 			LicenseListVersion: "3.16",
 		},
 		DataLicense:    "CC0-1.0",
-		Namespace:      "https://spdx.org/spdxdocs/apko/",
+		Namespace:      documentNamespace(documentName, opts.ImageInfo.ImageDigest),
 		Packages:       []Package{},
 		Relationships:  []Relationship{},
 		LicensingInfos: []LicensingInfo{},
@@ -156,6 +216,19 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 		}
 	}
 
+	addVerifications(doc, opts)
+	addStripped(doc, opts)
+
+	if opts.IncludeFiles {
+		if err := addFiles(doc, opts); err != nil {
+			return fmt.Errorf("adding files: %w", err)
+		}
+	}
+
+	if err := normalizeLicenses(ctx, doc, opts); err != nil {
+		return fmt.Errorf("normalizing licenses: %w", err)
+	}
+
 	dedupedPackages := make([]Package, 0, len(doc.Packages))
 	seenIDs := make(map[string]struct{})
 	for i := range doc.Packages {
@@ -168,7 +241,7 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 	}
 	doc.Packages = dedupedPackages
 
-	if err := renderDoc(doc, path); err != nil {
+	if err := sx.renderDoc(doc, path); err != nil {
 		return fmt.Errorf("rendering document: %w", err)
 	}
 
@@ -382,8 +455,15 @@ func (sx *SPDX) ParseInternalSBOM(opts *options.Options, path string) (*Document
 	return internalSBOM, nil
 }
 
-// renderDoc marshals a document to json and writes it to disk
-func renderDoc(doc *Document, path string) error {
+// renderDoc marshals a document to json, in the version of the
+// specification of sx, and writes it to disk
+func (sx *SPDX) renderDoc(doc *Document, path string) error {
+	version := sx.version
+	if version == "" {
+		version = Version23
+	}
+	serializers[version](doc)
+
 	out, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("opening SBOM path %s for writing: %w", path, err)
@@ -475,9 +555,11 @@ type Document struct {
 	Namespace            string                `json:"documentNamespace"`
 	DocumentDescribes    []string              `json:"documentDescribes"`
 	Packages             []Package             `json:"packages"`
+	Files                []File                `json:"files,omitempty"`
 	Relationships        []Relationship        `json:"relationships"`
 	ExternalDocumentRefs []ExternalDocumentRef `json:"externalDocumentRefs,omitempty"`
 	LicensingInfos       []LicensingInfo       `json:"hasExtractedLicensingInfos,omitempty"`
+	Annotations          []Annotation          `json:"annotations,omitempty"`
 }
 
 type ExternalDocumentRef struct {
@@ -505,6 +587,7 @@ type File struct {
 	NoticeText        string     `json:"noticeText,omitempty"`
 	LicenseConcluded  string     `json:"licenseConcluded,omitempty"`
 	Description       string     `json:"description,omitempty"`
+	Comment           string     `json:"comment,omitempty"`
 	FileTypes         []string   `json:"fileTypes,omitempty"`
 	LicenseInfoInFile []string   `json:"licenseInfoInFiles,omitempty"` // List of licenses
 	Checksums         []Checksum `json:"checksums,omitempty"`
@@ -528,6 +611,14 @@ type Package struct {
 	Checksums        []Checksum               `json:"checksums,omitempty"`
 	ExternalRefs     []ExternalRef            `json:"externalRefs,omitempty"`
 	VerificationCode *PackageVerificationCode `json:"packageVerificationCode,omitempty"`
+	Annotations      []Annotation             `json:"annotations,omitempty"`
+}
+
+type Annotation struct {
+	Date      string `json:"annotationDate"`
+	Type      string `json:"annotationType"`
+	Annotator string `json:"annotator"`
+	Comment   string `json:"comment"`
 }
 
 type PackageVerificationCode struct {
@@ -572,7 +663,7 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 			LicenseListVersion: "3.16",
 		},
 		DataLicense:   "CC0-1.0",
-		Namespace:     "https://spdx.org/spdxdocs/apko/",
+		Namespace:     documentNamespace(documentName, hashToString(opts.ImageInfo.IndexDigest)),
 		Packages:      []Package{},
 		Relationships: []Relationship{},
 	}
@@ -643,19 +734,197 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 			Type:    "VARIANT_OF",
 			Related: imagePackageID,
 		})
+
+		// Point at the SBOM of the image, which has its packages.
+		if info.SBOMDigest != "" {
+			ref := ExternalDocumentRef{
+				ExternalDocumentID: "DocumentRef-" + stringToIdentifier("sbom-"+info.Arch.String()),
+				SPDXDocument:       documentNamespace("", info.Digest.String()),
+				Checksum: Checksum{
+					Algorithm: "SHA256",
+					Value:     info.SBOMDigest,
+				},
+			}
+			doc.ExternalDocumentRefs = append(doc.ExternalDocumentRefs, ref)
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: imagePackageID,
+				Type:    "DESCRIBED_BY",
+				Related: ref.ExternalDocumentID + ":SPDXRef-DOCUMENT",
+			})
+		}
 	}
 
 	if opts.ImageInfo.VCSUrl != "" {
 		addSourcePackage(opts.ImageInfo.VCSUrl, doc, &indexPackage, opts)
 	}
 
-	if err := renderDoc(doc, path); err != nil {
+	if err := sx.renderDoc(doc, path); err != nil {
 		return fmt.Errorf("rendering document: %w", err)
 	}
 
 	return nil
 }
 
+// addFiles adds an entry for each regular file installed by the packages,
+// contained by the package that owns it if the document describes it, or by
+// the image otherwise.
+func addFiles(doc *Document, opts *options.Options) error {
+	owners := map[string]string{}
+	for _, p := range doc.Packages {
+		owners[p.Name+"-"+p.Version] = p.ID
+	}
+	root := ""
+	if len(doc.DocumentDescribes) > 0 {
+		root = doc.DocumentDescribes[0]
+	}
+
+	for _, pkg := range opts.Packages {
+		owner, ok := owners[pkg.Name+"-"+pkg.Version]
+		if !ok {
+			owner = root
+		}
+		for _, hdr := range pkg.Files {
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA { //nolint:staticcheck // apk databases use both
+				continue
+			}
+			checksums, err := fileChecksums(opts.FS, hdr.Name)
+			if errors.Is(err, fs.ErrNotExist) {
+				// Removed from the image after it was installed.
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			file := File{
+				ID:        stringToIdentifier(fmt.Sprintf("SPDXRef-File-%s-%s", pkg.Name, hdr.Name)),
+				Name:      "/" + hdr.Name,
+				Comment:   fmt.Sprintf("installed by package %s-%s", pkg.Name, pkg.Version),
+				Checksums: checksums,
+			}
+			doc.Files = append(doc.Files, file)
+			if owner != "" {
+				doc.Relationships = append(doc.Relationships, Relationship{
+					Element: owner,
+					Type:    "CONTAINS",
+					Related: file.ID,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// addVerifications annotates the packages installed by the build with how
+// their signatures were verified.
+func addVerifications(doc *Document, opts *options.Options) {
+	versions := make(map[string]string, len(opts.Packages))
+	for _, pkg := range opts.Packages {
+		versions[pkg.Name] = pkg.Version
+	}
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		v, ok := opts.PackageVerifications[p.Name]
+		if !ok || versions[p.Name] != p.Version {
+			continue
+		}
+		p.Annotations = append(p.Annotations, Annotation{
+			Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Type:      "OTHER",
+			Annotator: "Tool: apko",
+			Comment:   "apk " + v.String(),
+		})
+	}
+}
+
+// addStripped annotates the packages that installed the files stripped from
+// the image with which they were, and the package the document describes
+// with the others, or the document itself if it describes none of its
+// packages.
+func addStripped(doc *Document, opts *options.Options) {
+	if len(opts.StrippedFiles) == 0 {
+		return
+	}
+	root := ""
+	if len(doc.DocumentDescribes) != 0 {
+		root = doc.DocumentDescribes[0]
+	}
+	ids := map[string]string{}
+	for _, p := range doc.Packages {
+		ids[p.Name+"-"+p.Version] = p.ID
+	}
+	owners := map[string]string{}
+	for _, pkg := range opts.Packages {
+		id, ok := ids[pkg.Name+"-"+pkg.Version]
+		if !ok {
+			continue
+		}
+		for _, hdr := range pkg.Files {
+			owners["/"+strings.TrimPrefix(hdr.Name, "/")] = id
+		}
+	}
+	stripped := map[string][]string{}
+	for _, f := range opts.StrippedFiles {
+		id, ok := owners[f]
+		if !ok {
+			id = root
+		}
+		stripped[id] = append(stripped[id], f)
+	}
+	annotation := func(files []string) Annotation {
+		return Annotation{
+			Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Type:      "OTHER",
+			Annotator: "Tool: apko",
+			Comment:   "stripped " + strings.Join(files, ", "),
+		}
+	}
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		files, ok := stripped[p.ID]
+		if !ok {
+			continue
+		}
+		delete(stripped, p.ID)
+		p.Annotations = append(p.Annotations, annotation(files))
+	}
+	if files, ok := stripped[root]; ok {
+		doc.Annotations = append(doc.Annotations, annotation(files))
+	}
+}
+
+// fileChecksums returns the SHA1 checksum SPDX requires of every file, and
+// its SHA256 checksum.
+func fileChecksums(fsys apkfs.ReaderFS, name string) ([]Checksum, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s1, s256 := sha1.New(), sha256.New() //nolint:gosec // SPDX mandates SHA1
+	if _, err := io.Copy(io.MultiWriter(s1, s256), f); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return []Checksum{
+		{Algorithm: "SHA1", Value: hex.EncodeToString(s1.Sum(nil))},
+		{Algorithm: "SHA256", Value: hex.EncodeToString(s256.Sum(nil))},
+	}, nil
+}
+
+// toSPDX22 adapts doc to version 2.2 of the specification, which has no
+// primary package purpose and spells the external reference categories with
+// underscores.
+func toSPDX22(doc *Document) {
+	doc.Version = "SPDX-2.2"
+	for i := range doc.Packages {
+		doc.Packages[i].PrimaryPurpose = ""
+		for j := range doc.Packages[i].ExternalRefs {
+			ref := &doc.Packages[i].ExternalRefs[j]
+			ref.Category = strings.ReplaceAll(ref.Category, "-", "_")
+		}
+	}
+}
+
 // addOperatingSystem adds a package describing the operating system
 func addOperatingSystem(doc *Document, opts *options.Options) {
 	osPackage := Package{
@@ -15,13 +15,16 @@
 package spdx
 
 import (
+	"archive/tar"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -30,6 +33,8 @@ import (
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/generator"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
 
@@ -76,6 +81,274 @@ func TestGenerate(t *testing.T) {
 	require.FileExists(t, path)
 }
 
+func TestGenerateIncludeFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("lib", 0o755))
+	require.NoError(t, fsys.WriteFile("lib/libc.so", []byte("hello"), 0o755))
+	opts := testOpts(fsys)
+	opts.IncludeFiles = true
+	opts.Packages[0].Files = []tar.Header{
+		{Name: "lib", Typeflag: tar.TypeDir},
+		{Name: "lib/libc.so", Typeflag: tar.TypeReg},
+		{Name: "lib/removed.so", Typeflag: tar.TypeReg},
+	}
+
+	path := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	require.NoError(t, New().Generate(t.Context(), opts, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	require.Len(t, doc.Files, 1)
+	file := doc.Files[0]
+	require.Equal(t, "/lib/libc.so", file.Name)
+	require.Contains(t, file.Checksums, Checksum{
+		Algorithm: "SHA256",
+		Value:     "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	})
+	require.Contains(t, file.Comment, "musl-1.2.2-r7")
+	require.Contains(t, doc.Relationships, Relationship{
+		Element: doc.DocumentDescribes[0],
+		Type:    "CONTAINS",
+		Related: file.ID,
+	})
+}
+
+func TestNormalizeLicense(t *testing.T) {
+	for _, tc := range []struct {
+		license string
+		want    string
+		unknown map[string]string
+	}{
+		{license: "MIT", want: "MIT"},
+		{license: "NOASSERTION", want: "NOASSERTION"},
+		{license: "mit and apache-2.0", want: "MIT AND Apache-2.0"},
+		{license: "GPL2+ OR (BSD-3 AND ISC)", want: "GPL-2.0-or-later OR (BSD-3-Clause AND ISC)"},
+		{license: "GPL-2.0", want: "GPL-2.0-only"},
+		{license: "LGPL-2.1+", want: "LGPL-2.1-or-later"},
+		{license: "GPL-2.0-or-later WITH classpath-exception-2.0", want: "GPL-2.0-or-later WITH Classpath-exception-2.0"},
+		{
+			license: "MIT AND custom",
+			want:    "MIT AND LicenseRef-custom",
+			unknown: map[string]string{"LicenseRef-custom": "custom"},
+		},
+		{
+			license: "LicenseRef-ubuntu-font",
+			want:    "LicenseRef-ubuntu-font",
+			unknown: map[string]string{"LicenseRef-ubuntu-font": "LicenseRef-ubuntu-font"},
+		},
+		{
+			license: "MIT AND (",
+			want:    "LicenseRef-MIT-AND",
+			unknown: map[string]string{"LicenseRef-MIT-AND": "MIT AND ("},
+		},
+	} {
+		t.Run(tc.license, func(t *testing.T) {
+			got, unknown := normalizeLicense(tc.license)
+			require.Equal(t, tc.want, got)
+			if len(tc.unknown) == 0 {
+				require.Empty(t, unknown)
+			} else {
+				require.Equal(t, tc.unknown, unknown)
+			}
+		})
+	}
+}
+
+func TestGenerateLicenseTexts(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	sbomDir := path.Join("var", "lib", "db", "sbom")
+	require.NoError(t, fsys.MkdirAll(sbomDir, 0o750))
+	require.NoError(t, fsys.MkdirAll("usr/share/licenses/musl", 0o755))
+	require.NoError(t, fsys.WriteFile("usr/share/licenses/musl/COPYRIGHT", []byte("all yours"), 0o644))
+	apkSBOM, err := json.Marshal(&Document{
+		ID:                "SPDXRef-DOCUMENT",
+		DocumentDescribes: []string{"SPDXRef-Package-musl"},
+		Packages: []Package{{
+			ID:               "SPDXRef-Package-musl",
+			Name:             "musl",
+			Version:          "1.2.2-r7",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "mit or musl-license",
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, fsys.WriteFile(path.Join(sbomDir, "musl-1.2.2-r7.spdx.json"), apkSBOM, 0o644))
+
+	for _, tc := range []struct {
+		licenseTexts bool
+		want         string
+	}{
+		{false, "musl-license"},
+		{true, "all yours"},
+	} {
+		t.Run(fmt.Sprint(tc.licenseTexts), func(t *testing.T) {
+			opts := testOpts(fsys)
+			opts.IncludeLicenseTexts = tc.licenseTexts
+			opts.Packages[0].Files = []tar.Header{
+				{Name: "usr/share/licenses/musl", Typeflag: tar.TypeDir},
+				{Name: "usr/share/licenses/musl/COPYRIGHT", Typeflag: tar.TypeReg},
+			}
+
+			path := filepath.Join(t.TempDir(), "sbom.spdx.json")
+			require.NoError(t, New().Generate(t.Context(), opts, path))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			doc := &Document{}
+			require.NoError(t, json.Unmarshal(data, doc))
+
+			var licenses []string
+			for _, p := range doc.Packages {
+				if p.Name == "musl" {
+					licenses = append(licenses, p.LicenseDeclared)
+				}
+			}
+			require.Equal(t, []string{"MIT OR LicenseRef-musl-license"}, licenses)
+			require.Equal(t, []LicensingInfo{{
+				LicenseID:     "LicenseRef-musl-license",
+				ExtractedText: tc.want,
+			}}, doc.LicensingInfos)
+		})
+	}
+}
+
+func TestAddVerifications(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.PackageVerifications = map[string]apk.PackageVerification{
+		"musl": {KeyID: "test.rsa.pub", Checksum: true},
+	}
+	doc := &Document{Packages: []Package{
+		{ID: "SPDXRef-Package-musl", Name: "musl", Version: "1.2.2-r7"},
+		// Not the version that was installed.
+		{ID: "SPDXRef-Package-musl-old", Name: "musl", Version: "1.2.2-r6"},
+		{ID: "SPDXRef-Package-other", Name: "other", Version: "1.0"},
+	}}
+	addVerifications(doc, opts)
+	require.Equal(t, []Annotation{{
+		Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+		Type:      "OTHER",
+		Annotator: "Tool: apko",
+		Comment:   "apk signature verified with key test.rsa.pub, checksum matches the repository index",
+	}}, doc.Packages[0].Annotations)
+	require.Empty(t, doc.Packages[1].Annotations)
+	require.Empty(t, doc.Packages[2].Annotations)
+}
+
+func TestAddStripped(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.Packages[0].Files = []tar.Header{{Name: "usr/share/man/man7/musl.7"}, {Name: "lib/libc.a"}}
+	opts.StrippedFiles = []string{"/lib/libc.a", "/usr/share/man/man7/musl.7", "/usr/share/man/man1/app.1"}
+	doc := &Document{
+		DocumentDescribes: []string{"SPDXRef-Package-image"},
+		Packages: []Package{
+			{ID: "SPDXRef-Package-image", Name: "image"},
+			{ID: "SPDXRef-Package-musl", Name: "musl", Version: "1.2.2-r7"},
+		},
+	}
+	addStripped(doc, opts)
+	annotation := func(comment string) []Annotation {
+		return []Annotation{{
+			Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Type:      "OTHER",
+			Annotator: "Tool: apko",
+			Comment:   comment,
+		}}
+	}
+	require.Equal(t, annotation("stripped /usr/share/man/man1/app.1"), doc.Packages[0].Annotations)
+	require.Equal(t, annotation("stripped /lib/libc.a, /usr/share/man/man7/musl.7"), doc.Packages[1].Annotations)
+	require.Empty(t, doc.Annotations)
+
+	// Without the package it describes, the others annotate the document.
+	doc = &Document{
+		DocumentDescribes: []string{"SPDXRef-Package-image"},
+		Packages:          []Package{{ID: "SPDXRef-Package-musl", Name: "musl", Version: "1.2.2-r7"}},
+	}
+	addStripped(doc, opts)
+	require.Equal(t, annotation("stripped /lib/libc.a, /usr/share/man/man7/musl.7"), doc.Packages[0].Annotations)
+	require.Equal(t, annotation("stripped /usr/share/man/man1/app.1"), doc.Annotations)
+}
+
+func TestGenerateVersion(t *testing.T) {
+	gens, err := generator.WithVersions([]generator.Generator{New()}, map[string]string{"spdx": Version22})
+	require.NoError(t, err)
+	require.Len(t, gens, 1)
+
+	opts := testOpts(apkfs.NewMemFS())
+	opts.ImageInfo.ImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	path := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	require.NoError(t, gens[0].Generate(t.Context(), opts, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	require.Equal(t, "SPDX-2.2", doc.Version)
+	for _, p := range doc.Packages {
+		require.Empty(t, p.PrimaryPurpose, p.ID)
+		for _, ref := range p.ExternalRefs {
+			require.Equal(t, "PACKAGE_MANAGER", ref.Category, p.ID)
+		}
+	}
+
+	_, err = New().WithVersion("3.0")
+	require.ErrorContains(t, err, "unsupported SPDX version")
+	_, err = generator.WithVersions([]generator.Generator{New()}, map[string]string{"cyclonedx": "1.5"})
+	require.ErrorContains(t, err, "no cyclonedx SBOMs")
+}
+
+func TestGenerateIndex(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.ImageInfo.IndexDigest = v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	opts.ImageInfo.Images = []options.ArchImageInfo{{
+		Digest:     v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)},
+		Arch:       types.ParseArchitecture("amd64"),
+		SBOMDigest: strings.Repeat("c", 64),
+	}, {
+		Digest:     v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("d", 64)},
+		Arch:       types.ParseArchitecture("arm64"),
+		SBOMDigest: strings.Repeat("e", 64),
+	}}
+
+	path := filepath.Join(t.TempDir(), "sbom-index.spdx.json")
+	require.NoError(t, New().GenerateIndex(opts, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	// The index SBOM refers to the SBOM of each image, by its namespace.
+	require.Equal(t, []ExternalDocumentRef{{
+		Checksum:           Checksum{Algorithm: "SHA256", Value: strings.Repeat("c", 64)},
+		ExternalDocumentID: "DocumentRef-sbom-amd64",
+		SPDXDocument:       "https://spdx.org/spdxdocs/apko/sbom-sha256:" + strings.Repeat("b", 64),
+	}, {
+		Checksum:           Checksum{Algorithm: "SHA256", Value: strings.Repeat("e", 64)},
+		ExternalDocumentID: "DocumentRef-sbom-arm64",
+		SPDXDocument:       "https://spdx.org/spdxdocs/apko/sbom-sha256:" + strings.Repeat("d", 64),
+	}}, doc.ExternalDocumentRefs)
+	require.Equal(t, "https://spdx.org/spdxdocs/apko/sbom-sha256:"+strings.Repeat("a", 64), doc.Namespace)
+	require.NotEqual(t, doc.ExternalDocumentRefs[0].SPDXDocument, doc.ExternalDocumentRefs[1].SPDXDocument)
+	for _, ref := range doc.ExternalDocumentRefs {
+		require.NotEqual(t, doc.Namespace, ref.SPDXDocument)
+	}
+
+	// Which is the namespace of the SBOM of the image.
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("d", 64)
+	imagePath := filepath.Join(t.TempDir(), "sbom-aarch64.spdx.json")
+	require.NoError(t, New().Generate(t.Context(), opts, imagePath))
+	data, err = os.ReadFile(imagePath)
+	require.NoError(t, err)
+	image := &Document{}
+	require.NoError(t, json.Unmarshal(data, image))
+	require.Equal(t, doc.ExternalDocumentRefs[1].SPDXDocument, image.Namespace)
+	require.Contains(t, doc.Relationships, Relationship{
+		Element: "SPDXRef-Package-sha256-" + strings.Repeat("b", 64),
+		Type:    "DESCRIBED_BY",
+		Related: "DocumentRef-sbom-amd64:SPDXRef-DOCUMENT",
+	})
+}
+
 func TestSPDX_Generate(t *testing.T) {
 	tests := []struct {
 		name string
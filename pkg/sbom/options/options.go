@@ -50,6 +50,21 @@ type Options struct {
 
 	// Packages is a list of packages which will be listed in the SBOM
 	Packages []*apk.InstalledPackage
+
+	// PackageVerifications is how each of the Packages installed by this
+	// build was verified against the keyring, by package name
+	PackageVerifications map[string]apk.PackageVerification
+
+	// StrippedFiles are the absolute paths of the files removed from the
+	// image by strip path mutations, after they were installed
+	StrippedFiles []string
+
+	// IncludeFiles lists the files of the packages in the SBOM too
+	IncludeFiles bool
+
+	// IncludeLicenseTexts copies the license texts shipped by the packages
+	// into the SBOM for the licenses that are not in the SPDX license list
+	IncludeLicenseTexts bool
 }
 
 type PurlQualifiers map[string]string
@@ -0,0 +1,85 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+type ReleaseData struct {
+	ID         string
+	Name       string
+	PrettyName string
+	VersionID  string
+}
+
+// ReadReleaseData is a helper that reads the information from /etc/os-release
+//
+// If no os-release file is found, it returns a Data struct with ID set to "unknown".
+func ReadReleaseData(fsys fs.FS) (*ReleaseData, error) {
+	f, err := fsys.Open("/etc/os-release")
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ReleaseData{
+			ID:        "unknown",
+			Name:      "apko-generated image",
+			VersionID: "unknown",
+		}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening os-release: %w", err)
+	}
+	defer f.Close()
+
+	return ParseReleaseData(f)
+}
+
+// ParseReleaseData reads the os-release data from the provided io.Reader
+func ParseReleaseData(osRelease io.Reader) (*ReleaseData, error) {
+	scanner := bufio.NewScanner(osRelease)
+
+	kv := map[string]string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		before, after, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid os-release line: %q", line)
+		}
+
+		kv[before] = strings.Trim(after, "\"")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading os-release: %w", err)
+	}
+
+	return &ReleaseData{
+		ID:         kv["ID"],
+		Name:       kv["NAME"],
+		PrettyName: kv["PRETTY_NAME"],
+		VersionID:  kv["VERSION_ID"],
+	}, nil
+}
@@ -12,9 +12,33 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package sbom generates SBOMs for filesystems populated from APK packages.
+//
+// It can be used on its own, without running an apko build. Given a
+// filesystem containing an installed package database, NewOptions collects
+// the packages and operating system details, and Generate renders them with
+// any of the registered generators:
+//
+//	opts, err := sbom.NewOptions(fsys)
+//	opts.OutputDir = "out"
+//	opts.ImageInfo.Arch = types.ParseArchitecture("x86_64")
+//	sboms, err := sbom.Generate(ctx, &opts, generator.Generators("spdx")...)
+//
+// Generators register themselves on import, e.g. by importing
+// chainguard.dev/apko/pkg/sbom/generator/spdx. Tools embedding apko can add
+// formats of their own with generator.RegisterGenerator; those implementing
+// generator.TypedGenerator also choose the media type their SBOMs are
+// attached with and the predicate type they are attested with.
 package sbom
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/sbom/generator"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
 
@@ -27,3 +51,49 @@ var DefaultOptions = options.Options{
 	},
 	FileName: "sbom",
 }
+
+// installedDBPath is where the installed package database lives in the rootfs.
+const installedDBPath = "usr/lib/apk/db/installed"
+
+// NewOptions returns a copy of DefaultOptions populated with the packages in the
+// installed database and the operating system described by /etc/os-release in fsys.
+func NewOptions(fsys apkfs.ReaderFS) (options.Options, error) {
+	opts := DefaultOptions
+	opts.FS = fsys
+
+	f, err := fsys.Open(installedDBPath)
+	if err != nil {
+		return opts, fmt.Errorf("opening installed database: %w", err)
+	}
+	defer f.Close()
+
+	pkgs, err := apk.ParseInstalled(f)
+	if err != nil {
+		return opts, fmt.Errorf("parsing installed database: %w", err)
+	}
+	opts.Packages = pkgs
+
+	info, err := ReadReleaseData(fsys)
+	if err != nil {
+		return opts, fmt.Errorf("reading release data: %w", err)
+	}
+	opts.OS.Name = info.Name
+	opts.OS.ID = info.ID
+	opts.OS.Version = info.VersionID
+
+	return opts, nil
+}
+
+// Generate renders an SBOM for opts with each of the generators, writing them
+// to opts.OutputDir, and returns the paths of the documents written.
+func Generate(ctx context.Context, opts *options.Options, gens ...generator.Generator) ([]string, error) {
+	paths := make([]string, 0, len(gens))
+	for _, gen := range gens {
+		path := filepath.Join(opts.OutputDir, opts.FileName+"."+gen.Ext())
+		if err := gen.Generate(ctx, opts, path); err != nil {
+			return nil, fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/sbom/generator"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+const installed = `C:Q1Deb0jNytkrjPW4N/eKLZ43BwOlw=
+P:ca-certificates-bundle
+V:20230506-r0
+A:x86_64
+S:125290
+I:262144
+T:Mozilla's CA certificates bundle
+U:https://www.mozilla.org/en-US/about/governance/policies/security-group/certs/
+L:MPL-2.0 AND MIT
+o:ca-certificates
+t:1683241171
+c:0c4d8b3e0123f7a1c9b93ab4b2a6f9d3d5a6a12b
+
+`
+
+const osRelease = `ID=wolfi
+NAME="Wolfi"
+VERSION_ID="20230201"
+`
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("usr/lib/apk/db", 0o755))
+	require.NoError(t, fsys.WriteFile("usr/lib/apk/db/installed", []byte(installed), 0o644))
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/os-release", []byte(osRelease), 0o644))
+
+	opts, err := sbom.NewOptions(fsys)
+	require.NoError(t, err)
+	require.Len(t, opts.Packages, 1)
+	require.Equal(t, "ca-certificates-bundle", opts.Packages[0].Name)
+	require.Equal(t, "wolfi", opts.OS.ID)
+	require.Equal(t, "Wolfi", opts.OS.Name)
+	require.Equal(t, "20230201", opts.OS.Version)
+
+	opts.OutputDir = t.TempDir()
+	opts.ImageInfo.Arch = types.ParseArchitecture("x86_64")
+
+	paths, err := sbom.Generate(ctx, &opts, spdx.New())
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(opts.OutputDir, "sbom.spdx.json")}, paths)
+
+	b, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	require.Contains(t, string(b), "SPDXRef-OperatingSystem-wolfi")
+}
+
+// swid is a custom generator, the way a tool embedding apko would add one.
+type swid struct{}
+
+func (swid) Key() string           { return "swid" }
+func (swid) Ext() string           { return "swid.xml" }
+func (swid) MediaType() string     { return "application/swid+xml" }
+func (swid) PredicateType() string { return "https://example.com/swid" }
+
+func (swid) Generate(_ context.Context, opts *options.Options, path string) error {
+	return os.WriteFile(path, []byte("<SoftwareIdentity name=\""+opts.Packages[0].Name+"\"/>"), 0o644)
+}
+
+func (swid) GenerateIndex(*options.Options, string) error { return nil }
+
+func TestRegisterGenerator(t *testing.T) {
+	ctx := context.Background()
+	generator.RegisterGenerator("swid", func() generator.Generator { return swid{} })
+
+	gens := generator.Generators("spdx", "swid")
+	require.Len(t, gens, 2)
+	require.Equal(t, "spdx", gens[0].Key())
+	require.Equal(t, "swid", gens[1].Key())
+
+	require.Equal(t, ggcrtypes.MediaType("application/swid+xml"), oci.SBOMMediaType("swid"))
+	pt, err := oci.SBOMPredicateType("swid")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/swid", pt)
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("usr/lib/apk/db", 0o755))
+	require.NoError(t, fsys.WriteFile("usr/lib/apk/db/installed", []byte(installed), 0o644))
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/os-release", []byte(osRelease), 0o644))
+	opts, err := sbom.NewOptions(fsys)
+	require.NoError(t, err)
+	opts.OutputDir = t.TempDir()
+
+	paths, err := sbom.Generate(ctx, &opts, generator.Generators("swid")...)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(opts.OutputDir, "sbom.swid.xml")}, paths)
+	b, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	require.Contains(t, string(b), "ca-certificates-bundle")
+}
+
+func TestNewOptionsMissingDatabase(t *testing.T) {
+	_, err := sbom.NewOptions(apkfs.NewMemFS())
+	require.Error(t, err)
+}
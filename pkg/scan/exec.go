@@ -0,0 +1,129 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// execScanner runs an external scanner on the SBOM of images.
+type execScanner struct {
+	name  string
+	args  func(sbom string) []string
+	parse func(arch string, out []byte) ([]Finding, error)
+}
+
+var grype = &execScanner{
+	name: "grype",
+	args: func(sbom string) []string { return []string{"sbom:" + sbom, "--output", "json", "--quiet"} },
+	parse: func(arch string, out []byte) ([]Finding, error) {
+		var report struct {
+			Matches []struct {
+				Vulnerability struct {
+					ID       string `json:"id"`
+					Severity string `json:"severity"`
+					Fix      struct {
+						Versions []string `json:"versions"`
+					} `json:"fix"`
+				} `json:"vulnerability"`
+				Artifact struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"artifact"`
+			} `json:"matches"`
+		}
+		if err := json.Unmarshal(out, &report); err != nil {
+			return nil, err
+		}
+		findings := make([]Finding, 0, len(report.Matches))
+		for _, m := range report.Matches {
+			findings = append(findings, Finding{
+				Arch:          arch,
+				Package:       m.Artifact.Name,
+				Version:       m.Artifact.Version,
+				Vulnerability: m.Vulnerability.ID,
+				Severity:      parseSeverityOrUnknown(m.Vulnerability.Severity),
+				FixedVersion:  strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			})
+		}
+		return findings, nil
+	},
+}
+
+var trivy = &execScanner{
+	name: "trivy",
+	args: func(sbom string) []string { return []string{"sbom", "--format", "json", "--quiet", sbom} },
+	parse: func(arch string, out []byte) ([]Finding, error) {
+		var report struct {
+			Results []struct {
+				Vulnerabilities []struct {
+					VulnerabilityID  string
+					PkgName          string
+					InstalledVersion string
+					FixedVersion     string
+					Severity         string
+				}
+			}
+		}
+		if err := json.Unmarshal(out, &report); err != nil {
+			return nil, err
+		}
+		var findings []Finding
+		for _, r := range report.Results {
+			for _, v := range r.Vulnerabilities {
+				findings = append(findings, Finding{
+					Arch:          arch,
+					Package:       v.PkgName,
+					Version:       v.InstalledVersion,
+					Vulnerability: v.VulnerabilityID,
+					Severity:      parseSeverityOrUnknown(v.Severity),
+					FixedVersion:  v.FixedVersion,
+				})
+			}
+		}
+		return findings, nil
+	},
+}
+
+func (s *execScanner) Name() string {
+	return s.name
+}
+
+func (s *execScanner) Scan(ctx context.Context, target Target) ([]Finding, error) {
+	if target.SBOM == "" {
+		return nil, fmt.Errorf("%s scans the SPDX SBOM of the image, which was not generated", s.name)
+	}
+	bin, err := exec.LookPath(s.name)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, s.args(target.SBOM)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %w: %s", s.name, err, strings.TrimSpace(stderr.String()))
+	}
+	findings, err := s.parse(target.Arch, stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("parsing report of %s: %w", s.name, err)
+	}
+	return findings, nil
+}
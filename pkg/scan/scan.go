@@ -0,0 +1,250 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scan scans the packages of built images for known
+// vulnerabilities, with an external scanner such as grype or trivy or by
+// matching them against a security database in the format of the Alpine
+// secdb, and fails on findings over a severity threshold.
+package scan
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Severity is how severe a vulnerability is.
+type Severity int
+
+const (
+	// SeverityUnknown is the severity of vulnerabilities a scanner does not
+	// rate, such as all of those of a secdb.
+	SeverityUnknown Severity = iota
+	SeverityNegligible
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"unknown", "negligible", "low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses the name of a severity, in any case.
+func ParseSeverity(s string) (Severity, error) {
+	i := slices.Index(severityNames, strings.ToLower(s))
+	if i == -1 {
+		return 0, fmt.Errorf("unknown severity %q, expected one of %s", s, strings.Join(severityNames, ", "))
+	}
+	return Severity(i), nil
+}
+
+// parseSeverityOrUnknown is ParseSeverity for the ratings of scanners,
+// which are unknown when they are not one of the severities.
+func parseSeverityOrUnknown(s string) Severity {
+	sev, err := ParseSeverity(s)
+	if err != nil {
+		return SeverityUnknown
+	}
+	return sev
+}
+
+// Package is an installed package.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Origin is the package the package was built from, which security
+	// databases list vulnerabilities by.
+	Origin string `json:"origin,omitempty"`
+}
+
+// Target is the image of an architecture to scan.
+type Target struct {
+	// Arch is the architecture of the image, as apk names it.
+	Arch string
+	// Packages are the packages installed in the image.
+	Packages []Package
+	// SBOM is the path of the SPDX SBOM of the image, if it was generated.
+	SBOM string
+}
+
+// Finding is a vulnerability of a package of an image.
+type Finding struct {
+	Arch          string   `json:"arch"`
+	Package       string   `json:"package"`
+	Version       string   `json:"version"`
+	Vulnerability string   `json:"vulnerability"`
+	Severity      Severity `json:"-"`
+	// FixedVersion is the first version of the package without the
+	// vulnerability, if the scanner knows of one.
+	FixedVersion string `json:"fixedVersion,omitempty"`
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s: %s-%s: %s (%s)", f.Arch, f.Package, f.Version, f.Vulnerability, f.Severity)
+	if f.FixedVersion != "" {
+		s += ", fixed in " + f.FixedVersion
+	}
+	return s
+}
+
+// Scanner finds the vulnerabilities of the packages of images.
+type Scanner interface {
+	// Name is the name of the scanner, for messages.
+	Name() string
+	// Scan returns the vulnerabilities of the packages of target.
+	Scan(ctx context.Context, target Target) ([]Finding, error)
+}
+
+// Option configures a scanner.
+type Option func(*options)
+
+type options struct {
+	transport http.RoundTripper
+}
+
+// WithTransport fetches the security databases of secdb scanners through t,
+// rather than http.DefaultTransport.
+func WithTransport(t http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = t
+	}
+}
+
+// NewScanner returns the scanner of spec: grype or trivy, which are run
+// on the SBOM of each image and must be in PATH, or secdb=<location>,
+// which matches packages against the security database at location, a
+// path or an http(s) URL.
+func NewScanner(spec string, opts ...Option) (Scanner, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	name, arg, _ := strings.Cut(spec, "=")
+	switch name {
+	case "grype":
+		return grype, nil
+	case "trivy":
+		return trivy, nil
+	case "secdb":
+		if arg == "" {
+			return nil, fmt.Errorf("scanner %q has no location, as secdb=<path or URL>", spec)
+		}
+		return &secDBScanner{location: arg, client: &http.Client{Transport: o.transport}}, nil
+	default:
+		return nil, fmt.Errorf("unknown scanner %q, expected grype, trivy or secdb=<path or URL>", spec)
+	}
+}
+
+// Targets returns the images of idx to scan, with the SPDX SBOMs of sboms
+// that describe them.
+func Targets(idx v1.ImageIndex, sboms []types.SBOM) ([]Target, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	for _, desc := range im.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+		}
+		installed, err := oci.InstalledPackages(img)
+		if err != nil {
+			return nil, fmt.Errorf("reading packages of image %s: %w", desc.Digest, err)
+		}
+		pkgs := make([]Package, 0, len(installed))
+		for _, pkg := range installed {
+			pkgs = append(pkgs, Package{Name: pkg.Name, Version: pkg.Version, Origin: pkg.Origin})
+		}
+		arch := types.ParseArchitecture(desc.Platform.Architecture)
+		for _, a := range types.AllArchs {
+			if p := a.ToOCIPlatform(); p.Architecture == desc.Platform.Architecture && p.Variant == desc.Platform.Variant {
+				arch = a
+			}
+		}
+		t := Target{Arch: arch.ToAPK(), Packages: pkgs}
+		for _, s := range sboms {
+			if s.Arch == arch.String() && s.Format == "spdx" {
+				t.SBOM = s.Path
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// Check scans targets with scanners, logging every finding, and fails
+// listing those as severe as failOn or more. Findings of unknown severity,
+// which may be of any, fail at every threshold.
+func Check(ctx context.Context, scanners []Scanner, targets []Target, failOn Severity) error {
+	log := clog.FromContext(ctx)
+
+	var failed []Finding
+	for _, s := range scanners {
+		for _, t := range targets {
+			findings, err := s.Scan(ctx, t)
+			if err != nil {
+				return fmt.Errorf("scanning %s with %s: %w", t.Arch, s.Name(), err)
+			}
+			sortFindings(findings)
+			log.Infof("%s found %d vulnerabilities in %s", s.Name(), len(findings), t.Arch)
+			for _, f := range findings {
+				if f.Severity >= failOn || f.Severity == SeverityUnknown {
+					log.Warn(f.String())
+					failed = append(failed, f)
+				} else {
+					log.Info(f.String())
+				}
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(failed))
+	for i, f := range failed {
+		msgs[i] = "  " + f.String()
+	}
+	return fmt.Errorf("found %d vulnerabilities of severity %s or more, or of unknown severity:\n%s", len(failed), failOn, strings.Join(msgs, "\n"))
+}
+
+func sortFindings(findings []Finding) {
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(b.Severity, a.Severity),
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(a.Vulnerability, b.Vulnerability),
+		)
+	})
+}
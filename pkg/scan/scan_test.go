@@ -0,0 +1,106 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []string{"unknown", "Negligible", "low", "MEDIUM", "high", "critical"} {
+		sev, err := ParseSeverity(s)
+		require.NoError(t, err, s)
+		require.Equal(t, sev.String(), parseSeverityOrUnknown(s).String())
+	}
+	_, err := ParseSeverity("severe")
+	require.ErrorContains(t, err, `unknown severity "severe"`)
+	require.Equal(t, SeverityUnknown, parseSeverityOrUnknown("severe"))
+}
+
+func TestNewScanner(t *testing.T) {
+	for _, spec := range []string{"grype", "trivy", "secdb=secdb.json"} {
+		_, err := NewScanner(spec)
+		require.NoError(t, err, spec)
+	}
+	for _, spec := range []string{"clair", "secdb", "secdb="} {
+		_, err := NewScanner(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestSecDB(t *testing.T) {
+	ctx := context.Background()
+
+	db := filepath.Join(t.TempDir(), "secdb.json")
+	require.NoError(t, os.WriteFile(db, []byte(`{
+  "packages": [
+    {"pkg": {"name": "openssl", "secfixes": {
+      "0": ["CVE-2000-0001"],
+      "3.1.2-r0": ["CVE-2023-0002 GHSA-xxxx"],
+      "3.1.4-r1": ["CVE-2023-0003"]
+    }}}
+  ]
+}`), 0o644))
+
+	s, err := NewScanner("secdb=" + db)
+	require.NoError(t, err)
+	findings, err := s.Scan(ctx, Target{Arch: "x86_64", Packages: []Package{
+		{Name: "openssl", Version: "3.1.2-r0"},
+		// Subpackages are listed by origin.
+		{Name: "libcrypto3", Version: "3.1.2-r0", Origin: "openssl"},
+		{Name: "busybox", Version: "1.36.1-r0"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []Finding{{
+		Arch:          "x86_64",
+		Package:       "openssl",
+		Version:       "3.1.2-r0",
+		Vulnerability: "CVE-2023-0003",
+		Severity:      SeverityUnknown,
+		FixedVersion:  "3.1.4-r1",
+	}, {
+		Arch:          "x86_64",
+		Package:       "libcrypto3",
+		Version:       "3.1.2-r0",
+		Vulnerability: "CVE-2023-0003",
+		Severity:      SeverityUnknown,
+		FixedVersion:  "3.1.4-r1",
+	}}, findings)
+
+	// Unrated findings fail at every threshold.
+	for _, failOn := range []Severity{SeverityUnknown, SeverityHigh, SeverityCritical} {
+		err = Check(ctx, []Scanner{s}, []Target{{Arch: "x86_64", Packages: []Package{{Name: "openssl", Version: "3.1.2-r0"}}}}, failOn)
+		require.ErrorContains(t, err, "found 1 vulnerabilities of severity "+failOn.String()+" or more, or of unknown severity:\n  x86_64: openssl-3.1.2-r0: CVE-2023-0003 (unknown), fixed in 3.1.4-r1")
+	}
+	require.NoError(t, Check(ctx, []Scanner{s}, []Target{{Arch: "x86_64", Packages: []Package{{Name: "openssl", Version: "3.1.4-r1"}}}}, SeverityHigh))
+}
+
+func TestGrype(t *testing.T) {
+	findings, err := grype.parse("aarch64", []byte(`{"matches": [
+  {"vulnerability": {"id": "CVE-2024-0001", "severity": "Critical", "fix": {"versions": ["1.2.3-r1"]}}, "artifact": {"name": "zlib", "version": "1.2.3-r0"}},
+  {"vulnerability": {"id": "CVE-2024-0002", "severity": "Low"}, "artifact": {"name": "zlib", "version": "1.2.3-r0"}}
+]}`))
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	require.Equal(t, SeverityCritical, findings[0].Severity)
+	require.Equal(t, "1.2.3-r1", findings[0].FixedVersion)
+	require.Equal(t, SeverityLow, findings[1].Severity)
+	require.Equal(t, "aarch64", findings[1].Arch)
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// secDB is a security database in the format of the Alpine secdb, which
+// lists, for each package, the vulnerabilities fixed by each version.
+type secDB struct {
+	Packages []struct {
+		Pkg struct {
+			Name string `json:"name"`
+			// SecFixes maps versions to the vulnerabilities they fix, each
+			// an identifier possibly followed by aliases. Version 0 lists
+			// those the package was never affected by.
+			SecFixes map[string][]string `json:"secfixes"`
+		} `json:"pkg"`
+	} `json:"packages"`
+}
+
+// secDBScanner matches packages against a secDB, which lists them by origin.
+// Databases do not rate vulnerabilities, so its findings are of unknown
+// severity.
+type secDBScanner struct {
+	location string
+	client   *http.Client
+
+	once  sync.Once
+	fixes map[string]map[string][]string
+	err   error
+}
+
+func (s *secDBScanner) Name() string {
+	return "secdb"
+}
+
+func (s *secDBScanner) load(ctx context.Context) error {
+	s.once.Do(func() {
+		var b []byte
+		if b, s.err = readLocation(ctx, s.client, s.location); s.err != nil {
+			return
+		}
+		var db secDB
+		if s.err = json.Unmarshal(b, &db); s.err != nil {
+			s.err = fmt.Errorf("parsing %s: %w", s.location, s.err)
+			return
+		}
+		s.fixes = map[string]map[string][]string{}
+		for _, p := range db.Packages {
+			s.fixes[p.Pkg.Name] = p.Pkg.SecFixes
+		}
+	})
+	return s.err
+}
+
+func readLocation(ctx context.Context, client *http.Client, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return os.ReadFile(location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Scan reports, for each package of target, the vulnerabilities fixed in
+// versions later than the one installed.
+func (s *secDBScanner) Scan(ctx context.Context, target Target) ([]Finding, error) {
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, pkg := range target.Packages {
+		installed, err := apk.ParseVersion(pkg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version of %s: %w", pkg.Name, err)
+		}
+		origin := pkg.Origin
+		if origin == "" {
+			origin = pkg.Name
+		}
+		for fixed, vulns := range s.fixes[origin] {
+			v, err := apk.ParseVersion(fixed)
+			if err != nil || apk.CompareVersions(installed, v) >= 0 {
+				continue
+			}
+			for _, vuln := range vulns {
+				id, _, _ := strings.Cut(strings.TrimSpace(vuln), " ")
+				findings = append(findings, Finding{
+					Arch:          target.Arch,
+					Package:       pkg.Name,
+					Version:       pkg.Version,
+					Vulnerability: id,
+					Severity:      SeverityUnknown,
+					FixedVersion:  fixed,
+				})
+			}
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+const (
+	// DSSEMediaType is the media type of the DSSE envelopes attestations
+	// are stored in.
+	DSSEMediaType ggcrtypes.MediaType = "application/vnd.dsse.envelope.v1+json"
+
+	// InTotoPayloadType is the payload type of DSSE envelopes holding an
+	// in-toto statement.
+	InTotoPayloadType = "application/vnd.in-toto+json"
+
+	// InTotoStatementType is the type of the in-toto statements cosign
+	// produces and verifies.
+	InTotoStatementType = "https://in-toto.io/Statement/v0.1"
+
+	// PredicateTypeAnnotation holds the predicate type of an attestation.
+	PredicateTypeAnnotation = "predicateType"
+)
+
+// Attestation is an in-toto statement about a published manifest.
+type Attestation struct {
+	// Subject is the manifest the attestation is about.
+	Subject name.Digest
+	// PredicateType is a URI identifying the kind of Predicate, such as
+	// https://spdx.dev/Document for SPDX SBOMs.
+	PredicateType string
+	// Predicate is the JSON document being attested to.
+	Predicate json.RawMessage
+}
+
+// Attest signs each of atts as an in-toto statement in a DSSE envelope and
+// pushes them where cosign looks for attestations: to the sha256-<hex>.att
+// tag of the subject's repository, where attestations that are already there
+// are kept, or as referrers if s.Referrers is set. It returns the references
+// the attestations were pushed to.
+func (s *Signer) Attest(ctx context.Context, atts []Attestation, remoteOpts ...remote.Option) ([]name.Reference, error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "Attest")
+	defer span.End()
+	// Pushes are cancelled with ctx.
+	remoteOpts = append(slices.Clip(remoteOpts), remote.WithContext(ctx))
+
+	refs := make([]name.Reference, 0, len(atts))
+	for _, att := range atts {
+		envelope, err := s.envelope(att)
+		if err != nil {
+			return nil, err
+		}
+		attLayer := mutate.Addendum{
+			Layer:     static.NewLayer(envelope, DSSEMediaType),
+			MediaType: DSSEMediaType,
+			Annotations: map[string]string{
+				// The signature is in the envelope.
+				SignatureAnnotation:     "",
+				PredicateTypeAnnotation: att.PredicateType,
+			},
+		}
+		dig := att.Subject
+
+		if s.Referrers {
+			ref, err := pushReferrer(ctx, dig, attLayer, string(DSSEMediaType), remoteOpts...)
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("attested %s for %s as %s", att.PredicateType, dig, ref)
+			refs = append(refs, ref)
+			continue
+		}
+
+		tag := dig.Context().Tag(strings.Replace(dig.DigestStr(), ":", "-", 1) + ".att")
+		base, err := existingSignatures(tag, remoteOpts...)
+		if err != nil {
+			return nil, err
+		}
+		img, err := mutate.Append(base, attLayer)
+		if err != nil {
+			return nil, fmt.Errorf("appending attestation: %w", err)
+		}
+
+		log.With("tag", tag.String(), "digest", dig.String()).Infof("attesting %s for %s as %s", att.PredicateType, dig, tag)
+		if err := remote.Write(tag, img, remoteOpts...); err != nil {
+			return nil, fmt.Errorf("writing attestation for %s: %w", dig, err)
+		}
+		h, err := img.Digest()
+		if err != nil {
+			return nil, err
+		}
+		events.Emit(ctx, events.Event{
+			Type:      events.ArtifactPublished,
+			Reference: tag.String(),
+			Digest:    h.String(),
+		})
+		refs = append(refs, tag)
+	}
+	return refs, nil
+}
+
+// envelope returns the signed DSSE envelope of the in-toto statement of att.
+func (s *Signer) envelope(att Attestation) ([]byte, error) {
+	type subject struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	}
+	alg, hex, ok := strings.Cut(att.Subject.DigestStr(), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed digest %q", att.Subject.DigestStr())
+	}
+	statement, err := json.Marshal(struct {
+		Type          string          `json:"_type"`
+		PredicateType string          `json:"predicateType"`
+		Subject       []subject       `json:"subject"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}{
+		Type:          InTotoStatementType,
+		PredicateType: att.PredicateType,
+		Subject: []subject{{
+			Name:   att.Subject.Context().String(),
+			Digest: map[string]string{alg: hex},
+		}},
+		Predicate: att.Predicate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding statement: %w", err)
+	}
+
+	sig, err := s.SignPayload(PAE(InTotoPayloadType, statement))
+	if err != nil {
+		return nil, fmt.Errorf("signing attestation for %s: %w", att.Subject, err)
+	}
+
+	type signature struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	}
+	return json.Marshal(struct {
+		PayloadType string      `json:"payloadType"`
+		Payload     string      `json:"payload"`
+		Signatures  []signature `json:"signatures"`
+	}{
+		PayloadType: InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []signature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+}
+
+// PAE returns the DSSE pre-authentication encoding of payload, which is what
+// the signature of an envelope signs.
+func PAE(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
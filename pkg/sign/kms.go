@@ -0,0 +1,55 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+
+	"github.com/sigstore/sigstore/pkg/signature/kms"
+	// The KMS providers that key references are resolved with.
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/aws"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/azure"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/gcp"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/hashivault"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// IsKMSRef reports whether ref refers to a key held in a KMS, as a URI,
+// rather than to a key file.
+func IsKMSRef(ref string) bool {
+	return strings.Contains(ref, "://")
+}
+
+// LoadKMSKey returns a Signer for the key held in a KMS that ref refers to
+// the way cosign does: awskms://, azurekms://, gcpkms:// or hashivault://,
+// authenticated with the ambient credentials of the provider, or any other
+// scheme of a sigstore KMS plugin, sigstore-kms-<scheme>, found in PATH.
+func LoadKMSKey(ctx context.Context, ref string) (*Signer, error) {
+	sv, err := kms.Get(ctx, ref, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("loading KMS key %s: %w", ref, err)
+	}
+	key, _, err := sv.CryptoSigner(ctx, func(err error) {
+		clog.FromContext(ctx).Warnf("KMS key %s: %v", ref, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading KMS key %s: %w", ref, err)
+	}
+	return &Signer{Ref: ref, key: key}, nil
+}
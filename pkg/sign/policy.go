@@ -0,0 +1,219 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sign signs published images the way cosign does, and checks what
+// is published against the policies that require it.
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy declares which destinations must be signed, how, and which
+// attestations they must carry.
+//
+// A policy file looks like:
+//
+//	rules:
+//	  - destination: registry.example.com/prod/*
+//	    signed: true
+//	    attestations:
+//	      - https://spdx.dev/Document
+//	  - destination: registry.example.com/keyed/*
+//	    keys:
+//	      - cosign.pub
+//	      - sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule holds the requirements for publishing to matching destinations.
+type Rule struct {
+	// Destination is a path.Match pattern matched against the repository
+	// (e.g. registry.example.com/prod/*).
+	Destination string `yaml:"destination"`
+	// Signed requires the published index to be signed.
+	Signed bool `yaml:"signed,omitempty"`
+	// Keys, if set, are the only keys the index may be signed with, as the
+	// paths of PEM public keys, relative to the policy file, or as the
+	// fingerprints KeyFingerprint returns.
+	Keys []string `yaml:"keys,omitempty"`
+	// Identities would be the only keyless identities the index may be
+	// signed with. Keyless signing is not supported, so policies listing
+	// identities are rejected rather than unsatisfiable.
+	Identities []Identity `yaml:"identities,omitempty"`
+	// Attestations are predicate or artifact types that must be attached.
+	Attestations []string `yaml:"attestations,omitempty"`
+
+	// fingerprints of Keys.
+	fingerprints []string
+}
+
+// Identity is a keyless signing identity.
+type Identity struct {
+	Issuer  string `yaml:"issuer"`
+	Subject string `yaml:"subject"`
+}
+
+// Publication describes what a publish is going to produce, for checking it
+// against a Policy.
+type Publication struct {
+	// Key is the public key of the key the index is signed with, if any.
+	Key crypto.PublicKey
+	// Attestations are the predicate or artifact types attached to the
+	// index.
+	Attestations []string
+}
+
+// Signed reports whether the publication is signed at all.
+func (p Publication) Signed() bool {
+	return p.Key != nil
+}
+
+// KeyFingerprint returns the fingerprint of pub that policies may list keys
+// by: sha256: followed by the hex SHA-256 of its PKIX DER encoding, what
+//
+//	openssl pkey -pubin -in cosign.pub -outform der | sha256sum
+//
+// prints.
+func KeyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("marshaling public key: %w", err)
+	}
+	h := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(h[:]), nil
+}
+
+// LoadPolicy reads a Policy from path. The keys it lists by path are read
+// relative to the directory of path.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing policy: %w", err)
+	}
+	return parsePolicy(b, filepath.Dir(path))
+}
+
+// ParsePolicy parses a Policy, rejecting unknown fields so that typos do not
+// silently weaken it. The keys it lists by path are read relative to the
+// working directory.
+func ParsePolicy(b []byte) (*Policy, error) {
+	return parsePolicy(b, ".")
+}
+
+func parsePolicy(b []byte, dir string) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parsing signing policy: %w", err)
+	}
+	for i, r := range p.Rules {
+		if r.Destination == "" {
+			return nil, fmt.Errorf("signing policy rule %d has no destination", i)
+		}
+		if _, err := path.Match(r.Destination, ""); err != nil {
+			return nil, fmt.Errorf("signing policy rule %d: invalid destination %q: %w", i, r.Destination, err)
+		}
+		if len(r.Identities) != 0 {
+			return nil, fmt.Errorf("signing policy rule %d: identities require keyless signing, and keyless signing is not supported; list keys instead", i)
+		}
+		for _, k := range r.Keys {
+			fp, err := keyFingerprint(k, dir)
+			if err != nil {
+				return nil, fmt.Errorf("signing policy rule %d: %w", i, err)
+			}
+			p.Rules[i].fingerprints = append(p.Rules[i].fingerprints, fp)
+		}
+	}
+	return &p, nil
+}
+
+// keyFingerprint returns the fingerprint of the key k refers to, either
+// already a fingerprint or the path of a PEM public key relative to dir.
+func keyFingerprint(k, dir string) (string, error) {
+	if fp, ok := strings.CutPrefix(k, "sha256:"); ok {
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+			return "", fmt.Errorf("invalid key fingerprint %q", k)
+		}
+		return strings.ToLower(k), nil
+	}
+	if !filepath.IsAbs(k) {
+		k = filepath.Join(dir, k)
+	}
+	b, err := os.ReadFile(k)
+	if err != nil {
+		return "", fmt.Errorf("reading public key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return "", fmt.Errorf("no PEM public key found in %s", k)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parsing public key %s: %w", k, err)
+	}
+	return KeyFingerprint(pub)
+}
+
+// Check returns an error describing every way that publishing pub to repo
+// violates the policy, or nil if it does not.
+func (p *Policy) Check(repo name.Repository, pub Publication) error {
+	var errs []error
+	for _, r := range p.Rules {
+		if ok, _ := path.Match(r.Destination, repo.Name()); !ok {
+			continue
+		}
+		errs = append(errs, r.check(repo, pub)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (r Rule) check(repo name.Repository, pub Publication) []error {
+	var errs []error
+	mustSign := r.Signed || len(r.Keys) != 0
+	switch {
+	case mustSign && !pub.Signed():
+		errs = append(errs, fmt.Errorf("%s must be signed (rule %q)", repo, r.Destination))
+	case pub.Key != nil && len(r.Keys) != 0:
+		fp, err := KeyFingerprint(pub.Key)
+		if err != nil {
+			errs = append(errs, err)
+		} else if !slices.Contains(r.fingerprints, fp) {
+			errs = append(errs, fmt.Errorf("%s must not be signed with key %s (rule %q)", repo, fp, r.Destination))
+		}
+	}
+	for _, att := range r.Attestations {
+		if !slices.Contains(pub.Attestations, att) {
+			errs = append(errs, fmt.Errorf("%s must carry a %q attestation (rule %q)", repo, att, r.Destination))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/sign"
+)
+
+const policy = `
+rules:
+  - destination: registry.example.com/prod/*
+    signed: true
+    attestations:
+      - https://spdx.dev/Document
+  - destination: registry.example.com/keyed
+    keys:
+      - cosign.pub
+`
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cosign.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(policy), 0o644))
+
+	// Keys are read relative to the policy.
+	p, err := sign.LoadPolicy(filepath.Join(dir, "policy.yaml"))
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name    string
+		repo    string
+		pub     sign.Publication
+		wantErr bool
+	}{{
+		name: "unmatched destination",
+		repo: "registry.example.com/dev/app",
+	}, {
+		name:    "unsigned",
+		repo:    "registry.example.com/prod/app",
+		pub:     sign.Publication{Attestations: []string{"https://spdx.dev/Document"}},
+		wantErr: true,
+	}, {
+		name:    "missing attestation",
+		repo:    "registry.example.com/prod/app",
+		pub:     sign.Publication{Key: other.Public()},
+		wantErr: true,
+	}, {
+		name: "satisfied",
+		repo: "registry.example.com/prod/app",
+		pub:  sign.Publication{Key: other.Public(), Attestations: []string{"https://spdx.dev/Document"}},
+	}, {
+		name:    "wrong key",
+		repo:    "registry.example.com/keyed",
+		pub:     sign.Publication{Key: other.Public()},
+		wantErr: true,
+	}, {
+		name: "right key",
+		repo: "registry.example.com/keyed",
+		pub:  sign.Publication{Key: key.Public()},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := name.NewRepository(tt.repo)
+			require.NoError(t, err)
+			err = p.Check(repo, tt.pub)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPolicyFingerprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	fp, err := sign.KeyFingerprint(key.Public())
+	require.NoError(t, err)
+
+	p, err := sign.ParsePolicy([]byte("rules:\n  - destination: registry.example.com/keyed\n    keys:\n      - " + fp + "\n"))
+	require.NoError(t, err)
+	repo, err := name.NewRepository("registry.example.com/keyed")
+	require.NoError(t, err)
+	require.NoError(t, p.Check(repo, sign.Publication{Key: key.Public()}))
+
+	// A key that can't be read fails parsing, rather than matching nothing.
+	_, err = sign.ParsePolicy([]byte("rules:\n  - destination: registry.example.com/keyed\n    keys:\n      - missing.pub\n"))
+	require.Error(t, err)
+}
+
+func TestParsePolicyRejectsUnknownFields(t *testing.T) {
+	_, err := sign.ParsePolicy([]byte("rules:\n  - destination: foo\n    sigend: true\n"))
+	require.Error(t, err)
+}
+
+func TestParsePolicyRejectsIdentities(t *testing.T) {
+	_, err := sign.ParsePolicy([]byte(`rules:
+  - destination: registry.example.com/prod/*
+    identities:
+      - issuer: https://token.actions.githubusercontent.com
+        subject: release
+`))
+	require.ErrorContains(t, err, "keyless signing is not supported")
+}
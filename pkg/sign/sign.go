@@ -0,0 +1,332 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/events"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of cosign signature payloads.
+	SimpleSigningMediaType ggcrtypes.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// SignatureAnnotation holds the base64 encoded signature of a payload.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// SignatureArtifactType is the artifact type of signatures stored as
+	// referrers.
+	SignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+)
+
+// Signer signs published manifests with a private key.
+type Signer struct {
+	// Ref is how the key was referred to.
+	Ref string
+	// Referrers stores signatures with the OCI 1.1 referrers API, as
+	// artifacts whose subject is the signed manifest, instead of at .sig
+	// tags. Registries without the referrers API get the fallback tag
+	// schema instead.
+	Referrers bool
+
+	key crypto.Signer
+}
+
+// LoadKey reads a PEM private key from path: either an unencrypted PKCS #8,
+// SEC 1 EC or PKCS #1 RSA key, such as one made with
+//
+//	openssl genpkey -algorithm ec -pkeyopt ec_paramgen_curve:P-256
+//
+// or an encrypted key of cosign generate-key-pair, decrypted with the
+// password in COSIGN_PASSWORD, as cosign does. Keys held in a KMS are loaded
+// with LoadKMSKey instead. Keyless signing, with Fulcio certificates and
+// Rekor entries, is not supported.
+func LoadKey(path string) (*Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		password, ok := os.LookupEnv("COSIGN_PASSWORD")
+		if !ok {
+			return nil, fmt.Errorf("%s holds an encrypted cosign key, set COSIGN_PASSWORD to decrypt it", path)
+		}
+		var der []byte
+		if der, err = decryptCosignKey(block.Bytes, []byte(password)); err != nil {
+			return nil, fmt.Errorf("decrypting %s: %w", path, err)
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	default:
+		if strings.Contains(block.Type, "ENCRYPTED") {
+			return nil, fmt.Errorf("%s holds an encrypted key (%s), which is not supported", path, block.Type)
+		}
+		return nil, fmt.Errorf("%s holds an unsupported %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %T, which can't sign", path, key)
+	}
+	return &Signer{Ref: path, key: signer}, nil
+}
+
+// encryptedKey is how cosign encrypts private keys: sealed with NaCl
+// secretbox under a key derived from the password with scrypt.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// decryptCosignKey returns the PKCS #8 DER private key that cosign
+// encrypted with password into b.
+func decryptCosignKey(b, password []byte) ([]byte, error) {
+	var ek encryptedKey
+	if err := json.Unmarshal(b, &ek); err != nil {
+		return nil, fmt.Errorf("parsing encrypted key: %w", err)
+	}
+	if ek.KDF.Name != "scrypt" || ek.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported key encryption %s with %s", ek.Cipher.Name, ek.KDF.Name)
+	}
+	var nonce [24]byte
+	if len(ek.Cipher.Nonce) != len(nonce) {
+		return nil, fmt.Errorf("invalid nonce length %d", len(ek.Cipher.Nonce))
+	}
+	copy(nonce[:], ek.Cipher.Nonce)
+
+	derived, err := scrypt.Key(password, ek.KDF.Salt, ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	var secret [32]byte
+	copy(secret[:], derived)
+	der, ok := secretbox.Open(nil, ek.Ciphertext, &nonce, &secret)
+	if !ok {
+		return nil, errors.New("wrong password")
+	}
+	return der, nil
+}
+
+// NewSigner returns a Signer for key, referred to as ref.
+// This allows signing with keys held anywhere else, such as in an HSM.
+func NewSigner(ref string, key crypto.Signer) *Signer {
+	return &Signer{Ref: ref, key: key}
+}
+
+// Public returns the public key of s, which signing policies match on.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// SignPayload signs payload the way cosign verifies it with the matching
+// public key.
+func (s *Signer) SignPayload(payload []byte) ([]byte, error) {
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return s.key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+	h := sha256.Sum256(payload)
+	return s.key.Sign(rand.Reader, h[:], crypto.SHA256)
+}
+
+// Sign signs each of digests and pushes the signatures where cosign looks for
+// them: to the sha256-<hex>.sig tag of the same repository, where signatures
+// that are already there are kept, or as referrers if s.Referrers is set.
+// It returns the references the signatures were pushed to.
+func (s *Signer) Sign(ctx context.Context, digests []name.Digest, remoteOpts ...remote.Option) ([]name.Reference, error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "Sign")
+	defer span.End()
+	// Pushes are cancelled with ctx.
+	remoteOpts = append(slices.Clip(remoteOpts), remote.WithContext(ctx))
+
+	refs := make([]name.Reference, 0, len(digests))
+	for _, dig := range digests {
+		payload, err := simpleSigningPayload(dig)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := s.SignPayload(payload)
+		if err != nil {
+			return nil, fmt.Errorf("signing %s: %w", dig, err)
+		}
+		sigLayer := mutate.Addendum{
+			Layer:     static.NewLayer(payload, SimpleSigningMediaType),
+			MediaType: SimpleSigningMediaType,
+			Annotations: map[string]string{
+				SignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+			},
+		}
+
+		if s.Referrers {
+			ref, err := pushReferrer(ctx, dig, sigLayer, SignatureArtifactType, remoteOpts...)
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("signed %s as %s", dig, ref)
+			refs = append(refs, ref)
+			continue
+		}
+
+		tag := dig.Context().Tag(strings.Replace(dig.DigestStr(), ":", "-", 1) + ".sig")
+		base, err := existingSignatures(tag, remoteOpts...)
+		if err != nil {
+			return nil, err
+		}
+		img, err := mutate.Append(base, sigLayer)
+		if err != nil {
+			return nil, fmt.Errorf("appending signature: %w", err)
+		}
+
+		log.With("tag", tag.String(), "digest", dig.String()).Infof("signing %s as %s", dig, tag)
+		if err := remote.Write(tag, img, remoteOpts...); err != nil {
+			return nil, fmt.Errorf("writing signature for %s: %w", dig, err)
+		}
+		h, err := img.Digest()
+		if err != nil {
+			return nil, err
+		}
+		events.Emit(ctx, events.Event{
+			Type:      events.ArtifactPublished,
+			Reference: tag.String(),
+			Digest:    h.String(),
+		})
+		refs = append(refs, tag)
+	}
+	return refs, nil
+}
+
+// pushReferrer pushes sig as an artifact of artifactType referring to dig.
+func pushReferrer(ctx context.Context, dig name.Digest, sig mutate.Addendum, artifactType string, remoteOpts ...remote.Option) (name.Digest, error) {
+	subject, err := remote.Head(dig, remoteOpts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("getting descriptor of %s: %w", dig, err)
+	}
+	img, err := mutate.Append(mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1), sig)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("appending signature: %w", err)
+	}
+	img = mutate.ConfigMediaType(img, ggcrtypes.MediaType(artifactType))
+	img = mutate.Subject(img, v1.Descriptor{
+		MediaType: subject.MediaType,
+		Digest:    subject.Digest,
+		Size:      subject.Size,
+	}).(v1.Image)
+
+	h, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	ref := dig.Context().Digest(h.String())
+	if err := remote.Write(ref, img, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("writing signature for %s: %w", dig, err)
+	}
+	events.Emit(ctx, events.Event{
+		Type:      events.ArtifactPublished,
+		Reference: ref.String(),
+		Digest:    h.String(),
+	})
+	return ref, nil
+}
+
+// existingSignatures returns the signature image at tag, or an empty one.
+func existingSignatures(tag name.Tag, remoteOpts ...remote.Option) (v1.Image, error) {
+	img, err := remote.Image(tag, remoteOpts...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("fetching existing signatures: %w", err)
+	}
+	return img, nil
+}
+
+func simpleSigningPayload(dig name.Digest) ([]byte, error) {
+	type identity struct {
+		DockerReference string `json:"docker-reference"`
+	}
+	type image struct {
+		DockerManifestDigest string `json:"docker-manifest-digest"`
+	}
+	type critical struct {
+		Identity identity `json:"identity"`
+		Image    image    `json:"image"`
+		Type     string   `json:"type"`
+	}
+	return json.Marshal(struct {
+		Critical critical `json:"critical"`
+		Optional any      `json:"optional"`
+	}{
+		Critical: critical{
+			Identity: identity{DockerReference: dig.Context().String()},
+			Image:    image{DockerManifestDigest: dig.DigestStr()},
+			Type:     "cosign container image signature",
+		},
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/sigstore/pkg/signature/kms/fake"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"chainguard.dev/apko/pkg/sign"
+)
+
+func TestSign(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	signer, err := sign.LoadKey(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, keyPath, signer.Ref)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	h, err := img.Digest()
+	require.NoError(t, err)
+	dig, err := name.NewDigest(fmt.Sprintf("%s/test/sign@%s", u.Host, h))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(dig, img, ropt...))
+
+	// Signing twice keeps both signatures.
+	for range 2 {
+		tags, err := signer.Sign(ctx, []name.Digest{dig}, ropt...)
+		require.NoError(t, err)
+		require.Len(t, tags, 1)
+		require.Equal(t, "sha256-"+h.Hex+".sig", tags[0].Identifier())
+	}
+
+	sigs, err := remote.Image(dig.Context().Tag("sha256-"+h.Hex+".sig"), ropt...)
+	require.NoError(t, err)
+	m, err := sigs.Manifest()
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 2)
+
+	layers, err := sigs.Layers()
+	require.NoError(t, err)
+	for i, l := range layers {
+		require.Equal(t, sign.SimpleSigningMediaType, m.Layers[i].MediaType)
+		rc, err := l.Uncompressed()
+		require.NoError(t, err)
+		payload, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.Contains(t, string(payload), h.String())
+
+		sig, err := base64.StdEncoding.DecodeString(m.Layers[i].Annotations[sign.SignatureAnnotation])
+		require.NoError(t, err)
+		sum := sha256.Sum256(payload)
+		require.True(t, ecdsa.VerifyASN1(&key.PublicKey, sum[:], sig))
+	}
+}
+
+func TestSignReferrers(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := sign.NewSigner("test", key)
+	signer.Referrers = true
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	h, err := img.Digest()
+	require.NoError(t, err)
+	dig, err := name.NewDigest(fmt.Sprintf("%s/test/sign@%s", u.Host, h))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(dig, img, ropt...))
+
+	refs, err := signer.Sign(ctx, []name.Digest{dig}, ropt...)
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+
+	referrers, err := remote.Referrers(dig, ropt...)
+	require.NoError(t, err)
+	im, err := referrers.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 1)
+	require.Equal(t, sign.SignatureArtifactType, im.Manifests[0].ArtifactType)
+	require.Equal(t, refs[0].Identifier(), im.Manifests[0].Digest.String())
+}
+
+func TestAttest(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	ropt := []remote.Option{remote.WithTransport(s.Client().Transport)}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := sign.NewSigner("test", key)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	h, err := img.Digest()
+	require.NoError(t, err)
+	dig, err := name.NewDigest(fmt.Sprintf("%s/test/attest@%s", u.Host, h))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(dig, img, ropt...))
+
+	tags, err := signer.Attest(ctx, []sign.Attestation{{
+		Subject:       dig,
+		PredicateType: "https://spdx.dev/Document",
+		Predicate:     json.RawMessage(`{"spdxVersion":"SPDX-2.3"}`),
+	}}, ropt...)
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+	require.Equal(t, "sha256-"+h.Hex+".att", tags[0].Identifier())
+
+	atts, err := remote.Image(tags[0], ropt...)
+	require.NoError(t, err)
+	m, err := atts.Manifest()
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 1)
+	require.Equal(t, sign.DSSEMediaType, m.Layers[0].MediaType)
+	require.Equal(t, "https://spdx.dev/Document", m.Layers[0].Annotations[sign.PredicateTypeAnnotation])
+
+	layers, err := atts.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     []byte `json:"payload"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	}
+	require.NoError(t, json.NewDecoder(rc).Decode(&envelope))
+	require.Equal(t, sign.InTotoPayloadType, envelope.PayloadType)
+	require.Len(t, envelope.Signatures, 1)
+	sum := sha256.Sum256(sign.PAE(envelope.PayloadType, envelope.Payload))
+	require.True(t, ecdsa.VerifyASN1(&key.PublicKey, sum[:], envelope.Signatures[0].Sig))
+
+	var statement struct {
+		Type    string `json:"_type"`
+		Subject []struct {
+			Name   string            `json:"name"`
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		Predicate map[string]string `json:"predicate"`
+	}
+	require.NoError(t, json.Unmarshal(envelope.Payload, &statement))
+	require.Equal(t, sign.InTotoStatementType, statement.Type)
+	require.Len(t, statement.Subject, 1)
+	require.Equal(t, dig.Context().String(), statement.Subject[0].Name)
+	require.Equal(t, map[string]string{"sha256": h.Hex}, statement.Subject[0].Digest)
+	require.Equal(t, "SPDX-2.3", statement.Predicate["spdxVersion"])
+}
+
+func TestLoadKeyEncrypted(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	// Encrypt the key the way cosign generate-key-pair does, with cheaper
+	// scrypt parameters.
+	salt := make([]byte, 32)
+	var nonce [24]byte
+	_, err = rand.Read(salt)
+	require.NoError(t, err)
+	_, err = rand.Read(nonce[:])
+	require.NoError(t, err)
+	derived, err := scrypt.Key([]byte("hunter2"), salt, 1024, 8, 1, 32)
+	require.NoError(t, err)
+	var secret [32]byte
+	copy(secret[:], derived)
+	b, err := json.Marshal(map[string]any{
+		"kdf":        map[string]any{"name": "scrypt", "params": map[string]int{"N": 1024, "r": 8, "p": 1}, "salt": salt},
+		"cipher":     map[string]any{"name": "nacl/secretbox", "nonce": nonce[:]},
+		"ciphertext": secretbox.Seal(nil, der, &nonce, &secret),
+	})
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: b}), 0o600))
+
+	t.Setenv("COSIGN_PASSWORD", "wrong")
+	_, err = sign.LoadKey(keyPath)
+	require.ErrorContains(t, err, "wrong password")
+
+	t.Setenv("COSIGN_PASSWORD", "hunter2")
+	signer, err := sign.LoadKey(keyPath)
+	require.NoError(t, err)
+	require.True(t, key.PublicKey.Equal(signer.Public()))
+}
+
+func TestLoadKeyRejectsEncrypted(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("x")}), 0o600))
+	_, err := sign.LoadKey(keyPath)
+	require.ErrorContains(t, err, "encrypted")
+}
+
+func TestLoadKMSKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), fake.KmsCtxKey{}, key)
+
+	ref := fake.ReferenceScheme + "key"
+	require.True(t, sign.IsKMSRef(ref))
+	require.False(t, sign.IsKMSRef(filepath.Join("testdata", "cosign.key")))
+
+	signer, err := sign.LoadKMSKey(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, ref, signer.Ref)
+	require.True(t, key.PublicKey.Equal(signer.Public()))
+
+	payload := []byte("payload")
+	sig, err := signer.SignPayload(payload)
+	require.NoError(t, err)
+	sum := sha256.Sum256(payload)
+	require.True(t, ecdsa.VerifyASN1(&key.PublicKey, sum[:], sig))
+
+	_, err = sign.LoadKMSKey(ctx, "nosuchkms://key")
+	require.Error(t, err)
+}
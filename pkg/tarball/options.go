@@ -0,0 +1,105 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"time"
+)
+
+type options struct {
+	order     func(a, b string) int
+	mtime     func(time.Time) time.Time
+	owner     *owner
+	names     bool
+	xattrs    bool
+	closeTail bool
+}
+
+type owner struct {
+	uid, gid int
+}
+
+func defaultOptions() options {
+	return options{
+		names:     true,
+		xattrs:    true,
+		closeTail: true,
+	}
+}
+
+// Option configures how a tarball is written.
+type Option func(*options)
+
+// WithOrder sorts entries by path with cmp rather than emitting them in
+// walk order (lexical, directory by directory). All entries are collected
+// before the first one is yielded.
+func WithOrder(cmp func(a, b string) int) Option {
+	return func(o *options) {
+		o.order = cmp
+	}
+}
+
+// WithModTime sets the modification time of every entry to t.
+func WithModTime(t time.Time) Option {
+	return func(o *options) {
+		o.mtime = func(time.Time) time.Time { return t }
+	}
+}
+
+// WithClampedModTime caps the modification time of every entry at t,
+// leaving older entries untouched. This matches the SOURCE_DATE_EPOCH
+// convention for reproducible builds.
+func WithClampedModTime(t time.Time) Option {
+	return func(o *options) {
+		o.mtime = func(mt time.Time) time.Time {
+			if mt.After(t) {
+				return t
+			}
+			return mt
+		}
+	}
+}
+
+// WithOwner sets the owner of every entry to uid and gid, and omits the
+// user and group names.
+func WithOwner(uid, gid int) Option {
+	return func(o *options) {
+		o.owner = &owner{uid: uid, gid: gid}
+	}
+}
+
+// WithUserGroupNames controls whether user and group names are resolved
+// from etc/passwd and etc/group in the filesystem. Enabled by default.
+func WithUserGroupNames(names bool) Option {
+	return func(o *options) {
+		o.names = names
+	}
+}
+
+// WithXattrs controls whether extended attributes of files and
+// directories are recorded as PAX records. Enabled by default.
+func WithXattrs(xattrs bool) Option {
+	return func(o *options) {
+		o.xattrs = xattrs
+	}
+}
+
+// WithClose controls whether Write closes the tar.Writer, writing the
+// end-of-archive marker, once all entries are written. Enabled by default.
+func WithClose(closeTail bool) Option {
+	return func(o *options) {
+		o.closeTail = closeTail
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tarball writes deterministic tar archives from an apkfs.FullFS.
+//
+// Given the same filesystem contents and options, Write always produces
+// byte-identical output. This is the writer apko uses for image layers.
+//
+// Entries are written in a stable order, their extended attributes are
+// recorded as PAX records, which archive/tar sorts, and hardlinks always
+// point at an entry written before them. Options normalize the
+// modification times and ownership of entries.
+package tarball
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"slices"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sys/unix"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/passwd"
+)
+
+// XattrPAXRecordsPrefix is the PAX record prefix extended attributes are
+// recorded under.
+const XattrPAXRecordsPrefix = "SCHILY.xattr."
+
+// Write writes a tarball to the provided tar.Writer from the provided fs.FS.
+// The etc/passwd and etc/group file provide username and group name mappings for the tar.
+func Write(ctx context.Context, tw *tar.Writer, fsys apkfs.FullFS, opts ...Option) error {
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "writeTar")
+	defer span.End()
+
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	buf := make([]byte, 1<<20)
+
+	for f, err := range Walk(ctx, fsys, opts...) {
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(f.Header); err != nil {
+			return err
+		}
+
+		if f.Info.Mode().IsRegular() && f.Header.Size > 0 {
+			data, err := fsys.Open(f.Path)
+			if err != nil {
+				return err
+			}
+			defer data.Close()
+
+			if _, err := io.CopyBuffer(tw, data, buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !o.closeTail {
+		return nil
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	return nil
+}
+
+// Entry holds all the info we need to yield from Walk.
+//
+// We need both Header and Info because the fs.DirEntry.Info()
+// implementation is controlled by our tarfs implementation,
+// and we use that as a sidechannel to propagate package ownership.
+type Entry struct {
+	Path   string
+	Info   fs.FileInfo
+	Header *tar.Header
+}
+
+// Walk yields the tar entry for each path in fsys, in the order Write would
+// write them.
+func Walk(ctx context.Context, fsys apkfs.FullFS, opts ...Option) iter.Seq2[*Entry, error] {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.order == nil {
+		return linkForward(walk(ctx, fsys, o))
+	}
+
+	return linkForward(func(yield func(*Entry, error) bool) {
+		var entries []*Entry
+		for e, err := range walk(ctx, fsys, o) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			entries = append(entries, e)
+		}
+		slices.SortStableFunc(entries, func(a, b *Entry) int {
+			return o.order(a.Path, b.Path)
+		})
+		for _, e := range entries {
+			if !yield(e, nil) {
+				return
+			}
+		}
+	})
+}
+
+// linkForward rewrites hardlinks so that each points at an entry that comes
+// before it. Packages name the file a hardlink points at, which may come
+// after the link in the tarball; extracting it would then fail. The first
+// entry of each group of hardlinks instead holds the contents, and the rest,
+// the original target included, link to it.
+func linkForward(entries iter.Seq2[*Entry, error]) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		written := map[string]bool{}
+		// moved maps a hardlink target not written yet to the entry that
+		// holds its contents instead.
+		moved := map[string]string{}
+		for e, err := range entries {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			hdr := e.Header
+			switch {
+			case hdr.Typeflag == tar.TypeLink && !written[hdr.Linkname]:
+				if first, ok := moved[hdr.Linkname]; ok {
+					hdr.Linkname = first
+					break
+				}
+				moved[hdr.Linkname] = hdr.Name
+				hdr.Typeflag = tar.TypeReg
+				hdr.Linkname = ""
+				hdr.Size = e.Info.Size()
+			case hdr.Typeflag == tar.TypeReg && moved[hdr.Name] != "":
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = moved[hdr.Name]
+				hdr.Size = 0
+			}
+			written[hdr.Name] = true
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+func walk(ctx context.Context, fsys apkfs.FullFS, o options) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		users := map[int]string{}
+		groups := map[int]string{}
+		if o.names && o.owner == nil {
+			usersFile, _ := passwd.ReadUserFile(fsys, "etc/passwd")
+			groupsFile, _ := passwd.ReadGroupFile(fsys, "etc/group")
+			for _, u := range usersFile.Entries {
+				users[int(u.UID)] = u.UserName
+			}
+			for _, g := range groupsFile.Entries {
+				groups[int(g.GID)] = g.GroupName
+			}
+		}
+
+		if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// skip the root path, superfluous
+			if path == "." {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			var link string
+			if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+				if link, err = fsys.Readlink(path); err != nil {
+					return err
+				}
+			}
+
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+
+			if info.Mode()&os.ModeCharDevice == os.ModeCharDevice {
+				dev, err := fsys.Readnod(path)
+				if err != nil {
+					return err
+				}
+				header.Devmajor = int64(unix.Major(uint64(dev)))
+				header.Devminor = int64(unix.Minor(uint64(dev)))
+			}
+
+			// tar.FileInfoHeader sets Name to the base name of the file,
+			// which is weird, because tar.Header.Name is the full path.
+			// In some cases, that does make sense, because fs.FileInfo.Name()
+			// is only the basename, but in tar.FileInfoHeader, it populates
+			// many of the fields based on the fs.FileInfo.Sys() method returning
+			// a tar.Header, which _does_ have the full path!
+			//
+			// Regardless, we want to override the name with the full path, here,
+			// because this path represents the full path _as written into this fs_,
+			// which might be different from the original tar.Header's full path.
+			header.Name = path
+
+			header.ModTime = info.ModTime()
+			if o.mtime != nil {
+				header.ModTime = o.mtime(header.ModTime)
+			}
+
+			if o.owner != nil {
+				header.Uid, header.Gid = o.owner.uid, o.owner.gid
+				header.Uname, header.Gname = "", ""
+			} else if o.names {
+				if name, ok := users[header.Uid]; ok {
+					header.Uname = name
+				}
+				if name, ok := groups[header.Gid]; ok {
+					header.Gname = name
+				}
+			}
+
+			if link != "" {
+				header.Typeflag = tar.TypeSymlink
+			}
+
+			if header.PAXRecords == nil {
+				header.PAXRecords = map[string]string{}
+			}
+
+			// only capture xattrs for real objects in the FS
+			if o.xattrs && (header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeDir) {
+				xattrs, err := fsys.ListXattrs(path)
+				// we can ignore errors
+				if err == nil && xattrs != nil {
+					for name, value := range xattrs {
+						header.PAXRecords[XattrPAXRecordsPrefix+name] = string(value)
+					}
+				}
+			}
+
+			if !yield(&Entry{
+				Path:   path,
+				Info:   info,
+				Header: header,
+			}, nil) {
+				return fs.SkipAll
+			}
+
+			return nil
+		}); err != nil {
+			if !yield(nil, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/tarball"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+func testFS(t *testing.T) fs.FullFS {
+	t.Helper()
+
+	m := fs.NewMemFS()
+	require.NoError(t, m.MkdirAll("etc", 0o755))
+	require.NoError(t, m.WriteFile("etc/passwd", []byte("root:x:0:0:root:/root:/bin/sh\n"), 0o644))
+	require.NoError(t, m.WriteFile("etc/group", []byte("root:x:0:\n"), 0o644))
+	require.NoError(t, m.MkdirAll("a", 0o755))
+	require.NoError(t, m.WriteFile("a/b", []byte("hello world"), 0o644))
+	require.NoError(t, m.SetXattr("a/b", "user.file", []byte("bar")))
+	require.NoError(t, m.Chtimes("a/b", time.Unix(2000, 0), time.Unix(2000, 0)))
+	return m
+}
+
+func headers(t *testing.T, b []byte) []*tar.Header {
+	t.Helper()
+
+	var hdrs []*tar.Header
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hdrs
+		}
+		require.NoError(t, err)
+		hdrs = append(hdrs, hdr)
+	}
+}
+
+func write(t *testing.T, fsys fs.FullFS, opts ...tarball.Option) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, tarball.Write(context.Background(), tar.NewWriter(&buf), fsys, opts...))
+	return buf.Bytes()
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	fsys := testFS(t)
+	require.Equal(t, write(t, fsys), write(t, fsys))
+}
+
+func TestWriteDefaults(t *testing.T) {
+	hdrs := headers(t, write(t, testFS(t)))
+
+	names := make([]string, 0, len(hdrs))
+	for _, hdr := range hdrs {
+		names = append(names, hdr.Name)
+	}
+	require.Equal(t, []string{"a", "a/b", "etc", "etc/group", "etc/passwd"}, names)
+
+	file := hdrs[1]
+	require.Equal(t, "root", file.Uname)
+	require.Equal(t, "root", file.Gname)
+	require.Equal(t, "bar", file.PAXRecords[tarball.XattrPAXRecordsPrefix+"user.file"])
+	require.Equal(t, int64(2000), file.ModTime.Unix())
+}
+
+func TestWriteOptions(t *testing.T) {
+	epoch := time.Unix(1000, 0)
+
+	hdrs := headers(t, write(t, testFS(t),
+		tarball.WithOrder(func(a, b string) int { return -strings.Compare(a, b) }),
+		tarball.WithClampedModTime(epoch),
+		tarball.WithOwner(65532, 65532),
+		tarball.WithXattrs(false),
+	))
+
+	require.Equal(t, "etc/passwd", hdrs[0].Name)
+	for _, hdr := range hdrs {
+		require.False(t, hdr.ModTime.After(epoch), "%s not clamped", hdr.Name)
+		require.Equal(t, 65532, hdr.Uid)
+		require.Equal(t, 65532, hdr.Gid)
+		require.Empty(t, hdr.Uname)
+		require.Empty(t, hdr.PAXRecords)
+	}
+
+	for _, hdr := range headers(t, write(t, testFS(t), tarball.WithModTime(epoch))) {
+		require.True(t, hdr.ModTime.Equal(epoch), "%s mtime not overridden", hdr.Name)
+	}
+}
+
+func TestWriteHardlinks(t *testing.T) {
+	m := tarfs.New()
+	require.NoError(t, m.MkdirAll("bin", 0o755))
+	require.NoError(t, m.WriteFile("bin/z", []byte("hello world"), 0o755))
+	for _, name := range []string{"bin/a", "bin/b"} {
+		_, err := m.WriteHeader(tar.Header{Typeflag: tar.TypeLink, Name: name, Linkname: "bin/z"}, nil, nil)
+		require.NoError(t, err)
+	}
+
+	b := write(t, m)
+	hdrs := headers(t, b)
+	require.Len(t, hdrs, 4)
+
+	// The first of the links holds the contents, and the others point at it.
+	require.Equal(t, "bin/a", hdrs[1].Name)
+	require.Equal(t, byte(tar.TypeReg), hdrs[1].Typeflag)
+	require.Equal(t, int64(len("hello world")), hdrs[1].Size)
+	for _, hdr := range hdrs[2:] {
+		require.Equal(t, byte(tar.TypeLink), hdr.Typeflag, hdr.Name)
+		require.Equal(t, "bin/a", hdr.Linkname, hdr.Name)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(b))
+	for range 2 {
+		_, err := tr.Next()
+		require.NoError(t, err)
+	}
+	data, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+}